@@ -6,6 +6,7 @@
 -- 1. 启用必要的扩展
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 CREATE EXTENSION IF NOT EXISTS "pgcrypto";
+CREATE EXTENSION IF NOT EXISTS "pg_trgm";
 
 -- 2. 创建 moonshot schema
 CREATE SCHEMA IF NOT EXISTS "moonshot";
@@ -0,0 +1,85 @@
+// Package audit 记录任务和分类的写操作，供合规审计追溯操作人和操作内容
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/freedkr/moonshot/internal/database"
+)
+
+// 审计的操作
+const (
+	ActionTaskCreate         = "task.create"
+	ActionTaskImport         = "task.import"
+	ActionTaskMerge          = "task.merge" // 合并两个任务的分类为新任务
+	ActionTaskCancel         = "task.cancel"
+	ActionTaskDelete         = "task.delete"
+	ActionTaskEnrichMissing  = "task.enrich_missing" // 重新执行缺失分类的LLM增强
+	ActionTaskReprocess      = "task.reprocess"      // 以原任务ID重新处理已结束的任务
+	ActionCategoryOverride   = "categories.override"
+	ActionCategoryBulkUpdate = "categories.bulk_update"
+	ActionHierarchyRebuild   = "categories.rebuild_hierarchy"
+)
+
+// 操作对象类型，目前的对象都以任务ID标识
+const (
+	EntityTask       = "task"
+	EntityCategories = "categories" // 任务下的分类数据，明细在 details 中
+)
+
+// ActorHeader 传递操作人的请求头，接入认证后由认证中间件设置
+const ActorHeader = "X-Auth-User"
+
+// AnonymousActor 请求未携带操作人时记录的操作人
+const AnonymousActor = "anonymous"
+
+// Store 审计日志的存储，由 database.DatabaseInterface 实现
+type Store interface {
+	CreateAuditLog(ctx context.Context, entry *database.AuditLog) error
+}
+
+// Logger 审计日志记录器，nil 或未设置存储时不记录
+type Logger struct {
+	store Store
+}
+
+// NewLogger 创建审计日志记录器
+func NewLogger(store Store) *Logger {
+	return &Logger{store: store}
+}
+
+// Record 记录一次写操作。写入是尽力而为的：失败只写日志，不影响主操作；
+// 请求结束后 ctx 被取消时仍会写入
+func (l *Logger) Record(ctx context.Context, action, entity, entityID, actor string, details interface{}) {
+	if l == nil || l.store == nil {
+		return
+	}
+	if actor == "" {
+		actor = AnonymousActor
+	}
+
+	entry := &database.AuditLog{Action: action, Entity: entity, EntityID: entityID, Actor: actor}
+	if details != nil {
+		data, err := json.Marshal(details)
+		if err != nil {
+			log.Printf("序列化审计详情失败 - Action=%s, EntityID=%s, Error=%v", action, entityID, err)
+		} else {
+			entry.Details = data
+		}
+	}
+	if err := l.store.CreateAuditLog(context.WithoutCancel(ctx), entry); err != nil {
+		log.Printf("WARNING: 写入审计日志失败 - Action=%s, EntityID=%s, Actor=%s, Error=%v", action, entityID, actor, err)
+	}
+}
+
+// ActorFromRequest 从请求头获取操作人，未携带时为 anonymous
+func ActorFromRequest(r *http.Request) string {
+	if actor := strings.TrimSpace(r.Header.Get(ActorHeader)); actor != "" {
+		return actor
+	}
+	return AnonymousActor
+}
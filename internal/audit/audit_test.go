@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+)
+
+type fakeStore struct {
+	entries []*database.AuditLog
+	err     error
+}
+
+func (s *fakeStore) CreateAuditLog(ctx context.Context, entry *database.AuditLog) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if s.err != nil {
+		return s.err
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func TestLogger_Record(t *testing.T) {
+	store := &fakeStore{}
+	logger := NewLogger(store)
+
+	// 请求已结束时仍写入
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	logger.Record(ctx, ActionTaskCreate, EntityTask, "task-1", "", map[string]string{"type": "rule"})
+	if len(store.entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(store.entries))
+	}
+	entry := store.entries[0]
+	if entry.Actor != AnonymousActor || entry.Action != ActionTaskCreate || string(entry.Details) != `{"type":"rule"}` {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+
+	// 写入失败不影响调用方
+	store.err = errors.New("db down")
+	logger.Record(context.Background(), ActionTaskDelete, EntityTask, "task-1", "alice", nil)
+
+	var nilLogger *Logger
+	nilLogger.Record(context.Background(), ActionTaskCreate, EntityTask, "task-1", "alice", nil)
+	NewLogger(nil).Record(context.Background(), ActionTaskCreate, EntityTask, "task-1", "alice", nil)
+}
+
+func TestActorFromRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if actor := ActorFromRequest(req); actor != AnonymousActor {
+		t.Errorf("Expected %s, got %s", AnonymousActor, actor)
+	}
+	req.Header.Set(ActorHeader, " alice ")
+	if actor := ActorFromRequest(req); actor != "alice" {
+		t.Errorf("Expected alice, got %s", actor)
+	}
+}
@@ -19,6 +19,11 @@ type HierarchyBuilderImpl struct {
 type BuilderConfig struct {
 	EnableOrphanHandling bool `yaml:"enable_orphan_handling" json:"enable_orphan_handling"`
 	StrictMode           bool `yaml:"strict_mode" json:"strict_mode"`
+	CreateMissingParents bool `yaml:"create_missing_parents" json:"create_missing_parents"`
+
+	// 词典格式：编码各级之间的分隔符和按分隔符数量排列的层级名称，为空时使用国家职业分类大典的 "-" 和大类、中类、小类、细类
+	Separator string   `yaml:"separator" json:"separator"`
+	Levels    []string `yaml:"levels" json:"levels"`
 }
 
 // 层级级别常量
@@ -29,6 +34,9 @@ const (
 	LevelDetail = "细类"
 )
 
+// PlaceholderName 自动补全的父节点使用的占位名称
+const PlaceholderName = "(未命名)"
+
 // NewHierarchyBuilder 创建新的层级构建器
 func NewHierarchyBuilder(config *BuilderConfig) *HierarchyBuilderImpl {
 	if config == nil {
@@ -45,6 +53,11 @@ func NewHierarchyBuilder(config *BuilderConfig) *HierarchyBuilderImpl {
 
 // Build 构建层级结构
 func (b *HierarchyBuilderImpl) Build(ctx context.Context, records []*model.ParsedInfo) ([]*model.Category, error) {
+	return b.build(ctx, records, b.config.CreateMissingParents)
+}
+
+// build 构建层级结构，createMissingParents 为 true 时自动补全缺失的父节点
+func (b *HierarchyBuilderImpl) build(ctx context.Context, records []*model.ParsedInfo, createMissingParents bool) ([]*model.Category, error) {
 	nodeMap := make(map[string]*model.Category)
 	var rootCategories []*model.Category
 
@@ -71,6 +84,11 @@ func (b *HierarchyBuilderImpl) Build(ctx context.Context, records []*model.Parse
 		}
 	}
 
+	// 可选：沿编码链向上补全缺失的父节点，保证树完全连通
+	if createMissingParents {
+		b.synthesizeMissingParents(nodeMap)
+	}
+
 	// 第二步：建立父子关系（严格遵循原始数据）
 	for _, node := range nodeMap {
 		parentCode, hasParent := b.getParentCode(node.Code)
@@ -112,30 +130,63 @@ func (b *HierarchyBuilderImpl) Build(ctx context.Context, records []*model.Parse
 	return rootCategories, nil
 }
 
+// synthesizeMissingParents 为缺失父节点的编码创建占位节点
+func (b *HierarchyBuilderImpl) synthesizeMissingParents(nodeMap map[string]*model.Category) {
+	codes := make([]string, 0, len(nodeMap))
+	for code := range nodeMap {
+		codes = append(codes, code)
+	}
+
+	for _, code := range codes {
+		parentCode, hasParent := b.getParentCode(code)
+		for hasParent {
+			if _, exists := nodeMap[parentCode]; exists {
+				break
+			}
+			nodeMap[parentCode] = &model.Category{
+				Code:        parentCode,
+				Name:        PlaceholderName,
+				Level:       b.determineLevel(parentCode),
+				Synthesized: true,
+			}
+			log.Printf("ℹ️ 为编码 '%s' 补全缺失的父节点 '%s'", code, parentCode)
+			parentCode, hasParent = b.getParentCode(parentCode)
+		}
+	}
+}
+
+// separator 返回编码各级之间的分隔符
+func (b *HierarchyBuilderImpl) separator() string {
+	if b.config.Separator == "" {
+		return "-"
+	}
+	return b.config.Separator
+}
+
+// levels 返回按分隔符数量排列的层级名称
+func (b *HierarchyBuilderImpl) levels() []string {
+	if len(b.config.Levels) == 0 {
+		return []string{LevelMajor, LevelMiddle, LevelSmall, LevelDetail}
+	}
+	return b.config.Levels
+}
+
 // determineLevel 确定节点级别
 func (b *HierarchyBuilderImpl) determineLevel(code string) string {
-	level := strings.Count(code, "-")
-	switch level {
-	case 0:
-		return LevelMajor
-	case 1:
-		return LevelMiddle
-	case 2:
-		return LevelSmall
-	case 3:
-		return LevelDetail
-	default:
-		return "未知级别"
+	level := strings.Count(code, b.separator())
+	if levels := b.levels(); level < len(levels) {
+		return levels[level]
 	}
+	return "未知级别"
 }
 
 // getParentCode 获取父节点编码
 func (b *HierarchyBuilderImpl) getParentCode(code string) (string, bool) {
-	lastDash := strings.LastIndex(code, "-")
-	if lastDash == -1 {
+	lastSep := strings.LastIndex(code, b.separator())
+	if lastSep == -1 {
 		return "", false
 	}
-	return code[:lastDash], true
+	return code[:lastSep], true
 }
 
 // Validate 验证层级结构
@@ -168,7 +219,7 @@ func (b *HierarchyBuilderImpl) validateCategory(category *model.Category, errors
 	}
 
 	// 验证级别是否有效
-	validLevels := []string{LevelMajor, LevelMiddle, LevelSmall, LevelDetail}
+	validLevels := b.levels()
 	isValidLevel := false
 	for _, validLevel := range validLevels {
 		if category.Level == validLevel {
@@ -177,7 +228,7 @@ func (b *HierarchyBuilderImpl) validateCategory(category *model.Category, errors
 		}
 	}
 	if !isValidLevel {
-		errors.Add(model.NewValidationError("level", category.Level, "oneof=大类 中类 小类 细类", "无效的分类级别"))
+		errors.Add(model.NewValidationError("level", category.Level, "oneof="+strings.Join(validLevels, " "), "无效的分类级别"))
 	}
 
 	// 验证编码格式
@@ -197,21 +248,20 @@ func (b *HierarchyBuilderImpl) isValidCode(code string) bool {
 		return false
 	}
 
-	// 简单的格式验证：应该只包含数字和连字符
-	for _, char := range code {
-		if !((char >= '0' && char <= '9') || char == '-') {
+	for _, part := range strings.Split(code, b.separator()) {
+		// 不能以分隔符开始或结束，不能有连续的分隔符
+		if part == "" {
 			return false
 		}
-	}
-
-	// 不能以连字符开始或结束
-	if strings.HasPrefix(code, "-") || strings.HasSuffix(code, "-") {
-		return false
-	}
-
-	// 不能有连续的连字符
-	if strings.Contains(code, "--") {
-		return false
+		// 默认格式的编码只包含数字和连字符，其他词典格式的编码由解析器的编码正则约束
+		if b.config.Separator != "" {
+			continue
+		}
+		for _, char := range part {
+			if char < '0' || char > '9' {
+				return false
+			}
+		}
 	}
 
 	return true
@@ -253,9 +303,19 @@ func (b *HierarchyBuilderImpl) collectStatistics(category *model.Category, level
 }
 
 // BuildWithOptions 使用选项构建层级结构
+// 支持补全缺失父节点和按 SortBy/SortOrder 排序，未指定排序时按编码升序
 func (b *HierarchyBuilderImpl) BuildWithOptions(ctx context.Context, records []*model.ParsedInfo, options *BuildOptions) ([]*model.Category, error) {
-	// 简单实现，暂时忽略options
-	return b.Build(ctx, records)
+	if options == nil {
+		return b.Build(ctx, records)
+	}
+	categories, err := b.build(ctx, records, options.CreateMissingParents || b.config.CreateMissingParents)
+	if err != nil {
+		return nil, err
+	}
+	if (options.SortBy != "" && options.SortBy != SortByCode) || options.SortOrder == OrderDesc {
+		sortTree(categories, options.SortBy, options.SortOrder)
+	}
+	return categories, nil
 }
 
 // GetName 获取构建器名称
@@ -284,3 +344,21 @@ func (b *HierarchyBuilderImpl) sortChildren(category *model.Category) {
 		b.sortChildren(child)
 	}
 }
+
+// sortTree 按指定字段和顺序递归排序各层节点，名称相同时按编码排序
+func sortTree(categories []*model.Category, by SortField, order SortOrder) {
+	sort.SliceStable(categories, func(i, j int) bool {
+		a, c := categories[i], categories[j]
+		if order == OrderDesc {
+			a, c = c, a
+		}
+		if by == SortByName && a.Name != c.Name {
+			return a.Name < c.Name
+		}
+		return a.Code < c.Code
+	})
+
+	for _, category := range categories {
+		sortTree(category.Children, by, order)
+	}
+}
@@ -74,6 +74,37 @@ func TestHierarchyBuilderImpl_determineLevel(t *testing.T) {
 	}
 }
 
+func TestHierarchyBuilderImpl_Build_CustomSchema(t *testing.T) {
+	builder := NewHierarchyBuilder(&BuilderConfig{
+		EnableOrphanHandling: true,
+		Separator:            ".",
+		Levels:               []string{"门类", "大组", "职业"},
+	})
+
+	records := []*model.ParsedInfo{
+		{Code: "B", Name: "专业人员"},
+		{Code: "B.1", Name: "科学和工程专业人员"},
+		{Code: "B.1.1", Name: "物理学家"},
+	}
+	categories, err := builder.Build(context.Background(), records)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(categories) != 1 || categories[0].Level != "门类" {
+		t.Fatalf("Expected one root with level 门类, got %+v", categories)
+	}
+	middle := categories[0].Children
+	if len(middle) != 1 || middle[0].Level != "大组" || len(middle[0].Children) != 1 || middle[0].Children[0].Level != "职业" {
+		t.Fatalf("Expected 门类 > 大组 > 职业, got %+v", middle)
+	}
+	if errorList := builder.Validate(categories); errorList != nil {
+		t.Errorf("Expected no validation errors, got %v", errorList.Errors)
+	}
+	if builder.isValidCode("B..1") || builder.determineLevel("B.1.1.1") != "未知级别" {
+		t.Error("Expected codes to follow the configured separator and levels")
+	}
+}
+
 func TestHierarchyBuilderImpl_getParentCode(t *testing.T) {
 	builder := NewHierarchyBuilder(nil)
 
@@ -185,6 +216,61 @@ func TestHierarchyBuilderImpl_Build_WithOrphans(t *testing.T) {
 	}
 }
 
+func TestHierarchyBuilderImpl_BuildWithOptions_CreateMissingParents(t *testing.T) {
+	orphanData := []*model.ParsedInfo{
+		{Code: "1", Name: "大类1", Level: 0},
+		{Code: "1-01-01", Name: "小类 - 缺少中类", Level: 2},
+		{Code: "2-01", Name: "中类 - 缺少大类", Level: 1},
+	}
+
+	builder := NewHierarchyBuilder(nil)
+	ctx := context.Background()
+
+	categories, err := builder.BuildWithOptions(ctx, orphanData, &BuildOptions{CreateMissingParents: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// 补全后应只剩两个根节点：1 和补全的 2
+	if len(categories) != 2 {
+		t.Fatalf("Expected 2 root categories, got %d", len(categories))
+	}
+
+	root1 := categories[0]
+	if root1.Code != "1" || root1.Synthesized {
+		t.Errorf("Expected original root '1', got '%s' (synthesized=%v)", root1.Code, root1.Synthesized)
+	}
+	if len(root1.Children) != 1 {
+		t.Fatalf("Expected 1 child for root '1', got %d", len(root1.Children))
+	}
+
+	middle := root1.Children[0]
+	if middle.Code != "1-01" || !middle.Synthesized || middle.Name != PlaceholderName {
+		t.Errorf("Expected synthesized placeholder '1-01', got code='%s' name='%s' synthesized=%v",
+			middle.Code, middle.Name, middle.Synthesized)
+	}
+	if middle.Level != LevelMiddle {
+		t.Errorf("Expected level '%s' for placeholder, got '%s'", LevelMiddle, middle.Level)
+	}
+	if len(middle.Children) != 1 || middle.Children[0].Code != "1-01-01" {
+		t.Errorf("Expected '1-01-01' under placeholder '1-01'")
+	}
+
+	root2 := categories[1]
+	if root2.Code != "2" || !root2.Synthesized {
+		t.Errorf("Expected synthesized root '2', got '%s' (synthesized=%v)", root2.Code, root2.Synthesized)
+	}
+	if len(root2.Children) != 1 || root2.Children[0].Code != "2-01" || root2.Children[0].Synthesized {
+		t.Errorf("Expected original '2-01' under placeholder '2'")
+	}
+
+	// 严格模式下补全父节点后不应再报错
+	strictBuilder := NewHierarchyBuilder(&BuilderConfig{StrictMode: true, CreateMissingParents: true})
+	if _, err := strictBuilder.Build(ctx, orphanData); err != nil {
+		t.Errorf("Expected no error in strict mode with CreateMissingParents, got %v", err)
+	}
+}
+
 func TestHierarchyBuilderImpl_Build_WithDuplicates(t *testing.T) {
 	// 创建包含重复编码的测试数据
 	duplicateData := []*model.ParsedInfo{
@@ -226,6 +312,36 @@ func TestHierarchyBuilderImpl_BuildWithOptions(t *testing.T) {
 	}
 }
 
+func TestHierarchyBuilderImpl_BuildWithOptions_Sort(t *testing.T) {
+	records := []*model.ParsedInfo{
+		{Code: "1", Name: "乙", Level: 0},
+		{Code: "2", Name: "甲", Level: 0},
+		{Code: "1-01", Name: "中类B", Level: 1},
+		{Code: "1-02", Name: "中类A", Level: 1},
+	}
+
+	builder := NewHierarchyBuilder(nil)
+	ctx := context.Background()
+
+	categories, err := builder.BuildWithOptions(ctx, records, &BuildOptions{SortBy: SortByCode, SortOrder: OrderDesc})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if categories[0].Code != "2" || categories[1].Children[0].Code != "1-02" {
+		t.Errorf("Expected descending code order, got roots %s,%s and children of '1' starting with %s",
+			categories[0].Code, categories[1].Code, categories[1].Children[0].Code)
+	}
+
+	categories, err = builder.BuildWithOptions(ctx, records, &BuildOptions{SortBy: SortByName})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if categories[0].Name != "乙" || categories[0].Children[0].Name != "中类A" {
+		t.Errorf("Expected ascending name order, got root '%s' and first child '%s'",
+			categories[0].Name, categories[0].Children[0].Name)
+	}
+}
+
 func TestHierarchyBuilderImpl_Validate(t *testing.T) {
 	builder := NewHierarchyBuilder(nil)
 
@@ -0,0 +1,58 @@
+// Package clock 可替换的时间源
+// 调度循环、轮询和超时通过 Clock 获取时间，生产代码使用 Real，测试使用 Fake 手动推进时间，
+// 无需真实等待即可覆盖超时和退避分支
+package clock
+
+import "time"
+
+// Clock 时间源
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker 周期触发器，与 time.Ticker 相同，接收方跟不上时丢弃多余的触发
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real 返回系统时钟
+func Real() Clock {
+	return realClock{}
+}
+
+// OrReal c 为 nil 时返回系统时钟，用于未注入时钟的零值结构体
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real()
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
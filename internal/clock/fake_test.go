@@ -0,0 +1,84 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake_AfterFiresOnAdvance(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+
+	ch := c.After(time.Minute)
+	c.Advance(59 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("Expected After not to fire before the deadline")
+	default:
+	}
+
+	c.Advance(time.Second)
+	select {
+	case got := <-ch:
+		if !got.Equal(start.Add(time.Minute)) {
+			t.Errorf("Expected fire time %v, got %v", start.Add(time.Minute), got)
+		}
+	default:
+		t.Fatal("Expected After to fire at the deadline")
+	}
+	if n := c.Waiters(); n != 0 {
+		t.Errorf("Expected fired waiter to be removed, got %d", n)
+	}
+}
+
+func TestFake_TickerFiresOncePerAdvanceAndStops(t *testing.T) {
+	c := NewFake(time.Now())
+	ticker := c.NewTicker(time.Second)
+
+	// 一次推进多个周期只触发一次，与 time.Ticker 丢弃多余触发一致
+	c.Advance(3 * time.Second)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Fatal("Expected a single tick")
+	default:
+	}
+
+	c.Advance(time.Second)
+	<-ticker.C()
+
+	ticker.Stop()
+	c.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("Expected no tick after Stop")
+	default:
+	}
+}
+
+func TestFake_BlockUntil(t *testing.T) {
+	c := NewFake(time.Now())
+	fired := make(chan struct{})
+	go func() {
+		<-c.After(time.Hour)
+		close(fired)
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(time.Hour)
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected waiter registered before BlockUntil returned to fire")
+	}
+}
+
+func TestOrReal(t *testing.T) {
+	if _, ok := OrReal(nil).(realClock); !ok {
+		t.Error("Expected OrReal(nil) to return the real clock")
+	}
+	fake := NewFake(time.Now())
+	if OrReal(fake) != Clock(fake) {
+		t.Error("Expected OrReal to keep the injected clock")
+	}
+}
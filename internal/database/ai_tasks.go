@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrHybridParseResultNotFound 任务没有保存混合解析结果
+var ErrHybridParseResultNotFound = errors.New("混合解析结果不存在")
+
+// SaveHybridParseResult 保存任务的混合解析结果，同一任务重复处理时覆盖旧记录
+func (p *PostgreSQLDB) SaveHybridParseResult(ctx context.Context, result *HybridParseResult) error {
+	err := p.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"ai_task_count", "ai_tasks", "stats", "updated_at"}),
+	}).Create(result).Error
+	if err != nil {
+		return fmt.Errorf("保存混合解析结果失败: %w", err)
+	}
+	return nil
+}
+
+// GetHybridParseResult 获取任务的混合解析结果
+func (p *PostgreSQLDB) GetHybridParseResult(ctx context.Context, taskID string) (*HybridParseResult, error) {
+	var result HybridParseResult
+	err := p.db.WithContext(ctx).Where("task_id = ?", taskID).First(&result).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrHybridParseResultNotFound, taskID)
+		}
+		return nil, fmt.Errorf("获取混合解析结果失败: %w", err)
+	}
+	return &result, nil
+}
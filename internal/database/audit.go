@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// CreateAuditLog 追加一条审计日志
+func (p *PostgreSQLDB) CreateAuditLog(ctx context.Context, entry *AuditLog) error {
+	if err := p.db.WithContext(ctx).Create(entry).Error; err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	return nil
+}
+
+// ListAuditLogs 按时间倒序分页获取审计日志，entityID 为空时返回全部；返回当前页和总数
+func (p *PostgreSQLDB) ListAuditLogs(ctx context.Context, entityID string, limit, offset int) ([]*AuditLog, int64, error) {
+	query := p.db.WithContext(ctx).Model(&AuditLog{})
+	if entityID != "" {
+		query = query.Where("entity_id = ?", entityID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计审计日志失败: %w", err)
+	}
+	var entries []*AuditLog
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		return nil, 0, fmt.Errorf("获取审计日志失败: %w", err)
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDiffCategoryVersions_IgnoresInputOrder(t *testing.T) {
+	// 按不区分大小写的排序规则返回的顺序，与Go的字节序不同
+	from := []*Category{
+		{Code: "a-01", Name: "甲"},
+		{Code: "B-01", Name: "乙"},
+		{Code: "b-02", Name: "丙"},
+		{Code: "C-01", Name: "丁"},
+	}
+	to := []*Category{
+		{Code: "a-01", Name: "甲"},
+		{Code: "b-02", Name: "丙（修订）"},
+		{Code: "B-01", Name: "乙"},
+		{Code: "c-01", Name: "戊"},
+	}
+
+	diff := diffCategoryVersions(from, to, 0)
+	if diff.AddedCount != 1 || diff.RemovedCount != 1 || diff.ModifiedCount != 1 {
+		t.Fatalf("Expected 1 added, 1 removed, 1 modified, got %+v", diff)
+	}
+	changes := make(map[string]string)
+	for _, change := range diff.Changes {
+		changes[change.Code] = change.ChangeType
+	}
+	expected := map[string]string{"C-01": ChangeTypeRemoved, "b-02": ChangeTypeModified, "c-01": ChangeTypeAdded}
+	for code, changeType := range expected {
+		if changes[code] != changeType {
+			t.Errorf("%s: expected %s, got %q", code, changeType, changes[code])
+		}
+	}
+	if from[1].Code != "B-01" {
+		t.Error("排序不应修改调用方的切片")
+	}
+}
+
+func TestDiffCategoryVersions_DuplicateCodesInBatch(t *testing.T) {
+	from := []*Category{
+		{Code: "1-01", Name: "甲"},
+		{Code: "1-02", Name: "乙"},
+		{Code: "1-01", Name: "甲（重复）"},
+	}
+	to := []*Category{
+		{Code: "1-02", Name: "乙"},
+		{Code: "1-01", Name: "甲"},
+	}
+
+	diff := diffCategoryVersions(from, to, 0)
+	if diff.AddedCount != 0 || diff.RemovedCount != 0 || diff.ModifiedCount != 0 {
+		t.Errorf("同一批次内重复的编码只取第一条，不应产生变更，got %+v", diff)
+	}
+}
+
+func TestGetCategoryVersionDiff(t *testing.T) {
+	ctx := context.Background()
+	db := newWriterTestDB(t)
+	taskID := "2b4d6f8a-0c2e-4a4b-8d6f-8a0c2e4a6b8d"
+	firstBatch := "3c5e7a9b-1d3f-4b5c-9e7a-9b1d3f5b7c9e"
+	secondBatch := "4d6f8a0c-2e4a-4c6d-8f8a-0c2e4a6c8d0f"
+
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, firstBatch, writerCategories(taskID, 3, "名")); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+	changed := writerCategories(taskID, 4, "名")
+	changed[1].Name = "改名"
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, secondBatch, changed); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+
+	diff, err := db.GetCategoryVersionDiff(ctx, taskID, firstBatch, secondBatch, 0)
+	if err != nil {
+		t.Fatalf("对比版本失败: %v", err)
+	}
+	if diff.AddedCount != 1 || diff.RemovedCount != 0 || diff.ModifiedCount != 1 {
+		t.Errorf("Expected 1 added and 1 modified, got %+v", diff)
+	}
+
+	// 同一版本与自身比较没有变更
+	same, err := db.GetCategoryVersionDiff(ctx, taskID, firstBatch, firstBatch, 0)
+	if err != nil {
+		t.Fatalf("对比版本失败: %v", err)
+	}
+	if same.AddedCount != 0 || same.RemovedCount != 0 || same.ModifiedCount != 0 || len(same.Changes) != 0 {
+		t.Errorf("Expected empty diff for the same batch, got %+v", same)
+	}
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm/clause"
+)
+
+// likeEscaper 转义 LIKE 模式中的通配符，搜索词按字面匹配
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchCurrentCategories 在任务当前版本中按名称搜索分类（不区分大小写的子串匹配），
+// 名称以搜索词开头的排在前面，其余按编码排序；返回当前页和匹配总数
+// Postgres上 lower(name) 的trigram索引支持该查询，见 ensureSearchIndexes
+func (p *PostgreSQLDB) SearchCurrentCategories(ctx context.Context, taskID string, q string, limit, offset int) ([]*Category, int64, error) {
+	escaped := likeEscaper.Replace(strings.ToLower(q))
+	query := p.db.WithContext(ctx).Model(&Category{}).
+		Where("task_id = ? AND is_current = ?", taskID, true).
+		Where(`LOWER(name) LIKE ? ESCAPE '\'`, "%"+escaped+"%")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计搜索结果失败: %w", err)
+	}
+
+	var categories []*Category
+	err := query.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:  `CASE WHEN LOWER(name) LIKE ? ESCAPE '\' THEN 0 ELSE 1 END, code`,
+		Vars: []interface{}{escaped + "%"},
+	}}).Limit(limit).Offset(offset).Find(&categories).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("搜索分类失败: %w", err)
+	}
+	return categories, total, nil
+}
+
+// GetCurrentCategoriesByCodes 批量获取任务当前版本中指定编码的分类，按编码返回
+func (p *PostgreSQLDB) GetCurrentCategoriesByCodes(ctx context.Context, taskID string, codes []string) (map[string]*Category, error) {
+	result := make(map[string]*Category, len(codes))
+	if len(codes) == 0 {
+		return result, nil
+	}
+
+	var categories []*Category
+	err := p.db.WithContext(ctx).
+		Where("task_id = ? AND is_current = ? AND code IN ?", taskID, true, codes).
+		Find(&categories).Error
+	if err != nil {
+		return nil, fmt.Errorf("批量获取分类失败: %w", err)
+	}
+	for _, category := range categories {
+		result[category.Code] = category
+	}
+	return result, nil
+}
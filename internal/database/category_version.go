@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/freedkr/moonshot/internal/model"
+	"gorm.io/gorm"
+)
+
+// CategoryContentHasher 计算一组分类的内容哈希，只取编码、名称、层级和父级编码，结果与添加顺序无关。
+// 处理状态、PDF和LLM信息不参与计算，同一份Excel重新解析得到的哈希相同
+type CategoryContentHasher struct {
+	rows []string
+}
+
+// Add 添加一条分类
+func (h *CategoryContentHasher) Add(code, name, level, parentCode string) {
+	h.rows = append(h.rows, strings.Join([]string{code, name, level, parentCode}, "\x1f"))
+}
+
+// Sum 返回十六进制的内容哈希
+func (h *CategoryContentHasher) Sum() string {
+	sort.Strings(h.rows)
+	sum := sha256.New()
+	for _, row := range h.rows {
+		sum.Write([]byte(row))
+		sum.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// CategoryContentHash 计算分类的内容哈希
+func CategoryContentHash(categories []*Category) string {
+	var h CategoryContentHasher
+	for _, cat := range categories {
+		h.Add(cat.Code, cat.Name, cat.Level, cat.ParentCode)
+	}
+	return h.Sum()
+}
+
+// FlatCategoryContentHash 计算扁平分类的内容哈希，与这些分类写入数据库后 CategoryContentHash 的结果相同
+func FlatCategoryContentHash(flat []model.FlatCategory) string {
+	var h CategoryContentHasher
+	for _, item := range flat {
+		h.Add(item.Code, item.Name, item.Level, item.ParentCode)
+	}
+	return h.Sum()
+}
+
+// SaveFlatCategoryVersion 将展开后的分类树以 excel_parsed 状态保存为任务的新版本，返回写入的记录数。
+// 当前版本内容相同时直接复用，不写入新版本，也不修改已有的处理状态，返回复用的批次ID。
+// worker 保存层级结构和增量流程的步骤1都通过它写入，同一棵树在两处得到相同的内容哈希；
+// 写入经 CategoryWriter 按 flushSize 分批提交，只限制单个事务的大小，flat 本身仍完整保存在内存中
+func SaveFlatCategoryVersion(ctx context.Context, db DatabaseInterface, taskID, batchID string, flat []model.FlatCategory, flushSize int) (reused string, written int, err error) {
+	if len(flat) == 0 {
+		return "", 0, nil
+	}
+	existing, err := db.FindCurrentVersionByContent(ctx, taskID, FlatCategoryContentHash(flat))
+	if err != nil {
+		return "", 0, err
+	}
+	if existing != "" {
+		return existing, 0, nil
+	}
+
+	writer := db.NewCategoryWriter(taskID, batchID, flushSize)
+	for _, item := range flat {
+		err := writer.Write(ctx, &Category{
+			TaskID:     taskID,
+			Code:       item.Code,
+			Name:       item.Name,
+			Level:      item.Level,
+			ParentCode: item.ParentCode,
+			Status:     StatusExcelParsed,
+			DataSource: DataSourceExcel,
+		})
+		if err != nil {
+			abortCategoryWriter(writer, batchID)
+			return "", 0, err
+		}
+	}
+	written, err = writer.Commit(ctx)
+	if err != nil {
+		abortCategoryWriter(writer, batchID)
+		return "", 0, fmt.Errorf("提交分类版本失败: %w", err)
+	}
+	return "", written, nil
+}
+
+// abortCategoryWriter 删除未提交的分类批次，使用独立context以便任务取消后仍能清理
+func abortCategoryWriter(writer *CategoryWriter, batchID string) {
+	if err := writer.Abort(context.Background()); err != nil {
+		log.Printf("警告：清理未提交的分类批次 %s 失败: %v", batchID, err)
+	}
+}
+
+// CurrentVersionWithContent 在 tx 中检查任务当前版本的内容哈希是否等于 hash，相同时返回当前版本的批次ID，否则返回空字符串。
+// 没有当前版本或当前版本跨多个批次时视为不同
+func CurrentVersionWithContent(tx *gorm.DB, taskID, hash string) (string, error) {
+	var rows []*Category
+	err := tx.Model(&Category{}).
+		Select("code", "name", "level", "parent_code", "upload_batch_id").
+		Where("task_id = ? AND is_current = true", taskID).
+		Find(&rows).Error
+	if err != nil {
+		return "", fmt.Errorf("查询当前版本失败: %w", err)
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+	batchID := rows[0].UploadBatchID
+	for _, row := range rows {
+		if row.UploadBatchID != batchID {
+			return "", nil
+		}
+	}
+	if CategoryContentHash(rows) != hash {
+		return "", nil
+	}
+	return batchID, nil
+}
+
+// FindCurrentVersionByContent 返回内容哈希等于 hash 的当前版本批次ID，不存在时返回空字符串；
+// 用于任务重试时复用内容相同的版本，避免版本历史中出现重复的完整版本
+func (p *PostgreSQLDB) FindCurrentVersionByContent(ctx context.Context, taskID, hash string) (string, error) {
+	return CurrentVersionWithContent(p.db.WithContext(ctx), taskID, hash)
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestCategoryContentHash_IgnoresOrderAndProcessingFields(t *testing.T) {
+	a := writerCategories("t", 3, "名")
+	b := writerCategories("t", 3, "名")
+	b[0], b[2] = b[2], b[0]
+	b[1].Status = StatusCompleted
+	b[1].LLMEnhancements = `{"confidence":0.9}`
+
+	if CategoryContentHash(a) != CategoryContentHash(b) {
+		t.Error("顺序和处理字段不同不应影响内容哈希")
+	}
+
+	b[1].Name = "改名"
+	if CategoryContentHash(a) == CategoryContentHash(b) {
+		t.Error("名称不同时内容哈希应不同")
+	}
+}
+
+func TestBatchInsertCategoriesWithVersion_SkipsIdenticalContent(t *testing.T) {
+	ctx := context.Background()
+	db := newWriterTestDB(t)
+	taskID := "6f8b0d2f-4a6c-4d8e-9b0d-2f4a6c8e0b2d"
+	firstBatch := "7a9c1e3a-5b7d-4e9f-8c1e-3a5b7d9f1c3e"
+	retryBatch := "8b0d2f4b-6c8e-4f0a-9d2f-4b6c8e0a2d4f"
+	changedBatch := "9c1e3a5c-7d9f-4a1b-8e3a-5c7d9f1b3e5a"
+
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, firstBatch, writerCategories(taskID, 3, "名")); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, retryBatch, writerCategories(taskID, 3, "名")); err != nil {
+		t.Fatalf("重试插入失败: %v", err)
+	}
+
+	versions, err := db.GetCategoryVersionHistory(ctx, taskID)
+	if err != nil {
+		t.Fatalf("查询版本历史失败: %v", err)
+	}
+	if len(versions) != 1 || versions[0].UploadBatchID != firstBatch {
+		t.Fatalf("内容相同应复用第一个版本, got %+v", versions)
+	}
+
+	hash := CategoryContentHash(writerCategories(taskID, 3, "名"))
+	if batchID, err := db.FindCurrentVersionByContent(ctx, taskID, hash); err != nil || batchID != firstBatch {
+		t.Fatalf("FindCurrentVersionByContent = %q, %v", batchID, err)
+	}
+
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, changedBatch, writerCategories(taskID, 4, "名")); err != nil {
+		t.Fatalf("插入新内容失败: %v", err)
+	}
+	current, err := db.GetCurrentCategoriesByTaskID(ctx, taskID)
+	if err != nil {
+		t.Fatalf("查询当前版本失败: %v", err)
+	}
+	if len(current) != 4 || current[0].UploadBatchID != changedBatch {
+		t.Fatalf("内容不同应创建新版本, got %d", len(current))
+	}
+	if batchID, err := db.FindCurrentVersionByContent(ctx, taskID, hash); err != nil || batchID != "" {
+		t.Fatalf("旧内容不应匹配当前版本, got %q, %v", batchID, err)
+	}
+}
+
+func TestBatchInsertCategoriesWithVersion_InsertsInsideTransaction(t *testing.T) {
+	db := newWriterTestDB(t)
+	taskID := "1d3f5b7d-9e1a-4c3e-8f5b-7d9e1a3c5e7f"
+	firstBatch := "2e4a6c8e-0f2b-4d4f-9a6c-8e0f2b4d6f8a"
+	failedBatch := "3f5b7d9f-1a3c-4e5a-8b7d-9f1a3c5e7a9b"
+
+	// SQLite 只有一个连接，事务外的写入会等待事务释放连接而卡住
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, firstBatch, writerCategories(taskID, 3, "名")); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+
+	// 插入新版本失败时，旧版本的历史标记随事务一起回滚
+	insertErr := errors.New("插入失败")
+	if err := db.db.Callback().Create().Before("gorm:create").Register("test:fail_create", func(tx *gorm.DB) {
+		tx.AddError(insertErr)
+	}); err != nil {
+		t.Fatalf("注册回调失败: %v", err)
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, failedBatch, writerCategories(taskID, 4, "新")); !errors.Is(err, insertErr) {
+		t.Fatalf("期望插入错误, got %v", err)
+	}
+	db.db.Callback().Create().Remove("test:fail_create")
+
+	current, err := db.GetCurrentCategoriesByTaskID(ctx, taskID)
+	if err != nil {
+		t.Fatalf("查询当前版本失败: %v", err)
+	}
+	if len(current) != 3 || current[0].UploadBatchID != firstBatch {
+		t.Fatalf("插入失败后应保留原当前版本, got %d 条", len(current))
+	}
+}
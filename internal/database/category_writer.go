@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultCategoryFlushSize CategoryWriter 每次刷写的默认记录数
+const DefaultCategoryFlushSize = 1000
+
+// CategoryFlushSizeFromEnv 读取 CATEGORY_WRITE_FLUSH_SIZE，未配置或无效时使用 DefaultCategoryFlushSize
+func CategoryFlushSizeFromEnv() int {
+	v := os.Getenv("CATEGORY_WRITE_FLUSH_SIZE")
+	if v == "" {
+		return DefaultCategoryFlushSize
+	}
+	size, err := strconv.Atoi(v)
+	if err != nil || size <= 0 {
+		log.Printf("WARNING: CATEGORY_WRITE_FLUSH_SIZE 配置无效: %s，使用默认值 %d", v, DefaultCategoryFlushSize)
+		return DefaultCategoryFlushSize
+	}
+	return size
+}
+
+// CategoryWriter 分批写入任务的一个新版本分类，写入缓冲最多保留 flushSize 条记录，单个插入事务的大小因此有上限。
+// 它只限制写库环节，不是从解析器到数据库的流式写入：解析器一次读入整个工作表，
+// 按编码去重需要先看到全部记录，增量流程也以完整的分类树为输入，
+// 因此调用方（worker 保存层级和增量流程的步骤1）仍先构建并展开完整的分类树，整体内存占用与分类总数成正比。
+// 每次刷写在独立事务中以 is_current=false 插入，Commit 时在一个事务中将旧版本标记为历史、
+// 新批次标记为当前版本，因此写入过程中查询仍只看到旧版本；失败时调用 Abort 删除已写入的记录
+type CategoryWriter struct {
+	db        *gorm.DB
+	taskID    string
+	batchID   string
+	flushSize int
+	batchSize int
+
+	uploadTime time.Time
+	buffer     []*Category
+	written    int
+	done       bool
+}
+
+// NewCategoryWriter 创建分批写入器，flushSize <= 0 时使用 DefaultCategoryFlushSize
+func (p *PostgreSQLDB) NewCategoryWriter(taskID, batchID string, flushSize int) *CategoryWriter {
+	if flushSize <= 0 {
+		flushSize = DefaultCategoryFlushSize
+	}
+	return &CategoryWriter{
+		db:         p.db,
+		taskID:     taskID,
+		batchID:    batchID,
+		flushSize:  flushSize,
+		batchSize:  p.config.BatchSize,
+		uploadTime: time.Now(),
+		buffer:     make([]*Category, 0, flushSize),
+	}
+}
+
+// Write 追加分类，缓冲达到 flushSize 时刷写到数据库
+func (w *CategoryWriter) Write(ctx context.Context, categories ...*Category) error {
+	if w.done {
+		return fmt.Errorf("分类写入器已结束: %s", w.batchID)
+	}
+	for _, cat := range categories {
+		w.buffer = append(w.buffer, cat)
+		if len(w.buffer) >= w.flushSize {
+			if err := w.Flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush 在一个事务中写入缓冲中的分类，新记录在 Commit 之前不是当前版本
+func (w *CategoryWriter) Flush(ctx context.Context) error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	for _, cat := range w.buffer {
+		cat.TaskID = w.taskID
+		cat.UploadBatchID = w.batchID
+		cat.UploadTimestamp = w.uploadTime
+		cat.IsCurrent = false
+	}
+	err := w.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("id").CreateInBatches(w.buffer, w.batchSize).Error; err != nil {
+			return err
+		}
+		// is_current 为零值时 GORM 使用列默认值 true 插入，需在同一事务中改回 false
+		return tx.Model(&Category{}).
+			Where("task_id = ? AND upload_batch_id = ? AND is_current = true", w.taskID, w.batchID).
+			Update("is_current", false).Error
+	})
+	if err != nil {
+		return fmt.Errorf("写入分类失败: %w", err)
+	}
+	w.written += len(w.buffer)
+	// 清空引用，已写入的分类可以被回收
+	clear(w.buffer)
+	w.buffer = w.buffer[:0]
+	return nil
+}
+
+// Commit 写入剩余分类，并在一个事务中切换当前版本，返回写入的记录总数
+func (w *CategoryWriter) Commit(ctx context.Context) (int, error) {
+	if w.done {
+		return w.written, fmt.Errorf("分类写入器已结束: %s", w.batchID)
+	}
+	if err := w.Flush(ctx); err != nil {
+		return w.written, err
+	}
+	err := w.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Category{}).
+			Where("task_id = ? AND is_current = true", w.taskID).
+			Update("is_current", false).Error; err != nil {
+			return fmt.Errorf("标记历史版本失败: %w", err)
+		}
+		if err := tx.Model(&Category{}).
+			Where("task_id = ? AND upload_batch_id = ?", w.taskID, w.batchID).
+			Update("is_current", true).Error; err != nil {
+			return fmt.Errorf("标记当前版本失败: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return w.written, err
+	}
+	w.done = true
+	return w.written, nil
+}
+
+// Abort 丢弃缓冲并删除本批次已写入的分类，当前版本保持不变
+func (w *CategoryWriter) Abort(ctx context.Context) error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	w.buffer = nil
+	if w.written == 0 {
+		return nil
+	}
+	err := w.db.WithContext(ctx).
+		Where("task_id = ? AND upload_batch_id = ? AND is_current = false", w.taskID, w.batchID).
+		Delete(&Category{}).Error
+	if err != nil {
+		return fmt.Errorf("删除未提交的分类失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func newWriterTestDB(t *testing.T) *SQLiteDB {
+	t.Helper()
+	db, err := NewSQLiteDB(&SQLiteConfig{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.CreateTables(context.Background()); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	return db
+}
+
+func writerCategories(taskID string, n int, prefix string) []*Category {
+	categories := make([]*Category, n)
+	for i := range categories {
+		categories[i] = &Category{
+			TaskID:     taskID,
+			Code:       fmt.Sprintf("1-01-01-%02d", i+1),
+			Name:       fmt.Sprintf("%s%d", prefix, i+1),
+			Level:      "细类",
+			ParentCode: "1-01-01",
+			Status:     "excel_parsed",
+			DataSource: "excel",
+		}
+	}
+	return categories
+}
+
+func TestCategoryWriter_SwitchesVersionOnCommit(t *testing.T) {
+	ctx := context.Background()
+	db := newWriterTestDB(t)
+	taskID := "3c5e7a9c-1d3f-4a5c-8e7a-9c1d3f5a7c9e"
+	oldBatch := "4d6f8b0d-2e4a-4b6d-9f8b-0d2e4a6b8d0f"
+	newBatch := "5e7a9c1e-3f5b-4c7e-8a9c-1e3f5b7c9e1a"
+
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, oldBatch, writerCategories(taskID, 2, "旧")); err != nil {
+		t.Fatalf("插入旧版本失败: %v", err)
+	}
+
+	writer := db.NewCategoryWriter(taskID, newBatch, 3)
+	if err := writer.Write(ctx, writerCategories(taskID, 7, "新")...); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	// 已刷写两批，提交前查询仍只看到旧版本
+	current, err := db.GetCurrentCategoriesByTaskID(ctx, taskID)
+	if err != nil {
+		t.Fatalf("查询当前版本失败: %v", err)
+	}
+	if len(current) != 2 || current[0].UploadBatchID != oldBatch {
+		t.Fatalf("提交前应只有旧版本为当前版本, got %d", len(current))
+	}
+	flushed, err := db.GetCategoriesByBatchID(ctx, newBatch)
+	if err != nil {
+		t.Fatalf("查询新批次失败: %v", err)
+	}
+	if len(flushed) != 6 {
+		t.Fatalf("expected 6 flushed categories before commit, got %d", len(flushed))
+	}
+
+	written, err := writer.Commit(ctx)
+	if err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	if written != 7 {
+		t.Errorf("expected 7 written, got %d", written)
+	}
+	current, err = db.GetCurrentCategoriesByTaskID(ctx, taskID)
+	if err != nil {
+		t.Fatalf("查询当前版本失败: %v", err)
+	}
+	if len(current) != 7 {
+		t.Fatalf("expected 7 current categories, got %d", len(current))
+	}
+	for _, cat := range current {
+		if cat.UploadBatchID != newBatch || cat.TaskID != taskID {
+			t.Errorf("unexpected current category: %+v", cat)
+		}
+	}
+	if err := writer.Write(ctx, writerCategories(taskID, 1, "多余")...); err == nil {
+		t.Error("提交后写入应返回错误")
+	}
+}
+
+func TestCategoryWriter_AbortKeepsCurrentVersion(t *testing.T) {
+	ctx := context.Background()
+	db := newWriterTestDB(t)
+	taskID := "6f8b0d2f-4a6c-4d8f-9b0d-2f4a6c8e0b2d"
+	oldBatch := "7a9c1e3a-5b7d-4e9a-8c1e-3a5b7d9f1c3e"
+	newBatch := "8b0d2f4b-6c8e-4f0b-9d2f-4b6c8e0a2d4f"
+
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, oldBatch, writerCategories(taskID, 2, "旧")); err != nil {
+		t.Fatalf("插入旧版本失败: %v", err)
+	}
+	writer := db.NewCategoryWriter(taskID, newBatch, 2)
+	if err := writer.Write(ctx, writerCategories(taskID, 5, "新")...); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := writer.Abort(ctx); err != nil {
+		t.Fatalf("Abort失败: %v", err)
+	}
+
+	leftover, err := db.GetCategoriesByBatchID(ctx, newBatch)
+	if err != nil {
+		t.Fatalf("查询新批次失败: %v", err)
+	}
+	if len(leftover) != 0 {
+		t.Errorf("Abort后不应保留新批次记录, got %d", len(leftover))
+	}
+	current, err := db.GetCurrentCategoriesByTaskID(ctx, taskID)
+	if err != nil {
+		t.Fatalf("查询当前版本失败: %v", err)
+	}
+	if len(current) != 2 || current[0].UploadBatchID != oldBatch {
+		t.Errorf("Abort后旧版本应保持为当前版本, got %d", len(current))
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MetricsSnapshotFilter 查询指标快照的条件，字段为空值时不过滤
+type MetricsSnapshotFilter struct {
+	Source string
+	Stage  string
+	Since  time.Time
+	Until  time.Time
+}
+
+// SaveMetricsSnapshots 批量写入一次导出的指标快照
+func (p *PostgreSQLDB) SaveMetricsSnapshots(ctx context.Context, snapshots []*MetricsSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	if err := p.db.WithContext(ctx).Create(snapshots).Error; err != nil {
+		return fmt.Errorf("写入指标快照失败: %w", err)
+	}
+	return nil
+}
+
+// ListMetricsSnapshots 按时间顺序获取符合条件的指标快照
+func (p *PostgreSQLDB) ListMetricsSnapshots(ctx context.Context, filter MetricsSnapshotFilter) ([]*MetricsSnapshot, error) {
+	query := p.db.WithContext(ctx).Model(&MetricsSnapshot{})
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+	if filter.Stage != "" {
+		query = query.Where("stage = ?", filter.Stage)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	var snapshots []*MetricsSnapshot
+	if err := query.Order("created_at ASC, id ASC").Find(&snapshots).Error; err != nil {
+		return nil, fmt.Errorf("获取指标快照失败: %w", err)
+	}
+	return snapshots, nil
+}
+
+// PruneMetricsSnapshots 删除早于 olderThan 之前的指标快照，返回删除的行数
+func (p *PostgreSQLDB) PruneMetricsSnapshots(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if olderThan <= 0 {
+		return 0, fmt.Errorf("保留时长必须大于0: %v", olderThan)
+	}
+	result := p.db.WithContext(ctx).
+		Where("created_at < ?", time.Now().Add(-olderThan)).
+		Delete(&MetricsSnapshot{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("清理指标快照失败: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
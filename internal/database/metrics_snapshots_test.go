@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMetricsSnapshots(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewSQLiteDB(&SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	now := time.Now()
+	old := now.Add(-40 * 24 * time.Hour)
+	snapshots := []*MetricsSnapshot{
+		{Source: "worker-1", Stage: "llm_enhancement", DurationCount: 2, AvgDurationMs: 150, PeriodStart: now.Add(-time.Hour), CreatedAt: now.Add(-time.Hour)},
+		{Source: "worker-2", Stage: "llm_enhancement", DurationCount: 1, AvgDurationMs: 90, PeriodStart: now.Add(-time.Hour), CreatedAt: now},
+		{Source: "worker-1", Stage: "merge", SuccessCount: 3, PeriodStart: now.Add(-time.Hour), CreatedAt: now},
+		{Source: "worker-1", Stage: "llm_enhancement", DurationCount: 5, AvgDurationMs: 500, PeriodStart: old, CreatedAt: old},
+	}
+	if err := db.SaveMetricsSnapshots(ctx, snapshots); err != nil {
+		t.Fatalf("SaveMetricsSnapshots: %v", err)
+	}
+	if err := db.SaveMetricsSnapshots(ctx, nil); err != nil {
+		t.Fatalf("写入空快照应直接返回: %v", err)
+	}
+
+	got, err := db.ListMetricsSnapshots(ctx, MetricsSnapshotFilter{Stage: "llm_enhancement", Since: now.Add(-24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("ListMetricsSnapshots: %v", err)
+	}
+	if len(got) != 2 || got[0].Source != "worker-1" || got[1].Source != "worker-2" {
+		t.Fatalf("按阶段和时间过滤的结果错误: %+v", got)
+	}
+	got, err = db.ListMetricsSnapshots(ctx, MetricsSnapshotFilter{Source: "worker-1"})
+	if err != nil {
+		t.Fatalf("ListMetricsSnapshots: %v", err)
+	}
+	if len(got) != 3 || !got[0].CreatedAt.Equal(old) {
+		t.Fatalf("按实例过滤的结果应按时间排序: %+v", got)
+	}
+
+	deleted, err := db.PruneMetricsSnapshots(ctx, 30*24*time.Hour)
+	if err != nil {
+		t.Fatalf("PruneMetricsSnapshots: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("应删除1条过期快照，实际 %d", deleted)
+	}
+	if _, err := db.PruneMetricsSnapshots(ctx, 0); err == nil {
+		t.Error("保留时长为0时应返回错误")
+	}
+}
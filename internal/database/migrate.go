@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationModels 由 AutoMigrate 管理的模型
+var migrationModels = []interface{}{
+	&TaskRecord{},
+	&FileRecord{},
+	&ProcessingStats{},
+	&Category{},
+	&PDFResult{},
+	&PDFExtraction{},
+	&HybridParseResult{},
+	&CategoryOverride{},
+	&AuditLog{},
+	&MetricsSnapshot{},
+}
+
+// schemaVersionID 表结构版本记录的固定主键，表中只有一行
+const schemaVersionID = 1
+
+// SchemaVersion 已应用的表结构版本
+type SchemaVersion struct {
+	ID          int       `gorm:"primaryKey"`
+	Fingerprint string    `gorm:"type:varchar(64);not null"`
+	AppliedAt   time.Time `gorm:"not null"`
+}
+
+// TableName 指定表名
+func (SchemaVersion) TableName() string {
+	return "schema_versions"
+}
+
+// CreateTables 创建表结构
+// 多个实例同时启动时通过 Postgres advisory lock 串行执行迁移，其余实例等待；
+// 模型结构指纹与已记录版本一致时跳过 AutoMigrate
+func (p *PostgreSQLDB) CreateTables(ctx context.Context) error {
+	fingerprint := schemaFingerprint(migrationModels...)
+	lockKey := "moonshot:migrate:" + p.config.Schema
+
+	// advisory lock 是会话级的，加锁、迁移、解锁必须在同一个连接上
+	return p.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(hashtext(?))", lockKey).Error; err != nil {
+			return fmt.Errorf("获取迁移锁失败: %w", err)
+		}
+		defer func() {
+			// 使用独立的context解锁，避免ctx取消后锁随连接回到连接池
+			if err := conn.WithContext(context.Background()).Exec("SELECT pg_advisory_unlock(hashtext(?))", lockKey).Error; err != nil {
+				log.Printf("WARNING: 释放迁移锁失败: %v", err)
+			}
+		}()
+
+		if err := conn.AutoMigrate(&SchemaVersion{}); err != nil {
+			return fmt.Errorf("创建表结构版本表失败: %w", err)
+		}
+
+		var current SchemaVersion
+		err := conn.First(&current, schemaVersionID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("读取表结构版本失败: %w", err)
+		}
+		if err == nil && current.Fingerprint == fingerprint {
+			log.Printf("表结构已是最新版本 (%s)，跳过自动迁移", fingerprint[:12])
+			ensureSearchIndexes(conn)
+			return nil
+		}
+
+		// 使用 GORM 的 AutoMigrate 功能
+		if err := conn.AutoMigrate(migrationModels...); err != nil {
+			return fmt.Errorf("自动迁移失败: %w", err)
+		}
+
+		version := SchemaVersion{ID: schemaVersionID, Fingerprint: fingerprint, AppliedAt: time.Now()}
+		if err := conn.Save(&version).Error; err != nil {
+			return fmt.Errorf("记录表结构版本失败: %w", err)
+		}
+		log.Printf("表结构迁移完成，版本: %s", fingerprint[:12])
+		ensureSearchIndexes(conn)
+		return nil
+	})
+}
+
+// searchIndexStatements 名称搜索使用的Postgres专用索引，AutoMigrate 无法通过模型标签声明，
+// 且不在表结构指纹中，因此每次启动都以 IF NOT EXISTS 执行
+var searchIndexStatements = []string{
+	"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+	"CREATE INDEX IF NOT EXISTS idx_categories_name_trgm ON " + Category{}.TableName() + " USING gin (LOWER(name) gin_trgm_ops)",
+}
+
+// ensureSearchIndexes 创建名称搜索的trigram索引；数据库用户无权创建扩展时只记录警告，搜索仍可用但需要全表扫描
+func ensureSearchIndexes(conn *gorm.DB) {
+	for _, stmt := range searchIndexStatements {
+		if err := conn.Exec(stmt).Error; err != nil {
+			log.Printf("WARNING: 创建名称搜索索引失败，搜索将不使用索引: %v", err)
+			return
+		}
+	}
+}
+
+// schemaFingerprint 根据模型的字段名、类型和标签计算表结构指纹，模型定义变化时指纹随之变化
+func schemaFingerprint(models ...interface{}) string {
+	hash := sha256.New()
+	for _, m := range models {
+		t := reflect.TypeOf(m)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		fmt.Fprintf(hash, "model:%s\n", t.Name())
+		writeStructFields(hash, t)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// writeStructFields 写入结构体字段描述，展开匿名嵌入字段
+func writeStructFields(w io.Writer, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			writeStructFields(w, field.Type)
+			continue
+		}
+		fmt.Fprintf(w, "%s %s %s\n", field.Name, field.Type.String(), field.Tag)
+	}
+}
@@ -25,6 +25,15 @@ type TaskRecord struct {
 	ProcessedAt   *time.Time     `json:"processed_at,omitempty"`
 	CreatedBy     string         `json:"created_by,omitempty" gorm:"type:varchar(255)"`
 	ProcessingLog string         `json:"processing_log,omitempty" gorm:"type:text"`
+	ProcessedBy   string         `json:"processed_by,omitempty" gorm:"type:varchar(255)"` // 处理该任务的worker标识
+	ClaimedAt     *time.Time     `json:"claimed_at,omitempty" gorm:"index"`               // worker领取任务的时间，用于接管超时未完成的领取
+	FlowStartedAt *time.Time     `json:"flow_started_at,omitempty" gorm:"index"`          // 后台增量流程（PDF/LLM）的开始时间，流程结束后清空
+
+	// 任务结束时的回调通知
+	CallbackURL      string `json:"callback_url,omitempty" gorm:"type:text"`
+	CallbackStatus   string `json:"callback_status,omitempty" gorm:"type:varchar(50)"` // pending、delivered、failed
+	CallbackAttempts int    `json:"callback_attempts,omitempty" gorm:"not null;default:0"`
+	CallbackError    string `json:"callback_error,omitempty" gorm:"type:text"`
 }
 
 // FileRecord 文件记录
@@ -41,15 +50,16 @@ type FileRecord struct {
 
 // ProcessingStats 处理统计
 type ProcessingStats struct {
-	ID               string    `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
-	TaskID           string    `json:"task_id" gorm:"type:uuid;not null;index"`
-	TotalRecords     int       `json:"total_records" gorm:"not null;default:0"`
-	ProcessedRecords int       `json:"processed_records" gorm:"not null;default:0"`
-	SkippedRecords   int       `json:"skipped_records" gorm:"not null;default:0"`
-	ErrorRecords     int       `json:"error_records" gorm:"not null;default:0"`
-	ProcessingTimeMs int64     `json:"processing_time_ms" gorm:"not null;default:0"`
-	MemoryUsageMB    float64   `json:"memory_usage_mb" gorm:"type:decimal(10,2);not null;default:0"`
-	CreatedAt        time.Time `json:"created_at" gorm:"not null;default:now()"`
+	ID               string         `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	TaskID           string         `json:"task_id" gorm:"type:uuid;not null;index"`
+	TotalRecords     int            `json:"total_records" gorm:"not null;default:0"`
+	ProcessedRecords int            `json:"processed_records" gorm:"not null;default:0"`
+	SkippedRecords   int            `json:"skipped_records" gorm:"not null;default:0"`
+	ErrorRecords     int            `json:"error_records" gorm:"not null;default:0"`
+	ProcessingTimeMs int64          `json:"processing_time_ms" gorm:"not null;default:0"`
+	MemoryUsageMB    float64        `json:"memory_usage_mb" gorm:"type:decimal(10,2);not null;default:0"`
+	ParseWarnings    datatypes.JSON `json:"parse_warnings,omitempty" gorm:"type:jsonb"` // 解析时跳过的行及原因，最多保存前若干条
+	CreatedAt        time.Time      `json:"created_at" gorm:"not null;default:now()"`
 }
 
 // TableName 指定表名和schema
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// HybridParseResult 对应于数据库中的 hybrid_parse_results 表，每个任务一行，
+// 保存混合解析器以小类为单位打包的AI任务及解析统计，供检查V2混合方案和后续AI细类关联使用
+type HybridParseResult struct {
+	ID          uint           `gorm:"primarykey;autoIncrement" json:"-"`
+	TaskID      string         `gorm:"type:uuid;uniqueIndex" json:"task_id"`
+	AITaskCount int            `gorm:"not null;default:0" json:"ai_task_count"`
+	AITasks     datatypes.JSON `json:"ai_tasks"` // []*model.AITask
+	Stats       datatypes.JSON `json:"stats"`    // model.HybridParseStats
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (HybridParseResult) TableName() string {
+	return "moonshot.hybrid_parse_results"
+}
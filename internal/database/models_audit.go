@@ -0,0 +1,22 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// AuditLog 对应于数据库中的 audit_log 表，记录任务和分类的写操作，只追加不修改
+type AuditLog struct {
+	ID        uint           `gorm:"primarykey;autoIncrement" json:"id"`
+	Action    string         `gorm:"type:varchar(100);not null;index" json:"action"`    // 操作，如 task.create
+	Entity    string         `gorm:"type:varchar(50);not null" json:"entity"`           // 操作对象类型
+	EntityID  string         `gorm:"type:varchar(255);not null;index" json:"entity_id"` // 操作对象ID，任务相关操作为任务ID
+	Actor     string         `gorm:"type:varchar(255);not null" json:"actor"`           // 操作人，未认证时为 anonymous
+	Details   datatypes.JSON `json:"details,omitempty"`
+	CreatedAt time.Time      `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "moonshot.audit_log"
+}
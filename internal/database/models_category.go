@@ -42,6 +42,44 @@ const (
 	StatusCompleted   = "completed"    // 全部处理完成
 )
 
+// StatusTransition 分类处理状态的一次流转
+type StatusTransition struct {
+	From string
+	To   string
+}
+
+// 允许的状态流转：Excel解析 → PDF合并 → （LLM增强）→ 完成；
+// 没有可合并的PDF数据（跳过PDF或PDF未匹配）时，Excel解析结果可直接完成
+var (
+	TransitionPDFMerge    = StatusTransition{From: StatusExcelParsed, To: StatusPDFMerged}
+	TransitionExcelOnly   = StatusTransition{From: StatusExcelParsed, To: StatusCompleted}
+	TransitionLLMEnhance  = StatusTransition{From: StatusPDFMerged, To: StatusLLMEnhanced}
+	TransitionComplete    = StatusTransition{From: StatusPDFMerged, To: StatusCompleted}
+	TransitionEnhancedEnd = StatusTransition{From: StatusLLMEnhanced, To: StatusCompleted}
+)
+
+// AllowedStatusTransitions 全部允许的状态流转
+var AllowedStatusTransitions = []StatusTransition{
+	TransitionPDFMerge,
+	TransitionExcelOnly,
+	TransitionLLMEnhance,
+	TransitionComplete,
+	TransitionEnhancedEnd,
+}
+
+// CanTransition 判断分类状态能否从 from 流转到 to，状态不变时总是允许
+func CanTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, transition := range AllowedStatusTransitions {
+		if transition.From == from && transition.To == to {
+			return true
+		}
+	}
+	return false
+}
+
 // 数据源常量
 const (
 	DataSourceExcel  = "excel"  // 来自Excel
@@ -69,6 +107,8 @@ type CategoryDBInterface interface {
 	GetCategoriesByBatchID(ctx context.Context, batchID string) ([]*Category, error)
 	// BatchInsertCategoriesWithVersion 批量插入分类数据（支持版本管理）
 	BatchInsertCategoriesWithVersion(ctx context.Context, taskID, batchID string, categories []*Category) error
+	// FindCurrentVersionByContent 返回内容哈希与 hash 相同的当前版本批次ID，不存在时返回空字符串
+	FindCurrentVersionByContent(ctx context.Context, taskID, hash string) (string, error)
 	// MarkPreviousVersionsAsOld 将之前的版本标记为非当前版本
 	MarkPreviousVersionsAsOld(ctx context.Context, taskID string) error
 	// GetCategoryVersionHistory 获取分类的版本历史
@@ -88,3 +128,31 @@ type CategoryVersion struct {
 	RecordCount     int       `json:"record_count"`
 	IsCurrent       bool      `json:"is_current"`
 }
+
+// CategoryChange 两个版本之间单个分类的变更
+type CategoryChange struct {
+	Code        string `json:"code"`
+	ChangeType  string `json:"change_type"` // added, removed, modified
+	BeforeName  string `json:"before_name,omitempty"`
+	AfterName   string `json:"after_name,omitempty"`
+	BeforeLevel string `json:"before_level,omitempty"`
+	AfterLevel  string `json:"after_level,omitempty"`
+}
+
+// CategoryVersionDiff 两个版本之间的差异
+type CategoryVersionDiff struct {
+	FromBatchID   string            `json:"from"`
+	ToBatchID     string            `json:"to"`
+	AddedCount    int               `json:"added_count"`
+	RemovedCount  int               `json:"removed_count"`
+	ModifiedCount int               `json:"modified_count"`
+	Changes       []*CategoryChange `json:"changes"`
+	Truncated     bool              `json:"truncated"`
+}
+
+// 变更类型常量
+const (
+	ChangeTypeAdded    = "added"
+	ChangeTypeRemoved  = "removed"
+	ChangeTypeModified = "modified"
+)
@@ -0,0 +1,20 @@
+package database
+
+import "time"
+
+// MetricsSnapshot 对应于数据库中的 metrics_snapshots 表，保存一个导出区间内某个处理阶段的指标增量，用于查询历史趋势
+type MetricsSnapshot struct {
+	ID            uint      `gorm:"primarykey;autoIncrement" json:"id"`
+	Source        string    `gorm:"type:varchar(255);not null;index" json:"source"` // 导出快照的实例，如 rule-worker 的 worker ID
+	Stage         string    `gorm:"type:varchar(100);not null;index" json:"stage"`  // 处理阶段
+	DurationCount int64     `gorm:"not null;default:0" json:"duration_count"`       // 区间内记录时长的次数
+	AvgDurationMs float64   `gorm:"not null;default:0" json:"avg_duration_ms"`      // 区间内的平均时长
+	SuccessCount  int64     `gorm:"not null;default:0" json:"success_count"`
+	ErrorCount    int64     `gorm:"not null;default:0" json:"error_count"`
+	PeriodStart   time.Time `gorm:"not null" json:"period_start"`
+	CreatedAt     time.Time `gorm:"not null;index" json:"created_at"` // 区间结束时间，即导出时间
+}
+
+func (MetricsSnapshot) TableName() string {
+	return "moonshot.metrics_snapshots"
+}
@@ -0,0 +1,22 @@
+package database
+
+import "time"
+
+// ManualOverrideKey llm_enhancements 中标记已应用人工修正的字段
+const ManualOverrideKey = "manual_override"
+
+// CategoryOverride 对应于数据库中的 category_overrides 表，保存人工审核后指定的分类名称
+// 按 (task_id, code) 唯一，重新处理任务后在最终更新中重新应用，不会被LLM结果覆盖
+type CategoryOverride struct {
+	ID        uint      `gorm:"primarykey;autoIncrement" json:"-"`
+	TaskID    string    `gorm:"type:uuid;not null;uniqueIndex:idx_category_overrides_task_code" json:"task_id"`
+	Code      string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_category_overrides_task_code" json:"code"`
+	Name      string    `gorm:"type:varchar(255);not null" json:"name"`
+	Reason    string    `gorm:"type:text" json:"reason,omitempty"` // 修正原因，便于审计
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (CategoryOverride) TableName() string {
+	return "moonshot.category_overrides"
+}
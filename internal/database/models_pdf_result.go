@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	"gorm.io/datatypes"
 )
 
 // PDFResult 对应于数据库中的 pdf_results 表，用于存储PDF解析的原始结果
@@ -19,3 +20,22 @@ type PDFResult struct {
 func (PDFResult) TableName() string {
 	return "moonshot.pdf_results"
 }
+
+// PDFExtraction 对应于数据库中的 pdf_extractions 表，每个任务一行，
+// 保存PDF服务提取的职业编码及第一轮LLM清洗前后的数据，用于审计OCR提取质量
+type PDFExtraction struct {
+	ID              uint           `gorm:"primarykey;autoIncrement" json:"-"`
+	TaskID          string         `gorm:"type:uuid;uniqueIndex" json:"task_id"`
+	PDFTaskID       string         `gorm:"type:varchar(255)" json:"pdf_task_id,omitempty"` // PDF服务侧的验证任务ID
+	TotalFound      int            `gorm:"not null;default:0" json:"total_found"`
+	OccupationCodes datatypes.JSON `json:"occupation_codes"`                              // 清洗前：PDF服务返回的原始编码（含置信度和来源）
+	CleanedCodes    datatypes.JSON `json:"cleaned_codes,omitempty"`                       // 清洗后：第一轮LLM输出，清洗失败时为空
+	CleanedCount    int            `gorm:"not null;default:0" json:"cleaned_count"`
+	RawResult       datatypes.JSON `json:"-"` // PDF服务职业编码接口的完整返回，重新处理时复用以跳过PDF服务
+	CreatedAt       time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (PDFExtraction) TableName() string {
+	return "moonshot.pdf_extractions"
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrCategoryModified 分类在读取之后已被修改，乐观并发检查失败
+var ErrCategoryModified = errors.New("分类已被修改")
+
+// OverrideEdit 批量人工修正中的一项
+type OverrideEdit struct {
+	Override *CategoryOverride
+	// ExpectedUpdatedAt 非空时仅在分类当前的 updated_at 与之一致时应用，避免覆盖并发修改
+	ExpectedUpdatedAt *time.Time
+}
+
+// SaveCategoryOverride 保存分类的人工修正名称，同一任务同一编码重复保存时覆盖旧记录
+func (p *PostgreSQLDB) SaveCategoryOverride(ctx context.Context, override *CategoryOverride) error {
+	err := p.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_id"}, {Name: "code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "reason", "updated_at"}),
+	}).Create(override).Error
+	if err != nil {
+		return fmt.Errorf("保存人工修正失败: %w", err)
+	}
+	return nil
+}
+
+// GetCategoryOverrides 获取任务的全部人工修正，按编码排序
+func (p *PostgreSQLDB) GetCategoryOverrides(ctx context.Context, taskID string) ([]*CategoryOverride, error) {
+	var overrides []*CategoryOverride
+	if err := p.db.WithContext(ctx).Where("task_id = ?", taskID).Order("code").Find(&overrides).Error; err != nil {
+		return nil, fmt.Errorf("获取人工修正失败: %w", err)
+	}
+	return overrides, nil
+}
+
+// ApplyCategoryOverrides 将任务的人工修正写入当前版本的分类，返回更新的行数
+// 被修正的分类在 llm_enhancements 的 manual_override 字段中记录修正前的名称；
+// 已应用且名称一致的分类不再重复更新，当前版本中不存在的编码跳过
+func (p *PostgreSQLDB) ApplyCategoryOverrides(ctx context.Context, taskID string) (int64, error) {
+	overrides, err := p.GetCategoryOverrides(ctx, taskID)
+	if err != nil || len(overrides) == 0 {
+		return 0, err
+	}
+
+	codes := make([]string, len(overrides))
+	for i, override := range overrides {
+		codes[i] = override.Code
+	}
+	categories, err := p.GetCurrentCategoriesByCodes(ctx, taskID, codes)
+	if err != nil {
+		return 0, err
+	}
+
+	var updates []CategoryUpdate
+	for _, override := range overrides {
+		category, ok := categories[override.Code]
+		if !ok {
+			continue
+		}
+		if update, changed := overrideUpdate(category, override); changed {
+			updates = append(updates, update)
+		}
+	}
+	if len(updates) == 0 {
+		return 0, nil
+	}
+	return p.BatchUpdateCurrentCategories(ctx, taskID, updates)
+}
+
+// overrideUpdate 生成应用单条人工修正的更新，分类已应用相同修正时返回 false
+func overrideUpdate(category *Category, override *CategoryOverride) (CategoryUpdate, bool) {
+	enhancements := make(map[string]interface{})
+	if category.LLMEnhancements != "" {
+		if err := json.Unmarshal([]byte(category.LLMEnhancements), &enhancements); err != nil {
+			log.Printf("解析分类 %s 的 llm_enhancements 失败: %v", category.Code, err)
+			enhancements = make(map[string]interface{})
+		}
+	}
+	// 多次修正时 previous_name 保留流程输出的名称，而不是上一次的人工名称
+	previousName := category.Name
+	if marker, ok := enhancements[ManualOverrideKey].(map[string]interface{}); ok {
+		if marker["name"] == override.Name && category.Name == override.Name {
+			return CategoryUpdate{}, false
+		}
+		if previous, ok := marker["previous_name"].(string); ok {
+			previousName = previous
+		}
+	}
+
+	enhancements[ManualOverrideKey] = map[string]interface{}{
+		"name":          override.Name,
+		"previous_name": previousName,
+		"reason":        override.Reason,
+		"updated_at":    override.UpdatedAt,
+	}
+	enhancementsJSON, _ := json.Marshal(enhancements)
+	return CategoryUpdate{
+		Code: category.Code,
+		Updates: map[string]interface{}{
+			"name":             override.Name,
+			"llm_enhancements": string(enhancementsJSON),
+		},
+	}, true
+}
+
+// ApplyOverrideEdits 在一个事务中保存并应用一批人工修正，返回每一项的错误（成功时为 nil）
+// 编码不在当前版本中时该项为 ErrCategoryNotFound，updated_at 与预期不一致或在读取后被并发修改时为
+// ErrCategoryModified；单项失败不影响其他项，数据库错误时整体回滚并返回 error
+func (p *PostgreSQLDB) ApplyOverrideEdits(ctx context.Context, taskID string, edits []OverrideEdit) ([]error, error) {
+	results := make([]error, len(edits))
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i, edit := range edits {
+			override := edit.Override
+			override.TaskID = taskID
+			override.UpdatedAt = time.Now()
+
+			var category Category
+			err := tx.Where("task_id = ? AND code = ? AND is_current = ?", taskID, override.Code, true).
+				Order("id desc").First(&category).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				results[i] = fmt.Errorf("%w: %s", ErrCategoryNotFound, override.Code)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("获取分类 %s 失败: %w", override.Code, err)
+			}
+			if edit.ExpectedUpdatedAt != nil && !edit.ExpectedUpdatedAt.Equal(category.UpdatedAt) {
+				results[i] = fmt.Errorf("%w: %s", ErrCategoryModified, override.Code)
+				continue
+			}
+
+			// 以读取到的 updated_at 为条件更新，读取之后被其他请求修改时不覆盖
+			if update, changed := overrideUpdate(&category, override); changed {
+				result := tx.Model(&Category{}).
+					Where("id = ? AND updated_at = ?", category.ID, category.UpdatedAt).
+					Updates(update.Updates)
+				if result.Error != nil {
+					return fmt.Errorf("应用人工修正 %s 失败: %w", override.Code, result.Error)
+				}
+				if result.RowsAffected == 0 {
+					results[i] = fmt.Errorf("%w: %s", ErrCategoryModified, override.Code)
+					continue
+				}
+			}
+
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "task_id"}, {Name: "code"}},
+				DoUpdates: clause.AssignmentColumns([]string{"name", "reason", "updated_at"}),
+			}).Create(override).Error; err != nil {
+				return fmt.Errorf("保存人工修正 %s 失败: %w", override.Code, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
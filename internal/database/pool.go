@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+const (
+	DefaultSlowQueryThreshold = 200 * time.Millisecond // 慢查询日志的默认阈值
+	DefaultPoolStatsInterval  = time.Minute            // 连接池状态写入日志的默认间隔
+)
+
+// PoolStats 数据库连接池运行状态，取自 sql.DBStats
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`       // 累计等待空闲连接的次数
+	WaitDurationMs     int64 `json:"wait_duration_ms"` // 累计等待时长
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+func newPoolStats(stats sql.DBStats) *PoolStats {
+	return &PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
+
+// PoolStats 返回连接池的当前状态
+func (p *PostgreSQLDB) PoolStats() (*PoolStats, error) {
+	sqlDB, err := p.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return newPoolStats(sqlDB.Stats()), nil
+}
+
+// RunPoolStatsExport 按间隔将连接池状态写入日志，直到 ctx 取消；间隔为0时直接返回。
+// 两次输出之间出现等待连接时以警告输出，连接池耗尽在请求挂起之前即可从日志发现
+func RunPoolStatsExport(ctx context.Context, db DatabaseInterface, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastWaitCount int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stats, err := db.PoolStats()
+		if err != nil {
+			log.Printf("获取数据库连接池状态失败: %v", err)
+			continue
+		}
+		prefix := "数据库连接池"
+		if stats.WaitCount > lastWaitCount {
+			prefix = "WARNING: 数据库连接池出现等待"
+		}
+		lastWaitCount = stats.WaitCount
+		log.Printf("%s: max_open=%d open=%d in_use=%d idle=%d wait_count=%d wait_duration_ms=%d",
+			prefix, stats.MaxOpenConnections, stats.OpenConnections, stats.InUse, stats.Idle,
+			stats.WaitCount, stats.WaitDurationMs)
+	}
+}
+
+// SlowQueryThresholdFromEnv 读取 POSTGRES_SLOW_QUERY_THRESHOLD，如 "500ms"；
+// 未配置或格式无效时使用 DefaultSlowQueryThreshold，配置为0时关闭慢查询日志
+func SlowQueryThresholdFromEnv() time.Duration {
+	v := os.Getenv("POSTGRES_SLOW_QUERY_THRESHOLD")
+	if v == "" {
+		return DefaultSlowQueryThreshold
+	}
+	threshold, err := time.ParseDuration(v)
+	if err != nil || threshold < 0 {
+		log.Printf("WARNING: POSTGRES_SLOW_QUERY_THRESHOLD 配置无效: %s，使用默认值 %s", v, DefaultSlowQueryThreshold)
+		return DefaultSlowQueryThreshold
+	}
+	return threshold
+}
+
+// newGormLogger 创建输出超过阈值的慢查询的GORM日志，阈值为0时不输出慢查询；
+// 标准日志输出到stdout时（调试）同时输出全部SQL
+func newGormLogger(slowThreshold time.Duration) logger.Interface {
+	level := logger.Warn
+	if log.Default().Writer() == os.Stdout {
+		level = logger.Info
+	}
+	return logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold: slowThreshold,
+		LogLevel:      level,
+		Colorful:      true,
+	})
+}
+
+// PoolStatsIntervalFromEnv 读取 DB_POOL_STATS_INTERVAL，如 "30s"；
+// 未配置或格式无效时使用 DefaultPoolStatsInterval，配置为0时不输出连接池状态
+func PoolStatsIntervalFromEnv() time.Duration {
+	v := os.Getenv("DB_POOL_STATS_INTERVAL")
+	if v == "" {
+		return DefaultPoolStatsInterval
+	}
+	interval, err := time.ParseDuration(v)
+	if err != nil || interval < 0 {
+		log.Printf("WARNING: DB_POOL_STATS_INTERVAL 配置无效: %s，使用默认值 %s", v, DefaultPoolStatsInterval)
+		return DefaultPoolStatsInterval
+	}
+	return interval
+}
@@ -2,16 +2,18 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
+	"gorm.io/datatypes"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	"gorm.io/gorm/clause"
 )
 
 // PostgreSQLConfig PostgreSQL配置
@@ -28,8 +30,19 @@ type PostgreSQLConfig struct {
 	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"POSTGRES_CONN_MAX_LIFETIME" default:"5m"`
 	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"POSTGRES_CONN_MAX_IDLE_TIME" default:"5m"`
 	BatchSize       int           `yaml:"batch_size" env:"POSTGRES_BATCH_SIZE" default:"100"`
+	// SlowQueryThreshold 执行时间超过该值的SQL写入日志，0 表示不记录慢查询
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" env:"POSTGRES_SLOW_QUERY_THRESHOLD" default:"200ms"`
 }
 
+// ErrCategoryNotFound 分类不存在
+var ErrCategoryNotFound = errors.New("分类不存在")
+
+// ErrPDFExtractionNotFound 任务没有保存PDF提取结果
+var ErrPDFExtractionNotFound = errors.New("PDF提取结果不存在")
+
+// ErrTaskNotReprocessable 任务未结束、已取消或后台增量流程仍在运行，不能重新处理
+var ErrTaskNotReprocessable = errors.New("任务当前状态不能重新处理")
+
 // PostgreSQLDB PostgreSQL数据库
 type PostgreSQLDB struct {
 	db     *gorm.DB
@@ -47,10 +60,7 @@ func NewPostgreSQLDB(config *PostgreSQLConfig) (*PostgreSQLDB, error) {
 	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s search_path=%s",
 		config.Host, config.Port, config.Username, config.Password, config.Database, config.SSLMode, config.Schema)
 
-	gormConfig := &gorm.Config{}
-	if log.Default().Writer() == os.Stdout {
-		gormConfig.Logger = logger.Default.LogMode(logger.Info)
-	}
+	gormConfig := &gorm.Config{Logger: newGormLogger(config.SlowQueryThreshold)}
 
 	db, err := gorm.Open(postgres.Open(dsn), gormConfig)
 	if err != nil {
@@ -89,20 +99,16 @@ func NewPostgreSQLDB(config *PostgreSQLConfig) (*PostgreSQLDB, error) {
 	}, nil
 }
 
-// CreateTables 创建表结构
-func (p *PostgreSQLDB) CreateTables(ctx context.Context) error {
-	// 使用 GORM 的 AutoMigrate 功能
-	err := p.db.WithContext(ctx).AutoMigrate(
-		&TaskRecord{},
-		&FileRecord{},
-		&ProcessingStats{},
-		&Category{},
-		&PDFResult{},
-	)
-	if err != nil {
-		return fmt.Errorf("自动迁移失败: %w", err)
+// NewPostgreSQLDBWithConn 使用已建立的gorm连接创建实例，不设置search_path和连接池
+// 供集成测试接入内存数据库，config为nil时使用默认批次大小
+func NewPostgreSQLDBWithConn(db *gorm.DB, config *PostgreSQLConfig) *PostgreSQLDB {
+	if config == nil {
+		config = &PostgreSQLConfig{Schema: "moonshot", BatchSize: 100}
+	}
+	return &PostgreSQLDB{
+		db:     db,
+		config: config,
 	}
-	return nil
 }
 
 // CreateTask 创建任务
@@ -142,6 +148,66 @@ func (p *PostgreSQLDB) UpdateTask(ctx context.Context, task *TaskRecord) error {
 	return nil
 }
 
+// ClaimTask 以单条条件更新将 pending 状态的任务领取为 processing 并记录worker标识和领取时间，返回更新后的任务；
+// staleAfter 大于 0 时，领取时间早于 staleAfter 之前的 processing 任务视为领取它的worker已退出，可被重新领取。
+// 任务已被其他worker领取、已结束或不存在时返回 nil，多个worker同时领取时只有一个成功
+func (p *PostgreSQLDB) ClaimTask(ctx context.Context, taskID, workerID string, staleAfter time.Duration) (*TaskRecord, error) {
+	now := time.Now()
+	query := p.db.WithContext(ctx).Where("id = ? AND status = ?", taskID, "pending")
+	if staleAfter > 0 {
+		query = p.db.WithContext(ctx).Where("id = ? AND (status = ? OR (status = ? AND claimed_at < ?))",
+			taskID, "pending", "processing", now.Add(-staleAfter))
+	}
+
+	var claimed []TaskRecord
+	result := query.Model(&claimed).
+		Clauses(clause.Returning{}).
+		Updates(map[string]interface{}{
+			"status":       "processing",
+			"processed_by": workerID,
+			"claimed_at":   now,
+			"updated_at":   now,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("领取任务失败: %w", result.Error)
+	}
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+	return &claimed[0], nil
+}
+
+// ReleaseTaskClaim 将本worker领取但未开始处理的任务恢复为 pending，清除worker标识和领取时间，返回是否释放成功
+func (p *PostgreSQLDB) ReleaseTaskClaim(ctx context.Context, taskID, workerID string) (bool, error) {
+	result := p.db.WithContext(ctx).Model(&TaskRecord{}).
+		Where("id = ? AND status = ? AND processed_by = ?", taskID, "processing", workerID).
+		Updates(map[string]interface{}{
+			"status":       "pending",
+			"processed_by": "",
+			"claimed_at":   nil,
+			"updated_at":   time.Now(),
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("释放任务失败: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ListStaleClaims 列出指定类型中领取时间早于 claimedBefore 仍处于 processing 的任务，按领取时间排序
+// 领取这些任务的worker通常已退出，重新入队后由 ClaimTask 接管
+func (p *PostgreSQLDB) ListStaleClaims(ctx context.Context, taskType string, claimedBefore time.Time, limit int) ([]*TaskRecord, error) {
+	var tasks []*TaskRecord
+	err := p.db.WithContext(ctx).
+		Where("type = ? AND status = ? AND claimed_at < ?", taskType, "processing", claimedBefore).
+		Order("claimed_at ASC").
+		Limit(limit).
+		Find(&tasks).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询超时领取的任务失败: %w", err)
+	}
+	return tasks, nil
+}
+
 // DeleteTask 删除任务
 func (p *PostgreSQLDB) DeleteTask(ctx context.Context, taskID string) error {
 	result := p.db.WithContext(ctx).Delete(&TaskRecord{}, "id = ?", taskID)
@@ -164,6 +230,90 @@ func (p *PostgreSQLDB) ListTasks(ctx context.Context, limit, offset int) ([]*Tas
 	return tasks, nil
 }
 
+// terminalTaskStatuses 任务的终止状态，后台增量流程未结束时仍占用处理资源
+var terminalTaskStatuses = []string{"completed", "failed", "cancelled"}
+
+// FlowActiveWindow 后台增量流程计为活跃的最长时间，超过后视为worker异常退出遗留的标记，不再计数
+const FlowActiveWindow = 6 * time.Hour
+
+// CountActiveTasks 统计占用处理资源的任务数量：非终止状态（排队或处理中）的任务，
+// 以及规则步骤已完成、后台PDF/LLM增量流程仍在运行的任务
+func (p *PostgreSQLDB) CountActiveTasks(ctx context.Context) (int64, error) {
+	var count int64
+	err := p.db.WithContext(ctx).Model(&TaskRecord{}).
+		Where("status NOT IN ? OR flow_started_at > ?", terminalTaskStatuses, time.Now().Add(-FlowActiveWindow)).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("统计活跃任务失败: %w", err)
+	}
+	return count, nil
+}
+
+// SetTaskFlowRunning 记录任务的后台增量流程开始（running 为 true）或结束，只更新 flow_started_at
+func (p *PostgreSQLDB) SetTaskFlowRunning(ctx context.Context, taskID string, running bool) error {
+	var startedAt *time.Time
+	if running {
+		now := time.Now()
+		startedAt = &now
+	}
+	err := p.db.WithContext(ctx).Model(&TaskRecord{}).
+		Where("id = ?", taskID).
+		Update("flow_started_at", startedAt).Error
+	if err != nil {
+		return fmt.Errorf("更新任务流程状态失败: %w", err)
+	}
+	return nil
+}
+
+// reprocessableStatuses 可以重新处理的任务状态；已取消任务的取消标记仍保留在队列中，不允许重新处理
+var reprocessableStatuses = []string{"completed", "failed"}
+
+// ResetTaskForReprocess 将已完成或失败、且后台增量流程已结束的任务重置为 pending，
+// 替换任务配置并清除上次处理的结果、错误和领取信息，任务ID不变，已保存的PDF提取结果可以继续复用。
+// 任务状态不满足条件时返回 ErrTaskNotReprocessable
+func (p *PostgreSQLDB) ResetTaskForReprocess(ctx context.Context, taskID string, config datatypes.JSON) error {
+	result := p.db.WithContext(ctx).Model(&TaskRecord{}).
+		Where("id = ? AND status IN ? AND flow_started_at IS NULL", taskID, reprocessableStatuses).
+		Updates(map[string]interface{}{
+			"status":       "pending",
+			"config":       config,
+			"result":       nil,
+			"error_msg":    "",
+			"processed_at": nil,
+			"processed_by": "",
+			"claimed_at":   nil,
+			"updated_at":   time.Now(),
+			// 没有回调地址时保持为空，有回调地址时重新等待投递
+			"callback_status":   gorm.Expr("CASE WHEN callback_url <> '' THEN ? ELSE callback_status END", "pending"),
+			"callback_attempts": 0,
+			"callback_error":    "",
+		})
+	if result.Error != nil {
+		return fmt.Errorf("重置任务失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrTaskNotReprocessable, taskID)
+	}
+	return nil
+}
+
+// GetTasksByIDs 批量获取任务（单次查询），只返回状态相关字段
+func (p *PostgreSQLDB) GetTasksByIDs(ctx context.Context, taskIDs []string) ([]*TaskRecord, error) {
+	var tasks []*TaskRecord
+	if len(taskIDs) == 0 {
+		return tasks, nil
+	}
+
+	err := p.db.WithContext(ctx).
+		Select("id", "type", "status", "error_msg", "updated_at", "processed_at").
+		Where("id IN ?", taskIDs).
+		Find(&tasks).Error
+	if err != nil {
+		return nil, fmt.Errorf("批量获取任务失败: %w", err)
+	}
+	return tasks, nil
+}
+
 // CreateFile 创建文件记录
 func (p *PostgreSQLDB) CreateFile(ctx context.Context, file *FileRecord) error {
 	result := p.db.WithContext(ctx).Create(file)
@@ -203,6 +353,44 @@ func (db *PostgreSQLDB) GetCategoriesByTaskID(ctx context.Context, taskID string
 	return categories, err
 }
 
+// GetLatestProcessingStats 获取任务最新的处理统计，不存在时返回 nil
+func (p *PostgreSQLDB) GetLatestProcessingStats(ctx context.Context, taskID string) (*ProcessingStats, error) {
+	var stats []*ProcessingStats
+	err := p.db.WithContext(ctx).
+		Where("task_id = ?", taskID).
+		Order("created_at DESC").
+		Limit(1).
+		Find(&stats).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取处理统计失败: %w", err)
+	}
+	if len(stats) == 0 {
+		return nil, nil
+	}
+	return stats[0], nil
+}
+
+// PruneProcessingStats 删除创建时间早于 olderThan 之前的处理统计，每个任务最新的一条始终保留，返回删除的行数
+func (p *PostgreSQLDB) PruneProcessingStats(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if olderThan <= 0 {
+		return 0, fmt.Errorf("保留时长必须大于0: %v", olderThan)
+	}
+	cutoff := time.Now().Add(-olderThan)
+	// 只删除同一任务存在更新记录的行，保证每个任务至少留下最新的一条
+	newer := p.db.WithContext(ctx).
+		Table(ProcessingStats{}.TableName()+" AS newer").
+		Select("1").
+		Where("newer.task_id = processing_stats.task_id AND newer.created_at > processing_stats.created_at")
+	result := p.db.WithContext(ctx).
+		Where("created_at < ?", cutoff).
+		Where("EXISTS (?)", newer).
+		Delete(&ProcessingStats{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("清理处理统计失败: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
 // Close 关闭数据库连接
 func (p *PostgreSQLDB) Close() error {
 	sqlDB, err := p.db.DB()
@@ -226,6 +414,11 @@ func (p *PostgreSQLDB) GetDB() *gorm.DB {
 	return p.db
 }
 
+// WithContext 获取绑定ctx的GORM会话，供需要自行组合查询的调用方使用
+func (p *PostgreSQLDB) WithContext(ctx context.Context) *gorm.DB {
+	return p.db.WithContext(ctx)
+}
+
 // GetChildrenByParentCode 根据父节点ID获取其直接子节点
 func (p *PostgreSQLDB) GetChildrenByParentCode(ctx context.Context, taskID string, version string, parentCode string) ([]*Category, error) {
 	var categories []*Category
@@ -250,6 +443,77 @@ func (p *PostgreSQLDB) GetChildrenByParentCode(ctx context.Context, taskID strin
 	return categories, nil
 }
 
+// GetCategoryByCode 根据编码获取单个分类，version为空时使用当前版本
+func (p *PostgreSQLDB) GetCategoryByCode(ctx context.Context, taskID string, version string, code string) (*Category, error) {
+	var category Category
+	query := p.db.WithContext(ctx).Where("task_id = ? AND code = ?", taskID, code)
+
+	if version != "" {
+		query = query.Where("upload_batch_id = ?", version)
+	} else {
+		query = query.Where("is_current = ?", true)
+	}
+
+	err := query.Order("id desc").First(&category).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrCategoryNotFound, code)
+		}
+		return nil, fmt.Errorf("获取分类 %s 失败: %w", code, err)
+	}
+
+	return &category, nil
+}
+
+// GetCategoriesPage 分页获取某个版本的分类数据，按编码排序；batchID为空时使用当前版本
+func (p *PostgreSQLDB) GetCategoriesPage(ctx context.Context, taskID string, batchID string, limit, offset int) ([]*Category, int64, error) {
+	query := p.db.WithContext(ctx).Model(&Category{}).Where("task_id = ?", taskID)
+	if batchID != "" {
+		query = query.Where("upload_batch_id = ?", batchID)
+	} else {
+		query = query.Where("is_current = ?", true)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计分类数量失败: %w", err)
+	}
+
+	var categories []*Category
+	err := query.Order("code asc").Limit(limit).Offset(offset).Find(&categories).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("分页获取分类失败: %w", err)
+	}
+
+	return categories, total, nil
+}
+
+// GetParentCodesWithChildren 单次查询给定编码中哪些存在子节点；batchID为空时使用当前版本
+func (p *PostgreSQLDB) GetParentCodesWithChildren(ctx context.Context, taskID string, batchID string, codes []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	if len(codes) == 0 {
+		return result, nil
+	}
+
+	query := p.db.WithContext(ctx).Model(&Category{}).
+		Where("task_id = ? AND parent_code IN ?", taskID, codes)
+	if batchID != "" {
+		query = query.Where("upload_batch_id = ?", batchID)
+	} else {
+		query = query.Where("is_current = ?", true)
+	}
+
+	var parentCodes []string
+	if err := query.Distinct().Pluck("parent_code", &parentCodes).Error; err != nil {
+		return nil, fmt.Errorf("查询子节点存在性失败: %w", err)
+	}
+	for _, code := range parentCodes {
+		result[code] = true
+	}
+
+	return result, nil
+}
+
 // ======================= 兼容性方法（为旧代码提供版本化支持）=======================
 
 // BatchInsertCategories 批量插入分类数据（兼容性方法，自动设置版本化字段）
@@ -343,10 +607,20 @@ func (p *PostgreSQLDB) GetCategoriesByBatchID(ctx context.Context, batchID strin
 }
 
 // BatchInsertCategoriesWithVersion 批量插入分类数据（支持版本管理）
+// 当前版本的内容与 categories 相同时不再插入，保留当前版本，重试不会产生重复的完整版本
 func (p *PostgreSQLDB) BatchInsertCategoriesWithVersion(ctx context.Context, taskID, batchID string, categories []*Category) error {
 	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		existing, err := CurrentVersionWithContent(tx, taskID, CategoryContentHash(categories))
+		if err != nil {
+			return err
+		}
+		if existing != "" {
+			log.Printf("任务 %s 的当前版本 %s 内容相同，跳过插入批次 %s", taskID, existing, batchID)
+			return nil
+		}
+
 		// 1. 将现有的当前版本标记为历史版本
-		err := tx.Model(&Category{}).
+		err = tx.Model(&Category{}).
 			Where("task_id = ? AND is_current = true", taskID).
 			Update("is_current", false).Error
 		if err != nil {
@@ -362,7 +636,7 @@ func (p *PostgreSQLDB) BatchInsertCategoriesWithVersion(ctx context.Context, tas
 		}
 
 		// 3. 批量插入新的当前版本数据
-		if err := p.db.WithContext(ctx).Omit("id").CreateInBatches(categories, p.config.BatchSize).Error; err != nil {
+		if err := tx.Omit("id").CreateInBatches(categories, p.config.BatchSize).Error; err != nil {
 			return fmt.Errorf("批量插入版本化分类失败: %w", err)
 		}
 
@@ -370,6 +644,27 @@ func (p *PostgreSQLDB) BatchInsertCategoriesWithVersion(ctx context.Context, tas
 	})
 }
 
+// BatchUpdateCurrentCategories 在一个事务中按编码更新任务当前版本的分类，任一更新失败时整体回滚
+func (p *PostgreSQLDB) BatchUpdateCurrentCategories(ctx context.Context, taskID string, updates []CategoryUpdate) (int64, error) {
+	var affected int64
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, update := range updates {
+			result := tx.Model(&Category{}).
+				Where("task_id = ? AND code = ? AND is_current = true", taskID, update.Code).
+				Updates(update.Updates)
+			if result.Error != nil {
+				return fmt.Errorf("更新分类 %s 失败: %w", update.Code, result.Error)
+			}
+			affected += result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
 // MarkPreviousVersionsAsOld 将之前的版本标记为非当前版本
 func (p *PostgreSQLDB) MarkPreviousVersionsAsOld(ctx context.Context, taskID string) error {
 	err := p.db.WithContext(ctx).
@@ -425,27 +720,225 @@ func (p *PostgreSQLDB) GetCategoryVersionHistory(ctx context.Context, taskID str
 	return versions, nil
 }
 
+// GetCategoryVersionDiff 比较两个版本的分类差异
+// 一次查询取出两个批次的数据（不排序），再在内存中按code的字节序排序后归并比较
+func (p *PostgreSQLDB) GetCategoryVersionDiff(ctx context.Context, taskID, fromBatchID, toBatchID string, limit int) (*CategoryVersionDiff, error) {
+	// 同一版本与自身比较没有变更
+	if fromBatchID == toBatchID {
+		return &CategoryVersionDiff{FromBatchID: fromBatchID, ToBatchID: toBatchID, Changes: []*CategoryChange{}}, nil
+	}
+
+	// 排序在Go中进行，数据库按排序规则（collation）排序的结果与Go的字节序比较不一致
+	var categories []*Category
+	err := p.db.WithContext(ctx).
+		Select("code", "name", "level", "upload_batch_id").
+		Where("task_id = ? AND upload_batch_id IN (?, ?)", taskID, fromBatchID, toBatchID).
+		Find(&categories).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取版本对比数据失败: %w", err)
+	}
+
+	var fromCategories, toCategories []*Category
+	for _, cat := range categories {
+		if cat.UploadBatchID == fromBatchID {
+			fromCategories = append(fromCategories, cat)
+		} else {
+			toCategories = append(toCategories, cat)
+		}
+	}
+
+	diff := diffCategoryVersions(fromCategories, toCategories, limit)
+	diff.FromBatchID = fromBatchID
+	diff.ToBatchID = toBatchID
+	return diff, nil
+}
+
+// SavePDFExtraction 保存任务的PDF提取结果，同一任务重复处理时覆盖旧记录
+func (p *PostgreSQLDB) SavePDFExtraction(ctx context.Context, extraction *PDFExtraction) error {
+	err := p.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"pdf_task_id", "total_found", "occupation_codes", "cleaned_codes", "cleaned_count", "raw_result", "updated_at"}),
+	}).Create(extraction).Error
+	if err != nil {
+		return fmt.Errorf("保存PDF提取结果失败: %w", err)
+	}
+	return nil
+}
+
+// GetPDFExtraction 获取任务的PDF提取结果
+func (p *PostgreSQLDB) GetPDFExtraction(ctx context.Context, taskID string) (*PDFExtraction, error) {
+	var extraction PDFExtraction
+	err := p.db.WithContext(ctx).Where("task_id = ?", taskID).First(&extraction).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrPDFExtractionNotFound, taskID)
+		}
+		return nil, fmt.Errorf("获取PDF提取结果失败: %w", err)
+	}
+	return &extraction, nil
+}
+
+// diffCategoryVersions 将两个分类列表按code的字节序排序后做归并比较，输入顺序不影响结果，同一列表内重复的code只取第一条
+// limit 限制返回的变更明细数量，计数不受影响；limit<=0 表示不限制
+func diffCategoryVersions(from, to []*Category, limit int) *CategoryVersionDiff {
+	diff := &CategoryVersionDiff{Changes: []*CategoryChange{}}
+	from = sortedByCode(from)
+	to = sortedByCode(to)
+
+	addChange := func(change *CategoryChange) {
+		if limit > 0 && len(diff.Changes) >= limit {
+			diff.Truncated = true
+			return
+		}
+		diff.Changes = append(diff.Changes, change)
+	}
+
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		// 跳过同一批次内的重复code
+		if i > 0 && i < len(from) && from[i].Code == from[i-1].Code {
+			i++
+			continue
+		}
+		if j > 0 && j < len(to) && to[j].Code == to[j-1].Code {
+			j++
+			continue
+		}
+
+		switch {
+		case j >= len(to) || (i < len(from) && from[i].Code < to[j].Code):
+			diff.RemovedCount++
+			addChange(&CategoryChange{
+				Code:        from[i].Code,
+				ChangeType:  ChangeTypeRemoved,
+				BeforeName:  from[i].Name,
+				BeforeLevel: from[i].Level,
+			})
+			i++
+		case i >= len(from) || to[j].Code < from[i].Code:
+			diff.AddedCount++
+			addChange(&CategoryChange{
+				Code:       to[j].Code,
+				ChangeType: ChangeTypeAdded,
+				AfterName:  to[j].Name,
+				AfterLevel: to[j].Level,
+			})
+			j++
+		default:
+			if from[i].Name != to[j].Name || from[i].Level != to[j].Level {
+				diff.ModifiedCount++
+				addChange(&CategoryChange{
+					Code:        from[i].Code,
+					ChangeType:  ChangeTypeModified,
+					BeforeName:  from[i].Name,
+					AfterName:   to[j].Name,
+					BeforeLevel: from[i].Level,
+					AfterLevel:  to[j].Level,
+				})
+			}
+			i++
+			j++
+		}
+	}
+
+	return diff
+}
+
+// sortedByCode 返回按code字节序稳定排序的副本，不修改调用方的切片
+func sortedByCode(categories []*Category) []*Category {
+	sorted := make([]*Category, len(categories))
+	copy(sorted, categories)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Code < sorted[j].Code
+	})
+	return sorted
+}
+
 // DatabaseInterface 数据库接口
 type DatabaseInterface interface {
 	CreateTables(ctx context.Context) error
 	CreateTask(ctx context.Context, task *TaskRecord) error
 	GetTask(ctx context.Context, taskID string) (*TaskRecord, error)
 	UpdateTask(ctx context.Context, task *TaskRecord) error
+	// ClaimTask 原子地将 pending 任务（或领取超过 staleAfter 的 processing 任务）领取为 processing，已被领取时返回 nil
+	ClaimTask(ctx context.Context, taskID, workerID string, staleAfter time.Duration) (*TaskRecord, error)
+	// ReleaseTaskClaim 将本worker领取但未开始处理的任务恢复为 pending
+	ReleaseTaskClaim(ctx context.Context, taskID, workerID string) (bool, error)
+	// ListStaleClaims 列出领取时间早于 claimedBefore 仍处于 processing 的任务
+	ListStaleClaims(ctx context.Context, taskType string, claimedBefore time.Time, limit int) ([]*TaskRecord, error)
 	ListTasks(ctx context.Context, limit, offset int) ([]*TaskRecord, error)
+	GetTasksByIDs(ctx context.Context, taskIDs []string) ([]*TaskRecord, error)
+	CountActiveTasks(ctx context.Context) (int64, error)
+	// SetTaskFlowRunning 标记任务的后台增量流程开始或结束，运行中的流程计入活跃任务
+	SetTaskFlowRunning(ctx context.Context, taskID string, running bool) error
+	// ResetTaskForReprocess 将已结束的任务重置为 pending 并替换配置，用于重新处理
+	ResetTaskForReprocess(ctx context.Context, taskID string, config datatypes.JSON) error
 	DeleteTask(ctx context.Context, taskID string) error
 	CreateFile(ctx context.Context, file *FileRecord) error
 	CreateProcessingStats(ctx context.Context, stats *ProcessingStats) error
+	GetLatestProcessingStats(ctx context.Context, taskID string) (*ProcessingStats, error)
+	// PruneProcessingStats 删除早于保留时长的处理统计，保留每个任务最新的一条，返回删除的行数
+	PruneProcessingStats(ctx context.Context, olderThan time.Duration) (int64, error)
+	// GetTaskSummary 统计 since 之后创建的任务数、处理记录和LLM token消耗
+	GetTaskSummary(ctx context.Context, since time.Time) (*TaskSummary, error)
 	GetCategoriesByTaskID(ctx context.Context, taskID string) ([]*Category, error)
 	BatchInsertCategories(ctx context.Context, categories []*Category) error
 	GetChildrenByParentCode(ctx context.Context, taskID string, version string, parentCode string) ([]*Category, error)
+	GetCategoryByCode(ctx context.Context, taskID string, version string, code string) (*Category, error)
+	GetCategoriesPage(ctx context.Context, taskID string, batchID string, limit, offset int) ([]*Category, int64, error)
+	GetParentCodesWithChildren(ctx context.Context, taskID string, batchID string, codes []string) (map[string]bool, error)
+	// SearchCurrentCategories 按名称搜索任务当前版本的分类，返回当前页和匹配总数
+	SearchCurrentCategories(ctx context.Context, taskID string, q string, limit, offset int) ([]*Category, int64, error)
+	GetCurrentCategoriesByCodes(ctx context.Context, taskID string, codes []string) (map[string]*Category, error)
 
 	// 版本管理相关方法
 	GetCurrentCategoriesByTaskID(ctx context.Context, taskID string) ([]*Category, error)
 	GetCategoriesByBatchID(ctx context.Context, batchID string) ([]*Category, error)
 	BatchInsertCategoriesWithVersion(ctx context.Context, taskID, batchID string, categories []*Category) error
+	// FindCurrentVersionByContent 返回内容哈希与 hash 相同的当前版本批次ID，不存在时返回空字符串
+	FindCurrentVersionByContent(ctx context.Context, taskID, hash string) (string, error)
+	// NewCategoryWriter 创建分批写入新版本分类的写入器，Commit 时切换当前版本
+	NewCategoryWriter(taskID, batchID string, flushSize int) *CategoryWriter
 	MarkPreviousVersionsAsOld(ctx context.Context, taskID string) error
 	GetCategoryVersionHistory(ctx context.Context, taskID string) ([]*CategoryVersion, error)
+	GetCategoryVersionDiff(ctx context.Context, taskID, fromBatchID, toBatchID string, limit int) (*CategoryVersionDiff, error)
+
+	// BatchUpdateCurrentCategories 在一个事务中按编码更新任务当前版本的分类，返回更新的行数
+	BatchUpdateCurrentCategories(ctx context.Context, taskID string, updates []CategoryUpdate) (int64, error)
+
+	// PDF提取结果
+	SavePDFExtraction(ctx context.Context, extraction *PDFExtraction) error
+	GetPDFExtraction(ctx context.Context, taskID string) (*PDFExtraction, error)
+
+	// 混合解析器打包的AI任务
+	SaveHybridParseResult(ctx context.Context, result *HybridParseResult) error
+	GetHybridParseResult(ctx context.Context, taskID string) (*HybridParseResult, error)
+
+	// 人工修正
+	SaveCategoryOverride(ctx context.Context, override *CategoryOverride) error
+	GetCategoryOverrides(ctx context.Context, taskID string) ([]*CategoryOverride, error)
+	// ApplyCategoryOverrides 将任务的人工修正写入当前版本的分类，返回更新的行数
+	ApplyCategoryOverrides(ctx context.Context, taskID string) (int64, error)
+	// ApplyOverrideEdits 在一个事务中保存并应用一批人工修正，返回每一项的错误
+	ApplyOverrideEdits(ctx context.Context, taskID string, edits []OverrideEdit) ([]error, error)
+
+	// 审计日志，只追加
+	CreateAuditLog(ctx context.Context, entry *AuditLog) error
+	ListAuditLogs(ctx context.Context, entityID string, limit, offset int) ([]*AuditLog, int64, error)
+
+	// 指标快照，定期导出的各阶段指标增量
+	SaveMetricsSnapshots(ctx context.Context, snapshots []*MetricsSnapshot) error
+	ListMetricsSnapshots(ctx context.Context, filter MetricsSnapshotFilter) ([]*MetricsSnapshot, error)
+	// PruneMetricsSnapshots 删除早于保留时长的指标快照，返回删除的行数
+	PruneMetricsSnapshots(ctx context.Context, olderThan time.Duration) (int64, error)
+
+	// WithContext 获取绑定ctx的GORM会话，各实现均支持的通用查询可直接基于它组合
+	WithContext(ctx context.Context) *gorm.DB
 
 	Close() error
 	Ping(ctx context.Context) error
+	// PoolStats 返回连接池的当前状态
+	PoolStats() (*PoolStats, error)
+	// CheckSchema 比对模型定义与数据库实际表结构，列出缺失的表和列
+	CheckSchema(ctx context.Context) (*SchemaCheck, error)
 }
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPruneProcessingStats_KeepsLatestPerTask(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewSQLiteDB(&SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	now := time.Now()
+	stats := []*ProcessingStats{
+		// 只有过期记录的任务保留最新的一条
+		{ID: "00000000-0000-4000-8000-000000000001", TaskID: "task-old", CreatedAt: now.AddDate(0, 0, -90)},
+		{ID: "00000000-0000-4000-8000-000000000002", TaskID: "task-old", CreatedAt: now.AddDate(0, 0, -45)},
+		// 有近期记录的任务，过期记录全部删除
+		{ID: "00000000-0000-4000-8000-000000000003", TaskID: "task-active", CreatedAt: now.AddDate(0, 0, -40)},
+		{ID: "00000000-0000-4000-8000-000000000004", TaskID: "task-active", CreatedAt: now.AddDate(0, 0, -1)},
+		// 只有一条过期记录的任务不受影响
+		{ID: "00000000-0000-4000-8000-000000000005", TaskID: "task-single", CreatedAt: now.AddDate(0, 0, -120)},
+	}
+	for _, s := range stats {
+		if err := db.CreateProcessingStats(ctx, s); err != nil {
+			t.Fatalf("创建处理统计失败: %v", err)
+		}
+	}
+
+	deleted, err := db.PruneProcessingStats(ctx, 30*24*time.Hour)
+	if err != nil {
+		t.Fatalf("PruneProcessingStats: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("应删除2条过期统计，实际 %d", deleted)
+	}
+
+	var remaining []string
+	if err := db.WithContext(ctx).Model(&ProcessingStats{}).Order("id").Pluck("id", &remaining).Error; err != nil {
+		t.Fatalf("查询剩余统计失败: %v", err)
+	}
+	want := []string{
+		"00000000-0000-4000-8000-000000000002",
+		"00000000-0000-4000-8000-000000000004",
+		"00000000-0000-4000-8000-000000000005",
+	}
+	if len(remaining) != len(want) {
+		t.Fatalf("剩余统计应为 %v，实际 %v", want, remaining)
+	}
+	for i := range want {
+		if remaining[i] != want[i] {
+			t.Errorf("剩余统计应为 %v，实际 %v", want, remaining)
+			break
+		}
+	}
+
+	if _, err := db.PruneProcessingStats(ctx, 0); err == nil {
+		t.Error("保留时长为0时应返回错误")
+	}
+}
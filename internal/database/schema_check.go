@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SchemaCheck 模型定义与数据库实际表结构的比对结果
+// 代码中的模型新增字段而迁移未执行（或在副本上失败）时，列出缺失的表和列，
+// 避免在第一次查询时才出现难以定位的SQL错误
+type SchemaCheck struct {
+	OK             bool      `json:"ok"`
+	MissingTables  []string  `json:"missing_tables,omitempty"`
+	MissingColumns []string  `json:"missing_columns,omitempty"` // 表名.列名，如 categories.gbm
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// Err 表结构与模型一致时返回 nil，否则返回列出缺失表和列的错误
+func (s *SchemaCheck) Err() error {
+	if s == nil || s.OK {
+		return nil
+	}
+	var missing []string
+	for _, table := range s.MissingTables {
+		missing = append(missing, "表 "+table)
+	}
+	missing = append(missing, s.MissingColumns...)
+	return fmt.Errorf("表结构未更新: %s 缺失", strings.Join(missing, ", "))
+}
+
+// columnLister 列出表的实际列名，表不存在时返回空集合
+type columnLister func(ctx context.Context, schema, table string) (map[string]bool, error)
+
+// CheckSchema 比对 migrationModels 期望的列与 information_schema.columns 中的实际列
+func (p *PostgreSQLDB) CheckSchema(ctx context.Context) (*SchemaCheck, error) {
+	return checkSchema(ctx, p.db, func(ctx context.Context, schema, table string) (map[string]bool, error) {
+		if schema == "" {
+			schema = p.config.Schema
+		}
+		var columns []string
+		err := p.db.WithContext(ctx).Raw(
+			"SELECT column_name FROM information_schema.columns WHERE table_schema = ? AND table_name = ?",
+			schema, table).Scan(&columns).Error
+		return columnSet(columns), err
+	})
+}
+
+// CheckSchema SQLite没有 information_schema，通过 pragma_table_info 读取 moonshot 库中的列
+func (s *SQLiteDB) CheckSchema(ctx context.Context) (*SchemaCheck, error) {
+	return checkSchema(ctx, s.db, func(ctx context.Context, schema, table string) (map[string]bool, error) {
+		if schema == "" {
+			schema = "main"
+		}
+		var columns []string
+		err := s.db.WithContext(ctx).Raw("SELECT name FROM pragma_table_info(?, ?)", table, schema).Scan(&columns).Error
+		return columnSet(columns), err
+	})
+}
+
+// checkSchema 逐个模型解析期望的列名，与 list 返回的实际列比对
+func checkSchema(ctx context.Context, db *gorm.DB, list columnLister) (*SchemaCheck, error) {
+	check := &SchemaCheck{CheckedAt: time.Now()}
+	for _, model := range migrationModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("解析模型失败: %w", err)
+		}
+		schema, table := splitTableName(stmt.Schema.Table)
+
+		actual, err := list(ctx, schema, table)
+		if err != nil {
+			return nil, fmt.Errorf("读取表 %s 的列失败: %w", table, err)
+		}
+		if len(actual) == 0 {
+			check.MissingTables = append(check.MissingTables, table)
+			continue
+		}
+		for _, column := range stmt.Schema.DBNames {
+			if !actual[column] {
+				check.MissingColumns = append(check.MissingColumns, table+"."+column)
+			}
+		}
+	}
+	sort.Strings(check.MissingColumns)
+	check.OK = len(check.MissingTables) == 0 && len(check.MissingColumns) == 0
+	return check, nil
+}
+
+// splitTableName 拆分带schema前缀的表名，如 moonshot.categories
+func splitTableName(name string) (schema, table string) {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+func columnSet(columns []string) map[string]bool {
+	set := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		set[strings.ToLower(column)] = true
+	}
+	return set
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckSchema_DetectsMissingColumnsAndTables(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewSQLiteDB(&SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	check, err := db.CheckSchema(ctx)
+	if err != nil {
+		t.Fatalf("检查表结构失败: %v", err)
+	}
+	if !check.OK || check.Err() != nil {
+		t.Fatalf("迁移后表结构应与模型一致, got %+v", check)
+	}
+
+	// 模拟迁移未执行：删除一列和一张表
+	if err := db.WithContext(ctx).Exec("ALTER TABLE moonshot.categories DROP COLUMN pdf_info").Error; err != nil {
+		t.Fatalf("删除列失败: %v", err)
+	}
+	if err := db.WithContext(ctx).Exec("DROP TABLE moonshot.audit_log").Error; err != nil {
+		t.Fatalf("删除表失败: %v", err)
+	}
+
+	check, err = db.CheckSchema(ctx)
+	if err != nil {
+		t.Fatalf("检查表结构失败: %v", err)
+	}
+	if check.OK {
+		t.Fatal("expected schema drift")
+	}
+	if !reflect.DeepEqual(check.MissingColumns, []string{"categories.pdf_info"}) {
+		t.Errorf("MissingColumns = %v", check.MissingColumns)
+	}
+	if !reflect.DeepEqual(check.MissingTables, []string{"audit_log"}) {
+		t.Errorf("MissingTables = %v", check.MissingTables)
+	}
+	if err := check.Err(); err == nil || !strings.Contains(err.Error(), "categories.pdf_info") {
+		t.Errorf("Err() = %v, expected it to name the missing column", err)
+	}
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SQLiteConfig SQLite配置，用于本地开发和测试（驱动依赖cgo）
+type SQLiteConfig struct {
+	Path      string `yaml:"path" env:"SQLITE_PATH" default:""` // 数据库文件路径，为空时使用内存数据库
+	BatchSize int    `yaml:"batch_size" env:"SQLITE_BATCH_SIZE" default:"100"`
+}
+
+// SQLiteDB SQLite数据库
+// 查询方法与PostgreSQLDB共用（均为GORM通用查询），表结构创建单独实现。
+// 模型表名带 moonshot 库名前缀，因此业务表放在挂载为 moonshot 的库中
+type SQLiteDB struct {
+	*PostgreSQLDB
+	moonshotDSN string
+}
+
+// NewSQLiteDB 创建SQLite数据库连接
+func NewSQLiteDB(config *SQLiteConfig) (*SQLiteDB, error) {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+
+	moonshotDSN := config.Path
+	if moonshotDSN == "" {
+		// 命名的共享内存库，建表连接和查询连接访问同一份数据
+		moonshotDSN = fmt.Sprintf("file:moonshot_%s?mode=memory&cache=shared", uuid.New().String())
+	}
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, fmt.Errorf("打开SQLite数据库失败: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接池失败: %w", err)
+	}
+	// ATTACH 只对执行它的连接生效，SQLite写入本身也是串行的，因此只保留一个连接
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetMaxIdleConns(1)
+	sqlDB.SetConnMaxLifetime(0)
+	sqlDB.SetConnMaxIdleTime(0)
+
+	if err := db.Exec("ATTACH DATABASE ? AS moonshot", moonshotDSN).Error; err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("挂载moonshot库失败: %w", err)
+	}
+
+	return &SQLiteDB{
+		PostgreSQLDB: NewPostgreSQLDBWithConn(db, &PostgreSQLConfig{Schema: "moonshot", BatchSize: config.BatchSize}),
+		moonshotDSN:  moonshotDSN,
+	}, nil
+}
+
+// sqliteDefaultValues 模型中Postgres列默认值函数对应的SQLite表达式
+var sqliteDefaultValues = map[string]string{
+	"now()":              "CURRENT_TIMESTAMP",
+	"uuid_generate_v4()": "(lower(hex(randomblob(16))))",
+}
+
+// CreateTables 创建表结构
+// SQLite的迁移器无法在带库名的表（如 moonshot.categories）上建索引，
+// 因此另开一个直连 moonshot 库的连接，以不带库名的表名执行 AutoMigrate；
+// 该连接解析出的模型结构中的Postgres默认值函数替换为SQLite表达式，不影响查询连接
+func (s *SQLiteDB) CreateTables(ctx context.Context) error {
+	conn, err := gorm.Open(sqlite.Open(s.moonshotDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return fmt.Errorf("打开迁移连接失败: %w", err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return fmt.Errorf("获取迁移连接失败: %w", err)
+	}
+	defer sqlDB.Close()
+
+	for _, model := range migrationModels {
+		stmt := &gorm.Statement{DB: conn}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("解析模型失败: %w", err)
+		}
+		table := strings.TrimPrefix(stmt.Schema.Table, "moonshot.")
+		// 按表名缓存的模型结构即 AutoMigrate 使用的结构
+		if err := stmt.ParseWithSpecialTableName(model, table); err != nil {
+			return fmt.Errorf("解析模型失败: %w", err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if value, ok := sqliteDefaultValues[field.DefaultValue]; ok {
+				field.DefaultValue = value
+			}
+		}
+		if err := conn.WithContext(ctx).Table(table).AutoMigrate(model); err != nil {
+			return fmt.Errorf("自动迁移 %s 失败: %w", table, err)
+		}
+	}
+
+	log.Printf("SQLite表结构迁移完成: %d 张表", len(migrationModels))
+	return nil
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TaskSummary 时间窗口内所有任务的汇总统计
+type TaskSummary struct {
+	TotalTasks          int64            `json:"total_tasks"`
+	TasksByStatus       map[string]int64 `json:"tasks_by_status"`
+	ProcessingRuns      int64            `json:"processing_runs"`        // 处理统计条数，即规则解析执行次数
+	CategoriesProcessed int64            `json:"categories_processed"`   // 规则解析处理的记录总数
+	AvgProcessingTimeMs float64          `json:"avg_processing_time_ms"` // 规则解析的平均耗时
+	PromptTokens        int64            `json:"prompt_tokens"`
+	CompletionTokens    int64            `json:"completion_tokens"`
+	TotalTokens         int64            `json:"total_tokens"` // 来自任务结果中处理报告的token消耗
+}
+
+// tokenUsageExpr 生成读取任务结果中处理报告token字段的SQL表达式，field 如 total_tokens
+type tokenUsageExpr func(field string) string
+
+// postgresTokenUsage result 为 jsonb 列
+func postgresTokenUsage(field string) string {
+	return fmt.Sprintf("(result->'processing_report'->'token_usage'->>'%s')::bigint", field)
+}
+
+// sqliteTokenUsage result 以JSON文本保存
+func sqliteTokenUsage(field string) string {
+	return fmt.Sprintf("CAST(json_extract(result, '$.processing_report.token_usage.%s') AS INTEGER)", field)
+}
+
+// GetTaskSummary 统计 since 之后创建的任务、处理统计和LLM token消耗
+func (p *PostgreSQLDB) GetTaskSummary(ctx context.Context, since time.Time) (*TaskSummary, error) {
+	return getTaskSummary(p.db.WithContext(ctx), since, postgresTokenUsage)
+}
+
+// GetTaskSummary SQLite没有jsonb操作符，token字段通过 json_extract 读取
+func (s *SQLiteDB) GetTaskSummary(ctx context.Context, since time.Time) (*TaskSummary, error) {
+	return getTaskSummary(s.db.WithContext(ctx), since, sqliteTokenUsage)
+}
+
+func getTaskSummary(db *gorm.DB, since time.Time, tokenUsage tokenUsageExpr) (*TaskSummary, error) {
+	summary := &TaskSummary{TasksByStatus: make(map[string]int64)}
+
+	var statusCounts []struct {
+		Status string
+		Count  int64
+	}
+	err := db.Model(&TaskRecord{}).
+		Select("status, COUNT(*) AS count").
+		Where("created_at >= ?", since).
+		Group("status").
+		Scan(&statusCounts).Error
+	if err != nil {
+		return nil, fmt.Errorf("按状态统计任务失败: %w", err)
+	}
+	for _, sc := range statusCounts {
+		summary.TasksByStatus[sc.Status] = sc.Count
+		summary.TotalTasks += sc.Count
+	}
+
+	var stats struct {
+		Runs      int64
+		Processed int64
+		AvgTimeMs float64
+	}
+	err = db.Model(&ProcessingStats{}).
+		Select("COUNT(*) AS runs, COALESCE(SUM(processed_records), 0) AS processed, COALESCE(AVG(processing_time_ms), 0) AS avg_time_ms").
+		Where("created_at >= ?", since).
+		Scan(&stats).Error
+	if err != nil {
+		return nil, fmt.Errorf("统计处理记录失败: %w", err)
+	}
+	summary.ProcessingRuns = stats.Runs
+	summary.CategoriesProcessed = stats.Processed
+	summary.AvgProcessingTimeMs = stats.AvgTimeMs
+
+	var tokens struct {
+		Prompt     int64
+		Completion int64
+		Total      int64
+	}
+	err = db.Model(&TaskRecord{}).
+		Select(fmt.Sprintf("COALESCE(SUM(%s), 0) AS prompt, COALESCE(SUM(%s), 0) AS completion, COALESCE(SUM(%s), 0) AS total",
+			tokenUsage("prompt_tokens"), tokenUsage("completion_tokens"), tokenUsage("total_tokens"))).
+		Where("created_at >= ? AND result IS NOT NULL", since).
+		Scan(&tokens).Error
+	if err != nil {
+		return nil, fmt.Errorf("统计token消耗失败: %w", err)
+	}
+	summary.PromptTokens = tokens.Prompt
+	summary.CompletionTokens = tokens.Completion
+	summary.TotalTokens = tokens.Total
+
+	return summary, nil
+}
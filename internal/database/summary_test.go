@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+func TestGetTaskSummary(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewSQLiteDB(&SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	now := time.Now()
+	old := now.Add(-30 * 24 * time.Hour)
+	tasks := []*TaskRecord{
+		{ID: "1b3d5f7b-9c1e-4a3b-8d5f-7b9c1e3a5b7d", Status: "completed", CreatedAt: now,
+			Result: datatypes.JSON(`{"processing_report":{"token_usage":{"prompt_tokens":800,"completion_tokens":200,"total_tokens":1000}}}`)},
+		{ID: "2c4e6a8c-0d2f-4b4c-9e6a-8c0d2f4b6c8e", Status: "completed", CreatedAt: now,
+			Result: datatypes.JSON(`{"processing_report":{"token_usage":{"prompt_tokens":300,"completion_tokens":200,"total_tokens":500}}}`)},
+		{ID: "3d5f7b9d-1e3a-4c5d-8f7b-9d1e3a5c7d9f", Status: "failed", CreatedAt: now, Result: datatypes.JSON(`{"error":"x"}`)},
+		{ID: "4e6a8c0e-2f4b-4d6e-9a8c-0e2f4b6d8e0a", Status: "pending", CreatedAt: now},
+		// 时间窗口之外
+		{ID: "5f7b9d1f-3a5c-4e7f-8b9d-1f3a5c7e9f1b", Status: "completed", CreatedAt: old,
+			Result: datatypes.JSON(`{"processing_report":{"token_usage":{"total_tokens":9999}}}`)},
+	}
+	for _, task := range tasks {
+		task.Type = "rule"
+		task.Config = datatypes.JSON(`{}`)
+		if err := db.CreateTask(ctx, task); err != nil {
+			t.Fatalf("创建任务失败: %v", err)
+		}
+	}
+	for _, stats := range []*ProcessingStats{
+		{ID: "6a8c0e2a-4b6d-4f8a-9c0e-2a4b6d8f0a2c", TaskID: tasks[0].ID, ProcessedRecords: 100, ProcessingTimeMs: 200, CreatedAt: now},
+		{ID: "7b9d1f3b-5c7e-4a9b-8d1f-3b5c7e9a1b3d", TaskID: tasks[1].ID, ProcessedRecords: 50, ProcessingTimeMs: 400, CreatedAt: now},
+		{ID: "8c0e2a4c-6d8f-4b0c-9e2a-4c6d8f0b2c4e", TaskID: tasks[4].ID, ProcessedRecords: 999, ProcessingTimeMs: 9999, CreatedAt: old},
+	} {
+		if err := db.CreateProcessingStats(ctx, stats); err != nil {
+			t.Fatalf("创建处理统计失败: %v", err)
+		}
+	}
+
+	summary, err := db.GetTaskSummary(ctx, now.Add(-7*24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetTaskSummary: %v", err)
+	}
+	if summary.TotalTasks != 4 || summary.TasksByStatus["completed"] != 2 || summary.TasksByStatus["failed"] != 1 || summary.TasksByStatus["pending"] != 1 {
+		t.Errorf("unexpected task counts: %+v", summary)
+	}
+	if summary.ProcessingRuns != 2 || summary.CategoriesProcessed != 150 || summary.AvgProcessingTimeMs != 300 {
+		t.Errorf("unexpected processing stats: %+v", summary)
+	}
+	if summary.PromptTokens != 1100 || summary.CompletionTokens != 400 || summary.TotalTokens != 1500 {
+		t.Errorf("unexpected token usage: %+v", summary)
+	}
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+func TestClaimTask_ExactlyOnce(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewSQLiteDB(&SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	taskID := "1a3c5e7a-9b1d-4f3a-8c5e-7a9b1d3f5a7c"
+	if err := db.CreateTask(ctx, &TaskRecord{ID: taskID, Type: "rule", Status: "pending", Config: datatypes.JSON(`{}`)}); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	claims := make(chan *TaskRecord, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(workerID string) {
+			defer wg.Done()
+			task, err := db.ClaimTask(ctx, taskID, workerID, 0)
+			if err != nil {
+				t.Errorf("领取任务失败: %v", err)
+				return
+			}
+			if task != nil {
+				claims <- task
+			}
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+	close(claims)
+
+	var claimed []*TaskRecord
+	for task := range claims {
+		claimed = append(claimed, task)
+	}
+	if len(claimed) != 1 {
+		t.Fatalf("Expected exactly one claim, got %d", len(claimed))
+	}
+	if claimed[0].ID != taskID || claimed[0].Status != "processing" || claimed[0].ProcessedBy == "" {
+		t.Errorf("Unexpected claimed task: %+v", claimed[0])
+	}
+
+	stored, err := db.GetTask(ctx, taskID)
+	if err != nil {
+		t.Fatalf("获取任务失败: %v", err)
+	}
+	if stored.Status != "processing" || stored.ProcessedBy != claimed[0].ProcessedBy {
+		t.Errorf("Expected stored task claimed by %s, got %+v", claimed[0].ProcessedBy, stored)
+	}
+
+	// 不存在的任务同样返回 nil
+	if task, err := db.ClaimTask(ctx, "3c5e7a9b-1d3f-4a5c-8e7a-9b1d3f5a7c9e", "a", 0); err != nil || task != nil {
+		t.Errorf("Expected nil for missing task, got %+v (err: %v)", task, err)
+	}
+}
+
+func TestClaimTask_TakesOverStaleClaim(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewSQLiteDB(&SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	taskID := "5e7a9b1d-3f5a-4c7e-9a1b-3d5f7a9c1e3a"
+	if err := db.CreateTask(ctx, &TaskRecord{ID: taskID, Type: "rule", Status: "pending", Config: datatypes.JSON(`{}`)}); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	if task, err := db.ClaimTask(ctx, taskID, "a", time.Hour); err != nil || task == nil || task.ClaimedAt == nil {
+		t.Fatalf("Expected first claim to succeed, got %+v (err: %v)", task, err)
+	}
+
+	// 领取未超时，其他worker不能接管
+	if task, err := db.ClaimTask(ctx, taskID, "b", time.Hour); err != nil || task != nil {
+		t.Errorf("Expected fresh claim to be kept, got %+v (err: %v)", task, err)
+	}
+	if stale, err := db.ListStaleClaims(ctx, "rule", time.Now().Add(-time.Hour), 10); err != nil || len(stale) != 0 {
+		t.Errorf("Expected no stale claims, got %d (err: %v)", len(stale), err)
+	}
+
+	// 领取时间早于超时时长后视为原worker已退出
+	claimedAt := time.Now().Add(-2 * time.Hour)
+	if err := db.GetDB().Model(&TaskRecord{}).Where("id = ?", taskID).Update("claimed_at", claimedAt).Error; err != nil {
+		t.Fatalf("更新领取时间失败: %v", err)
+	}
+	stale, err := db.ListStaleClaims(ctx, "rule", time.Now().Add(-time.Hour), 10)
+	if err != nil || len(stale) != 1 || stale[0].ID != taskID {
+		t.Fatalf("Expected stale claim %s, got %+v (err: %v)", taskID, stale, err)
+	}
+	if task, err := db.ClaimTask(ctx, taskID, "b", 0); err != nil || task != nil {
+		t.Errorf("Expected no takeover without timeout, got %+v (err: %v)", task, err)
+	}
+	task, err := db.ClaimTask(ctx, taskID, "b", time.Hour)
+	if err != nil || task == nil || task.ProcessedBy != "b" {
+		t.Fatalf("Expected worker b to take over stale claim, got %+v (err: %v)", task, err)
+	}
+}
+
+func TestCountActiveTasks_IncludesRunningFlows(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewSQLiteDB(&SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	stale := time.Now().Add(-FlowActiveWindow - time.Hour)
+	tasks := []*TaskRecord{
+		{ID: "2b4d6f8a-0c2e-4a4b-9d6f-8a0c2e4b6d8f", Status: "pending"},
+		{ID: "4d6f8a0c-2e4b-4c6d-8f8a-0c2e4b6d8f0a", Status: "completed"},
+		{ID: "6f8a0c2e-4b6d-4e8f-a0c2-e4b6d8f0a2c4", Status: "completed"},
+		{ID: "8a0c2e4b-6d8f-4a0c-b2e4-b6d8f0a2c4e6", Status: "completed", FlowStartedAt: &stale},
+		{ID: "0c2e4b6d-8f0a-4c2e-84b6-d8f0a2c4e6a8", Status: "failed"},
+	}
+	for _, task := range tasks {
+		task.Type = "rule"
+		task.Config = datatypes.JSON(`{}`)
+		if err := db.CreateTask(ctx, task); err != nil {
+			t.Fatalf("创建任务失败: %v", err)
+		}
+	}
+
+	count := func() int64 {
+		t.Helper()
+		active, err := db.CountActiveTasks(ctx)
+		if err != nil {
+			t.Fatalf("统计活跃任务失败: %v", err)
+		}
+		return active
+	}
+	if active := count(); active != 1 {
+		t.Fatalf("只有排队中的任务应计入，实际 %d", active)
+	}
+
+	// 规则步骤已完成但增量流程仍在运行的任务计入活跃任务，超过时间窗口的遗留标记不计入
+	if err := db.SetTaskFlowRunning(ctx, tasks[1].ID, true); err != nil {
+		t.Fatalf("标记流程运行失败: %v", err)
+	}
+	if active := count(); active != 2 {
+		t.Errorf("运行中的增量流程应计入活跃任务，实际 %d", active)
+	}
+
+	if err := db.SetTaskFlowRunning(ctx, tasks[1].ID, false); err != nil {
+		t.Fatalf("清除流程标记失败: %v", err)
+	}
+	if active := count(); active != 1 {
+		t.Errorf("流程结束后不应再计入，实际 %d", active)
+	}
+	task, err := db.GetTask(ctx, tasks[1].ID)
+	if err != nil || task.FlowStartedAt != nil || task.Status != "completed" {
+		t.Errorf("清除流程标记不应改变任务状态: %+v (err: %v)", task, err)
+	}
+}
@@ -0,0 +1,358 @@
+package httpx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLogLevel 请求日志的详细程度
+type AccessLogLevel string
+
+const (
+	AccessLogOff   AccessLogLevel = "off"   // 不记录
+	AccessLogBasic AccessLogLevel = "basic" // 记录方法、路径、状态码、耗时和请求ID
+	AccessLogBody  AccessLogLevel = "body"  // 另外记录脱敏后的请求头、请求体和响应体
+)
+
+const (
+	// DefaultAccessLogMaxBody 记录请求体和响应体的默认最大字节数
+	DefaultAccessLogMaxBody = 4096
+	// DefaultAccessLogFieldRunes 提示词等长文本字段默认保留的字符数
+	DefaultAccessLogFieldRunes = 100
+
+	redactedValue = "[REDACTED]"
+)
+
+// defaultRedactFields 默认脱敏的JSON字段、请求头和查询参数，比较时不区分大小写
+var defaultRedactFields = []string{"authorization", "x-api-key", "api_key", "apikey", "auth_token", "token", "password", "secret"}
+
+// defaultTruncateFields 默认截断的JSON字段，提示词只保留开头用于定位问题
+var defaultTruncateFields = []string{"prompt", "system_prompt"}
+
+// AccessLogRoute 按路径前缀覆盖日志级别，前缀最长的规则优先
+type AccessLogRoute struct {
+	Prefix string
+	Level  AccessLogLevel
+}
+
+// AccessLogConfig 请求日志配置
+type AccessLogConfig struct {
+	Level          AccessLogLevel   // 默认级别，为空时为 basic
+	Routes         []AccessLogRoute // 按路由覆盖级别，如健康检查关闭、任务提交记录请求体
+	MaxBodyBytes   int              // 请求体和响应体超过该字节数时不记录内容，<=0 时使用默认值
+	RedactFields   []string         // 在默认字段之外需要脱敏的字段
+	TruncateFields []string         // 在默认字段之外需要截断的长文本字段
+	FieldRunes     int              // 长文本字段保留的字符数，<=0 时使用默认值
+}
+
+// levelFor 返回路径适用的日志级别
+func (cfg AccessLogConfig) levelFor(path string) AccessLogLevel {
+	level, matched := cfg.Level, -1
+	for _, route := range cfg.Routes {
+		if strings.HasPrefix(path, route.Prefix) && len(route.Prefix) > matched {
+			level, matched = route.Level, len(route.Prefix)
+		}
+	}
+	return level
+}
+
+// AccessLog 请求日志中间件，替代 gin.Logger：记录方法、路径、状态码、耗时和请求ID，
+// body 级别下记录请求头、请求体和响应体，其中密钥等敏感字段脱敏、提示词截断，非JSON内容只记录长度。
+// 应注册在响应压缩之后，记录的是压缩前的响应体
+func AccessLog(cfg AccessLogConfig) gin.HandlerFunc {
+	if cfg.Level == "" {
+		cfg.Level = AccessLogBasic
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = DefaultAccessLogMaxBody
+	}
+	if cfg.FieldRunes <= 0 {
+		cfg.FieldRunes = DefaultAccessLogFieldRunes
+	}
+	r := &redactor{
+		redact:   fieldSet(defaultRedactFields, cfg.RedactFields),
+		truncate: fieldSet(defaultTruncateFields, cfg.TruncateFields),
+		runes:    cfg.FieldRunes,
+	}
+
+	return func(c *gin.Context) {
+		level := cfg.levelFor(c.Request.URL.Path)
+		if level == AccessLogOff {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		var requestBody []byte
+		var requestTooLarge bool
+		var writer *bodyCaptureWriter
+		if level == AccessLogBody {
+			requestBody, requestTooLarge = peekRequestBody(c, cfg.MaxBodyBytes)
+			writer = &bodyCaptureWriter{ResponseWriter: c.Writer, limit: cfg.MaxBodyBytes}
+			c.Writer = writer
+		}
+
+		c.Next()
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "[HTTP] %d %s %s %s request_id=%s client=%s",
+			c.Writer.Status(), c.Request.Method, r.redactURL(c.Request.URL), time.Since(start).Round(time.Microsecond),
+			requestID(c), c.ClientIP())
+		if len(c.Errors) > 0 {
+			fmt.Fprintf(&b, " errors=%q", c.Errors.String())
+		}
+		if writer != nil {
+			fmt.Fprintf(&b, " headers=%s", r.headers(c.Request.Header))
+			fmt.Fprintf(&b, " request_body=%s", r.body(c.ContentType(), requestBody, requestTooLarge, cfg.MaxBodyBytes))
+			fmt.Fprintf(&b, " response_body=%s", r.body(contentType(writer.Header().Get("Content-Type")), writer.buf.Bytes(), writer.overflow, cfg.MaxBodyBytes))
+		}
+		log.Print(b.String())
+	}
+}
+
+// requestID 优先取 RequestID 中间件设置的值，其次取请求头或响应头中的 X-Request-ID
+func requestID(c *gin.Context) string {
+	if id := c.GetString("RequestID"); id != "" {
+		return id
+	}
+	if id := c.GetHeader("X-Request-ID"); id != "" {
+		return id
+	}
+	if id := c.Writer.Header().Get("X-Request-ID"); id != "" {
+		return id
+	}
+	return "-"
+}
+
+// peekRequestBody 读取不超过 limit 字节的请求体用于记录，并把已读取的部分放回，处理器仍能读取完整请求体
+func peekRequestBody(c *gin.Context, limit int) ([]byte, bool) {
+	if c.Request.Body == nil {
+		return nil, false
+	}
+	if c.Request.ContentLength > int64(limit) {
+		return nil, true
+	}
+	body := c.Request.Body
+	peeked, err := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	c.Request.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(peeked), body), Closer: body}
+	if err != nil {
+		return nil, false
+	}
+	if len(peeked) > limit {
+		return nil, true
+	}
+	return peeked, false
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyCaptureWriter 在写出响应的同时保留前 limit 字节
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *bodyCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyCaptureWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.buf.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.buf.Reset()
+		return
+	}
+	w.buf.Write(data)
+}
+
+// redactor 对请求日志中的敏感字段脱敏、长文本截断
+type redactor struct {
+	redact   map[string]bool
+	truncate map[string]bool
+	runes    int
+}
+
+func fieldSet(defaults, extra []string) map[string]bool {
+	set := make(map[string]bool, len(defaults)+len(extra))
+	for _, field := range append(append([]string(nil), defaults...), extra...) {
+		if field = strings.ToLower(strings.TrimSpace(field)); field != "" {
+			set[field] = true
+		}
+	}
+	return set
+}
+
+// redactURL 返回脱敏查询参数后的路径，如 api_key
+func (r *redactor) redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	query := u.Query()
+	for key := range query {
+		if r.redact[strings.ToLower(key)] {
+			query.Set(key, redactedValue)
+		}
+	}
+	return u.Path + "?" + query.Encode()
+}
+
+// headers 返回脱敏后的请求头
+func (r *redactor) headers(header map[string][]string) string {
+	redacted := make(map[string]string, len(header))
+	for key, values := range header {
+		if r.redact[strings.ToLower(key)] {
+			redacted[key] = redactedValue
+			continue
+		}
+		redacted[key] = strings.Join(values, ",")
+	}
+	encoded, _ := json.Marshal(redacted)
+	return string(encoded)
+}
+
+// body 返回可以写入日志的请求体或响应体：JSON 脱敏后输出，其他内容只记录长度
+func (r *redactor) body(contentType string, data []byte, tooLarge bool, limit int) string {
+	switch {
+	case tooLarge:
+		return fmt.Sprintf("[超过%d字节，未记录]", limit)
+	case len(data) == 0:
+		return "-"
+	case !strings.Contains(contentType, "json"):
+		return fmt.Sprintf("[%s %d字节]", contentType, len(data))
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Sprintf("[无效JSON %d字节]", len(data))
+	}
+	encoded, _ := json.Marshal(r.value(value))
+	return string(encoded)
+}
+
+// value 递归处理JSON值：敏感字段替换为 [REDACTED]，长文本字段截断
+func (r *redactor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			lower := strings.ToLower(key)
+			switch {
+			case r.redact[lower]:
+				v[key] = redactedValue
+			case r.truncate[lower]:
+				if s, ok := field.(string); ok {
+					v[key] = truncateRunes(s, r.runes)
+				}
+			default:
+				v[key] = r.value(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.value(item)
+		}
+	}
+	return v
+}
+
+// truncateRunes 超过 n 个字符时只保留开头，并注明原始长度
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return fmt.Sprintf("%s...(共%d字)", string(runes[:n]), len(runes))
+}
+
+// contentType 去掉 Content-Type 中的参数部分
+func contentType(v string) string {
+	if i := strings.Index(v, ";"); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(v)
+}
+
+// ParseAccessLogLevel 解析日志级别 off/basic/body
+func ParseAccessLogLevel(v string) (AccessLogLevel, error) {
+	switch level := AccessLogLevel(strings.ToLower(strings.TrimSpace(v))); level {
+	case AccessLogOff, AccessLogBasic, AccessLogBody:
+		return level, nil
+	}
+	return "", fmt.Errorf("日志级别无效: %s，应为 off、basic 或 body", v)
+}
+
+// ParseAccessLogRoutes 解析逗号分隔的 路径前缀:级别，如 "/health:off,/api/v1/tasks:body"
+func ParseAccessLogRoutes(v string) ([]AccessLogRoute, error) {
+	var routes []AccessLogRoute
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, ":")
+		if i <= 0 || !strings.HasPrefix(entry, "/") {
+			return nil, fmt.Errorf("路由日志配置无效: %s，应为 路径前缀:级别", entry)
+		}
+		level, err := ParseAccessLogLevel(entry[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, AccessLogRoute{Prefix: entry[:i], Level: level})
+	}
+	return routes, nil
+}
+
+// AccessLogConfigFromEnv 读取以 prefix 开头的请求日志配置，如 prefix 为 API 时读取：
+// API_ACCESS_LOG_LEVEL（off/basic/body，默认 basic）、API_ACCESS_LOG_ROUTES（按路由覆盖级别）、
+// API_ACCESS_LOG_MAX_BODY（记录请求体和响应体的最大字节数）、API_ACCESS_LOG_REDACT_FIELDS（额外脱敏的字段，逗号分隔）
+func AccessLogConfigFromEnv(prefix string) (AccessLogConfig, error) {
+	cfg := AccessLogConfig{Level: AccessLogBasic, MaxBodyBytes: DefaultAccessLogMaxBody}
+	if v := os.Getenv(prefix + "_ACCESS_LOG_LEVEL"); v != "" {
+		level, err := ParseAccessLogLevel(v)
+		if err != nil {
+			return cfg, fmt.Errorf("%s_ACCESS_LOG_LEVEL 配置无效: %w", prefix, err)
+		}
+		cfg.Level = level
+	}
+	if v := os.Getenv(prefix + "_ACCESS_LOG_ROUTES"); v != "" {
+		routes, err := ParseAccessLogRoutes(v)
+		if err != nil {
+			return cfg, fmt.Errorf("%s_ACCESS_LOG_ROUTES 配置无效: %w", prefix, err)
+		}
+		cfg.Routes = routes
+	}
+	if v := os.Getenv(prefix + "_ACCESS_LOG_MAX_BODY"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			return cfg, fmt.Errorf("%s_ACCESS_LOG_MAX_BODY 配置无效: %s", prefix, v)
+		}
+		cfg.MaxBodyBytes = parsed
+	}
+	if v := os.Getenv(prefix + "_ACCESS_LOG_REDACT_FIELDS"); v != "" {
+		cfg.RedactFields = strings.Split(v, ",")
+	}
+	return cfg, nil
+}
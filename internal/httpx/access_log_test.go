@@ -0,0 +1,163 @@
+package httpx
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captureAccessLog 以给定配置处理一个请求，返回处理器读到的请求体和写出的日志
+func captureAccessLog(t *testing.T, cfg AccessLogConfig, req *http.Request) (string, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var out bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&out)
+	defer log.SetOutput(previous)
+
+	var handlerBody string
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("RequestID", "req-1")
+		c.Next()
+	})
+	router.Use(AccessLog(cfg))
+	handler := func(c *gin.Context) {
+		data, _ := io.ReadAll(c.Request.Body)
+		handlerBody = string(data)
+		c.JSON(http.StatusCreated, gin.H{"task_id": "t-1", "token": "resp-secret"})
+	}
+	router.POST("/api/v1/tasks", handler)
+	router.GET("/health", handler)
+
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	return handlerBody, out.String()
+}
+
+func TestAccessLog_BasicRecordsRequestWithoutBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks?api_key=qs-secret&page=1", strings.NewReader(`{"api_key":"body-secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	handlerBody, line := captureAccessLog(t, AccessLogConfig{}, req)
+
+	if handlerBody != `{"api_key":"body-secret"}` {
+		t.Fatalf("handler body = %q", handlerBody)
+	}
+	for _, want := range []string{"201", "POST", "/api/v1/tasks?", "request_id=req-1", "api_key=%5BREDACTED%5D"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log %q missing %q", line, want)
+		}
+	}
+	for _, secret := range []string{"qs-secret", "body-secret", "request_body"} {
+		if strings.Contains(line, secret) {
+			t.Errorf("log %q should not contain %q", line, secret)
+		}
+	}
+}
+
+func TestAccessLog_BodyRedactsAndTruncates(t *testing.T) {
+	prompt := strings.Repeat("长", 150)
+	body := `{"prompt":"` + prompt + `","api_key":"body-secret","options":[{"password":"p"}],"model":"kimi"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer header-secret")
+	req.Header.Set("X-API-Key", "key-secret")
+
+	handlerBody, line := captureAccessLog(t, AccessLogConfig{Level: AccessLogBody}, req)
+
+	if handlerBody != body {
+		t.Fatalf("handler should read the full request body, got %d bytes", len(handlerBody))
+	}
+	for _, secret := range []string{"header-secret", "key-secret", "body-secret", `"password":"p"`, "resp-secret", prompt} {
+		if strings.Contains(line, secret) {
+			t.Errorf("log should not contain %q: %s", secret, line)
+		}
+	}
+	for _, want := range []string{`"model":"kimi"`, `"task_id":"t-1"`, "(共150字)", redactedValue} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log missing %q: %s", want, line)
+		}
+	}
+}
+
+func TestAccessLog_BodyOverLimitNotRecorded(t *testing.T) {
+	body := `{"text":"` + strings.Repeat("x", 64) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+
+	handlerBody, line := captureAccessLog(t, AccessLogConfig{Level: AccessLogBody, MaxBodyBytes: 16}, req)
+
+	if handlerBody != body {
+		t.Fatalf("handler should read the full request body, got %q", handlerBody)
+	}
+	if strings.Contains(line, "xxxx") || !strings.Contains(line, "request_body=[超过16字节") {
+		t.Errorf("oversized body should not be logged: %s", line)
+	}
+}
+
+func TestAccessLog_RouteOverride(t *testing.T) {
+	cfg := AccessLogConfig{Level: AccessLogBasic, Routes: []AccessLogRoute{{Prefix: "/health", Level: AccessLogOff}}}
+
+	_, line := captureAccessLog(t, cfg, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if line != "" {
+		t.Errorf("/health should not be logged, got %q", line)
+	}
+
+	cfg.Routes = append(cfg.Routes, AccessLogRoute{Prefix: "/api/v1", Level: AccessLogOff}, AccessLogRoute{Prefix: "/api/v1/tasks", Level: AccessLogBody})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(`{"model":"kimi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	_, line = captureAccessLog(t, cfg, req)
+	if !strings.Contains(line, `request_body={"model":"kimi"}`) {
+		t.Errorf("longest prefix should win, got %q", line)
+	}
+}
+
+func TestParseAccessLogRoutes(t *testing.T) {
+	routes, err := ParseAccessLogRoutes(" /health:off, /api/v1/tasks:BODY ,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []AccessLogRoute{{Prefix: "/health", Level: AccessLogOff}, {Prefix: "/api/v1/tasks", Level: AccessLogBody}}
+	if len(routes) != len(want) {
+		t.Fatalf("routes = %+v, want %+v", routes, want)
+	}
+	for i := range want {
+		if routes[i] != want[i] {
+			t.Errorf("routes[%d] = %+v, want %+v", i, routes[i], want[i])
+		}
+	}
+
+	for _, invalid := range []string{"health:off", "/health", "/health:verbose"} {
+		if _, err := ParseAccessLogRoutes(invalid); err == nil {
+			t.Errorf("ParseAccessLogRoutes(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestAccessLogConfigFromEnv(t *testing.T) {
+	t.Setenv("TEST_ACCESS_LOG_LEVEL", "body")
+	t.Setenv("TEST_ACCESS_LOG_ROUTES", "/health:off")
+	t.Setenv("TEST_ACCESS_LOG_MAX_BODY", "1024")
+	t.Setenv("TEST_ACCESS_LOG_REDACT_FIELDS", "session_id")
+
+	cfg, err := AccessLogConfigFromEnv("TEST")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Level != AccessLogBody || cfg.MaxBodyBytes != 1024 || len(cfg.Routes) != 1 || len(cfg.RedactFields) != 1 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	t.Setenv("TEST_ACCESS_LOG_MAX_BODY", "-1")
+	if _, err := AccessLogConfigFromEnv("TEST"); err == nil {
+		t.Error("negative max body should fail")
+	}
+}
@@ -0,0 +1,139 @@
+// Package httpx 提供服务间调用共享的HTTP客户端
+package httpx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Config HTTP客户端配置
+type Config struct {
+	Timeout             time.Duration `yaml:"timeout" env:"HTTP_CLIENT_TIMEOUT" default:"120s"`
+	MaxIdleConns        int           `yaml:"max_idle_conns" env:"HTTP_CLIENT_MAX_IDLE_CONNS" default:"100"`
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host" env:"HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST" default:"20"`
+	IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout" env:"HTTP_CLIENT_IDLE_CONN_TIMEOUT" default:"90s"`
+	MaxRetries          int           `yaml:"max_retries" env:"HTTP_CLIENT_MAX_RETRIES" default:"2"`
+	RetryBackoff        time.Duration `yaml:"retry_backoff" env:"HTTP_CLIENT_RETRY_BACKOFF" default:"500ms"`
+}
+
+// DefaultConfig 返回默认HTTP客户端配置
+func DefaultConfig() Config {
+	return Config{
+		Timeout:             120 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 20,
+		IdleConnTimeout:     90 * time.Second,
+		MaxRetries:          2,
+		RetryBackoff:        500 * time.Millisecond,
+	}
+}
+
+// NewClient 根据配置创建HTTP客户端
+// 幂等请求（GET/HEAD）在连接重置或5xx响应时自动重试，其余请求只发送一次
+func NewClient(cfg Config) *http.Client {
+	defaults := DefaultConfig()
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = defaults.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = defaults.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = defaults.IdleConnTimeout
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaults.RetryBackoff
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.MaxIdleConns = cfg.MaxIdleConns
+	base.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	base.IdleConnTimeout = cfg.IdleConnTimeout
+
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &retryTransport{
+			base:       base,
+			maxRetries: cfg.MaxRetries,
+			backoff:    cfg.RetryBackoff,
+		},
+	}
+}
+
+// retryTransport 对幂等请求进行自动重试的RoundTripper
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	backoff    time.Duration
+}
+
+// RoundTrip 实现http.RoundTripper接口
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		resp, err = t.base.RoundTrip(req)
+
+		retryable := false
+		if err != nil {
+			retryable = isRetryableError(err)
+		} else if resp.StatusCode >= http.StatusInternalServerError {
+			retryable = true
+		}
+
+		if !retryable || attempt >= t.maxRetries {
+			return resp, err
+		}
+
+		// 丢弃本次响应以便复用连接
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, fmt.Errorf("等待重试时请求被取消: %w", req.Context().Err())
+		case <-time.After(t.backoff * time.Duration(attempt+1)):
+		}
+	}
+}
+
+// isIdempotent 判断请求是否可安全重试
+func isIdempotent(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+// isRetryableError 判断网络错误是否为瞬时错误
+func isRetryableError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "connection reset by peer")
+}
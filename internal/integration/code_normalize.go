@@ -0,0 +1,55 @@
+package integration
+
+import (
+	"strings"
+	"unicode"
+)
+
+// codeDashes PDF提取和LLM输出中常见的横线变体，统一替换为ASCII连字符
+var codeDashes = map[rune]bool{
+	'－': true, // 全角连字符 U+FF0D
+	'‐': true, // U+2010
+	'‑': true, // 不换行连字符 U+2011
+	'‒': true, // U+2012
+	'–': true, // EN横线 U+2013
+	'—': true, // EM横线 U+2014
+	'―': true, // U+2015
+	'−': true, // 减号 U+2212
+	'﹣': true, // 小型连字符 U+FE63
+}
+
+// normalizeCode 规范化职业编码：全角数字转为ASCII数字，各种横线转为 "-"，去除所有空白
+// 如 "１－０１ －０１" 规范化为 "1-01-01"，已是ASCII的编码保持不变
+func normalizeCode(code string) string {
+	var b strings.Builder
+	b.Grow(len(code))
+	for _, r := range code {
+		switch {
+		case r >= '０' && r <= '９':
+			b.WriteRune('0' + (r - '０'))
+		case codeDashes[r]:
+			b.WriteByte('-')
+		case unicode.IsSpace(r) || r == '\u200b' || r == '\ufeff':
+			// 包括全角空格、不间断空格，以及不属于 unicode 空白的零宽空格和BOM
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// normalizePDFCodes 原地规范化PDF条目中的编码，返回被修改的条目数
+func normalizePDFCodes(pdfData []map[string]interface{}) int {
+	changed := 0
+	for _, item := range pdfData {
+		code, ok := item["code"].(string)
+		if !ok {
+			continue
+		}
+		if normalized := normalizeCode(code); normalized != code {
+			item["code"] = normalized
+			changed++
+		}
+	}
+	return changed
+}
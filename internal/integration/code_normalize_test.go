@@ -0,0 +1,83 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalizeCode 测试全角、混合宽度编码规范化为ASCII编码
+func TestNormalizeCode(t *testing.T) {
+	cases := map[string]string{
+		"1-01-01-01":       "1-01-01-01",
+		"１－０１－０１－０１":       "1-01-01-01",
+		"１-01－０２":          "1-01-02",
+		"1—01 -01":         "1-01-01",
+		"2–03−04‐05":       "2-03-04-05",
+		" 3-01\u3000-01 ":  "3-01-01",
+		"4-01\u00a0-02":    "4-01-02",
+		"\ufeff5-01\u200b": "5-01",
+		"GBM １０１００":        "GBM10100",
+		"":                 "",
+	}
+	for input, expected := range cases {
+		assert.Equal(t, expected, normalizeCode(input), "input: %q", input)
+	}
+}
+
+// TestNormalizePDFCodes 测试原地规范化PDF条目编码并统计修改数
+func TestNormalizePDFCodes(t *testing.T) {
+	pdfData := []map[string]interface{}{
+		{"code": "１－０１", "name": "全角"},
+		{"code": "1-02", "name": "半角"},
+		{"code": 103, "name": "非字符串编码"},
+		{"name": "无编码"},
+	}
+	assert.Equal(t, 1, normalizePDFCodes(pdfData))
+	assert.Equal(t, "1-01", pdfData[0]["code"])
+	assert.Equal(t, "1-02", pdfData[1]["code"])
+	assert.Equal(t, 103, pdfData[2]["code"])
+}
+
+// TestGroupByCodePrefix_NormalizesCodes 测试全角编码按规范化后的前缀分组
+func TestGroupByCodePrefix_NormalizesCodes(t *testing.T) {
+	b := &BatchProcessor{}
+	groups, err := b.groupByCodePrefix(map[string]interface{}{
+		"occupation_codes": []interface{}{
+			map[string]interface{}{"code": "２－０１－０１", "name": "全角"},
+			map[string]interface{}{"code": "2-01-02", "name": "半角"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	items := groups[getMainCategory("2-01-01")]["occupation_codes"].([]interface{})
+	require.Len(t, items, 2)
+	assert.Equal(t, "2-01-01", items[0].(map[string]interface{})["code"])
+}
+
+// TestMergeResults_MatchesFullWidthCodes 测试全角和混合宽度的PDF编码能与分类编码匹配并参与去重
+func TestMergeResults_MatchesFullWidthCodes(t *testing.T) {
+	tree := []*model.Category{{
+		Code: "6-01", Name: "机械",
+		Children: []*model.Category{
+			{Code: "6-01-01", Name: "装配工"},
+			{Code: "6-01-02", Name: "钳工"},
+		},
+	}}
+	pdfData := []map[string]interface{}{
+		{"code": "６－０１－０１", "name": "机械装配工", "confidence": 0.9},
+		{"code": "6-01 -01", "name": "装配员", "confidence": 0.5},
+		{"code": "6—01-０２", "name": "机修钳工"},
+	}
+
+	processor := &PDFLLMProcessor{dedupPDFCodes: true}
+	choices := processor.MergeResults(tree, pdfData)
+	pdfNames := make(map[string]string)
+	for _, choice := range choices {
+		pdfNames[choice.Code] = choice.PdfName
+	}
+	assert.Equal(t, "机械装配工", pdfNames["6-01-01"], "同一编码的不同写法去重后保留置信度最高的条目")
+	assert.Equal(t, "机修钳工", pdfNames["6-01-02"])
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/httpx"
 	"github.com/freedkr/moonshot/internal/model"
 	"gorm.io/datatypes"
 )
@@ -27,13 +28,16 @@ type PDFServiceClient struct {
 	httpClient *http.Client
 }
 
-// NewPDFServiceClient 创建PDF服务客户端
+// NewPDFServiceClient 创建PDF服务客户端，连接池和重试参数取自环境变量
 func NewPDFServiceClient(config PDFServiceConfig) PDFService {
+	return newPDFServiceClient(config, getHTTPClientConfig())
+}
+
+// newPDFServiceClient 按指定的HTTP客户端配置创建PDF服务客户端
+func newPDFServiceClient(config PDFServiceConfig, httpConfig httpx.Config) *PDFServiceClient {
 	return &PDFServiceClient{
-		config: config,
-		httpClient: &http.Client{
-			Timeout: config.Timeout,
-		},
+		config:     config,
+		httpClient: newServiceHTTPClient(httpConfig, config.Timeout),
 	}
 }
 
@@ -151,40 +155,7 @@ func (c *PDFServiceClient) GetOccupationCodes(ctx context.Context, taskID string
 		return PDFResult{}, fmt.Errorf("parse result failed: %w", err)
 	}
 
-	// 转换为标准格式
-	pdfResult := PDFResult{
-		TaskID:      taskID,
-		Status:      "completed",
-		ProcessedAt: time.Now(),
-	}
-
-	if codes, ok := result["occupation_codes"].([]interface{}); ok {
-		pdfResult.TotalFound = len(codes)
-		for _, code := range codes {
-			if codeMap, ok := code.(map[string]interface{}); ok {
-				occupationCode := PDFOccupationCode{
-					ExtractedAt: time.Now(),
-				}
-				
-				if c, ok := codeMap["code"].(string); ok {
-					occupationCode.Code = c
-				}
-				if n, ok := codeMap["name"].(string); ok {
-					occupationCode.Name = n
-				}
-				if conf, ok := codeMap["confidence"].(float64); ok {
-					occupationCode.Confidence = conf
-				} else {
-					occupationCode.Confidence = 0.8 // 默认置信度
-				}
-				occupationCode.Source = "pdf"
-				
-				pdfResult.OccupationCodes = append(pdfResult.OccupationCodes, occupationCode)
-			}
-		}
-	}
-
-	return pdfResult, nil
+	return decodePDFResult(taskID, result, time.Now())
 }
 
 // waitForCompletion 等待处理完成
@@ -434,15 +405,9 @@ func NewProcessingRepository(db database.DatabaseInterface) ProcessingRepository
 
 // SaveProcessingResults 保存处理结果
 func (r *ProcessingRepositoryImpl) SaveProcessingResults(ctx context.Context, request PersistenceRequest) error {
-	// 获取GORM实例
-	pgDB, ok := r.db.(*database.PostgreSQLDB)
-	if !ok {
-		return fmt.Errorf("database type error")
-	}
-
 	// 删除旧数据
 	if request.Options.ReplaceExisting {
-		if err := pgDB.GetDB().WithContext(ctx).Where("task_id = ?", request.TaskID).Delete(&database.Category{}).Error; err != nil {
+		if err := r.db.WithContext(ctx).Where("task_id = ?", request.TaskID).Delete(&database.Category{}).Error; err != nil {
 			return fmt.Errorf("delete old categories failed: %w", err)
 		}
 	}
@@ -473,7 +438,7 @@ func (r *ProcessingRepositoryImpl) SaveProcessingResults(ctx context.Context, re
 		batchSize = 100
 	}
 
-	if err := pgDB.GetDB().WithContext(ctx).CreateInBatches(categories, batchSize).Error; err != nil {
+	if err := r.db.WithContext(ctx).CreateInBatches(categories, batchSize).Error; err != nil {
 		return fmt.Errorf("batch insert failed: %w", err)
 	}
 
@@ -506,6 +471,7 @@ func (r *ProcessingRepositoryImpl) UpdateTaskStatus(ctx context.Context, taskID
 // MetricsCollectorImpl 指标收集器实现
 type MetricsCollectorImpl struct {
 	metrics ProcessingMetrics
+	totals  map[string]StageTotals // 各阶段的累计计数，供 StageTotals 导出
 	mutex   sync.RWMutex
 }
 
@@ -518,6 +484,7 @@ func NewMetricsCollector() MetricsCollector {
 			RecentActivity:    make([]ActivityRecord, 0, 100),
 			Timestamp:         time.Now(),
 		},
+		totals: make(map[string]StageTotals),
 	}
 }
 
@@ -542,6 +509,11 @@ func (c *MetricsCollectorImpl) RecordProcessingDuration(stage string, duration t
 	
 	c.metrics.StageMetrics[stage] = stageMetrics
 
+	totals := c.totals[stage]
+	totals.DurationCount++
+	totals.TotalDuration += duration
+	c.totals[stage] = totals
+
 	// 记录活动
 	c.addActivity(stage, "duration_recorded", duration, "")
 }
@@ -560,6 +532,10 @@ func (c *MetricsCollectorImpl) RecordSuccess(stage string) {
 	// 成功率计算需要追踪成功次数
 	c.metrics.StageMetrics[stage] = stageMetrics
 
+	totals := c.totals[stage]
+	totals.SuccessCount++
+	c.totals[stage] = totals
+
 	c.addActivity(stage, "success", 0, "")
 }
 
@@ -580,6 +556,10 @@ func (c *MetricsCollectorImpl) RecordError(stage string, err error) {
 	stageMetrics.Errors = append(stageMetrics.Errors, errorType)
 	c.metrics.StageMetrics[stage] = stageMetrics
 
+	totals := c.totals[stage]
+	totals.ErrorCount++
+	c.totals[stage] = totals
+
 	c.addActivity(stage, "error", 0, errorType)
 }
 
@@ -605,6 +585,7 @@ func (c *MetricsCollectorImpl) GetMetrics() ProcessingMetrics {
 	
 	// 深拷贝StageMetrics
 	for k, v := range c.metrics.StageMetrics {
+		v.Errors = append([]string(nil), v.Errors...)
 		metricsCopy.StageMetrics[k] = v
 	}
 	
@@ -619,6 +600,18 @@ func (c *MetricsCollectorImpl) GetMetrics() ProcessingMetrics {
 	return metricsCopy
 }
 
+// StageTotals 复制各阶段的累计计数，只在复制期间持有读锁
+func (c *MetricsCollectorImpl) StageTotals() map[string]StageTotals {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	totals := make(map[string]StageTotals, len(c.totals))
+	for stage, t := range c.totals {
+		totals[stage] = t
+	}
+	return totals
+}
+
 // Reset 重置指标
 func (c *MetricsCollectorImpl) Reset() {
 	c.mutex.Lock()
@@ -630,6 +623,7 @@ func (c *MetricsCollectorImpl) Reset() {
 		RecentActivity:    make([]ActivityRecord, 0, 100),
 		Timestamp:         time.Now(),
 	}
+	c.totals = make(map[string]StageTotals)
 }
 
 // addActivity 添加活动记录
@@ -0,0 +1,70 @@
+package integration
+
+import (
+	"encoding/json"
+
+	"github.com/freedkr/moonshot/internal/database"
+)
+
+// ConfidenceReviewKey llm_enhancements 中记录低置信度处理结果的字段
+const ConfidenceReviewKey = "confidence_review"
+
+// RuleNameKey llm_enhancements 中记录规则解析原始名称的字段，名称被LLM覆盖后仍可用于对比
+const RuleNameKey = "rule_name"
+
+// SetMinConfidence 设置应用语义选择结果的最低置信度，0 表示不过滤
+func (p *IncrementalProcessor) SetMinConfidence(minConfidence float64) {
+	p.minConfidence = minConfidence
+}
+
+// llmResultUpdate 将一条语义选择结果转换为分类更新，结果中没有编码时返回 false
+// 置信度低于阈值时不覆盖名称，保留规则名称并在 llm_enhancements 的 confidence_review 字段中记录；
+// 未返回置信度的结果按原逻辑应用
+func (p *IncrementalProcessor) llmResultUpdate(item map[string]interface{}) (database.CategoryUpdate, bool) {
+	code, ok := item["code"].(string)
+	if !ok || code == "" {
+		return database.CategoryUpdate{}, false
+	}
+
+	updates := map[string]interface{}{
+		"status": database.StatusCompleted,
+	}
+	confidence, hasConfidence := item["confidence"].(float64)
+	if p.minConfidence > 0 && hasConfidence && confidence < p.minConfidence {
+		enhancements := make(map[string]interface{}, len(item)+1)
+		for key, value := range item {
+			enhancements[key] = value
+		}
+		enhancements[ConfidenceReviewKey] = map[string]interface{}{
+			"action":         "kept_rule_name",
+			"llm_name":       item["name"],
+			"confidence":     confidence,
+			"min_confidence": p.minConfidence,
+		}
+		item = enhancements
+	} else {
+		updates["name"] = item["name"] // 如果LLM优化了name，也更新
+	}
+
+	// 序列化LLM增强信息
+	llmInfoJSON, _ := json.Marshal(item)
+	updates["llm_enhancements"] = string(llmInfoJSON)
+	return database.CategoryUpdate{Code: code, Updates: updates}, true
+}
+
+// withRuleNames 为语义选择结果补充候选数据中的规则名称，LLM已返回该字段时不覆盖
+func withRuleNames(results []map[string]interface{}, choices []SemanticChoiceItem) {
+	ruleNames := make(map[string]string, len(choices))
+	for _, choice := range choices {
+		ruleNames[choice.Code] = choice.RuleName
+	}
+	for _, item := range results {
+		code, _ := item["code"].(string)
+		if _, exists := item[RuleNameKey]; exists {
+			continue
+		}
+		if ruleName, ok := ruleNames[code]; ok && ruleName != "" {
+			item[RuleNameKey] = ruleName
+		}
+	}
+}
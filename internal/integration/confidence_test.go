@@ -0,0 +1,63 @@
+package integration
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIncrementalProcessor_LLMResultUpdate 测试低于最低置信度的语义选择结果保留规则名称
+func TestIncrementalProcessor_LLMResultUpdate(t *testing.T) {
+	processor := &IncrementalProcessor{}
+	low := map[string]interface{}{"code": "1-01-01-01", "name": "焊接工", "confidence": 0.4}
+	noConfidence := map[string]interface{}{"code": "1-01-01-02", "name": "钳工"}
+
+	// 默认阈值为0，所有结果都覆盖名称
+	update, ok := processor.llmResultUpdate(low)
+	require.True(t, ok)
+	assert.Equal(t, "焊接工", update.Updates["name"])
+
+	processor.SetMinConfidence(0.6)
+	update, ok = processor.llmResultUpdate(low)
+	require.True(t, ok)
+	assert.NotContains(t, update.Updates, "name", "低置信度结果不覆盖名称")
+	var enhancements map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(update.Updates["llm_enhancements"].(string)), &enhancements))
+	review, ok := enhancements[ConfidenceReviewKey].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "kept_rule_name", review["action"])
+	assert.Equal(t, "焊接工", review["llm_name"])
+	assert.Equal(t, 0.6, review["min_confidence"])
+	assert.NotContains(t, low, ConfidenceReviewKey, "不修改原始结果")
+
+	// 未返回置信度的结果按原逻辑应用
+	update, ok = processor.llmResultUpdate(noConfidence)
+	require.True(t, ok)
+	assert.Equal(t, "钳工", update.Updates["name"])
+
+	_, ok = processor.llmResultUpdate(map[string]interface{}{"name": "无编码"})
+	assert.False(t, ok)
+}
+
+// TestWithRuleNames 测试语义选择结果补充规则名称，便于名称被覆盖后对比
+func TestWithRuleNames(t *testing.T) {
+	results := []map[string]interface{}{
+		{"code": "1-01-01-01", "name": "焊接工"},
+		{"code": "1-01-01-02", "name": "钳工", RuleNameKey: "钳工(LLM)"},
+		{"code": "9-99-99-99", "name": "未知"},
+	}
+	withRuleNames(results, []SemanticChoiceItem{
+		{Code: "1-01-01-01", RuleName: "焊工", PdfName: "焊接工"},
+		{Code: "1-01-01-02", RuleName: "钳工"},
+	})
+
+	assert.Equal(t, "焊工", results[0][RuleNameKey])
+	assert.Equal(t, "钳工(LLM)", results[1][RuleNameKey], "不覆盖已有字段")
+	assert.NotContains(t, results[2], RuleNameKey)
+
+	update, ok := (&IncrementalProcessor{}).llmResultUpdate(results[0])
+	require.True(t, ok)
+	assert.Contains(t, update.Updates["llm_enhancements"], `"rule_name":"焊工"`)
+}
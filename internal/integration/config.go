@@ -2,10 +2,13 @@ package integration
 
 import (
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/httpx"
 	"gopkg.in/yaml.v3"
 )
 
@@ -25,7 +28,6 @@ func LoadProcessingConfig(cfg *config.Config) *ProcessingConfig {
 			LLM: LLMServiceConfig{
 				BaseURL:    getConfigServiceURL("llm-service", "8090"),
 				Timeout:    120 * time.Second,
-				MaxRetries: 3,
 				TaskTypes:  []string{"data_cleaning", "semantic_analysis"},
 			},
 		},
@@ -48,11 +50,272 @@ func LoadProcessingConfig(cfg *config.Config) *ProcessingConfig {
 			PDFFilePath: getTestPDFPath(),
 		},
 		Concurrency: getOptimizedConcurrencyConfig(),
+		HTTP:        getHTTPClientConfig(),
 	}
+	processingConfig.Prompts.TemplatesDir = getPromptTemplatesDir()
+	processingConfig.Prompts.ParentHierarchyDepth = getParentHierarchyDepth()
+	processingConfig.Validation.NameRulesFile = getNameRulesFile()
+	processingConfig.Validation.MinConfidence = getMinConfidence()
+	processingConfig.Merge.DedupPDFCodes = getPDFCodeDedup()
+	processingConfig.PDFReplay.ReuseStoredResult = getPDFResultReuse()
+	processingConfig.Degradation.RuleOnlyOnLLMFailure = getRuleOnlyFallback()
+	processingConfig.Enrichment.Levels = getEnrichLevels()
+	applyLLMRetryConfig(&processingConfig.Services.LLM)
+	processingConfig.Health = getHealthGateConfig()
+	processingConfig.StepTimeouts = getStepTimeoutConfig()
 
 	return processingConfig
 }
 
+// getPromptTemplatesDir 获取自定义提示词模板目录，为空时使用内置模板
+func getPromptTemplatesDir() string {
+	return os.Getenv("PROMPT_TEMPLATES_DIR")
+}
+
+// getParentHierarchyDepth 获取第二轮语义选择提示词中包含的祖先层数
+// 默认只包含直接父级；更深的路径提供更多上下文，但会增加token消耗
+func getParentHierarchyDepth() int {
+	depth := defaultParentHierarchyDepth
+	if v := os.Getenv("SEMANTIC_PARENT_DEPTH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			depth = n
+		}
+	}
+	if depth > maxParentHierarchyDepth {
+		depth = maxParentHierarchyDepth
+	}
+	return depth
+}
+
+// getCleaningFailureTolerance 获取第一轮并发清洗允许失败的分组比例（0-1）
+// 失败分组未超过该比例时保留其余分组的结果，超过时回退到单次处理全部数据
+func getCleaningFailureTolerance() float64 {
+	tolerance := defaultCleaningFailureTolerance
+	if v := os.Getenv("LLM_CLEANING_FAILURE_TOLERANCE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+			tolerance = f
+		}
+	}
+	return tolerance
+}
+
+// getNameRulesFile 获取自定义名称校验规则文件，为空时使用内置规则
+func getNameRulesFile() string {
+	return os.Getenv("NAME_RULES_FILE")
+}
+
+// getPDFCodeDedup 获取融合前是否按编码去重清洗后的PDF数据，默认开启
+func getPDFCodeDedup() bool {
+	if v := os.Getenv("PDF_DEDUP_CODES"); v != "" {
+		if enabled, err := strconv.ParseBool(v); err == nil {
+			return enabled
+		}
+	}
+	return true
+}
+
+// getMinConfidence 获取应用LLM语义选择结果的最低置信度（0-1），0 表示不过滤
+func getMinConfidence() float64 {
+	if v := os.Getenv("LLM_MIN_CONFIDENCE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+			return f
+		}
+	}
+	return 0
+}
+
+// semanticTaskTypes 第二轮语义选择轮询使用的任务类型，只使用LLM服务已配置路由的类型
+var semanticTaskTypes = []string{
+	"semantic_analysis", // 主要用于语义分析
+	"data_cleaning",     // 复用数据清洗队列
+}
+
+// getSemanticConcurrency 获取第二轮语义选择同时进行的LLM调用数上限
+// 默认按提供商并发配额计算，LLM_SEMANTIC_CONCURRENCY 可覆盖
+func getSemanticConcurrency() int {
+	if v := os.Getenv("LLM_SEMANTIC_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return semanticConcurrencyFromQuota(getOptimizedConcurrencyConfig())
+}
+
+// semanticConcurrencyFromQuota 轮询使用的任务类型的并发配额之和，不超过全局并发上限，至少为1
+func semanticConcurrencyFromQuota(cfg ConcurrencyConfig) int {
+	total := 0
+	for _, taskType := range semanticTaskTypes {
+		total += cfg.TaskAllocations[taskType].MaxConcurrent
+	}
+	if limit := cfg.GlobalQuotas.MaxConcurrent; limit > 0 && total > limit {
+		total = limit
+	}
+	return max(total, 1)
+}
+
+// getLLMDeterministic 是否以确定性模式提交LLM任务（温度0+固定seed），用于提示词回归测试
+func getLLMDeterministic() bool {
+	return os.Getenv("LLM_DETERMINISTIC") == "true"
+}
+
+// getLLMFallbackConfig 获取LLM服务不可用时直连提供商的兜底配置，LLM_FALLBACK_ENABLED=true 时启用
+// API Key 未单独配置时复用 llm-service 的 KIMI_API_KEY
+func getLLMFallbackConfig() LLMFallbackConfig {
+	fallbackConfig := LLMFallbackConfig{
+		Enabled:  os.Getenv("LLM_FALLBACK_ENABLED") == "true",
+		Provider: os.Getenv("LLM_FALLBACK_PROVIDER"),
+		BaseURL:  os.Getenv("LLM_FALLBACK_BASE_URL"),
+		APIKey:   os.Getenv("LLM_FALLBACK_API_KEY"),
+		Model:    os.Getenv("LLM_FALLBACK_MODEL"),
+	}
+	if fallbackConfig.APIKey == "" {
+		fallbackConfig.APIKey = os.Getenv("KIMI_API_KEY")
+	}
+	if v := os.Getenv("LLM_FALLBACK_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			fallbackConfig.Timeout = d
+		}
+	}
+	return fallbackConfig
+}
+
+// applyLLMRetryConfig 设置LLM调用的重试次数和退避参数，支持环境变量覆盖
+func applyLLMRetryConfig(llmConfig *LLMServiceConfig) {
+	defaults := defaultLLMRetryConfig()
+	if llmConfig.MaxRetries <= 0 {
+		llmConfig.MaxRetries = defaults.MaxRetries
+	}
+	if llmConfig.BaseBackoff <= 0 {
+		llmConfig.BaseBackoff = defaults.BaseBackoff
+	}
+	if llmConfig.MaxBackoff <= 0 {
+		llmConfig.MaxBackoff = defaults.MaxBackoff
+	}
+	if llmConfig.BackoffJitter <= 0 {
+		llmConfig.BackoffJitter = defaults.BackoffJitter
+	}
+
+	if v := os.Getenv("LLM_MAX_RETRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			llmConfig.MaxRetries = n
+		}
+	}
+	if v := os.Getenv("LLM_RETRY_BASE_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			llmConfig.BaseBackoff = d
+		}
+	}
+	if v := os.Getenv("LLM_RETRY_MAX_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			llmConfig.MaxBackoff = d
+		}
+	}
+	if v := os.Getenv("LLM_RETRY_JITTER"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+			llmConfig.BackoffJitter = f
+		}
+	}
+}
+
+// getLLMRetryConfig 获取LLM调用的重试配置（默认值+环境变量覆盖）
+func getLLMRetryConfig() LLMServiceConfig {
+	var llmConfig LLMServiceConfig
+	applyLLMRetryConfig(&llmConfig)
+	return llmConfig
+}
+
+// getHealthGateConfig 获取下游健康门控配置，支持环境变量覆盖
+func getHealthGateConfig() HealthGateConfig {
+	healthConfig := defaultHealthGateConfig()
+
+	if v := os.Getenv("DOWNSTREAM_HEALTH_MODE"); v != "" {
+		healthConfig.Mode = DownstreamHealthMode(v)
+	}
+	if v := os.Getenv("DOWNSTREAM_HEALTH_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			healthConfig.CheckTimeout = d
+		}
+	}
+	if v := os.Getenv("DOWNSTREAM_HEALTH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			healthConfig.CheckInterval = d
+		}
+	}
+	if v := os.Getenv("DOWNSTREAM_HEALTH_MAX_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			healthConfig.MaxBackoff = d
+		}
+	}
+
+	return healthConfig
+}
+
+// getStepTimeoutConfig 获取增量处理各步骤的超时时间，支持环境变量覆盖，设置为 0 表示不限制
+func getStepTimeoutConfig() StepTimeoutConfig {
+	stepTimeouts := defaultStepTimeoutConfig()
+	overrides := map[string]*time.Duration{
+		"STEP_TIMEOUT_EXCEL_SAVE":   &stepTimeouts.ExcelSave,
+		"STEP_TIMEOUT_PDF_CLEANING": &stepTimeouts.PDFCleaning,
+		"STEP_TIMEOUT_MERGE":        &stepTimeouts.Merge,
+		"STEP_TIMEOUT_LLM_ENHANCE":  &stepTimeouts.LLMEnhance,
+		"STEP_TIMEOUT_FINAL_UPDATE": &stepTimeouts.FinalUpdate,
+	}
+	for name, target := range overrides {
+		if v := os.Getenv(name); v != "" {
+			if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+				*target = d
+			}
+		}
+	}
+	return stepTimeouts
+}
+
+// getHTTPClientConfig 获取HTTP客户端配置，支持环境变量覆盖
+func getHTTPClientConfig() httpx.Config {
+	httpConfig := httpx.DefaultConfig()
+
+	if v := os.Getenv("HTTP_CLIENT_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			httpConfig.Timeout = d
+		}
+	}
+	if v := os.Getenv("HTTP_CLIENT_MAX_IDLE_CONNS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			httpConfig.MaxIdleConns = n
+		}
+	}
+	if v := os.Getenv("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			httpConfig.MaxIdleConnsPerHost = n
+		}
+	}
+	if v := os.Getenv("HTTP_CLIENT_IDLE_CONN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			httpConfig.IdleConnTimeout = d
+		}
+	}
+	if v := os.Getenv("HTTP_CLIENT_MAX_RETRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			httpConfig.MaxRetries = n
+		}
+	}
+	if v := os.Getenv("HTTP_CLIENT_RETRY_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			httpConfig.RetryBackoff = d
+		}
+	}
+
+	return httpConfig
+}
+
+// newServiceHTTPClient 按HTTP客户端配置创建服务客户端使用的HTTP客户端，timeout为0时使用配置中的超时
+func newServiceHTTPClient(httpConfig httpx.Config, timeout time.Duration) *http.Client {
+	if timeout > 0 {
+		httpConfig.Timeout = timeout
+	}
+	return httpx.NewClient(httpConfig)
+}
+
 // getConfigServiceURL 获取服务URL - 配置专用版本
 func getConfigServiceURL(serviceName, defaultPort string) string {
 	switch serviceName {
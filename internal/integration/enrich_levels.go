@@ -0,0 +1,73 @@
+package integration
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/freedkr/moonshot/internal/database"
+)
+
+// DefaultEnrichLevels 默认只对细类执行第二轮LLM增强，大类、中类、小类名称直接取自标准，无需增强
+var DefaultEnrichLevels = []string{"细类"}
+
+// allEnrichLevels LLM_ENRICH_LEVELS 取该值时所有层级都参与增强
+const allEnrichLevels = "*"
+
+// SetEnrichLevels 设置参与第二轮LLM增强的层级，为空时所有层级都参与
+func (p *IncrementalProcessor) SetEnrichLevels(levels []string) {
+	p.enrichLevels = levels
+}
+
+// getEnrichLevels 读取 LLM_ENRICH_LEVELS（逗号分隔，如 "小类,细类"），未配置时使用 DefaultEnrichLevels，
+// 配置为 "*" 时不按层级过滤
+func getEnrichLevels() []string {
+	v := strings.TrimSpace(os.Getenv("LLM_ENRICH_LEVELS"))
+	if v == "" {
+		return DefaultEnrichLevels
+	}
+	if v == allEnrichLevels {
+		return nil
+	}
+	var levels []string
+	for _, level := range strings.Split(v, ",") {
+		if level = strings.TrimSpace(level); level != "" {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// filterEnrichLevels 按配置的层级拆分增强候选，返回参与增强和跳过的分类；未配置层级时全部参与
+func (p *IncrementalProcessor) filterEnrichLevels(categories []database.Category) (selected, skipped []database.Category) {
+	if len(p.enrichLevels) == 0 {
+		return categories, nil
+	}
+	levels := make(map[string]bool, len(p.enrichLevels))
+	for _, level := range p.enrichLevels {
+		levels[level] = true
+	}
+	for _, cat := range categories {
+		if levels[cat.Level] {
+			selected = append(selected, cat)
+		} else {
+			skipped = append(skipped, cat)
+		}
+	}
+	return selected, skipped
+}
+
+// completeSkippedLevels 将不参与增强的分类直接标记为完成，名称保持规则解析结果
+func (p *IncrementalProcessor) completeSkippedLevels(ctx context.Context, taskID string, skipped []database.Category) error {
+	if len(skipped) == 0 {
+		return nil
+	}
+	updates := make([]database.CategoryUpdate, 0, len(skipped))
+	for _, cat := range skipped {
+		updates = append(updates, database.CategoryUpdate{
+			Code:    cat.Code,
+			Updates: map[string]interface{}{"status": database.StatusCompleted},
+		})
+	}
+	return p.batchUpdateCategoriesByCode(ctx, taskID, updates)
+}
@@ -0,0 +1,80 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// TestGetEnrichLevels 测试增强层级配置的解析
+func TestGetEnrichLevels(t *testing.T) {
+	t.Setenv("LLM_ENRICH_LEVELS", "")
+	assert.Equal(t, DefaultEnrichLevels, getEnrichLevels())
+
+	t.Setenv("LLM_ENRICH_LEVELS", " 小类, 细类 ,")
+	assert.Equal(t, []string{"小类", "细类"}, getEnrichLevels())
+
+	t.Setenv("LLM_ENRICH_LEVELS", "*")
+	assert.Empty(t, getEnrichLevels())
+}
+
+// TestIncrementalProcessor_EnrichLevelsFallback 测试PDF未匹配的降级路径中只有细类提交LLM增强，其余层级直接完成
+func TestIncrementalProcessor_EnrichLevelsFallback(t *testing.T) {
+	llmService := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		if code := promptField(req.Prompt, "编码:"); code != "" {
+			return LLMTaskStatus{Status: "completed", Result: map[string]interface{}{
+				"code": code, "name": promptField(req.Prompt, "选项1:"), "confidence": 0.9,
+			}}
+		}
+		return LLMTaskStatus{Status: "completed", Result: `[{"code":"9-99-99-99","name":"无关职业"}]`}
+	})
+	t.Setenv("LLM_SERVICE_URL", llmService.Host())
+	t.Setenv("PDF_VALIDATOR_URL", "127.0.0.1:1")
+	t.Setenv("LLM_ENRICH_LEVELS", "")
+
+	ctx := context.Background()
+	db := newTestCategoryDB(t)
+	taskID := "9b1d3f5b-7c9e-4b1d-8f3a-5c7e9a1b3d5f"
+	require.NoError(t, db.CreateTask(ctx, &database.TaskRecord{
+		ID: taskID, Type: "rule", Status: "completed", Config: datatypes.JSON(`{}`),
+	}))
+	require.NoError(t, db.SavePDFExtraction(ctx, &database.PDFExtraction{
+		TaskID: taskID, TotalFound: 1,
+		OccupationCodes: datatypes.JSON(`[{"code":"9-99-99-99","name":"无关职业"}]`),
+	}))
+
+	categories := []*model.Category{
+		{Code: "1", Name: "党的机关人员", Level: "大类"},
+		{Code: "1-01", Name: "中国共产党机关负责人", Level: "中类"},
+		{Code: "1-01-01-01", Name: "焊工", Level: "细类"},
+		{Code: "1-01-01-02", Name: "钳工", Level: "细类"},
+	}
+	processor := NewIncrementalProcessor(&config.Config{}, db)
+	require.NoError(t, processor.ProcessIncrementalFlow(ctx, taskID, "input.xlsx", categories))
+
+	var semanticCodes []string
+	for _, req := range llmService.Requests() {
+		if code := promptField(req.Prompt, "编码:"); code != "" {
+			semanticCodes = append(semanticCodes, code)
+		}
+	}
+	assert.ElementsMatch(t, []string{"1-01-01-01", "1-01-01-02"}, semanticCodes, "只有细类提交语义选择")
+
+	current, err := db.GetCurrentCategoriesByTaskID(ctx, taskID)
+	require.NoError(t, err)
+	require.Len(t, current, 4)
+	for _, cat := range current {
+		assert.Equal(t, database.StatusCompleted, cat.Status, cat.Code)
+		if cat.Level == "细类" {
+			assert.NotEmpty(t, cat.LLMEnhancements, cat.Code)
+		} else {
+			assert.Empty(t, cat.LLMEnhancements, "%s 不参与增强", cat.Code)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/google/uuid"
+)
+
+// ErrFlowInProgress 同一任务已有增量流程或补充增强正在执行
+var ErrFlowInProgress = errors.New("任务正在处理中")
+
+// defaultTaskLockTTL 未设置步骤超时时处理锁的过期时间，防止进程崩溃后锁一直不释放
+const defaultTaskLockTTL = 2 * time.Hour
+
+// EnrichMissingResult 补充增强的统计结果
+type EnrichMissingResult struct {
+	Selected int `json:"selected"` // 缺少LLM增强信息的分类数
+	Enriched int `json:"enriched"` // 成功写入增强结果的分类数
+	Failed   int `json:"failed"`   // 拆分重试后仍未得到结果的分类数
+}
+
+// SetTaskLocker 设置任务处理锁，未设置时不做并发保护
+func (p *IncrementalProcessor) SetTaskLocker(locker TaskLocker) {
+	p.taskLocker = locker
+}
+
+// taskLockTTL 处理锁的过期时间，取各步骤超时之和；存在不限时的步骤时使用默认值
+func (p *IncrementalProcessor) taskLockTTL() time.Duration {
+	steps := []time.Duration{
+		p.stepTimeouts.ExcelSave,
+		p.stepTimeouts.PDFCleaning,
+		p.stepTimeouts.Merge,
+		p.stepTimeouts.LLMEnhance,
+		p.stepTimeouts.FinalUpdate,
+	}
+	var total time.Duration
+	for _, timeout := range steps {
+		if timeout <= 0 {
+			return defaultTaskLockTTL
+		}
+		total += timeout
+	}
+	return total + time.Minute
+}
+
+// acquireTaskLock 获取任务处理锁，返回释放函数；锁已被占用时返回 ErrFlowInProgress
+// 获取锁本身失败时继续处理，避免Redis短暂不可用导致任务中断
+func (p *IncrementalProcessor) acquireTaskLock(ctx context.Context, taskID string) (func(), error) {
+	if p.taskLocker == nil {
+		return func() {}, nil
+	}
+	owner := uuid.New().String()
+	acquired, err := p.taskLocker.AcquireTaskLock(ctx, taskID, owner, p.taskLockTTL())
+	if err != nil {
+		fmt.Printf("⚠️ WARNING: 获取任务处理锁失败 - taskID: %s, 错误: %v\n", taskID, err)
+		return func() {}, nil
+	}
+	if !acquired {
+		return nil, ErrFlowInProgress
+	}
+	return func() {
+		// 使用独立的context，流程被取消或超时后仍能释放锁
+		if err := p.taskLocker.ReleaseTaskLock(context.Background(), taskID, owner); err != nil {
+			fmt.Printf("⚠️ WARNING: 释放任务处理锁失败 - taskID: %s, 错误: %v\n", taskID, err)
+		}
+	}, nil
+}
+
+// EnrichMissing 只对当前版本中缺少LLM增强信息的分类重新执行步骤4的语义选择，只包含配置的增强层级
+// 未与PDF合并的分类先推进到 pdf_merged，数据来源仍为Excel；完成后按名称规则校验
+// 与增量流程共用任务处理锁，流程进行中时返回 ErrFlowInProgress
+func (p *IncrementalProcessor) EnrichMissing(ctx context.Context, taskID string) (*EnrichMissingResult, error) {
+	release, err := p.acquireTaskLock(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx = withLLMCorrelation(ctx, taskID, llmStepEnrichMissing)
+	startTime := time.Now()
+	defer func() {
+		p.metrics.RecordProcessingDuration("llm_enrich_missing", time.Since(startTime))
+	}()
+
+	fmt.Printf("\n🚀 [补充增强-开始] taskID=%s\n", taskID)
+
+	var missing []database.Category
+	if err := p.db.WithContext(ctx).
+		Where("task_id = ? AND is_current = true AND (llm_enhancements IS NULL OR llm_enhancements = '')", taskID).
+		Order("code").Find(&missing).Error; err != nil {
+		p.metrics.RecordError("llm_enrich_missing", err)
+		return nil, fmt.Errorf("查询缺少增强信息的分类失败: %w", err)
+	}
+	// 不参与增强的层级缺少增强信息是正常的，不补充
+	missing, _ = p.filterEnrichLevels(missing)
+	result := &EnrichMissingResult{Selected: len(missing)}
+	fmt.Printf("🔍 [补充增强-查询] 缺少LLM增强信息的分类 %d 条\n", len(missing))
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	// 状态只能经 pdf_merged 流转到 completed
+	var unmerged []string
+	for i := range missing {
+		if missing[i].Status == database.StatusExcelParsed {
+			unmerged = append(unmerged, missing[i].Code)
+			missing[i].Status = database.StatusPDFMerged
+		}
+	}
+	if len(unmerged) > 0 {
+		if err := p.db.WithContext(ctx).Model(&database.Category{}).
+			Where("task_id = ? AND is_current = true AND status = ? AND code IN ?", taskID, database.StatusExcelParsed, unmerged).
+			Update("status", database.StatusPDFMerged).Error; err != nil {
+			return nil, fmt.Errorf("更新未合并分类状态失败: %w", err)
+		}
+	}
+
+	var allCategories []database.Category
+	if p.parentDepth > 0 {
+		if err := p.db.WithContext(ctx).Select("code, name, parent_code").
+			Where("task_id = ? AND is_current = true", taskID).Find(&allCategories).Error; err != nil {
+			fmt.Printf("⚠️ [补充增强-层级] 查询分类层级失败: %v，不包含父级信息\n", err)
+		}
+	}
+
+	choices := p.prepareEnrichedData(missing, allCategories)
+	_, enriched, err := p.enhanceInBatches(ctx, taskID, "补充增强", choices)
+	result.Enriched = enriched
+	result.Failed = result.Selected - enriched
+	if err != nil {
+		return result, err
+	}
+
+	if err := p.validateFinalNames(ctx, taskID); err != nil {
+		fmt.Printf("❌ [补充增强-名称校验失败] 错误: %v\n", err)
+		p.metrics.RecordError("name_validation", err)
+	}
+	if err := p.applyManualOverrides(ctx, taskID, "补充增强"); err != nil {
+		fmt.Printf("❌ [补充增强-人工修正失败] 错误: %v\n", err)
+	}
+
+	p.metrics.RecordSuccess("llm_enrich_missing")
+	fmt.Printf("✅ [补充增强-完成] taskID=%s, 选中 %d 条, 成功 %d 条\n", taskID, result.Selected, result.Enriched)
+	return result, nil
+}
@@ -0,0 +1,108 @@
+package integration
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTaskLocker 内存中的任务处理锁
+type fakeTaskLocker struct {
+	mu     sync.Mutex
+	owners map[string]string
+	ttls   []time.Duration
+}
+
+func (f *fakeTaskLocker) AcquireTaskLock(ctx context.Context, taskID string, owner string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ttls = append(f.ttls, ttl)
+	if _, held := f.owners[taskID]; held {
+		return false, nil
+	}
+	f.owners[taskID] = owner
+	return true, nil
+}
+
+func (f *fakeTaskLocker) ReleaseTaskLock(ctx context.Context, taskID string, owner string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.owners[taskID] == owner {
+		delete(f.owners, taskID)
+	}
+	return nil
+}
+
+// TestIncrementalProcessor_EnrichMissing 测试只对缺少LLM增强信息的分类重新执行语义选择
+func TestIncrementalProcessor_EnrichMissing(t *testing.T) {
+	llmService := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		code := promptField(req.Prompt, "编码:")
+		return LLMTaskStatus{Status: "completed", Result: map[string]interface{}{"code": code, "name": promptField(req.Prompt, "选项1:")}}
+	})
+	t.Setenv("LLM_SERVICE_URL", llmService.Host())
+
+	db := newTestCategoryDB(t)
+	processor := NewIncrementalProcessor(&config.Config{}, db)
+	locker := &fakeTaskLocker{owners: make(map[string]string)}
+	processor.SetTaskLocker(locker)
+	ctx := context.Background()
+	taskID := "8c2d4e6f-1a3b-4c5d-9e7f-2b4d6f8a0c1e"
+
+	require.NoError(t, db.BatchInsertCategoriesWithVersion(ctx, taskID, "4b6d8f0a-2c4e-4a6b-8d0f-3c5e7a9b1d2f", []*database.Category{
+		{TaskID: taskID, Code: "1-01-01-01", Name: "焊工", Level: "细类", Status: database.StatusCompleted, DataSource: database.DataSourceMerged, LLMEnhancements: `{"code":"1-01-01-01","name":"焊工"}`},
+		{TaskID: taskID, Code: "1-01-01-02", Name: "钳工", Level: "细类", Status: database.StatusPDFMerged, DataSource: database.DataSourceMerged},
+		{TaskID: taskID, Code: "3-01-01-01", Name: "邮政营业员", Level: "细类", Status: database.StatusExcelParsed, DataSource: database.DataSourceExcel},
+	}))
+
+	result, err := processor.EnrichMissing(ctx, taskID)
+	require.NoError(t, err)
+	assert.Equal(t, &EnrichMissingResult{Selected: 2, Enriched: 2, Failed: 0}, result)
+
+	var submitted []string
+	for _, req := range llmService.Requests() {
+		submitted = append(submitted, promptField(req.Prompt, "编码:"))
+		assert.Equal(t, map[string]interface{}{"parent_task_id": taskID, "step": llmStepEnrichMissing}, req.Metadata, "LLM任务应携带上游任务ID和步骤")
+	}
+	assert.ElementsMatch(t, []string{"1-01-01-02", "3-01-01-01"}, submitted, "已增强的分类不再提交LLM")
+
+	var rows []database.Category
+	require.NoError(t, db.GetDB().Where("task_id = ? AND is_current = true", taskID).Order("code").Find(&rows).Error)
+	require.Len(t, rows, 3)
+	for _, row := range rows {
+		assert.Equal(t, database.StatusCompleted, row.Status, row.Code)
+		assert.NotEmpty(t, row.LLMEnhancements, row.Code)
+	}
+	assert.Equal(t, database.DataSourceExcel, rows[2].DataSource, "未与PDF合并的分类数据来源不变")
+
+	// 再次执行时没有需要补充的分类
+	result, err = processor.EnrichMissing(ctx, taskID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Selected)
+	assert.Empty(t, locker.owners, "执行结束后应释放锁")
+}
+
+// TestIncrementalProcessor_TaskLock 测试增量流程和补充增强共用任务处理锁
+func TestIncrementalProcessor_TaskLock(t *testing.T) {
+	processor := NewIncrementalProcessor(&config.Config{}, nil)
+	locker := &fakeTaskLocker{owners: map[string]string{"task-1": "other-flow"}}
+	processor.SetTaskLocker(locker)
+	ctx := context.Background()
+
+	_, err := processor.EnrichMissing(ctx, "task-1")
+	assert.ErrorIs(t, err, ErrFlowInProgress)
+	assert.ErrorIs(t, processor.ProcessIncrementalFlow(ctx, "task-1", "input.xlsx", nil), ErrFlowInProgress)
+	assert.Equal(t, "other-flow", locker.owners["task-1"], "不应释放其他流程持有的锁")
+
+	// 锁的过期时间覆盖全部步骤超时，存在不限时的步骤时使用默认值
+	defaults := defaultStepTimeoutConfig()
+	expected := defaults.ExcelSave + defaults.PDFCleaning + defaults.Merge + defaults.LLMEnhance + defaults.FinalUpdate + time.Minute
+	assert.Equal(t, expected, locker.ttls[0])
+	processor.SetStepTimeouts(StepTimeoutConfig{LLMEnhance: time.Hour})
+	assert.Equal(t, defaultTaskLockTTL, processor.taskLockTTL())
+}
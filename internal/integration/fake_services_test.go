@@ -0,0 +1,199 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLLMResponder 根据提交的任务生成任务状态，返回的状态会原样作为 GET /api/v1/tasks/:id 的响应
+type fakeLLMResponder func(req LLMTaskRequest) LLMTaskStatus
+
+// fakeLLMService 模拟LLM服务的 POST /api/v1/tasks 和 GET /api/v1/tasks/:id
+// 任务提交后第一次查询即返回 responder 的结果
+type fakeLLMService struct {
+	*httptest.Server
+
+	respond fakeLLMResponder
+	nextID  int64
+
+	mu       sync.Mutex
+	requests map[string]LLMTaskRequest
+}
+
+// newFakeLLMServer 创建模拟LLM服务，测试结束时自动关闭
+func newFakeLLMServer(t *testing.T, respond fakeLLMResponder) *fakeLLMService {
+	t.Helper()
+	f := &fakeLLMService{
+		respond:  respond,
+		requests: make(map[string]LLMTaskRequest),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// newFakeLLMService 模拟LLM服务：提交即完成，结果中回显提示词里的编码
+func newFakeLLMService(t *testing.T) *fakeLLMService {
+	return newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		code := promptField(req.Prompt, "编码:")
+		return LLMTaskStatus{Status: "completed", Result: fmt.Sprintf(`{"code":"%s","name":"名称%s"}`, code, code)}
+	})
+}
+
+func (f *fakeLLMService) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/tasks":
+		var req LLMTaskRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		taskID := fmt.Sprintf("task-%d", atomic.AddInt64(&f.nextID, 1))
+		f.mu.Lock()
+		f.requests[taskID] = req
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(LLMTaskResponse{TaskID: taskID, Status: "pending"})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v1/tasks/"):
+		taskID := strings.TrimPrefix(r.URL.Path, "/api/v1/tasks/")
+		f.mu.Lock()
+		req, ok := f.requests[taskID]
+		f.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		status := f.respond(req)
+		status.TaskID = taskID
+		json.NewEncoder(w).Encode(status)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Host 返回不带协议的地址，与 llmServiceURL 的格式一致
+func (f *fakeLLMService) Host() string {
+	return strings.TrimPrefix(f.URL, "http://")
+}
+
+// Requests 返回已提交的任务，按提交顺序排列
+func (f *fakeLLMService) Requests() []LLMTaskRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	requests := make([]LLMTaskRequest, 0, len(f.requests))
+	for i := int64(1); i <= atomic.LoadInt64(&f.nextID); i++ {
+		if req, ok := f.requests[fmt.Sprintf("task-%d", i)]; ok {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// promptField 从提示词中读取以 prefix 开头的行的值，如 "编码:"
+func promptField(prompt, prefix string) string {
+	for _, line := range strings.Split(prompt, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, prefix))
+		}
+	}
+	return ""
+}
+
+// fakePDFValidator 模拟PDF验证服务的 upload-and-validate、status 和 occupation-codes 接口
+type fakePDFValidator struct {
+	*httptest.Server
+
+	// OccupationCodes occupation-codes 接口返回的条目
+	OccupationCodes []map[string]interface{}
+	// PendingPolls status 接口返回 processing 的次数，之后返回 completed
+	PendingPolls int32
+
+	uploads     int32
+	statusPolls int32
+
+	mu           sync.Mutex
+	uploadedFile string
+}
+
+// newFakePDFValidator 创建模拟PDF验证服务，测试结束时自动关闭
+func newFakePDFValidator(t *testing.T, codes []map[string]interface{}) *fakePDFValidator {
+	t.Helper()
+	f := &fakePDFValidator{OccupationCodes: codes}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+const fakePDFTaskID = "pdf-task-1"
+
+func (f *fakePDFValidator) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/upload-and-validate":
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		file.Close()
+		if r.FormValue("validation_type") == "" {
+			http.Error(w, "missing validation_type", http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(&f.uploads, 1)
+		f.mu.Lock()
+		f.uploadedFile = header.Filename
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"task_id": fakePDFTaskID, "status": "processing"})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/status/"+fakePDFTaskID:
+		status := "completed"
+		if atomic.AddInt32(&f.statusPolls, 1) <= atomic.LoadInt32(&f.PendingPolls) {
+			status = "processing"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"task_id": fakePDFTaskID, "status": status})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/blocks/"+fakePDFTaskID+"/occupation-codes":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"task_id":          fakePDFTaskID,
+			"occupation_codes": f.OccupationCodes,
+			"total":            len(f.OccupationCodes),
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Host 返回不带协议的地址，与 pdfServiceURL 的格式一致
+func (f *fakePDFValidator) Host() string {
+	return strings.TrimPrefix(f.URL, "http://")
+}
+
+// Uploads 返回上传次数
+func (f *fakePDFValidator) Uploads() int32 {
+	return atomic.LoadInt32(&f.uploads)
+}
+
+// UploadedFile 返回最近一次上传的文件名
+func (f *fakePDFValidator) UploadedFile() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.uploadedFile
+}
+
+// newTestCategoryDB 创建内存SQLite数据库并建好表结构，测试结束时自动关闭
+func newTestCategoryDB(t *testing.T) *database.SQLiteDB {
+	t.Helper()
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.CreateTables(context.Background()))
+	return db
+}
@@ -0,0 +1,219 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DownstreamHealthMode 下游服务不可用时的任务处理方式
+type DownstreamHealthMode string
+
+const (
+	// DownstreamModeHold 任务依赖的下游不可用时放回队列，等待恢复后再处理
+	DownstreamModeHold DownstreamHealthMode = "hold"
+	// DownstreamModeFailFast 任务依赖的下游不可用时立即将任务标记为失败
+	DownstreamModeFailFast DownstreamHealthMode = "fail_fast"
+)
+
+// ErrDownstreamUnavailable 下游服务（PDF/LLM）深度健康检查未通过
+var ErrDownstreamUnavailable = errors.New("下游服务不可用")
+
+// HealthGateConfig 下游健康门控配置
+type HealthGateConfig struct {
+	Mode          DownstreamHealthMode `yaml:"mode"`           // fail_fast（默认）或 hold
+	CheckTimeout  time.Duration        `yaml:"check_timeout"`  // 单次健康检查超时
+	CheckInterval time.Duration        `yaml:"check_interval"` // 健康时缓存检查结果的时长
+	MaxBackoff    time.Duration        `yaml:"max_backoff"`    // 熔断打开后的最长等待，从 check_interval 开始逐次翻倍
+}
+
+// defaultHealthGateConfig 返回默认下游健康门控配置
+func defaultHealthGateConfig() HealthGateConfig {
+	return HealthGateConfig{
+		Mode:          DownstreamModeFailFast,
+		CheckTimeout:  5 * time.Second,
+		CheckInterval: 10 * time.Second,
+		MaxBackoff:    2 * time.Minute,
+	}
+}
+
+// circuitState 熔断器状态
+type circuitState int
+
+const (
+	circuitClosed   circuitState = iota // 下游健康，按 check_interval 周期复查
+	circuitOpen                         // 下游不可用，退避期内不再探测
+	circuitHalfOpen                     // 退避结束，下一次检查决定恢复或继续熔断
+)
+
+// 下游服务名称，用于按任务需要选择检查的服务
+const (
+	DownstreamPDF = "pdf-validator"
+	DownstreamLLM = "llm-service"
+)
+
+// downstreamCheck 单个下游服务的深度健康检查端点
+type downstreamCheck struct {
+	name string
+	url  string
+}
+
+// serviceCircuit 单个下游服务的熔断状态，各服务独立熔断，一个服务不可用不影响只依赖其他服务的任务
+type serviceCircuit struct {
+	check     downstreamCheck
+	state     circuitState
+	checkedAt time.Time
+	openUntil time.Time
+	backoff   time.Duration
+	lastErr   error
+}
+
+// HealthGate 处理任务前的下游健康门控，以熔断器方式分别缓存PDF和LLM服务的深度健康状态
+type HealthGate struct {
+	mu       sync.Mutex
+	config   HealthGateConfig
+	circuits []*serviceCircuit
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewHealthGate 根据处理配置创建下游健康门控
+// PDF服务使用 /health/ready，LLM服务使用 /ready，两者都会检查各自的依赖
+func NewHealthGate(processingConfig *ProcessingConfig) *HealthGate {
+	cfg := processingConfig.Health
+	defaults := defaultHealthGateConfig()
+	if cfg.Mode != DownstreamModeHold {
+		cfg.Mode = DownstreamModeFailFast
+	}
+	if cfg.CheckTimeout <= 0 {
+		cfg.CheckTimeout = defaults.CheckTimeout
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaults.CheckInterval
+	}
+	if cfg.MaxBackoff < cfg.CheckInterval {
+		cfg.MaxBackoff = cfg.CheckInterval
+	}
+
+	checks := []downstreamCheck{
+		{name: DownstreamPDF, url: fmt.Sprintf("http://%s/health/ready", processingConfig.Services.PDF.BaseURL)},
+		{name: DownstreamLLM, url: fmt.Sprintf("http://%s/ready", processingConfig.Services.LLM.BaseURL)},
+	}
+	circuits := make([]*serviceCircuit, 0, len(checks))
+	for _, check := range checks {
+		circuits = append(circuits, &serviceCircuit{check: check, state: circuitClosed})
+	}
+
+	return &HealthGate{
+		config:   cfg,
+		circuits: circuits,
+		// 健康检查只需要一次快速判断，不使用带重试的共享客户端
+		client: &http.Client{Timeout: cfg.CheckTimeout},
+		now:    time.Now,
+	}
+}
+
+// Mode 返回下游不可用时的处理方式
+func (g *HealthGate) Mode() DownstreamHealthMode {
+	return g.config.Mode
+}
+
+// Check 检查全部下游服务，等同于 CheckServices(ctx, DownstreamPDF, DownstreamLLM)
+func (g *HealthGate) Check(ctx context.Context) error {
+	return g.CheckServices(ctx, DownstreamPDF, DownstreamLLM)
+}
+
+// CheckServices 只检查任务需要的下游服务，不可用时返回包装了 ErrDownstreamUnavailable 的错误，未传入服务时总是可用
+// 各服务的熔断打开期间直接返回该服务上次的错误，不发起探测
+func (g *HealthGate) CheckServices(ctx context.Context, services ...string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var failures []string
+	for _, circuit := range g.circuits {
+		if !containsService(services, circuit.check.name) {
+			continue
+		}
+		if err := g.checkCircuit(ctx, circuit); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", circuit.check.name, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%w: %s", ErrDownstreamUnavailable, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// checkCircuit 按熔断状态检查单个下游服务
+func (g *HealthGate) checkCircuit(ctx context.Context, c *serviceCircuit) error {
+	now := g.now()
+	switch c.state {
+	case circuitClosed:
+		if !c.checkedAt.IsZero() && now.Sub(c.checkedAt) < g.config.CheckInterval {
+			return nil
+		}
+	case circuitOpen:
+		if now.Before(c.openUntil) {
+			return c.lastErr
+		}
+		c.state = circuitHalfOpen
+	}
+
+	err := g.probeOne(ctx, c.check)
+	c.checkedAt = now
+	if err == nil {
+		if c.state != circuitClosed {
+			fmt.Printf("下游服务 %s 已恢复，继续处理任务\n", c.check.name)
+		}
+		c.state = circuitClosed
+		c.backoff = 0
+		c.lastErr = nil
+		return nil
+	}
+
+	if c.backoff == 0 {
+		c.backoff = g.config.CheckInterval
+	} else if c.state == circuitHalfOpen {
+		c.backoff *= 2
+		if c.backoff > g.config.MaxBackoff {
+			c.backoff = g.config.MaxBackoff
+		}
+	}
+	c.state = circuitOpen
+	c.openUntil = now.Add(c.backoff)
+	c.lastErr = err
+	fmt.Printf("下游服务 %s 健康检查未通过，%v 后重试: %v\n", c.check.name, c.backoff, err)
+	return err
+}
+
+func containsService(services []string, name string) bool {
+	for _, service := range services {
+		if service == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *HealthGate) probeOne(ctx context.Context, check downstreamCheck) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("健康检查返回 %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestHealthGate 创建指向同一个测试服务器的健康门控，时钟由调用方控制
+func newTestHealthGate(t *testing.T, healthy *atomic.Bool, probes *atomic.Int32) (*HealthGate, *time.Time) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		if healthy.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	processingConfig := &ProcessingConfig{}
+	processingConfig.Services.PDF.BaseURL = host
+	processingConfig.Services.LLM.BaseURL = host
+	processingConfig.Health = HealthGateConfig{
+		Mode:          DownstreamModeHold,
+		CheckInterval: 10 * time.Second,
+		MaxBackoff:    30 * time.Second,
+	}
+
+	gate := NewHealthGate(processingConfig)
+	now := time.Unix(0, 0)
+	gate.now = func() time.Time { return now }
+	return gate, &now
+}
+
+// TestHealthGateCircuit 测试下游不可用时熔断、退避翻倍并在恢复后关闭
+func TestHealthGateCircuit(t *testing.T) {
+	var healthy atomic.Bool
+	var probes atomic.Int32
+	healthy.Store(true)
+	gate, now := newTestHealthGate(t, &healthy, &probes)
+	ctx := context.Background()
+
+	assert.Equal(t, DownstreamModeHold, gate.Mode())
+
+	// 健康时在 check_interval 内复用结果
+	require.NoError(t, gate.Check(ctx))
+	require.NoError(t, gate.Check(ctx))
+	assert.Equal(t, int32(2), probes.Load(), "两个下游各探测一次")
+
+	// 缓存过期后发现下游不可用，熔断打开
+	healthy.Store(false)
+	*now = now.Add(11 * time.Second)
+	err := gate.Check(ctx)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrDownstreamUnavailable))
+	probes.Store(0)
+
+	// 退避期内不再探测
+	*now = now.Add(5 * time.Second)
+	assert.ErrorIs(t, gate.Check(ctx), ErrDownstreamUnavailable)
+	assert.Equal(t, int32(0), probes.Load())
+
+	// 半开探测仍失败，退避翻倍到20秒
+	*now = now.Add(6 * time.Second)
+	assert.ErrorIs(t, gate.Check(ctx), ErrDownstreamUnavailable)
+	assert.Equal(t, int32(2), probes.Load())
+	*now = now.Add(15 * time.Second)
+	assert.ErrorIs(t, gate.Check(ctx), ErrDownstreamUnavailable)
+	assert.Equal(t, int32(2), probes.Load())
+
+	// 下游恢复后半开探测成功，熔断关闭
+	healthy.Store(true)
+	*now = now.Add(6 * time.Second)
+	require.NoError(t, gate.Check(ctx))
+	for _, circuit := range gate.circuits {
+		assert.Equal(t, circuitClosed, circuit.state)
+		assert.Equal(t, time.Duration(0), circuit.backoff)
+	}
+}
+
+// TestHealthGateCheckServices 测试各下游独立熔断，只检查任务需要的服务
+func TestHealthGateCheckServices(t *testing.T) {
+	newServer := func(status int, probes *atomic.Int32) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			probes.Add(1)
+			w.WriteHeader(status)
+		}))
+		t.Cleanup(server.Close)
+		return strings.TrimPrefix(server.URL, "http://")
+	}
+	var pdfProbes, llmProbes atomic.Int32
+	processingConfig := &ProcessingConfig{}
+	processingConfig.Services.PDF.BaseURL = newServer(http.StatusServiceUnavailable, &pdfProbes)
+	processingConfig.Services.LLM.BaseURL = newServer(http.StatusOK, &llmProbes)
+	gate := NewHealthGate(processingConfig)
+	ctx := context.Background()
+
+	// PDF服务不可用不影响只需要LLM服务或不需要下游的任务
+	require.NoError(t, gate.CheckServices(ctx, DownstreamLLM))
+	require.NoError(t, gate.CheckServices(ctx))
+	assert.Equal(t, int32(0), pdfProbes.Load())
+
+	err := gate.CheckServices(ctx, FlowOptions{}.RequiredServices(false)...)
+	require.ErrorIs(t, err, ErrDownstreamUnavailable)
+	assert.Contains(t, err.Error(), DownstreamPDF)
+	assert.NotContains(t, err.Error(), DownstreamLLM)
+
+	assert.Equal(t, []string{DownstreamPDF, DownstreamLLM}, FlowOptions{}.RequiredServices(false))
+	assert.Equal(t, []string{DownstreamLLM}, FlowOptions{SkipPDF: true, Enrichment: EnrichmentLLM}.RequiredServices(false))
+	assert.Empty(t, FlowOptions{SkipPDF: true, Enrichment: EnrichmentRule}.RequiredServices(false))
+	// 开启规则降级时LLM不可用也能完成任务，不检查LLM服务
+	assert.Equal(t, []string{DownstreamPDF}, FlowOptions{}.RequiredServices(true))
+	assert.Empty(t, FlowOptions{SkipPDF: true, Enrichment: EnrichmentLLM}.RequiredServices(true))
+}
+
+// TestHealthGateFailFastMode 测试默认使用fail_fast模式，只有显式配置hold时才放回队列
+func TestHealthGateFailFastMode(t *testing.T) {
+	processingConfig := &ProcessingConfig{}
+	assert.Equal(t, DownstreamModeFailFast, NewHealthGate(processingConfig).Mode())
+
+	processingConfig.Health.Mode = DownstreamModeHold
+	assert.Equal(t, DownstreamModeHold, NewHealthGate(processingConfig).Mode())
+
+	processingConfig.Health.Mode = "unknown"
+	assert.Equal(t, DownstreamModeFailFast, NewHealthGate(processingConfig).Mode())
+}
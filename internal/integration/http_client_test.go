@@ -0,0 +1,42 @@
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetHTTPClientConfig 测试HTTP客户端配置的所有字段都支持环境变量覆盖
+func TestGetHTTPClientConfig(t *testing.T) {
+	t.Setenv("HTTP_CLIENT_TIMEOUT", "30s")
+	t.Setenv("HTTP_CLIENT_MAX_IDLE_CONNS", "50")
+	t.Setenv("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST", "8")
+	t.Setenv("HTTP_CLIENT_IDLE_CONN_TIMEOUT", "45s")
+	t.Setenv("HTTP_CLIENT_MAX_RETRIES", "4")
+	t.Setenv("HTTP_CLIENT_RETRY_BACKOFF", "250ms")
+
+	assert.Equal(t, httpx.Config{
+		Timeout:             30 * time.Second,
+		MaxIdleConns:        50,
+		MaxIdleConnsPerHost: 8,
+		IdleConnTimeout:     45 * time.Second,
+		MaxRetries:          4,
+		RetryBackoff:        250 * time.Millisecond,
+	}, getHTTPClientConfig())
+}
+
+// TestIncrementalProcessor_SetHTTPConfig 测试处理配置中的HTTP参数应用到内部处理器及直连兜底
+func TestIncrementalProcessor_SetHTTPConfig(t *testing.T) {
+	fallback := &directLLMProvider{config: LLMFallbackConfig{Timeout: 90 * time.Second}}
+	processor := &IncrementalProcessor{pdfProcessor: &PDFLLMProcessor{fallback: fallback}}
+
+	processor.SetHTTPConfig(httpx.Config{Timeout: 15 * time.Second, MaxIdleConnsPerHost: 4})
+
+	require.NotNil(t, processor.pdfProcessor.httpClient)
+	assert.Equal(t, 15*time.Second, processor.pdfProcessor.httpClient.Timeout)
+	require.NotNil(t, fallback.httpClient)
+	assert.Equal(t, 90*time.Second, fallback.httpClient.Timeout, "兜底保留自身的超时配置")
+}
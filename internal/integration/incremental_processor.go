@@ -3,193 +3,388 @@ package integration
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"strings"
 	"time"
 
+	"github.com/freedkr/moonshot/internal/clock"
 	"github.com/freedkr/moonshot/internal/config"
 	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/httpx"
 	"github.com/freedkr/moonshot/internal/model"
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 // IncrementalProcessor 增量更新处理器 - 实现理想的5步流程
 type IncrementalProcessor struct {
-	config        *config.Config
-	httpClient    *http.Client
-	db            database.DatabaseInterface
-	llmServiceURL string
-	pdfServiceURL string
-	metrics       MetricsCollector
+	config           *config.Config
+	db               database.DatabaseInterface
+	pdfProcessor     *PDFLLMProcessor // PDF验证和LLM调用，各步骤共享HTTP连接池和指标收集器
+	metrics          MetricsCollector
+	cancelChecker    CancellationChecker
+	parentDepth      int               // 语义选择提示词中包含的祖先层数
+	stepTimeouts     StepTimeoutConfig // 各步骤的超时时间
+	taskLocker       TaskLocker        // 任务处理锁，与补充增强互斥
+	minConfidence    float64           // 应用语义选择结果的最低置信度，0 表示不过滤
+	dedupPDFCodes    bool              // 融合前按编码去重清洗后的PDF数据
+	reusePDFResult   bool              // 重新处理时复用已保存的PDF提取结果
+	ruleOnlyFallback bool              // LLM不可用时以规则解析结果完成任务
+	enrichLevels     []string          // 参与第二轮LLM增强的层级，为空时不过滤
+	dedupPolicy      model.DedupPolicy // 步骤1展开分类树时重复编码的取舍策略，与 worker 保存层级结构时一致
+	clock            clock.Clock       // 步骤超时和批次间隔的时间源，nil 时使用系统时钟
 }
 
+// ErrTaskCancelled 任务在增量处理过程中被取消
+var ErrTaskCancelled = errors.New("任务已取消")
+
 // NewIncrementalProcessor 创建增量处理器
 func NewIncrementalProcessor(cfg *config.Config, db database.DatabaseInterface) *IncrementalProcessor {
+	metrics := NewMetricsCollector()
+	clk := clock.Real()
+	pdfProcessor := NewPDFLLMProcessor(cfg, db)
+	pdfProcessor.SetMetricsCollector(metrics)
+	pdfProcessor.SetClock(clk)
+
 	return &IncrementalProcessor{
-		config: cfg,
-		db:     db,
-		httpClient: &http.Client{
-			Timeout: 120 * time.Second,
-		},
-		llmServiceURL: getServiceURL(cfg, "llm-service", "8090"),
-		pdfServiceURL: getServiceURL(cfg, "pdf-validator", "8000"),
-		metrics:       NewMetricsCollector(),
+		config:           cfg,
+		db:               db,
+		pdfProcessor:     pdfProcessor,
+		metrics:          metrics,
+		parentDepth:      getParentHierarchyDepth(),
+		stepTimeouts:     getStepTimeoutConfig(),
+		minConfidence:    getMinConfidence(),
+		dedupPDFCodes:    getPDFCodeDedup(),
+		reusePDFResult:   getPDFResultReuse(),
+		ruleOnlyFallback: getRuleOnlyFallback(),
+		enrichLevels:     getEnrichLevels(),
+		dedupPolicy:      model.DedupComplete,
+		clock:            clk,
+	}
+}
+
+// SetClock 替换时间源，同时用于内部的PDF/LLM处理器
+func (p *IncrementalProcessor) SetClock(c clock.Clock) {
+	p.clock = c
+	if p.pdfProcessor != nil {
+		p.pdfProcessor.SetClock(c)
+	}
+}
+
+// timeSource 返回注入的时间源，未注入时使用系统时钟
+func (p *IncrementalProcessor) timeSource() clock.Clock {
+	return clock.OrReal(p.clock)
+}
+
+// SetDedupPolicy 设置步骤1展开分类树时重复编码的取舍策略，应与 worker 保存层级结构时使用的策略相同
+func (p *IncrementalProcessor) SetDedupPolicy(policy model.DedupPolicy) {
+	p.dedupPolicy = policy
+}
+
+// SetRetryConfig 设置内部PDF/LLM处理器调用LLM服务的重试次数与退避参数
+func (p *IncrementalProcessor) SetRetryConfig(retryConfig LLMServiceConfig) {
+	if p.pdfProcessor != nil {
+		p.pdfProcessor.SetRetryConfig(retryConfig)
+	}
+}
+
+// SetHTTPConfig 设置内部PDF/LLM处理器使用的HTTP客户端连接池、超时和重试参数
+func (p *IncrementalProcessor) SetHTTPConfig(httpConfig httpx.Config) {
+	if p.pdfProcessor != nil {
+		p.pdfProcessor.SetHTTPConfig(httpConfig)
+	}
+}
+
+// SetStepTimeouts 设置各步骤的超时时间
+func (p *IncrementalProcessor) SetStepTimeouts(stepTimeouts StepTimeoutConfig) {
+	p.stepTimeouts = stepTimeouts
+}
+
+// SetCancellationChecker 设置取消检查器，流程在步骤和批次之间检查任务是否被取消
+func (p *IncrementalProcessor) SetCancellationChecker(checker CancellationChecker) {
+	p.cancelChecker = checker
+}
+
+// checkCancelled 任务被取消时返回 ErrTaskCancelled
+// 检查失败时继续处理，避免Redis短暂不可用导致任务中断
+func (p *IncrementalProcessor) checkCancelled(ctx context.Context, taskID string) error {
+	if p.cancelChecker == nil {
+		return nil
+	}
+	cancelled, err := p.cancelChecker.IsCancelRequested(ctx, taskID)
+	if err != nil {
+		fmt.Printf("⚠️ WARNING: 检查取消标记失败 - taskID: %s, 错误: %v\n", taskID, err)
+		return nil
 	}
+	if cancelled {
+		fmt.Printf("🛑 DEBUG: 任务已被取消，停止增量处理 - taskID: %s\n", taskID)
+		return ErrTaskCancelled
+	}
+	return nil
 }
 
 // ProcessIncrementalFlow 执行增量更新的5步流程
+// 每个步骤之间以及步骤4的每个批次之间检查取消标记；取消时已写入的分类数据保持各自步骤的状态，
+// 当前版本仍可正常查询。每个步骤在各自的超时内执行，超时的步骤以 ErrStepTimeout 失败。
+// 流程持有任务处理锁，同一任务的补充增强正在执行时返回 ErrFlowInProgress
 func (p *IncrementalProcessor) ProcessIncrementalFlow(ctx context.Context, taskID string, excelPath string, categories []*model.Category) error {
+	return p.ProcessIncrementalFlowWithOptions(ctx, taskID, excelPath, categories, FlowOptions{})
+}
+
+// ProcessIncrementalFlowWithOptions 按任务选项执行增量流程，opts.SkipPDF 时步骤1之后跳过步骤2、3
+func (p *IncrementalProcessor) ProcessIncrementalFlowWithOptions(ctx context.Context, taskID string, excelPath string, categories []*model.Category, opts FlowOptions) error {
 	fmt.Printf("🚀 DEBUG: IncrementalProcessor.ProcessIncrementalFlow 开始执行 - taskID: %s\n", taskID)
+	release, err := p.acquireTaskLock(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, report := withReportCollector(ctx)
+
+	if err := p.checkCancelled(ctx, taskID); err != nil {
+		return err
+	}
+
 	// 步骤1：先解析excel保存到表中，此时外部接口可以调用得到数据渲染
-	err := p.step1SaveExcelData(ctx, taskID, categories)
+	err = p.runStep(ctx, taskID, "步骤1", p.stepTimeouts.ExcelSave, func(ctx context.Context) error {
+		return p.step1SaveExcelData(ctx, taskID, categories)
+	})
 	if err != nil {
 		return fmt.Errorf("步骤1失败: %w", err)
 	}
 
+	if err := p.checkCancelled(ctx, taskID); err != nil {
+		return err
+	}
+
+	if opts.SkipPDF {
+		return p.processWithoutPDF(ctx, taskID, opts.Enrichment, report)
+	}
+
 	// 步骤2：pdf处理得到的结果调用llm进行第一步的清洗，对应的数据是name，code
 	fmt.Printf("🚀 DEBUG: 开始执行步骤2 - PDF处理和LLM清洗 - taskID: %s\n", taskID)
-	pdfData, err := p.step2ProcessPDFWithLLM(ctx, taskID)
+	var pdfData []map[string]interface{}
+	err = p.runStep(ctx, taskID, "步骤2", p.stepTimeouts.PDFCleaning, func(ctx context.Context) error {
+		var stepErr error
+		pdfData, stepErr = p.step2ProcessPDFWithLLM(ctx, taskID)
+		return stepErr
+	})
 	if err != nil {
 		fmt.Printf("❌ ERROR: 步骤2失败 - taskID: %s, 错误: %v\n", taskID, err)
+		// 开启规则降级时，LLM不可用不再使任务失败，步骤1保存的规则解析结果即为最终结果
+		if p.ruleOnlyFallback && isLLMFailure(err) && ctx.Err() == nil {
+			if err := p.completeWithRules(ctx, taskID, err); err != nil {
+				return err
+			}
+			p.saveProcessingReport(ctx, taskID, report, true)
+			return nil
+		}
 		return fmt.Errorf("步骤2失败: %w", err)
 	}
 	fmt.Printf("✅ DEBUG: 步骤2完成 - taskID: %s, PDF数据条数: %d\n", taskID, len(pdfData))
 
+	if err := p.checkCancelled(ctx, taskID); err != nil {
+		return err
+	}
+
 	// 步骤3：将excel与pdf的数据通过code或者name进行两部分的合并，区分excel和pdf
 	fmt.Printf("🚀 DEBUG: 开始执行步骤3 - 合并Excel和PDF数据 - taskID: %s\n", taskID)
-	err = p.step3MergeExcelAndPDFData(ctx, taskID, pdfData)
+	err = p.runStep(ctx, taskID, "步骤3", p.stepTimeouts.Merge, func(ctx context.Context) error {
+		return p.step3MergeExcelAndPDFData(ctx, taskID, pdfData)
+	})
 	if err != nil {
 		fmt.Printf("❌ ERROR: 步骤3失败 - taskID: %s, 错误: %v\n", taskID, err)
 		return fmt.Errorf("步骤3失败: %w", err)
 	}
 	fmt.Printf("✅ DEBUG: 步骤3完成 - taskID: %s\n", taskID)
 
+	return p.runEnhancementSteps(ctx, taskID, report)
+}
+
+// runEnhancementSteps 执行步骤4（第二轮LLM增强）和步骤5（最终结果检查），完成后保存处理报告
+func (p *IncrementalProcessor) runEnhancementSteps(ctx context.Context, taskID string, report *reportCollector) error {
+	if err := p.checkCancelled(ctx, taskID); err != nil {
+		return err
+	}
+
 	// 步骤4：第二次调用llm，通过3步骤得到更丰富的数据投喂给llm进行筛选
 	fmt.Printf("🚀 DEBUG: 开始执行步骤4 - 第二次LLM增强 - taskID: %s\n", taskID)
-	enhancedData, err := p.step4EnhanceWithSecondLLM(ctx, taskID)
+	var enhancedData []map[string]interface{}
+	err := p.runStep(ctx, taskID, "步骤4", p.stepTimeouts.LLMEnhance, func(ctx context.Context) error {
+		var stepErr error
+		enhancedData, stepErr = p.step4EnhanceWithSecondLLM(ctx, taskID)
+		return stepErr
+	})
 	if err != nil {
 		fmt.Printf("❌ ERROR: 步骤4失败 - taskID: %s, 错误: %v\n", taskID, err)
 		return fmt.Errorf("步骤4失败: %w", err)
 	}
 	fmt.Printf("✅ DEBUG: 步骤4完成 - taskID: %s, 增强数据条数: %d\n", taskID, len(enhancedData))
 
+	if err := p.checkCancelled(ctx, taskID); err != nil {
+		return err
+	}
+
 	// 步骤5：最终筛选后的结果更新会分类表中
 	fmt.Printf("🚀 DEBUG: 开始执行步骤5 - 更新最终结果 - taskID: %s\n", taskID)
-	err = p.step5UpdateFinalResults(ctx, taskID, enhancedData)
+	err = p.runStep(ctx, taskID, "步骤5", p.stepTimeouts.FinalUpdate, func(ctx context.Context) error {
+		return p.step5UpdateFinalResults(ctx, taskID, enhancedData)
+	})
 	if err != nil {
 		fmt.Printf("❌ ERROR: 步骤5失败 - taskID: %s, 错误: %v\n", taskID, err)
 		return fmt.Errorf("步骤5失败: %w", err)
 	}
 	fmt.Printf("✅ DEBUG: 步骤5完成 - taskID: %s\n", taskID)
 	fmt.Printf("🎉 DEBUG: 增量处理流程全部完成 - taskID: %s\n", taskID)
+	p.saveProcessingReport(ctx, taskID, report, false)
 
 	return nil
 }
 
 // step1SaveExcelData 步骤1：保存Excel解析数据
+// 与 worker 保存层级结构使用相同的展开和去重策略，当前版本内容相同（worker 已写入或任务重试）时复用该版本，
+// 已有的处理状态和PDF/LLM结果保持不变
 func (p *IncrementalProcessor) step1SaveExcelData(ctx context.Context, taskID string, categories []*model.Category) error {
 	p.metrics.RecordProcessingDuration("excel_parsing", time.Since(time.Now()))
 
-	// 生成新的批次ID
+	flat, _ := model.FlattenWithPolicy(categories, p.dedupPolicy)
 	batchID := uuid.New().String()
-	currentTime := time.Now()
-
-	// 转换为数据库格式，包含版本化字段
-	var dbCategories []*database.Category
-	for _, cat := range categories {
-		dbCat := &database.Category{
-			TaskID:          taskID,
-			Code:            cat.Code,
-			Name:            cat.Name,
-			Level:           cat.Level,
-			ParentCode:      cat.GetParentCode(),
-			Status:          database.StatusExcelParsed,
-			DataSource:      database.DataSourceExcel,
-			UploadBatchID:   batchID,
-			UploadTimestamp: currentTime,
-			IsCurrent:       true, // 新插入的记录设为当前版本
-		}
-		dbCategories = append(dbCategories, dbCat)
-	}
-
-	// 使用版本化逻辑：先标记旧版本，再插入新版本
-	pgDB, ok := p.db.(*database.PostgreSQLDB)
-	if !ok {
-		return fmt.Errorf("数据库类型错误")
-	}
-
-	// 添加调试日志
-	fmt.Printf("DEBUG: 准备处理taskID=%s的数据，共%d条记录，batchID=%s\n", taskID, len(dbCategories), batchID)
-
-	err := pgDB.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// 检查是否存在当前版本记录
-		var existingCount int64
-		if err := tx.Model(&database.Category{}).Where("task_id = ? AND is_current = true", taskID).Count(&existingCount).Error; err != nil {
-			return fmt.Errorf("检查已存在数据失败: %w", err)
-		}
-		fmt.Printf("DEBUG: taskID=%s 已存在当前版本记录%d条\n", taskID, existingCount)
-
-		// 将现有的当前版本标记为历史版本
-		if existingCount > 0 {
-			result := tx.Model(&database.Category{}).
-				Where("task_id = ? AND is_current = true", taskID).
-				Update("is_current", false)
-			if result.Error != nil {
-				return fmt.Errorf("标记历史版本失败: %w", result.Error)
-			}
-			fmt.Printf("DEBUG: 标记了%d条记录为历史版本\n", result.RowsAffected)
-		}
-
-		// 批量插入新的当前版本数据
-		if err := tx.CreateInBatches(dbCategories, 100).Error; err != nil {
-			return fmt.Errorf("批量插入数据失败: %w", err)
-		}
-		fmt.Printf("DEBUG: 成功插入%d条新的当前版本记录，batchID=%s\n", len(dbCategories), batchID)
-
-		return nil
-	})
+	fmt.Printf("DEBUG: 准备处理taskID=%s的数据，共%d条记录，batchID=%s\n", taskID, len(flat), batchID)
 
+	reused, written, err := database.SaveFlatCategoryVersion(ctx, p.db, taskID, batchID, flat, 0)
 	if err != nil {
 		p.metrics.RecordError("excel_parsing", err)
 		return fmt.Errorf("保存Excel数据失败: %w", err)
 	}
 
 	p.metrics.RecordSuccess("excel_parsing")
-	fmt.Printf("DEBUG: Excel数据版本化保存完成 - taskID=%s, batchID=%s\n", taskID, batchID)
+	if reused != "" {
+		fmt.Printf("DEBUG: 当前版本内容相同，复用已有版本 - taskID=%s, batchID=%s\n", taskID, reused)
+		return nil
+	}
+	fmt.Printf("DEBUG: Excel数据版本化保存完成 - taskID=%s, batchID=%s, 记录数=%d\n", taskID, batchID, written)
 	return nil
 }
 
 // step2ProcessPDFWithLLM 步骤2：PDF处理并调用LLM清洗
 func (p *IncrementalProcessor) step2ProcessPDFWithLLM(ctx context.Context, taskID string) ([]map[string]interface{}, error) {
+	ctx = withLLMCorrelation(ctx, taskID, llmStepPDFCleaning)
 	startTime := time.Now()
 	defer func() {
 		p.metrics.RecordProcessingDuration("pdf_llm_cleaning", time.Since(startTime))
 	}()
 
-	// 调用PDF验证服务 (复用现有逻辑)
-	pdfResult, err := p.callPDFValidator(ctx, taskID)
-	if err != nil {
-		p.metrics.RecordError("pdf_llm_cleaning", err)
-		return nil, fmt.Errorf("PDF验证失败: %w", err)
-	}
+	// 重新处理时优先复用已保存的PDF提取结果，提取的职业编码不会变化
+	pdfResult, replayed := p.loadStoredPDFResult(ctx, taskID)
+	if !replayed {
+		// 调用PDF验证服务 (复用现有逻辑)
+		var err error
+		pdfResult, err = p.callPDFValidator(ctx, taskID)
+		if err != nil {
+			p.metrics.RecordError("pdf_llm_cleaning", err)
+			return nil, fmt.Errorf("PDF验证失败: %w", err)
+		}
+
+		fmt.Printf("📊 DEBUG: PDF验证完成，职业编码数: %d\n", len(pdfResult.OccupationCodes))
 
-	// 📊 DEBUG: PDF验证完成，记录原始数据大小
-	fmt.Printf("📊 DEBUG: PDF验证完成，原始数据大小: %v\n", len(fmt.Sprintf("%+v", pdfResult)))
+		// 先保存原始提取结果，清洗失败时仍可审计
+		p.savePDFExtraction(ctx, taskID, pdfResult, nil)
+	}
 
 	// 第一轮LLM分析 - 清洗PDF结果
 	cleanedPDFData, err := p.firstLLMAnalysis(ctx, pdfResult)
 	if err != nil {
 		p.metrics.RecordError("pdf_llm_cleaning", err)
-		return nil, fmt.Errorf("第一轮LLM分析失败: %w", err)
+		return nil, fmt.Errorf("第一轮LLM分析失败: %w", &llmFailure{err: err})
 	}
 
 	fmt.Printf("🎯 DEBUG: 第一轮LLM分析完成，清洗后数据条数: %d\n", len(cleanedPDFData))
+	p.savePDFExtraction(ctx, taskID, pdfResult, cleanedPDFData)
 
 	p.metrics.RecordSuccess("pdf_llm_cleaning")
 	return cleanedPDFData, nil
 }
 
+// savePDFExtraction 保存PDF服务的原始提取结果和第一轮清洗结果，失败不影响主流程
+func (p *IncrementalProcessor) savePDFExtraction(ctx context.Context, taskID string, pdfResult PDFResult, cleaned []map[string]interface{}) {
+	extraction := buildPDFExtraction(taskID, pdfResult, cleaned)
+	if err := p.db.SavePDFExtraction(ctx, extraction); err != nil {
+		fmt.Printf("⚠️ WARNING: 保存PDF提取结果失败 - taskID: %s, 错误: %v\n", taskID, err)
+	}
+}
+
+// mergeTaskResult 将字段合并写入任务结果，保留结果中的其他字段；status 非空时同时更新任务状态。
+// 只更新这两列，避免覆盖worker同时写入的其他字段
+func (p *IncrementalProcessor) mergeTaskResult(tx *gorm.DB, taskID string, status string, fields map[string]interface{}) error {
+	var task database.TaskRecord
+	if err := tx.Select("id, result").Where("id = ?", taskID).First(&task).Error; err != nil {
+		return fmt.Errorf("获取任务记录失败: %w", err)
+	}
+
+	result := make(map[string]interface{})
+	if len(task.Result) > 0 {
+		if err := json.Unmarshal(task.Result, &result); err != nil {
+			return fmt.Errorf("解析任务结果失败: %w", err)
+		}
+	}
+	for key, value := range fields {
+		result[key] = value
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("序列化任务结果失败: %w", err)
+	}
+
+	updates := map[string]interface{}{"result": datatypes.JSON(data)}
+	if status != "" {
+		updates["status"] = status
+	}
+	return tx.Model(&database.TaskRecord{}).Where("id = ?", taskID).Updates(updates).Error
+}
+
+// buildPDFExtraction 将PDF服务返回的结果转换为数据库记录，条目和完整返回按PDF服务的原始格式保存
+func buildPDFExtraction(taskID string, pdfResult PDFResult, cleaned []map[string]interface{}) *database.PDFExtraction {
+	extraction := &database.PDFExtraction{
+		TaskID:          taskID,
+		PDFTaskID:       pdfResult.TaskID,
+		TotalFound:      pdfResult.TotalFound,
+		OccupationCodes: datatypes.JSON(pdfResult.rawCodeItems()),
+	}
+
+	raw := interface{}(pdfResult.Raw)
+	if pdfResult.Raw == nil {
+		raw = pdfResult
+	}
+	if data, err := json.Marshal(raw); err == nil {
+		extraction.RawResult = data
+	}
+
+	if cleaned != nil {
+		if data, err := json.Marshal(cleaned); err == nil {
+			extraction.CleanedCodes = data
+		}
+		extraction.CleanedCount = len(cleaned)
+	}
+	return extraction
+}
+
+// toInt 将JSON解码得到的数值转换为int
+func toInt(value interface{}) int {
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case json.Number:
+		n, _ := v.Int64()
+		return int(n)
+	default:
+		return 0
+	}
+}
+
 // step3MergeExcelAndPDFData 步骤3：融合Excel和PDF数据
 func (p *IncrementalProcessor) step3MergeExcelAndPDFData(ctx context.Context, taskID string, pdfData []map[string]interface{}) error {
 	startTime := time.Now()
@@ -199,9 +394,17 @@ func (p *IncrementalProcessor) step3MergeExcelAndPDFData(ctx context.Context, ta
 
 	fmt.Printf("📊 [Step3-开始] taskID=%s, PDF数据条数=%d\n", taskID, len(pdfData))
 
-	pgDB, ok := p.db.(*database.PostgreSQLDB)
-	if !ok {
-		return fmt.Errorf("数据库类型错误")
+	// LLM输出的编码可能含全角数字或横线，先规范化，否则去重和按编码匹配都会漏掉这些条目
+	if changed := normalizePDFCodes(pdfData); changed > 0 {
+		fmt.Printf("📊 [Step3-编码规范化] 规范化编码 %d 条\n", changed)
+	}
+
+	// 同一编码可能来自多个前缀分组或PDF中的重复条目，先去重，避免融合结果依赖返回顺序
+	if p.dedupPDFCodes {
+		var conflicts []PDFCodeConflict
+		pdfData, conflicts = dedupPDFCodes(pdfData)
+		fmt.Printf("📊 [Step3-去重] 编码冲突数=%d, 去重后PDF数据条数=%d\n", len(conflicts), len(pdfData))
+		p.recordPDFCodeConflicts(ctx, taskID, conflicts)
 	}
 
 	// 创建PDF数据的Code映射
@@ -224,11 +427,12 @@ func (p *IncrementalProcessor) step3MergeExcelAndPDFData(ctx context.Context, ta
 
 	// 批量更新数据库中的记录
 	var updates []database.CategoryUpdate
+	var codeMatched, nameMatched int
 
 	// 获取现有的Excel数据
 	var excelCategories []database.Category
 	fmt.Printf("🔍 [Step3-查询] 正在查询 task_id=%s AND status=%s 的记录...\n", taskID, database.StatusExcelParsed)
-	err := pgDB.GetDB().WithContext(ctx).Where("task_id = ? AND status = ?",
+	err := p.db.WithContext(ctx).Where("task_id = ? AND is_current = true AND status = ?",
 		taskID, database.StatusExcelParsed).Find(&excelCategories).Error
 	if err != nil {
 		p.metrics.RecordError("data_merging", err)
@@ -244,9 +448,11 @@ func (p *IncrementalProcessor) step3MergeExcelAndPDFData(ctx context.Context, ta
 		// 优先按Code匹配
 		if pdfInfo, found = pdfCodeMap[cat.Code]; found {
 			matchType = "Code匹配"
+			codeMatched++
 		} else if pdfInfo, found = pdfNameMap[cat.Name]; found {
 			// 备选按Name匹配
 			matchType = "Name匹配"
+			nameMatched++
 		}
 
 		if found {
@@ -272,6 +478,7 @@ func (p *IncrementalProcessor) step3MergeExcelAndPDFData(ctx context.Context, ta
 	}
 	fmt.Printf("📊 [Step3-匹配统计] 总记录=%d, 成功匹配=%d, 未匹配=%d\n",
 		len(excelCategories), len(updates), len(excelCategories)-len(updates))
+	reportCollectorFrom(ctx).recordPDFMatches(len(pdfData), codeMatched, nameMatched)
 
 	// 执行批量更新
 	if len(updates) > 0 {
@@ -294,6 +501,7 @@ func (p *IncrementalProcessor) step3MergeExcelAndPDFData(ctx context.Context, ta
 
 // step4EnhanceWithSecondLLM 步骤4：第二轮LLM增强
 func (p *IncrementalProcessor) step4EnhanceWithSecondLLM(ctx context.Context, taskID string) ([]map[string]interface{}, error) {
+	ctx = withLLMCorrelation(ctx, taskID, llmStepLLMEnhance)
 	startTime := time.Now()
 	defer func() {
 		p.metrics.RecordProcessingDuration("llm_enhancement", time.Since(startTime))
@@ -301,20 +509,14 @@ func (p *IncrementalProcessor) step4EnhanceWithSecondLLM(ctx context.Context, ta
 
 	fmt.Printf("\n🚀 [Step4-开始] 第二轮LLM增强 - taskID=%s\n", taskID)
 
-	// 获取已融合的数据
-	pgDB, ok := p.db.(*database.PostgreSQLDB)
-	if !ok {
-		return nil, fmt.Errorf("数据库类型错误")
-	}
-
 	// 先查询所有状态，了解数据分布
 	var statusCount []struct {
 		Status string
 		Count  int64
 	}
-	pgDB.GetDB().Model(&database.Category{}).
+	p.db.WithContext(ctx).Model(&database.Category{}).
 		Select("status, count(*) as count").
-		Where("task_id = ?", taskID).
+		Where("task_id = ? AND is_current = true", taskID).
 		Group("status").
 		Scan(&statusCount)
 
@@ -325,7 +527,7 @@ func (p *IncrementalProcessor) step4EnhanceWithSecondLLM(ctx context.Context, ta
 
 	var mergedCategories []database.Category
 	fmt.Printf("🔍 [Step4-查询] 正在查询 task_id=%s AND status=%s 的记录...\n", taskID, database.StatusPDFMerged)
-	err := pgDB.GetDB().WithContext(ctx).Where("task_id = ? AND status = ?",
+	err := p.db.WithContext(ctx).Where("task_id = ? AND is_current = true AND status = ?",
 		taskID, database.StatusPDFMerged).Find(&mergedCategories).Error
 	if err != nil {
 		fmt.Printf("❌ [Step4-查询失败] 错误: %v\n", err)
@@ -338,33 +540,77 @@ func (p *IncrementalProcessor) step4EnhanceWithSecondLLM(ctx context.Context, ta
 	// 如果没有融合数据，尝试使用所有Excel数据
 	if len(mergedCategories) == 0 {
 		fmt.Printf("⚠️ [Step4-降级处理] 没有找到pdf_merged状态的数据，尝试使用excel_parsed状态的数据...\n")
-		err = pgDB.GetDB().WithContext(ctx).Where("task_id = ? AND status = ?",
+		err = p.db.WithContext(ctx).Where("task_id = ? AND is_current = true AND status = ?",
 			taskID, database.StatusExcelParsed).Find(&mergedCategories).Error
 		if err != nil {
 			fmt.Printf("❌ [Step4-降级失败] 获取Excel数据失败: %v\n", err)
 			return nil, fmt.Errorf("获取Excel数据失败: %w", err)
 		}
+		// 未合并PDF的数据保持 excel_parsed，增强结果经 excel_parsed → completed 流转完成
 		fmt.Printf("✅ [Step4-降级成功] 获取到Excel数据 %d 条\n", len(mergedCategories))
 	}
 
+	// 只有配置的层级参与增强，其余层级的名称直接取自标准，以规则解析结果完成
+	mergedCategories, skippedCategories := p.filterEnrichLevels(mergedCategories)
+	if len(skippedCategories) > 0 {
+		fmt.Printf("⏭️ [Step4-层级过滤] 增强层级=%v，跳过 %d 条，参与增强 %d 条\n",
+			p.enrichLevels, len(skippedCategories), len(mergedCategories))
+		if err := p.completeSkippedLevels(ctx, taskID, skippedCategories); err != nil {
+			fmt.Printf("❌ [Step4-层级过滤] 更新跳过分类状态失败: %v\n", err)
+			return nil, fmt.Errorf("更新跳过分类状态失败: %w", err)
+		}
+	}
+
+	// 查询当前版本的全部分类，用于构建祖先名称路径
+	var allCategories []database.Category
+	if p.parentDepth > 0 {
+		if err := p.db.WithContext(ctx).Select("code, name, parent_code").
+			Where("task_id = ? AND is_current = true", taskID).Find(&allCategories).Error; err != nil {
+			fmt.Printf("⚠️ [Step4-层级] 查询分类层级失败: %v，不包含父级信息\n", err)
+		}
+	}
+
 	// 准备丰富数据供LLM分析
-	enrichedChoices := p.prepareEnrichedData(mergedCategories)
+	enrichedChoices := p.prepareEnrichedData(mergedCategories, allCategories)
 	fmt.Printf("🔄 [Step4-准备数据] 准备第二轮LLM分析，候选数据: %d 条\n", len(enrichedChoices))
 
-	// 批量处理：每批10条，处理完立即更新数据库
+	allResults, totalProcessed, err := p.enhanceInBatches(ctx, taskID, "Step4", enrichedChoices)
+	if err != nil {
+		return allResults, err
+	}
+
+	fmt.Printf("\n✅ [Step4-完成] 批量LLM分析完成，总计处理并更新: %d 条\n", totalProcessed)
+	// 记录平均置信度，用于比较不同祖先层数对选择质量的影响
+	reportCollectorFrom(ctx).recordConfidence(allResults)
+	if avg, count := averageConfidence(allResults); count > 0 {
+		fmt.Printf("📈 [Step4-置信度] 父级层数=%d，平均置信度=%.3f（%d/%d 条返回置信度）\n",
+			p.parentDepth, avg, count, len(allResults))
+	}
+	p.metrics.RecordSuccess("llm_enhancement")
+	return allResults, nil
+}
+
+// enhanceInBatches 分批执行第二轮LLM语义选择，每批处理完立即更新数据库
+// 失败的批次拆分重试，仍失败时跳过；返回全部结果和成功写入的条数，stage 用于日志前缀
+func (p *IncrementalProcessor) enhanceInBatches(ctx context.Context, taskID string, stage string, choices []SemanticChoiceItem) ([]map[string]interface{}, int, error) {
 	batchSize := 10
 	totalProcessed := 0
 	var allResults []map[string]interface{}
 
-	for i := 0; i < len(enrichedChoices); i += batchSize {
+	for i := 0; i < len(choices); i += batchSize {
 		end := i + batchSize
-		if end > len(enrichedChoices) {
-			end = len(enrichedChoices)
+		if end > len(choices) {
+			end = len(choices)
 		}
 
-		batch := enrichedChoices[i:end]
+		if err := p.checkCancelled(ctx, taskID); err != nil {
+			fmt.Printf("🛑 [%s-取消] 已处理 %d 条，剩余批次不再提交LLM\n", stage, totalProcessed)
+			return allResults, totalProcessed, err
+		}
+
+		batch := choices[i:end]
 		batchNum := (i / batchSize) + 1
-		fmt.Printf("\n📦 [Step4-批次%d] 处理第 %d-%d 条数据（共%d条）\n", batchNum, i+1, end, len(enrichedChoices))
+		fmt.Printf("\n📦 [%s-批次%d] 处理第 %d-%d 条数据（共%d条）\n", stage, batchNum, i+1, end, len(choices))
 
 		// 打印当前批次的前3个候选数据
 		for j, choice := range batch {
@@ -376,23 +622,32 @@ func (p *IncrementalProcessor) step4EnhanceWithSecondLLM(ctx context.Context, ta
 		}
 
 		// 第二轮LLM分析 - 处理当前批次
-		fmt.Printf("🤖 [Step4-批次%d-LLM] 开始LLM分析...\n", batchNum)
-		batchResult, err := p.secondLLMAnalysis(ctx, batch)
-		if err != nil {
-			fmt.Printf("❌ [Step4-批次%d-失败] LLM分析失败: %v，跳过本批次\n", batchNum, err)
-			p.metrics.RecordError("llm_enhancement_batch", err)
-			continue // 跳过失败的批次，继续处理下一批
+		fmt.Printf("🤖 [%s-批次%d-LLM] 开始LLM分析...\n", stage, batchNum)
+		batchResult, failures := p.secondLLMAnalysis(ctx, batch)
+		if len(failures) > 0 {
+			fmt.Printf("❌ [%s-批次%d-失败] %d/%d 条LLM分析失败，单独重试失败条目\n", stage, batchNum, len(failures), len(batch))
+			p.metrics.RecordError("llm_enhancement_batch", failures[0].Err)
+			recovered := p.retryFailedChoices(ctx, failures)
+			if len(recovered) > 0 {
+				fmt.Printf("🔁 [%s-批次%d-回退] 重试恢复 %d/%d 条\n", stage, batchNum, len(recovered), len(failures))
+			}
+			batchResult = append(batchResult, recovered...)
+			if len(batchResult) == 0 {
+				fmt.Printf("❌ [%s-批次%d-失败] 重试后仍无结果，跳过本批次\n", stage, batchNum)
+				continue // 跳过失败的批次，继续处理下一批
+			}
 		}
 
-		fmt.Printf("✅ [Step4-批次%d-成功] LLM分析完成，返回 %d 条结果\n", batchNum, len(batchResult))
+		fmt.Printf("✅ [%s-批次%d-成功] LLM分析完成，返回 %d 条结果\n", stage, batchNum, len(batchResult))
+		withRuleNames(batchResult, batch)
 
 		// 立即更新这批数据到数据库
 		if len(batchResult) > 0 {
-			fmt.Printf("💾 [Step4-批次%d-更新] 立即更新数据库...\n", batchNum)
+			fmt.Printf("💾 [%s-批次%d-更新] 立即更新数据库...\n", stage, batchNum)
 			if err := p.updateBatchLLMResults(ctx, taskID, batchResult); err != nil {
-				fmt.Printf("❌ [Step4-批次%d-更新失败] 数据库更新失败: %v\n", batchNum, err)
+				fmt.Printf("❌ [%s-批次%d-更新失败] 数据库更新失败: %v\n", stage, batchNum, err)
 			} else {
-				fmt.Printf("✅ [Step4-批次%d-更新成功] 已更新 %d 条记录\n", batchNum, len(batchResult))
+				fmt.Printf("✅ [%s-批次%d-更新成功] 已更新 %d 条记录\n", stage, batchNum, len(batchResult))
 				totalProcessed += len(batchResult)
 			}
 		}
@@ -401,15 +656,29 @@ func (p *IncrementalProcessor) step4EnhanceWithSecondLLM(ctx context.Context, ta
 		allResults = append(allResults, batchResult...)
 
 		// 添加短暂延迟，避免过度压力
-		if i+batchSize < len(enrichedChoices) {
-			fmt.Printf("⏱️ [Step4-批次%d] 等待1秒后处理下一批...\n", batchNum)
-			time.Sleep(1 * time.Second)
+		if i+batchSize < len(choices) {
+			fmt.Printf("⏱️ [%s-批次%d] 等待1秒后处理下一批...\n", stage, batchNum)
+			<-p.timeSource().After(1 * time.Second)
 		}
 	}
 
-	fmt.Printf("\n✅ [Step4-完成] 批量LLM分析完成，总计处理并更新: %d 条\n", totalProcessed)
-	p.metrics.RecordSuccess("llm_enhancement")
-	return allResults, nil
+	return allResults, totalProcessed, nil
+}
+
+// averageConfidence 计算语义选择结果中 confidence 字段的平均值，返回平均值和有效条数
+func averageConfidence(results []map[string]interface{}) (float64, int) {
+	var sum float64
+	count := 0
+	for _, item := range results {
+		if confidence, ok := item["confidence"].(float64); ok && confidence >= 0 && confidence <= 1 {
+			sum += confidence
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return sum / float64(count), count
 }
 
 // step5UpdateFinalResults 步骤5：最终状态检查（数据已在step4批量更新）
@@ -422,19 +691,14 @@ func (p *IncrementalProcessor) step5UpdateFinalResults(ctx context.Context, task
 	fmt.Printf("\n🚀 [Step5-开始] 最终状态检查 - taskID=%s\n", taskID)
 
 	// 由于数据已在step4中批量更新，这里只做状态检查
-	pgDB, ok := p.db.(*database.PostgreSQLDB)
-	if !ok {
-		return fmt.Errorf("数据库类型错误")
-	}
-
 	// 统计更新结果
 	var statusStats []struct {
 		Status string
 		Count  int64
 	}
-	err := pgDB.GetDB().Model(&database.Category{}).
+	err := p.db.WithContext(ctx).Model(&database.Category{}).
 		Select("status, count(*) as count").
-		Where("task_id = ?", taskID).
+		Where("task_id = ? AND is_current = true", taskID).
 		Group("status").
 		Scan(&statusStats).Error
 
@@ -450,8 +714,8 @@ func (p *IncrementalProcessor) step5UpdateFinalResults(ctx context.Context, task
 
 	// 检查llm_enhancements字段是否已填充
 	var enhancedCount int64
-	pgDB.GetDB().Model(&database.Category{}).
-		Where("task_id = ? AND llm_enhancements IS NOT NULL AND llm_enhancements != ''", taskID).
+	p.db.WithContext(ctx).Model(&database.Category{}).
+		Where("task_id = ? AND is_current = true AND llm_enhancements IS NOT NULL AND llm_enhancements != ''", taskID).
 		Count(&enhancedCount)
 
 	fmt.Printf("📊 [Step5-LLM增强统计] LLM增强字段已填充: %d 条\n", enhancedCount)
@@ -471,21 +735,15 @@ func (p *IncrementalProcessor) step5UpdateFinalResults(ctx context.Context, task
 
 			// 检查该记录是否已有llm_enhancements
 			var count int64
-			pgDB.GetDB().Model(&database.Category{}).
+			p.db.WithContext(ctx).Model(&database.Category{}).
 				Where("task_id = ? AND code = ? AND (llm_enhancements IS NULL OR llm_enhancements = '')",
 					taskID, code).
 				Count(&count)
 
 			if count > 0 {
-				llmInfoJSON, _ := json.Marshal(item)
-				updates = append(updates, database.CategoryUpdate{
-					Code: code,
-					Updates: map[string]interface{}{
-						"status":           database.StatusCompleted,
-						"llm_enhancements": string(llmInfoJSON),
-						"name":             item["name"],
-					},
-				})
+				if update, ok := p.llmResultUpdate(item); ok {
+					updates = append(updates, update)
+				}
 			}
 		}
 
@@ -499,31 +757,67 @@ func (p *IncrementalProcessor) step5UpdateFinalResults(ctx context.Context, task
 		}
 	}
 
+	// 按名称规则校验LLM增强后的名称，不依赖LLM是否遵守提示词中的排除规则
+	if err := p.validateFinalNames(ctx, taskID); err != nil {
+		fmt.Printf("❌ [Step5-名称校验失败] 错误: %v\n", err)
+		p.metrics.RecordError("name_validation", err)
+	}
+
+	// 人工修正最后应用，重新处理后仍以人工指定的名称为准
+	if err := p.applyManualOverrides(ctx, taskID, "Step5"); err != nil {
+		fmt.Printf("❌ [Step5-人工修正失败] 错误: %v\n", err)
+		return err
+	}
+
 	p.metrics.RecordSuccess("final_update")
 	fmt.Printf("✅ [Step5-完成] 最终检查完成，共 %d 条记录已完成LLM增强\n\n", enhancedCount)
 	return nil
 }
 
 // 辅助方法 - 复用现有逻辑
-func (p *IncrementalProcessor) callPDFValidator(ctx context.Context, taskID string) (map[string]interface{}, error) {
-	// 复用现有的PDFLLMProcessor的callPDFValidator方法
-	processor := NewPDFLLMProcessor(p.config, p.db)
-	return processor.callPDFValidator(ctx, taskID, "")
+func (p *IncrementalProcessor) callPDFValidator(ctx context.Context, taskID string) (PDFResult, error) {
+	return p.pdfProcessor.callPDFValidator(ctx, taskID, "")
+}
+
+func (p *IncrementalProcessor) firstLLMAnalysis(ctx context.Context, pdfResult PDFResult) ([]map[string]interface{}, error) {
+	return p.pdfProcessor.firstLLMAnalysis(ctx, pdfResult)
 }
 
-func (p *IncrementalProcessor) firstLLMAnalysis(ctx context.Context, pdfResult map[string]interface{}) ([]map[string]interface{}, error) {
-	// 复用现有的PDFLLMProcessor的firstLLMAnalysis方法
-	processor := NewPDFLLMProcessor(p.config, p.db)
-	return processor.firstLLMAnalysis(ctx, pdfResult)
+// secondLLMAnalysis 逐条执行第二轮语义选择，返回成功的结果和失败的条目，失败的条目不填充默认结果
+func (p *IncrementalProcessor) secondLLMAnalysis(ctx context.Context, choices []SemanticChoiceItem) ([]map[string]interface{}, []SemanticItemFailure) {
+	return p.pdfProcessor.AnalyzeChoices(ctx, choices)
 }
 
-func (p *IncrementalProcessor) secondLLMAnalysis(ctx context.Context, choices []SemanticChoiceItem) ([]map[string]interface{}, error) {
-	// 复用现有的PDFLLMProcessor的SecondLLMAnalysis方法
-	processor := NewPDFLLMProcessor(p.config, p.db)
-	return processor.SecondLLMAnalysis(ctx, choices)
+// retryFailedChoices 只重试失败的条目，已成功的条目不会重复提交
+// 重试仍失败的条目被丢弃并记为回退失败，保持原状态；每条恢复的结果记录一次回退成功指标
+func (p *IncrementalProcessor) retryFailedChoices(ctx context.Context, failures []SemanticItemFailure) []map[string]interface{} {
+	if len(failures) == 0 || ctx.Err() != nil {
+		return nil
+	}
+
+	choices := make([]SemanticChoiceItem, len(failures))
+	for i, failure := range failures {
+		choices[i] = failure.Choice
+	}
+	recovered, stillFailed := p.secondLLMAnalysis(ctx, choices)
+	for range recovered {
+		p.metrics.RecordSuccess(metricsStageLLMSemanticFallback)
+	}
+	for _, failure := range stillFailed {
+		fmt.Printf("⚠️ [Step4-回退] Code=%s 重试仍失败: %v\n", failure.Choice.Code, failure.Err)
+		p.metrics.RecordError(metricsStageLLMSemanticFallback, failure.Err)
+	}
+	return recovered
 }
 
-func (p *IncrementalProcessor) prepareEnrichedData(categories []database.Category) []SemanticChoiceItem {
+func (p *IncrementalProcessor) prepareEnrichedData(categories []database.Category, hierarchy []database.Category) []SemanticChoiceItem {
+	names := make(map[string]string, len(hierarchy))
+	parents := make(map[string]string, len(hierarchy))
+	for _, cat := range hierarchy {
+		names[cat.Code] = cat.Name
+		parents[cat.Code] = cat.ParentCode
+	}
+
 	var choices []SemanticChoiceItem
 
 	for _, cat := range categories {
@@ -542,8 +836,8 @@ func (p *IncrementalProcessor) prepareEnrichedData(categories []database.Categor
 			}
 		}
 
-		// 设置父层级信息
-		choice.ParentHierarchy = cat.ParentCode
+		// 设置父层级信息：按配置的层数拼接祖先名称
+		choice.ParentHierarchy = buildParentHierarchy(cat.ParentCode, names, parents, p.parentDepth)
 
 		choices = append(choices, choice)
 	}
@@ -551,22 +845,130 @@ func (p *IncrementalProcessor) prepareEnrichedData(categories []database.Categor
 	return choices
 }
 
-func (p *IncrementalProcessor) batchUpdateCategoriesByCode(ctx context.Context, taskID string, updates []database.CategoryUpdate) error {
-	pgDB, ok := p.db.(*database.PostgreSQLDB)
-	if !ok {
-		return fmt.Errorf("数据库类型错误")
+// validateFinalNames 对已完成LLM增强的当前版本分类执行名称规则，修正或标记违规名称
+func (p *IncrementalProcessor) validateFinalNames(ctx context.Context, taskID string) error {
+	var categories []database.Category
+	err := p.db.WithContext(ctx).
+		Where("task_id = ? AND is_current = true AND llm_enhancements IS NOT NULL AND llm_enhancements != ''", taskID).
+		Find(&categories).Error
+	if err != nil {
+		return fmt.Errorf("获取待校验分类失败: %w", err)
+	}
+
+	validator := currentNameValidator()
+	var updates []database.CategoryUpdate
+	for _, cat := range categories {
+		if update, changed := applyNameRules(validator, cat); changed {
+			updates = append(updates, update)
+		}
+	}
+
+	fmt.Printf("🔍 [Step5-名称校验] 校验 %d 条，违规 %d 条\n", len(categories), len(updates))
+	if len(updates) == 0 {
+		return nil
+	}
+	return p.batchUpdateCategoriesByCode(ctx, taskID, updates)
+}
+
+// applyNameRules 校验单个分类名称，命中规则时返回需要写入的更新
+// 处理结果记录在 llm_enhancements 的 name_validation 字段中；被拒绝的名称依次尝试
+// LLM给出的备选名称和PDF名称，都不可用时保留原名称并标记待复核
+func applyNameRules(validator *NameValidator, cat database.Category) (database.CategoryUpdate, bool) {
+	result := validator.Validate(cat.Name)
+	if len(result.Violations) == 0 {
+		return database.CategoryUpdate{}, false
+	}
+
+	enhancements := make(map[string]interface{})
+	if cat.LLMEnhancements != "" {
+		if err := json.Unmarshal([]byte(cat.LLMEnhancements), &enhancements); err != nil {
+			enhancements = make(map[string]interface{})
+		}
 	}
 
+	validation := map[string]interface{}{
+		"original_name": cat.Name,
+		"violations":    result.Violations,
+	}
+
+	finalName := result.Name
+	action := "fixed"
+	if result.Name == strings.TrimSpace(cat.Name) {
+		action = "flagged"
+	}
+	if result.Rejected {
+		finalName = cat.Name
+		action = "needs_review"
+		for _, candidate := range nameCandidates(enhancements, cat.PDFInfo) {
+			if candidateResult := validator.Validate(candidate.name); !candidateResult.Rejected {
+				finalName = candidateResult.Name
+				action = "replaced"
+				validation["replaced_by"] = candidate.source
+				break
+			}
+		}
+	}
+	validation["action"] = action
+	validation["final_name"] = finalName
+	enhancements["name_validation"] = validation
+
+	enhancementsJSON, _ := json.Marshal(enhancements)
+	return database.CategoryUpdate{
+		Code: cat.Code,
+		Updates: map[string]interface{}{
+			"name":             finalName,
+			"llm_enhancements": string(enhancementsJSON),
+		},
+	}, true
+}
+
+// nameCandidate 被拒绝名称的候选替代
+type nameCandidate struct {
+	source string
+	name   string
+}
+
+// nameCandidates 按优先级收集候选名称：LLM备选名称、PDF名称
+func nameCandidates(enhancements map[string]interface{}, pdfInfo string) []nameCandidate {
+	var candidates []nameCandidate
+	if alt, ok := enhancements["alternative_name"].(string); ok && strings.TrimSpace(alt) != "" {
+		candidates = append(candidates, nameCandidate{source: "alternative_name", name: alt})
+	}
+	if pdfInfo != "" {
+		var info map[string]interface{}
+		if err := json.Unmarshal([]byte(pdfInfo), &info); err == nil {
+			if pdfName, ok := info["name"].(string); ok && strings.TrimSpace(pdfName) != "" {
+				candidates = append(candidates, nameCandidate{source: "pdf_name", name: pdfName})
+			}
+		}
+	}
+	return candidates
+}
+
+func (p *IncrementalProcessor) batchUpdateCategoriesByCode(ctx context.Context, taskID string, updates []database.CategoryUpdate) error {
 	fmt.Printf("  🔄 [批量更新-开始] 准备更新 %d 条记录\n", len(updates))
 
 	// 使用事务批量更新
-	tx := pgDB.GetDB().Begin()
+	tx := p.db.WithContext(ctx).Begin()
 	defer tx.Rollback()
 
+	currentStatus, err := p.currentCategoryStatus(tx, taskID, updates)
+	if err != nil {
+		return err
+	}
+
 	successCount := 0
 	for i, update := range updates {
+		// 拒绝非法的状态流转，例如未与PDF合并就标记为完成
+		if to, ok := update.Updates["status"].(string); ok {
+			if from, exists := currentStatus[update.Code]; exists && !database.CanTransition(from, to) {
+				fmt.Printf("    ⚠️ WARNING: 拒绝非法状态流转 Code=%s, %s -> %s\n", update.Code, from, to)
+				continue
+			}
+		}
+
 		result := tx.WithContext(ctx).Model(&database.Category{}).
-			Where("task_id = ? AND code = ?", taskID, update.Code).
+			Where("task_id = ? AND is_current = true AND code = ?", taskID, update.Code).
 			Updates(update.Updates)
 
 		if result.Error != nil {
@@ -594,27 +996,39 @@ func (p *IncrementalProcessor) batchUpdateCategoriesByCode(ctx context.Context,
 	return nil
 }
 
+// currentCategoryStatus 查询待更新编码的当前版本状态，仅在更新包含状态变更时查询
+func (p *IncrementalProcessor) currentCategoryStatus(tx *gorm.DB, taskID string, updates []database.CategoryUpdate) (map[string]string, error) {
+	var codes []string
+	for _, update := range updates {
+		if _, ok := update.Updates["status"]; ok {
+			codes = append(codes, update.Code)
+		}
+	}
+	statuses := make(map[string]string, len(codes))
+	if len(codes) == 0 {
+		return statuses, nil
+	}
+
+	var rows []database.Category
+	if err := tx.Select("code, status").
+		Where("task_id = ? AND is_current = true AND code IN ?", taskID, codes).
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("查询分类当前状态失败: %w", err)
+	}
+	for _, row := range rows {
+		statuses[row.Code] = row.Status
+	}
+	return statuses, nil
+}
+
 // updateBatchLLMResults 批量更新LLM分析结果到数据库
 func (p *IncrementalProcessor) updateBatchLLMResults(ctx context.Context, taskID string, results []map[string]interface{}) error {
 	var updates []database.CategoryUpdate
 
 	for _, item := range results {
-		code, ok := item["code"].(string)
-		if !ok || code == "" {
-			continue
+		if update, ok := p.llmResultUpdate(item); ok {
+			updates = append(updates, update)
 		}
-
-		// 序列化LLM增强信息
-		llmInfoJSON, _ := json.Marshal(item)
-
-		updates = append(updates, database.CategoryUpdate{
-			Code: code,
-			Updates: map[string]interface{}{
-				"status":           database.StatusCompleted,
-				"llm_enhancements": string(llmInfoJSON),
-				"name":             item["name"], // 如果LLM优化了name，也更新
-			},
-		})
 	}
 
 	if len(updates) == 0 {
@@ -629,3 +1043,8 @@ func (p *IncrementalProcessor) updateBatchLLMResults(ctx context.Context, taskID
 func (p *IncrementalProcessor) GetMetrics() ProcessingMetrics {
 	return p.metrics.GetMetrics()
 }
+
+// MetricsCollector 返回各步骤共享的指标收集器，用于定期导出指标快照
+func (p *IncrementalProcessor) MetricsCollector() MetricsCollector {
+	return p.metrics
+}
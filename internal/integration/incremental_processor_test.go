@@ -0,0 +1,389 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/clock"
+	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCancellationChecker 可控的取消检查器
+type fakeCancellationChecker struct {
+	cancelled map[string]bool
+	err       error
+}
+
+func (f *fakeCancellationChecker) IsCancelRequested(ctx context.Context, taskID string) (bool, error) {
+	return f.cancelled[taskID], f.err
+}
+
+// TestIncrementalProcessor_CheckCancelled 测试取消标记检查
+func TestIncrementalProcessor_CheckCancelled(t *testing.T) {
+	ctx := context.Background()
+	processor := &IncrementalProcessor{metrics: NewMetricsCollector()}
+
+	// 未设置检查器时不中止
+	assert.NoError(t, processor.checkCancelled(ctx, "task-1"))
+
+	processor.SetCancellationChecker(&fakeCancellationChecker{cancelled: map[string]bool{"task-1": true}})
+	assert.ErrorIs(t, processor.checkCancelled(ctx, "task-1"), ErrTaskCancelled)
+	assert.NoError(t, processor.checkCancelled(ctx, "task-2"))
+
+	// 检查失败时继续处理
+	processor.SetCancellationChecker(&fakeCancellationChecker{err: errors.New("redis unavailable")})
+	assert.NoError(t, processor.checkCancelled(ctx, "task-1"))
+}
+
+// TestIncrementalProcessor_CancelledBeforeStart 测试已取消的任务不会写入任何数据
+func TestIncrementalProcessor_CancelledBeforeStart(t *testing.T) {
+	processor := &IncrementalProcessor{metrics: NewMetricsCollector()}
+	processor.SetCancellationChecker(&fakeCancellationChecker{cancelled: map[string]bool{"task-1": true}})
+
+	// db 为 nil，若流程未在步骤1前中止会直接失败
+	err := processor.ProcessIncrementalFlow(context.Background(), "task-1", "input.xlsx", nil)
+	assert.ErrorIs(t, err, ErrTaskCancelled)
+}
+
+// TestIncrementalProcessor_RunStepTimeout 测试步骤超时后立即失败并记录指标，即使步骤不响应context取消
+func TestIncrementalProcessor_RunStepTimeout(t *testing.T) {
+	processor := &IncrementalProcessor{metrics: NewMetricsCollector()}
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	defer close(release)
+	err := processor.runStep(ctx, "task-1", "步骤2", 20*time.Millisecond, func(ctx context.Context) error {
+		<-release // 模拟卡住且不检查context的步骤
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrStepTimeout)
+	assert.Contains(t, err.Error(), "步骤2")
+	assert.Len(t, processor.GetMetrics().StageMetrics[metricsStageStepTimeout].Errors, 1)
+
+	// 未超时的步骤返回自身的结果，步骤内部可以看到超时context
+	stepErr := errors.New("merge failed")
+	err = processor.runStep(ctx, "task-1", "步骤3", time.Minute, func(ctx context.Context) error {
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+		return stepErr
+	})
+	assert.Equal(t, stepErr, err)
+
+	// 超时为0时不设置超时；外层context取消时返回取消错误而不是超时
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = processor.runStep(cancelled, "task-1", "步骤4", 0, func(ctx context.Context) error {
+		_, hasDeadline := ctx.Deadline()
+		assert.False(t, hasDeadline)
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, processor.GetMetrics().StageMetrics[metricsStageStepTimeout].Errors, 1)
+}
+
+// TestIncrementalProcessor_RunStepTimeoutUsesClock 测试步骤超时由注入的时钟判定，推进假时钟即可触发
+func TestIncrementalProcessor_RunStepTimeoutUsesClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	processor := &IncrementalProcessor{metrics: NewMetricsCollector()}
+	processor.SetClock(fake)
+
+	release := make(chan struct{})
+	defer close(release)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- processor.runStep(context.Background(), "task-1", "步骤4", 30*time.Minute, func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(30*time.Minute - time.Second)
+	assert.Equal(t, 1, fake.Waiters())
+	fake.Advance(time.Second)
+
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, ErrStepTimeout)
+		assert.Contains(t, err.Error(), "步骤4")
+	case <-time.After(5 * time.Second):
+		t.Fatal("推进时钟后步骤没有超时")
+	}
+	assert.Len(t, processor.GetMetrics().StageMetrics[metricsStageStepTimeout].Errors, 1)
+}
+
+// TestGetStepTimeoutConfig 测试步骤超时的默认值和环境变量覆盖
+func TestGetStepTimeoutConfig(t *testing.T) {
+	t.Setenv("STEP_TIMEOUT_LLM_ENHANCE", "45m")
+	t.Setenv("STEP_TIMEOUT_MERGE", "0")
+	t.Setenv("STEP_TIMEOUT_PDF_CLEANING", "invalid")
+
+	stepTimeouts := getStepTimeoutConfig()
+	defaults := defaultStepTimeoutConfig()
+	assert.Equal(t, 45*time.Minute, stepTimeouts.LLMEnhance)
+	assert.Equal(t, time.Duration(0), stepTimeouts.Merge)
+	assert.Equal(t, defaults.PDFCleaning, stepTimeouts.PDFCleaning)
+	assert.Equal(t, defaults.ExcelSave, stepTimeouts.ExcelSave)
+}
+
+// TestNewIncrementalProcessor_SharesPDFProcessor 测试各步骤复用同一个PDFLLMProcessor及其HTTP客户端和指标收集器
+func TestNewIncrementalProcessor_SharesPDFProcessor(t *testing.T) {
+	processor := NewIncrementalProcessor(&config.Config{}, nil)
+	require.NotNil(t, processor.pdfProcessor)
+	assert.Same(t, processor.metrics, processor.pdfProcessor.metrics)
+	assert.NotNil(t, processor.pdfProcessor.httpClient)
+}
+
+// TestIncrementalProcessor_RetryFailedChoices 测试只重试失败的条目，已成功的条目不重复提交，重试仍失败的条目计为回退失败
+func TestIncrementalProcessor_RetryFailedChoices(t *testing.T) {
+	// broken 中的编码始终返回无法解析的结果，flaky 中的编码仅第一次返回无法解析的结果
+	broken := map[string]bool{"1-01-01-04": true}
+	flaky := map[string]bool{"1-01-01-01": true}
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	llmService := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		code := promptField(req.Prompt, "编码:")
+		mu.Lock()
+		attempts[code]++
+		attempt := attempts[code]
+		mu.Unlock()
+		if broken[code] || (flaky[code] && attempt == 1) {
+			return LLMTaskStatus{Status: "completed", Result: "无法解析的输出"}
+		}
+		return LLMTaskStatus{Status: "completed", Result: map[string]interface{}{"code": code, "name": "名称" + code}}
+	})
+	t.Setenv("LLM_SERVICE_URL", llmService.Host())
+	processor := NewIncrementalProcessor(&config.Config{}, nil)
+	ctx := context.Background()
+
+	batch := []SemanticChoiceItem{
+		{Code: "1-01-01-01", RuleName: "甲"},
+		{Code: "1-01-01-02", RuleName: "乙"},
+		{Code: "1-01-01-03", RuleName: "丙"},
+		{Code: "1-01-01-04", RuleName: "丁"},
+	}
+	// 失败条目未超过半数时也不以规则名称填充默认结果
+	results, failures := processor.secondLLMAnalysis(ctx, batch)
+	require.Len(t, results, 2)
+	require.Len(t, failures, 2)
+	assert.Equal(t, "1-01-01-01", failures[0].Choice.Code)
+	assert.Equal(t, "1-01-01-04", failures[1].Choice.Code)
+
+	recovered := processor.retryFailedChoices(ctx, failures)
+	require.Len(t, recovered, 1)
+	assert.Equal(t, "1-01-01-01", recovered[0]["code"])
+
+	mu.Lock()
+	assert.Equal(t, map[string]int{"1-01-01-01": 2, "1-01-01-02": 1, "1-01-01-03": 1, "1-01-01-04": 2}, attempts,
+		"已成功的条目不应重复提交")
+	mu.Unlock()
+
+	fallback := processor.metrics.GetMetrics().StageMetrics[metricsStageLLMSemanticFallback]
+	assert.Equal(t, int64(2), fallback.Count)
+	assert.Len(t, fallback.Errors, 1, "重试仍失败的条目计为回退失败")
+}
+
+// TestIncrementalProcessor_EndToEnd 使用模拟的PDF验证服务、LLM服务和内存数据库执行完整的5步流程
+func TestIncrementalProcessor_EndToEnd(t *testing.T) {
+	// PDF解析出的名称带有空格，由第一轮LLM清洗；4-01-01-01 不在Excel中
+	pdfNames := map[string]string{
+		"1-01-01-01": "焊 工",
+		"1-01-01-02": "钳工 ",
+		"2-02-01-01": "中学 教师",
+		"4-01-01-01": "仅PDF职业",
+	}
+	var occupationCodes []map[string]interface{}
+	for _, code := range []string{"1-01-01-01", "1-01-01-02", "2-02-01-01", "4-01-01-01"} {
+		occupationCodes = append(occupationCodes, map[string]interface{}{
+			"code": code, "name": pdfNames[code], "page": 1, "confidence": 0.9,
+		})
+	}
+	pdfService := newFakePDFValidator(t, occupationCodes)
+
+	llmService := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		// 第二轮语义选择：优先PDF名称，结果以对象形式返回；1-01-01-02 的名称带末尾标点，由步骤5修正
+		if code := promptField(req.Prompt, "编码:"); code != "" {
+			name := promptField(req.Prompt, "选项2:")
+			if name == "" {
+				name = promptField(req.Prompt, "选项1:")
+			}
+			if code == "1-01-01-02" {
+				name += "。"
+			}
+			return LLMTaskStatus{Status: "completed", Result: map[string]interface{}{"code": code, "name": name}}
+		}
+
+		// 第一轮分组清洗：去掉名称中的空格；大类1返回markdown包裹的wrapper格式，其余返回JSON数组
+		var items []map[string]interface{}
+		for code, name := range pdfNames {
+			if strings.Contains(req.Prompt, `"`+code+`"`) {
+				items = append(items, map[string]interface{}{"code": code, "name": strings.ReplaceAll(strings.TrimSpace(name), " ", "")})
+			}
+		}
+		if strings.Contains(req.Prompt, `"1-01-01-01"`) {
+			wrapped, _ := json.Marshal(map[string]interface{}{"items": items})
+			return LLMTaskStatus{Status: "completed", Result: "```json\n" + string(wrapped) + "\n```"}
+		}
+		array, _ := json.Marshal(items)
+		return LLMTaskStatus{Status: "completed", Result: string(array)}
+	})
+
+	pdfPath := filepath.Join(t.TempDir(), "sample.pdf")
+	require.NoError(t, os.WriteFile(pdfPath, []byte("%PDF-1.4 fake"), 0o644))
+	t.Setenv("PDF_TEST_FILE_PATH", pdfPath)
+	t.Setenv("PDF_VALIDATOR_URL", pdfService.Host())
+	t.Setenv("LLM_SERVICE_URL", llmService.Host())
+
+	db := newTestCategoryDB(t)
+	processor := NewIncrementalProcessor(&config.Config{}, db)
+
+	categories := []*model.Category{
+		{Code: "1-01-01-01", Name: "焊工", Level: "细类"},
+		{Code: "1-01-01-02", Name: "钳工", Level: "细类"},
+		{Code: "2-02-01-01", Name: "中学教师", Level: "细类"},
+		{Code: "3-01-01-01", Name: "邮政营业员", Level: "细类"},
+	}
+	taskID := "6f1c1d7e-3b7a-4c53-9a55-0d6a1f0e2b11"
+	require.NoError(t, processor.ProcessIncrementalFlow(context.Background(), taskID, "input.xlsx", categories))
+
+	assert.Equal(t, int32(1), pdfService.Uploads())
+	assert.Equal(t, "sample.pdf", pdfService.UploadedFile())
+
+	var semanticRequests int
+	for _, req := range llmService.Requests() {
+		if promptField(req.Prompt, "编码:") != "" {
+			semanticRequests++
+		}
+	}
+	assert.Equal(t, 3, semanticRequests, "只有与PDF合并成功的分类进入第二轮")
+
+	var rows []database.Category
+	require.NoError(t, db.GetDB().Where("task_id = ? AND is_current = true", taskID).Order("code").Find(&rows).Error)
+	require.Len(t, rows, 4)
+	byCode := make(map[string]database.Category)
+	for _, row := range rows {
+		byCode[row.Code] = row
+	}
+
+	for code, expectedName := range map[string]string{"1-01-01-01": "焊工", "1-01-01-02": "钳工", "2-02-01-01": "中学教师"} {
+		row := byCode[code]
+		assert.Equal(t, database.StatusCompleted, row.Status, code)
+		assert.Equal(t, database.DataSourceMerged, row.DataSource, code)
+		assert.Equal(t, expectedName, row.Name, code)
+
+		var pdfInfo map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(row.PDFInfo), &pdfInfo), code)
+		assert.Equal(t, expectedName, pdfInfo["name"], "PDF信息应为清洗后的名称: %s", code)
+
+		var enhancements map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(row.LLMEnhancements), &enhancements), code)
+		assert.Equal(t, code, enhancements["code"])
+	}
+
+	var enhancements map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(byCode["1-01-01-02"].LLMEnhancements), &enhancements))
+	validation, ok := enhancements["name_validation"].(map[string]interface{})
+	require.True(t, ok, "末尾标点应由名称规则处理")
+	assert.Equal(t, "钳工。", validation["original_name"])
+	assert.Equal(t, "fixed", validation["action"])
+
+	unmatched := byCode["3-01-01-01"]
+	assert.Equal(t, database.StatusExcelParsed, unmatched.Status)
+	assert.Equal(t, "邮政营业员", unmatched.Name)
+	assert.Empty(t, unmatched.PDFInfo)
+	assert.Empty(t, unmatched.LLMEnhancements)
+
+	extraction, err := db.GetPDFExtraction(context.Background(), taskID)
+	require.NoError(t, err)
+	assert.Equal(t, fakePDFTaskID, extraction.PDFTaskID)
+	var rawCodes []map[string]interface{}
+	require.NoError(t, json.Unmarshal(extraction.OccupationCodes, &rawCodes))
+	assert.Len(t, rawCodes, extraction.TotalFound)
+	assert.NotEmpty(t, extraction.CleanedCodes, "应保存清洗后的数据")
+	assert.Greater(t, extraction.CleanedCount, 0)
+
+	snapshot := processor.GetMetrics()
+	assert.Equal(t, int64(0), snapshot.ErrorCount)
+}
+
+// TestIncrementalProcessor_RejectsIllegalStatusTransition 测试批量更新拒绝跳过流程的状态流转
+func TestIncrementalProcessor_RejectsIllegalStatusTransition(t *testing.T) {
+	db := newTestCategoryDB(t)
+	processor := NewIncrementalProcessor(&config.Config{}, db)
+	ctx := context.Background()
+	taskID := "3d5e7f90-1a2b-4c3d-8e9f-0a1b2c3d4e5f"
+
+	require.NoError(t, db.BatchInsertCategoriesWithVersion(ctx, taskID, "9a8b7c6d-5e4f-4a3b-9c2d-1e0f9a8b7c6d", []*database.Category{
+		{TaskID: taskID, Code: "1-01-01-01", Name: "焊工", Level: "细类", Status: database.StatusExcelParsed, DataSource: database.DataSourceExcel},
+		{TaskID: taskID, Code: "1-01-01-02", Name: "钳工", Level: "细类", Status: database.StatusExcelParsed, DataSource: database.DataSourceExcel},
+	}))
+
+	require.NoError(t, processor.batchUpdateCategoriesByCode(ctx, taskID, []database.CategoryUpdate{
+		{Code: "1-01-01-01", Updates: map[string]interface{}{"status": database.StatusLLMEnhanced, "name": "非法更新"}},
+		{Code: "1-01-01-02", Updates: map[string]interface{}{"status": database.StatusPDFMerged}},
+	}))
+
+	var rows []database.Category
+	require.NoError(t, db.GetDB().Where("task_id = ?", taskID).Order("code").Find(&rows).Error)
+	require.Len(t, rows, 2)
+	assert.Equal(t, database.StatusExcelParsed, rows[0].Status)
+	assert.Equal(t, "焊工", rows[0].Name, "被拒绝的更新不写入任何字段")
+	assert.Equal(t, database.StatusPDFMerged, rows[1].Status)
+
+	assert.True(t, database.CanTransition(database.StatusPDFMerged, database.StatusCompleted))
+	assert.True(t, database.CanTransition(database.StatusExcelParsed, database.StatusCompleted), "没有PDF数据时Excel结果可直接完成")
+	assert.True(t, database.CanTransition(database.StatusCompleted, database.StatusCompleted))
+	assert.False(t, database.CanTransition(database.StatusCompleted, database.StatusExcelParsed))
+}
+
+// TestIncrementalProcessor_Step1ReusesIdenticalVersion 测试步骤1复用 worker 已写入或重试前内容相同的当前版本，且不重置已有结果
+func TestIncrementalProcessor_Step1ReusesIdenticalVersion(t *testing.T) {
+	db := newTestCategoryDB(t)
+	processor := NewIncrementalProcessor(&config.Config{}, db)
+	ctx := context.Background()
+	taskID := "4e6f8a0b-2c3d-4e5f-9a0b-1c2d3e4f5a6b"
+	categories := []*model.Category{
+		{Code: "1-01-01-01", Name: "焊工", Level: "细类"},
+		{Code: "1-01-01-02", Name: "钳工", Level: "细类"},
+	}
+
+	// worker 先按相同策略写入层级结构，步骤1不应再产生新版本
+	flat, _ := model.FlattenWithPolicy(categories, model.DedupComplete)
+	_, written, err := database.SaveFlatCategoryVersion(ctx, db, taskID, "5f7a9b1c-3d4e-4f6a-8b1c-2d3e4f5a6b7c", flat, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, written)
+
+	require.NoError(t, processor.step1SaveExcelData(ctx, taskID, categories))
+	require.NoError(t, db.GetDB().Model(&database.Category{}).
+		Where("task_id = ? AND code = ?", taskID, "1-01-01-01").
+		Updates(map[string]interface{}{"status": database.StatusPDFMerged, "pdf_info": `{"name":"焊工"}`}).Error)
+
+	require.NoError(t, processor.step1SaveExcelData(ctx, taskID, categories))
+
+	versions, err := db.GetCategoryVersionHistory(ctx, taskID)
+	require.NoError(t, err)
+	require.Len(t, versions, 1, "内容相同的重试不应产生新版本")
+
+	current, err := db.GetCurrentCategoriesByTaskID(ctx, taskID)
+	require.NoError(t, err)
+	require.Len(t, current, 2)
+	assert.Equal(t, database.StatusPDFMerged, current[0].Status, "复用版本时保留已有处理状态")
+	assert.Equal(t, `{"name":"焊工"}`, current[0].PDFInfo)
+
+	categories[1].Name = "钳工（装配）"
+	require.NoError(t, processor.step1SaveExcelData(ctx, taskID, categories))
+	versions, err = db.GetCategoryVersionHistory(ctx, taskID)
+	require.NoError(t, err)
+	assert.Len(t, versions, 2, "内容变化时创建新版本")
+}
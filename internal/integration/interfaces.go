@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/freedkr/moonshot/internal/httpx"
 	"github.com/freedkr/moonshot/internal/model"
 )
 
@@ -41,9 +42,22 @@ type MetricsCollector interface {
 	RecordSuccess(stage string)
 	RecordError(stage string, err error)
 	GetMetrics() ProcessingMetrics
+	// StageTotals 只复制各阶段的累计计数，开销远小于 GetMetrics，供定期导出快照使用
+	StageTotals() map[string]StageTotals
 	Reset()
 }
 
+// CancellationChecker 任务取消检查接口
+type CancellationChecker interface {
+	IsCancelRequested(ctx context.Context, taskID string) (bool, error)
+}
+
+// TaskLocker 任务处理锁接口，保证同一任务的增量流程和补充增强不会同时执行
+type TaskLocker interface {
+	AcquireTaskLock(ctx context.Context, taskID string, owner string, ttl time.Duration) (bool, error)
+	ReleaseTaskLock(ctx context.Context, taskID string, owner string) error
+}
+
 // ===== 数据模型定义 =====
 
 // ProcessingConfig 处理配置
@@ -66,6 +80,38 @@ type ProcessingConfig struct {
 	} `yaml:"test_data"`
 	
 	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+
+	HTTP httpx.Config `yaml:"http"`
+
+	Prompts struct {
+		TemplatesDir         string `yaml:"templates_dir"`
+		ParentHierarchyDepth int    `yaml:"parent_hierarchy_depth"` // 语义选择提示词中包含的祖先层数，0 表示不包含
+	} `yaml:"prompts"`
+
+	Validation struct {
+		NameRulesFile string  `yaml:"name_rules_file"`
+		MinConfidence float64 `yaml:"min_confidence"` // 低于该置信度的语义选择结果不覆盖名称，0 表示不过滤
+	} `yaml:"validation"`
+
+	Merge struct {
+		DedupPDFCodes bool `yaml:"dedup_pdf_codes"` // 融合前同一编码只保留置信度最高的PDF条目
+	} `yaml:"merge"`
+
+	PDFReplay struct {
+		ReuseStoredResult bool `yaml:"reuse_stored_result"` // 重新处理时复用已保存的PDF提取结果，任务配置 force_pdf 时仍重新调用
+	} `yaml:"pdf_replay"`
+
+	Degradation struct {
+		RuleOnlyOnLLMFailure bool `yaml:"rule_only_on_llm_failure"` // LLM不可用时以规则解析结果完成任务，结果中标记 llm_skipped
+	} `yaml:"degradation"`
+
+	Enrichment struct {
+		Levels []string `yaml:"levels"` // 参与第二轮LLM增强的层级，默认只有细类，为空时所有层级都参与
+	} `yaml:"enrichment"`
+
+	Health HealthGateConfig `yaml:"health"`
+
+	StepTimeouts StepTimeoutConfig `yaml:"step_timeouts"`
 }
 
 // PDFServiceConfig PDF服务配置
@@ -78,10 +124,13 @@ type PDFServiceConfig struct {
 
 // LLMServiceConfig LLM服务配置
 type LLMServiceConfig struct {
-	BaseURL     string        `yaml:"base_url"`
-	Timeout     time.Duration `yaml:"timeout"`
-	MaxRetries  int           `yaml:"max_retries"`
-	TaskTypes   []string      `yaml:"task_types"`
+	BaseURL       string        `yaml:"base_url"`
+	Timeout       time.Duration `yaml:"timeout"`
+	MaxRetries    int           `yaml:"max_retries"`    // 最大尝试次数
+	BaseBackoff   time.Duration `yaml:"base_backoff"`   // 第n次重试前等待 base_backoff*n²
+	MaxBackoff    time.Duration `yaml:"max_backoff"`    // 单次等待上限
+	BackoffJitter float64       `yaml:"backoff_jitter"` // 等待时间的随机抖动比例，0.2 表示 ±20%
+	TaskTypes     []string      `yaml:"task_types"`
 }
 
 // PDFValidationRequest PDF验证请求
@@ -100,6 +149,7 @@ type PDFResult struct {
 	OccupationCodes []PDFOccupationCode    `json:"occupation_codes"`
 	ProcessedAt     time.Time              `json:"processed_at"`
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+	Raw             map[string]interface{} `json:"-"` // PDF服务的原始返回，用于保存审计记录
 }
 
 // PDFOccupationCode PDF提取的职业编码
@@ -243,6 +293,14 @@ type StageMetrics struct {
 	Errors      []string      `json:"errors,omitempty"`
 }
 
+// StageTotals 阶段的累计计数，导出快照时用两次读取的差值计算区间指标
+type StageTotals struct {
+	DurationCount int64         // 记录时长的次数
+	TotalDuration time.Duration // 记录时长的累计值
+	SuccessCount  int64
+	ErrorCount    int64
+}
+
 // ActivityRecord 活动记录
 type ActivityRecord struct {
 	Timestamp time.Time `json:"timestamp"`
@@ -0,0 +1,43 @@
+package integration
+
+import "context"
+
+// 提交LLM任务时写入 metadata 的关联字段，与 llm-service 的 models.MetadataParentTaskID/MetadataStep 一致
+const (
+	llmMetadataParentTaskID = "parent_task_id"
+	llmMetadataStep         = "step"
+)
+
+// 发起LLM调用的处理步骤，与 StepTimeoutConfig 的配置项名称一致
+const (
+	llmStepPDFCleaning   = "pdf_cleaning"
+	llmStepLLMEnhance    = "llm_enhance"
+	llmStepEnrichMissing = "enrich_missing"
+)
+
+type llmCorrelationKey struct{}
+
+// llmCorrelation 当前处理的上游任务和步骤
+type llmCorrelation struct {
+	taskID string
+	step   string
+}
+
+// withLLMCorrelation 在context中记录上游任务ID和步骤，之后提交的LLM任务会在 metadata 中携带这两个字段，
+// 可以通过 llm-service 的 GET /api/v1/tasks?parent_task_id= 查到某次上传触发的全部LLM任务
+func withLLMCorrelation(ctx context.Context, taskID string, step string) context.Context {
+	return context.WithValue(ctx, llmCorrelationKey{}, llmCorrelation{taskID: taskID, step: step})
+}
+
+// llmMetadataFromContext 返回提交LLM任务时携带的 metadata，context中没有关联信息时返回 nil
+func llmMetadataFromContext(ctx context.Context) map[string]interface{} {
+	correlation, ok := ctx.Value(llmCorrelationKey{}).(llmCorrelation)
+	if !ok || correlation.taskID == "" {
+		return nil
+	}
+	metadata := map[string]interface{}{llmMetadataParentTaskID: correlation.taskID}
+	if correlation.step != "" {
+		metadata[llmMetadataStep] = correlation.step
+	}
+	return metadata
+}
@@ -0,0 +1,88 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"gorm.io/gorm"
+)
+
+// 规则降级完成时写入任务结果的字段
+const (
+	LLMSkippedKey       = "llm_skipped"        // 未调用LLM，任务以规则解析结果完成
+	LLMSkippedReasonKey = "llm_skipped_reason" // 跳过LLM的原因
+)
+
+// llmFailure 标记重试后仍失败的LLM调用，流程据此判断能否降级为规则解析结果
+type llmFailure struct {
+	err error
+}
+
+func (e *llmFailure) Error() string {
+	return e.err.Error()
+}
+
+func (e *llmFailure) Unwrap() error {
+	return e.err
+}
+
+// isLLMFailure 判断错误是否由LLM调用失败引起
+func isLLMFailure(err error) bool {
+	var failure *llmFailure
+	return errors.As(err, &failure)
+}
+
+// SetRuleOnlyFallback 设置LLM不可用时是否以规则解析结果完成任务
+func (p *IncrementalProcessor) SetRuleOnlyFallback(enabled bool) {
+	p.ruleOnlyFallback = enabled
+}
+
+// getRuleOnlyFallback 获取LLM不可用时是否以规则解析结果完成任务，默认关闭
+func getRuleOnlyFallback() bool {
+	if v := os.Getenv("LLM_RULE_ONLY_FALLBACK"); v != "" {
+		if enabled, err := strconv.ParseBool(v); err == nil {
+			return enabled
+		}
+	}
+	return false
+}
+
+// completeWithRules LLM不可用或任务选择仅规则增强时以规则解析结果完成任务：Excel解析状态的当前版本分类直接标记为 completed，
+// 数据来源记为 excel；任务标记为 completed，结果中记录 llm_skipped 和跳过原因。
+// 只更新 excel_parsed 状态的分类，excel_parsed → completed 是允许的状态流转，以一条条件更新完成，不逐条经过 batchUpdateCategoriesByCode
+func (p *IncrementalProcessor) completeWithRules(ctx context.Context, taskID string, cause error) error {
+	var promoted int64
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.Category{}).
+			Where("task_id = ? AND is_current = true AND status = ?", taskID, database.StatusExcelParsed).
+			Updates(map[string]interface{}{
+				"status":      database.StatusCompleted,
+				"data_source": database.DataSourceExcel,
+				"updated_at":  time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("更新分类状态失败: %w", result.Error)
+		}
+		promoted = result.RowsAffected
+
+		return p.mergeTaskResult(tx, taskID, "completed", map[string]interface{}{
+			LLMSkippedKey:       true,
+			LLMSkippedReasonKey: cause.Error(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("规则降级完成失败: %w", err)
+	}
+	if err := p.applyManualOverrides(ctx, taskID, "规则降级"); err != nil {
+		fmt.Printf("❌ [规则降级-人工修正失败] 错误: %v\n", err)
+	}
+
+	p.metrics.RecordSuccess("rule_only_fallback")
+	fmt.Printf("⚠️ [规则降级] 任务以规则解析结果完成 - taskID: %s, 分类数: %d, 原因: %v\n", taskID, promoted, cause)
+	return nil
+}
@@ -0,0 +1,88 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// TestIncrementalProcessor_RuleOnlyFallback 测试LLM不可用时按配置失败或以规则解析结果完成任务
+func TestIncrementalProcessor_RuleOnlyFallback(t *testing.T) {
+	llmService := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		return LLMTaskStatus{Status: "failed", Error: "model unavailable"}
+	})
+	t.Setenv("LLM_SERVICE_URL", llmService.Host())
+	t.Setenv("PDF_VALIDATOR_URL", "127.0.0.1:1")
+	t.Setenv("LLM_MAX_RETRIES", "1")
+	t.Setenv("LLM_RETRY_BASE_BACKOFF", "1ms")
+
+	categories := []*model.Category{
+		{Code: "1-01-01-01", Name: "焊工", Level: "细类"},
+		{Code: "1-01-01-02", Name: "钳工", Level: "细类"},
+	}
+	ctx := context.Background()
+	run := func(t *testing.T, fallback bool) (*database.SQLiteDB, string, error) {
+		db := newTestCategoryDB(t)
+		taskID := "8c0e2a4b-6d8f-4b0c-9e2a-4b6d8f0c2e4a"
+		require.NoError(t, db.CreateTask(ctx, &database.TaskRecord{
+			ID: taskID, Type: "rule", Status: "completed",
+			Config: datatypes.JSON(`{}`), Result: datatypes.JSON(`{"message":"Hierarchy saved to database"}`),
+		}))
+		// 预先保存PDF提取结果，步骤2复用而不调用PDF服务，只有LLM不可用
+		require.NoError(t, db.SavePDFExtraction(ctx, &database.PDFExtraction{
+			TaskID: taskID, TotalFound: 2,
+			OccupationCodes: datatypes.JSON(`[{"code":"1-01-01-01","name":"焊 工"},{"code":"1-01-01-02","name":"钳工"}]`),
+		}))
+
+		processor := NewIncrementalProcessor(&config.Config{}, db)
+		processor.SetRuleOnlyFallback(fallback)
+		return db, taskID, processor.ProcessIncrementalFlow(ctx, taskID, "input.xlsx", categories)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		db, taskID, err := run(t, false)
+		require.Error(t, err)
+		assert.True(t, isLLMFailure(err))
+
+		var parsed int64
+		require.NoError(t, db.GetDB().Model(&database.Category{}).
+			Where("task_id = ? AND status = ?", taskID, database.StatusExcelParsed).Count(&parsed).Error)
+		assert.Equal(t, int64(2), parsed, "未开启降级时分类保持Excel解析状态")
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		db, taskID, err := run(t, true)
+		require.NoError(t, err)
+
+		var rows []database.Category
+		require.NoError(t, db.GetDB().Where("task_id = ? AND is_current = true", taskID).Order("code").Find(&rows).Error)
+		require.Len(t, rows, 2)
+		for _, row := range rows {
+			assert.Equal(t, database.StatusCompleted, row.Status, row.Code)
+			assert.Equal(t, database.DataSourceExcel, row.DataSource, row.Code)
+		}
+		assert.Equal(t, "焊工", rows[0].Name, "名称使用规则解析结果")
+
+		task, err := db.GetTask(ctx, taskID)
+		require.NoError(t, err)
+		assert.Equal(t, "completed", task.Status)
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(task.Result, &result))
+		assert.Equal(t, true, result[LLMSkippedKey])
+		assert.Contains(t, result[LLMSkippedReasonKey], "第一轮LLM分析失败")
+		assert.Equal(t, "Hierarchy saved to database", result["message"], "保留结果中的原有字段")
+
+		report, ok := result[ProcessingReportKey].(map[string]interface{})
+		require.True(t, ok, "降级完成时同样生成处理报告")
+		assert.Equal(t, true, report["llm_skipped"])
+		assert.Equal(t, float64(2), report["total_codes"])
+		assert.Equal(t, float64(2), report["rule_fallback"])
+	})
+}
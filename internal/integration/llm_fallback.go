@@ -0,0 +1,131 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// 直连提供商兜底的默认参数，接口地址和模型没有默认值，必须显式配置
+const (
+	defaultFallbackProvider   = "direct"
+	defaultFallbackTimeout    = 300 * time.Second
+	defaultFallbackMaxTokens  = 30000
+	fallbackDeterministicSeed = 42
+)
+
+// LLMFallbackConfig LLM服务不可用时直连提供商的兜底配置，默认关闭
+type LLMFallbackConfig struct {
+	Enabled  bool
+	Provider string // 日志和错误信息中显示的提供商名称
+	BaseURL  string // OpenAI 兼容接口地址，必填
+	APIKey   string
+	Model    string // 必填
+	Timeout  time.Duration
+}
+
+// directLLMProvider 绕过 llm-service 直接调用提供商的 chat/completions 接口
+// 只在 llm-service 重试耗尽后使用，不经过服务端的调度和限流
+type directLLMProvider struct {
+	config     LLMFallbackConfig
+	httpClient *http.Client
+}
+
+// newDirectLLMProvider 创建直连提供商，未启用或缺少API Key、接口地址、模型时返回 nil
+func newDirectLLMProvider(cfg LLMFallbackConfig) *directLLMProvider {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.APIKey == "" || cfg.BaseURL == "" || cfg.Model == "" {
+		fmt.Printf("⚠️ 已启用LLM直连兜底但未配置API Key、接口地址或模型，兜底不可用\n")
+		return nil
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = defaultFallbackProvider
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultFallbackTimeout
+	}
+	return &directLLMProvider{
+		config:     cfg,
+		httpClient: newServiceHTTPClient(getHTTPClientConfig(), cfg.Timeout),
+	}
+}
+
+type chatCompletionMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionRequest struct {
+	Model          string                  `json:"model"`
+	Messages       []chatCompletionMessage `json:"messages"`
+	ResponseFormat map[string]string       `json:"response_format,omitempty"`
+	Temperature    float64                 `json:"temperature"`
+	MaxTokens      int                     `json:"max_tokens,omitempty"`
+	Seed           *int                    `json:"seed,omitempty"`
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message      chatCompletionMessage `json:"message"`
+		FinishReason string                `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// Complete 发送单轮提示词并返回模型输出的原始内容，输出格式与 llm-service 返回的结果一致
+func (d *directLLMProvider) Complete(ctx context.Context, taskType string, prompt string) (string, error) {
+	reqBody := chatCompletionRequest{
+		Model:          d.config.Model,
+		Messages:       []chatCompletionMessage{{Role: "user", Content: prompt}},
+		ResponseFormat: map[string]string{"type": "json_object"},
+		Temperature:    0.1,
+		MaxTokens:      defaultFallbackMaxTokens,
+	}
+	if getLLMDeterministic() {
+		seed := fallbackDeterministicSeed
+		reqBody.Temperature = 0
+		reqBody.Seed = &seed
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.config.BaseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+d.config.APIKey)
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("调用%s失败: %w", d.config.Provider, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取%s响应失败: %w", d.config.Provider, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &LLMServiceError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var completion chatCompletionResponse
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return "", fmt.Errorf("解析%s响应失败: %w", d.config.Provider, err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("%s响应中没有结果 (taskType: %s)", d.config.Provider, taskType)
+	}
+	if completion.Choices[0].FinishReason == "length" {
+		return "", ErrLLMResultTruncated
+	}
+	return completion.Choices[0].Message.Content, nil
+}
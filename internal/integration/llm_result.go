@@ -0,0 +1,38 @@
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrLLMMalformedResult LLM返回了内容但无法解析为约定的JSON，属于协议错误
+// 与有效的空结果区分：空结果表示LLM正常结束且没有找到任何条目
+var ErrLLMMalformedResult = errors.New("LLM结果格式无效")
+
+// isEmptyLLMResult 判断提取后的JSON是否为有效的空结果：空内容、[]、{} 或 null
+func isEmptyLLMResult(content string) bool {
+	switch strings.Join(strings.Fields(content), "") {
+	case "", "[]", "{}", "null":
+		return true
+	}
+	return false
+}
+
+// completedLLMResult 将已完成任务状态中的 result 转换为字符串，result 缺失时返回空字符串
+func completedLLMResult(result interface{}) (string, error) {
+	switch v := result.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return strings.TrimSpace(v), nil
+	default:
+		// 兼容结果不是字符串的情况
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("结果序列化失败: %w", err)
+		}
+		return string(data), nil
+	}
+}
@@ -0,0 +1,67 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLLMServiceClient_EmptyResult 测试LLM正常结束但没有找到条目时按空结果成功返回，
+// 无法解析的内容和被截断的输出仍作为错误返回
+func TestLLMServiceClient_EmptyResult(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  LLMTaskStatus
+		wantErr error
+	}{
+		{name: "empty array", status: LLMTaskStatus{Status: "completed", Result: "[]"}},
+		{name: "markdown empty array", status: LLMTaskStatus{Status: "completed", Result: "```json\n[ ]\n```"}},
+		{name: "no content", status: LLMTaskStatus{Status: "completed", Result: ""}},
+		{name: "garbage", status: LLMTaskStatus{Status: "completed", Result: "抱歉，我无法处理该请求"}, wantErr: ErrLLMMalformedResult},
+		{name: "truncated", status: LLMTaskStatus{Status: "completed", Result: `[{"code":"1-01`, Truncated: true}, wantErr: ErrLLMResultTruncated},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			llmService := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+				return tc.status
+			})
+			client := &LLMServiceClient{
+				config:     LLMServiceConfig{BaseURL: llmService.Host(), MaxRetries: 1, BaseBackoff: time.Millisecond},
+				httpClient: newServiceHTTPClient(getHTTPClientConfig(), 5*time.Second),
+			}
+
+			data := []PDFOccupationCode{{Code: "1-01-01-01", Name: "（本小类包括下列职业）"}}
+			items, err := client.processSingleGroup(context.Background(), "1", data, "data_cleaning")
+			if tc.wantErr != nil {
+				require.Error(t, err)
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, items)
+			assert.Empty(t, items)
+		})
+	}
+}
+
+// TestLLMServiceClient_ParseSemanticResult 测试语义分析的空结果保留规则名称，无法解析的内容返回错误
+func TestLLMServiceClient_ParseSemanticResult(t *testing.T) {
+	client := &LLMServiceClient{}
+	choice := SemanticChoice{Code: "1-01-01-01", RuleName: "焊工", PDFName: "电焊工"}
+
+	result, err := client.parseSemanticResult("{}", choice)
+	require.NoError(t, err)
+	assert.Equal(t, "焊工", result.Name)
+	assert.Equal(t, "1-01-01", result.ParentCode)
+
+	_, err = client.parseSemanticResult("not json", choice)
+	assert.ErrorIs(t, err, ErrLLMMalformedResult)
+
+	result, err = client.parseSemanticResult(`{"name":"电焊工","selected_from":"pdf"}`, choice)
+	require.NoError(t, err)
+	assert.Equal(t, "电焊工", result.Name)
+}
@@ -0,0 +1,145 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/clock"
+)
+
+// LLM调用重试的默认参数
+const (
+	defaultLLMMaxRetries    = 3
+	defaultLLMBaseBackoff   = time.Second
+	defaultLLMMaxBackoff    = 30 * time.Second
+	defaultLLMBackoffJitter = 0.2
+)
+
+// ErrLLMResultTruncated LLM结果因max_tokens不足被截断，重试同一提示词不会得到不同结果
+var ErrLLMResultTruncated = errors.New("LLM结果被截断（max_tokens不足）")
+
+// LLMServiceError LLM服务返回的非成功HTTP状态
+type LLMServiceError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *LLMServiceError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("LLM服务返回错误 %d", e.StatusCode)
+	}
+	return fmt.Sprintf("LLM服务返回错误 %d: %s", e.StatusCode, e.Body)
+}
+
+// isRetryableLLMError 判断LLM调用错误是否值得重试
+// 429/5xx/408和网络超时可重试；400、认证失败等其他4xx以及结果截断、提示词过大立即放弃；未识别的错误按可重试处理
+func isRetryableLLMError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrLLMResultTruncated) || errors.Is(err, ErrPromptTooLarge) {
+		return false
+	}
+
+	var serviceErr *LLMServiceError
+	if errors.As(err, &serviceErr) {
+		switch {
+		case serviceErr.StatusCode == http.StatusTooManyRequests,
+			serviceErr.StatusCode == http.StatusRequestTimeout,
+			serviceErr.StatusCode >= 500:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// 网络错误、超时、任务失败等暂时性错误
+	return true
+}
+
+// llmRetryBackoff 计算第attempt次重试前的等待时间（attempt从1开始）
+// 基础时长按 base*attempt² 增长并以 max 封顶，再叠加 ±jitter 比例的随机抖动，random 取值 [0,1)
+func llmRetryBackoff(cfg LLMServiceConfig, attempt int, random float64) time.Duration {
+	if attempt < 1 {
+		return 0
+	}
+	base := cfg.BaseBackoff
+	if base <= 0 {
+		base = defaultLLMBaseBackoff
+	}
+	maxBackoff := cfg.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultLLMMaxBackoff
+	}
+
+	backoff := maxBackoff
+	// 避免 attempt² 过大时溢出
+	if n := time.Duration(attempt) * time.Duration(attempt); n <= maxBackoff/base {
+		backoff = base * n
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	jitter := cfg.BackoffJitter
+	if jitter <= 0 {
+		return backoff
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	factor := 1 + jitter*(2*random-1)
+	return time.Duration(float64(backoff) * factor)
+}
+
+// defaultLLMRetryConfig 默认的LLM重试配置
+func defaultLLMRetryConfig() LLMServiceConfig {
+	return LLMServiceConfig{
+		MaxRetries:    defaultLLMMaxRetries,
+		BaseBackoff:   defaultLLMBaseBackoff,
+		MaxBackoff:    defaultLLMMaxBackoff,
+		BackoffJitter: defaultLLMBackoffJitter,
+	}
+}
+
+// retryLLMCall 按配置重试LLM调用，遇到不可重试错误或上下文取消时立即返回，退避等待使用 clk 计时
+func retryLLMCall(ctx context.Context, clk clock.Clock, cfg LLMServiceConfig, call func() (string, error)) (string, int, error) {
+	maxRetries := cfg.MaxRetries
+	if maxRetries < 1 {
+		maxRetries = 1
+	}
+
+	var lastErr error
+	for i := 0; i < maxRetries; i++ {
+		if i > 0 {
+			backoff := llmRetryBackoff(cfg, i, rand.Float64())
+			fmt.Printf("🔄 [LLM重试] 第%d次重试，等待 %v\n", i, backoff)
+			select {
+			case <-clk.After(backoff):
+			case <-ctx.Done():
+				return "", i, ctx.Err()
+			}
+		}
+
+		result, err := call()
+		if err == nil {
+			return result, i + 1, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			return "", i + 1, ctx.Err()
+		}
+		if !isRetryableLLMError(err) {
+			fmt.Printf("🚫 [LLM重试] 不可重试的错误，停止重试: %v\n", err)
+			return "", i + 1, err
+		}
+	}
+	return "", maxRetries, lastErr
+}
@@ -0,0 +1,291 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIsRetryableLLMError 测试LLM调用错误的重试分类
+func TestIsRetryableLLMError(t *testing.T) {
+	timeoutErr := &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"无错误", nil, false},
+		{"限流429", &LLMServiceError{StatusCode: http.StatusTooManyRequests}, true},
+		{"服务错误500", &LLMServiceError{StatusCode: http.StatusInternalServerError}, true},
+		{"网关错误502", &LLMServiceError{StatusCode: http.StatusBadGateway}, true},
+		{"服务不可用503", &LLMServiceError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"请求超时408", &LLMServiceError{StatusCode: http.StatusRequestTimeout}, true},
+		{"请求错误400", &LLMServiceError{StatusCode: http.StatusBadRequest}, false},
+		{"未认证401", &LLMServiceError{StatusCode: http.StatusUnauthorized}, false},
+		{"无权限403", &LLMServiceError{StatusCode: http.StatusForbidden}, false},
+		{"包装后的400", fmt.Errorf("提交LLM任务失败: %w", &LLMServiceError{StatusCode: http.StatusBadRequest}), false},
+		{"包装后的503", fmt.Errorf("提交LLM任务失败: %w", &LLMServiceError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"网络超时", fmt.Errorf("调用LLM服务失败: %w", timeoutErr), true},
+		{"请求超时", context.DeadlineExceeded, true},
+		{"结果截断", fmt.Errorf("等待LLM结果失败: %w", ErrLLMResultTruncated), false},
+		{"上下文取消", context.Canceled, false},
+		{"未知错误", errors.New("LLM任务失败: 模型异常"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.retryable, isRetryableLLMError(tt.err))
+		})
+	}
+}
+
+// TestLLMRetryBackoff_Bounds 测试退避时间在抖动范围内且不超过上限
+func TestLLMRetryBackoff_Bounds(t *testing.T) {
+	cfg := LLMServiceConfig{
+		BaseBackoff:   time.Second,
+		MaxBackoff:    30 * time.Second,
+		BackoffJitter: 0.2,
+	}
+
+	for attempt := 1; attempt <= 20; attempt++ {
+		expected := time.Duration(attempt*attempt) * time.Second
+		if expected > cfg.MaxBackoff {
+			expected = cfg.MaxBackoff
+		}
+		lower := time.Duration(float64(expected) * 0.8)
+		upper := time.Duration(float64(expected) * 1.2)
+
+		for _, random := range []float64{0, 0.25, 0.5, 0.75, 0.999999} {
+			backoff := llmRetryBackoff(cfg, attempt, random)
+			assert.GreaterOrEqual(t, backoff, lower, "attempt=%d random=%v", attempt, random)
+			assert.LessOrEqual(t, backoff, upper, "attempt=%d random=%v", attempt, random)
+		}
+		assert.Equal(t, expected, llmRetryBackoff(cfg, attempt, 0.5), "random=0.5 时不抖动")
+	}
+
+	// 不同的随机数产生不同的等待时间
+	assert.NotEqual(t, llmRetryBackoff(cfg, 2, 0.1), llmRetryBackoff(cfg, 2, 0.9))
+	// 无抖动时严格按 base*n² 封顶
+	cfg.BackoffJitter = 0
+	assert.Equal(t, 4*time.Second, llmRetryBackoff(cfg, 2, 0.9))
+	assert.Equal(t, 30*time.Second, llmRetryBackoff(cfg, 1000000, 0.9))
+	assert.Equal(t, time.Duration(0), llmRetryBackoff(cfg, 0, 0.9))
+}
+
+// TestRetryLLMCall 测试重试次数与不可重试错误的提前返回
+func TestRetryLLMCall(t *testing.T) {
+	cfg := LLMServiceConfig{
+		MaxRetries:    4,
+		BaseBackoff:   time.Millisecond,
+		MaxBackoff:    5 * time.Millisecond,
+		BackoffJitter: 0.2,
+	}
+
+	t.Run("可重试错误用完重试次数", func(t *testing.T) {
+		var calls int
+		_, attempts, err := retryLLMCall(context.Background(), clock.Real(), cfg, func() (string, error) {
+			calls++
+			return "", &LLMServiceError{StatusCode: http.StatusServiceUnavailable}
+		})
+		require.Error(t, err)
+		assert.Equal(t, 4, calls)
+		assert.Equal(t, 4, attempts)
+	})
+
+	t.Run("不可重试错误立即返回", func(t *testing.T) {
+		var calls int
+		_, attempts, err := retryLLMCall(context.Background(), clock.Real(), cfg, func() (string, error) {
+			calls++
+			return "", &LLMServiceError{StatusCode: http.StatusUnauthorized}
+		})
+		var serviceErr *LLMServiceError
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, http.StatusUnauthorized, serviceErr.StatusCode)
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("重试后成功", func(t *testing.T) {
+		var calls int
+		result, attempts, err := retryLLMCall(context.Background(), clock.Real(), cfg, func() (string, error) {
+			calls++
+			if calls < 3 {
+				return "", &LLMServiceError{StatusCode: http.StatusTooManyRequests}
+			}
+			return "ok", nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "ok", result)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("等待期间上下文取消", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := cfg
+		slow.BaseBackoff = time.Hour
+		slow.MaxBackoff = time.Hour
+		_, _, err := retryLLMCall(ctx, clock.Real(), slow, func() (string, error) {
+			cancel()
+			return "", &LLMServiceError{StatusCode: http.StatusServiceUnavailable}
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// TestRetryLLMCall_BackoffUsesClock 测试重试的退避等待由注入的时钟计时
+func TestRetryLLMCall_BackoffUsesClock(t *testing.T) {
+	cfg := LLMServiceConfig{
+		MaxRetries:  3,
+		BaseBackoff: time.Minute,
+		MaxBackoff:  10 * time.Minute,
+	}
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	var calls int32
+	type outcome struct {
+		result   string
+		attempts int
+		err      error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, attempts, err := retryLLMCall(context.Background(), fake, cfg, func() (string, error) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				return "", &LLMServiceError{StatusCode: http.StatusServiceUnavailable}
+			}
+			return "ok", nil
+		})
+		done <- outcome{result, attempts, err}
+	}()
+
+	// 第一次重试等待 1 分钟，不足时不会再次调用
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute - time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	fake.Advance(time.Second)
+
+	// 第二次重试等待 2² 分钟
+	fake.BlockUntil(1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	fake.Advance(4 * time.Minute)
+
+	select {
+	case out := <-done:
+		require.NoError(t, out.err)
+		assert.Equal(t, "ok", out.result)
+		assert.Equal(t, 3, out.attempts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("推进时钟后重试没有完成")
+	}
+}
+
+// TestPDFLLMProcessor_CallLLMServiceWithRetry_StopsOnClientError 测试400错误不再重复提交
+func TestPDFLLMProcessor_CallLLMServiceWithRetry_StopsOnClientError(t *testing.T) {
+	var submits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&submits, 1)
+		http.Error(w, `{"error":"invalid prompt"}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	processor := &PDFLLMProcessor{
+		httpClient:    server.Client(),
+		llmServiceURL: server.Listener.Addr().String(),
+		metrics:       NewMetricsCollector(),
+		retryConfig:   LLMServiceConfig{MaxRetries: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	}
+
+	_, err := processor.callLLMServiceWithRetry(context.Background(), "data_cleaning", "prompt")
+	var serviceErr *LLMServiceError
+	require.ErrorAs(t, err, &serviceErr)
+	assert.Equal(t, http.StatusBadRequest, serviceErr.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&submits))
+}
+
+// TestApplyLLMRetryConfig 测试默认值和环境变量覆盖
+func TestApplyLLMRetryConfig(t *testing.T) {
+	t.Setenv("LLM_MAX_RETRIES", "5")
+	t.Setenv("LLM_RETRY_BASE_BACKOFF", "500ms")
+	t.Setenv("LLM_RETRY_MAX_BACKOFF", "")
+	t.Setenv("LLM_RETRY_JITTER", "0.5")
+
+	cfg := getLLMRetryConfig()
+	assert.Equal(t, 5, cfg.MaxRetries)
+	assert.Equal(t, 500*time.Millisecond, cfg.BaseBackoff)
+	assert.Equal(t, defaultLLMMaxBackoff, cfg.MaxBackoff)
+	assert.Equal(t, 0.5, cfg.BackoffJitter)
+}
+
+// TestPDFLLMProcessor_CallLLMService_ProviderFallback 测试LLM服务不可用时使用直连提供商兜底
+func TestPDFLLMProcessor_CallLLMService_ProviderFallback(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "deploying", http.StatusServiceUnavailable)
+	}))
+	defer service.Close()
+
+	var providerCalls int32
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&providerCalls, 1)
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"{\"ok\":true}"},"finish_reason":"stop"}]}`))
+	}))
+	defer provider.Close()
+
+	processor := &PDFLLMProcessor{
+		httpClient:    service.Client(),
+		llmServiceURL: service.Listener.Addr().String(),
+		metrics:       NewMetricsCollector(),
+		retryConfig:   LLMServiceConfig{MaxRetries: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		fallback:      newDirectLLMProvider(LLMFallbackConfig{Enabled: true, BaseURL: provider.URL, APIKey: "test-key", Model: "test-model"}),
+	}
+
+	result, err := processor.callLLMService(context.Background(), "data_cleaning", "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, result)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&providerCalls))
+	stage := processor.GetMetrics().StageMetrics[metricsStageLLMProviderFallback]
+	assert.Empty(t, stage.Errors)
+	assert.NotZero(t, stage.Count)
+
+	// 第二轮语义选择同样经过兜底
+	results, failures := processor.AnalyzeChoices(context.Background(), []SemanticChoiceItem{{Code: "1-01-01-01", RuleName: "焊工"}})
+	require.Empty(t, failures)
+	require.Len(t, results, 1)
+	assert.Equal(t, "1-01-01-01", results[0]["code"])
+	assert.Equal(t, int32(2), atomic.LoadInt32(&providerCalls))
+
+	// 请求本身无效（400）时直连提供商同样会失败，不触发兜底
+	badRequest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid prompt"}`, http.StatusBadRequest)
+	}))
+	defer badRequest.Close()
+	processor.llmServiceURL = badRequest.Listener.Addr().String()
+	_, err = processor.callLLMService(context.Background(), "data_cleaning", "prompt")
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&providerCalls))
+	assert.Nil(t, newDirectLLMProvider(LLMFallbackConfig{Enabled: true}), "缺少API Key时不启用兜底")
+	assert.Nil(t, newDirectLLMProvider(LLMFallbackConfig{Enabled: true, APIKey: "test-key"}), "缺少接口地址和模型时不启用兜底")
+	assert.Nil(t, newDirectLLMProvider(LLMFallbackConfig{Enabled: true, APIKey: "test-key", BaseURL: provider.URL}), "缺少模型时不启用兜底")
+	assert.Nil(t, newDirectLLMProvider(LLMFallbackConfig{APIKey: "test-key"}), "默认关闭")
+}
+
+// TestIncrementalProcessor_SetRetryConfig 测试重试配置传递给内部的PDF/LLM处理器
+func TestIncrementalProcessor_SetRetryConfig(t *testing.T) {
+	processor := &IncrementalProcessor{pdfProcessor: &PDFLLMProcessor{}}
+	retryConfig := LLMServiceConfig{MaxRetries: 5, BaseBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	processor.SetRetryConfig(retryConfig)
+	assert.Equal(t, retryConfig, processor.pdfProcessor.retryConfig)
+}
@@ -5,10 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/freedkr/moonshot/internal/clock"
+	"github.com/freedkr/moonshot/internal/httpx"
 )
 
 // LLMServiceClient LLM服务客户端实现
@@ -19,13 +23,16 @@ type LLMServiceClient struct {
 	metrics      MetricsCollector
 }
 
-// NewLLMServiceClient 创建LLM服务客户端
+// NewLLMServiceClient 创建LLM服务客户端，连接池和重试参数取自环境变量
 func NewLLMServiceClient(config LLMServiceConfig) LLMService {
+	return newLLMServiceClient(config, getHTTPClientConfig())
+}
+
+// newLLMServiceClient 按指定的HTTP客户端配置创建LLM服务客户端
+func newLLMServiceClient(config LLMServiceConfig, httpConfig httpx.Config) *LLMServiceClient {
 	return &LLMServiceClient{
-		config: config,
-		httpClient: &http.Client{
-			Timeout: config.Timeout,
-		},
+		config:     config,
+		httpClient: newServiceHTTPClient(httpConfig, config.Timeout),
 		// concurrency 和 metrics 将在 orchestrator 中注入
 	}
 }
@@ -81,7 +88,7 @@ func (c *LLMServiceClient) AnalyzeSemanticsConcurrently(ctx context.Context, req
 
 // ProcessSingleTask 处理单个任务
 func (c *LLMServiceClient) ProcessSingleTask(ctx context.Context, taskType string, prompt string) (string, error) {
-	return c.callLLMServiceWithRetry(ctx, taskType, prompt, c.config.MaxRetries)
+	return c.callLLMServiceWithRetry(ctx, taskType, prompt)
 }
 
 // groupPDFDataByPrefix 按编码前缀分组PDF数据
@@ -194,10 +201,13 @@ func (c *LLMServiceClient) processSingleGroup(ctx context.Context, prefix string
 	}
 
 	// 构建清洗提示词
-	prompt := c.buildCleaningPrompt(prefix, string(jsonData))
+	prompt, err := c.buildCleaningPrompt(prefix, string(jsonData))
+	if err != nil {
+		return nil, err
+	}
 
 	// 调用LLM服务
-	result, err := c.callLLMServiceWithRetry(ctx, taskType, prompt, c.config.MaxRetries)
+	result, err := c.callLLMServiceWithRetry(ctx, taskType, prompt)
 	if err != nil {
 		return nil, fmt.Errorf("LLM call failed: %w", err)
 	}
@@ -207,30 +217,8 @@ func (c *LLMServiceClient) processSingleGroup(ctx context.Context, prefix string
 }
 
 // buildCleaningPrompt 构建数据清洗提示词
-func (c *LLMServiceClient) buildCleaningPrompt(prefix string, data string) string {
-	return fmt.Sprintf(`你是一名数据清洗专家。请分析以下从PDF提取的第%s大类职业分类数据。
-
-核心数据：
-%s
-
-清洗规则：
-1. 识别所有有效的职业编码（格式如：%s-01-01-01）
-2. 修正OCR识别错误
-3. 标准化职业名称
-4. 保持同一大类内的一致性
-5. 去除描述性文字和无关内容
-
-输出格式要求：
-返回JSON数组，每个元素包含：
-{
-  "code": "职业编码",
-  "name": "职业名称",
-  "confidence": "置信度(0-1)",
-  "source": "pdf",
-  "level": "细类"
-}
-
-只返回JSON数组，不要有其他内容。`, prefix, data, prefix)
+func (c *LLMServiceClient) buildCleaningPrompt(prefix string, data string) (string, error) {
+	return currentPromptRegistry().Render(PromptStagePrefixCleaning, PromptData{Prefix: prefix, Data: data})
 }
 
 // parseCleaningResult 解析清洗结果
@@ -238,9 +226,14 @@ func (c *LLMServiceClient) parseCleaningResult(result string, prefix string) ([]
 	// 清理响应，提取JSON部分
 	cleanResult := c.extractJSON(result)
 
+	// 该分组没有需要清洗的条目，是有效的空结果
+	if isEmptyLLMResult(cleanResult) {
+		return []CleanedDataItem{}, nil
+	}
+
 	var items []CleanedDataItem
 	if err := json.Unmarshal([]byte(cleanResult), &items); err != nil {
-		return nil, fmt.Errorf("parse cleaning result failed: %w", err)
+		return nil, fmt.Errorf("parse cleaning result failed: %w: %v", ErrLLMMalformedResult, err)
 	}
 
 	// 后处理：设置处理时间和来源
@@ -338,10 +331,13 @@ func (c *LLMServiceClient) processSemanticChoicesWithTaskRotation(ctx context.Co
 // processSingleSemanticChoice 处理单个语义选择
 func (c *LLMServiceClient) processSingleSemanticChoice(ctx context.Context, choice SemanticChoice, taskType string) (FinalResultItem, error) {
 	// 构建语义分析提示词
-	prompt := c.buildSemanticPrompt(choice)
+	prompt, err := c.buildSemanticPrompt(choice)
+	if err != nil {
+		return FinalResultItem{}, err
+	}
 
 	// 调用LLM服务
-	result, err := c.callLLMServiceWithRetry(ctx, taskType, prompt, c.config.MaxRetries)
+	result, err := c.callLLMServiceWithRetry(ctx, taskType, prompt)
 	if err != nil {
 		return FinalResultItem{}, fmt.Errorf("LLM call failed: %w", err)
 	}
@@ -351,28 +347,13 @@ func (c *LLMServiceClient) processSingleSemanticChoice(ctx context.Context, choi
 }
 
 // buildSemanticPrompt 构建语义分析提示词
-func (c *LLMServiceClient) buildSemanticPrompt(choice SemanticChoice) string {
-	return fmt.Sprintf(`你是职业分类专家。请为以下职业编码选择最合适的名称：
-
-编码：%s
-选项1：%s
-选项2：%s
-父级类别：%s
-
-选择规则：
-- 只能选择选项1或选项2，不能创造新名称
-- 选择与父级层次语义更连贯的名称
-- 优先选择完整的、名词性的职业名称
-- 如果两个名称相似，选择更完整、更规范的版本
-- 排除包含"本小类包括"、"进行..."、"担任..."等描述性短语
-
-返回JSON格式：
-{
-  "code": "编码",
-  "name": "选择后的名称",
-  "parent_name": "父级类别名称",
-  "selected_from": "rule"或"pdf"
-}`, choice.Code, choice.RuleName, choice.PDFName, choice.ParentHierarchy)
+func (c *LLMServiceClient) buildSemanticPrompt(choice SemanticChoice) (string, error) {
+	return currentPromptRegistry().Render(PromptStageSemanticChoiceDetailed, PromptData{
+		Code:            choice.Code,
+		RuleName:        choice.RuleName,
+		PDFName:         choice.PDFName,
+		ParentHierarchy: choice.ParentHierarchy,
+	})
 }
 
 // parseSemanticResult 解析语义分析结果
@@ -380,9 +361,14 @@ func (c *LLMServiceClient) parseSemanticResult(result string, choice SemanticCho
 	// 清理响应，提取JSON部分
 	cleanResult := c.extractJSON(result)
 
+	// LLM没有给出选择时保留规则名称，不计为失败
+	if isEmptyLLMResult(cleanResult) {
+		return c.createDefaultResult(choice), nil
+	}
+
 	var semanticResult map[string]interface{}
 	if err := json.Unmarshal([]byte(cleanResult), &semanticResult); err != nil {
-		return FinalResultItem{}, fmt.Errorf("parse semantic result failed: %w", err)
+		return FinalResultItem{}, fmt.Errorf("parse semantic result failed: %w: %v", ErrLLMMalformedResult, err)
 	}
 
 	// 构建最终结果
@@ -515,36 +501,20 @@ func (c *LLMServiceClient) extractJSON(response string) string {
 }
 
 // callLLMServiceWithRetry 带重试的LLM服务调用
-func (c *LLMServiceClient) callLLMServiceWithRetry(ctx context.Context, taskType string, prompt string, maxRetries int) (string, error) {
-	var lastErr error
-
-	for i := 0; i < maxRetries; i++ {
-		if i > 0 {
-			// 指数退避
-			backoff := time.Duration(i*i) * time.Second
-			if backoff > 30*time.Second {
-				backoff = 30 * time.Second
-			}
-			
-			select {
-			case <-time.After(backoff):
-			case <-ctx.Done():
-				return "", ctx.Err()
-			}
-		}
-
-		result, err := c.callLLMServiceAsync(ctx, taskType, prompt)
-		if err == nil {
-			return result, nil
-		}
-
-		lastErr = err
+func (c *LLMServiceClient) callLLMServiceWithRetry(ctx context.Context, taskType string, prompt string) (string, error) {
+	if err := checkPromptSize(taskType, prompt); err != nil {
+		return "", err
+	}
+	result, attempts, err := retryLLMCall(ctx, clock.Real(), c.config, func() (string, error) {
+		return c.callLLMServiceAsync(ctx, taskType, prompt)
+	})
+	if err != nil {
 		if ctx.Err() != nil {
 			return "", ctx.Err()
 		}
+		return "", fmt.Errorf("LLM service call failed after %d attempts: %w", attempts, err)
 	}
-
-	return "", fmt.Errorf("LLM service call failed after %d retries: %w", maxRetries, lastErr)
+	return result, nil
 }
 
 // callLLMServiceAsync 异步调用LLM服务
@@ -558,6 +528,12 @@ func (c *LLMServiceClient) callLLMServiceAsync(ctx context.Context, taskType str
 		"model":   "moonshot-v1-128k",
 		"priority": "normal",
 	}
+	if getLLMDeterministic() {
+		request["deterministic"] = true
+	}
+	if metadata := llmMetadataFromContext(ctx); metadata != nil {
+		request["metadata"] = metadata
+	}
 
 	jsonData, err := json.Marshal(request)
 	if err != nil {
@@ -581,7 +557,8 @@ func (c *LLMServiceClient) callLLMServiceAsync(ctx context.Context, taskType str
 
 	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusCreated {
 		fmt.Printf("❌ [LLM调用失败] 响应状态码: %d\n", resp.StatusCode)
-		return "", fmt.Errorf("LLM service returned error %d", resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		return "", &LLMServiceError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	// 获取任务ID
@@ -623,38 +600,42 @@ func (c *LLMServiceClient) waitForLLMResult(ctx context.Context, taskID string)
 			statusStr := status["status"].(string)
 			switch statusStr {
 			case "completed", "success":
-				if result, ok := status["result"].(string); ok {
-					fmt.Printf("✅ [LLM完成] 任务ID=%s, 结果长度=%d\n", taskID, len(result))
-					// 验证结果是否为有效的JSON
-					result = strings.TrimSpace(result)
-					if result == "" {
-						fmt.Printf("⚠️ [LLM结果为空] 任务ID=%s\n", taskID)
-						return "", fmt.Errorf("LLM返回空结果")
-					}
-					
-					// 打印结果的前200字符作为示例
-					if len(result) > 200 {
-						fmt.Printf("  📝 [LLM结果示例] %s...\n", result[:200])
-					} else {
-						fmt.Printf("  📝 [LLM结果] %s\n", result)
-					}
-					
-					// 检查是否是截断的结果
-					if !strings.HasSuffix(result, "}") && !strings.HasSuffix(result, "]") {
-						fmt.Printf("⚠️ [LLM结果可能被截断] 结果不以}或]结尾\n")
-					}
-					
-					return result, nil
+				// 输出因max_tokens不足被截断（finish_reason=length）时内容不完整，属于协议错误
+				if truncated, _ := status["truncated"].(bool); truncated {
+					fmt.Printf("✂️ [LLM结果被截断] 任务ID=%s\n", taskID)
+					return "", ErrLLMResultTruncated
+				}
+				result, err := completedLLMResult(status["result"])
+				if err != nil {
+					return "", err
 				}
-				fmt.Printf("⚠️ [LLM空结果] 任务ID=%s\n", taskID)
-				return "", fmt.Errorf("empty result")
+				// 正常结束但没有内容是有效的空结果，如分组内全部是描述性文字，由解析方按空结果处理
+				if result == "" {
+					fmt.Printf("⚠️ [LLM结果为空] 任务ID=%s, 按空结果处理\n", taskID)
+					return "", nil
+				}
+				fmt.Printf("✅ [LLM完成] 任务ID=%s, 结果长度=%d\n", taskID, len(result))
+
+				// 打印结果的前200字符作为示例
+				if len(result) > 200 {
+					fmt.Printf("  📝 [LLM结果示例] %s...\n", result[:200])
+				} else {
+					fmt.Printf("  📝 [LLM结果] %s\n", result)
+				}
+
+				// 检查是否是截断的结果
+				if !strings.HasSuffix(result, "}") && !strings.HasSuffix(result, "]") {
+					fmt.Printf("⚠️ [LLM结果可能被截断] 结果不以}或]结尾\n")
+				}
+
+				return result, nil
 			case "failed", "error":
 				errorMsg := "unknown error"
 				if errStr, ok := status["error"].(string); ok {
 					errorMsg = errStr
 				}
 				fmt.Printf("❌ [LLM失败] 任务ID=%s, 错误=%s\n", taskID, errorMsg)
-				return "", fmt.Errorf("LLM task failed: %s", errorMsg)
+				return "", fmt.Errorf("LLM task failed: %w", llmTaskFailure(errorMsg))
 			case "cancelled":
 				fmt.Printf("❌ [LLM取消] 任务ID=%s\n", taskID)
 				return "", fmt.Errorf("LLM task cancelled")
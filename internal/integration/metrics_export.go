@@ -0,0 +1,170 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/clock"
+	"github.com/freedkr/moonshot/internal/database"
+)
+
+const (
+	DefaultMetricsFlushInterval = 5 * time.Minute // 指标快照的默认导出间隔
+	DefaultMetricsRetentionDays = 30              // 指标快照的默认保留天数
+)
+
+// MetricsSnapshotStore 指标快照的存储
+type MetricsSnapshotStore interface {
+	SaveMetricsSnapshots(ctx context.Context, snapshots []*database.MetricsSnapshot) error
+	PruneMetricsSnapshots(ctx context.Context, olderThan time.Duration) (int64, error)
+}
+
+// MetricsExporter 定期将指标收集器在两次导出之间的增量写入 metrics_snapshots 表，重启后历史指标仍可查询。
+// 导出只在复制累计计数时短暂持有收集器的读锁，写库在导出goroutine中进行，不阻塞指标记录
+type MetricsExporter struct {
+	collector MetricsCollector
+	store     MetricsSnapshotStore
+	source    string
+	retention time.Duration // 快照保留时长，0 表示不清理
+	clock     clock.Clock
+
+	// 上次导出时的累计计数和时间，只在导出goroutine中访问
+	last   map[string]StageTotals
+	lastAt time.Time
+}
+
+// NewMetricsExporter 创建指标快照导出器，source 标识导出的实例
+func NewMetricsExporter(collector MetricsCollector, store MetricsSnapshotStore, source string) *MetricsExporter {
+	e := &MetricsExporter{
+		collector: collector,
+		store:     store,
+		source:    source,
+		retention: DefaultMetricsRetentionDays * 24 * time.Hour,
+	}
+	e.SetClock(clock.Real())
+	return e
+}
+
+// SetRetention 设置快照保留时长，0 表示不清理
+func (e *MetricsExporter) SetRetention(retention time.Duration) {
+	e.retention = retention
+}
+
+// SetClock 替换时间源，第一个导出区间从此时开始
+func (e *MetricsExporter) SetClock(c clock.Clock) {
+	e.clock = c
+	e.lastAt = c.Now()
+}
+
+// Run 按间隔导出指标快照并清理过期快照，直到 ctx 取消；间隔为0时直接返回
+func (e *MetricsExporter) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := e.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		if _, err := e.Export(ctx); err != nil {
+			fmt.Printf("⚠️ 导出指标快照失败: %v\n", err)
+		}
+		if e.retention > 0 {
+			if _, err := e.store.PruneMetricsSnapshots(ctx, e.retention); err != nil {
+				fmt.Printf("⚠️ 清理指标快照失败: %v\n", err)
+			}
+		}
+	}
+}
+
+// Export 写入自上次导出以来各阶段的增量，返回写入的快照数；区间内没有新指标的阶段不写入。
+// 不支持并发调用
+func (e *MetricsExporter) Export(ctx context.Context) (int, error) {
+	totals := e.collector.StageTotals()
+	now := e.clock.Now()
+
+	stages := make([]string, 0, len(totals))
+	for stage := range totals {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+
+	var snapshots []*database.MetricsSnapshot
+	for _, stage := range stages {
+		delta := stageTotalsDelta(totals[stage], e.last[stage])
+		if delta.DurationCount == 0 && delta.SuccessCount == 0 && delta.ErrorCount == 0 {
+			continue
+		}
+		snapshot := &database.MetricsSnapshot{
+			Source:        e.source,
+			Stage:         stage,
+			DurationCount: delta.DurationCount,
+			SuccessCount:  delta.SuccessCount,
+			ErrorCount:    delta.ErrorCount,
+			PeriodStart:   e.lastAt,
+			CreatedAt:     now,
+		}
+		if delta.DurationCount > 0 {
+			snapshot.AvgDurationMs = float64(delta.TotalDuration.Microseconds()) / 1000 / float64(delta.DurationCount)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	if err := e.store.SaveMetricsSnapshots(ctx, snapshots); err != nil {
+		// 写入失败时保留上次的基准，增量计入下一次导出
+		return 0, err
+	}
+	e.last = totals
+	e.lastAt = now
+	return len(snapshots), nil
+}
+
+// stageTotalsDelta 计算两次累计计数的差值；收集器重置后累计值变小，此时当前值即为增量
+func stageTotalsDelta(current, previous StageTotals) StageTotals {
+	if current.DurationCount < previous.DurationCount || current.SuccessCount < previous.SuccessCount || current.ErrorCount < previous.ErrorCount {
+		return current
+	}
+	return StageTotals{
+		DurationCount: current.DurationCount - previous.DurationCount,
+		TotalDuration: current.TotalDuration - previous.TotalDuration,
+		SuccessCount:  current.SuccessCount - previous.SuccessCount,
+		ErrorCount:    current.ErrorCount - previous.ErrorCount,
+	}
+}
+
+// MetricsFlushIntervalFromEnv 读取 METRICS_FLUSH_INTERVAL，如 "1m"；
+// 未配置或格式无效时使用 DefaultMetricsFlushInterval，配置为0时不导出指标快照
+func MetricsFlushIntervalFromEnv() time.Duration {
+	v := os.Getenv("METRICS_FLUSH_INTERVAL")
+	if v == "" {
+		return DefaultMetricsFlushInterval
+	}
+	interval, err := time.ParseDuration(v)
+	if err != nil || interval < 0 {
+		fmt.Printf("⚠️ METRICS_FLUSH_INTERVAL 配置无效: %s，使用默认值 %s\n", v, DefaultMetricsFlushInterval)
+		return DefaultMetricsFlushInterval
+	}
+	return interval
+}
+
+// MetricsRetentionFromEnv 读取 METRICS_RETENTION_DAYS，返回快照保留时长；
+// 未配置或格式无效时使用 DefaultMetricsRetentionDays，配置为0时不清理
+func MetricsRetentionFromEnv() time.Duration {
+	days := DefaultMetricsRetentionDays
+	if v := os.Getenv("METRICS_RETENTION_DAYS"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			fmt.Printf("⚠️ METRICS_RETENTION_DAYS 配置无效: %s，使用默认值 %d\n", v, DefaultMetricsRetentionDays)
+		} else {
+			days = parsed
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
@@ -0,0 +1,155 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/clock"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSnapshotStore 记录写入的指标快照和清理调用
+type fakeSnapshotStore struct {
+	mu        sync.Mutex
+	snapshots []*database.MetricsSnapshot
+	prunes    []time.Duration
+	saveErr   error
+}
+
+func (s *fakeSnapshotStore) SaveMetricsSnapshots(ctx context.Context, snapshots []*database.MetricsSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.snapshots = append(s.snapshots, snapshots...)
+	return nil
+}
+
+func (s *fakeSnapshotStore) PruneMetricsSnapshots(ctx context.Context, olderThan time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prunes = append(s.prunes, olderThan)
+	return 0, nil
+}
+
+func (s *fakeSnapshotStore) saved() []*database.MetricsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*database.MetricsSnapshot(nil), s.snapshots...)
+}
+
+// TestMetricsExporter_ExportDeltas 测试每次导出只写入上次导出之后的增量
+func TestMetricsExporter_ExportDeltas(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	collector := NewMetricsCollector()
+	store := &fakeSnapshotStore{}
+	exporter := NewMetricsExporter(collector, store, "worker-1")
+	exporter.SetClock(fake)
+
+	collector.RecordProcessingDuration("llm_enhancement", 100*time.Millisecond)
+	collector.RecordProcessingDuration("llm_enhancement", 300*time.Millisecond)
+	collector.RecordSuccess("llm_enhancement")
+	collector.RecordError("pdf_llm_cleaning", errors.New("timeout"))
+
+	fake.Advance(5 * time.Minute)
+	n, err := exporter.Export(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	snapshots := store.saved()
+	assert.Equal(t, "llm_enhancement", snapshots[0].Stage)
+	assert.Equal(t, "worker-1", snapshots[0].Source)
+	assert.Equal(t, int64(2), snapshots[0].DurationCount)
+	assert.InDelta(t, 200, snapshots[0].AvgDurationMs, 0.001)
+	assert.Equal(t, int64(1), snapshots[0].SuccessCount)
+	assert.Equal(t, start, snapshots[0].PeriodStart)
+	assert.Equal(t, start.Add(5*time.Minute), snapshots[0].CreatedAt)
+	assert.Equal(t, "pdf_llm_cleaning", snapshots[1].Stage)
+	assert.Equal(t, int64(1), snapshots[1].ErrorCount)
+
+	// 没有新指标的阶段不写入，有新指标的阶段只写入增量
+	collector.RecordProcessingDuration("llm_enhancement", 50*time.Millisecond)
+	fake.Advance(5 * time.Minute)
+	n, err = exporter.Export(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	last := store.saved()[2]
+	assert.Equal(t, int64(1), last.DurationCount)
+	assert.InDelta(t, 50, last.AvgDurationMs, 0.001)
+	assert.Equal(t, int64(0), last.SuccessCount)
+	assert.Equal(t, start.Add(5*time.Minute), last.PeriodStart)
+
+	// 写入失败时增量保留到下一次导出
+	store.saveErr = errors.New("db down")
+	collector.RecordSuccess("merge")
+	_, err = exporter.Export(ctx)
+	require.Error(t, err)
+	store.saveErr = nil
+	collector.RecordSuccess("merge")
+	n, err = exporter.Export(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	assert.Equal(t, int64(2), store.saved()[3].SuccessCount)
+
+	// 收集器重置后以当前累计值作为增量
+	collector.Reset()
+	collector.RecordError("merge", errors.New("x"))
+	n, err = exporter.Export(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	assert.Equal(t, int64(1), store.saved()[4].ErrorCount)
+}
+
+// TestMetricsExporter_Run 测试按间隔导出并清理过期快照
+func TestMetricsExporter_Run(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	collector := NewMetricsCollector()
+	store := &fakeSnapshotStore{}
+	exporter := NewMetricsExporter(collector, store, "api-server")
+	exporter.SetClock(fake)
+	exporter.SetRetention(7 * 24 * time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		exporter.Run(ctx, time.Minute)
+		close(done)
+	}()
+
+	collector.RecordSuccess("final_update")
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	require.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.prunes) == 1
+	}, time.Second, time.Millisecond)
+	require.Len(t, store.saved(), 1)
+	assert.Equal(t, 7*24*time.Hour, store.prunes[0])
+
+	cancel()
+	<-done
+}
+
+// TestMetricsExporterEnv 测试导出间隔和保留天数的环境变量
+func TestMetricsExporterEnv(t *testing.T) {
+	assert.Equal(t, DefaultMetricsFlushInterval, MetricsFlushIntervalFromEnv())
+	assert.Equal(t, 30*24*time.Hour, MetricsRetentionFromEnv())
+
+	t.Setenv("METRICS_FLUSH_INTERVAL", "1m")
+	t.Setenv("METRICS_RETENTION_DAYS", "0")
+	assert.Equal(t, time.Minute, MetricsFlushIntervalFromEnv())
+	assert.Equal(t, time.Duration(0), MetricsRetentionFromEnv())
+
+	t.Setenv("METRICS_FLUSH_INTERVAL", "invalid")
+	t.Setenv("METRICS_RETENTION_DAYS", "-1")
+	assert.Equal(t, DefaultMetricsFlushInterval, MetricsFlushIntervalFromEnv())
+	assert.Equal(t, 30*24*time.Hour, MetricsRetentionFromEnv())
+}
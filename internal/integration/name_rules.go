@@ -0,0 +1,168 @@
+package integration
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NameRuleAction 名称规则命中后的处理方式
+type NameRuleAction string
+
+const (
+	NameRuleActionReject NameRuleAction = "reject" // 名称不可用，改用候选名称，没有可用候选时标记待复核
+	NameRuleActionStrip  NameRuleAction = "strip"  // 删除匹配的部分
+	NameRuleActionFlag   NameRuleAction = "flag"   // 仅标记，不修改名称
+)
+
+// NameRule 分类名称校验规则
+type NameRule struct {
+	Name    string         `yaml:"name" json:"name"`
+	Pattern string         `yaml:"pattern" json:"pattern"`
+	Action  NameRuleAction `yaml:"action" json:"action"`
+}
+
+// DefaultNameRules 内置规则，与提示词中的排除规则保持一致
+func DefaultNameRules() []NameRule {
+	return []NameRule{
+		{Name: "trailing_punctuation", Pattern: `[\s，。、；：,.;:！!？?]+$`, Action: NameRuleActionStrip},
+		{Name: "descriptive_phrase", Pattern: `本小类包括|包括下列职业`, Action: NameRuleActionReject},
+		{Name: "verb_phrase", Pattern: `^(进行|担任)`, Action: NameRuleActionReject},
+		{Name: "all_digits", Pattern: `^[\d\s\-]+$`, Action: NameRuleActionReject},
+		{Name: "too_long", Pattern: `^.{41,}$`, Action: NameRuleActionFlag},
+	}
+}
+
+// NameViolation 名称命中的规则
+type NameViolation struct {
+	Rule   string         `json:"rule"`
+	Action NameRuleAction `json:"action"`
+}
+
+// NameValidationResult 名称校验结果
+type NameValidationResult struct {
+	Name       string          // 执行 strip 后的名称
+	Rejected   bool            // 是否命中 reject 规则（或 strip 后为空）
+	Violations []NameViolation // 命中的规则，按规则顺序
+}
+
+// NameValidator 按顺序执行名称规则
+type NameValidator struct {
+	rules    []NameRule
+	patterns []*regexp.Regexp
+}
+
+// NewNameValidator 编译规则，正则或动作无效时返回错误
+func NewNameValidator(rules []NameRule) (*NameValidator, error) {
+	validator := &NameValidator{}
+	for i, rule := range rules {
+		switch rule.Action {
+		case NameRuleActionReject, NameRuleActionStrip, NameRuleActionFlag:
+		default:
+			return nil, fmt.Errorf("名称规则 %d (%s) 的动作无效: %q", i, rule.Name, rule.Action)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("名称规则 %d (%s) 的正则无效: %w", i, rule.Name, err)
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule_%d", i)
+		}
+		validator.rules = append(validator.rules, rule)
+		validator.patterns = append(validator.patterns, pattern)
+	}
+	return validator, nil
+}
+
+// Validate 校验名称；strip 规则依次作用于上一条规则处理后的名称
+func (v *NameValidator) Validate(name string) NameValidationResult {
+	result := NameValidationResult{Name: strings.TrimSpace(name)}
+	for i, rule := range v.rules {
+		pattern := v.patterns[i]
+		if !pattern.MatchString(result.Name) {
+			continue
+		}
+		result.Violations = append(result.Violations, NameViolation{Rule: rule.Name, Action: rule.Action})
+		switch rule.Action {
+		case NameRuleActionStrip:
+			result.Name = strings.TrimSpace(pattern.ReplaceAllString(result.Name, ""))
+		case NameRuleActionReject:
+			result.Rejected = true
+		}
+	}
+	if result.Name == "" {
+		result.Rejected = true
+	}
+	return result
+}
+
+// nameRulesFile 名称规则文件格式
+type nameRulesFile struct {
+	Rules []NameRule `yaml:"rules"`
+}
+
+// LoadNameRules 从YAML文件加载规则，path 为空时返回内置规则
+func LoadNameRules(path string) ([]NameRule, error) {
+	if path == "" {
+		return DefaultNameRules(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取名称规则文件失败: %w", err)
+	}
+	var file nameRulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析名称规则文件失败: %w", err)
+	}
+	return file.Rules, nil
+}
+
+var (
+	nameValidatorMu sync.RWMutex
+	nameValidator   *NameValidator
+)
+
+// InitNameRules 在服务启动时加载并校验名称规则
+func InitNameRules(path string) error {
+	rules, err := LoadNameRules(path)
+	if err != nil {
+		return err
+	}
+	validator, err := NewNameValidator(rules)
+	if err != nil {
+		return err
+	}
+
+	nameValidatorMu.Lock()
+	nameValidator = validator
+	nameValidatorMu.Unlock()
+	return nil
+}
+
+// currentNameValidator 获取当前名称校验器，未初始化时按配置文件加载
+func currentNameValidator() *NameValidator {
+	nameValidatorMu.RLock()
+	validator := nameValidator
+	nameValidatorMu.RUnlock()
+	if validator != nil {
+		return validator
+	}
+
+	if err := InitNameRules(getNameRulesFile()); err != nil {
+		// 自定义规则有误时退回内置规则，内置规则在测试中保证可用
+		fmt.Printf("⚠️ [名称规则] 加载失败，使用内置规则: %v\n", err)
+		validator, _ = NewNameValidator(DefaultNameRules())
+		nameValidatorMu.Lock()
+		nameValidator = validator
+		nameValidatorMu.Unlock()
+		return validator
+	}
+
+	nameValidatorMu.RLock()
+	defer nameValidatorMu.RUnlock()
+	return nameValidator
+}
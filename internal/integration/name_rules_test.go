@@ -0,0 +1,107 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNameValidator_DefaultRules 测试内置规则
+func TestNameValidator_DefaultRules(t *testing.T) {
+	validator, err := NewNameValidator(DefaultNameRules())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		input        string
+		expectedName string
+		rejected     bool
+		rules        []string
+	}{
+		{"合规名称", "焊工", "焊工", false, nil},
+		{"去除末尾标点", "焊工。", "焊工", false, []string{"trailing_punctuation"}},
+		{"描述性短语", "本小类包括下列职业", "本小类包括下列职业", true, []string{"descriptive_phrase"}},
+		{"动词短语", "进行设备维护", "进行设备维护", true, []string{"verb_phrase"}},
+		{"纯数字", "1-01-01", "1-01-01", true, []string{"all_digits"}},
+		{"仅标点", "。", "", true, []string{"trailing_punctuation"}},
+		{"过长名称", strings.Repeat("长", 41), strings.Repeat("长", 41), false, []string{"too_long"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := validator.Validate(tt.input)
+			assert.Equal(t, tt.expectedName, result.Name)
+			assert.Equal(t, tt.rejected, result.Rejected)
+
+			var rules []string
+			for _, v := range result.Violations {
+				rules = append(rules, v.Rule)
+			}
+			assert.Equal(t, tt.rules, rules)
+		})
+	}
+}
+
+// TestLoadNameRules 测试从文件加载规则
+func TestLoadNameRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.yaml")
+	content := "rules:\n  - name: no_brackets\n    pattern: '[（(].*[)）]'\n    action: strip\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	rules, err := LoadNameRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+
+	validator, err := NewNameValidator(rules)
+	require.NoError(t, err)
+	assert.Equal(t, "焊工", validator.Validate("焊工（电焊）").Name)
+
+	_, err = NewNameValidator([]NameRule{{Name: "bad", Pattern: "x", Action: "delete"}})
+	assert.Error(t, err)
+	_, err = NewNameValidator([]NameRule{{Name: "bad", Pattern: "(", Action: NameRuleActionFlag}})
+	assert.Error(t, err)
+
+	defaults, err := LoadNameRules("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultNameRules(), defaults)
+}
+
+// TestApplyNameRules 测试违规名称的修正、替换和标记
+func TestApplyNameRules(t *testing.T) {
+	validator, err := NewNameValidator(DefaultNameRules())
+	require.NoError(t, err)
+
+	_, changed := applyNameRules(validator, database.Category{Code: "1-01", Name: "焊工", LLMEnhancements: `{"name":"焊工"}`})
+	assert.False(t, changed)
+
+	// 被拒绝的名称改用PDF名称
+	update, changed := applyNameRules(validator, database.Category{
+		Code:            "1-02",
+		Name:            "本小类包括下列职业",
+		PDFInfo:         `{"name":"电工。"}`,
+		LLMEnhancements: `{"name":"本小类包括下列职业","confidence":0.8}`,
+	})
+	require.True(t, changed)
+	assert.Equal(t, "电工", update.Updates["name"])
+
+	var enhancements map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(update.Updates["llm_enhancements"].(string)), &enhancements))
+	assert.Equal(t, 0.8, enhancements["confidence"])
+	validation := enhancements["name_validation"].(map[string]interface{})
+	assert.Equal(t, "replaced", validation["action"])
+	assert.Equal(t, "pdf_name", validation["replaced_by"])
+	assert.Equal(t, "本小类包括下列职业", validation["original_name"])
+
+	// 没有可用候选时保留原名称并标记待复核
+	update, changed = applyNameRules(validator, database.Category{Code: "1-03", Name: "12345", LLMEnhancements: `{}`})
+	require.True(t, changed)
+	assert.Equal(t, "12345", update.Updates["name"])
+	assert.Contains(t, update.Updates["llm_enhancements"], `"action":"needs_review"`)
+}
@@ -143,6 +143,11 @@ func (m *MockMetricsCollector) GetMetrics() ProcessingMetrics {
 	return args.Get(0).(ProcessingMetrics)
 }
 
+func (m *MockMetricsCollector) StageTotals() map[string]StageTotals {
+	args := m.Called()
+	return args.Get(0).(map[string]StageTotals)
+}
+
 func (m *MockMetricsCollector) Reset() {
 	m.Called()
 }
@@ -0,0 +1,19 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+)
+
+// applyManualOverrides 在最终更新的最后应用人工修正，LLM结果和名称校验不会覆盖人工指定的名称
+func (p *IncrementalProcessor) applyManualOverrides(ctx context.Context, taskID string, stage string) error {
+	applied, err := p.db.ApplyCategoryOverrides(ctx, taskID)
+	if err != nil {
+		p.metrics.RecordError("manual_override", err)
+		return fmt.Errorf("应用人工修正失败: %w", err)
+	}
+	if applied > 0 {
+		fmt.Printf("✍️ [%s-人工修正] 已应用 %d 条人工修正 - taskID: %s\n", stage, applied, taskID)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// TestIncrementalProcessor_ManualOverrideSurvivesReprocessing 测试重新处理后人工修正仍覆盖LLM结果
+func TestIncrementalProcessor_ManualOverrideSurvivesReprocessing(t *testing.T) {
+	llmService := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		if code := promptField(req.Prompt, "编码:"); code != "" {
+			return LLMTaskStatus{Status: "completed", Result: map[string]interface{}{
+				"code": code, "name": promptField(req.Prompt, "选项2:"), "selected_from": "pdf",
+			}}
+		}
+		return LLMTaskStatus{Status: "completed",
+			Result: `[{"code":"1-01-01-01","name":"焊接工"},{"code":"1-01-01-02","name":"钳工"}]`}
+	})
+	t.Setenv("LLM_SERVICE_URL", llmService.Host())
+	t.Setenv("PDF_VALIDATOR_URL", "127.0.0.1:1")
+
+	ctx := context.Background()
+	db := newTestCategoryDB(t)
+	taskID := "5d7f9b1d-3e5a-4c7e-9a1c-3e5a7c9e1b3d"
+	require.NoError(t, db.CreateTask(ctx, &database.TaskRecord{
+		ID: taskID, Type: "rule", Status: "completed", Config: datatypes.JSON(`{}`),
+	}))
+	require.NoError(t, db.SavePDFExtraction(ctx, &database.PDFExtraction{
+		TaskID: taskID, TotalFound: 2,
+		OccupationCodes: datatypes.JSON(`[{"code":"1-01-01-01","name":"焊接工"},{"code":"1-01-01-02","name":"钳工"}]`),
+	}))
+	require.NoError(t, db.SaveCategoryOverride(ctx, &database.CategoryOverride{
+		TaskID: taskID, Code: "1-01-01-01", Name: "电焊工", Reason: "审核修正",
+	}))
+
+	process := func() {
+		categories := []*model.Category{
+			{Code: "1-01-01-01", Name: "焊工", Level: "细类"},
+			{Code: "1-01-01-02", Name: "钳工", Level: "细类"},
+		}
+		processor := NewIncrementalProcessor(&config.Config{}, db)
+		require.NoError(t, processor.ProcessIncrementalFlow(ctx, taskID, "input.xlsx", categories))
+	}
+
+	for i := 0; i < 2; i++ {
+		process()
+		cats, err := db.GetCurrentCategoriesByCodes(ctx, taskID, []string{"1-01-01-01", "1-01-01-02"})
+		require.NoError(t, err)
+		require.Len(t, cats, 2)
+		assert.Equal(t, "电焊工", cats["1-01-01-01"].Name, "第%d次处理后仍使用人工修正的名称", i+1)
+		assert.Equal(t, "钳工", cats["1-01-01-02"].Name)
+
+		var enhancements map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(cats["1-01-01-01"].LLMEnhancements), &enhancements))
+		marker, ok := enhancements[database.ManualOverrideKey].(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, "焊接工", marker["previous_name"])
+		assert.Equal(t, "焊工", enhancements[RuleNameKey])
+		assert.NotContains(t, cats["1-01-01-02"].LLMEnhancements, database.ManualOverrideKey)
+	}
+}
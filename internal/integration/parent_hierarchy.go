@@ -0,0 +1,32 @@
+package integration
+
+import "strings"
+
+const (
+	// defaultParentHierarchyDepth 默认只传直接父级名称
+	defaultParentHierarchyDepth = 1
+	// maxParentHierarchyDepth 细类最多有大类、中类、小类三级祖先
+	maxParentHierarchyDepth = 3
+	// maxParentHierarchyRunes 祖先路径的最大字符数，超出时从最上层祖先开始舍弃
+	maxParentHierarchyRunes = 60
+	// parentHierarchySeparator 祖先路径的分隔符
+	parentHierarchySeparator = " > "
+)
+
+// buildParentHierarchy 沿父级编码向上查找祖先名称，按"大类 > 中类 > 小类"的顺序拼接
+// depth 为包含的祖先层数，1 表示只包含直接父级
+func buildParentHierarchy(parentCode string, names, parents map[string]string, depth int) string {
+	var ancestors []string
+	for code := parentCode; code != "" && len(ancestors) < depth; code = parents[code] {
+		if name := names[code]; name != "" {
+			ancestors = append([]string{name}, ancestors...)
+		}
+	}
+
+	path := strings.Join(ancestors, parentHierarchySeparator)
+	for len(ancestors) > 1 && len([]rune(path)) > maxParentHierarchyRunes {
+		ancestors = ancestors[1:]
+		path = strings.Join(ancestors, parentHierarchySeparator)
+	}
+	return path
+}
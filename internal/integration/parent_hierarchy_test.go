@@ -0,0 +1,113 @@
+package integration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBuildParentHierarchy 测试按层数拼接祖先名称路径
+func TestBuildParentHierarchy(t *testing.T) {
+	names := map[string]string{"6": "生产制造", "6-01": "机械", "6-01-01": "装配"}
+	parents := map[string]string{"6-01": "6", "6-01-01": "6-01"}
+
+	assert.Equal(t, "", buildParentHierarchy("6-01-01", names, parents, 0))
+	assert.Equal(t, "装配", buildParentHierarchy("6-01-01", names, parents, 1))
+	assert.Equal(t, "机械 > 装配", buildParentHierarchy("6-01-01", names, parents, 2))
+	assert.Equal(t, "生产制造 > 机械 > 装配", buildParentHierarchy("6-01-01", names, parents, 3))
+	assert.Equal(t, "", buildParentHierarchy("", names, parents, 3))
+
+	// 超出长度上限时从最上层祖先开始舍弃，直接父级始终保留
+	names["6"] = strings.Repeat("长", maxParentHierarchyRunes)
+	assert.Equal(t, "机械 > 装配", buildParentHierarchy("6-01-01", names, parents, 3))
+}
+
+// TestGetParentHierarchyDepth 测试祖先层数的默认值、环境变量覆盖和上限
+func TestGetParentHierarchyDepth(t *testing.T) {
+	t.Setenv("SEMANTIC_PARENT_DEPTH", "")
+	assert.Equal(t, defaultParentHierarchyDepth, getParentHierarchyDepth())
+
+	t.Setenv("SEMANTIC_PARENT_DEPTH", "0")
+	assert.Equal(t, 0, getParentHierarchyDepth())
+
+	t.Setenv("SEMANTIC_PARENT_DEPTH", "10")
+	assert.Equal(t, maxParentHierarchyDepth, getParentHierarchyDepth())
+
+	t.Setenv("SEMANTIC_PARENT_DEPTH", "abc")
+	assert.Equal(t, defaultParentHierarchyDepth, getParentHierarchyDepth())
+}
+
+// TestMergeResults_ParentHierarchy 测试融合结果中的祖先路径来自分类树
+func TestMergeResults_ParentHierarchy(t *testing.T) {
+	tree := []*model.Category{{
+		Code: "6", Name: "生产制造",
+		Children: []*model.Category{{
+			Code: "6-01", Name: "机械",
+			Children: []*model.Category{{
+				Code: "6-01-01", Name: "装配",
+				Children: []*model.Category{{Code: "6-01-01-01", Name: "装配工"}},
+			}},
+		}},
+	}}
+	pdfData := []map[string]interface{}{{"code": "6-01-01-01", "name": "机械装配工"}}
+
+	processor := &PDFLLMProcessor{parentDepth: 3}
+	choices := processor.MergeResults(tree, pdfData)
+	if assert.Len(t, choices, 1) {
+		assert.Equal(t, "生产制造 > 机械 > 装配", choices[0].ParentHierarchy)
+	}
+
+	processor.parentDepth = 1
+	choices = processor.MergeResults(tree, pdfData)
+	if assert.Len(t, choices, 1) {
+		assert.Equal(t, "装配", choices[0].ParentHierarchy)
+	}
+}
+
+// TestMergeResults_PDFOnlyCodeParentHierarchy 测试规则骨架中没有的PDF编码按编码推断父级，名称取自规则或PDF数据
+func TestMergeResults_PDFOnlyCodeParentHierarchy(t *testing.T) {
+	tree := []*model.Category{{
+		Code: "6", Name: "生产制造",
+		Children: []*model.Category{{
+			Code: "6-01", Name: "机械",
+			Children: []*model.Category{{
+				Code: "6-01-01", Name: "装配",
+				Children: []*model.Category{{Code: "6-01-01-01", Name: "装配工"}},
+			}},
+		}},
+	}}
+	pdfData := []map[string]interface{}{
+		{"code": "6-01-01-01", "name": "机械装配工"},
+		{"code": "6-01-01-02", "name": "钳工"},      // 父级在规则骨架中
+		{"code": "6-01-02", "name": "检验"},         // 规则骨架缺少的小类
+		{"code": "6-01-02-01", "name": "机械产品检验员"}, // 父级只在PDF中
+	}
+
+	processor := &PDFLLMProcessor{parentDepth: 3}
+	hierarchies := make(map[string]string)
+	for _, choice := range processor.MergeResults(tree, pdfData) {
+		hierarchies[choice.Code] = choice.ParentHierarchy
+	}
+	assert.Equal(t, "生产制造 > 机械 > 装配", hierarchies["6-01-01-01"])
+	assert.Equal(t, "生产制造 > 机械 > 装配", hierarchies["6-01-01-02"])
+	assert.Equal(t, "生产制造 > 机械 > 检验", hierarchies["6-01-02-01"])
+	assert.Equal(t, "生产制造 > 机械", hierarchies["6-01-02"])
+}
+
+// TestAverageConfidence 测试平均置信度只统计合法取值
+func TestAverageConfidence(t *testing.T) {
+	avg, count := averageConfidence([]map[string]interface{}{
+		{"confidence": 0.9},
+		{"confidence": 0.7},
+		{"confidence": "高"},
+		{"confidence": 1.5},
+		{},
+	})
+	assert.Equal(t, 2, count)
+	assert.InDelta(t, 0.8, avg, 1e-9)
+
+	_, count = averageConfidence(nil)
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,108 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// PDFCodeConflictsKey 任务结果中记录PDF编码冲突的字段
+const PDFCodeConflictsKey = "pdf_code_conflicts"
+
+// PDFCodeConflict 清洗后的PDF数据中同一编码出现多次时的取舍记录，供人工复核PDF中有歧义的位置
+type PDFCodeConflict struct {
+	Code           string   `json:"code"`
+	Occurrences    int      `json:"occurrences"`
+	KeptName       string   `json:"kept_name"`
+	KeptConfidence float64  `json:"kept_confidence"` // 保留条目未返回置信度时为 0
+	DiscardedNames []string `json:"discarded_names"`
+}
+
+// SetPDFCodeDedup 设置融合前是否按编码去重清洗后的PDF数据
+func (p *IncrementalProcessor) SetPDFCodeDedup(enabled bool) {
+	p.dedupPDFCodes = enabled
+}
+
+// dedupPDFCodes 按编码去重清洗后的PDF数据：同一编码保留置信度最高的条目，置信度相同时保留最先出现的，
+// 未返回置信度的条目优先级最低。结果保持各编码首次出现的顺序，没有编码的条目原样保留；
+// 冲突按编码排序返回，使融合结果不依赖分组的返回顺序
+func dedupPDFCodes(pdfData []map[string]interface{}) ([]map[string]interface{}, []PDFCodeConflict) {
+	deduped := make([]map[string]interface{}, 0, len(pdfData))
+	positions := make(map[string]int)
+	conflictMap := make(map[string]*PDFCodeConflict)
+
+	for _, item := range pdfData {
+		code, _ := item["code"].(string)
+		if code == "" {
+			deduped = append(deduped, item)
+			continue
+		}
+
+		pos, exists := positions[code]
+		if !exists {
+			positions[code] = len(deduped)
+			deduped = append(deduped, item)
+			continue
+		}
+
+		conflict, ok := conflictMap[code]
+		if !ok {
+			conflict = &PDFCodeConflict{Code: code, Occurrences: 1, DiscardedNames: []string{}}
+			conflictMap[code] = conflict
+		}
+		conflict.Occurrences++
+
+		discarded := item
+		if pdfItemConfidence(item) > pdfItemConfidence(deduped[pos]) {
+			discarded = deduped[pos]
+			deduped[pos] = item
+		}
+		name, _ := discarded["name"].(string)
+		conflict.DiscardedNames = append(conflict.DiscardedNames, name)
+	}
+
+	conflicts := make([]PDFCodeConflict, 0, len(conflictMap))
+	for code, conflict := range conflictMap {
+		kept := deduped[positions[code]]
+		conflict.KeptName, _ = kept["name"].(string)
+		conflict.KeptConfidence, _ = parseConfidence(kept["confidence"])
+		conflicts = append(conflicts, *conflict)
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Code < conflicts[j].Code })
+	return deduped, conflicts
+}
+
+// pdfItemConfidence 返回清洗结果条目的置信度，未返回或无法解析时返回 -1
+func pdfItemConfidence(item map[string]interface{}) float64 {
+	if confidence, ok := parseConfidence(item["confidence"]); ok {
+		return confidence
+	}
+	return -1
+}
+
+// parseConfidence 解析LLM返回的置信度，兼容数值和数字字符串
+func parseConfidence(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// recordPDFCodeConflicts 将PDF编码冲突写入任务结果的 pdf_code_conflicts 字段，保留结果中的其他字段；
+// 每次融合都会覆盖上次记录，失败不影响主流程
+func (p *IncrementalProcessor) recordPDFCodeConflicts(ctx context.Context, taskID string, conflicts []PDFCodeConflict) {
+	err := p.mergeTaskResult(p.db.WithContext(ctx), taskID, "", map[string]interface{}{PDFCodeConflictsKey: conflicts})
+	if err != nil {
+		fmt.Printf("⚠️ WARNING: 记录PDF编码冲突失败 - taskID: %s, 错误: %v\n", taskID, err)
+	}
+}
@@ -0,0 +1,84 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// TestDedupPDFCodes 测试同一编码保留置信度最高的条目，且结果与返回顺序无关
+func TestDedupPDFCodes(t *testing.T) {
+	pdfData := []map[string]interface{}{
+		{"code": "1-01-01-02", "name": "钳工", "confidence": 0.7},
+		{"code": "1-01-01-01", "name": "焊 工", "confidence": 0.6},
+		{"name": "无编码条目"},
+		{"code": "1-01-01-01", "name": "焊工", "confidence": "0.9"},
+		{"code": "1-01-01-02", "name": "钳工（重复）", "confidence": 0.7},
+		{"code": "1-01-01-01", "name": "电焊工"},
+	}
+
+	deduped, conflicts := dedupPDFCodes(pdfData)
+	require.Len(t, deduped, 3)
+	assert.Equal(t, "钳工", deduped[0]["name"], "置信度相同时保留最先出现的条目")
+	assert.Equal(t, "焊工", deduped[1]["name"], "保留置信度最高的条目并保持编码首次出现的位置")
+	assert.Equal(t, "无编码条目", deduped[2]["name"])
+
+	assert.Equal(t, []PDFCodeConflict{
+		{Code: "1-01-01-01", Occurrences: 3, KeptName: "焊工", KeptConfidence: 0.9, DiscardedNames: []string{"焊 工", "电焊工"}},
+		{Code: "1-01-01-02", Occurrences: 2, KeptName: "钳工", KeptConfidence: 0.7, DiscardedNames: []string{"钳工（重复）"}},
+	}, conflicts)
+
+	// 调换输入顺序后保留的条目不变
+	reversed := make([]map[string]interface{}, 0, len(pdfData))
+	for i := len(pdfData) - 1; i >= 0; i-- {
+		reversed = append(reversed, pdfData[i])
+	}
+	deduped, _ = dedupPDFCodes(reversed)
+	kept := make(map[string]interface{})
+	for _, item := range deduped {
+		if code, ok := item["code"].(string); ok {
+			kept[code] = item["name"]
+		}
+	}
+	assert.Equal(t, "焊工", kept["1-01-01-01"])
+}
+
+// TestIncrementalProcessor_RecordPDFCodeConflicts 测试编码冲突写入任务结果且保留原有字段
+func TestIncrementalProcessor_RecordPDFCodeConflicts(t *testing.T) {
+	db := newTestCategoryDB(t)
+	processor := NewIncrementalProcessor(&config.Config{}, db)
+	ctx := context.Background()
+	taskID := "5a7c9e1f-2b4d-4f6a-8c0e-1d3f5b7a9c2e"
+	require.NoError(t, db.CreateTask(ctx, &database.TaskRecord{
+		ID: taskID, Type: "rule", Status: "completed",
+		Config: datatypes.JSON(`{}`), Result: datatypes.JSON(`{"status":"completed"}`),
+	}))
+
+	processor.recordPDFCodeConflicts(ctx, taskID, []PDFCodeConflict{
+		{Code: "1-01-01-01", Occurrences: 2, KeptName: "焊工", KeptConfidence: 0.9, DiscardedNames: []string{"焊 工"}},
+	})
+
+	task, err := db.GetTask(ctx, taskID)
+	require.NoError(t, err)
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(task.Result, &result))
+	assert.Equal(t, "completed", result["status"])
+	conflicts, ok := result[PDFCodeConflictsKey].([]interface{})
+	require.True(t, ok)
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "1-01-01-01", conflicts[0].(map[string]interface{})["code"])
+	assert.Equal(t, "completed", task.Status, "不修改任务状态")
+
+	// 再次融合没有冲突时清空上次记录
+	processor.recordPDFCodeConflicts(ctx, taskID, []PDFCodeConflict{})
+	task, err = db.GetTask(ctx, taskID)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(task.Result, &result))
+	assert.Empty(t, result[PDFCodeConflictsKey])
+}
@@ -3,6 +3,7 @@ package integration
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -14,18 +15,34 @@ import (
 
 // BatchProcessor PDF和LLM批量并发处理器
 type BatchProcessor struct {
-	processor     *PDFLLMProcessor
-	batchSize     int
-	maxConcurrent int
+	processor        *PDFLLMProcessor
+	batchSize        int
+	maxConcurrent    int
+	failureTolerance float64 // 允许失败的分组比例，未超过时返回其余分组的结果
 }
 
+// defaultCleaningFailureTolerance 默认允许8个前缀分组中最多2个失败
+const defaultCleaningFailureTolerance = 0.25
+
 // NewBatchProcessor 创建批量处理器
 func NewBatchProcessor(processor *PDFLLMProcessor) *BatchProcessor {
 	return &BatchProcessor{
-		processor:     processor,
-		batchSize:     100, // 每批100条数据
-		maxConcurrent: 8,   // 最多8个并发
+		processor:        processor,
+		batchSize:        100, // 每批100条数据
+		maxConcurrent:    8,   // 最多8个并发
+		failureTolerance: getCleaningFailureTolerance(),
+	}
+}
+
+// withinFailureTolerance 失败分组占比不超过容忍度时返回 true
+func (b *BatchProcessor) withinFailureTolerance(failed, total int) bool {
+	if failed == 0 {
+		return true
+	}
+	if failed == total {
+		return false
 	}
+	return float64(failed)/float64(total) <= b.failureTolerance
 }
 
 // ProcessPDFDataConcurrently 并发处理PDF数据
@@ -33,7 +50,10 @@ func (b *BatchProcessor) ProcessPDFDataConcurrently(ctx context.Context, pdfData
 	fmt.Printf("DEBUG: ProcessPDFDataConcurrently 开始执行\n")
 
 	// 1. 按照编码前缀分组（如 1-xx, 2-xx, 3-xx）
-	groups := b.groupByCodePrefix(pdfData)
+	groups, err := b.groupByCodePrefix(pdfData)
+	if err != nil {
+		return nil, err
+	}
 	fmt.Printf("DEBUG: 分组完成，共 %d 个分组\n", len(groups))
 
 	// 2. 创建结果收集通道
@@ -64,7 +84,9 @@ func (b *BatchProcessor) ProcessPDFDataConcurrently(ctx context.Context, pdfData
 
 			fmt.Printf("DEBUG: 分组 %s 开始调用processSingleGroup\n", prefix)
 			// 处理这一组数据
+			startTime := time.Now()
 			result, err := b.processSingleGroup(ctx, prefix, data)
+			b.processor.recordLLMCall(metricsStageLLMCleaningGroup, startTime, err)
 			if err != nil {
 				fmt.Printf("DEBUG: 分组 %s 处理失败: %v\n", prefix, err)
 				errorCh <- fmt.Errorf("处理组 %s 失败: %w", prefix, err)
@@ -120,35 +142,37 @@ func (b *BatchProcessor) ProcessPDFDataConcurrently(ctx context.Context, pdfData
 
 	fmt.Printf("DEBUG: 结果收集完成，allResults长度: %d, errors长度: %d\n", len(allResults), len(errors))
 
-	// 检查错误
+	// 检查错误：失败分组未超过容忍度时返回其余分组的结果，失败分组的编码不参与后续融合
+	if !b.withinFailureTolerance(len(errors), len(groups)) {
+		fmt.Printf("DEBUG: 失败分组 %d/%d 超过容忍度 %.2f，返回失败: %v\n", len(errors), len(groups), b.failureTolerance, errors)
+		return allResults, fmt.Errorf("部分组处理失败(%d/%d): %v", len(errors), len(groups), errors)
+	}
 	if len(errors) > 0 {
-		fmt.Printf("DEBUG: 发现错误，返回失败: %v\n", errors)
-		return allResults, fmt.Errorf("部分组处理失败: %v", errors)
+		fmt.Printf("⚠️ [并发清洗] 失败分组 %d/%d 在容忍度 %.2f 内，返回其余分组的 %d 条结果: %v\n",
+			len(errors), len(groups), b.failureTolerance, len(allResults), errors)
 	}
 
 	fmt.Printf("DEBUG: ProcessPDFDataConcurrently 成功完成\n")
 	return allResults, nil
 }
 
+// ErrUnrecognizedPDFData PDF数据中找不到编码条目数组，无法按前缀分组
+var ErrUnrecognizedPDFData = errors.New("无法识别的PDF数据格式")
+
 // groupByCodePrefix 按编码前缀分组
-func (b *BatchProcessor) groupByCodePrefix(pdfData map[string]interface{}) map[string]map[string]interface{} {
+// 条目数组优先取 occupation_codes，其次取 items，都没有时取顶层字段中看起来像 {code,name} 列表的数组；
+// 仍找不到时返回 ErrUnrecognizedPDFData，不再把整份数据作为一个分组，避免生成过大的提示词
+func (b *BatchProcessor) groupByCodePrefix(pdfData map[string]interface{}) (map[string]map[string]interface{}, error) {
 	groups := make(map[string]map[string]interface{})
 
-	// 首先尝试PDF服务格式 {"occupation_codes": [...]}
-	var items []interface{}
-	if occupationCodes, ok := pdfData["occupation_codes"].([]interface{}); ok {
-		items = occupationCodes
-		fmt.Printf("DEBUG: groupByCodePrefix 找到occupation_codes数组，长度: %d\n", len(items))
-	} else if itemsArray, ok := pdfData["items"].([]interface{}); ok {
-		// 备用：尝试items格式
-		items = itemsArray
-		fmt.Printf("DEBUG: groupByCodePrefix 找到items数组，长度: %d\n", len(items))
-	} else {
-		// 如果不是预期格式，作为单个组处理
-		fmt.Printf("DEBUG: groupByCodePrefix 未找到occupation_codes或items字段，使用all组\n")
-		groups["all"] = pdfData
-		return groups
+	key, items := findPDFCodeItems(pdfData)
+	if key == "" {
+		return nil, fmt.Errorf("%w: 顶层字段 %s", ErrUnrecognizedPDFData, describePDFShape(pdfData))
+	}
+	if key != "occupation_codes" && key != "items" {
+		fmt.Printf("⚠️ [PDF格式] 未找到occupation_codes或items字段，使用字段 %s 中的条目，数据结构: %s\n", key, describePDFShape(pdfData))
 	}
+	fmt.Printf("DEBUG: groupByCodePrefix 找到%s数组，长度: %d\n", key, len(items))
 
 	for _, item := range items {
 		itemMap, ok := item.(map[string]interface{})
@@ -160,6 +184,17 @@ func (b *BatchProcessor) groupByCodePrefix(pdfData map[string]interface{}) map[s
 		if !ok {
 			continue
 		}
+		// 全角编码会被分到错误的前缀组，分组前先规范化
+		code = normalizeCode(code)
+		if code != itemMap["code"] {
+			// 复制后再改写编码，PDF服务的原始返回仍会被保存和复用
+			normalized := make(map[string]interface{}, len(itemMap))
+			for k, v := range itemMap {
+				normalized[k] = v
+			}
+			normalized["code"] = code
+			item = normalized
+		}
 
 		// 获取主分类前缀（如 "1", "2", "3" 等）
 		prefix := getMainCategory(code)
@@ -174,7 +209,85 @@ func (b *BatchProcessor) groupByCodePrefix(pdfData map[string]interface{}) map[s
 		groups[prefix]["occupation_codes"] = append(groupItems, item)
 	}
 
-	return groups
+	return groups, nil
+}
+
+// findPDFCodeItems 查找PDF数据中的编码条目数组，返回字段名和数组；找不到时字段名为空
+func findPDFCodeItems(pdfData map[string]interface{}) (string, []interface{}) {
+	for _, key := range []string{"occupation_codes", "items"} {
+		if items, ok := pdfData[key].([]interface{}); ok {
+			return key, items
+		}
+	}
+
+	// 按字段名排序遍历，多个候选时取编码条目最多的数组，结果与map遍历顺序无关
+	keys := make([]string, 0, len(pdfData))
+	for key := range pdfData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	bestKey, bestCount := "", 0
+	for _, key := range keys {
+		items, ok := pdfData[key].([]interface{})
+		if !ok {
+			continue
+		}
+		if count := countCodeItems(items); count > bestCount && count*2 >= len(items) {
+			bestKey, bestCount = key, count
+		}
+	}
+	if bestKey == "" {
+		return "", nil
+	}
+	return bestKey, pdfData[bestKey].([]interface{})
+}
+
+// countCodeItems 统计数组中同时带有字符串 code 和 name 的对象数
+func countCodeItems(items []interface{}) int {
+	count := 0
+	for _, item := range items {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		_, hasCode := itemMap["code"].(string)
+		_, hasName := itemMap["name"].(string)
+		if hasCode && hasName {
+			count++
+		}
+	}
+	return count
+}
+
+// describePDFShape 描述PDF数据顶层字段的类型，数组附带长度，用于日志和错误信息
+func describePDFShape(pdfData map[string]interface{}) string {
+	if len(pdfData) == 0 {
+		return "{}"
+	}
+	fields := make([]string, 0, len(pdfData))
+	for key, value := range pdfData {
+		var kind string
+		switch v := value.(type) {
+		case []interface{}:
+			kind = fmt.Sprintf("array[%d]", len(v))
+		case map[string]interface{}:
+			kind = "object"
+		case string:
+			kind = "string"
+		case float64, int, int64:
+			kind = "number"
+		case bool:
+			kind = "bool"
+		case nil:
+			kind = "null"
+		default:
+			kind = fmt.Sprintf("%T", v)
+		}
+		fields = append(fields, key+":"+kind)
+	}
+	sort.Strings(fields)
+	return "{" + strings.Join(fields, ", ") + "}"
 }
 
 // getMainCategory 获取主分类
@@ -231,30 +344,10 @@ func (b *BatchProcessor) processSingleGroup(ctx context.Context, prefix string,
 
 	fmt.Printf("DEBUG: 分组 %s 开始构建prompt\n", prefix)
 	// 构建针对这个分组的prompt，只包含核心字段
-	prompt := fmt.Sprintf(`你是一名数据清洗专家。以下是一份列表，其中每个对象包含编码（code）、名称（name）及其他元数据。你的任务是根据以下规则，为每个唯一的编码（code）从其关联的名称列表中，选出最准确、最精炼的职业名称。
-
-请严格遵守以下规则进行判断：
-
-1.  **分组处理**：将列表中的数据按 code 字段进行分组。
-2.  **语义组合判断**：
-    * **优先选择**：如果一个 code 对应的多个 name 中，只有一个是完整的、名词性的职业或实体名称，那么这一个就是正确的名称。
-    * **次要排除**：如果一个 code 下的名称包含"本小类包括下列职业"、"进行..."或"担任..."等描述性或动词性短语，则这些名称应被排除。它们是辅助性说明，不是最终的职业名称。
-    * **完整性优先**：对于像"航天动力装置制造工"和"航天动力装置制造工程技术人员"这样的情况，如果"航天动力装置制造工程技术人员"是完整的，而另一个是截断的（根据文本内容判断），则优先选择完整的名称。
-3.  **最终输出**：以 code: name 的JSON格式输出最终确认的词表列表。
-
-请使用此方法处理以下JSON数据，并仅返回最终结果。
-
-%s
-
-输出JSON数组格式，不要有其他内容：
-[
-  {
-    "code": "职业编码",
-    "name": "职业名称",
-    "confidence": "置信度(0-1)"
-  }
-]
-`, jsonString(coreData))
+	prompt, err := currentPromptRegistry().Render(PromptStageGroupCleaning, PromptData{Data: jsonString(coreData)})
+	if err != nil {
+		return nil, err
+	}
 
 	fmt.Printf("DEBUG: 分组 %s 开始调用LLM服务\n", prefix)
 	// 调用LLM服务
@@ -472,19 +565,20 @@ func (b *BatchProcessor) processBatch(ctx context.Context, workerID int, batch [
 	}
 
 	// 构建prompt
-	prompt := fmt.Sprintf(`分析并优化以下职业分类数据（批次%d，共%d条）：
-
-%s
-
-要求：
-1. 验证编码格式正确性
-2. 优化职业名称表述
-3. 确保层级关系合理
-
-输出JSON数组。`, workerID, len(items), jsonString(items))
+	prompt, err := currentPromptRegistry().Render(PromptStageBatchOptimization, PromptData{
+		Data:    jsonString(items),
+		BatchID: workerID,
+		Count:   len(items),
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	// 调用LLM（带重试）
-	result, err := b.processor.callLLMServiceWithRetry(ctx, "batch_processing", prompt, 3)
+	// 调用LLM（带重试和直连兜底），提示词超出模型上下文时对半拆分后分别处理
+	result, err := b.processor.callLLMService(ctx, "batch_processing", prompt)
+	if errors.Is(err, ErrPromptTooLarge) && len(batch) > 1 {
+		return b.processSplitBatch(ctx, workerID, batch)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("worker %d 处理失败: %w", workerID, err)
 	}
@@ -498,6 +592,21 @@ func (b *BatchProcessor) processBatch(ctx context.Context, workerID int, batch [
 	return processedData, nil
 }
 
+// processSplitBatch 将提示词过大的批次对半拆分后依次处理，合并两半的结果
+func (b *BatchProcessor) processSplitBatch(ctx context.Context, workerID int, batch []*model.Category) ([]map[string]interface{}, error) {
+	mid := len(batch) / 2
+	fmt.Printf("✂️ worker %d 批次提示词过大，拆分为 %d + %d 条重新处理\n", workerID, mid, len(batch)-mid)
+	first, err := b.processBatch(ctx, workerID, batch[:mid])
+	if err != nil {
+		return nil, err
+	}
+	second, err := b.processBatch(ctx, workerID, batch[mid:])
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
 // OptimizeWithPipeline 使用pipeline模式优化处理
 func (b *BatchProcessor) OptimizeWithPipeline(ctx context.Context, taskID string, categories []*model.Category) error {
 	// 创建pipeline阶段
@@ -704,6 +813,9 @@ func extractCoreFields(data map[string]interface{}) map[string]interface{} {
 		coreItem := map[string]interface{}{}
 
 		if code, exists := itemMap["code"]; exists {
+			if s, ok := code.(string); ok {
+				code = normalizeCode(s)
+			}
 			coreItem["code"] = code
 		}
 
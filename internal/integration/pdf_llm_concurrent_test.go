@@ -0,0 +1,74 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func codeItems(codes ...string) []interface{} {
+	items := make([]interface{}, 0, len(codes))
+	for _, code := range codes {
+		items = append(items, map[string]interface{}{"code": code, "name": "名称" + code})
+	}
+	return items
+}
+
+// TestGroupByCodePrefix_Shapes 测试不同结构的PDF数据都能找到编码条目数组并按前缀分组
+func TestGroupByCodePrefix_Shapes(t *testing.T) {
+	cases := []struct {
+		name    string
+		pdfData map[string]interface{}
+	}{
+		{"occupation_codes", map[string]interface{}{"occupation_codes": codeItems("1-01", "2-01", "2-02")}},
+		{"items", map[string]interface{}{"items": codeItems("1-01", "2-01", "2-02")}},
+		{"其他字段名", map[string]interface{}{
+			"page_count": 12.0,
+			"source":     "国家职业分类大典.pdf",
+			"records":    codeItems("1-01", "2-01", "2-02"),
+		}},
+		{"多个候选取条目最多的数组", map[string]interface{}{
+			"headers": codeItems("9-01"),
+			"rows":    codeItems("1-01", "2-01", "2-02"),
+			"pages":   []interface{}{1.0, 2.0, 3.0},
+		}},
+	}
+
+	b := &BatchProcessor{}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			groups, err := b.groupByCodePrefix(tc.pdfData)
+			require.NoError(t, err)
+			require.Len(t, groups, 2)
+			assert.Len(t, groups["1"]["occupation_codes"], 1)
+			assert.Len(t, groups["2"]["occupation_codes"], 2)
+		})
+	}
+}
+
+// TestGroupByCodePrefix_Unrecognized 测试找不到编码条目时返回描述数据结构的错误，而不是把整份数据作为一个分组
+func TestGroupByCodePrefix_Unrecognized(t *testing.T) {
+	cases := []map[string]interface{}{
+		{},
+		{"text": "全文", "pages": []interface{}{1.0, 2.0}},
+		// 多数元素不是编码条目的数组不作为候选
+		{"blocks": []interface{}{"a", "b", "c", map[string]interface{}{"code": "1-01", "name": "x"}}},
+		{"data": map[string]interface{}{"occupation_codes": codeItems("1-01")}},
+	}
+
+	b := &BatchProcessor{}
+	for _, pdfData := range cases {
+		groups, err := b.groupByCodePrefix(pdfData)
+		assert.ErrorIs(t, err, ErrUnrecognizedPDFData)
+		assert.Nil(t, groups)
+	}
+
+	_, err := b.groupByCodePrefix(map[string]interface{}{"text": "全文", "pages": []interface{}{1.0, 2.0}})
+	assert.Contains(t, err.Error(), "{pages:array[2], text:string}")
+
+	// 并发清洗直接返回错误，不调用LLM
+	_, err = b.ProcessPDFDataConcurrently(context.Background(), map[string]interface{}{"text": "全文"})
+	assert.ErrorIs(t, err, ErrUnrecognizedPDFData)
+}
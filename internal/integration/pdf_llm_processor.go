@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -14,10 +15,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/freedkr/moonshot/internal/clock"
 	"github.com/freedkr/moonshot/internal/config"
 	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/httpx"
 	"github.com/freedkr/moonshot/internal/model"
+	"github.com/google/uuid"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // PDFLLMProcessor 处理PDF验证和LLM语义分析的集成
@@ -27,21 +32,94 @@ type PDFLLMProcessor struct {
 	db            database.DatabaseInterface
 	llmServiceURL string
 	pdfServiceURL string
+	metrics       MetricsCollector
+	retryConfig   LLMServiceConfig   // LLM调用的重试次数与退避参数
+	parentDepth   int                // 语义选择提示词中包含的祖先层数
+	fallback      *directLLMProvider // LLM服务重试耗尽后的直连提供商兜底，nil 表示不兜底
+	dedupPDFCodes bool               // 融合前按编码去重清洗后的PDF数据
+
+	semanticConcurrency int // 第二轮语义选择同时进行的LLM调用数上限，<=0 时按提供商并发配额计算
+
+	clock clock.Clock // 轮询、超时和退避等待的时间源，nil 时使用系统时钟
 }
 
+// LLM调用的指标阶段名称
+const (
+	metricsStageLLMCleaningGroup    = "llm_cleaning_group"    // 第一轮清洗中单个编码前缀分组的LLM调用
+	metricsStageLLMCleaningFallback = "llm_cleaning_fallback" // 第一轮清洗的单次回退调用
+	metricsStageLLMSemanticItem     = "llm_semantic_item"     // 第二轮语义选择中单个条目的LLM调用
+	metricsStageLLMSemanticFallback = "llm_semantic_fallback" // 第二轮失败后经单条重试恢复的条目，重试仍失败的条目记为错误
+	metricsStageLLMProviderFallback = "llm_provider_fallback" // LLM服务不可用时直连提供商的调用
+)
+
 // NewPDFLLMProcessor 创建新的处理器
 func NewPDFLLMProcessor(cfg *config.Config, db database.DatabaseInterface) *PDFLLMProcessor {
 	return &PDFLLMProcessor{
-		config: cfg,
-		db:     db,
-		httpClient: &http.Client{
-			Timeout: 120 * time.Second,
-		},
+		config:        cfg,
+		db:            db,
+		httpClient:    newServiceHTTPClient(getHTTPClientConfig(), 0),
 		llmServiceURL: getServiceURL(cfg, "llm-service", "8090"),
 		pdfServiceURL: getServiceURL(cfg, "pdf-validator", "8000"),
+		metrics:       NewMetricsCollector(),
+		retryConfig:   getLLMRetryConfig(),
+		parentDepth:   getParentHierarchyDepth(),
+		fallback:      newDirectLLMProvider(getLLMFallbackConfig()),
+		dedupPDFCodes: getPDFCodeDedup(),
+
+		semanticConcurrency: getSemanticConcurrency(),
+
+		clock: clock.Real(),
 	}
 }
 
+// SetMetricsCollector 使用外部的指标收集器，使LLM调用指标与调用方汇总在一起
+func (p *PDFLLMProcessor) SetMetricsCollector(metrics MetricsCollector) {
+	p.metrics = metrics
+}
+
+// SetRetryConfig 设置LLM调用的重试次数与退避参数
+func (p *PDFLLMProcessor) SetRetryConfig(retryConfig LLMServiceConfig) {
+	p.retryConfig = retryConfig
+}
+
+// SetHTTPConfig 按HTTP客户端配置重建调用LLM/PDF服务及直连兜底使用的HTTP客户端
+func (p *PDFLLMProcessor) SetHTTPConfig(httpConfig httpx.Config) {
+	p.httpClient = newServiceHTTPClient(httpConfig, 0)
+	if p.fallback != nil {
+		p.fallback.httpClient = newServiceHTTPClient(httpConfig, p.fallback.config.Timeout)
+	}
+}
+
+// SetSemanticConcurrency 设置第二轮语义选择同时进行的LLM调用数上限
+func (p *PDFLLMProcessor) SetSemanticConcurrency(n int) {
+	p.semanticConcurrency = n
+}
+
+// SetClock 替换时间源，测试中使用 clock.Fake 推进轮询和超时
+func (p *PDFLLMProcessor) SetClock(c clock.Clock) {
+	p.clock = c
+}
+
+// timeSource 返回注入的时间源，未注入时使用系统时钟
+func (p *PDFLLMProcessor) timeSource() clock.Clock {
+	return clock.OrReal(p.clock)
+}
+
+// GetMetrics 获取LLM调用指标
+func (p *PDFLLMProcessor) GetMetrics() ProcessingMetrics {
+	return p.metrics.GetMetrics()
+}
+
+// recordLLMCall 记录一次LLM调用的耗时和结果，可在并发goroutine中调用
+func (p *PDFLLMProcessor) recordLLMCall(stage string, startTime time.Time, err error) {
+	p.metrics.RecordProcessingDuration(stage, time.Since(startTime))
+	if err != nil {
+		p.metrics.RecordError(stage, err)
+		return
+	}
+	p.metrics.RecordSuccess(stage)
+}
+
 // ProcessWithPDFAndLLM 使用新的增量更新流程处理职业分类数据
 func (p *PDFLLMProcessor) ProcessWithPDFAndLLM(ctx context.Context, taskID string, excelPath string, categories []*model.Category) error {
 	// 使用新的增量处理器执行5步流程
@@ -83,7 +161,7 @@ func (p *PDFLLMProcessor) ProcessWithPDFAndLLMLegacy(ctx context.Context, taskID
 }
 
 // callPDFValidator 调用PDF验证服务
-func (p *PDFLLMProcessor) callPDFValidator(ctx context.Context, taskID string, _ string) (map[string]interface{}, error) {
+func (p *PDFLLMProcessor) callPDFValidator(ctx context.Context, taskID string, _ string) (PDFResult, error) {
 	// 使用固定的PDF文件路径，支持环境变量配置
 	pdfFilePath := os.Getenv("PDF_TEST_FILE_PATH")
 	if pdfFilePath == "" {
@@ -98,7 +176,7 @@ func (p *PDFLLMProcessor) callPDFValidator(ctx context.Context, taskID string, _
 	// 读取PDF文件
 	pdfFile, err := os.Open(pdfFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("无法打开PDF文件 %s: %w", pdfFilePath, err)
+		return PDFResult{}, fmt.Errorf("无法打开PDF文件 %s: %w", pdfFilePath, err)
 	}
 	defer pdfFile.Close()
 
@@ -109,54 +187,57 @@ func (p *PDFLLMProcessor) callPDFValidator(ctx context.Context, taskID string, _
 	// 添加文件字段
 	part, err := writer.CreateFormFile("file", filepath.Base(pdfFilePath))
 	if err != nil {
-		return nil, fmt.Errorf("创建form文件失败: %w", err)
+		return PDFResult{}, fmt.Errorf("创建form文件失败: %w", err)
 	}
 
 	if _, err := io.Copy(part, pdfFile); err != nil {
-		return nil, fmt.Errorf("复制文件内容失败: %w", err)
+		return PDFResult{}, fmt.Errorf("复制文件内容失败: %w", err)
 	}
 
 	// 添加validation_type字段
 	if err := writer.WriteField("validation_type", "standard"); err != nil {
-		return nil, fmt.Errorf("写入validation_type失败: %w", err)
+		return PDFResult{}, fmt.Errorf("写入validation_type失败: %w", err)
 	}
 
 	// 关闭writer
 	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("关闭multipart writer失败: %w", err)
+		return PDFResult{}, fmt.Errorf("关闭multipart writer失败: %w", err)
 	}
 
 	// 调用upload-and-validate接口
 	url := fmt.Sprintf("http://%s/api/v1/upload-and-validate", p.pdfServiceURL)
 	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
-		return nil, err
+		return PDFResult{}, err
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	// 发送请求
 	resp, err := p.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("调用PDF验证服务失败: %w", err)
+		return PDFResult{}, fmt.Errorf("调用PDF验证服务失败: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("PDF服务返回错误 %d: %s", resp.StatusCode, string(body))
+		return PDFResult{}, fmt.Errorf("PDF服务返回错误 %d: %s", resp.StatusCode, string(body))
 	}
 
 	// 获取验证任务ID
 	var validationResp map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&validationResp); err != nil {
-		return nil, err
+		return PDFResult{}, err
 	}
 
-	pdfTaskID := validationResp["task_id"].(string)
+	pdfTaskID, _ := validationResp["task_id"].(string)
+	if pdfTaskID == "" {
+		return PDFResult{}, fmt.Errorf("PDF服务未返回task_id: %v", validationResp)
+	}
 
 	// 等待处理完成
 	if err := p.waitForPDFCompletion(ctx, pdfTaskID); err != nil {
-		return nil, err
+		return PDFResult{}, err
 	}
 
 	// 获取职业编码结果
@@ -165,10 +246,11 @@ func (p *PDFLLMProcessor) callPDFValidator(ctx context.Context, taskID string, _
 
 // waitForPDFCompletion 等待PDF处理完成
 func (p *PDFLLMProcessor) waitForPDFCompletion(ctx context.Context, pdfTaskID string) error {
-	ticker := time.NewTicker(3 * time.Second) // 增加轮询间隔到3秒
+	clk := p.timeSource()
+	ticker := clk.NewTicker(3 * time.Second) // 增加轮询间隔到3秒
 	defer ticker.Stop()
 
-	timeout := time.After(180 * time.Second) // 增加到3分钟超时，给PDF处理更多时间
+	timeout := clk.After(180 * time.Second) // 增加到3分钟超时，给PDF处理更多时间
 
 	for {
 		select {
@@ -177,7 +259,7 @@ func (p *PDFLLMProcessor) waitForPDFCompletion(ctx context.Context, pdfTaskID st
 		case <-timeout:
 			// 超时后，尝试直接获取结果，可能已经完成但status接口有问题
 			return nil // 返回nil让调用方尝试获取结果
-		case <-ticker.C:
+		case <-ticker.C():
 			// 尝试检查状态，如果失败则继续等待
 			if completed, err := p.checkPDFStatus(ctx, pdfTaskID); err != nil {
 				// 忽略status接口的错误，继续等待
@@ -230,37 +312,38 @@ func (p *PDFLLMProcessor) checkPDFStatus(ctx context.Context, pdfTaskID string)
 	}
 }
 
-// getOccupationCodes 获取职业编码结果
-func (p *PDFLLMProcessor) getOccupationCodes(ctx context.Context, pdfTaskID string) (map[string]interface{}, error) {
+// getOccupationCodes 获取职业编码结果，转换为与 PDFServiceClient 相同的 PDFResult
+func (p *PDFLLMProcessor) getOccupationCodes(ctx context.Context, pdfTaskID string) (PDFResult, error) {
 	// 调用occupation-codes接口获取结果
 	url := fmt.Sprintf("http://%s/api/v1/blocks/%s/occupation-codes", p.pdfServiceURL, pdfTaskID)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, err
+		return PDFResult{}, err
 	}
 
 	resp, err := p.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("获取职业编码结果失败: %w", err)
+		return PDFResult{}, fmt.Errorf("获取职业编码结果失败: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("获取结果失败 %d: %s", resp.StatusCode, string(body))
+		return PDFResult{}, fmt.Errorf("获取结果失败 %d: %s", resp.StatusCode, string(body))
 	}
 
 	var result map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("解析结果失败: %w", err)
+		return PDFResult{}, fmt.Errorf("解析结果失败: %w", err)
 	}
 
-	return result, nil
+	return decodePDFResult(pdfTaskID, result, p.timeSource().Now())
 }
 
 // firstLLMAnalysis 第一轮LLM分析 - 清洗PDF解析结果（使用并发）
-func (p *PDFLLMProcessor) firstLLMAnalysis(ctx context.Context, pdfData map[string]interface{}) ([]map[string]interface{}, error) {
+func (p *PDFLLMProcessor) firstLLMAnalysis(ctx context.Context, pdfResult PDFResult) ([]map[string]interface{}, error) {
+	pdfData := pdfResult.cleaningInput()
 	fmt.Printf("🚀 [FirstLLMAnalysis-开始] pdfData keys数量: %d\n", len(pdfData))
 	
 	// 打印PDF数据的结构
@@ -318,29 +401,14 @@ func (p *PDFLLMProcessor) firstLLMAnalysisFallback(ctx context.Context, pdfData
 	// 调试信息：记录核心字段提取情况
 	fmt.Printf("DEBUG: firstLLMAnalysisFallback 提取了核心字段（只包含code和name）\n")
 
-	prompt := fmt.Sprintf(`你是一名数据清洗专家。请分析以下从PDF提取的职业分类数据，识别并提取准确的职业编码和名称。
-
-PDF提取的核心数据（已过滤只包含code和name）：
-%s
-
-请遵循以下规则进行清洗：
-1. 识别所有有效的职业编码（格式如：1-01-01-01）
-2. 为每个编码匹配最准确的职业名称
-3. 去除描述性文字和无关内容
-4. 修正明显的OCR识别错误
-
-输出格式要求：
-返回JSON数组，每个元素包含：
-{
-  "code": "职业编码",
-  "name": "职业名称",
-  "confidence": "置信度(0-1)",
-  "source": "pdf"
-}
-
-只返回JSON数组，不要有其他内容。`, jsonString(coreData))
+	prompt, err := currentPromptRegistry().Render(PromptStageCleaningFallback, PromptData{Data: jsonString(coreData)})
+	if err != nil {
+		return nil, err
+	}
 
+	startTime := time.Now()
 	result, err := p.callLLMService(ctx, "data_cleaning", prompt)
+	p.recordLLMCall(metricsStageLLMCleaningFallback, startTime, err)
 	if err != nil {
 		return nil, err
 	}
@@ -457,13 +525,62 @@ func tryParsePartialJSON(input string) []map[string]interface{} {
 }
 
 // SecondLLMAnalysis 第二轮LLM分析 - 使用任务类型轮询实现并发（导出供测试）
+// 同时进行的LLM调用数不超过 semanticConcurrency，避免叶子节点较多时瞬间提交大量任务触发限流
 func (p *PDFLLMProcessor) SecondLLMAnalysis(ctx context.Context, choices []SemanticChoiceItem) ([]map[string]interface{}, error) {
-	fmt.Printf("🤖 [SecondLLMAnalysis-开始] 开始第二轮LLM分析，待处理条目数: %d\n", len(choices))
-	// 定义可用的任务类型池，只使用LLM服务已配置路由的类型
-	taskTypes := []string{
-		"semantic_analysis", // 主要用于语义分析
-		"data_cleaning",     // 复用数据清洗队列
+	results, errs := p.analyzeChoices(ctx, choices)
+	errorCount := 0
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		errorCount++
+		// 使用默认值
+		results[i] = map[string]interface{}{
+			"code":        choices[i].Code,
+			"name":        choices[i].RuleName, // 默认使用规则名称
+			"level":       "细类",
+			"parent_code": inferParentCode(choices[i].Code),
+		}
+	}
+
+	if errorCount > len(choices)/2 {
+		fmt.Printf("❌ [SecondLLMAnalysis-错误] 超过50%%的条目处理失败\n")
+		return results, fmt.Errorf("超过50%%的条目处理失败(%d/%d)", errorCount, len(choices))
+	}
+
+	fmt.Printf("✅ [SecondLLMAnalysis-完成] 返回有效结果=%d条\n", len(results))
+	return results, nil
+}
+
+// SemanticItemFailure 第二轮语义选择中失败的条目
+type SemanticItemFailure struct {
+	Choice SemanticChoiceItem
+	Err    error
+}
+
+// AnalyzeChoices 逐条执行第二轮语义选择，按输入顺序返回成功的结果和失败的条目；
+// 与 SecondLLMAnalysis 不同，失败的条目不以规则名称填充默认结果，由调用方决定是否重试
+func (p *PDFLLMProcessor) AnalyzeChoices(ctx context.Context, choices []SemanticChoiceItem) ([]map[string]interface{}, []SemanticItemFailure) {
+	results, errs := p.analyzeChoices(ctx, choices)
+	succeeded := make([]map[string]interface{}, 0, len(choices))
+	var failures []SemanticItemFailure
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, SemanticItemFailure{Choice: choices[i], Err: err})
+			continue
+		}
+		succeeded = append(succeeded, results[i])
+	}
+	return succeeded, failures
+}
+
+// analyzeChoices 以有限并发逐条分析，返回与输入对齐的结果和错误，失败条目的结果为 nil
+func (p *PDFLLMProcessor) analyzeChoices(ctx context.Context, choices []SemanticChoiceItem) ([]map[string]interface{}, []error) {
+	concurrency := p.semanticConcurrency
+	if concurrency <= 0 {
+		concurrency = semanticConcurrencyFromQuota(getOptimizedConcurrencyConfig())
 	}
+	fmt.Printf("🤖 [SecondLLMAnalysis-开始] 开始第二轮LLM分析，待处理条目数: %d, 并发上限: %d\n", len(choices), concurrency)
 
 	// 结果收集
 	type itemResult struct {
@@ -473,25 +590,33 @@ func (p *PDFLLMProcessor) SecondLLMAnalysis(ctx context.Context, choices []Seman
 	}
 
 	resultCh := make(chan itemResult, len(choices))
+	jobs := make(chan int, len(choices))
+	for i := range choices {
+		jobs <- i
+	}
+	close(jobs)
 
-	// 使用goroutine池处理，每个goroutine使用不同的任务类型
+	// 固定数量的worker按序号领取条目，每个条目按序号轮询分配任务类型
+	workers := min(concurrency, len(choices))
 	var wg sync.WaitGroup
-	for i, choice := range choices {
+	for w := 0; w < workers; w++ {
 		wg.Add(1)
-		// 轮询分配任务类型
-		taskType := taskTypes[i%len(taskTypes)]
-
-		go func(idx int, item SemanticChoiceItem, tType string) {
+		go func() {
 			defer wg.Done()
-
-			// 单条处理，使用分配的任务类型
-			result, err := p.analyzeSingleChoice(ctx, item, tType)
-			resultCh <- itemResult{
-				index:  idx,
-				result: result,
-				err:    err,
+			for idx := range jobs {
+				taskType := semanticTaskTypes[idx%len(semanticTaskTypes)]
+
+				// 单条处理，使用分配的任务类型
+				startTime := time.Now()
+				result, err := p.analyzeSingleChoice(ctx, choices[idx], taskType)
+				p.recordLLMCall(metricsStageLLMSemanticItem, startTime, err)
+				resultCh <- itemResult{
+					index:  idx,
+					result: result,
+					err:    err,
+				}
 			}
-		}(i, choice, taskType)
+		}()
 	}
 
 	// 等待所有goroutine完成
@@ -502,6 +627,7 @@ func (p *PDFLLMProcessor) SecondLLMAnalysis(ctx context.Context, choices []Seman
 
 	// 收集结果并保持顺序
 	results := make([]map[string]interface{}, len(choices))
+	errs := make([]error, len(choices))
 	errorCount := 0
 
 	for res := range resultCh {
@@ -509,13 +635,7 @@ func (p *PDFLLMProcessor) SecondLLMAnalysis(ctx context.Context, choices []Seman
 			errorCount++
 			fmt.Printf("  ❌ [LLM处理失败] 条目 %d (Code=%s) 失败: %v\n", 
 				res.index, choices[res.index].Code, res.err)
-			// 使用默认值
-			results[res.index] = map[string]interface{}{
-				"code":        choices[res.index].Code,
-				"name":        choices[res.index].RuleName, // 默认使用规则名称
-				"level":       "细类",
-				"parent_code": inferParentCode(choices[res.index].Code),
-			}
+			errs[res.index] = res.err
 		} else {
 			if res.index < 3 { // 打印前3个成功的结果
 				fmt.Printf("  ✅ [LLM处理成功] 条目 %d (Code=%s): %+v\n", 
@@ -527,54 +647,24 @@ func (p *PDFLLMProcessor) SecondLLMAnalysis(ctx context.Context, choices []Seman
 
 	fmt.Printf("📊 [SecondLLMAnalysis-统计] 总条目=%d, 成功=%d, 失败=%d\n", 
 		len(choices), len(choices)-errorCount, errorCount)
-	
-	if errorCount > len(choices)/2 {
-		fmt.Printf("❌ [SecondLLMAnalysis-错误] 超过50%%的条目处理失败\n")
-		return results, fmt.Errorf("超过50%%的条目处理失败(%d/%d)", errorCount, len(choices))
-	}
-
-	// 过滤掉nil结果
-	var finalResults []map[string]interface{}
-	for _, r := range results {
-		if r != nil {
-			finalResults = append(finalResults, r)
-		}
-	}
-
-	fmt.Printf("✅ [SecondLLMAnalysis-完成] 返回有效结果=%d条\n", len(finalResults))
-	return finalResults, nil
+	return results, errs
 }
 
 // analyzeSingleChoice 分析单个选择项，使用指定的任务类型
 func (p *PDFLLMProcessor) analyzeSingleChoice(ctx context.Context, choice SemanticChoiceItem, taskType string) (map[string]interface{}, error) {
 	// 构建单条数据的精确提示
-	prompt := fmt.Sprintf(`你是职业分类专家.请为以下职业编码选择最合适的名称:
-
-编码:%s
-选项1:%s
-选项2:%s
-父级类别:%s
-
-选择规则:
-- 只能选择选项1或选项2,不能创造新名称。
-- 选择与父级层次语义更连贯的名称
-- 优先选择完整的、名词性的职业名称
-- 如果两个名称相似,选择更完整、更规范的版本
-- 排除包含"本小类包括"、"进行..."、"担任..."等描述性短语
-
-返回JSON格式:
-{
-  "code": "编码",
-  "name": "选择后的名称",
-  "parent_name": "父级类别名称"
-}`,
-		choice.Code,
-		choice.RuleName,
-		choice.PdfName,
-		choice.ParentHierarchy)
-
-	// 使用指定的任务类型调用LLM服务
-	result, err := p.callLLMServiceWithRetry(ctx, taskType, prompt, 3)
+	prompt, err := currentPromptRegistry().Render(PromptStageSemanticChoice, PromptData{
+		Code:            choice.Code,
+		RuleName:        choice.RuleName,
+		PDFName:         choice.PdfName,
+		ParentHierarchy: choice.ParentHierarchy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用指定的任务类型调用LLM服务，服务不可用时按配置使用直连提供商兜底
+	result, err := p.callLLMService(ctx, taskType, prompt)
 	if err != nil {
 		return nil, err
 	}
@@ -651,23 +741,24 @@ type SemanticChoiceItem struct {
 
 // MergeResults 融合规则解析结果和PDF清洗结果为语义选择结构（导出供测试）
 func (p *PDFLLMProcessor) MergeResults(categories []*model.Category, pdfData []map[string]interface{}) []SemanticChoiceItem {
-	// 构建父子关系映射 - 只记录直接父级名称
-	parentNameMap := make(map[string]string)
+	// 构建父子关系映射 - 记录每个节点的名称和父级编码，用于拼接祖先路径
+	nameMap := make(map[string]string)
+	parentCodeMap := make(map[string]string)
 	var buildParentMap func([]*model.Category, string)
-	buildParentMap = func(cats []*model.Category, parentName string) {
+	buildParentMap = func(cats []*model.Category, parentCode string) {
 		for _, cat := range cats {
 			if cat == nil {
 				continue
 			}
 
-			// 记录当前节点的父级名称
-			if parentName != "" {
-				parentNameMap[cat.Code] = parentName
+			nameMap[cat.Code] = cat.Name
+			if parentCode != "" {
+				parentCodeMap[cat.Code] = parentCode
 			}
 
-			// 递归处理子节点，当前节点名称作为子节点的父级名称
+			// 递归处理子节点，当前节点作为子节点的父级
 			if len(cat.Children) > 0 {
-				buildParentMap(cat.Children, cat.Name)
+				buildParentMap(cat.Children, cat.Code)
 			}
 		}
 	}
@@ -692,13 +783,29 @@ func (p *PDFLLMProcessor) MergeResults(categories []*model.Category, pdfData []m
 	}
 	collectDetailedCodes(categories)
 
-	// 收集PDF数据
+	// 收集PDF数据，先规范化全角编码，同一编码出现多次时保留置信度最高的条目
+	normalizePDFCodes(pdfData)
+	if p.dedupPDFCodes {
+		var conflicts []PDFCodeConflict
+		pdfData, conflicts = dedupPDFCodes(pdfData)
+		if len(conflicts) > 0 {
+			fmt.Printf("⚠️ [融合] PDF数据中 %d 个编码重复，已保留置信度最高的条目\n", len(conflicts))
+		}
+	}
 	pdfDataMap := make(map[string]string)
+	skipped := 0
 	for _, pdfItem := range pdfData {
-		code := pdfItem["code"].(string)
-		name := pdfItem["name"].(string)
+		code, name, ok := itemCodeAndName(pdfItem)
+		if !ok {
+			skipped++
+			continue
+		}
 		pdfDataMap[code] = name
 	}
+	if skipped > 0 {
+		fmt.Printf("⚠️ [融合] 跳过 %d 条缺少编码或名称的PDF清洗结果\n", skipped)
+	}
+	backfillPDFParents(pdfDataMap, nameMap, parentCodeMap)
 
 	// 创建语义选择项
 	var choices []SemanticChoiceItem
@@ -713,14 +820,14 @@ func (p *PDFLLMProcessor) MergeResults(categories []*model.Category, pdfData []m
 	}
 
 	for code := range allCodes {
-		// 获取直接父级名称
-		parentName := parentNameMap[code] // 如果没有父级则为空字符串
+		// 按配置的层数拼接祖先名称，如果没有父级则为空字符串
+		parentHierarchy := buildParentHierarchy(parentCodeMap[code], nameMap, parentCodeMap, p.parentDepth)
 
 		choice := SemanticChoiceItem{
 			Code:            code,
 			RuleName:        ruleData[code],   // 如果没有则为空
 			PdfName:         pdfDataMap[code], // 如果没有则为空
-			ParentHierarchy: parentName,       // 只包含直接父级名称
+			ParentHierarchy: parentHierarchy,
 		}
 
 		// 只有至少有一个名称才加入
@@ -732,40 +839,70 @@ func (p *PDFLLMProcessor) MergeResults(categories []*model.Category, pdfData []m
 	return choices
 }
 
+// backfillPDFParents 为规则骨架中没有的PDF编码补全祖先路径所需的父级关系和名称：
+// 父编码按编码推断，名称优先取规则数据，其次取PDF数据，规则骨架中已有的关系不变
+func backfillPDFParents(pdfDataMap, nameMap, parentCodeMap map[string]string) {
+	for code := range pdfDataMap {
+		for c := code; ; {
+			if _, inRule := nameMap[c]; inRule {
+				break
+			}
+			parent := inferParentCode(c)
+			if parent == "" {
+				break
+			}
+			parentCodeMap[c] = parent
+			c = parent
+		}
+	}
+	for code, name := range pdfDataMap {
+		if _, inRule := nameMap[code]; !inRule && name != "" {
+			nameMap[code] = name
+		}
+	}
+}
+
 // callLLMService 调用LLM服务（使用异步方式）
+// 服务不可用且重试耗尽时，如启用了直连兜底则直接调用提供商，调用结果记入 llm_provider_fallback 指标
 func (p *PDFLLMProcessor) callLLMService(ctx context.Context, taskType string, prompt string) (string, error) {
 	// 使用带重试的异步调用
-	return p.callLLMServiceWithRetry(ctx, taskType, prompt, 3)
-}
-
-// saveFinalResult 保存最终结果到数据库
-func (p *PDFLLMProcessor) saveFinalResult(ctx context.Context, taskID string, finalData []map[string]interface{}) error {
-	// 先删除旧的分类数据 - 通过直接使用GORM
-	pgDB, ok := p.db.(*database.PostgreSQLDB)
-	if !ok {
-		return fmt.Errorf("数据库类型错误")
+	result, err := p.callLLMServiceWithRetry(ctx, taskType, prompt)
+	if err == nil || p.fallback == nil || ctx.Err() != nil || !isRetryableLLMError(err) {
+		return result, err
 	}
 
-	// 删除旧数据
-	if err := pgDB.GetDB().WithContext(ctx).Where("task_id = ?", taskID).Delete(&database.Category{}).Error; err != nil {
-		return fmt.Errorf("删除旧分类数据失败: %w", err)
+	fmt.Printf("⚠️ LLM服务不可用，使用直连提供商 %s 兜底 - taskType: %s, 原因: %v\n", p.fallback.config.Provider, taskType, err)
+	startTime := time.Now()
+	result, fallbackErr := p.fallback.Complete(ctx, taskType, prompt)
+	p.recordLLMCall(metricsStageLLMProviderFallback, startTime, fallbackErr)
+	if fallbackErr != nil {
+		return "", fmt.Errorf("%w；直连提供商兜底失败: %v", err, fallbackErr)
 	}
+	return result, nil
+}
 
-	// 转换并保存新的分类数据
+// saveFinalResult 保存最终结果到数据库，缺少编码或名称的结果跳过；没有可保存的结果时保留旧数据
+func (p *PDFLLMProcessor) saveFinalResult(ctx context.Context, taskID string, finalData []map[string]interface{}) error {
+	// 转换新的分类数据
 	var categories []*database.Category
+	skipped := 0
 	for _, item := range finalData {
+		code, name, ok := itemCodeAndName(item)
+		if !ok {
+			skipped++
+			continue
+		}
 		// Level 字段应该是字符串类型（大类/中类/小类/细类）
 		levelStr, ok := item["level"].(string)
 		if !ok {
 			// 如果不是字符串，尝试根据code推断
-			code := item["code"].(string)
 			levelStr = inferLevelFromCode(code)
 		}
 
 		cat := &database.Category{
 			TaskID:     taskID,
-			Code:       item["code"].(string),
-			Name:       item["name"].(string),
+			Code:       code,
+			Name:       name,
 			Level:      levelStr,
 			ParentCode: "",
 		}
@@ -776,10 +913,42 @@ func (p *PDFLLMProcessor) saveFinalResult(ctx context.Context, taskID string, fi
 
 		categories = append(categories, cat)
 	}
+	if skipped > 0 {
+		fmt.Printf("⚠️ 跳过 %d 条缺少编码或名称的最终结果\n", skipped)
+	}
+	if len(categories) == 0 {
+		return fmt.Errorf("没有可保存的最终结果（共 %d 条，跳过 %d 条）", len(finalData), skipped)
+	}
 
-	// 批量插入 - 使用上面已经获取的pgDB
-	if err := pgDB.GetDB().WithContext(ctx).CreateInBatches(categories, 100).Error; err != nil {
-		return fmt.Errorf("批量插入失败: %w", err)
+	// 在一个事务中替换当前版本，历史版本保持不变，插入失败时当前版本不受影响
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 新记录沿用当前版本的批次ID，没有当前版本时生成新批次
+		var current database.Category
+		err := tx.Select("upload_batch_id").Where("task_id = ? AND is_current = true", taskID).Take(&current).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("查询当前版本失败: %w", err)
+		}
+		batchID := current.UploadBatchID
+		if batchID == "" {
+			batchID = uuid.New().String()
+		}
+		now := p.timeSource().Now()
+		for _, cat := range categories {
+			cat.UploadBatchID = batchID
+			cat.UploadTimestamp = now
+			cat.IsCurrent = true
+		}
+
+		if err := tx.Where("task_id = ? AND is_current = true", taskID).Delete(&database.Category{}).Error; err != nil {
+			return fmt.Errorf("删除旧分类数据失败: %w", err)
+		}
+		if err := tx.CreateInBatches(categories, 100).Error; err != nil {
+			return fmt.Errorf("批量插入失败: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	// 更新任务状态
@@ -795,11 +964,21 @@ func (p *PDFLLMProcessor) saveFinalResult(ctx context.Context, taskID string, fi
 		"total_categories": len(categories),
 	})
 	task.Result = datatypes.JSON(resultJSON)
-	task.UpdatedAt = time.Now()
+	task.UpdatedAt = p.timeSource().Now()
 
 	return p.db.UpdateTask(ctx, task)
 }
 
+// itemCodeAndName 读取LLM结果中的编码和名称，LLM输出不可信，任一字段缺失、为空或不是字符串时返回 false
+func itemCodeAndName(item map[string]interface{}) (string, string, bool) {
+	code, _ := item["code"].(string)
+	name, _ := item["name"].(string)
+	if strings.TrimSpace(code) == "" || strings.TrimSpace(name) == "" {
+		return "", "", false
+	}
+	return code, name, true
+}
+
 // getServiceURL 获取服务URL
 func getServiceURL(cfg *config.Config, serviceName string, defaultPort string) string {
 	// 根据服务名称返回对应的URL
@@ -14,12 +14,14 @@ import (
 
 // LLMTaskRequest LLM任务请求
 type LLMTaskRequest struct {
-	TaskType   string                 `json:"type"`
-	Prompt     string                 `json:"prompt"`
-	Model      string                 `json:"model,omitempty"`
-	Priority   string                 `json:"priority,omitempty"`
-	Parameters map[string]interface{} `json:"parameters,omitempty"`
-	Callback   *CallbackConfig        `json:"callback,omitempty"`
+	TaskType      string                 `json:"type"`
+	Prompt        string                 `json:"prompt"`
+	Model         string                 `json:"model,omitempty"`
+	Priority      string                 `json:"priority,omitempty"`
+	Deterministic bool                   `json:"deterministic,omitempty"` // 确定性模式（温度0+固定seed）
+	Parameters    map[string]interface{} `json:"parameters,omitempty"`
+	Callback      *CallbackConfig        `json:"callback,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"` // 上游任务ID和步骤，用于跨服务关联
 }
 
 // CallbackConfig 回调配置
@@ -41,13 +43,21 @@ type LLMTaskStatus struct {
 	Status      string                 `json:"status"`
 	Result      interface{}            `json:"result,omitempty"`
 	Error       string                 `json:"error,omitempty"`
+	Truncated   bool                   `json:"truncated,omitempty"` // 输出因max_tokens不足被截断
 	Progress    float64                `json:"progress"`
 	CreatedAt   time.Time              `json:"created_at"`
 	StartedAt   *time.Time             `json:"started_at,omitempty"`
 	CompletedAt *time.Time             `json:"completed_at,omitempty"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	TokenUsage  *LLMTokenUsage         `json:"token_usage,omitempty"`
 }
 
+// 轮询LLM任务结果的间隔和最长等待时间
+const (
+	llmPollInterval  = 2 * time.Second
+	llmResultTimeout = 5 * time.Minute
+)
+
 // callLLMServiceAsync 异步调用LLM服务
 func (p *PDFLLMProcessor) callLLMServiceAsync(ctx context.Context, taskType string, prompt string) (string, error) {
 	fmt.Printf("📨 DEBUG: callLLMServiceAsync 开始 - taskType: %s, prompt长度: %d\n", taskType, len(prompt))
@@ -81,7 +91,9 @@ func (p *PDFLLMProcessor) submitLLMTask(ctx context.Context, taskType string, pr
 		TaskType: taskType,
 		Prompt:   prompt,
 		// Model:    "moonshot-v1-128k", // 使用128K token的模型
-		Priority: "normal", // 普通优先级（字符串类型）
+		Priority:      "normal", // 普通优先级（字符串类型）
+		Deterministic: getLLMDeterministic(),
+		Metadata:      llmMetadataFromContext(ctx),
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -111,7 +123,7 @@ func (p *PDFLLMProcessor) submitLLMTask(ctx context.Context, taskType string, pr
 	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
 		fmt.Printf("❌ DEBUG: submitLLMTask 响应状态错误 %d: %s\n", resp.StatusCode, string(body))
-		return "", fmt.Errorf("LLM服务返回错误 %d: %s", resp.StatusCode, string(body))
+		return "", &LLMServiceError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var taskResp LLMTaskResponse
@@ -120,18 +132,19 @@ func (p *PDFLLMProcessor) submitLLMTask(ctx context.Context, taskType string, pr
 		return "", err
 	}
 
-	fmt.Printf("✅ DEBUG: submitLLMTask 成功 - taskID: %s\n", taskResp.TaskID)
+	fmt.Printf("✅ DEBUG: submitLLMTask 成功 - taskID: %s, metadata: %v\n", taskResp.TaskID, reqBody.Metadata)
 	return taskResp.TaskID, nil
 }
 
 // waitForLLMResult 等待LLM任务完成
 func (p *PDFLLMProcessor) waitForLLMResult(ctx context.Context, taskID string) (string, error) {
 	fmt.Printf("⏳ DEBUG: waitForLLMResult 开始等待 - taskID: %s\n", taskID)
-	ticker := time.NewTicker(2 * time.Second)
+	clk := p.timeSource()
+	ticker := clk.NewTicker(llmPollInterval)
 	defer ticker.Stop()
 
 	// 最长等待5分钟
-	timeout := time.After(5 * time.Minute)
+	timeout := clk.After(llmResultTimeout)
 	checkCount := 0
 
 	for {
@@ -142,7 +155,7 @@ func (p *PDFLLMProcessor) waitForLLMResult(ctx context.Context, taskID string) (
 		case <-timeout:
 			fmt.Printf("⏰ DEBUG: waitForLLMResult 超时 - taskID: %s, 检查次数: %d\n", taskID, checkCount)
 			return "", fmt.Errorf("等待LLM任务超时")
-		case <-ticker.C:
+		case <-ticker.C():
 			checkCount++
 			fmt.Printf("🔍 DEBUG: waitForLLMResult 第%d次检查状态 - taskID: %s\n", checkCount, taskID)
 			status, err := p.checkLLMTaskStatus(ctx, taskID)
@@ -156,6 +169,13 @@ func (p *PDFLLMProcessor) waitForLLMResult(ctx context.Context, taskID string) (
 
 			switch status.Status {
 			case "completed", "success":
+				// 截断的结果同样消耗了token，先计入处理报告
+				reportCollectorFrom(ctx).addTokenUsage(status.TokenUsage)
+				// 被截断的结果是不完整的JSON，不能直接解析
+				if status.Truncated {
+					fmt.Printf("✂️ DEBUG: waitForLLMResult 结果被截断 - taskID: %s\n", taskID)
+					return "", ErrLLMResultTruncated
+				}
 				// status.Result 已经是字符串格式的JSON，直接转换即可
 				var resultStr string
 				if status.Result == nil {
@@ -177,7 +197,7 @@ func (p *PDFLLMProcessor) waitForLLMResult(ctx context.Context, taskID string) (
 			case "failed", "error":
 				if status.Error != "" {
 					fmt.Printf("💥 DEBUG: waitForLLMResult 任务失败 - taskID: %s, 错误: %s\n", taskID, status.Error)
-					return "", fmt.Errorf("LLM任务失败: %s", status.Error)
+					return "", fmt.Errorf("LLM任务失败: %w", llmTaskFailure(status.Error))
 				}
 				fmt.Printf("💥 DEBUG: waitForLLMResult 任务失败 - taskID: %s, 未知错误\n", taskID)
 				return "", fmt.Errorf("LLM任务失败")
@@ -229,42 +249,27 @@ func (p *PDFLLMProcessor) checkLLMTaskStatus(ctx context.Context, taskID string)
 	return &status, nil
 }
 
-// callLLMServiceWithRetry 带重试的LLM服务调用
-func (p *PDFLLMProcessor) callLLMServiceWithRetry(ctx context.Context, taskType string, prompt string, maxRetries int) (string, error) {
-	fmt.Printf("🔄 DEBUG: callLLMServiceWithRetry 开始 - taskType: %s, maxRetries: %d\n", taskType, maxRetries)
-	var lastErr error
-
-	for i := 0; i < maxRetries; i++ {
-		fmt.Printf("🔄 DEBUG: callLLMServiceWithRetry 第%d次尝试\n", i+1)
-		
-		if i > 0 {
-			// 指数退避
-			backoff := time.Duration(i*i) * time.Second
-			if backoff > 30*time.Second {
-				backoff = 30 * time.Second
-			}
-			fmt.Printf("🔄 DEBUG: callLLMServiceWithRetry 等待 %v 后重试\n", backoff)
-			time.Sleep(backoff)
-		}
-
-		fmt.Printf("🔄 DEBUG: callLLMServiceWithRetry 调用 callLLMServiceAsync\n")
-		result, err := p.callLLMServiceAsync(ctx, taskType, prompt)
-		if err == nil {
-			fmt.Printf("✅ DEBUG: callLLMServiceWithRetry 成功获取结果, 长度: %d\n", len(result))
-			return result, nil
-		}
+// callLLMServiceWithRetry 带重试的LLM服务调用，重试次数和退避参数由 retryConfig 决定
+func (p *PDFLLMProcessor) callLLMServiceWithRetry(ctx context.Context, taskType string, prompt string) (string, error) {
+	fmt.Printf("🔄 DEBUG: callLLMServiceWithRetry 开始 - taskType: %s, maxRetries: %d\n", taskType, p.retryConfig.MaxRetries)
+	if err := checkPromptSize(taskType, prompt); err != nil {
+		return "", err
+	}
 
-		fmt.Printf("❌ DEBUG: callLLMServiceWithRetry 第%d次失败: %v\n", i+1, err)
-		lastErr = err
-		// 如果是上下文取消，立即返回
-		if ctx.Err() != nil {
-			fmt.Printf("🚫 DEBUG: callLLMServiceWithRetry 上下文取消: %v\n", ctx.Err())
-			return "", ctx.Err()
-		}
+	result, attempts, err := retryLLMCall(ctx, p.timeSource(), p.retryConfig, func() (string, error) {
+		return p.callLLMServiceAsync(ctx, taskType, prompt)
+	})
+	if err == nil {
+		fmt.Printf("✅ DEBUG: callLLMServiceWithRetry 成功获取结果, 长度: %d\n", len(result))
+		return result, nil
+	}
+	if ctx.Err() != nil {
+		fmt.Printf("🚫 DEBUG: callLLMServiceWithRetry 上下文取消: %v\n", ctx.Err())
+		return "", ctx.Err()
 	}
 
-	fmt.Printf("💥 DEBUG: callLLMServiceWithRetry 所有重试失败\n")
-	return "", fmt.Errorf("LLM服务调用失败（重试%d次）: %w", maxRetries, lastErr)
+	fmt.Printf("💥 DEBUG: callLLMServiceWithRetry 调用失败（尝试%d次）: %v\n", attempts, err)
+	return "", fmt.Errorf("LLM服务调用失败（尝试%d次）: %w", attempts, err)
 }
 
 // ProcessWithCallback 带回调的处理
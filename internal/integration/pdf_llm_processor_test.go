@@ -0,0 +1,366 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/clock"
+	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// TestPDFLLMProcessor_SecondLLMAnalysisRecordsMetrics 测试并发语义分析记录每个条目的LLM调用指标
+func TestPDFLLMProcessor_SecondLLMAnalysisRecordsMetrics(t *testing.T) {
+	server := newFakeLLMService(t)
+	defer server.Close()
+
+	metrics := NewMetricsCollector()
+	processor := &PDFLLMProcessor{
+		httpClient:    server.Client(),
+		llmServiceURL: strings.TrimPrefix(server.URL, "http://"),
+		metrics:       NewMetricsCollector(),
+	}
+	processor.SetMetricsCollector(metrics)
+
+	var choices []SemanticChoiceItem
+	for i := 0; i < 12; i++ {
+		choices = append(choices, SemanticChoiceItem{
+			Code:     fmt.Sprintf("1-01-01-%02d", i),
+			RuleName: fmt.Sprintf("规则名称%d", i),
+		})
+	}
+
+	// 处理期间并发读取指标，配合 -race 检查数据竞争
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = processor.GetMetrics()
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}()
+
+	results, err := processor.SecondLLMAnalysis(context.Background(), choices)
+	close(done)
+	require.NoError(t, err)
+	require.Len(t, results, len(choices))
+	assert.Equal(t, "名称1-01-01-00", results[0]["name"])
+
+	snapshot := metrics.GetMetrics()
+	assert.Equal(t, int64(len(choices)), snapshot.SuccessCount)
+	assert.Equal(t, int64(0), snapshot.ErrorCount)
+	// 每个条目记录一次时长和一次成功
+	assert.Equal(t, int64(2*len(choices)), snapshot.StageMetrics[metricsStageLLMSemanticItem].Count)
+}
+
+// TestPDFLLMProcessor_SecondLLMAnalysisConcurrencyCap 测试同时进行的LLM调用数不超过配置的上限，结果顺序与输入一致
+func TestPDFLLMProcessor_SecondLLMAnalysisConcurrencyCap(t *testing.T) {
+	const concurrencyCap = 3
+	fake := newFakeLLMService(t)
+
+	// 任务提交后到第一次查询返回完成之前视为进行中
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				prev := atomic.LoadInt32(&maxInFlight)
+				if n <= prev || atomic.CompareAndSwapInt32(&maxInFlight, prev, n) {
+					break
+				}
+			}
+		} else {
+			defer atomic.AddInt32(&inFlight, -1)
+		}
+		fake.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	processor := &PDFLLMProcessor{
+		httpClient:    server.Client(),
+		llmServiceURL: strings.TrimPrefix(server.URL, "http://"),
+		metrics:       NewMetricsCollector(),
+	}
+	processor.SetSemanticConcurrency(concurrencyCap)
+
+	var choices []SemanticChoiceItem
+	for i := 0; i < 2*concurrencyCap; i++ {
+		choices = append(choices, SemanticChoiceItem{
+			Code:     fmt.Sprintf("1-01-01-%02d", i),
+			RuleName: fmt.Sprintf("规则名称%d", i),
+		})
+	}
+
+	results, err := processor.SecondLLMAnalysis(context.Background(), choices)
+	require.NoError(t, err)
+	require.Len(t, results, len(choices))
+	for i, result := range results {
+		assert.Equal(t, choices[i].Code, result["code"])
+	}
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(concurrencyCap))
+	assert.Equal(t, int32(concurrencyCap), atomic.LoadInt32(&maxInFlight))
+
+	// 任务类型仍按序号轮询
+	taskTypes := make(map[string]int)
+	for _, req := range fake.Requests() {
+		taskTypes[req.TaskType]++
+	}
+	assert.Equal(t, map[string]int{"semantic_analysis": concurrencyCap, "data_cleaning": concurrencyCap}, taskTypes)
+}
+
+// TestSemanticConcurrencyFromQuota 测试默认并发上限取轮询任务类型的配额之和，并受全局上限约束
+func TestSemanticConcurrencyFromQuota(t *testing.T) {
+	cfg := getOptimizedConcurrencyConfig()
+	assert.Equal(t, 5, semanticConcurrencyFromQuota(cfg))
+
+	cfg.GlobalQuotas.MaxConcurrent = 4
+	assert.Equal(t, 4, semanticConcurrencyFromQuota(cfg))
+
+	assert.Equal(t, 1, semanticConcurrencyFromQuota(ConcurrencyConfig{}))
+
+	t.Setenv("LLM_SEMANTIC_CONCURRENCY", "8")
+	assert.Equal(t, 8, getSemanticConcurrency())
+	t.Setenv("LLM_SEMANTIC_CONCURRENCY", "0")
+	assert.Equal(t, 5, getSemanticConcurrency())
+}
+
+// TestPDFLLMProcessor_RecordLLMCallConcurrent 测试并发记录LLM调用指标
+func TestPDFLLMProcessor_RecordLLMCallConcurrent(t *testing.T) {
+	processor := &PDFLLMProcessor{metrics: NewMetricsCollector()}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%5 == 0 {
+				err = errors.New("LLM服务不可用")
+			}
+			processor.recordLLMCall(metricsStageLLMCleaningGroup, time.Now(), err)
+			_ = processor.GetMetrics()
+		}(i)
+	}
+	wg.Wait()
+
+	snapshot := processor.GetMetrics()
+	assert.Equal(t, int64(40), snapshot.SuccessCount)
+	assert.Equal(t, int64(10), snapshot.ErrorCount)
+	assert.Len(t, snapshot.StageMetrics[metricsStageLLMCleaningGroup].Errors, 10)
+}
+
+// TestBatchProcessor_FailureTolerance 测试失败分组未超过容忍度时返回其余分组的结果
+func TestBatchProcessor_FailureTolerance(t *testing.T) {
+	// 大类4的分组始终返回无法解析的结果
+	server := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		if strings.Contains(req.Prompt, `"4-01-01-01"`) {
+			return LLMTaskStatus{Status: "completed", Result: "无法解析的输出"}
+		}
+		var items []map[string]interface{}
+		for _, code := range []string{"1-01-01-01", "2-01-01-01", "3-01-01-01"} {
+			if strings.Contains(req.Prompt, `"`+code+`"`) {
+				items = append(items, map[string]interface{}{"code": code, "name": "名称" + code})
+			}
+		}
+		return LLMTaskStatus{Status: "completed", Result: items}
+	})
+
+	processor := &PDFLLMProcessor{
+		httpClient:    server.Client(),
+		llmServiceURL: server.Host(),
+		metrics:       NewMetricsCollector(),
+	}
+	var codes []interface{}
+	for _, code := range []string{"1-01-01-01", "2-01-01-01", "3-01-01-01", "4-01-01-01"} {
+		codes = append(codes, map[string]interface{}{"code": code, "name": "原始" + code})
+	}
+	pdfData := map[string]interface{}{"occupation_codes": codes}
+
+	batchProcessor := NewBatchProcessor(processor)
+	batchProcessor.failureTolerance = 0.25
+	results, err := batchProcessor.ProcessPDFDataConcurrently(context.Background(), pdfData)
+	require.NoError(t, err)
+	assert.Len(t, results, 3)
+
+	// 容忍度为0时任一分组失败即返回错误
+	batchProcessor.failureTolerance = 0
+	_, err = batchProcessor.ProcessPDFDataConcurrently(context.Background(), pdfData)
+	assert.Error(t, err)
+
+	assert.True(t, batchProcessor.withinFailureTolerance(0, 0))
+	batchProcessor.failureTolerance = 1
+	assert.False(t, batchProcessor.withinFailureTolerance(4, 4), "全部分组失败时始终返回错误")
+}
+
+// TestPDFLLMProcessor_WaitForLLMResultTimeoutUsesClock 测试推进假时钟触发状态轮询和等待超时
+func TestPDFLLMProcessor_WaitForLLMResultTimeoutUsesClock(t *testing.T) {
+	var polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&polls, 1)
+		fmt.Fprint(w, `{"task_id":"task-1","status":"processing","progress":0.5}`)
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	processor := &PDFLLMProcessor{
+		httpClient:    server.Client(),
+		llmServiceURL: strings.TrimPrefix(server.URL, "http://"),
+		metrics:       NewMetricsCollector(),
+	}
+	processor.SetClock(fake)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := processor.waitForLLMResult(context.Background(), "task-1")
+		errCh <- err
+	}()
+
+	// 轮询定时器和超时等待都注册后再推进时间
+	fake.BlockUntil(2)
+	for i := int32(1); i <= 3; i++ {
+		fake.Advance(llmPollInterval)
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&polls) == i }, time.Second, time.Millisecond)
+	}
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("未到超时时间就返回: %v", err)
+	default:
+	}
+
+	fake.Advance(llmResultTimeout)
+	select {
+	case err := <-errCh:
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "等待LLM任务超时")
+	case <-time.After(5 * time.Second):
+		t.Fatal("推进时钟后等待没有超时")
+	}
+}
+
+// malformedLLMItems LLM返回的缺少编码或名称、字段类型不对的条目
+func malformedLLMItems() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"code": "1-01-01-02", "name": "钳工", "level": "细类"},
+		{"code": "1-01-01-03"},
+		{"name": "只有名称"},
+		{"code": 103, "name": "数字编码"},
+		{"code": "1-01-01-04", "name": nil},
+		{},
+	}
+}
+
+// TestPDFLLMProcessor_MergeResultsSkipsMalformedItems 测试融合时跳过缺少编码或名称的清洗结果
+func TestPDFLLMProcessor_MergeResultsSkipsMalformedItems(t *testing.T) {
+	processor := NewPDFLLMProcessor(&config.Config{}, nil)
+	categories := []*model.Category{{Code: "1-01-01-01", Name: "焊工", Level: "细类"}}
+
+	var choices []SemanticChoiceItem
+	require.NotPanics(t, func() {
+		choices = processor.MergeResults(categories, malformedLLMItems())
+	})
+
+	codes := make(map[string]bool)
+	for _, choice := range choices {
+		codes[choice.Code] = true
+	}
+	assert.True(t, codes["1-01-01-01"])
+	assert.True(t, codes["1-01-01-02"])
+	assert.False(t, codes["1-01-01-03"], "缺少名称的条目应跳过")
+	assert.False(t, codes["1-01-01-04"], "名称不是字符串的条目应跳过")
+}
+
+// TestPDFLLMProcessor_SaveFinalResultSkipsMalformedItems 测试保存最终结果时跳过异常条目，全部异常时保留旧数据
+func TestPDFLLMProcessor_SaveFinalResultSkipsMalformedItems(t *testing.T) {
+	ctx := context.Background()
+	db := newTestCategoryDB(t)
+	taskID := "5a7c9e1b-3d5f-4a7c-9e1b-3d5f7a9c1e3b"
+	require.NoError(t, db.CreateTask(ctx, &database.TaskRecord{
+		ID: taskID, Type: "rule", Status: "processing", Config: datatypes.JSON(`{}`),
+	}))
+	processor := NewPDFLLMProcessor(&config.Config{}, db)
+
+	// 历史版本和当前版本各一条
+	oldBatch := "6b8d0f2c-4e6a-4b8d-8f2c-4e6a8b0d2f4c"
+	currentBatch := "7c9e1a3d-5f7b-4c9e-9a3d-5f7b9c1e3a5d"
+	require.NoError(t, db.BatchInsertCategoriesWithVersion(ctx, taskID, oldBatch, []*database.Category{
+		{TaskID: taskID, Code: "1-01-01-09", Name: "历史", Level: "细类", Status: database.StatusExcelParsed},
+	}))
+	require.NoError(t, db.BatchInsertCategoriesWithVersion(ctx, taskID, currentBatch, []*database.Category{
+		{TaskID: taskID, Code: "1-01-01-08", Name: "当前", Level: "细类", Status: database.StatusExcelParsed},
+	}))
+
+	require.NotPanics(t, func() {
+		require.NoError(t, processor.saveFinalResult(ctx, taskID, malformedLLMItems()))
+	})
+	var rows []database.Category
+	require.NoError(t, db.GetDB().Where("task_id = ? AND is_current = true", taskID).Find(&rows).Error)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "1-01-01-02", rows[0].Code)
+	assert.Equal(t, currentBatch, rows[0].UploadBatchID, "最终结果沿用当前版本的批次")
+
+	var history []database.Category
+	require.NoError(t, db.GetDB().Where("task_id = ? AND is_current = false", taskID).Find(&history).Error)
+	require.Len(t, history, 1, "历史版本不应被删除")
+	assert.Equal(t, "1-01-01-09", history[0].Code)
+
+	err := processor.saveFinalResult(ctx, taskID, []map[string]interface{}{{"name": "只有名称"}})
+	require.Error(t, err)
+	require.NoError(t, db.GetDB().Where("task_id = ? AND is_current = true", taskID).Find(&rows).Error)
+	assert.Len(t, rows, 1, "没有可保存的结果时不删除旧数据")
+}
+
+// TestBatchProcessor_SplitsPromptTooLarge 测试LLM服务以提示词过大拒绝批次时对半拆分后重新处理
+func TestBatchProcessor_SplitsPromptTooLarge(t *testing.T) {
+	var calls int32
+	server := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		atomic.AddInt32(&calls, 1)
+		var items []map[string]interface{}
+		for _, code := range []string{"1-01-01-01", "1-01-01-02"} {
+			if strings.Contains(req.Prompt, `"`+code+`"`) {
+				items = append(items, map[string]interface{}{"code": code, "name": "名称" + code})
+			}
+		}
+		if len(items) > 1 {
+			return LLMTaskStatus{Status: "failed", Error: "kimi: " + ErrPromptTooLarge.Error() + ": 估算 9000 tokens"}
+		}
+		return LLMTaskStatus{Status: "completed", Result: items}
+	})
+
+	processor := &PDFLLMProcessor{
+		httpClient:    server.Client(),
+		llmServiceURL: server.Host(),
+		metrics:       NewMetricsCollector(),
+	}
+	batch := []*model.Category{
+		{Code: "1-01-01-01", Name: "原始1", Level: "细类"},
+		{Code: "1-01-01-02", Name: "原始2", Level: "细类"},
+	}
+
+	results, err := NewBatchProcessor(processor).processBatch(context.Background(), 1, batch)
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "整批被拒后应拆成两半各调用一次，且不重试被拒的整批")
+
+	t.Setenv("LLM_PROMPT_CONTEXT_TOKENS", "100")
+	t.Setenv("LLM_COMPLETION_RESERVE", "90")
+	_, err = processor.callLLMServiceWithRetry(context.Background(), "batch_processing", strings.Repeat("职业", 10))
+	assert.ErrorIs(t, err, ErrPromptTooLarge, "超出本地预算时不应提交任务")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,110 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/freedkr/moonshot/internal/database"
+)
+
+// ForcePDFConfigKey 任务配置中要求重新调用PDF服务的字段，PDF文件有变化时设为 true
+const ForcePDFConfigKey = "force_pdf"
+
+// SetPDFResultReuse 设置重新处理任务时是否复用已保存的PDF提取结果
+func (p *IncrementalProcessor) SetPDFResultReuse(enabled bool) {
+	p.reusePDFResult = enabled
+}
+
+// getPDFResultReuse 获取是否复用已保存的PDF提取结果，默认开启
+func getPDFResultReuse() bool {
+	if v := os.Getenv("PDF_REUSE_STORED_RESULT"); v != "" {
+		if enabled, err := strconv.ParseBool(v); err == nil {
+			return enabled
+		}
+	}
+	return true
+}
+
+// loadStoredPDFResult 读取任务已保存的PDF提取结果，用于只调整LLM提示词的重新处理，跳过耗时的PDF服务轮询。
+// 未开启复用、任务配置了 force_pdf 或没有可用的保存结果时返回 false，由调用方重新调用PDF服务
+func (p *IncrementalProcessor) loadStoredPDFResult(ctx context.Context, taskID string) (PDFResult, bool) {
+	if !p.reusePDFResult {
+		return PDFResult{}, false
+	}
+	if p.taskForcesPDF(ctx, taskID) {
+		fmt.Printf("🔁 [Step2-PDF复用] 任务配置了 %s，重新调用PDF服务 - taskID: %s\n", ForcePDFConfigKey, taskID)
+		return PDFResult{}, false
+	}
+
+	extraction, err := p.db.GetPDFExtraction(ctx, taskID)
+	if err != nil {
+		if !errors.Is(err, database.ErrPDFExtractionNotFound) {
+			fmt.Printf("⚠️ WARNING: 读取已保存的PDF提取结果失败，重新调用PDF服务 - taskID: %s, 错误: %v\n", taskID, err)
+		}
+		return PDFResult{}, false
+	}
+
+	stored := storedPDFResult(extraction)
+	if stored == nil {
+		return PDFResult{}, false
+	}
+	pdfResult, err := decodePDFResult(extraction.PDFTaskID, stored, p.timeSource().Now())
+	if err != nil || len(pdfResult.OccupationCodes) == 0 {
+		fmt.Printf("⚠️ WARNING: 已保存的PDF提取结果不可用，重新调用PDF服务 - taskID: %s\n", taskID)
+		return PDFResult{}, false
+	}
+	fmt.Printf("♻️ [Step2-PDF复用] 使用已保存的PDF提取结果，跳过PDF服务 - taskID: %s, 编码数: %d\n", taskID, len(pdfResult.OccupationCodes))
+	return pdfResult, true
+}
+
+// taskForcesPDF 判断任务配置是否要求重新调用PDF服务，读取任务失败时按不强制处理
+func (p *IncrementalProcessor) taskForcesPDF(ctx context.Context, taskID string) bool {
+	task, err := p.db.GetTask(ctx, taskID)
+	if err != nil || len(task.Config) == 0 {
+		return false
+	}
+	var taskConfig map[string]interface{}
+	if err := json.Unmarshal(task.Config, &taskConfig); err != nil {
+		return false
+	}
+	switch v := taskConfig[ForcePDFConfigKey].(type) {
+	case bool:
+		return v
+	case string:
+		force, _ := strconv.ParseBool(v)
+		return force
+	default:
+		return false
+	}
+}
+
+// storedPDFResult 从保存的记录还原PDF服务的返回；早期记录没有完整返回时用编码列表重建。
+// 没有职业编码时返回 nil，避免复用一次失败的提取
+func storedPDFResult(extraction *database.PDFExtraction) map[string]interface{} {
+	var result map[string]interface{}
+	if len(extraction.RawResult) > 0 {
+		if err := json.Unmarshal(extraction.RawResult, &result); err != nil {
+			result = nil
+		}
+	}
+	if result == nil {
+		var codes []interface{}
+		if err := json.Unmarshal(extraction.OccupationCodes, &codes); err != nil {
+			return nil
+		}
+		result = map[string]interface{}{
+			"task_id":          extraction.PDFTaskID,
+			"occupation_codes": codes,
+			"total_found":      float64(extraction.TotalFound),
+		}
+	}
+
+	if codes, _ := result["occupation_codes"].([]interface{}); len(codes) == 0 {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,162 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// TestStoredPDFResult 测试优先还原完整返回，早期记录用编码列表重建，没有编码时不复用
+func TestStoredPDFResult(t *testing.T) {
+	raw := &database.PDFExtraction{
+		PDFTaskID:       "pdf-1",
+		RawResult:       datatypes.JSON(`{"task_id":"pdf-1","occupation_codes":[{"code":"1-01"}],"total":1,"source":"ocr"}`),
+		OccupationCodes: datatypes.JSON(`[{"code":"1-01"}]`),
+	}
+	result := storedPDFResult(raw)
+	require.NotNil(t, result)
+	assert.Equal(t, "ocr", result["source"])
+
+	legacy := &database.PDFExtraction{PDFTaskID: "pdf-2", TotalFound: 2, OccupationCodes: datatypes.JSON(`[{"code":"1-01"},{"code":"1-02"}]`)}
+	result = storedPDFResult(legacy)
+	require.NotNil(t, result)
+	assert.Equal(t, "pdf-2", result["task_id"])
+	assert.Len(t, result["occupation_codes"], 2)
+
+	assert.Nil(t, storedPDFResult(&database.PDFExtraction{OccupationCodes: datatypes.JSON(`[]`)}))
+	assert.Nil(t, storedPDFResult(&database.PDFExtraction{RawResult: datatypes.JSON(`{"occupation_codes":[]}`)}))
+}
+
+// TestGroupByCodePrefix_KeepsRawResult 测试分组时规范化编码不修改PDF服务的原始返回，保存和复用的结果保持原样
+func TestGroupByCodePrefix_KeepsRawResult(t *testing.T) {
+	raw := map[string]interface{}{"code": "２－０１－０１", "name": "全角"}
+	b := &BatchProcessor{}
+	groups, err := b.groupByCodePrefix(map[string]interface{}{"occupation_codes": []interface{}{raw}})
+	require.NoError(t, err)
+	items := groups[getMainCategory("2-01-01")]["occupation_codes"].([]interface{})
+	assert.Equal(t, "2-01-01", items[0].(map[string]interface{})["code"])
+	assert.Equal(t, "２－０１－０１", raw["code"])
+}
+
+// TestIncrementalProcessor_Step2ReplaysStoredPDFResult 测试重新处理时复用保存的PDF结果，force_pdf 和关闭复用时重新调用PDF服务
+func TestIncrementalProcessor_Step2ReplaysStoredPDFResult(t *testing.T) {
+	codes := []string{"1-01-01-01", "2-01-01-01"}
+	var occupationCodes []map[string]interface{}
+	for _, code := range codes {
+		occupationCodes = append(occupationCodes, map[string]interface{}{"code": code, "name": "名称" + code, "confidence": 0.9})
+	}
+	pdfService := newFakePDFValidator(t, occupationCodes)
+	llmService := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		var items []map[string]interface{}
+		for _, code := range codes {
+			if strings.Contains(req.Prompt, `"`+code+`"`) {
+				items = append(items, map[string]interface{}{"code": code, "name": "名称" + code})
+			}
+		}
+		array, _ := json.Marshal(items)
+		return LLMTaskStatus{Status: "completed", Result: string(array)}
+	})
+
+	pdfPath := filepath.Join(t.TempDir(), "sample.pdf")
+	require.NoError(t, os.WriteFile(pdfPath, []byte("%PDF-1.4 fake"), 0o644))
+	t.Setenv("PDF_TEST_FILE_PATH", pdfPath)
+	t.Setenv("PDF_VALIDATOR_URL", pdfService.Host())
+	t.Setenv("LLM_SERVICE_URL", llmService.Host())
+
+	db := newTestCategoryDB(t)
+	processor := NewIncrementalProcessor(&config.Config{}, db)
+	ctx := context.Background()
+	taskID := "7b9d1f3a-5c7e-4a9b-8d1f-3a5c7e9b1d3f"
+	require.NoError(t, db.CreateTask(ctx, &database.TaskRecord{
+		ID: taskID, Type: "rule", Status: "processing", Config: datatypes.JSON(`{}`),
+	}))
+
+	first, err := processor.step2ProcessPDFWithLLM(ctx, taskID)
+	require.NoError(t, err)
+	assert.Len(t, first, 2)
+	assert.Equal(t, int32(1), pdfService.Uploads())
+
+	// 重新处理：复用保存的结果，清洗结果不变
+	second, err := processor.step2ProcessPDFWithLLM(ctx, taskID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, first, second)
+	assert.Equal(t, int32(1), pdfService.Uploads(), "复用保存的结果时不应调用PDF服务")
+
+	// PDF有变化时通过 force_pdf 重新调用
+	require.NoError(t, db.GetDB().Model(&database.TaskRecord{}).Where("id = ?", taskID).
+		Update("config", datatypes.JSON(`{"force_pdf":true}`)).Error)
+	_, err = processor.step2ProcessPDFWithLLM(ctx, taskID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), pdfService.Uploads())
+
+	// 关闭复用时总是调用PDF服务
+	require.NoError(t, db.GetDB().Model(&database.TaskRecord{}).Where("id = ?", taskID).
+		Update("config", datatypes.JSON(`{}`)).Error)
+	processor.SetPDFResultReuse(false)
+	_, err = processor.step2ProcessPDFWithLLM(ctx, taskID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), pdfService.Uploads())
+}
+
+// TestIncrementalProcessor_ReprocessReplaysStoredPDFResult 测试通过重新处理接口重置的任务复用原任务ID下保存的PDF结果，
+// 重置时设置 force_pdf 则重新调用PDF服务
+func TestIncrementalProcessor_ReprocessReplaysStoredPDFResult(t *testing.T) {
+	codes := []string{"3-01-01-01"}
+	occupationCodes := []map[string]interface{}{{"code": codes[0], "name": "名称" + codes[0], "confidence": 0.9}}
+	pdfService := newFakePDFValidator(t, occupationCodes)
+	llmService := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		array, _ := json.Marshal([]map[string]interface{}{{"code": codes[0], "name": "名称" + codes[0]}})
+		return LLMTaskStatus{Status: "completed", Result: string(array)}
+	})
+
+	pdfPath := filepath.Join(t.TempDir(), "sample.pdf")
+	require.NoError(t, os.WriteFile(pdfPath, []byte("%PDF-1.4 fake"), 0o644))
+	t.Setenv("PDF_TEST_FILE_PATH", pdfPath)
+	t.Setenv("PDF_VALIDATOR_URL", pdfService.Host())
+	t.Setenv("LLM_SERVICE_URL", llmService.Host())
+
+	db := newTestCategoryDB(t)
+	processor := NewIncrementalProcessor(&config.Config{}, db)
+	ctx := context.Background()
+	taskID := "2e4a6c8e-1a3c-4e5a-9c1e-3a5c7e9a1c3e"
+	require.NoError(t, db.CreateTask(ctx, &database.TaskRecord{
+		ID: taskID, Type: "rule", Status: "processing", Config: datatypes.JSON(`{"force_pdf":true}`),
+	}))
+
+	first, err := processor.step2ProcessPDFWithLLM(ctx, taskID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), pdfService.Uploads())
+
+	complete := func() {
+		require.NoError(t, db.GetDB().Model(&database.TaskRecord{}).Where("id = ?", taskID).
+			Update("status", "completed").Error)
+	}
+
+	// 创建时的 force_pdf 被重新处理的配置替换，复用保存的结果
+	complete()
+	require.NoError(t, db.ResetTaskForReprocess(ctx, taskID, datatypes.JSON(`{"force_pdf":false}`)))
+	replayed, err := processor.step2ProcessPDFWithLLM(ctx, taskID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, first, replayed)
+	assert.Equal(t, int32(1), pdfService.Uploads(), "重新处理时不应重新解析PDF")
+
+	complete()
+	require.NoError(t, db.ResetTaskForReprocess(ctx, taskID, datatypes.JSON(`{"force_pdf":true}`)))
+	_, err = processor.step2ProcessPDFWithLLM(ctx, taskID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), pdfService.Uploads())
+
+	// 后台增量流程未结束的任务不能重置
+	complete()
+	require.NoError(t, db.SetTaskFlowRunning(ctx, taskID, true))
+	assert.ErrorIs(t, db.ResetTaskForReprocess(ctx, taskID, datatypes.JSON(`{}`)), database.ErrTaskNotReprocessable)
+}
@@ -0,0 +1,116 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultPDFCodeConfidence PDF服务未返回置信度时使用的默认值
+const defaultPDFCodeConfidence = 0.8
+
+// decodePDFResult 将PDF服务 occupation-codes 接口的返回转换为 PDFResult。
+// 条目数组的查找规则与 groupByCodePrefix 相同；缺少编码或字段类型不对的条目跳过，不会因格式异常panic。
+// pdfTaskID 为空时取返回中的 task_id；找不到条目数组时返回 ErrUnrecognizedPDFData
+func decodePDFResult(pdfTaskID string, raw map[string]interface{}, now time.Time) (PDFResult, error) {
+	key, items := findPDFCodeItems(raw)
+	if key == "" {
+		return PDFResult{}, fmt.Errorf("%w: 顶层字段 %s", ErrUnrecognizedPDFData, describePDFShape(raw))
+	}
+
+	if pdfTaskID == "" {
+		pdfTaskID, _ = raw["task_id"].(string)
+	}
+	result := PDFResult{
+		TaskID:      pdfTaskID,
+		Status:      "completed",
+		ProcessedAt: now,
+		Raw:         raw,
+	}
+
+	skipped := 0
+	for _, item := range items {
+		code, ok := decodePDFOccupationCode(item, now)
+		if !ok {
+			skipped++
+			continue
+		}
+		result.OccupationCodes = append(result.OccupationCodes, code)
+	}
+	if skipped > 0 {
+		fmt.Printf("⚠️ [PDF格式] %s 中 %d 个条目缺少编码或格式无效，已跳过\n", key, skipped)
+	}
+
+	switch {
+	case raw["total_found"] != nil:
+		result.TotalFound = toInt(raw["total_found"])
+	case raw["total"] != nil:
+		result.TotalFound = toInt(raw["total"])
+	default:
+		result.TotalFound = len(items)
+	}
+	return result, nil
+}
+
+// decodePDFOccupationCode 转换单个条目，不是对象或没有非空的字符串编码时返回 false
+func decodePDFOccupationCode(item interface{}, now time.Time) (PDFOccupationCode, bool) {
+	itemMap, ok := item.(map[string]interface{})
+	if !ok {
+		return PDFOccupationCode{}, false
+	}
+	code, _ := itemMap["code"].(string)
+	if code = strings.TrimSpace(code); code == "" {
+		return PDFOccupationCode{}, false
+	}
+
+	occupationCode := PDFOccupationCode{
+		Code:        code,
+		Confidence:  defaultPDFCodeConfidence,
+		Source:      "pdf",
+		ExtractedAt: now,
+	}
+	occupationCode.Name, _ = itemMap["name"].(string)
+	occupationCode.Level, _ = itemMap["level"].(string)
+	occupationCode.Font, _ = itemMap["font"].(string)
+	if confidence, ok := itemMap["confidence"].(float64); ok {
+		occupationCode.Confidence = confidence
+	}
+	return occupationCode, true
+}
+
+// cleaningInput 转换为第一轮LLM清洗的输入，条目只包含已校验的字段
+func (r PDFResult) cleaningInput() map[string]interface{} {
+	codes := make([]interface{}, 0, len(r.OccupationCodes))
+	for _, code := range r.OccupationCodes {
+		item := map[string]interface{}{
+			"code":       code.Code,
+			"name":       code.Name,
+			"confidence": code.Confidence,
+		}
+		if code.Level != "" {
+			item["level"] = code.Level
+		}
+		codes = append(codes, item)
+	}
+	return map[string]interface{}{
+		"task_id":          r.TaskID,
+		"total_found":      r.TotalFound,
+		"occupation_codes": codes,
+	}
+}
+
+// rawCodeItems 返回PDF服务原始返回中的条目数组，用于保存审计记录；没有原始返回时序列化已转换的条目
+func (r PDFResult) rawCodeItems() json.RawMessage {
+	if _, items := findPDFCodeItems(r.Raw); items != nil {
+		if data, err := json.Marshal(items); err == nil {
+			return data
+		}
+	}
+	codes := r.OccupationCodes
+	if codes == nil {
+		codes = []PDFOccupationCode{}
+	}
+	data, _ := json.Marshal(codes)
+	return data
+}
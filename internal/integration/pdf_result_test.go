@@ -0,0 +1,82 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDecodePDFResult_MalformedItems 测试格式异常的条目被跳过而不是panic
+func TestDecodePDFResult_MalformedItems(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	raw := map[string]interface{}{
+		"task_id": "pdf-1",
+		"occupation_codes": []interface{}{
+			map[string]interface{}{"code": "1-01-01", "name": "焊工", "confidence": 0.95, "level": "细类"},
+			map[string]interface{}{"name": "缺少编码"},
+			map[string]interface{}{"code": 101, "name": "数字编码"},
+			map[string]interface{}{"code": "  ", "name": "空编码"},
+			map[string]interface{}{"code": "1-01-02", "name": 42, "confidence": "high"},
+			"不是对象",
+			nil,
+		},
+	}
+
+	var result PDFResult
+	require.NotPanics(t, func() {
+		var err error
+		result, err = decodePDFResult("", raw, now)
+		require.NoError(t, err)
+	})
+
+	assert.Equal(t, "pdf-1", result.TaskID)
+	assert.Equal(t, 7, result.TotalFound)
+	require.Len(t, result.OccupationCodes, 2)
+	assert.Equal(t, PDFOccupationCode{Code: "1-01-01", Name: "焊工", Confidence: 0.95, Source: "pdf", Level: "细类", ExtractedAt: now}, result.OccupationCodes[0])
+	assert.Equal(t, "1-01-02", result.OccupationCodes[1].Code)
+	assert.Empty(t, result.OccupationCodes[1].Name)
+	assert.Equal(t, defaultPDFCodeConfidence, result.OccupationCodes[1].Confidence)
+
+	_, err := decodePDFResult("pdf-2", map[string]interface{}{"status": "completed", "count": 3.0}, now)
+	assert.True(t, errors.Is(err, ErrUnrecognizedPDFData))
+}
+
+// TestPDFLLMProcessor_MalformedPDFOutputDoesNotPanic 测试PDF服务返回异常条目、LLM清洗结果缺少字段时流程不会panic
+func TestPDFLLMProcessor_MalformedPDFOutputDoesNotPanic(t *testing.T) {
+	pdfService := newFakePDFValidator(t, []map[string]interface{}{
+		{"code": "1-01-01-01", "name": "焊工"},
+		{"name": "缺少编码"},
+		{"code": []interface{}{"1-01"}, "name": "编码是数组"},
+	})
+	t.Setenv("PDF_VALIDATOR_URL", pdfService.Host())
+	processor := NewPDFLLMProcessor(&config.Config{}, nil)
+
+	var result PDFResult
+	require.NotPanics(t, func() {
+		var err error
+		result, err = processor.getOccupationCodes(context.Background(), fakePDFTaskID)
+		require.NoError(t, err)
+	})
+	require.Len(t, result.OccupationCodes, 1)
+	assert.Equal(t, "1-01-01-01", result.OccupationCodes[0].Code)
+
+	input := result.cleaningInput()
+	assert.Len(t, input["occupation_codes"], 1)
+
+	categories := []*model.Category{{Code: "1-01-01-01", Name: "焊工", Level: "细类"}}
+	cleaned := []map[string]interface{}{
+		{"code": "1-01-01-01"},
+		{"name": "只有名称"},
+		{"code": 7, "name": "数字编码"},
+	}
+	require.NotPanics(t, func() {
+		choices := processor.MergeResults(categories, cleaned)
+		assert.NotEmpty(t, choices)
+	})
+}
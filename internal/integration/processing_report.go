@@ -0,0 +1,165 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+)
+
+// ProcessingReportKey 处理报告在任务结果中的字段名
+const ProcessingReportKey = "processing_report"
+
+// ProcessingReport 一次增量处理的汇总报告，流程结束时写入任务结果
+type ProcessingReport struct {
+	TotalCodes        int            `json:"total_codes"`        // 当前版本分类总数
+	PDFCodes          int            `json:"pdf_codes"`          // PDF清洗（规范化、去重）后的编码条目数
+	PDFMatched        PDFMatchCounts `json:"pdf_matched"`        // 与PDF数据匹配的分类数
+	LLMEnriched       int            `json:"llm_enriched"`       // 已填充LLM增强信息的分类数
+	RuleFallback      int            `json:"rule_fallback"`      // 未经LLM增强、沿用规则解析名称的分类数
+	AverageConfidence float64        `json:"average_confidence"` // 第二轮LLM语义选择的平均置信度
+	ConfidenceSamples int            `json:"confidence_samples"` // 返回了有效置信度的结果条数
+	TokenUsage        LLMTokenUsage  `json:"token_usage"`        // 本次流程全部LLM任务的token消耗
+	LLMSkipped        bool           `json:"llm_skipped"`        // 未调用LLM，任务以规则解析结果完成
+	PDFSkipped        bool           `json:"pdf_skipped"`        // 跳过了PDF验证和融合，分类全部来自Excel
+	DurationMs        int64          `json:"duration_ms"`
+	GeneratedAt       time.Time      `json:"generated_at"`
+}
+
+// PDFMatchCounts 步骤3按匹配方式统计的分类数
+type PDFMatchCounts struct {
+	ByCode  int `json:"by_code"`
+	ByName  int `json:"by_name"`
+	ByFuzzy int `json:"by_fuzzy"` // 目前融合只做精确匹配，始终为0
+	Total   int `json:"total"`
+}
+
+// LLMTokenUsage LLM服务返回的token使用量
+type LLMTokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type reportCollectorKey struct{}
+
+// reportCollector 收集一次流程中各步骤的统计。处理器被多个流程并发使用，因此随context传递；
+// 所有方法在 nil 上调用时不做任何事，不经过流程的调用（如补充增强）无需判断
+type reportCollector struct {
+	mu            sync.Mutex
+	startedAt     time.Time
+	report        ProcessingReport
+	confidenceSum float64
+}
+
+// withReportCollector 在context中挂载新的统计收集器
+func withReportCollector(ctx context.Context) (context.Context, *reportCollector) {
+	collector := &reportCollector{startedAt: time.Now()}
+	return context.WithValue(ctx, reportCollectorKey{}, collector), collector
+}
+
+// reportCollectorFrom 返回context中的统计收集器，没有时返回 nil
+func reportCollectorFrom(ctx context.Context) *reportCollector {
+	collector, _ := ctx.Value(reportCollectorKey{}).(*reportCollector)
+	return collector
+}
+
+// recordPDFMatches 记录步骤3参与匹配的PDF条目数和各匹配方式的分类数
+func (c *reportCollector) recordPDFMatches(pdfCodes, byCode, byName int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.report.PDFCodes = pdfCodes
+	c.report.PDFMatched = PDFMatchCounts{ByCode: byCode, ByName: byName, Total: byCode + byName}
+}
+
+// recordConfidence 累计语义选择结果的置信度
+func (c *reportCollector) recordConfidence(results []map[string]interface{}) {
+	if c == nil {
+		return
+	}
+	avg, count := averageConfidence(results)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.confidenceSum += avg * float64(count)
+	c.report.ConfidenceSamples += count
+}
+
+// recordPDFSkipped 记录流程跳过了PDF验证和融合
+func (c *reportCollector) recordPDFSkipped() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.report.PDFSkipped = true
+}
+
+// addTokenUsage 累计一个LLM任务的token使用量
+func (c *reportCollector) addTokenUsage(usage *LLMTokenUsage) {
+	if c == nil || usage == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.report.TokenUsage.PromptTokens += usage.PromptTokens
+	c.report.TokenUsage.CompletionTokens += usage.CompletionTokens
+	c.report.TokenUsage.TotalTokens += usage.TotalTokens
+}
+
+// snapshot 返回当前收集到的统计
+func (c *reportCollector) snapshot() ProcessingReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report := c.report
+	if report.ConfidenceSamples > 0 {
+		report.AverageConfidence = c.confidenceSum / float64(report.ConfidenceSamples)
+	}
+	report.DurationMs = time.Since(c.startedAt).Milliseconds()
+	return report
+}
+
+// saveProcessingReport 汇总收集器的统计和分类表的最终状态，写入任务结果。
+// 报告只用于展示，生成或保存失败时记录日志，不影响流程结果
+func (p *IncrementalProcessor) saveProcessingReport(ctx context.Context, taskID string, collector *reportCollector, llmSkipped bool) {
+	report, err := p.buildProcessingReport(ctx, taskID, collector, llmSkipped)
+	if err == nil {
+		err = p.mergeTaskResult(p.db.WithContext(ctx), taskID, "", map[string]interface{}{
+			ProcessingReportKey: report,
+		})
+	}
+	if err != nil {
+		fmt.Printf("⚠️ WARNING: 保存处理报告失败 - taskID: %s, 错误: %v\n", taskID, err)
+		return
+	}
+	fmt.Printf("📋 [处理报告] taskID=%s, 总数=%d, PDF匹配=%d(编码%d/名称%d), LLM增强=%d, 规则名称=%d, 平均置信度=%.3f, tokens=%d\n",
+		taskID, report.TotalCodes, report.PDFMatched.Total, report.PDFMatched.ByCode, report.PDFMatched.ByName,
+		report.LLMEnriched, report.RuleFallback, report.AverageConfidence, report.TokenUsage.TotalTokens)
+}
+
+// buildProcessingReport 生成处理报告，分类总数和LLM增强数按当前版本分类统计
+func (p *IncrementalProcessor) buildProcessingReport(ctx context.Context, taskID string, collector *reportCollector, llmSkipped bool) (*ProcessingReport, error) {
+	report := collector.snapshot()
+	report.LLMSkipped = llmSkipped
+	report.GeneratedAt = time.Now()
+
+	var total, enriched int64
+	if err := p.db.WithContext(ctx).Model(&database.Category{}).
+		Where("task_id = ? AND is_current = true", taskID).
+		Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("统计分类总数失败: %w", err)
+	}
+	if err := p.db.WithContext(ctx).Model(&database.Category{}).
+		Where("task_id = ? AND is_current = true AND llm_enhancements IS NOT NULL AND llm_enhancements != ''", taskID).
+		Count(&enriched).Error; err != nil {
+		return nil, fmt.Errorf("统计LLM增强数失败: %w", err)
+	}
+	report.TotalCodes = int(total)
+	report.LLMEnriched = int(enriched)
+	report.RuleFallback = int(total - enriched)
+	return &report, nil
+}
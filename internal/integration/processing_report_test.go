@@ -0,0 +1,89 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// TestIncrementalProcessor_ProcessingReport 测试流程结束时按各步骤统计生成处理报告并写入任务结果
+func TestIncrementalProcessor_ProcessingReport(t *testing.T) {
+	usage := &LLMTokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	llmService := newFakeLLMServer(t, func(req LLMTaskRequest) LLMTaskStatus {
+		if code := promptField(req.Prompt, "编码:"); code != "" {
+			confidence := 0.5
+			if code == "1-01-01-01" {
+				confidence = 0.9
+			}
+			return LLMTaskStatus{Status: "completed", TokenUsage: usage, Result: map[string]interface{}{
+				"code": code, "name": promptField(req.Prompt, "选项1:"), "confidence": confidence,
+			}}
+		}
+		return LLMTaskStatus{Status: "completed", TokenUsage: usage,
+			Result: `[{"code":"1-01-01-01","name":"焊工"},{"code":"1-01-01-02","name":"钳工"}]`}
+	})
+	t.Setenv("LLM_SERVICE_URL", llmService.Host())
+	t.Setenv("PDF_VALIDATOR_URL", "127.0.0.1:1")
+
+	ctx := context.Background()
+	db := newTestCategoryDB(t)
+	taskID := "0e2a4c6e-8b0d-4f2a-8c4e-6a8b0d2f4a6c"
+	require.NoError(t, db.CreateTask(ctx, &database.TaskRecord{
+		ID: taskID, Type: "rule", Status: "completed",
+		Config: datatypes.JSON(`{}`), Result: datatypes.JSON(`{"message":"Hierarchy saved to database"}`),
+	}))
+	require.NoError(t, db.SavePDFExtraction(ctx, &database.PDFExtraction{
+		TaskID: taskID, TotalFound: 2,
+		OccupationCodes: datatypes.JSON(`[{"code":"1-01-01-01","name":"焊工"},{"code":"1-01-01-02","name":"钳工"}]`),
+	}))
+
+	// 焊工按编码匹配，钳工编码不同、按名称匹配，邮政营业员未匹配
+	categories := []*model.Category{
+		{Code: "1-01-01-01", Name: "焊工", Level: "细类"},
+		{Code: "1-01-01-09", Name: "钳工", Level: "细类"},
+		{Code: "3-01-01-01", Name: "邮政营业员", Level: "细类"},
+	}
+	processor := NewIncrementalProcessor(&config.Config{}, db)
+	require.NoError(t, processor.ProcessIncrementalFlow(ctx, taskID, "input.xlsx", categories))
+
+	task, err := db.GetTask(ctx, taskID)
+	require.NoError(t, err)
+	var result struct {
+		Message string            `json:"message"`
+		Report  *ProcessingReport `json:"processing_report"`
+	}
+	require.NoError(t, json.Unmarshal(task.Result, &result))
+	assert.Equal(t, "Hierarchy saved to database", result.Message, "保留结果中的原有字段")
+	require.NotNil(t, result.Report)
+
+	report := result.Report
+	assert.Equal(t, 3, report.TotalCodes)
+	assert.Equal(t, 2, report.PDFCodes)
+	assert.Equal(t, PDFMatchCounts{ByCode: 1, ByName: 1, Total: 2}, report.PDFMatched)
+	assert.Equal(t, 2, report.LLMEnriched)
+	assert.Equal(t, 1, report.RuleFallback)
+	assert.Equal(t, 2, report.ConfidenceSamples)
+	assert.InDelta(t, 0.7, report.AverageConfidence, 1e-9)
+	calls := len(llmService.Requests())
+	assert.Equal(t, LLMTokenUsage{PromptTokens: 10 * calls, CompletionTokens: 5 * calls, TotalTokens: 15 * calls}, report.TokenUsage)
+	assert.False(t, report.LLMSkipped)
+	assert.False(t, report.GeneratedAt.IsZero())
+}
+
+// TestReportCollector_Nil 测试不经过流程的调用可以直接使用 nil 收集器
+func TestReportCollector_Nil(t *testing.T) {
+	collector := reportCollectorFrom(context.Background())
+	assert.Nil(t, collector)
+	assert.NotPanics(t, func() {
+		collector.recordPDFMatches(1, 1, 0)
+		collector.recordConfidence([]map[string]interface{}{{"confidence": 0.5}})
+		collector.addTokenUsage(&LLMTokenUsage{TotalTokens: 1})
+	})
+}
@@ -32,8 +32,8 @@ func NewProcessingOrchestrator(
 	processingConfig := LoadProcessingConfig(cfg)
 
 	return &ProcessingOrchestrator{
-		pdfService:  NewPDFServiceClient(processingConfig.Services.PDF),
-		llmService:  NewLLMServiceClient(processingConfig.Services.LLM),
+		pdfService:  newPDFServiceClient(processingConfig.Services.PDF, processingConfig.HTTP),
+		llmService:  newLLMServiceClient(processingConfig.Services.LLM, processingConfig.HTTP),
 		dataMapper:  NewDataMapper(),
 		repository:  NewProcessingRepository(db),
 		concurrency: NewQuotaAwareConcurrencyManager(processingConfig.Concurrency),
@@ -0,0 +1,58 @@
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/freedkr/moonshot/internal/tokens"
+)
+
+// ErrPromptTooLarge 提示词估算的token数超过模型上下文减去输出预留，批量调用方应拆分后重试
+var ErrPromptTooLarge = tokens.ErrPromptTooLarge
+
+// 提示词预算的默认值：提交的任务使用128k模型，给输出至少预留8000 tokens
+const (
+	defaultPromptContextTokens = 128000
+	defaultCompletionReserve   = 8000
+)
+
+// getPromptBudget 获取发送前检查提示词大小的预算
+// LLM_PROMPT_CONTEXT_TOKENS 为模型上下文长度（设为0关闭检查），LLM_COMPLETION_RESERVE 为给输出预留的token数
+func getPromptBudget() tokens.Budget {
+	budget := tokens.Budget{
+		ContextTokens:     defaultPromptContextTokens,
+		CompletionReserve: defaultCompletionReserve,
+	}
+	if v := os.Getenv("LLM_PROMPT_CONTEXT_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			budget.ContextTokens = n
+		}
+	}
+	if v := os.Getenv("LLM_COMPLETION_RESERVE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			budget.CompletionReserve = n
+		}
+	}
+	return budget
+}
+
+// checkPromptSize 发送前估算提示词的token数，超出预算时返回 ErrPromptTooLarge，避免输出被静默截断
+func checkPromptSize(taskType, prompt string) error {
+	estimate, err := getPromptBudget().Check(prompt)
+	fmt.Printf("🧮 DEBUG: [提示词预算] 任务类型=%s, 字符数=%d, 估算tokens=%d\n", taskType, len([]rune(prompt)), estimate)
+	if err != nil {
+		fmt.Printf("❌ [提示词过大] 任务类型=%s: %v\n", taskType, err)
+	}
+	return err
+}
+
+// llmTaskFailure 将LLM服务返回的任务错误转换为 error；服务端按模型上下文拒绝的提示词包装为 ErrPromptTooLarge
+func llmTaskFailure(errorMsg string) error {
+	if strings.Contains(errorMsg, ErrPromptTooLarge.Error()) {
+		return fmt.Errorf("%w（LLM服务拒绝）: %s", ErrPromptTooLarge, errorMsg)
+	}
+	return errors.New(errorMsg)
+}
@@ -0,0 +1,164 @@
+package integration
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+//go:embed prompts/*.tmpl
+var defaultPromptFS embed.FS
+
+// 提示词阶段名称，对应模板文件名 <stage>.tmpl
+const (
+	PromptStageGroupCleaning          = "group_cleaning"           // 按编码前缀分组的数据清洗
+	PromptStageCleaningFallback       = "cleaning_fallback"        // 第一轮清洗的单次回退方案
+	PromptStageBatchOptimization      = "batch_optimization"       // 批次优化
+	PromptStagePrefixCleaning         = "prefix_cleaning"          // LLMServiceClient 的大类清洗
+	PromptStageSemanticChoice         = "semantic_choice"          // 第二轮语义选择
+	PromptStageSemanticChoiceDetailed = "semantic_choice_detailed" // 带来源标记的语义选择
+)
+
+// PromptData 提示词模板变量
+type PromptData struct {
+	Data            string // JSON格式的待处理数据
+	Code            string // 职业编码
+	Prefix          string // 大类编码前缀
+	RuleName        string // 规则（Excel）名称
+	PDFName         string // PDF名称
+	ParentHierarchy string // 父级层次
+	BatchID         int    // 批次编号
+	Count           int    // 批次数据条数
+}
+
+// PromptRegistry 提示词模板注册表
+type PromptRegistry struct {
+	templates map[string]*template.Template
+}
+
+// NewPromptRegistry 加载提示词模板
+// 先加载内置默认模板，再用 dir 目录下同名的 <stage>.tmpl 覆盖；dir 为空时只使用默认模板
+// 所有模板都会用示例数据试渲染一次，模板有误时直接返回错误
+func NewPromptRegistry(dir string) (*PromptRegistry, error) {
+	registry := &PromptRegistry{templates: make(map[string]*template.Template)}
+
+	entries, err := defaultPromptFS.ReadDir("prompts")
+	if err != nil {
+		return nil, fmt.Errorf("读取内置提示词模板失败: %w", err)
+	}
+	for _, entry := range entries {
+		content, err := defaultPromptFS.ReadFile("prompts/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("读取内置提示词模板 %s 失败: %w", entry.Name(), err)
+		}
+		if err := registry.add(strings.TrimSuffix(entry.Name(), ".tmpl"), string(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return nil, fmt.Errorf("扫描提示词模板目录失败: %w", err)
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("读取提示词模板 %s 失败: %w", file, err)
+			}
+			if err := registry.add(strings.TrimSuffix(filepath.Base(file), ".tmpl"), string(content)); err != nil {
+				return nil, err
+			}
+			fmt.Printf("📝 [提示词模板] 使用自定义模板: %s\n", file)
+		}
+	}
+
+	return registry, nil
+}
+
+// add 解析并校验单个模板
+func (r *PromptRegistry) add(stage, content string) error {
+	tmpl, err := template.New(stage).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return fmt.Errorf("解析提示词模板 %s 失败: %w", stage, err)
+	}
+
+	// 试渲染，确保模板引用的变量都存在
+	sample := PromptData{Data: "[]", Code: "1-01-01-01", Prefix: "1", RuleName: "示例", PDFName: "示例", ParentHierarchy: "示例", BatchID: 1, Count: 1}
+	if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+		return fmt.Errorf("校验提示词模板 %s 失败: %w", stage, err)
+	}
+
+	r.templates[stage] = tmpl
+	return nil
+}
+
+// Render 渲染指定阶段的提示词
+func (r *PromptRegistry) Render(stage string, data PromptData) (string, error) {
+	tmpl, ok := r.templates[stage]
+	if !ok {
+		return "", fmt.Errorf("提示词模板不存在: %s", stage)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("渲染提示词模板 %s 失败: %w", stage, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Stages 返回已注册的阶段名称
+func (r *PromptRegistry) Stages() []string {
+	stages := make([]string, 0, len(r.templates))
+	for stage := range r.templates {
+		stages = append(stages, stage)
+	}
+	return stages
+}
+
+var (
+	promptRegistryMu sync.RWMutex
+	promptRegistry   *PromptRegistry
+)
+
+// InitPromptTemplates 在服务启动时加载并校验提示词模板
+func InitPromptTemplates(dir string) error {
+	registry, err := NewPromptRegistry(dir)
+	if err != nil {
+		return err
+	}
+
+	promptRegistryMu.Lock()
+	promptRegistry = registry
+	promptRegistryMu.Unlock()
+	return nil
+}
+
+// currentPromptRegistry 获取当前提示词注册表，未初始化时按配置目录加载
+func currentPromptRegistry() *PromptRegistry {
+	promptRegistryMu.RLock()
+	registry := promptRegistry
+	promptRegistryMu.RUnlock()
+	if registry != nil {
+		return registry
+	}
+
+	if err := InitPromptTemplates(getPromptTemplatesDir()); err != nil {
+		// 自定义模板有误时退回内置模板，内置模板在测试中保证可用
+		fmt.Printf("⚠️ [提示词模板] 加载失败，使用内置模板: %v\n", err)
+		registry, _ = NewPromptRegistry("")
+		promptRegistryMu.Lock()
+		promptRegistry = registry
+		promptRegistryMu.Unlock()
+		return registry
+	}
+
+	promptRegistryMu.RLock()
+	defer promptRegistryMu.RUnlock()
+	return promptRegistry
+}
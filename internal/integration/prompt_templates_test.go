@@ -0,0 +1,63 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPromptRegistry_Defaults 测试内置模板均可渲染
+func TestPromptRegistry_Defaults(t *testing.T) {
+	registry, err := NewPromptRegistry("")
+	require.NoError(t, err)
+
+	stages := []string{
+		PromptStageGroupCleaning,
+		PromptStageCleaningFallback,
+		PromptStageBatchOptimization,
+		PromptStagePrefixCleaning,
+		PromptStageSemanticChoice,
+		PromptStageSemanticChoiceDetailed,
+	}
+	for _, stage := range stages {
+		prompt, err := registry.Render(stage, PromptData{Data: `[{"code":"1-01"}]`, Code: "1-01-01-01", Prefix: "1"})
+		require.NoError(t, err, stage)
+		assert.NotEmpty(t, prompt, stage)
+	}
+
+	prompt, err := registry.Render(PromptStageSemanticChoice, PromptData{Code: "2-02-01-01", RuleName: "规则名", PDFName: "PDF名", ParentHierarchy: "父级"})
+	require.NoError(t, err)
+	assert.Contains(t, prompt, "编码:2-02-01-01")
+	assert.Contains(t, prompt, "选项1:规则名")
+	assert.Contains(t, prompt, "选项2:PDF名")
+
+	_, err = registry.Render("unknown", PromptData{})
+	assert.Error(t, err)
+}
+
+// TestPromptRegistry_Override 测试目录模板覆盖与校验
+func TestPromptRegistry_Override(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, PromptStageSemanticChoice+".tmpl"), []byte("自定义:{{.Code}}"), 0644))
+
+	registry, err := NewPromptRegistry(dir)
+	require.NoError(t, err)
+
+	prompt, err := registry.Render(PromptStageSemanticChoice, PromptData{Code: "1-01"})
+	require.NoError(t, err)
+	assert.Equal(t, "自定义:1-01", prompt)
+
+	// 语法错误或引用不存在的变量都应在加载时失败
+	badDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(badDir, "broken.tmpl"), []byte("{{.Code"), 0644))
+	_, err = NewPromptRegistry(badDir)
+	assert.Error(t, err)
+
+	unknownVarDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(unknownVarDir, "unknown.tmpl"), []byte("{{.NotExist}}"), 0644))
+	_, err = NewPromptRegistry(unknownVarDir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PDFSkippedKey 跳过PDF验证和融合时写入任务结果的字段
+const PDFSkippedKey = "pdf_skipped"
+
+// EnrichmentMode 跳过PDF后对Excel解析结果的增强方式
+type EnrichmentMode string
+
+const (
+	// EnrichmentLLM 执行第二轮LLM语义选择（步骤4、5），候选名称只有规则解析结果
+	EnrichmentLLM EnrichmentMode = "llm"
+	// EnrichmentRule 不调用LLM，直接以规则解析结果完成任务
+	EnrichmentRule EnrichmentMode = "rule"
+)
+
+// FlowOptions 单个任务的增量流程选项，零值执行完整的5步流程
+type FlowOptions struct {
+	SkipPDF    bool           // 跳过步骤2、3的PDF验证和融合，分类的数据来源保持 excel
+	Enrichment EnrichmentMode // 跳过PDF后的增强方式，为空时使用 llm
+}
+
+// RequiredServices 返回增量流程依赖的下游服务，用于处理任务前的健康门控：
+// 跳过PDF时不需要PDF服务；跳过PDF且仅使用规则增强，或开启了规则降级（LLM不可用时以规则解析结果完成）时不需要LLM服务
+func (o FlowOptions) RequiredServices(ruleOnlyFallback bool) []string {
+	var services []string
+	if !o.SkipPDF {
+		services = append(services, DownstreamPDF)
+	}
+	if !ruleOnlyFallback && !(o.SkipPDF && o.Enrichment == EnrichmentRule) {
+		services = append(services, DownstreamLLM)
+	}
+	return services
+}
+
+// ParseEnrichmentMode 解析任务配置中的增强方式，为空时返回 llm
+func ParseEnrichmentMode(value string) (EnrichmentMode, error) {
+	switch mode := EnrichmentMode(strings.TrimSpace(value)); mode {
+	case "":
+		return EnrichmentLLM, nil
+	case EnrichmentLLM, EnrichmentRule:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("enrichment 必须是 %s 或 %s: %q", EnrichmentLLM, EnrichmentRule, value)
+	}
+}
+
+// errRuleOnlyEnrichment 任务选择仅规则增强时记录的跳过LLM原因
+var errRuleOnlyEnrichment = errors.New("任务跳过PDF且配置为仅使用规则解析结果")
+
+// processWithoutPDF 步骤1之后跳过PDF验证和融合，不再调用PDF服务：
+// 规则模式直接以规则解析结果完成，LLM模式对Excel解析结果执行步骤4、5。两种方式下分类的数据来源都是 excel
+func (p *IncrementalProcessor) processWithoutPDF(ctx context.Context, taskID string, enrichment EnrichmentMode, report *reportCollector) error {
+	fmt.Printf("⏭️ DEBUG: 跳过步骤2、3（PDF验证和融合）- taskID: %s, 增强方式: %s\n", taskID, enrichment)
+	report.recordPDFSkipped()
+	if err := p.mergeTaskResult(p.db.WithContext(ctx), taskID, "", map[string]interface{}{PDFSkippedKey: true}); err != nil {
+		fmt.Printf("⚠️ WARNING: 记录跳过PDF失败 - taskID: %s, 错误: %v\n", taskID, err)
+	}
+
+	if enrichment == EnrichmentRule {
+		if err := p.completeWithRules(ctx, taskID, errRuleOnlyEnrichment); err != nil {
+			return err
+		}
+		p.saveProcessingReport(ctx, taskID, report, true)
+		return nil
+	}
+	return p.runEnhancementSteps(ctx, taskID, report)
+}
@@ -0,0 +1,82 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/config"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// TestIncrementalProcessor_SkipPDF 测试跳过PDF时不调用PDF服务，分类以Excel数据完成
+func TestIncrementalProcessor_SkipPDF(t *testing.T) {
+	llmService := newFakeLLMService(t)
+	t.Setenv("LLM_SERVICE_URL", llmService.Host())
+	// PDF服务不可达，调用即失败
+	t.Setenv("PDF_VALIDATOR_URL", "127.0.0.1:1")
+	t.Setenv("LLM_MAX_RETRIES", "1")
+	t.Setenv("LLM_RETRY_BASE_BACKOFF", "1ms")
+
+	categories := []*model.Category{
+		{Code: "1-01-01-01", Name: "焊工", Level: "细类"},
+		{Code: "1-01-01-02", Name: "钳工", Level: "细类"},
+	}
+	ctx := context.Background()
+	run := func(t *testing.T, enrichment EnrichmentMode) (*database.SQLiteDB, string) {
+		db := newTestCategoryDB(t)
+		taskID := "3f1b5d7e-9a2c-4e6f-8b1d-3f5a7c9e1b2d"
+		require.NoError(t, db.CreateTask(ctx, &database.TaskRecord{
+			ID: taskID, Type: "rule", Status: "completed",
+			Config: datatypes.JSON(`{}`), Result: datatypes.JSON(`{"message":"Hierarchy saved to database"}`),
+		}))
+		processor := NewIncrementalProcessor(&config.Config{}, db)
+		opts := FlowOptions{SkipPDF: true, Enrichment: enrichment}
+		require.NoError(t, processor.ProcessIncrementalFlowWithOptions(ctx, taskID, "input.xlsx", categories, opts))
+		return db, taskID
+	}
+	assertExcelCompleted := func(t *testing.T, db *database.SQLiteDB, taskID string) map[string]interface{} {
+		var rows []database.Category
+		require.NoError(t, db.GetDB().Where("task_id = ? AND is_current = true", taskID).Order("code").Find(&rows).Error)
+		require.Len(t, rows, 2)
+		for _, row := range rows {
+			assert.Equal(t, database.StatusCompleted, row.Status, row.Code)
+			assert.Equal(t, database.DataSourceExcel, row.DataSource, row.Code)
+		}
+
+		var extractions int64
+		require.NoError(t, db.GetDB().Model(&database.PDFExtraction{}).Where("task_id = ?", taskID).Count(&extractions).Error)
+		assert.Zero(t, extractions, "跳过PDF时不保存PDF提取结果")
+
+		task, err := db.GetTask(ctx, taskID)
+		require.NoError(t, err)
+		assert.Equal(t, "completed", task.Status)
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(task.Result, &result))
+		assert.Equal(t, true, result[PDFSkippedKey])
+		report, ok := result[ProcessingReportKey].(map[string]interface{})
+		require.True(t, ok, "跳过PDF时同样生成处理报告")
+		assert.Equal(t, true, report["pdf_skipped"])
+		return result
+	}
+
+	t.Run("rule", func(t *testing.T) {
+		before := len(llmService.Requests())
+		db, taskID := run(t, EnrichmentRule)
+		result := assertExcelCompleted(t, db, taskID)
+		assert.Equal(t, true, result[LLMSkippedKey])
+		assert.Equal(t, before, len(llmService.Requests()), "仅规则增强时不调用LLM")
+	})
+
+	t.Run("llm", func(t *testing.T) {
+		before := len(llmService.Requests())
+		db, taskID := run(t, EnrichmentLLM)
+		result := assertExcelCompleted(t, db, taskID)
+		assert.Nil(t, result[LLMSkippedKey])
+		assert.Greater(t, len(llmService.Requests()), before, "LLM增强对Excel解析结果执行步骤4")
+	})
+}
@@ -0,0 +1,83 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStepTimeout 增量处理的单个步骤执行超时
+var ErrStepTimeout = errors.New("步骤执行超时")
+
+// metricsStageStepTimeout 步骤超时的指标阶段名称，错误信息中包含具体步骤
+const metricsStageStepTimeout = "step_timeout"
+
+// StepTimeoutConfig 增量处理各步骤的超时时间，0 表示该步骤不单独设置超时
+type StepTimeoutConfig struct {
+	ExcelSave   time.Duration `yaml:"excel_save"`   // 步骤1：保存Excel数据
+	PDFCleaning time.Duration `yaml:"pdf_cleaning"` // 步骤2：PDF解析和第一轮LLM清洗
+	Merge       time.Duration `yaml:"merge"`        // 步骤3：合并Excel和PDF数据
+	LLMEnhance  time.Duration `yaml:"llm_enhance"`  // 步骤4：第二轮LLM语义选择
+	FinalUpdate time.Duration `yaml:"final_update"` // 步骤5：更新最终结果和名称校验
+}
+
+// defaultStepTimeoutConfig 返回默认步骤超时，PDF和LLM步骤包含多次远程调用，超时较长
+func defaultStepTimeoutConfig() StepTimeoutConfig {
+	return StepTimeoutConfig{
+		ExcelSave:   2 * time.Minute,
+		PDFCleaning: 20 * time.Minute,
+		Merge:       2 * time.Minute,
+		LLMEnhance:  30 * time.Minute,
+		FinalUpdate: 5 * time.Minute,
+	}
+}
+
+// runStep 在带超时的context中执行一个步骤
+// 超时后立即返回 ErrStepTimeout，不再等待没有响应context取消的步骤；
+// 该步骤的goroutine会在后台自行结束，流程不会继续执行后续步骤
+func (p *IncrementalProcessor) runStep(ctx context.Context, taskID string, step string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+
+	// 步骤内部可以看到超时context；是否超时以注入的时钟为准，测试中推进假时钟即可触发
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(stepCtx)
+	}()
+
+	var err error
+	timedOut := false
+	select {
+	case err = <-done:
+		timedOut = errors.Is(stepCtx.Err(), context.DeadlineExceeded)
+	case <-stepCtx.Done():
+		// 步骤恰好在超时前完成时以步骤的结果为准
+		select {
+		case err = <-done:
+		default:
+			err = stepCtx.Err()
+		}
+		timedOut = errors.Is(stepCtx.Err(), context.DeadlineExceeded)
+	case <-p.timeSource().After(timeout):
+		cancel()
+		select {
+		case err = <-done:
+		default:
+			err = stepCtx.Err()
+		}
+		timedOut = true
+	}
+	if err == nil || ctx.Err() != nil || !timedOut {
+		return err
+	}
+
+	timeoutErr := fmt.Errorf("%w: %s 超过 %s", ErrStepTimeout, step, timeout)
+	p.metrics.RecordError(metricsStageStepTimeout, timeoutErr)
+	fmt.Printf("⏰ ERROR: 步骤超时 - taskID: %s, 步骤: %s, 超时: %s\n", taskID, step, timeout)
+	return timeoutErr
+}
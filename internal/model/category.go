@@ -28,6 +28,9 @@ type Category struct {
 	// Level 层级名称：大类/中类/小类/细类
 	Level string `json:"level" yaml:"level" validate:"required,oneof=大类 中类 小类 细类"`
 
+	// Synthesized 是否为构建时自动补全的占位节点
+	Synthesized bool `json:"synthesized,omitempty" yaml:"synthesized,omitempty"`
+
 	// Children 子分类列表
 	Children []*Category `json:"children,omitempty" yaml:"children,omitempty"`
 
@@ -78,6 +81,19 @@ type ParsedInfo struct {
 	RawContent string `json:"raw_content,omitempty"`
 }
 
+// ParseWarning 解析过程中被跳过的行或单元格
+// 用于追溯解析结果中缺失记录的原因
+type ParseWarning struct {
+	// Row Excel行号（从1开始），无法定位到行时为0
+	Row int `json:"row"`
+
+	// Cell 单元格位置，如 "B12"；涉及整行时为行内的列范围，如 "E12:F12"
+	Cell string `json:"cell"`
+
+	// Reason 跳过原因
+	Reason string `json:"reason"`
+}
+
 // GetLevelName 根据层级数字返回层级名称
 func (p *ParsedInfo) GetLevelName() string {
 	switch p.Level {
@@ -272,6 +288,9 @@ type HybridParseResult struct {
 
 	// Stats 统计信息
 	Stats *HybridParseStats `json:"stats"`
+
+	// Warnings 解析过程中被跳过的内容
+	Warnings []ParseWarning `json:"warnings,omitempty"`
 }
 
 // HybridParseStats 混合解析统计
@@ -285,6 +304,9 @@ type HybridParseStats struct {
 	// AITaskCount AI任务数量
 	AITaskCount int `json:"ai_task_count"`
 
+	// WarningCount 解析警告数量
+	WarningCount int `json:"warning_count"`
+
 	// ProcessingTime 处理时间(毫秒)
 	ProcessingTime int64 `json:"processing_time"`
 }
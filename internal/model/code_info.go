@@ -0,0 +1,34 @@
+package model
+
+import "strings"
+
+// CodeInfo 从职业编码推导出的层级信息
+// 编码每一段对应一个层级，如 "1-01-01-01" 为细类，其父级为 "1-01-01"
+type CodeInfo struct {
+	// Code 职业编码
+	Code string `json:"code"`
+
+	// ParentCode 父级编码，大类为空
+	ParentCode string `json:"parent_code"`
+
+	// Depth 层级深度，大类为0，细类为3；编码为空时为-1
+	Depth int `json:"depth"`
+
+	// Level 层级名称（大类/中类/小类/细类），层级超出细类时为空
+	Level string `json:"level"`
+}
+
+// ParseCodeInfo 根据编码推导父级编码和层级
+func ParseCodeInfo(code string) CodeInfo {
+	code = strings.TrimSpace(code)
+	c := &Category{Code: code}
+	info := CodeInfo{
+		Code:       code,
+		ParentCode: c.GetParentCode(),
+		Depth:      c.GetLevel(),
+	}
+	if info.Depth >= 0 && info.Depth <= 3 {
+		info.Level = (&ParsedInfo{Level: info.Depth}).GetLevelName()
+	}
+	return info
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestParseCodeInfo(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected CodeInfo
+	}{
+		{code: "1", expected: CodeInfo{Code: "1", ParentCode: "", Depth: 0, Level: LevelMajor}},
+		{code: "1-01", expected: CodeInfo{Code: "1-01", ParentCode: "1", Depth: 1, Level: LevelMiddle}},
+		{code: "1-01-01", expected: CodeInfo{Code: "1-01-01", ParentCode: "1-01", Depth: 2, Level: LevelSmall}},
+		{code: " 1-01-01-01 ", expected: CodeInfo{Code: "1-01-01-01", ParentCode: "1-01-01", Depth: 3, Level: LevelDetail}},
+		{code: "1-01-01-01-01", expected: CodeInfo{Code: "1-01-01-01-01", ParentCode: "1-01-01-01", Depth: 4, Level: ""}},
+		{code: "", expected: CodeInfo{Depth: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := ParseCodeInfo(tt.code); got != tt.expected {
+				t.Errorf("ParseCodeInfo(%q) = %+v, want %+v", tt.code, got, tt.expected)
+			}
+		})
+	}
+}
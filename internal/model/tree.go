@@ -0,0 +1,170 @@
+package model
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// FlatCategory 扁平化分类结构，通过 ParentCode 指向父节点
+// 数据库按行存储分类，API 也以扁平列表返回，便于前端快速渲染大型数据集
+type FlatCategory struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Level       string `json:"level"`
+	ParentCode  string `json:"parent_code"`
+	HasChildren bool   `json:"has_children"` // 是否有子节点，用于前端展开/收起功能
+	HasLLM      bool   `json:"has_llm"`      // 是否有LLM增强数据
+	HasPDF      bool   `json:"has_pdf"`      // 是否有PDF信息数据
+}
+
+// BuildTree 将扁平分类列表还原为树形结构
+// 节点挂到 ParentCode 指向的父节点下；父节点不在列表中时沿编码向上查找最近的祖先，
+// 没有任何祖先时才作为根节点。同一编码只保留第一次出现的记录，子节点保持输入顺序
+func BuildTree(flat []FlatCategory) []*Category {
+	nodes := make(map[string]*Category, len(flat))
+	ordered := make([]FlatCategory, 0, len(flat))
+	for _, item := range flat {
+		if _, exists := nodes[item.Code]; exists {
+			continue
+		}
+		nodes[item.Code] = &Category{
+			Code:  item.Code,
+			Name:  item.Name,
+			Level: item.Level,
+		}
+		ordered = append(ordered, item)
+	}
+
+	var roots []*Category
+	for _, item := range ordered {
+		node := nodes[item.Code]
+		if parent := findTreeParent(nodes, item); parent != nil {
+			parent.AddChild(node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots
+}
+
+// findTreeParent 查找节点在列表中最近的祖先
+func findTreeParent(nodes map[string]*Category, item FlatCategory) *Category {
+	if item.ParentCode != "" && item.ParentCode != item.Code {
+		if parent, exists := nodes[item.ParentCode]; exists {
+			return parent
+		}
+	}
+
+	probe := &Category{Code: item.Code}
+	for code := probe.GetParentCode(); code != ""; code = probe.GetParentCode() {
+		if parent, exists := nodes[code]; exists {
+			return parent
+		}
+		probe.Code = code
+	}
+	return nil
+}
+
+// DedupPolicy 展开时重复编码的取舍策略
+type DedupPolicy string
+
+const (
+	// DedupFirst 保留第一次出现的节点
+	DedupFirst DedupPolicy = "first"
+	// DedupComplete 完整性优先：层级与编码一致的节点优先，其次名称更长的节点，相同时保留先出现的
+	DedupComplete DedupPolicy = "complete"
+)
+
+// DuplicateReplacement 完整性优先去重时，后出现的节点替换了先出现节点的名称或层级
+type DuplicateReplacement struct {
+	Code     string
+	OldName  string
+	NewName  string
+	OldLevel string
+	NewLevel string
+}
+
+// Flatten 将树形结构按先序遍历展开为扁平列表
+// 根节点的 ParentCode 为空；重复编码只保留第一次出现的节点（及其子树），避免违反数据库唯一约束
+func Flatten(roots []*Category) []FlatCategory {
+	flat, _ := FlattenWithPolicy(roots, DedupFirst)
+	return flat
+}
+
+// FlattenWithPolicy 按指定策略处理重复编码的 Flatten
+// 无论哪种策略，节点位置和子树都取第一次出现的节点；DedupComplete 只替换名称和层级，并返回替换记录
+func FlattenWithPolicy(roots []*Category, policy DedupPolicy) ([]FlatCategory, []DuplicateReplacement) {
+	var best map[string]*Category
+	if policy == DedupComplete {
+		best = mostCompleteNodes(roots)
+	}
+
+	var flat []FlatCategory
+	var replacements []DuplicateReplacement
+	seen := make(map[string]bool)
+
+	var walk func(nodes []*Category, parentCode string)
+	walk = func(nodes []*Category, parentCode string) {
+		for _, node := range nodes {
+			if node == nil || seen[node.Code] {
+				continue
+			}
+			seen[node.Code] = true
+
+			name, level := node.Name, node.Level
+			if chosen := best[node.Code]; chosen != nil && chosen != node {
+				name, level = chosen.Name, chosen.Level
+				replacements = append(replacements, DuplicateReplacement{
+					Code:     node.Code,
+					OldName:  node.Name,
+					NewName:  name,
+					OldLevel: node.Level,
+					NewLevel: level,
+				})
+			}
+
+			flat = append(flat, FlatCategory{
+				Code:        node.Code,
+				Name:        name,
+				Level:       level,
+				ParentCode:  parentCode,
+				HasChildren: len(node.Children) > 0,
+			})
+			walk(node.Children, node.Code)
+		}
+	}
+	walk(roots, "")
+
+	return flat, replacements
+}
+
+// mostCompleteNodes 遍历整棵树，为每个编码选出最完整的节点
+func mostCompleteNodes(roots []*Category) map[string]*Category {
+	best := make(map[string]*Category)
+	var walk func(nodes []*Category)
+	walk = func(nodes []*Category) {
+		for _, node := range nodes {
+			if node == nil {
+				continue
+			}
+			if current, exists := best[node.Code]; !exists || moreComplete(node, current) {
+				best[node.Code] = node
+			}
+			walk(node.Children)
+		}
+	}
+	walk(roots)
+	return best
+}
+
+// moreComplete 判断 candidate 是否比 current 更完整：层级与编码推导的层级一致者优先，其次名称字符数更多者
+func moreComplete(candidate, current *Category) bool {
+	expected := ParseCodeInfo(candidate.Code).Level
+	candidateMatches := expected != "" && candidate.Level == expected
+	currentMatches := expected != "" && current.Level == expected
+	if candidateMatches != currentMatches {
+		return candidateMatches
+	}
+	return utf8.RuneCountInString(strings.TrimSpace(candidate.Name)) > utf8.RuneCountInString(strings.TrimSpace(current.Name))
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildTree(t *testing.T) {
+	flat := []FlatCategory{
+		{Code: "1", Name: "大类1", Level: "大类"},
+		{Code: "1-01", Name: "中类1", Level: "中类", ParentCode: "1"},
+		{Code: "1-01-01", Name: "小类1", Level: "小类", ParentCode: "1-01"},
+		{Code: "1-01-01-01", Name: "细类1", Level: "细类", ParentCode: "1-01-01"},
+		{Code: "1-01-01-01", Name: "重复细类", Level: "细类", ParentCode: "1-01-01"},
+		{Code: "2", Name: "大类2", Level: "大类"},
+		// 父节点 2-01 不在列表中，应挂到最近的祖先 2 下而不是成为根节点
+		{Code: "2-01-01", Name: "小类2", Level: "小类", ParentCode: "2-01"},
+		// 列表中没有任何祖先的节点作为根节点
+		{Code: "3-01", Name: "中类3", Level: "中类", ParentCode: "3"},
+	}
+
+	roots := BuildTree(flat)
+
+	var rootCodes []string
+	for _, root := range roots {
+		rootCodes = append(rootCodes, root.Code)
+	}
+	if expected := []string{"1", "2", "3-01"}; !reflect.DeepEqual(rootCodes, expected) {
+		t.Fatalf("Expected roots %v, got %v", expected, rootCodes)
+	}
+
+	detail := roots[0].FindDescendant("1-01-01-01")
+	if detail == nil {
+		t.Fatal("Expected 1-01-01-01 to be nested under 1")
+	}
+	if detail.Name != "细类1" {
+		t.Errorf("Expected first occurrence to win, got %s", detail.Name)
+	}
+	if roots[0].GetTotalDescendantsCount() != 3 {
+		t.Errorf("Expected 3 descendants under 1, got %d", roots[0].GetTotalDescendantsCount())
+	}
+
+	if roots[1].FindChild("2-01-01") == nil {
+		t.Error("Expected orphan 2-01-01 to be attached to nearest ancestor 2")
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	root := &Category{Code: "1", Name: "大类1", Level: "大类"}
+	middle := &Category{Code: "1-01", Name: "中类1", Level: "中类"}
+	middle.AddChild(&Category{Code: "1-01-01", Name: "小类1", Level: "小类"})
+	root.AddChild(middle)
+	root.AddChild(&Category{Code: "1-01", Name: "重复中类", Level: "中类"})
+
+	flat := Flatten([]*Category{root, nil, {Code: "2", Name: "大类2", Level: "大类"}})
+
+	expected := []FlatCategory{
+		{Code: "1", Name: "大类1", Level: "大类", HasChildren: true},
+		{Code: "1-01", Name: "中类1", Level: "中类", ParentCode: "1", HasChildren: true},
+		{Code: "1-01-01", Name: "小类1", Level: "小类", ParentCode: "1-01"},
+		{Code: "2", Name: "大类2", Level: "大类"},
+	}
+	if !reflect.DeepEqual(flat, expected) {
+		t.Errorf("Flatten() = %+v, expected %+v", flat, expected)
+	}
+}
+
+func TestFlattenWithPolicy_PrefersCompleteName(t *testing.T) {
+	root := &Category{Code: "1", Name: "党的机关、国家机关、群众团体和社会组织、企事业单位负责人", Level: "大类"}
+	middle := &Category{Code: "1-01", Name: "中国共产党机关负", Level: "中类"}
+	middle.AddChild(&Category{Code: "1-01-01", Name: "小类1", Level: "小类"})
+	root.AddChild(middle)
+	root.AddChild(&Category{Code: "1-01", Name: "中国共产党机关负责人", Level: "中类"})
+	// 层级与编码不一致的记录即使名称更长也不采用
+	root.AddChild(&Category{Code: "1-01", Name: "中国共产党机关负责人（误识别）", Level: "细类"})
+
+	flat, replacements := FlattenWithPolicy([]*Category{root}, DedupComplete)
+
+	expected := []FlatCategory{
+		{Code: "1", Name: root.Name, Level: "大类", HasChildren: true},
+		{Code: "1-01", Name: "中国共产党机关负责人", Level: "中类", ParentCode: "1", HasChildren: true},
+		{Code: "1-01-01", Name: "小类1", Level: "小类", ParentCode: "1-01"},
+	}
+	if !reflect.DeepEqual(flat, expected) {
+		t.Errorf("FlattenWithPolicy() = %+v, expected %+v", flat, expected)
+	}
+	expectedReplacements := []DuplicateReplacement{
+		{Code: "1-01", OldName: "中国共产党机关负", NewName: "中国共产党机关负责人", OldLevel: "中类", NewLevel: "中类"},
+	}
+	if !reflect.DeepEqual(replacements, expectedReplacements) {
+		t.Errorf("replacements = %+v, expected %+v", replacements, expectedReplacements)
+	}
+
+	firstFlat, firstReplacements := FlattenWithPolicy([]*Category{root}, DedupFirst)
+	if firstFlat[1].Name != "中国共产党机关负" || len(firstReplacements) != 0 {
+		t.Errorf("DedupFirst should keep the first occurrence, got %+v, %+v", firstFlat[1], firstReplacements)
+	}
+}
+
+func TestBuildTree_FlattenRoundTrip(t *testing.T) {
+	flat := []FlatCategory{
+		{Code: "1", Name: "大类1", Level: "大类", HasChildren: true},
+		{Code: "1-01", Name: "中类1", Level: "中类", ParentCode: "1", HasChildren: true},
+		{Code: "1-01-01", Name: "小类1", Level: "小类", ParentCode: "1-01", HasChildren: true},
+		{Code: "1-01-01-01", Name: "细类1", Level: "细类", ParentCode: "1-01-01"},
+		{Code: "1-02", Name: "中类2", Level: "中类", ParentCode: "1"},
+		{Code: "2", Name: "大类2", Level: "大类"},
+	}
+
+	if result := Flatten(BuildTree(flat)); !reflect.DeepEqual(result, flat) {
+		t.Errorf("Round trip mismatch:\n got %+v\nwant %+v", result, flat)
+	}
+}
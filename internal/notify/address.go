@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// ErrBlockedAddress 回调地址解析到回环、链路本地或内网地址，且主机不在白名单中
+var ErrBlockedAddress = errors.New("回调地址指向内网或本机地址")
+
+// AllowedHostsFromEnv 读取 TASK_CALLBACK_ALLOWED_HOSTS（逗号分隔的主机名或IP），
+// 白名单中的主机跳过内网地址检查，用于接收方部署在内网的场景
+func AllowedHostsFromEnv() []string {
+	var hosts []string
+	for _, host := range strings.Split(os.Getenv("TASK_CALLBACK_ALLOWED_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// hostAllowed 判断主机是否在白名单中，主机名不区分大小写
+func hostAllowed(host string, allowedHosts []string) bool {
+	for _, allowed := range allowedHosts {
+		if strings.EqualFold(strings.Trim(allowed, "[]"), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublicIP 判断地址是否可以作为回调目标：排除回环、链路本地、RFC1918/ULA内网、未指定和组播地址
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast())
+}
+
+// resolvePublicIPs 解析主机的所有地址，任一地址不是公网地址时返回 ErrBlockedAddress
+// 全部检查而不是挑选公网地址，避免同时返回内网地址的域名绕过检查
+func resolvePublicIPs(ctx context.Context, host string) ([]net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("解析回调地址 %s 失败: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("回调地址 %s 没有可用的IP", host)
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return nil, fmt.Errorf("%w: %s -> %s", ErrBlockedAddress, host, addr.IP)
+		}
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
+
+// safeDialContext 返回只连接公网地址的拨号函数
+// 拨号时重新解析并直接连接检查过的IP，防止提交后通过DNS重绑定指向内网
+func safeDialContext(dialer *net.Dialer, allowedHosts []string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if hostAllowed(host, allowedHosts) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		ips, err := resolvePublicIPs(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
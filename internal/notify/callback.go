@@ -0,0 +1,260 @@
+// Package notify 在任务结束时向客户端提供的回调地址发送通知
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/httpx"
+)
+
+// 回调投递状态，记录在任务的 callback_status 字段
+const (
+	CallbackStatusPending   = "pending"
+	CallbackStatusDelivered = "delivered"
+	CallbackStatusFailed    = "failed"
+)
+
+// 回调请求头
+const (
+	EventHeader     = "X-Moonshot-Event"
+	SignatureHeader = "X-Moonshot-Signature"
+
+	// EventTaskFinished 任务进入终态（completed、failed、cancelled）时发送的事件
+	EventTaskFinished = "task.finished"
+)
+
+// maxErrorBodyBytes 记录回调失败原因时最多读取的响应体长度
+const maxErrorBodyBytes = 512
+
+// Config 回调通知配置
+type Config struct {
+	Secret     string        // HMAC签名密钥，为空时不签名
+	Timeout    time.Duration // 单次请求超时
+	MaxRetries int           // 首次失败后的最大重试次数
+	RetryDelay time.Duration // 首次重试前的等待时间，之后每次翻倍
+
+	AllowedHosts []string // 允许指向内网或本机地址的回调主机白名单
+}
+
+// DefaultConfig 默认回调配置：10秒超时，最多重试3次
+func DefaultConfig() Config {
+	return Config{
+		Timeout:    10 * time.Second,
+		MaxRetries: 3,
+		RetryDelay: time.Second,
+	}
+}
+
+// ConfigFromEnv 从环境变量读取回调配置，未设置或格式错误的项使用默认值
+// TASK_CALLBACK_SECRET、TASK_CALLBACK_TIMEOUT、TASK_CALLBACK_MAX_RETRIES、TASK_CALLBACK_RETRY_DELAY、TASK_CALLBACK_ALLOWED_HOSTS
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	cfg.Secret = os.Getenv("TASK_CALLBACK_SECRET")
+	cfg.AllowedHosts = AllowedHostsFromEnv()
+	if v := os.Getenv("TASK_CALLBACK_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.Timeout = d
+		}
+	}
+	if v := os.Getenv("TASK_CALLBACK_MAX_RETRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.MaxRetries = n
+		}
+	}
+	if v := os.Getenv("TASK_CALLBACK_RETRY_DELAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.RetryDelay = d
+		}
+	}
+	return cfg
+}
+
+// ValidateCallbackURL 校验回调地址，只接受带主机名的 http/https 绝对地址
+// 不在 allowedHosts 中的主机会解析DNS，解析到回环、链路本地或内网地址时拒绝
+func ValidateCallbackURL(ctx context.Context, raw string, allowedHosts []string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("无效的回调地址: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("回调地址必须是 http 或 https 绝对地址")
+	}
+	if hostAllowed(u.Hostname(), allowedHosts) {
+		return nil
+	}
+	_, err = resolvePublicIPs(ctx, u.Hostname())
+	return err
+}
+
+// Payload 回调请求体
+type Payload struct {
+	Event       string          `json:"event"`
+	TaskID      string          `json:"task_id"`
+	Status      string          `json:"status"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	ProcessedAt *time.Time      `json:"processed_at,omitempty"`
+	Timestamp   time.Time       `json:"timestamp"`
+}
+
+// Sign 计算请求体的签名，格式为 "sha256=<hex(HMAC-SHA256(secret, body))>"
+// 接收方用相同密钥对原始请求体计算后比较 X-Moonshot-Signature 即可校验来源
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// TaskNotifier 任务结束回调通知器
+type TaskNotifier struct {
+	db     database.DatabaseInterface
+	client *http.Client
+	config Config
+}
+
+// NewTaskNotifier 创建任务回调通知器
+func NewTaskNotifier(db database.DatabaseInterface, cfg Config) *TaskNotifier {
+	defaults := DefaultConfig()
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaults.RetryDelay
+	}
+
+	// 重试由 Notify 自己控制；拨号时再次检查目标地址，不经过环境变量中的代理，
+	// 避免提交后DNS重绑定或代理转发把回调送到内网
+	clientConfig := httpx.DefaultConfig()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.MaxIdleConns = clientConfig.MaxIdleConns
+	transport.MaxIdleConnsPerHost = clientConfig.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = clientConfig.IdleConnTimeout
+	transport.DialContext = safeDialContext(&net.Dialer{Timeout: cfg.Timeout, KeepAlive: 30 * time.Second}, cfg.AllowedHosts)
+	return &TaskNotifier{
+		db:     db,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		config: cfg,
+	}
+}
+
+// Notify 向任务的回调地址发送当前状态，并将投递结果记录到任务上
+// 任务没有回调地址时直接返回；网络错误、5xx和429会按退避重试，其他4xx视为接收方拒绝，不再重试
+func (n *TaskNotifier) Notify(ctx context.Context, taskID string) error {
+	task, err := n.db.GetTask(ctx, taskID)
+	if err != nil {
+		return fmt.Errorf("获取任务记录失败: %w", err)
+	}
+	if task.CallbackURL == "" {
+		return nil
+	}
+
+	payload := Payload{
+		Event:       EventTaskFinished,
+		TaskID:      task.ID,
+		Status:      task.Status,
+		Error:       task.ErrorMsg,
+		ProcessedAt: task.ProcessedAt,
+		Timestamp:   time.Now(),
+	}
+	if len(task.Result) > 0 && json.Valid(task.Result) {
+		payload.Result = json.RawMessage(task.Result)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("序列化回调数据失败: %w", err)
+	}
+
+	attempts, deliverErr := n.deliver(ctx, task.CallbackURL, body)
+
+	updates := map[string]interface{}{
+		"callback_status":   CallbackStatusDelivered,
+		"callback_attempts": task.CallbackAttempts + attempts,
+		"callback_error":    "",
+	}
+	if deliverErr != nil {
+		updates["callback_status"] = CallbackStatusFailed
+		updates["callback_error"] = deliverErr.Error()
+	}
+	// 只更新回调字段，避免覆盖并发写入的任务状态和结果
+	if err := n.db.WithContext(ctx).Model(&database.TaskRecord{}).Where("id = ?", taskID).Updates(updates).Error; err != nil {
+		log.Printf("记录任务回调状态失败 - TaskID: %s: %v", taskID, err)
+	}
+	if deliverErr != nil {
+		return fmt.Errorf("回调投递失败（尝试 %d 次）: %w", attempts, deliverErr)
+	}
+	log.Printf("任务回调成功 - TaskID: %s, Status: %s", taskID, task.Status)
+	return nil
+}
+
+// deliver 发送回调请求直到成功或重试耗尽，返回实际尝试次数
+func (n *TaskNotifier) deliver(ctx context.Context, callbackURL string, body []byte) (int, error) {
+	delay := n.config.RetryDelay
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		retryable, err := n.post(ctx, callbackURL, body)
+		if err == nil {
+			return attempt, nil
+		}
+		lastErr = err
+		if !retryable || attempt > n.config.MaxRetries {
+			return attempt, lastErr
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, fmt.Errorf("%v (重试已取消: %w)", lastErr, ctx.Err())
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// post 发送一次回调请求，返回错误是否可以重试
+func (n *TaskNotifier) post(ctx context.Context, callbackURL string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("创建回调请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, EventTaskFinished)
+	if n.config.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.config.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// 目标地址被拒绝时重试也不会成功
+		return ctx.Err() == nil && !errors.Is(err, ErrBlockedAddress), fmt.Errorf("发送回调请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, fmt.Errorf("回调地址返回状态码 %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+}
@@ -0,0 +1,203 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"gorm.io/datatypes"
+)
+
+func newTestDB(t *testing.T) database.DatabaseInterface {
+	t.Helper()
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	if err := db.CreateTables(context.Background()); err != nil {
+		t.Fatalf("创建表失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func createTask(t *testing.T, db database.DatabaseInterface, id, callbackURL string) {
+	t.Helper()
+	task := &database.TaskRecord{
+		ID:             id,
+		Type:           "rule",
+		Status:         "completed",
+		Config:         datatypes.JSON(`{}`),
+		Result:         datatypes.JSON(`{"status":"completed","message":"Hierarchy saved to database"}`),
+		CallbackURL:    callbackURL,
+		CallbackStatus: CallbackStatusPending,
+	}
+	if err := db.CreateTask(context.Background(), task); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+}
+
+func testConfig() Config {
+	return Config{Secret: "test-secret", Timeout: time.Second, MaxRetries: 2, RetryDelay: time.Millisecond, AllowedHosts: []string{"127.0.0.1"}}
+}
+
+func TestNotify_SignsPayloadAndRecordsDelivery(t *testing.T) {
+	var body []byte
+	var signature, event string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		event = r.Header.Get(EventHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	db := newTestDB(t)
+	createTask(t, db, "task-1", server.URL)
+
+	if err := NewTaskNotifier(db, testConfig()).Notify(context.Background(), "task-1"); err != nil {
+		t.Fatalf("Expected delivery to succeed, got %v", err)
+	}
+	if signature != Sign("test-secret", body) {
+		t.Errorf("Signature %q does not match body", signature)
+	}
+	if event != EventTaskFinished {
+		t.Errorf("Expected event header %q, got %q", EventTaskFinished, event)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("解析回调数据失败: %v", err)
+	}
+	if payload.TaskID != "task-1" || payload.Status != "completed" || len(payload.Result) == 0 {
+		t.Errorf("Unexpected payload: %s", body)
+	}
+
+	task, _ := db.GetTask(context.Background(), "task-1")
+	if task.CallbackStatus != CallbackStatusDelivered || task.CallbackAttempts != 1 {
+		t.Errorf("Expected delivered after 1 attempt, got %s/%d", task.CallbackStatus, task.CallbackAttempts)
+	}
+}
+
+func TestNotify_RetriesServerErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	db := newTestDB(t)
+	createTask(t, db, "task-2", server.URL)
+
+	if err := NewTaskNotifier(db, testConfig()).Notify(context.Background(), "task-2"); err != nil {
+		t.Fatalf("Expected delivery after retries, got %v", err)
+	}
+	task, _ := db.GetTask(context.Background(), "task-2")
+	if task.CallbackStatus != CallbackStatusDelivered || task.CallbackAttempts != 3 {
+		t.Errorf("Expected delivered after 3 attempts, got %s/%d", task.CallbackStatus, task.CallbackAttempts)
+	}
+}
+
+func TestNotify_ClientErrorFailsWithoutRetry(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	db := newTestDB(t)
+	createTask(t, db, "task-3", server.URL)
+
+	if err := NewTaskNotifier(db, testConfig()).Notify(context.Background(), "task-3"); err == nil {
+		t.Fatal("Expected delivery to fail on 401")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected no retry on 401, got %d attempts", attempts)
+	}
+	task, _ := db.GetTask(context.Background(), "task-3")
+	if task.CallbackStatus != CallbackStatusFailed || task.CallbackError == "" {
+		t.Errorf("Expected failed status with error, got %s/%q", task.CallbackStatus, task.CallbackError)
+	}
+}
+
+func TestNotify_SkipsTasksWithoutCallback(t *testing.T) {
+	db := newTestDB(t)
+	createTask(t, db, "task-4", "")
+
+	if err := NewTaskNotifier(db, testConfig()).Notify(context.Background(), "task-4"); err != nil {
+		t.Fatalf("Expected no-op for task without callback, got %v", err)
+	}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	ctx := context.Background()
+	if err := ValidateCallbackURL(ctx, "https://93.184.216.34/hooks/moonshot", nil); err != nil {
+		t.Errorf("Expected valid URL, got %v", err)
+	}
+	for _, raw := range []string{"example.com/hook", "ftp://example.com/hook", "http://", "://bad"} {
+		if err := ValidateCallbackURL(ctx, raw, nil); err == nil {
+			t.Errorf("Expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestValidateCallbackURL_RejectsInternalAddresses(t *testing.T) {
+	ctx := context.Background()
+	for _, raw := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.5/hook",
+		"http://172.16.3.4/hook",
+		"http://192.168.1.10/hook",
+		"http://0.0.0.0/hook",
+	} {
+		if err := ValidateCallbackURL(ctx, raw, nil); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Expected %q to be blocked, got %v", raw, err)
+		}
+	}
+	if err := ValidateCallbackURL(ctx, "http://10.0.0.5/hook", []string{"10.0.0.5"}); err != nil {
+		t.Errorf("Expected allowlisted host to pass, got %v", err)
+	}
+}
+
+func TestNotify_RefusesInternalAddressWithoutAllowlist(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	db := newTestDB(t)
+	createTask(t, db, "task-5", server.URL)
+
+	cfg := testConfig()
+	cfg.AllowedHosts = nil
+	err := NewTaskNotifier(db, cfg).Notify(context.Background(), "task-5")
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Expected blocked address error, got %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 0 {
+		t.Errorf("Expected no request to reach the internal server, got %d", calls)
+	}
+
+	task, _ := db.GetTask(context.Background(), "task-5")
+	if task.CallbackStatus != CallbackStatusFailed || task.CallbackAttempts != 1 {
+		t.Errorf("Expected one failed attempt without retries, got status=%s attempts=%d", task.CallbackStatus, task.CallbackAttempts)
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"strings"
 
 	"github.com/freedkr/moonshot/internal/model"
-	"github.com/xuri/excelize/v2"
 )
 
 // ExcelParserImpl Excel解析器实现
@@ -30,14 +29,18 @@ type ExcelParserImpl struct {
 	// 它通过查找 "代码" 或 "代码 (GBM xxxx)" 模式来分割字符串。
 	// 示例: "1 (GBM 10000) A 2-01 B" -> 会找到 "1 (GBM 10000)" 和 "2-01"
 	reCodeFinder *regexp.Regexp
+	// schema 词典格式，提供编码正则、层级规则和列布局
+	schema *compiledSchema
 }
 
 // ParserConfig 解析器配置
 type ParserConfig struct {
-	SheetName     string `yaml:"sheet_name" json:"sheet_name"`
-	StrictMode    bool   `yaml:"strict_mode" json:"strict_mode"`
-	SkipEmptyRows bool   `yaml:"skip_empty_rows" json:"skip_empty_rows"`
-	MaxRows       int    `yaml:"max_rows" json:"max_rows"`
+	SheetName       string   `yaml:"sheet_name" json:"sheet_name"`
+	SheetCandidates []string `yaml:"sheet_candidates" json:"sheet_candidates"` // 配置的工作表不存在时依次尝试的名称
+	StrictMode      bool     `yaml:"strict_mode" json:"strict_mode"`
+	SkipEmptyRows   bool     `yaml:"skip_empty_rows" json:"skip_empty_rows"`
+	MaxRows         int      `yaml:"max_rows" json:"max_rows"`
+	Schema          string   `yaml:"schema" json:"schema"` // 词典格式名称，为空时使用 gbt2022
 }
 
 // NewExcelParser 创建新的Excel解析器
@@ -51,14 +54,30 @@ func NewExcelParser(config *ParserConfig) *ExcelParserImpl {
 		}
 	}
 
+	schema := newParserSchema(config)
 	return &ExcelParserImpl{
 		config:       config,
 		reWhitespace: regexp.MustCompile(`\s+`),
-		reUnified:    regexp.MustCompile(`^(.*?)([\d-]+)\s*(?:\(\s*GBM\s*(\d+)\s*\))?\s*(.*)$`), // 详见结构体注释
-		reCodeFinder: regexp.MustCompile(`[\d-]+(?:\s*\(\s*GBM\s*\d+\s*\))?`),
+		reUnified:    schema.reUnified, // 详见结构体注释
+		reCodeFinder: schema.reCodeFinder,
+		schema:       schema,
 	}
 }
 
+// MaxRows 返回最大处理行数（0表示不限制）
+func (p *ExcelParserImpl) MaxRows() int {
+	return p.config.MaxRows
+}
+
+// WithMaxRows 返回只修改最大处理行数的解析器副本，用于单个任务覆盖全局配置，原解析器不受影响
+func (p *ExcelParserImpl) WithMaxRows(maxRows int) *ExcelParserImpl {
+	config := *p.config
+	config.MaxRows = maxRows
+	clone := *p
+	clone.config = &config
+	return &clone
+}
+
 // Parse 解析输入数据
 func (p *ExcelParserImpl) Parse(ctx context.Context, input io.Reader) ([]*model.ParsedInfo, error) {
 	// 由于excelize需要文件路径，这里需要特殊处理
@@ -69,27 +88,46 @@ func (p *ExcelParserImpl) Parse(ctx context.Context, input io.Reader) ([]*model.
 
 // ParseFile 解析Excel文件
 func (p *ExcelParserImpl) ParseFile(ctx context.Context, filePath string) ([]*model.ParsedInfo, error) {
-	f, err := excelize.OpenFile(filePath)
+	records, _, err := p.ParseFileWithWarnings(ctx, filePath)
+	return records, err
+}
+
+// ParseFileWithWarnings 解析Excel文件，并返回解析过程中被跳过的行和单元格
+func (p *ExcelParserImpl) ParseFileWithWarnings(ctx context.Context, filePath string) ([]*model.ParsedInfo, []model.ParseWarning, error) {
+	f, err := openWorkbook(filePath)
 	if err != nil {
-		return nil, model.NewFileError(model.ErrCodeFileReadError, filePath, "open", "打开Excel文件失败", err)
+		return nil, nil, model.NewFileError(model.ErrCodeFileReadError, filePath, "open", "打开Excel文件失败", err)
 	}
 	defer f.Close()
 
-	rows, err := f.GetRows(p.config.SheetName)
+	sheetName, err := selectSheet(f, filePath, p.config)
 	if err != nil {
-		return nil, model.NewFileError(model.ErrCodeFileReadError, p.config.SheetName, "read_sheet", "读取工作表数据失败", err)
+		return nil, nil, err
 	}
 
+	rows, err := f.Rows(sheetName)
+	if err != nil {
+		return nil, nil, model.NewFileError(model.ErrCodeFileReadError, sheetName, "read_sheet", "读取工作表数据失败", err)
+	}
+
+	// 只解析前 MaxRows 行（含表头），用于快速预览大文件
+	if p.config.MaxRows > 0 && len(rows) > p.config.MaxRows {
+		log.Printf("工作表 %s 共 %d 行，按 max_rows 只解析前 %d 行", sheetName, len(rows), p.config.MaxRows)
+		rows = rows[:p.config.MaxRows]
+	}
+
+	warnings := &parseWarnings{}
+
 	// 第一步：从E/F列（索引4和5）直接提取所有细类记录。
-	detailRecords, err := p.extractDetailRecords(ctx, rows)
+	detailRecords, err := p.extractDetailRecords(ctx, rows, warnings)
 	if err != nil {
-		return nil, fmt.Errorf("提取细类记录失败: %w", err)
+		return nil, nil, fmt.Errorf("提取细类记录失败: %w", err)
 	}
 	// fmt.Println(rows)
 	// 第二步：从前4列（A-D）提取骨架结构（大类、中类、小类）。
-	skeletonRecords, err := p.extractSkeletonRecords(ctx, rows)
+	skeletonRecords, err := p.extractSkeletonRecords(ctx, rows, warnings)
 	if err != nil {
-		return nil, fmt.Errorf("提取骨架记录失败: %w", err)
+		return nil, nil, fmt.Errorf("提取骨架记录失败: %w", err)
 	}
 
 	// 合并所有记录
@@ -97,26 +135,26 @@ func (p *ExcelParserImpl) ParseFile(ctx context.Context, filePath string) ([]*mo
 	allRecords = append(allRecords, skeletonRecords...)
 	allRecords = append(allRecords, detailRecords...)
 
-	log.Printf("提取到 %d 条骨架记录，%d 条细类记录，合计 %d 条",
-		len(skeletonRecords), len(detailRecords), len(allRecords))
+	log.Printf("提取到 %d 条骨架记录，%d 条细类记录，合计 %d 条，跳过 %d 处内容",
+		len(skeletonRecords), len(detailRecords), len(allRecords), len(warnings.list()))
 
-	return allRecords, nil
+	return allRecords, warnings.list(), nil
 }
 
-// extractDetailRecords 从E/F列（索引4和5）提取细类记录。
-func (p *ExcelParserImpl) extractDetailRecords(ctx context.Context, rows [][]string) ([]*model.ParsedInfo, error) {
+// extractDetailRecords 从细类列（默认E/F列，索引4和5）提取细类记录。
+func (p *ExcelParserImpl) extractDetailRecords(ctx context.Context, rows [][]string, warnings *parseWarnings) ([]*model.ParsedInfo, error) {
 	var detailRecords []*model.ParsedInfo
+	codeCol, nameCol := p.schema.Columns.DetailCode, p.schema.Columns.DetailName
 
-	for _, row := range rows {
-		if len(row) <= 5 {
+	for rowIndex, row := range rows {
+		codeData, nameData, ok := p.schema.detailCells(row)
+		if !ok {
 			continue
 		}
 
-		codeData := strings.TrimSpace(row[4]) // E列
-		nameData := strings.TrimSpace(row[5]) // F列
-
 		// 跳过无效行
-		if codeData == "" || nameData == "" || codeData == "续表" || nameData == "续表" {
+		marker := p.schema.ContinuationMarker
+		if codeData == "" || nameData == "" || codeData == marker || nameData == marker {
 			continue
 		}
 
@@ -130,9 +168,14 @@ func (p *ExcelParserImpl) extractDetailRecords(ctx context.Context, rows [][]str
 
 		for _, code := range codes {
 			code = strings.TrimSpace(code)
-			if code != "" && strings.Count(code, "-") == 3 {
-				cleanCodes = append(cleanCodes, code)
+			if code == "" {
+				continue
 			}
+			if !p.schema.isDetailCode(code) {
+				warnings.add(rowIndex, codeCol, fmt.Sprintf("细类编码格式无效: %s", quoteContent(code)))
+				continue
+			}
+			cleanCodes = append(cleanCodes, code)
 		}
 
 		for _, name := range names {
@@ -147,6 +190,10 @@ func (p *ExcelParserImpl) extractDetailRecords(ctx context.Context, rows [][]str
 		if len(cleanNames) < minLen {
 			minLen = len(cleanNames)
 		}
+		if len(cleanCodes) != len(cleanNames) {
+			warnings.addRange(rowIndex, codeCol, nameCol, fmt.Sprintf("细类编码与名称数量不一致（编码%d个，名称%d个），丢弃%d条未配对内容",
+				len(cleanCodes), len(cleanNames), len(cleanCodes)+len(cleanNames)-2*minLen))
+		}
 
 		for i := 0; i < minLen; i++ {
 			code := cleanCodes[i]
@@ -170,28 +217,31 @@ func (p *ExcelParserImpl) extractDetailRecords(ctx context.Context, rows [][]str
 	return detailRecords, nil
 }
 
-// extractSkeletonRecords 从前4列（A-D）提取骨架结构（大类、中类、小类）。
-func (p *ExcelParserImpl) extractSkeletonRecords(ctx context.Context, rows [][]string) ([]*model.ParsedInfo, error) {
+// extractSkeletonRecords 从骨架列（默认前4列A-D）提取骨架结构（大类、中类、小类）。
+func (p *ExcelParserImpl) extractSkeletonRecords(ctx context.Context, rows [][]string, warnings *parseWarnings) ([]*model.ParsedInfo, error) {
 	var skeletonRecords []*model.ParsedInfo
+	skeletonColumns := p.schema.Columns.SkeletonColumns
 
 	for i, row := range rows {
 		if p.isJunkRow(row) {
+			p.warnJunkRowWithCode(row, i, warnings)
 			continue
 		}
 
-		// 只处理前4列的内容提取骨架结构
-		firstFourCols := make([]string, 0, 4)
-		for j := 0; j < len(row) && j < 4; j++ {
-			firstFourCols = append(firstFourCols, row[j])
+		// 只处理骨架列的内容提取骨架结构
+		skeletonCols := make([]string, 0, skeletonColumns)
+		for j := 0; j < len(row) && j < skeletonColumns; j++ {
+			skeletonCols = append(skeletonCols, row[j])
 		}
 
-		fullText := strings.Join(firstFourCols, " ")
-		records, err := p.extractRecords(fullText)
+		fullText := strings.Join(skeletonCols, " ")
+		records, err := p.extractRecords(fullText, i, warnings)
 		if err != nil {
 			if p.config.StrictMode {
 				return nil, model.NewParseError(i+1, 0, fullText, "", fmt.Sprintf("处理Excel第 %d 行时提取记录失败: %v", i+1, err))
 			}
 			log.Printf("警告：处理Excel第 %d 行时提取记录失败: %v", i+1, err)
+			warnings.addRange(i, 0, len(skeletonCols)-1, fmt.Sprintf("提取记录失败: %v", err))
 			continue
 		}
 		skeletonRecords = append(skeletonRecords, records...)
@@ -208,10 +258,13 @@ func (p *ExcelParserImpl) extractSkeletonRecords(ctx context.Context, rows [][]s
 }
 
 // extractRecords 从给定的文本字符串中提取一个或多个记录。
-// 适用于一行中包含多个职业分类的情况。
-func (p *ExcelParserImpl) extractRecords(text string) ([]*model.ParsedInfo, error) {
+// 适用于一行中包含多个职业分类的情况。rowIndex 为文本所在行（从0开始），用于记录警告。
+func (p *ExcelParserImpl) extractRecords(text string, rowIndex int, warnings *parseWarnings) ([]*model.ParsedInfo, error) {
 	locs := p.reCodeFinder.FindAllStringIndex(text, -1)
 	if locs == nil {
+		if trimmed := strings.TrimSpace(text); trimmed != "" {
+			warnings.addRange(rowIndex, 0, p.schema.Columns.SkeletonColumns-1, fmt.Sprintf("未找到职业编码: %s", quoteContent(trimmed)))
+		}
 		return nil, nil
 	}
 
@@ -227,6 +280,7 @@ func (p *ExcelParserImpl) extractRecords(text string) ([]*model.ParsedInfo, erro
 		info, err := p.parseCellContent(contentPart)
 		if err != nil {
 			log.Printf("警告：在提取记录时跳过一个片段，原因: %v", err)
+			warnings.addRange(rowIndex, 0, p.schema.Columns.SkeletonColumns-1, err.Error())
 			continue
 		}
 		if info != nil {
@@ -321,24 +375,22 @@ func (p *ExcelParserImpl) removeChineseSpaces(name string) string {
 }
 
 // isJunkRow 检查给定的Excel行是否为应被忽略的“垃圾行”。
-// 这包括空行、表头行（如“大类”、“中类”）、续表标记或文档标题行。
+// 这包括空行、表头行（如“大类”、“中类”）、续表标记或文档标题行，具体规则由词典格式定义。
 func (p *ExcelParserImpl) isJunkRow(row []string) bool {
-	if len(row) == 0 {
-		return true
-	}
+	return p.schema.isJunkRow(row)
+}
 
-	firstCell := strings.TrimSpace(row[0])
-	if firstCell == "大类" || firstCell == "中类" {
-		return true
-	}
+// reJunkRowCode 匹配垃圾行中可能被误丢弃的中类及以下编码，忽略标题中的年份等数字
+var reJunkRowCode = regexp.MustCompile(`\d-\d{2}`)
 
-	for _, cell := range row {
-		cleanCell := p.reWhitespace.ReplaceAllString(cell, "")
-		if cleanCell == "续表" || strings.Contains(cleanCell, "职业分类大典") || cleanCell == "分类体系表" {
-			return true
+// warnJunkRowWithCode 被识别为垃圾行但前4列仍包含编码时记录警告，便于排查误判
+func (p *ExcelParserImpl) warnJunkRowWithCode(row []string, rowIndex int, warnings *parseWarnings) {
+	for j := 0; j < len(row) && j < p.schema.Columns.SkeletonColumns; j++ {
+		if reJunkRowCode.MatchString(row[j]) {
+			warnings.add(rowIndex, j, fmt.Sprintf("所在行被识别为表头或续表已跳过，但单元格包含编码: %s", quoteContent(strings.TrimSpace(row[j]))))
+			return
 		}
 	}
-	return false
 }
 
 // Validate 验证解析器配置
@@ -346,7 +398,7 @@ func (p *ExcelParserImpl) Validate() error {
 	if p.config.SheetName == "" {
 		return model.NewValidationError("工作表名称不能为空", "sheet_name", "", "required")
 	}
-	return nil
+	return validateSchema(p.config)
 }
 
 // GetSupportedFormats 获取支持的格式
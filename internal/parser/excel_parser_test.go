@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/freedkr/moonshot/internal/model"
+	"github.com/xuri/excelize/v2"
 )
 
 func TestNewExcelParser(t *testing.T) {
@@ -236,7 +237,7 @@ func TestExcelParserImpl_extractRecords(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			results, err := parser.extractRecords(tt.input)
+			results, err := parser.extractRecords(tt.input, 0, nil)
 			if err != nil {
 				t.Errorf("Unexpected error: %v", err)
 			}
@@ -322,7 +323,7 @@ func TestExcelParserImpl_extractDetailRecords(t *testing.T) {
 		{"", "", "", "", "2-01-01-01\n2-01-01-02\n2-01-01-03", "名称1\n名称2"}, // 代码比名称多的情况
 	}
 
-	results, err := parser.extractDetailRecords(ctx, rows)
+	results, err := parser.extractDetailRecords(ctx, rows, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -365,7 +366,7 @@ func TestExcelParserImpl_extractSkeletonRecords(t *testing.T) {
 		{"2 (GBM 20000) 专业技术人员", "", "", ""},        // 另一个大类
 	}
 
-	results, err := parser.extractSkeletonRecords(ctx, rows)
+	results, err := parser.extractSkeletonRecords(ctx, rows, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -413,8 +414,8 @@ func TestExcelParserImpl_StrictMode(t *testing.T) {
 	}
 
 	// 严格模式应该在遇到错误时停止（但当前实现只是记录警告）
-	strictResults, strictErr := strictParser.extractSkeletonRecords(ctx, badRows)
-	lenientResults, lenientErr := lenientParser.extractSkeletonRecords(ctx, badRows)
+	strictResults, strictErr := strictParser.extractSkeletonRecords(ctx, badRows, nil)
+	lenientResults, lenientErr := lenientParser.extractSkeletonRecords(ctx, badRows, nil)
 
 	// 两种模式都不应该返回错误（因为当前实现是宽容的）
 	if strictErr != nil {
@@ -443,7 +444,7 @@ func TestExcelParserImpl_ContextCancellation(t *testing.T) {
 		{"", "", "", "", "1-01-01-01", "测试"},
 	}
 
-	_, err := parser.extractDetailRecords(ctx, rows)
+	_, err := parser.extractDetailRecords(ctx, rows, nil)
 	if err == nil {
 		t.Error("Expected context cancellation error")
 	}
@@ -452,7 +453,7 @@ func TestExcelParserImpl_ContextCancellation(t *testing.T) {
 	}
 
 	// 测试extractSkeletonRecords
-	_, err = parser.extractSkeletonRecords(ctx, rows)
+	_, err = parser.extractSkeletonRecords(ctx, rows, nil)
 	if err == nil {
 		t.Error("Expected context cancellation error")
 	}
@@ -460,3 +461,160 @@ func TestExcelParserImpl_ContextCancellation(t *testing.T) {
 		t.Errorf("Expected context.Canceled, got %v", err)
 	}
 }
+
+func TestSelectSheet(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	// 默认工作表 Sheet1 无表头；Data 工作表带职业分类表头
+	if _, err := f.NewSheet("Data"); err != nil {
+		t.Fatalf("Failed to create sheet: %v", err)
+	}
+	f.SetSheetRow("Data", "A1", &[]interface{}{"中华人民共和国职业分类大典"})
+	f.SetSheetRow("Data", "A2", &[]interface{}{"大 类", "中类", "小类", "细类"})
+	if _, err := f.NewSheet("Extra"); err != nil {
+		t.Fatalf("Failed to create sheet: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		config   *ParserConfig
+		expected string
+	}{
+		{"配置的工作表存在", &ParserConfig{SheetName: "Sheet1"}, "Sheet1"},
+		{"使用候选工作表", &ParserConfig{SheetName: "Table1", SheetCandidates: []string{"Missing", "Extra"}}, "Extra"},
+		{"按表头自动识别", &ParserConfig{SheetName: "Table1"}, "Data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheet, err := selectSheet(&xlsxWorkbook{f: f}, "test.xlsx", tt.config)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if sheet != tt.expected {
+				t.Errorf("Expected sheet %q, got %q", tt.expected, sheet)
+			}
+		})
+	}
+
+	// 无匹配时错误信息应列出可用工作表
+	noMatch := excelize.NewFile()
+	defer noMatch.Close()
+	_, err := selectSheet(&xlsxWorkbook{f: noMatch}, "test.xlsx", &ParserConfig{SheetName: "Table1"})
+	if err == nil {
+		t.Fatal("Expected error when no sheet matches")
+	}
+	if !strings.Contains(err.Error(), "Sheet1") {
+		t.Errorf("Expected error to list available sheets, got %v", err)
+	}
+}
+
+func TestExcelParserImpl_ParseWarnings(t *testing.T) {
+	parser := NewExcelParser(nil)
+	ctx := context.Background()
+
+	rows := [][]string{
+		{"大类", "中类", "小类", "细类"},                            // 表头，不记录警告
+		{"1 (GBM 10000) 国家机关负责人", "", "", ""},               // 正常骨架
+		{"本小类包括下列职业", "", "", ""},                           // 无编码
+		{"", "", "", "", "1-01-01-01\n1-01-01-02", "仅一个名称"}, // 编码名称数量不一致
+		{"", "", "", "", "1-01-01\n1-01-01-03", "名称A\n名称B"}, // 编码格式无效
+		{"续表", "1-02 (GBM 10200) 被误判的中类", "", ""},           // 垃圾行中包含编码
+	}
+
+	warnings := &parseWarnings{}
+	if _, err := parser.extractDetailRecords(ctx, rows, warnings); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := parser.extractSkeletonRecords(ctx, rows, warnings); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"E4:F4": "数量不一致",
+		"E5":    "格式无效",
+		"E5:F5": "数量不一致",
+		"A3:D3": "未找到职业编码",
+		"B6":    "包含编码",
+	}
+	got := warnings.list()
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d warnings, got %d: %+v", len(expected), len(got), got)
+	}
+	for _, w := range got {
+		reason, ok := expected[w.Cell]
+		if !ok {
+			t.Errorf("Unexpected warning at %s: %s", w.Cell, w.Reason)
+			continue
+		}
+		if !strings.Contains(w.Reason, reason) {
+			t.Errorf("Warning at %s: expected reason containing %q, got %q", w.Cell, reason, w.Reason)
+		}
+		if w.Row <= 0 {
+			t.Errorf("Warning at %s: expected 1-based row, got %d", w.Cell, w.Row)
+		}
+	}
+}
+
+func TestExcelParserImpl_ParseLegacyXLS(t *testing.T) {
+	parser := NewExcelParser(nil)
+
+	records, warnings, err := parser.ParseFileWithWarnings(context.Background(), "testdata/legacy.xls")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %+v", warnings)
+	}
+
+	got := make(map[string]string)
+	for _, record := range records {
+		got[record.Code] = record.Name
+	}
+	expected := map[string]string{
+		"1":          "国家机关负责人",
+		"1-01":       "中国共产党机关负责人",
+		"1-01-01":    "委员会负责人",
+		"1-01-01-01": "细类名称1",
+		"1-01-01-02": "细类名称2",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected records %v, got %v", expected, got)
+	}
+}
+
+func TestExcelParserImpl_WithMaxRows(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetName("Sheet1", "Table1")
+	f.SetSheetRow("Table1", "A1", &[]interface{}{"大类", "中类", "小类", "细类"})
+	f.SetSheetRow("Table1", "A2", &[]interface{}{"1 (GBM 10000) 国家机关负责人"})
+	f.SetSheetRow("Table1", "A3", &[]interface{}{"", "1-01 (GBM 10100) 中国共产党机关负责人"})
+	f.SetSheetRow("Table1", "A4", &[]interface{}{"", "", "1-01-01 (GBM 10101) 委员会负责人"})
+	path := t.TempDir() + "/max_rows.xlsx"
+	if err := f.SaveAs(path); err != nil {
+		t.Fatalf("Failed to save workbook: %v", err)
+	}
+
+	parser := NewExcelParser(nil)
+	limited := parser.WithMaxRows(2)
+	if parser.MaxRows() != 0 || limited.MaxRows() != 2 {
+		t.Fatalf("WithMaxRows should not modify the original parser: %d, %d", parser.MaxRows(), limited.MaxRows())
+	}
+
+	all, err := parser.ParseFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(all) != 3 {
+		t.Errorf("Expected 3 records without limit, got %d", len(all))
+	}
+
+	records, err := limited.ParseFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Code != "1" {
+		t.Errorf("Expected only the record in the first 2 rows, got %+v", records)
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/freedkr/moonshot/internal/model"
-	"github.com/xuri/excelize/v2"
 )
 
 // HybridParser 混合智能解析器
@@ -21,7 +20,8 @@ type HybridParser struct {
 	reWhitespace *regexp.Regexp
 	reUnified    *regexp.Regexp
 	reCodeFinder *regexp.Regexp
-	reMajorClass *regexp.Regexp  // 专门用于识别大类的正则
+	reMajorClass *regexp.Regexp  // 专门用于识别大类的正则，词典格式未定义大类标题时为 nil
+	schema       *compiledSchema // 词典格式，提供编码正则、层级规则和列布局
 }
 
 // NewHybridParser 创建新的混合解析器
@@ -35,15 +35,31 @@ func NewHybridParser(config *ParserConfig) *HybridParser {
 		}
 	}
 
+	schema := newParserSchema(config)
 	return &HybridParser{
 		config:       config,
 		reWhitespace: regexp.MustCompile(`\s+`),
-		reUnified:    regexp.MustCompile(`^(.*?)([\d-]+)\s*(?:\(\s*GBM\s*(\d+)\s*\))?\s*(.*)$`),
-		reCodeFinder: regexp.MustCompile(`[\d-]+(?:\s*\(\s*GBM\s*\d+\s*\))?`),
-		reMajorClass: regexp.MustCompile(`第[一二三四五六七八]大类\s+([1-8])\s*(?:\(\s*GBM\s*(\d+)\s*\))?\s*(.*)$`),
+		reUnified:    schema.reUnified,
+		reCodeFinder: schema.reCodeFinder,
+		reMajorClass: schema.reMajorClass,
+		schema:       schema,
 	}
 }
 
+// MaxRows 返回最大处理行数（0表示不限制）
+func (p *HybridParser) MaxRows() int {
+	return p.config.MaxRows
+}
+
+// WithMaxRows 返回只修改最大处理行数的解析器副本，用于单个任务覆盖全局配置，原解析器不受影响
+func (p *HybridParser) WithMaxRows(maxRows int) *HybridParser {
+	config := *p.config
+	config.MaxRows = maxRows
+	clone := *p
+	clone.config = &config
+	return &clone
+}
+
 // Parse 解析输入数据（混合智能解析）
 func (p *HybridParser) Parse(ctx context.Context, input io.Reader) ([]*model.ParsedInfo, error) {
 	return nil, model.NewSystemError("hybrid_parser", "parse", "混合解析器需要文件路径，不能直接从io.Reader读取", fmt.Errorf("unsupported operation"))
@@ -53,15 +69,26 @@ func (p *HybridParser) Parse(ctx context.Context, input io.Reader) ([]*model.Par
 func (p *HybridParser) ParseFile(ctx context.Context, filePath string) (*model.HybridParseResult, error) {
 	startTime := time.Now()
 	
-	f, err := excelize.OpenFile(filePath)
+	f, err := openWorkbook(filePath)
 	if err != nil {
 		return nil, model.NewFileError(model.ErrCodeFileReadError, filePath, "open", "打开Excel文件失败", err)
 	}
 	defer f.Close()
 
-	rows, err := f.GetRows(p.config.SheetName)
+	sheetName, err := selectSheet(f, filePath, p.config)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := f.Rows(sheetName)
 	if err != nil {
-		return nil, model.NewFileError(model.ErrCodeFileReadError, p.config.SheetName, "read_sheet", "读取工作表数据失败", err)
+		return nil, model.NewFileError(model.ErrCodeFileReadError, sheetName, "read_sheet", "读取工作表数据失败", err)
+	}
+
+	// 只解析前 MaxRows 行（含表头），与 ExcelParserImpl 一致
+	if p.config.MaxRows > 0 && len(rows) > p.config.MaxRows {
+		log.Printf("工作表 %s 共 %d 行，按 max_rows 只解析前 %d 行", sheetName, len(rows), p.config.MaxRows)
+		rows = rows[:p.config.MaxRows]
 	}
 
 	// 第一步：本地预处理 — 以"小类"为单位打包AI任务
@@ -75,6 +102,7 @@ func (p *HybridParser) ParseFile(ctx context.Context, filePath string) (*model.H
 		TotalRows:      len(rows),
 		SkeletonCount:  len(result.SkeletonRecords),
 		AITaskCount:    len(result.AITasks),
+		WarningCount:   len(result.Warnings),
 		ProcessingTime: time.Since(startTime).Milliseconds(),
 	}
 
@@ -89,6 +117,7 @@ func (p *HybridParser) ParseFile(ctx context.Context, filePath string) (*model.H
 func (p *HybridParser) hybridParse(ctx context.Context, rows [][]string) (*model.HybridParseResult, error) {
 	var skeletonRecords []*model.SkeletonRecord
 	var aiTasks []*model.AITask
+	warnings := &parseWarnings{}
 	
 	// 第一遍：收集所有骨架记录
 	for rowIndex, row := range rows {
@@ -103,15 +132,16 @@ func (p *HybridParser) hybridParse(ctx context.Context, rows [][]string) (*model
 		}
 
 		// 识别骨架节点（大类、中类、小类）
-		skeletonRecords_row := p.identifySkeletonNode(row, rowIndex)
+		skeletonRecords_row := p.identifySkeletonNode(row, rowIndex, warnings)
 		if len(skeletonRecords_row) > 0 {
 			skeletonRecords = append(skeletonRecords, skeletonRecords_row...)
 		}
 	}
 	
-	// 第二遍：为每个小类收集对应的EF列数据
+	// 第二遍：为每个小类（骨架的最后一级）收集对应的细类列数据
+	smallLevel := p.schema.Levels[len(p.schema.Levels)-2]
 	for _, skeletonRecord := range skeletonRecords {
-		if skeletonRecord.Level == model.LevelSmall {
+		if skeletonRecord.Level == smallLevel {
 			// 创建AI任务
 			task := &model.AITask{
 				ParentCode: skeletonRecord.Code,
@@ -133,12 +163,13 @@ func (p *HybridParser) hybridParse(ctx context.Context, rows [][]string) (*model
 	return &model.HybridParseResult{
 		SkeletonRecords: skeletonRecords,
 		AITasks:         aiTasks,
+		Warnings:        warnings.list(),
 	}, nil
 }
 
 // identifySkeletonNode 识别骨架节点（大类、中类、小类）
 // 新策略：逐列检查每个单元格，精确定位和提取完整信息
-func (p *HybridParser) identifySkeletonNode(row []string, rowIndex int) []*model.SkeletonRecord {
+func (p *HybridParser) identifySkeletonNode(row []string, rowIndex int, warnings *parseWarnings) []*model.SkeletonRecord {
 	var records []*model.SkeletonRecord
 	
 	// 注释掉这个检查，因为大类行可能只有1列
@@ -146,8 +177,8 @@ func (p *HybridParser) identifySkeletonNode(row []string, rowIndex int) []*model
 	//	return records
 	// }
 
-	// 检查每个单元格（A-D列）是否包含骨架信息
-	for colIndex := 0; colIndex < 4 && colIndex < len(row); colIndex++ {
+	// 检查每个骨架单元格（默认A-D列）是否包含骨架信息
+	for colIndex := 0; colIndex < p.schema.Columns.SkeletonColumns && colIndex < len(row); colIndex++ {
 		cellContent := strings.TrimSpace(row[colIndex])
 		if cellContent == "" {
 			continue
@@ -155,7 +186,7 @@ func (p *HybridParser) identifySkeletonNode(row []string, rowIndex int) []*model
 		
 
 		// 尝试从单元格提取骨架信息（可能有多个条目）
-		cellRecords := p.extractSkeletonFromCell(cellContent, rowIndex, colIndex)
+		cellRecords := p.extractSkeletonFromCell(cellContent, rowIndex, colIndex, warnings)
 		if len(cellRecords) > 0 {
 			records = append(records, cellRecords...)
 		}
@@ -166,23 +197,26 @@ func (p *HybridParser) identifySkeletonNode(row []string, rowIndex int) []*model
 
 // extractSkeletonFromCell 从单个单元格提取骨架信息
 // 修改为支持单元格内多个条目的拆分，优化大类识别
-func (p *HybridParser) extractSkeletonFromCell(cellContent string, rowIndex, colIndex int) []*model.SkeletonRecord {
+func (p *HybridParser) extractSkeletonFromCell(cellContent string, rowIndex, colIndex int, warnings *parseWarnings) []*model.SkeletonRecord {
 	var records []*model.SkeletonRecord
 	
-	// 第一步：尝试专门的大类识别（八大类：1-8）
+	// 第一步：尝试专门的大类识别（默认格式为八大类：1-8）
 	majorRecords := p.extractMajorCategories(cellContent)
 	records = append(records, majorRecords...)
 	
 	// 第二步：使用通用方法识别中类和小类
-	generalRecords := p.extractGeneralSkeletonRecords(cellContent)
+	generalRecords := p.extractGeneralSkeletonRecords(cellContent, rowIndex, colIndex, warnings)
 	records = append(records, generalRecords...)
 
 	return records
 }
 
-// extractMajorCategories 专门提取大类（八大类：1-8）
+// extractMajorCategories 专门提取大类（默认格式为八大类：1-8）
 func (p *HybridParser) extractMajorCategories(cellContent string) []*model.SkeletonRecord {
 	var records []*model.SkeletonRecord
+	if p.reMajorClass == nil {
+		return records
+	}
 	
 	// 使用专门的大类正则匹配 "第X大类"格式
 	matches := p.reMajorClass.FindAllStringSubmatch(cellContent, -1)
@@ -192,12 +226,12 @@ func (p *HybridParser) extractMajorCategories(cellContent string) []*model.Skele
 			continue
 		}
 		
-		code := strings.TrimSpace(match[1])      // 数字编码(1-8)
+		code := strings.TrimSpace(match[1])      // 大类编码
 		gbmCode := strings.TrimSpace(match[2])   // GBM编码
 		name := strings.TrimSpace(match[3])      // 名称部分
 		
-		// 确保这确实是大类（单个数字1-8）
-		if len(code) != 1 || code < "1" || code > "8" {
+		// 确保这确实是大类（默认格式为单个数字1-8）
+		if !p.schema.isMajorCode(code) {
 			continue
 		}
 		
@@ -211,7 +245,7 @@ func (p *HybridParser) extractMajorCategories(cellContent string) []*model.Skele
 			Code:  code,
 			GBM:   p.parseGBM(gbmCode),
 			Name:  name,
-			Level: model.LevelMajor,
+			Level: p.schema.Levels[0],
 		}
 		records = append(records, record)
 	}
@@ -220,7 +254,7 @@ func (p *HybridParser) extractMajorCategories(cellContent string) []*model.Skele
 }
 
 // extractGeneralSkeletonRecords 提取中类和小类
-func (p *HybridParser) extractGeneralSkeletonRecords(cellContent string) []*model.SkeletonRecord {
+func (p *HybridParser) extractGeneralSkeletonRecords(cellContent string, rowIndex, colIndex int, warnings *parseWarnings) []*model.SkeletonRecord {
 	var records []*model.SkeletonRecord
 	
 	// 使用reCodeFinder找到所有编码位置
@@ -242,18 +276,26 @@ func (p *HybridParser) extractGeneralSkeletonRecords(cellContent string) []*mode
 
 		// 解析这个部分
 		info, err := p.parseCellContent(contentPart)
-		if err != nil || info == nil {
+		if err != nil {
+			warnings.add(rowIndex, colIndex, err.Error())
+			continue
+		}
+		if info == nil {
 			continue
 		}
 
 		// 根据编码确定层级
 		level := p.determineLevel(info.Code)
 		if level == "" {
+			// 细类编码由AI任务处理，其余无法识别的编码记录警告
+			if !p.schema.isDetailCode(info.Code) {
+				warnings.add(rowIndex, colIndex, fmt.Sprintf("无法识别编码层级: %s", quoteContent(info.Code)))
+			}
 			continue // 跳过无效的骨架节点
 		}
 
-		// 只处理中类和小类（大类由专门方法处理）
-		if level != model.LevelMiddle && level != model.LevelSmall {
+		// 只处理中类和小类（大类由专门方法处理，词典格式未定义大类标题时按编码识别）
+		if level == p.schema.Levels[0] && p.reMajorClass != nil {
 			continue
 		}
 
@@ -352,15 +394,13 @@ func (p *HybridParser) collectDetailDataByPrefix(rows [][]string, task *model.AI
 	var allDetailNames []string
 	
 	for _, row := range rows {
-		if len(row) <= 5 {
+		eCol, fCol, ok := p.schema.detailCells(row) // 默认为E列、F列
+		if !ok {
 			continue
 		}
 
-		eCol := strings.TrimSpace(row[4]) // E列
-		fCol := strings.TrimSpace(row[5]) // F列
-
 		// 跳过明显无效的行
-		if eCol == "续表" || fCol == "续表" {
+		if eCol == p.schema.ContinuationMarker || fCol == p.schema.ContinuationMarker {
 			continue
 		}
 
@@ -428,13 +468,14 @@ func (p *HybridParser) collectDetailDataByPrefix(rows [][]string, task *model.AI
 
 // isExactDetailCode 检查编码是否精确匹配小类前缀格式
 func (p *HybridParser) isExactDetailCode(code, smallClassCode string) bool {
-	// 编码必须以 smallClassCode- 开头
-	if !strings.HasPrefix(code, smallClassCode+"-") {
+	// 编码必须以 smallClassCode 加分隔符开头
+	prefix := smallClassCode + p.schema.Separator
+	if !strings.HasPrefix(code, prefix) {
 		return false
 	}
 	
 	// 检查后缀是否为数字格式
-	suffix := strings.TrimPrefix(code, smallClassCode+"-")
+	suffix := strings.TrimPrefix(code, prefix)
 	if suffix == "" {
 		return false
 	}
@@ -451,18 +492,16 @@ func (p *HybridParser) isExactDetailCode(code, smallClassCode string) bool {
 
 // collectDetailData 收集细类数据（E列和F列）- 修复数量匹配问题
 func (p *HybridParser) collectDetailData(row []string, task *model.AITask) {
-	if len(row) <= 5 {
+	codeData, nameData, ok := p.schema.detailCells(row) // 默认为E列、F列
+	if !ok {
 		return
 	}
 
-	codeData := strings.TrimSpace(row[4]) // E列
-	nameData := strings.TrimSpace(row[5]) // F列
-
 	// 跳过无效数据
 	if codeData == "" && nameData == "" {
 		return
 	}
-	if codeData == "续表" || nameData == "续表" {
+	if codeData == p.schema.ContinuationMarker || nameData == p.schema.ContinuationMarker {
 		return
 	}
 
@@ -507,22 +546,9 @@ func (p *HybridParser) hasTaskContent(task *model.AITask) bool {
 }
 
 // determineLevel 根据编码确定层级
+// 默认格式下 "1" 为大类、"1-01" 为中类、"1-01-00" 为小类，细类由AI处理，这里不识别
 func (p *HybridParser) determineLevel(code string) string {
-	if code == "" {
-		return ""
-	}
-	
-	dashCount := strings.Count(code, "-")
-	switch dashCount {
-	case 0:
-		return model.LevelMajor  // 大类：如 "1"
-	case 1:
-		return model.LevelMiddle // 中类：如 "1-01"
-	case 2:
-		return model.LevelSmall  // 小类：如 "1-01-00"
-	default:
-		return "" // 细类由AI处理，这里不识别
-	}
+	return p.schema.skeletonLevel(code)
 }
 
 // parseCellContent 解析单个记录的字符串
@@ -564,22 +590,7 @@ func (p *HybridParser) parseCellContent(raw string) (*model.ParsedInfo, error) {
 
 // isJunkRow 检查是否为垃圾行
 func (p *HybridParser) isJunkRow(row []string) bool {
-	if len(row) == 0 {
-		return true
-	}
-
-	firstCell := strings.TrimSpace(row[0])
-	if firstCell == "大类" || firstCell == "中类" {
-		return true
-	}
-
-	for _, cell := range row {
-		cleanCell := p.reWhitespace.ReplaceAllString(cell, "")
-		if cleanCell == "续表" || strings.Contains(cleanCell, "职业分类大典") || cleanCell == "分类体系表" {
-			return true
-		}
-	}
-	return false
+	return p.schema.isJunkRow(row)
 }
 
 // 实现Parser接口
@@ -587,7 +598,7 @@ func (p *HybridParser) Validate() error {
 	if p.config.SheetName == "" {
 		return model.NewValidationError("工作表名称不能为空", "sheet_name", "", "required")
 	}
-	return nil
+	return validateSchema(p.config)
 }
 
 func (p *HybridParser) GetName() string {
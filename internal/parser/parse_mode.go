@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/freedkr/moonshot/internal/model"
+)
+
+// ParseMode rule-worker 解析输入文件的方式
+type ParseMode string
+
+const (
+	// ParseModeClassic 使用 ExcelParserImpl 逐单元格解析全部层级（默认）
+	ParseModeClassic ParseMode = "classic"
+	// ParseModeHybrid 使用 HybridParser 解析大、中、小类骨架，细类以小类为单位打包为AI任务
+	ParseModeHybrid ParseMode = "hybrid"
+)
+
+// ResolveParseMode 确定解析方式：环境变量 PARSER_MODE 优先于配置文件的 parser.mode，
+// 均未设置时使用 classic，值无效时返回错误，由调用方在启动时失败
+func ResolveParseMode(configured string) (ParseMode, error) {
+	value := strings.TrimSpace(os.Getenv("PARSER_MODE"))
+	if value == "" {
+		value = strings.TrimSpace(configured)
+	}
+	switch ParseMode(strings.ToLower(value)) {
+	case "", ParseModeClassic:
+		return ParseModeClassic, nil
+	case ParseModeHybrid:
+		return ParseModeHybrid, nil
+	default:
+		return "", fmt.Errorf("无效的解析方式 %q，可选值: %s、%s", value, ParseModeClassic, ParseModeHybrid)
+	}
+}
+
+// HybridParsedInfos 将混合解析结果展开为构建层级使用的记录：骨架记录在前，
+// 之后是各AI任务中按顺序配对的细类编码和名称，层级由构建器根据编码确定。
+// 编码与名称数量不一致时，每条未配对的编码或名称返回一条警告；AI任务不记录原始行号，警告的行号为0
+func HybridParsedInfos(result *model.HybridParseResult) ([]*model.ParsedInfo, []model.ParseWarning) {
+	var (
+		records  []*model.ParsedInfo
+		warnings []model.ParseWarning
+	)
+	for _, skeleton := range result.SkeletonRecords {
+		info := &model.ParsedInfo{Code: skeleton.Code, Name: skeleton.Name}
+		if skeleton.GBM > 0 {
+			info.GbmCode = strconv.Itoa(skeleton.GBM)
+		}
+		records = append(records, info)
+	}
+	for _, task := range result.AITasks {
+		for i, code := range task.DetailCodesRaw {
+			if i >= len(task.DetailNamesRaw) {
+				warnings = append(warnings, model.ParseWarning{
+					Reason: fmt.Sprintf("小类 %s 的细类编码 %s 没有对应的名称，已丢弃", task.ParentCode, quoteContent(code)),
+				})
+				continue
+			}
+			records = append(records, &model.ParsedInfo{Code: code, Name: task.DetailNamesRaw[i]})
+		}
+		for _, name := range task.DetailNamesRaw[min(len(task.DetailCodesRaw), len(task.DetailNamesRaw)):] {
+			warnings = append(warnings, model.ParseWarning{
+				Reason: fmt.Sprintf("小类 %s 的细类名称 %s 没有对应的编码，已丢弃", task.ParentCode, quoteContent(name)),
+			})
+		}
+	}
+	return records, warnings
+}
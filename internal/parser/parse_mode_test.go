@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestResolveParseMode(t *testing.T) {
+	for _, tc := range []struct {
+		env, configured string
+		expected        ParseMode
+	}{
+		{"", "", ParseModeClassic},
+		{"classic", "", ParseModeClassic},
+		{"Hybrid", "", ParseModeHybrid},
+		{"", "hybrid", ParseModeHybrid},
+		{"classic", "hybrid", ParseModeClassic},
+	} {
+		t.Setenv("PARSER_MODE", tc.env)
+		got, err := ResolveParseMode(tc.configured)
+		if err != nil || got != tc.expected {
+			t.Errorf("PARSER_MODE=%q parser.mode=%q: expected %s, got %s, %v", tc.env, tc.configured, tc.expected, got, err)
+		}
+	}
+
+	for _, tc := range []struct{ env, configured string }{{"v3", ""}, {"", "hybird"}} {
+		t.Setenv("PARSER_MODE", tc.env)
+		if _, err := ResolveParseMode(tc.configured); err == nil {
+			t.Errorf("PARSER_MODE=%q parser.mode=%q 应返回错误", tc.env, tc.configured)
+		}
+	}
+}
+
+func TestHybridParsedInfos(t *testing.T) {
+	result := &model.HybridParseResult{
+		SkeletonRecords: []*model.SkeletonRecord{
+			{Code: "1-01", GBM: 10100, Name: "中国共产党机关负责人", Level: model.LevelMiddle},
+			{Code: "1-01-01", Name: "委员会负责人", Level: model.LevelSmall},
+		},
+		AITasks: []*model.AITask{{
+			ParentCode:     "1-01-01",
+			ParentName:     "委员会负责人",
+			DetailCodesRaw: []string{"1-01-01-01", "1-01-01-02"},
+			DetailNamesRaw: []string{"委员会主任"},
+		}},
+	}
+
+	records, warnings := HybridParsedInfos(result)
+	if len(records) != 3 {
+		t.Fatalf("Expected 2 skeleton records and 1 paired detail, got %d", len(records))
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Reason, "1-01-01-02") {
+		t.Errorf("Expected a warning for the unpaired code, got %+v", warnings)
+	}
+	if records[0].GbmCode != "10100" || records[1].GbmCode != "" {
+		t.Errorf("Unexpected GBM codes: %q, %q", records[0].GbmCode, records[1].GbmCode)
+	}
+	if records[2].Code != "1-01-01-01" || records[2].Name != "委员会主任" {
+		t.Errorf("Unexpected detail record: %+v", records[2])
+	}
+}
+
+func TestHybridParser_WithMaxRows(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetName("Sheet1", "Table1")
+	f.SetSheetRow("Table1", "A1", &[]interface{}{"大类", "中类", "小类", "细类"})
+	f.SetSheetRow("Table1", "A2", &[]interface{}{"1 (GBM 10000) 国家机关负责人"})
+	f.SetSheetRow("Table1", "A3", &[]interface{}{"", "1-01 (GBM 10100) 中国共产党机关负责人"})
+	f.SetSheetRow("Table1", "A4", &[]interface{}{"", "", "1-01-01 (GBM 10101) 委员会负责人"})
+	path := t.TempDir() + "/max_rows.xlsx"
+	if err := f.SaveAs(path); err != nil {
+		t.Fatalf("Failed to save workbook: %v", err)
+	}
+
+	parser := NewHybridParser(nil)
+	limited := parser.WithMaxRows(2)
+	if parser.MaxRows() != 0 || limited.MaxRows() != 2 {
+		t.Fatalf("WithMaxRows should not modify the original parser: %d, %d", parser.MaxRows(), limited.MaxRows())
+	}
+
+	all, err := parser.ParseFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result, err := limited.ParseFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Stats.TotalRows != 2 || len(result.SkeletonRecords) >= len(all.SkeletonRecords) {
+		t.Errorf("Expected only the first 2 rows to be parsed, got %d rows and %d skeleton records (unlimited %d)",
+			result.Stats.TotalRows, len(result.SkeletonRecords), len(all.SkeletonRecords))
+	}
+}
+
+func TestHybridParsedInfos_WarnsForEachUnpairedEntry(t *testing.T) {
+	result := &model.HybridParseResult{
+		AITasks: []*model.AITask{
+			{
+				ParentCode:     "2-01-01",
+				DetailCodesRaw: []string{"2-01-01-01", "2-01-01-02", "2-01-01-03"},
+				DetailNamesRaw: []string{"名称一"},
+			},
+			{
+				ParentCode:     "2-01-02",
+				DetailCodesRaw: []string{"2-01-02-01"},
+				DetailNamesRaw: []string{"名称二", "多余名称"},
+			},
+		},
+	}
+
+	records, warnings := HybridParsedInfos(result)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 paired details, got %d", len(records))
+	}
+	expected := []string{"2-01-01-02", "2-01-01-03", "多余名称"}
+	if len(warnings) != len(expected) {
+		t.Fatalf("Expected %d warnings, got %+v", len(expected), warnings)
+	}
+	for i, content := range expected {
+		if !strings.Contains(warnings[i].Reason, content) {
+			t.Errorf("Warning %d should mention %s, got %q", i, content, warnings[i].Reason)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/xuri/excelize/v2"
+)
+
+// maxWarningContentRunes 警告原因中引用原始内容的最大字符数
+const maxWarningContentRunes = 60
+
+// parseWarnings 收集单次解析过程中被跳过的行和单元格，nil 时忽略所有记录
+type parseWarnings struct {
+	items []model.ParseWarning
+}
+
+// add 记录一条警告，rowIndex 和 colIndex 均从0开始
+func (w *parseWarnings) add(rowIndex, colIndex int, reason string) {
+	w.addRange(rowIndex, colIndex, colIndex, reason)
+}
+
+// addRange 记录涉及同一行多列的警告
+func (w *parseWarnings) addRange(rowIndex, fromCol, toCol int, reason string) {
+	if w == nil {
+		return
+	}
+	cell := cellName(fromCol, rowIndex)
+	if toCol != fromCol {
+		cell += ":" + cellName(toCol, rowIndex)
+	}
+	w.items = append(w.items, model.ParseWarning{
+		Row:    rowIndex + 1,
+		Cell:   cell,
+		Reason: reason,
+	})
+}
+
+// list 返回已收集的警告
+func (w *parseWarnings) list() []model.ParseWarning {
+	if w == nil {
+		return nil
+	}
+	return w.items
+}
+
+// cellName 将从0开始的行列号转换为单元格名称
+func cellName(colIndex, rowIndex int) string {
+	name, err := excelize.CoordinatesToCellName(colIndex+1, rowIndex+1)
+	if err != nil {
+		return fmt.Sprintf("R%dC%d", rowIndex+1, colIndex+1)
+	}
+	return name
+}
+
+// quoteContent 截断并引用原始内容，避免警告过长
+func quoteContent(content string) string {
+	if utf8.RuneCountInString(content) > maxWarningContentRunes {
+		runes := []rune(content)
+		content = string(runes[:maxWarningContentRunes]) + "…"
+	}
+	return fmt.Sprintf("%q", content)
+}
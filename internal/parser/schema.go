@@ -0,0 +1,316 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/freedkr/moonshot/internal/model"
+)
+
+// SchemaGBT2022 《中华人民共和国职业分类大典》（GB/T 6565-2015，2022年版）格式，默认使用
+const SchemaGBT2022 = "gbt2022"
+
+// DictionarySchema 职业分类词典的格式定义
+// 骨架（大类、中类、小类）与细类的识别规则都由它提供，解析其他分类标准时注册新的格式即可，不需要修改解析器
+type DictionarySchema struct {
+	// Name 格式名称，通过 ParserConfig.Schema 选择
+	Name string
+
+	// CodePattern 匹配一个编码的正则片段，不能包含捕获组，如 `[\d-]+`
+	CodePattern string
+	// AuxCodePattern 紧跟在编码后的可选辅助编码，需包含且只包含一个捕获组，如 GBM 编码；为空表示没有辅助编码
+	AuxCodePattern string
+	// Separator 编码各级之间的分隔符，用于推导层级和匹配细类前缀
+	Separator string
+
+	// MajorPattern 识别大类标题行的正则，捕获组依次为编码、辅助编码、名称；为空时大类和其他骨架节点一样按编码识别
+	MajorPattern string
+	// MajorCodePattern 大类编码需要满足的正则，为空时不校验
+	MajorCodePattern string
+
+	// Levels 按编码中分隔符数量排列的层级，最后一级为细类，其余为骨架
+	Levels []string
+
+	// Columns 各类数据所在的列
+	Columns ColumnMap
+
+	// HeaderColumns 表头中必须按顺序出现的列名，用于自动识别工作表
+	HeaderColumns []string
+	// HeaderFirstCells 首列为这些值的行视为表头行
+	HeaderFirstCells []string
+	// ContinuationMarker 续表标记，所在行和细类单元格会被跳过
+	ContinuationMarker string
+	// JunkCells 去除空白后等于这些值的单元格所在行会被跳过
+	JunkCells []string
+	// JunkSubstrings 去除空白后包含这些文字的单元格所在行会被跳过，如文档标题
+	JunkSubstrings []string
+}
+
+// ColumnMap 词典表格的列布局，列号从0开始
+type ColumnMap struct {
+	SkeletonColumns int // 前N列为骨架列（大类、中类、小类）
+	DetailCode      int // 细类编码列
+	DetailName      int // 细类名称列
+}
+
+// GBT2022Schema 返回国家职业分类大典的格式定义：八大类1-8，"第X大类"标题，可选的GBM编码，A-D列骨架，E/F列细类
+func GBT2022Schema() DictionarySchema {
+	return DictionarySchema{
+		Name:               SchemaGBT2022,
+		CodePattern:        `[\d-]+`,
+		AuxCodePattern:     `\(\s*GBM\s*(\d+)\s*\)`,
+		Separator:          "-",
+		MajorPattern:       `第[一二三四五六七八]大类\s+([1-8])\s*(?:\(\s*GBM\s*(\d+)\s*\))?\s*(.*)$`,
+		MajorCodePattern:   `^[1-8]$`,
+		Levels:             []string{model.LevelMajor, model.LevelMiddle, model.LevelSmall, model.LevelDetail},
+		Columns:            ColumnMap{SkeletonColumns: 4, DetailCode: 4, DetailName: 5},
+		HeaderColumns:      []string{"大类", "中类", "小类"},
+		HeaderFirstCells:   []string{"大类", "中类"},
+		ContinuationMarker: "续表",
+		JunkCells:          []string{"续表", "分类体系表"},
+		JunkSubstrings:     []string{"职业分类大典"},
+	}
+}
+
+// compiledSchema 编译好正则的词典格式
+type compiledSchema struct {
+	DictionarySchema
+	reUnified    *regexp.Regexp // 前缀名称、编码、辅助编码、后缀名称
+	reCodeFinder *regexp.Regexp // 在一段文本中定位每条记录的起始位置
+	reMajorClass *regexp.Regexp // 大类标题，可能为 nil
+	reMajorCode  *regexp.Regexp // 大类编码校验，可能为 nil
+	reWhitespace *regexp.Regexp
+}
+
+var (
+	schemaMutex sync.RWMutex
+	schemas     = map[string]*compiledSchema{}
+)
+
+func init() {
+	if err := RegisterSchema(GBT2022Schema()); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterSchema 注册词典格式，同名格式会被覆盖。正则无法编译或定义不完整时返回错误
+func RegisterSchema(schema DictionarySchema) error {
+	compiled, err := compileSchema(schema)
+	if err != nil {
+		return fmt.Errorf("词典格式 %q 无效: %w", schema.Name, err)
+	}
+	schemaMutex.Lock()
+	defer schemaMutex.Unlock()
+	schemas[schema.Name] = compiled
+	return nil
+}
+
+// SchemaNames 返回已注册的词典格式名称
+func SchemaNames() []string {
+	schemaMutex.RLock()
+	defer schemaMutex.RUnlock()
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SchemaFromEnv 从环境变量 PARSER_SCHEMA 读取词典格式名称，未设置时返回空字符串（使用默认格式）
+func SchemaFromEnv() string {
+	return strings.TrimSpace(os.Getenv("PARSER_SCHEMA"))
+}
+
+// LookupSchema 按名称返回已注册的词典格式定义，名称为空时返回默认格式，未注册时返回错误
+func LookupSchema(name string) (DictionarySchema, error) {
+	schema, err := lookupSchema(name)
+	if err != nil {
+		return DictionarySchema{}, fmt.Errorf("%v，可用格式: %v", err, SchemaNames())
+	}
+	definition := schema.DictionarySchema
+	definition.Levels = append([]string(nil), schema.Levels...)
+	return definition, nil
+}
+
+// lookupSchema 按名称查找词典格式，名称为空时返回默认格式
+func lookupSchema(name string) (*compiledSchema, error) {
+	if name == "" {
+		name = SchemaGBT2022
+	}
+	schemaMutex.RLock()
+	defer schemaMutex.RUnlock()
+	if schema, ok := schemas[name]; ok {
+		return schema, nil
+	}
+	return nil, fmt.Errorf("未注册的词典格式 %q", name)
+}
+
+// resolveSchema 查找配置的词典格式，未注册时回退到默认格式，Validate 会报告该错误
+func resolveSchema(config *ParserConfig) *compiledSchema {
+	schema, err := lookupSchema(config.Schema)
+	if err != nil {
+		schema, _ = lookupSchema(SchemaGBT2022)
+	}
+	return schema
+}
+
+// newParserSchema 为解析器选择词典格式，格式未注册时记录警告
+func newParserSchema(config *ParserConfig) *compiledSchema {
+	if err := validateSchema(config); err != nil {
+		log.Printf("⚠️ %v，使用 %s", err, SchemaGBT2022)
+	}
+	return resolveSchema(config)
+}
+
+// compileSchema 校验格式定义并编译其中的正则
+func compileSchema(schema DictionarySchema) (*compiledSchema, error) {
+	if schema.Name == "" {
+		return nil, errors.New("名称不能为空")
+	}
+	if schema.CodePattern == "" || schema.Separator == "" {
+		return nil, errors.New("CodePattern 和 Separator 不能为空")
+	}
+	if len(schema.Levels) < 2 {
+		return nil, errors.New("Levels 至少需要一级骨架和一级细类")
+	}
+	columns := schema.Columns
+	if columns.SkeletonColumns <= 0 || columns.DetailCode < 0 || columns.DetailName < 0 {
+		return nil, errors.New("列布局无效")
+	}
+
+	// 没有辅助编码时用空捕获组占位，保证 reUnified 始终有4个捕获组
+	aux := schema.AuxCodePattern
+	if aux == "" {
+		aux = `()`
+	}
+	reCode, err := regexp.Compile(schema.CodePattern)
+	if err != nil {
+		return nil, fmt.Errorf("CodePattern: %w", err)
+	}
+	if reCode.NumSubexp() != 0 {
+		return nil, errors.New("CodePattern 不能包含捕获组")
+	}
+	reAux, err := regexp.Compile(aux)
+	if err != nil {
+		return nil, fmt.Errorf("AuxCodePattern: %w", err)
+	}
+	if reAux.NumSubexp() != 1 {
+		return nil, errors.New("AuxCodePattern 必须包含且只包含一个捕获组")
+	}
+
+	compiled := &compiledSchema{
+		DictionarySchema: schema,
+		reUnified:        regexp.MustCompile(`^(.*?)(` + schema.CodePattern + `)\s*(?:` + aux + `)?\s*(.*)$`),
+		reCodeFinder:     regexp.MustCompile(schema.CodePattern + `(?:\s*` + aux + `)?`),
+		reWhitespace:     regexp.MustCompile(`\s+`),
+	}
+	if schema.MajorPattern != "" {
+		if compiled.reMajorClass, err = regexp.Compile(schema.MajorPattern); err != nil {
+			return nil, fmt.Errorf("MajorPattern: %w", err)
+		}
+		if compiled.reMajorClass.NumSubexp() != 3 {
+			return nil, errors.New("MajorPattern 必须包含编码、辅助编码、名称3个捕获组")
+		}
+	}
+	if schema.MajorCodePattern != "" {
+		if compiled.reMajorCode, err = regexp.Compile(schema.MajorCodePattern); err != nil {
+			return nil, fmt.Errorf("MajorCodePattern: %w", err)
+		}
+	}
+	return compiled, nil
+}
+
+// depth 编码中分隔符的数量
+func (s *compiledSchema) depth(code string) int {
+	return strings.Count(code, s.Separator)
+}
+
+// skeletonLevel 根据编码推导骨架层级，细类编码和无法识别的编码返回空字符串
+func (s *compiledSchema) skeletonLevel(code string) string {
+	if code == "" {
+		return ""
+	}
+	if d := s.depth(code); d < len(s.Levels)-1 {
+		return s.Levels[d]
+	}
+	return ""
+}
+
+// isDetailCode 判断编码是否为细类编码
+func (s *compiledSchema) isDetailCode(code string) bool {
+	return s.depth(code) == len(s.Levels)-1
+}
+
+// isMajorCode 判断编码是否符合大类编码规则
+func (s *compiledSchema) isMajorCode(code string) bool {
+	if s.reMajorCode == nil {
+		return s.depth(code) == 0
+	}
+	return s.reMajorCode.MatchString(code)
+}
+
+// isHeaderFirstCell 判断行首单元格是否为表头
+func (s *compiledSchema) isHeaderFirstCell(cell string) bool {
+	for _, header := range s.HeaderFirstCells {
+		if cell == header {
+			return true
+		}
+	}
+	return false
+}
+
+// isJunkCell 判断去除空白后的单元格是否表明所在行应被跳过
+func (s *compiledSchema) isJunkCell(cell string) bool {
+	cleanCell := s.reWhitespace.ReplaceAllString(cell, "")
+	for _, junk := range s.JunkCells {
+		if cleanCell == junk {
+			return true
+		}
+	}
+	for _, junk := range s.JunkSubstrings {
+		if strings.Contains(cleanCell, junk) {
+			return true
+		}
+	}
+	return false
+}
+
+// isJunkRow 检查是否为表头、续表或文档标题等应被忽略的行
+func (s *compiledSchema) isJunkRow(row []string) bool {
+	if len(row) == 0 {
+		return true
+	}
+	if s.isHeaderFirstCell(strings.TrimSpace(row[0])) {
+		return true
+	}
+	for _, cell := range row {
+		if s.isJunkCell(cell) {
+			return true
+		}
+	}
+	return false
+}
+
+// detailCells 返回一行中的细类编码和名称单元格，列不存在时 ok 为 false
+func (s *compiledSchema) detailCells(row []string) (codeData, nameData string, ok bool) {
+	codeCol, nameCol := s.Columns.DetailCode, s.Columns.DetailName
+	if codeCol >= len(row) || nameCol >= len(row) {
+		return "", "", false
+	}
+	return strings.TrimSpace(row[codeCol]), strings.TrimSpace(row[nameCol]), true
+}
+
+// validateSchema 校验配置的词典格式是否已注册
+func validateSchema(config *ParserConfig) error {
+	if _, err := lookupSchema(config.Schema); err != nil {
+		return model.NewValidationError("schema", config.Schema, "registered", fmt.Sprintf("%v，可用格式: %v", err, SchemaNames()))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// testIndustrySchema 行业词典格式：字母大类、点号分隔、无辅助编码，A-C列骨架，D/E列细类
+func testIndustrySchema() DictionarySchema {
+	return DictionarySchema{
+		Name:               "test_industry",
+		CodePattern:        `[A-Z](?:\.\d+)*`,
+		Separator:          ".",
+		MajorCodePattern:   `^[A-H]$`,
+		Levels:             []string{"门类", "大类", "中类", "小类"},
+		Columns:            ColumnMap{SkeletonColumns: 3, DetailCode: 3, DetailName: 4},
+		HeaderColumns:      []string{"门类", "大类", "中类"},
+		HeaderFirstCells:   []string{"门类"},
+		ContinuationMarker: "续表",
+		JunkCells:          []string{"续表"},
+	}
+}
+
+func TestRegisterSchema_ParsesCustomDictionary(t *testing.T) {
+	if err := RegisterSchema(testIndustrySchema()); err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+
+	config := &ParserConfig{SheetName: "Sheet1", Schema: "test_industry"}
+	rows := [][]string{
+		{"门类", "大类", "中类"},
+		{"A 农林牧渔业", "", "", "", ""},
+		{"", "A.01 农业", "", "", ""},
+		{"", "", "A.01.01 谷物种植", "A.01.01.01\nA.01.01.02", "稻谷种植\n小麦种植"},
+		{"续表", "", "", "", ""},
+	}
+
+	excelParser := NewExcelParser(config)
+	if err := excelParser.Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	ctx := context.Background()
+	warnings := &parseWarnings{}
+	skeleton, err := excelParser.extractSkeletonRecords(ctx, rows, warnings)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	details, err := excelParser.extractDetailRecords(ctx, rows, warnings)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := make(map[string]string)
+	for _, record := range append(skeleton, details...) {
+		got[record.Code] = record.Name
+	}
+	expected := map[string]string{
+		"A":          "农林牧渔业",
+		"A.01":       "农业",
+		"A.01.01":    "谷物种植",
+		"A.01.01.01": "稻谷种植",
+		"A.01.01.02": "小麦种植",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected records %v, got %v", expected, got)
+	}
+	if list := warnings.list(); len(list) != 0 {
+		t.Errorf("Expected no warnings, got %+v", list)
+	}
+
+	// 混合解析器按格式识别骨架层级，并为最后一级骨架收集细类
+	result, err := NewHybridParser(config).hybridParse(ctx, rows)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	levels := make(map[string]string)
+	for _, record := range result.SkeletonRecords {
+		levels[record.Code] = record.Level
+	}
+	if !reflect.DeepEqual(levels, map[string]string{"A": "门类", "A.01": "大类", "A.01.01": "中类"}) {
+		t.Errorf("Unexpected skeleton levels: %v", levels)
+	}
+	if len(result.AITasks) != 1 || result.AITasks[0].ParentCode != "A.01.01" || len(result.AITasks[0].DetailCodesRaw) != 2 {
+		t.Errorf("Expected one AI task for A.01.01 with 2 details, got %+v", result.AITasks)
+	}
+}
+
+func TestRegisterSchema_RejectsInvalidDefinitions(t *testing.T) {
+	invalid := map[string]func(*DictionarySchema){
+		"缺少名称":      func(s *DictionarySchema) { s.Name = "" },
+		"编码正则含捕获组":  func(s *DictionarySchema) { s.CodePattern = `([\d-]+)` },
+		"辅助编码缺少捕获组": func(s *DictionarySchema) { s.AuxCodePattern = `GBM\s*\d+` },
+		"大类正则捕获组不足": func(s *DictionarySchema) { s.MajorPattern = `第(.)大类` },
+		"层级不足":      func(s *DictionarySchema) { s.Levels = []string{"大类"} },
+	}
+	for name, mutate := range invalid {
+		schema := GBT2022Schema()
+		schema.Name = "test_invalid"
+		mutate(&schema)
+		if err := RegisterSchema(schema); err == nil {
+			t.Errorf("%s: expected registration to fail", name)
+		}
+	}
+}
+
+func TestValidate_UnknownSchema(t *testing.T) {
+	config := &ParserConfig{SheetName: "Table1", Schema: "missing"}
+	if err := NewExcelParser(config).Validate(); err == nil {
+		t.Error("Expected ExcelParser validation to fail for unknown schema")
+	}
+	if err := NewHybridParser(config).Validate(); err == nil {
+		t.Error("Expected HybridParser validation to fail for unknown schema")
+	}
+	// 未注册的格式回退到默认格式，仍可解析
+	if level := NewHybridParser(config).determineLevel("1-01"); level != "中类" {
+		t.Errorf("Expected fallback to %s, got level %q", SchemaGBT2022, level)
+	}
+}
+
+func TestLookupSchema(t *testing.T) {
+	schema, err := LookupSchema("")
+	if err != nil || schema.Name != SchemaGBT2022 || schema.Separator != "-" || len(schema.Levels) != 4 {
+		t.Fatalf("Expected the default schema, got %+v, %v", schema, err)
+	}
+	schema.Levels[0] = "changed"
+	if again, _ := LookupSchema(SchemaGBT2022); again.Levels[0] == "changed" {
+		t.Error("LookupSchema should return a copy of the registered levels")
+	}
+	if _, err := LookupSchema("no_such_schema"); err == nil {
+		t.Error("Expected an error for an unregistered schema")
+	}
+}
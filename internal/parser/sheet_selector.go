@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/freedkr/moonshot/internal/model"
+)
+
+// headerScanRows 自动识别工作表时扫描的最大行数
+const headerScanRows = 20
+
+var reHeaderWhitespace = regexp.MustCompile(`\s+`)
+
+// selectSheet 选择要解析的工作表
+// 依次尝试：配置的工作表名称、候选名称列表、按词典格式的表头特征自动识别；都不匹配时返回列出可用工作表的错误
+func selectSheet(f workbook, filePath string, config *ParserConfig) (string, error) {
+	sheets := f.SheetList()
+	available := make(map[string]bool, len(sheets))
+	for _, sheet := range sheets {
+		available[sheet] = true
+	}
+
+	if config.SheetName != "" && available[config.SheetName] {
+		return config.SheetName, nil
+	}
+
+	for _, candidate := range config.SheetCandidates {
+		if available[candidate] {
+			log.Printf("工作表 %q 不存在，使用候选工作表 %q", config.SheetName, candidate)
+			return candidate, nil
+		}
+	}
+
+	headerColumns := resolveSchema(config).HeaderColumns
+	for _, sheet := range sheets {
+		if sheetHasExpectedHeader(f, sheet, headerColumns) {
+			log.Printf("工作表 %q 不存在，按表头自动识别使用工作表 %q", config.SheetName, sheet)
+			return sheet, nil
+		}
+	}
+
+	message := fmt.Sprintf("未找到匹配的工作表（配置: %q, 候选: %v），可用工作表: [%s]",
+		config.SheetName, config.SheetCandidates, strings.Join(sheets, ", "))
+	return "", model.NewFileError(model.ErrCodeNotFound, filePath, "select_sheet", message, nil)
+}
+
+// sheetHasExpectedHeader 判断工作表前若干行中是否存在职业分类表表头
+func sheetHasExpectedHeader(f workbook, sheet string, headerColumns []string) bool {
+	if len(headerColumns) == 0 {
+		return false
+	}
+	rows, err := f.HeadRows(sheet, headerScanRows)
+	if err != nil {
+		return false
+	}
+	for _, columns := range rows {
+		if isExpectedHeaderRow(columns, headerColumns) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExpectedHeaderRow 判断一行是否按顺序包含表头列（默认为大类、中类、小类）
+func isExpectedHeaderRow(row []string, headerColumns []string) bool {
+	next := 0
+	for _, cell := range row {
+		if next == len(headerColumns) {
+			break
+		}
+		if reHeaderWhitespace.ReplaceAllString(cell, "") == headerColumns[next] {
+			next++
+		}
+	}
+	return next == len(headerColumns)
+}
+
+// SheetCandidatesFromEnv 从环境变量 PARSER_SHEET_CANDIDATES 读取逗号分隔的候选工作表名称
+func SheetCandidatesFromEnv() []string {
+	var candidates []string
+	for _, name := range strings.Split(os.Getenv("PARSER_SHEET_CANDIDATES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/extrame/xls"
+	"github.com/xuri/excelize/v2"
+)
+
+// oleSignature 旧版 .xls（BIFF8）所在的 OLE2 复合文档文件头
+var oleSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// xlsFallbackColumns 旧版文件的行记录缺少列范围时读取的列数
+const xlsFallbackColumns = 26
+
+// workbook 解析器读取的工作簿，.xlsx 和旧版 .xls 都转换为同样的 [][]string 行数据
+type workbook interface {
+	// SheetList 按顺序返回所有工作表名称
+	SheetList() []string
+	// Rows 读取工作表的全部行，每行去掉末尾的空单元格
+	Rows(sheet string) ([][]string, error)
+	// HeadRows 读取工作表的前 n 行，用于识别表头
+	HeadRows(sheet string, n int) ([][]string, error)
+	Close() error
+}
+
+// openWorkbook 按文件内容识别格式并打开工作簿
+// 上传文件在worker中统一保存为 .xlsx 后缀，因此不依赖扩展名判断
+func openWorkbook(filePath string) (workbook, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, len(oleSignature))
+	if _, err := io.ReadFull(file, header); err != nil || !bytes.Equal(header, oleSignature) {
+		file.Close()
+		f, err := excelize.OpenFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		return &xlsxWorkbook{f: f}, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	wb, err := xls.OpenReader(file, "utf-8")
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("读取xls文件失败: %w", err)
+	}
+	if wb == nil {
+		file.Close()
+		return nil, fmt.Errorf("读取xls文件失败: 未找到Workbook数据流")
+	}
+	return &xlsWorkbook{wb: wb, file: file}, nil
+}
+
+// xlsxWorkbook 基于 excelize 的 .xlsx 工作簿
+type xlsxWorkbook struct {
+	f *excelize.File
+}
+
+func (w *xlsxWorkbook) SheetList() []string {
+	return w.f.GetSheetList()
+}
+
+func (w *xlsxWorkbook) Rows(sheet string) ([][]string, error) {
+	return w.f.GetRows(sheet)
+}
+
+// HeadRows 流式读取前 n 行，避免为识别表头加载整个工作表
+func (w *xlsxWorkbook) HeadRows(sheet string, n int) ([][]string, error) {
+	rows, err := w.f.Rows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result [][]string
+	for i := 0; i < n && rows.Next(); i++ {
+		columns, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, columns)
+	}
+	return result, nil
+}
+
+func (w *xlsxWorkbook) Close() error {
+	return w.f.Close()
+}
+
+// xlsWorkbook 基于 extrame/xls 的旧版 .xls 工作簿
+type xlsWorkbook struct {
+	wb   *xls.WorkBook
+	file *os.File
+}
+
+func (w *xlsWorkbook) SheetList() []string {
+	sheets := make([]string, 0, w.wb.NumSheets())
+	for i := 0; i < w.wb.NumSheets(); i++ {
+		if sheet := w.wb.GetSheet(i); sheet != nil {
+			sheets = append(sheets, sheet.Name)
+		}
+	}
+	return sheets
+}
+
+func (w *xlsWorkbook) Rows(sheet string) ([][]string, error) {
+	return w.HeadRows(sheet, -1)
+}
+
+// HeadRows 读取前 n 行，n<0 时读取全部；缺失的行返回空切片，与 excelize 的行为一致
+func (w *xlsWorkbook) HeadRows(sheet string, n int) ([][]string, error) {
+	ws := w.findSheet(sheet)
+	if ws == nil {
+		return nil, fmt.Errorf("工作表 %s 不存在", sheet)
+	}
+
+	count := int(ws.MaxRow) + 1
+	if n >= 0 && n < count {
+		count = n
+	}
+	rows := make([][]string, count)
+	for i := 0; i < count; i++ {
+		rows[i] = readXLSRow(ws, i)
+	}
+	// 与 excelize 一致，去掉末尾的空行
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+	return rows, nil
+}
+
+func (w *xlsWorkbook) findSheet(name string) *xls.WorkSheet {
+	for i := 0; i < w.wb.NumSheets(); i++ {
+		if sheet := w.wb.GetSheet(i); sheet != nil && sheet.Name == name {
+			return sheet
+		}
+	}
+	return nil
+}
+
+func (w *xlsWorkbook) Close() error {
+	return w.file.Close()
+}
+
+// readXLSRow 读取一行单元格文本，去掉末尾的空单元格
+// extrame/xls 对不存在的行会 panic，这里按空行处理
+func readXLSRow(ws *xls.WorkSheet, index int) (cells []string) {
+	defer func() {
+		if recover() != nil {
+			cells = nil
+		}
+	}()
+
+	row := ws.Row(index)
+	lastCol := row.LastCol()
+	if lastCol <= 0 {
+		lastCol = xlsFallbackColumns
+	}
+	cells = make([]string, lastCol)
+	for col := 0; col < lastCol; col++ {
+		cells[col] = strings.ReplaceAll(row.Col(col), "\r\n", "\n")
+	}
+	for len(cells) > 0 && cells[len(cells)-1] == "" {
+		cells = cells[:len(cells)-1]
+	}
+	return cells
+}
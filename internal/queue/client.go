@@ -15,9 +15,14 @@ type Client interface {
 	EnqueueTask(task *Task) error
 	EnqueueTaskWithContext(ctx context.Context, task *Task) error
 	DequeueTask(queueName string) (*Task, error)
+	BlockingDequeue(ctx context.Context, queueName string, timeout time.Duration) (*Task, error)
 	GetTaskStatus(taskID string) (*Task, error)
 	UpdateTaskStatus(taskID string, status string, error string) error
 	UpdateTaskResult(taskID string, resultObjectName string) error
+	RequestCancel(ctx context.Context, taskID string) error
+	IsCancelRequested(ctx context.Context, taskID string) (bool, error)
+	AcquireTaskLock(ctx context.Context, taskID string, owner string, ttl time.Duration) (bool, error)
+	ReleaseTaskLock(ctx context.Context, taskID string, owner string) error
 	Close()
 }
 
@@ -39,54 +44,47 @@ type Task struct {
 type redisClient struct {
 	client *redis.Client
 	ctx    context.Context
+	retry  RetryConfig // Redis命令的重试配置
 }
 
+// NewRedisQueue 创建Redis队列客户端，重试配置从环境变量读取
 func NewRedisQueue(qcfg config.QueueConfig) (Client, error) {
+	return NewRedisQueueWithRetry(qcfg, RetryConfigFromEnv())
+}
+
+// NewRedisQueueWithRetry 使用指定的重试配置创建Redis队列客户端
+// 命令的重试统一由 retry 控制，关闭go-redis内置的重试，避免两层重试叠加
+func NewRedisQueueWithRetry(qcfg config.QueueConfig, retry RetryConfig) (Client, error) {
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     qcfg.Addr,
-		Password: qcfg.Password,
-		DB:       qcfg.DB,
+		Addr:       qcfg.Addr,
+		Password:   qcfg.Password,
+		DB:         qcfg.DB,
+		MaxRetries: -1,
 	})
 	ctx := context.Background()
 
-	// 测试连接
-	_, err := rdb.Ping(ctx).Result()
+	// 测试连接，容忍Redis启动稍晚于服务
+	err := withRetry(ctx, retry, "PING", func() error {
+		return rdb.Ping(ctx).Err()
+	})
 	if err != nil {
+		rdb.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %v", err)
 	}
 
 	return &redisClient{
 		client: rdb,
 		ctx:    ctx,
+		retry:  retry,
 	}, nil
 }
 
 func (c *redisClient) EnqueueTask(task *Task) error {
-	// 序列化任务
-	taskJSON, err := json.Marshal(task)
-	if err != nil {
-		return fmt.Errorf("failed to marshal task: %v", err)
-	}
-
-	// 保存任务状态
-	taskKey := fmt.Sprintf("task:%s", task.ID)
-	err = c.client.Set(c.ctx, taskKey, taskJSON, 24*time.Hour).Err()
-	if err != nil {
-		return fmt.Errorf("failed to save task: %v", err)
-	}
-
-	// 根据任务类型选择队列
-	queueName := c.getQueueName(task.Type)
-
-	// 添加到队列
-	err = c.client.LPush(c.ctx, queueName, task.ID).Err()
-	if err != nil {
-		return fmt.Errorf("failed to enqueue task: %v", err)
-	}
-
-	return nil
+	return c.EnqueueTaskWithContext(c.ctx, task)
 }
 
+// EnqueueTaskWithContext 保存任务状态并加入对应队列，两条命令在一个事务中执行，失败时整体重试
+// 命令已执行但响应丢失时，重试可能导致同一任务重复入队
 func (c *redisClient) EnqueueTaskWithContext(ctx context.Context, task *Task) error {
 	// 序列化任务
 	taskJSON, err := json.Marshal(task)
@@ -94,33 +92,50 @@ func (c *redisClient) EnqueueTaskWithContext(ctx context.Context, task *Task) er
 		return fmt.Errorf("failed to marshal task: %v", err)
 	}
 
-	// 保存任务状态
 	taskKey := fmt.Sprintf("task:%s", task.ID)
-	err = c.client.Set(ctx, taskKey, taskJSON, 24*time.Hour).Err()
-	if err != nil {
-		return fmt.Errorf("failed to save task: %v", err)
-	}
-
 	// 根据任务类型选择队列
 	queueName := c.getQueueName(task.Type)
 
-	// 添加到队列
-	err = c.client.LPush(ctx, queueName, task.ID).Err()
+	err = withRetry(ctx, c.retry, "enqueue", func() error {
+		_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, taskKey, taskJSON, 24*time.Hour)
+			pipe.LPush(ctx, queueName, task.ID)
+			return nil
+		})
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to enqueue task: %v", err)
+		return fmt.Errorf("failed to enqueue task: %w", err)
 	}
 
 	return nil
 }
 
+// DefaultDequeueTimeout DequeueTask 阻塞等待任务的时长
+const DefaultDequeueTimeout = 5 * time.Second
+
+// DequeueTask 阻塞式从队列获取任务，最多等待5秒；队列为空时返回 nil, nil
 func (c *redisClient) DequeueTask(queueName string) (*Task, error) {
-	// 阻塞式从队列获取任务ID
-	result, err := c.client.BRPop(c.ctx, 5*time.Second, queueName).Result()
+	return c.BlockingDequeue(c.ctx, queueName, DefaultDequeueTimeout)
+}
+
+// BlockingDequeue 以 BRPOP 阻塞等待任务，有任务入队时立即返回；timeout 内没有任务时返回 nil, nil
+// timeout <= 0 时使用 DefaultDequeueTimeout，不会无限阻塞，调用方可以在两次出队之间检查 ctx 和下游状态
+func (c *redisClient) BlockingDequeue(ctx context.Context, queueName string, timeout time.Duration) (*Task, error) {
+	if timeout <= 0 {
+		timeout = DefaultDequeueTimeout
+	}
+	var result []string
+	err := withRetry(ctx, c.retry, "BRPOP", func() error {
+		var err error
+		result, err = c.client.BRPop(ctx, timeout, queueName).Result()
+		return err
+	})
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil // 没有任务
 		}
-		return nil, fmt.Errorf("failed to dequeue task: %v", err)
+		return nil, fmt.Errorf("failed to dequeue task: %w", err)
 	}
 
 	if len(result) != 2 {
@@ -136,12 +151,17 @@ func (c *redisClient) DequeueTask(queueName string) (*Task, error) {
 func (c *redisClient) GetTaskStatus(taskID string) (*Task, error) {
 	taskKey := fmt.Sprintf("task:%s", taskID)
 
-	taskJSON, err := c.client.Get(c.ctx, taskKey).Result()
+	var taskJSON string
+	err := withRetry(c.ctx, c.retry, "GET", func() error {
+		var err error
+		taskJSON, err = c.client.Get(c.ctx, taskKey).Result()
+		return err
+	})
 	if err != nil {
 		if err == redis.Nil {
 			return nil, fmt.Errorf("task not found")
 		}
-		return nil, fmt.Errorf("failed to get task: %v", err)
+		return nil, fmt.Errorf("failed to get task: %w", err)
 	}
 
 	var task Task
@@ -181,6 +201,82 @@ func (c *redisClient) UpdateTaskResult(taskID string, resultObjectName string) e
 	return c.saveTask(task)
 }
 
+// RequestCancel 设置任务取消标记，由处理任务的worker在步骤之间检查
+func (c *redisClient) RequestCancel(ctx context.Context, taskID string) error {
+	err := withRetry(ctx, c.retry, "SET cancel", func() error {
+		return c.client.Set(ctx, cancelKey(taskID), time.Now().Format(time.RFC3339), 24*time.Hour).Err()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set cancel flag: %w", err)
+	}
+	return nil
+}
+
+// IsCancelRequested 检查任务是否已被请求取消
+func (c *redisClient) IsCancelRequested(ctx context.Context, taskID string) (bool, error) {
+	var n int64
+	err := withRetry(ctx, c.retry, "EXISTS cancel", func() error {
+		var err error
+		n, err = c.client.Exists(ctx, cancelKey(taskID)).Result()
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check cancel flag: %w", err)
+	}
+	return n > 0, nil
+}
+
+func cancelKey(taskID string) string {
+	return fmt.Sprintf("task:%s:cancel", taskID)
+}
+
+// releaseLockScript 只删除仍由 owner 持有的锁，避免锁过期后误删其他流程获得的锁
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// AcquireTaskLock 获取任务的处理锁，同一任务同时只允许一个增量处理流程，锁在 ttl 后自动过期
+// 重试时上一次 SETNX 可能已经成功，因此锁已存在时再确认持有者是否为 owner
+func (c *redisClient) AcquireTaskLock(ctx context.Context, taskID string, owner string, ttl time.Duration) (bool, error) {
+	var ok bool
+	err := withRetry(ctx, c.retry, "SETNX lock", func() error {
+		acquired, err := c.client.SetNX(ctx, lockKey(taskID), owner, ttl).Result()
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			holder, err := c.client.Get(ctx, lockKey(taskID)).Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			acquired = holder == owner
+		}
+		ok = acquired
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire task lock: %w", err)
+	}
+	return ok, nil
+}
+
+// ReleaseTaskLock 释放 owner 持有的任务处理锁
+func (c *redisClient) ReleaseTaskLock(ctx context.Context, taskID string, owner string) error {
+	err := withRetry(ctx, c.retry, "release lock", func() error {
+		return releaseLockScript.Run(ctx, c.client, []string{lockKey(taskID)}, owner).Err()
+	})
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to release task lock: %w", err)
+	}
+	return nil
+}
+
+func lockKey(taskID string) string {
+	return fmt.Sprintf("task:%s:lock", taskID)
+}
+
 func (c *redisClient) saveTask(task *Task) error {
 	taskJSON, err := json.Marshal(task)
 	if err != nil {
@@ -188,9 +284,11 @@ func (c *redisClient) saveTask(task *Task) error {
 	}
 
 	taskKey := fmt.Sprintf("task:%s", task.ID)
-	err = c.client.Set(c.ctx, taskKey, taskJSON, 24*time.Hour).Err()
+	err = withRetry(c.ctx, c.retry, "SET task", func() error {
+		return c.client.Set(c.ctx, taskKey, taskJSON, 24*time.Hour).Err()
+	})
 	if err != nil {
-		return fmt.Errorf("failed to save task: %v", err)
+		return fmt.Errorf("failed to save task: %w", err)
 	}
 
 	return nil
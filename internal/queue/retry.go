@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrQueueUnavailable Redis在重试耗尽后仍不可用。DequeueTask 队列为空时返回 nil, nil，
+// 只有Redis本身出错时才返回错误，调用方可据此区分"没有任务"和"队列故障"
+var ErrQueueUnavailable = errors.New("queue unavailable")
+
+// RetryConfig Redis命令的重试配置
+type RetryConfig struct {
+	MaxRetries     int           // 首次失败后的最大重试次数，0 表示不重试
+	InitialBackoff time.Duration // 首次重试前的等待时间，之后每次翻倍
+	MaxBackoff     time.Duration // 单次等待时间上限
+}
+
+// DefaultRetryConfig 默认重试配置：最多重试3次，等待 100ms、200ms、400ms
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxRetries:     3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+	}
+}
+
+// RetryConfigFromEnv 从环境变量读取重试配置，未设置或格式错误的项使用默认值
+// REDIS_RETRY_MAX_RETRIES、REDIS_RETRY_BACKOFF、REDIS_RETRY_MAX_BACKOFF
+func RetryConfigFromEnv() RetryConfig {
+	cfg := DefaultRetryConfig()
+	if v := os.Getenv("REDIS_RETRY_MAX_RETRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.MaxRetries = n
+		}
+	}
+	if v := os.Getenv("REDIS_RETRY_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.InitialBackoff = d
+		}
+	}
+	if v := os.Getenv("REDIS_RETRY_MAX_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.MaxBackoff = d
+		}
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = cfg.InitialBackoff
+	}
+	return cfg
+}
+
+// withRetry 执行Redis命令，遇到可重试的错误时按指数退避重试
+// 重试耗尽后返回包装了 ErrQueueUnavailable 的错误；不可重试的错误（如 redis.Nil、上下文取消）直接返回
+func withRetry(ctx context.Context, cfg RetryConfig, op string, fn func() error) error {
+	backoff := cfg.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+		if attempt >= cfg.MaxRetries {
+			return fmt.Errorf("%w: %s failed after %d attempts: %v", ErrQueueUnavailable, op, attempt+1, err)
+		}
+
+		log.Printf("Redis命令失败，%v 后重试 (%s, 第%d次): %v", backoff, op, attempt+1, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s: %w", op, ctx.Err())
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > cfg.MaxBackoff {
+			backoff = cfg.MaxBackoff
+		}
+	}
+}
+
+// isRetryable 判断错误是否为Redis的瞬时故障
+// 连接类错误可重试；Redis返回的错误只有实例加载中、只读副本等临时状态可重试
+func isRetryable(err error) bool {
+	if errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		msg := redisErr.Error()
+		return strings.HasPrefix(msg, "LOADING ") || strings.HasPrefix(msg, "READONLY ") ||
+			strings.HasPrefix(msg, "CLUSTERDOWN ") || strings.HasPrefix(msg, "TRYAGAIN ")
+	}
+	return true
+}
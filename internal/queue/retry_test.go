@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// serverError 模拟Redis服务端返回的错误
+type serverError string
+
+func (e serverError) Error() string { return string(e) }
+
+func (serverError) RedisError() {}
+
+func testRetryConfig(maxRetries int) RetryConfig {
+	return RetryConfig{MaxRetries: maxRetries, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+}
+
+func TestWithRetry_RecoversFromTransientErrors(t *testing.T) {
+	attempts := 0
+	err := withRetry(context.Background(), testRetryConfig(3), "SET", func() error {
+		attempts++
+		if attempts < 3 {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected success after retries, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestWithRetry_ExhaustedReturnsQueueUnavailable(t *testing.T) {
+	attempts := 0
+	err := withRetry(context.Background(), testRetryConfig(2), "LPUSH", func() error {
+		attempts++
+		return io.EOF
+	})
+	if !errors.Is(err, ErrQueueUnavailable) {
+		t.Fatalf("Expected ErrQueueUnavailable, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 1 attempt plus 2 retries, got %d", attempts)
+	}
+}
+
+func TestWithRetry_DoesNotRetryPermanentErrors(t *testing.T) {
+	for _, permanent := range []error{redis.Nil, context.Canceled, serverError("WRONGTYPE Operation against a key holding the wrong kind of value")} {
+		attempts := 0
+		err := withRetry(context.Background(), testRetryConfig(3), "GET", func() error {
+			attempts++
+			return permanent
+		})
+		if err != permanent {
+			t.Errorf("Expected %v returned unchanged, got %v", permanent, err)
+		}
+		if attempts != 1 {
+			t.Errorf("Expected no retry for %v, got %d attempts", permanent, attempts)
+		}
+	}
+}
+
+func TestIsRetryable_RedisTransientStates(t *testing.T) {
+	if !isRetryable(serverError("LOADING Redis is loading the dataset in memory")) {
+		t.Errorf("Expected LOADING to be retryable")
+	}
+	if !isRetryable(serverError("READONLY You can't write against a read only replica.")) {
+		t.Errorf("Expected READONLY to be retryable")
+	}
+}
+
+func TestWithRetry_StopsWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := RetryConfig{MaxRetries: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	attempts := 0
+	err := withRetry(ctx, cfg, "BRPOP", func() error {
+		attempts++
+		cancel()
+		return io.EOF
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestRetryConfigFromEnv(t *testing.T) {
+	t.Setenv("REDIS_RETRY_MAX_RETRIES", "5")
+	t.Setenv("REDIS_RETRY_BACKOFF", "500ms")
+	t.Setenv("REDIS_RETRY_MAX_BACKOFF", "invalid")
+
+	cfg := RetryConfigFromEnv()
+	if cfg.MaxRetries != 5 || cfg.InitialBackoff != 500*time.Millisecond {
+		t.Errorf("Unexpected config from env: %+v", cfg)
+	}
+	if cfg.MaxBackoff != DefaultRetryConfig().MaxBackoff {
+		t.Errorf("Expected default max backoff for invalid value, got %v", cfg.MaxBackoff)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
 )
 
 // MinIOConfig MinIO配置
@@ -18,8 +19,23 @@ type MinIOConfig struct {
 	UseSSL          bool   `yaml:"use_ssl" env:"MINIO_USE_SSL" default:"false"`
 	BucketName      string `yaml:"bucket_name" env:"MINIO_BUCKET_NAME" default:"moonshot"`
 	Region          string `yaml:"region" env:"MINIO_REGION" default:"us-east-1"`
+
+	// 存储桶策略
+	Versioning        bool   `yaml:"versioning" env:"MINIO_VERSIONING" default:"false"`
+	UploadsPrefix     string `yaml:"uploads_prefix" env:"MINIO_UPLOADS_PREFIX" default:"uploads/"`
+	UploadsExpireDays int    `yaml:"uploads_expire_days" env:"MINIO_UPLOADS_EXPIRE_DAYS" default:"0"`
+}
+
+// BucketPolicy 存储桶策略
+type BucketPolicy struct {
+	Versioning   bool   // 是否启用对象版本控制
+	ExpirePrefix string // 自动过期的对象前缀
+	ExpireDays   int    // 过期天数，0表示不设置过期规则
 }
 
+// uploadsExpireRuleID 上传文件过期规则ID
+const uploadsExpireRuleID = "moonshot-expire-uploads"
+
 // MinIOStorage MinIO存储实现
 type MinIOStorage struct {
 	client *minio.Client
@@ -58,6 +74,78 @@ func (m *MinIOStorage) EnsureBucket(ctx context.Context) error {
 		}
 	}
 
+	prefix := m.config.UploadsPrefix
+	if prefix == "" {
+		prefix = "uploads/"
+	}
+	return m.ConfigureBucket(ctx, BucketPolicy{
+		Versioning:   m.config.Versioning,
+		ExpirePrefix: prefix,
+		ExpireDays:   m.config.UploadsExpireDays,
+	})
+}
+
+// ConfigureBucket 应用存储桶策略，可重复调用：已生效的配置不会重复设置
+func (m *MinIOStorage) ConfigureBucket(ctx context.Context, policy BucketPolicy) error {
+	if policy.Versioning {
+		versioning, err := m.client.GetBucketVersioning(ctx, m.config.BucketName)
+		if err != nil {
+			return fmt.Errorf("获取存储桶版本控制状态失败: %w", err)
+		}
+		if !versioning.Enabled() {
+			if err := m.client.EnableVersioning(ctx, m.config.BucketName); err != nil {
+				return fmt.Errorf("启用存储桶版本控制失败: %w", err)
+			}
+		}
+	}
+
+	return m.configureExpireRule(ctx, policy)
+}
+
+// configureExpireRule 设置或移除上传文件的过期规则，保留其他已有规则
+func (m *MinIOStorage) configureExpireRule(ctx context.Context, policy BucketPolicy) error {
+	current, err := m.client.GetBucketLifecycle(ctx, m.config.BucketName)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code != "NoSuchLifecycleConfiguration" {
+			return fmt.Errorf("获取存储桶生命周期配置失败: %w", err)
+		}
+		current = lifecycle.NewConfiguration()
+	}
+
+	var rules []lifecycle.Rule
+	var existing *lifecycle.Rule
+	for i := range current.Rules {
+		if current.Rules[i].ID == uploadsExpireRuleID {
+			existing = &current.Rules[i]
+			continue
+		}
+		rules = append(rules, current.Rules[i])
+	}
+
+	if policy.ExpireDays <= 0 {
+		// 未配置过期且不存在旧规则时无需改动
+		if existing == nil {
+			return nil
+		}
+	} else {
+		if existing != nil && existing.Status == "Enabled" &&
+			existing.RuleFilter.Prefix == policy.ExpirePrefix &&
+			int(existing.Expiration.Days) == policy.ExpireDays {
+			return nil
+		}
+		rules = append(rules, lifecycle.Rule{
+			ID:         uploadsExpireRuleID,
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: policy.ExpirePrefix},
+			Expiration: lifecycle.Expiration{Days: lifecycle.ExpirationDays(policy.ExpireDays)},
+		})
+	}
+
+	config := lifecycle.NewConfiguration()
+	config.Rules = rules
+	if err := m.client.SetBucketLifecycle(ctx, m.config.BucketName, config); err != nil {
+		return fmt.Errorf("设置存储桶生命周期失败: %w", err)
+	}
 	return nil
 }
 
@@ -0,0 +1,67 @@
+// Package tokens 提示词token数估算
+// 不依赖具体模型的分词器：中日韩字符按每字1个token，其余字符按每4个1个token向上取整，
+// 对Kimi的中文提示词略偏保守，用于发送前判断提示词是否放得进模型上下文
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+)
+
+// ErrPromptTooLarge 提示词估算的token数超过模型上下文减去输出预留，发送后输出会被截断
+// llm-service 以该错误的文本作为任务错误前缀，调用方据此识别
+var ErrPromptTooLarge = errors.New("提示词超出模型上下文")
+
+// asciiCharsPerToken 非中日韩字符平均每个token的字符数
+const asciiCharsPerToken = 4
+
+// Estimate 估算文本的token数
+func Estimate(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+asciiCharsPerToken-1)/asciiCharsPerToken
+}
+
+// isCJK 判断是否为中日韩文字或全角标点
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) ||
+		(r >= 0x3000 && r <= 0x303F) || // 中日韩标点
+		(r >= 0xFF00 && r <= 0xFFEF) // 全角字符
+}
+
+// Budget 提示词预算：模型上下文长度减去给输出预留的token数
+type Budget struct {
+	ContextTokens     int // 模型上下文长度，<=0 时不检查
+	CompletionReserve int // 给输出预留的token数
+}
+
+// Limit 提示词允许的最大token数，不检查时返回 0
+func (b Budget) Limit() int {
+	if b.ContextTokens <= 0 {
+		return 0
+	}
+	return max(b.ContextTokens-b.CompletionReserve, 0)
+}
+
+// Check 估算提示词的token数，超过预算时返回包装了 ErrPromptTooLarge 的错误
+func (b Budget) Check(prompts ...string) (int, error) {
+	estimate := 0
+	for _, prompt := range prompts {
+		estimate += Estimate(prompt)
+	}
+	if b.ContextTokens > 0 && estimate > b.Limit() {
+		return estimate, fmt.Errorf("%w: 估算 %d tokens，上限 %d（上下文 %d - 输出预留 %d）",
+			ErrPromptTooLarge, estimate, b.Limit(), b.ContextTokens, b.CompletionReserve)
+	}
+	return estimate, nil
+}
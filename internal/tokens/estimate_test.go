@@ -0,0 +1,40 @@
+package tokens
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"职业分类", 4},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"编码：1-01", 3 + 1},
+		{"编码：1-01.02", 3 + 2},
+	} {
+		if got := Estimate(tc.text); got != tc.want {
+			t.Errorf("Estimate(%q) = %d, want %d", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestBudgetCheck(t *testing.T) {
+	budget := Budget{ContextTokens: 10, CompletionReserve: 4}
+
+	if estimate, err := budget.Check("职业", "分类"); err != nil || estimate != 4 {
+		t.Errorf("Check = %d, %v, want 4, nil", estimate, err)
+	}
+	estimate, err := budget.Check(strings.Repeat("职", 7))
+	if !errors.Is(err, ErrPromptTooLarge) || estimate != 7 {
+		t.Errorf("Check = %d, %v, want ErrPromptTooLarge", estimate, err)
+	}
+	if _, err := (Budget{}).Check(strings.Repeat("职", 1000)); err != nil {
+		t.Errorf("零值预算不应检查, got %v", err)
+	}
+}
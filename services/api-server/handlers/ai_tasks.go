@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+// GetAITasks 获取混合解析器为任务生成的AI任务（小类编码及其细类原始编码和名称）和解析统计
+func (h *Handlers) GetAITasks(c *gin.Context) {
+	taskID := c.Query("task_id")
+	if taskID == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id 参数", nil)
+		return
+	}
+
+	result, err := h.db.GetHybridParseResult(c.Request.Context(), taskID)
+	if err != nil {
+		if errors.Is(err, database.ErrHybridParseResultNotFound) {
+			respondError(c, http.StatusNotFound, ErrCodeNotFound, "该任务没有混合解析结果", nil)
+			return
+		}
+		log.Printf("获取任务 %s 的混合解析结果失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取混合解析结果失败", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetAITasks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	taskID := "5d7f9b1d-3e5a-4b7c-9d1f-3b5d7f9b1c3e"
+	record := &database.HybridParseResult{
+		TaskID:      taskID,
+		AITaskCount: 1,
+		AITasks:     []byte(`[{"parent_code":"3-02-01","parent_name":"农作物生产人员","detail_codes_raw":["3-02-01-01"],"detail_names_raw":["农艺工"]}]`),
+		Stats:       []byte(`{"total_rows":10,"skeleton_count":3,"ai_task_count":1,"warning_count":0,"processing_time":5}`),
+	}
+	if err := db.SaveHybridParseResult(ctx, record); err != nil {
+		t.Fatalf("保存混合解析结果失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/data/ai-tasks", h.GetAITasks)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/data/ai-tasks?"+query, nil))
+		return w
+	}
+
+	w := get("task_id=" + taskID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		TaskID      string                 `json:"task_id"`
+		AITaskCount int                    `json:"ai_task_count"`
+		AITasks     []*model.AITask        `json:"ai_tasks"`
+		Stats       model.HybridParseStats `json:"stats"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response %q: %v", w.Body.String(), err)
+	}
+	if resp.TaskID != taskID || resp.AITaskCount != 1 || len(resp.AITasks) != 1 || resp.AITasks[0].ParentCode != "3-02-01" {
+		t.Errorf("Unexpected AI tasks: %s", w.Body.String())
+	}
+	if resp.Stats.SkeletonCount != 3 || resp.Stats.TotalRows != 10 {
+		t.Errorf("Expected parse stats in response, got %+v", resp.Stats)
+	}
+
+	if w := get("task_id=6e8a0c2e-4f6b-4c8d-8e0a-4c6e8a0c2d4f"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for task without hybrid parse result, got %d", w.Code)
+	}
+	if w := get(""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without task_id, got %d", w.Code)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/freedkr/moonshot/internal/audit"
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志的分页大小
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// recordAudit 记录当前请求的写操作，操作人取自请求头
+func (h *Handlers) recordAudit(c *gin.Context, action, entity, entityID string, details interface{}) {
+	h.audit.Record(c.Request.Context(), action, entity, entityID, audit.ActorFromRequest(c.Request), details)
+}
+
+// GetAuditLog 按时间倒序查看审计日志，task_id 为空时返回全部任务的操作
+func (h *Handlers) GetAuditLog(c *gin.Context) {
+	taskID := c.Query("task_id")
+	limit := defaultAuditPageSize
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= maxAuditPageSize {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	entries, total, err := h.db.ListAuditLogs(c.Request.Context(), taskID, limit, offset)
+	if err != nil {
+		log.Printf("获取审计日志失败 - TaskID=%s, Error=%v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取审计日志失败", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":     taskID,
+		"entries":     entries,
+		"total_count": total,
+		"limit":       limit,
+		"offset":      offset,
+		"has_more":    int64(offset+len(entries)) < total,
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/audit"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuditLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	taskID := "3b5d7f9b-1c3e-4a5c-9e7a-9b1d3f5a7c9e"
+	otherTaskID := "5d7f9b1d-3e5a-4c7e-8a9c-1d3f5b7d9f1b"
+	categories := []*database.Category{
+		{TaskID: taskID, Code: "1-01-01-01", Name: "焊工", Level: "细类", Status: database.StatusCompleted},
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, "7f9b1d3f-5a7c-4e9a-8c1e-3f5b7d9f1a3c", categories); err != nil {
+		t.Fatalf("插入分类失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/data/categories/bulk-update", h.BulkUpdateCategories)
+	router.DELETE("/api/v1/tasks/:id", h.DeleteTask)
+	router.GET("/api/v1/audit", h.GetAuditLog)
+
+	body, _ := json.Marshal(gin.H{"task_id": taskID, "edits": []gin.H{{"code": "1-01-01-01", "name": "电焊工"}}})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/data/categories/bulk-update", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(audit.ActorHeader, "reviewer-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/v1/tasks/"+taskID, nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/v1/tasks/"+otherTaskID, nil))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/audit?task_id="+taskID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	var resp struct {
+		Entries []database.AuditLog `json:"entries"`
+		Total   int64               `json:"total_count"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Total != 2 || len(resp.Entries) != 2 {
+		t.Fatalf("Expected 2 entries for the task, got %+v", resp.Entries)
+	}
+	// 按时间倒序
+	deleted, updated := resp.Entries[0], resp.Entries[1]
+	if deleted.Action != audit.ActionTaskDelete || deleted.Actor != audit.AnonymousActor || string(deleted.Details) != `{"deleted":false}` {
+		t.Errorf("Unexpected delete entry: %+v", deleted)
+	}
+	if updated.Action != audit.ActionCategoryBulkUpdate || updated.Actor != "reviewer-1" || updated.Entity != audit.EntityCategories {
+		t.Errorf("Unexpected bulk update entry: %+v", updated)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/audit", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Total != 3 {
+		t.Errorf("Expected 3 entries in total, got %d", resp.Total)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/freedkr/moonshot/internal/builder"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// maxBuildRecords 单次构建请求允许的最大记录数
+const maxBuildRecords = 100000
+
+// BuildRecord 构建请求中的一条原始记录，level 可选，提供时校验是否与编码推导的级别一致
+type BuildRecord struct {
+	Code    string `json:"code"`
+	GbmCode string `json:"gbm_code,omitempty"`
+	Name    string `json:"name"`
+	Level   string `json:"level,omitempty"`
+}
+
+// BuildHierarchy 根据请求中的原始记录构建层级结构，返回层级树、统计信息和校验错误
+// 请求体为记录数组，构建选项通过查询参数指定：orphan_handling、strict、create_missing_parents、sort_by、sort_order。
+// 接口无状态，不读写数据库和队列，相同输入总是得到相同结果
+func (h *Handlers) BuildHierarchy(c *gin.Context) {
+	config, options, err := parseBuildOptions(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+
+	var records []BuildRecord
+	if err := c.ShouldBindJSON(&records); err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "请求体必须是记录数组", err.Error())
+		return
+	}
+	if len(records) == 0 {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "记录不能为空", nil)
+		return
+	}
+	if len(records) > maxBuildRecords {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "记录数超过上限", gin.H{"max_records": maxBuildRecords})
+		return
+	}
+
+	parsed := make([]*model.ParsedInfo, 0, len(records))
+	for i, record := range records {
+		if record.Code == "" {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "记录缺少编码", gin.H{"index": i})
+			return
+		}
+		parsed = append(parsed, &model.ParsedInfo{Code: record.Code, GbmCode: record.GbmCode, Name: record.Name, RowIndex: i})
+	}
+
+	hierarchyBuilder := builder.NewHierarchyBuilder(config)
+	categories, err := hierarchyBuilder.BuildWithOptions(c.Request.Context(), parsed, options)
+	if err != nil {
+		var hierarchyErr *model.HierarchyError
+		if errors.As(err, &hierarchyErr) {
+			respondError(c, http.StatusUnprocessableEntity, ErrCodeInvalidRequest, "严格模式下发现孤儿节点",
+				gin.H{"code": hierarchyErr.Code1, "parent_code": hierarchyErr.Code2})
+			return
+		}
+		log.Printf("构建层级失败: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "构建层级失败", nil)
+		return
+	}
+
+	validationErrors := make([]string, 0)
+	if errorList := hierarchyBuilder.Validate(categories); errorList != nil {
+		for _, validationErr := range errorList.Errors {
+			validationErrors = append(validationErrors, validationErr.Error())
+		}
+	}
+	validationErrors = append(validationErrors, levelMismatches(records, categories)...)
+
+	c.JSON(http.StatusOK, gin.H{
+		"categories": categories,
+		"statistics": hierarchyBuilder.GetStatistics(categories),
+		"errors":     validationErrors,
+	})
+}
+
+// parseBuildOptions 从查询参数解析构建选项，默认处理孤儿节点、非严格模式、按编码升序
+func parseBuildOptions(c *gin.Context) (*builder.BuilderConfig, *builder.BuildOptions, error) {
+	config := &builder.BuilderConfig{EnableOrphanHandling: true}
+	options := &builder.BuildOptions{SortBy: builder.SortByCode, SortOrder: builder.OrderAsc}
+
+	boolParams := []struct {
+		name   string
+		target *bool
+	}{
+		{"orphan_handling", &config.EnableOrphanHandling},
+		{"strict", &config.StrictMode},
+		{"create_missing_parents", &options.CreateMissingParents},
+	}
+	for _, param := range boolParams {
+		if v := c.Query(param.name); v != "" {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s 必须是布尔值", param.name)
+			}
+			*param.target = parsed
+		}
+	}
+
+	switch sortBy := builder.SortField(c.DefaultQuery("sort_by", string(builder.SortByCode))); sortBy {
+	case builder.SortByCode, builder.SortByName:
+		options.SortBy = sortBy
+	default:
+		return nil, nil, errors.New("sort_by 只支持 code 或 name")
+	}
+	switch sortOrder := builder.SortOrder(c.DefaultQuery("sort_order", string(builder.OrderAsc))); sortOrder {
+	case builder.OrderAsc, builder.OrderDesc:
+		options.SortOrder = sortOrder
+	default:
+		return nil, nil, errors.New("sort_order 只支持 asc 或 desc")
+	}
+	return config, options, nil
+}
+
+// levelMismatches 找出请求中声明的级别与编码推导级别不一致的记录
+func levelMismatches(records []BuildRecord, categories []*model.Category) []string {
+	levels := make(map[string]string)
+	var collect func([]*model.Category)
+	collect = func(nodes []*model.Category) {
+		for _, node := range nodes {
+			levels[node.Code] = node.Level
+			collect(node.Children)
+		}
+	}
+	collect(categories)
+
+	mismatches := make([]string, 0)
+	for _, record := range records {
+		level, ok := levels[record.Code]
+		if record.Level == "" || !ok || record.Level == level {
+			continue
+		}
+		message := fmt.Sprintf("编码 %s 推导的级别为 %s", record.Code, level)
+		mismatches = append(mismatches, model.NewValidationError("level", record.Level, "level_mismatch", message).Error())
+	}
+	return mismatches
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+func TestBuildHierarchy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := NewHandlers(nil, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/build", h.BuildHierarchy)
+	post := func(query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/build?"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	records := `[
+		{"code": "1", "name": "大类一", "level": "大类"},
+		{"code": "1-02", "name": "中类B", "level": "中类"},
+		{"code": "1-01", "name": "中类A", "level": "小类"},
+		{"code": "2-01-01", "name": "缺少父级的小类"}
+	]`
+
+	var body struct {
+		Categories []*model.Category      `json:"categories"`
+		Statistics map[string]interface{} `json:"statistics"`
+		Errors     []string               `json:"errors"`
+	}
+	w := post("sort_order=desc", records)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	// 孤儿节点默认作为根节点，按编码降序排列
+	if len(body.Categories) != 2 || body.Categories[0].Code != "2-01-01" {
+		t.Fatalf("Expected orphan kept as root in descending order, got %+v", body.Categories)
+	}
+	if children := body.Categories[1].Children; len(children) != 2 || children[0].Code != "1-02" {
+		t.Errorf("Expected children of '1' in descending order, got %+v", children)
+	}
+	if total := body.Statistics["total_nodes"]; total != float64(4) {
+		t.Errorf("Expected 4 nodes in statistics, got %v", total)
+	}
+	if len(body.Errors) != 1 || !strings.Contains(body.Errors[0], "1-01") {
+		t.Errorf("Expected one level mismatch for '1-01', got %v", body.Errors)
+	}
+
+	// 补全缺失的父节点后只剩两个根节点
+	w = post("create_missing_parents=true", records)
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(body.Categories) != 2 || body.Categories[1].Code != "2" || !body.Categories[1].Synthesized {
+		t.Errorf("Expected synthesized root '2', got %+v", body.Categories)
+	}
+
+	// 严格模式下孤儿节点导致构建失败
+	if w := post("orphan_handling=false&strict=true", records); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 in strict mode, got %d", w.Code)
+	}
+
+	for _, tc := range []struct{ query, body string }{
+		{"", `{"code": "1"}`},
+		{"", `[]`},
+		{"", `[{"name": "缺少编码"}]`},
+		{"sort_by=level", records},
+		{"strict=maybe", records},
+	} {
+		if w := post(tc.query, tc.body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for query=%q body=%s, got %d", tc.query, tc.body, w.Code)
+		}
+	}
+}
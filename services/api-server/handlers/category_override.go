@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/audit"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+// SetCategoryOverrideRequest 人工修正分类名称的请求
+type SetCategoryOverrideRequest struct {
+	TaskID string `json:"task_id" binding:"required"`
+	Code   string `json:"code" binding:"required"`
+	Name   string `json:"name" binding:"required"`
+	Reason string `json:"reason"`
+}
+
+// SetCategoryOverride 保存人工审核后指定的分类名称并立即应用到当前版本
+// 修正按 (task_id, code) 持久化，任务重新处理时在最终更新中重新应用，LLM结果不会覆盖
+func (h *Handlers) SetCategoryOverride(c *gin.Context) {
+	var req SetCategoryOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "名称不能为空", nil)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := h.db.GetCategoryByCode(ctx, req.TaskID, "", req.Code); err != nil {
+		if errors.Is(err, database.ErrCategoryNotFound) {
+			respondError(c, http.StatusNotFound, ErrCodeNotFound, "分类不存在", gin.H{"task_id": req.TaskID, "code": req.Code})
+			return
+		}
+		log.Printf("获取任务 %s 的分类 %s 失败: %v", req.TaskID, req.Code, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取分类失败", nil)
+		return
+	}
+
+	override := &database.CategoryOverride{TaskID: req.TaskID, Code: req.Code, Name: req.Name, Reason: req.Reason}
+	if err := h.db.SaveCategoryOverride(ctx, override); err != nil {
+		log.Printf("保存人工修正失败 - TaskID=%s, Code=%s, Error=%v", req.TaskID, req.Code, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "保存人工修正失败", nil)
+		return
+	}
+	if _, err := h.db.ApplyCategoryOverrides(ctx, req.TaskID); err != nil {
+		log.Printf("应用人工修正失败 - TaskID=%s, Code=%s, Error=%v", req.TaskID, req.Code, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "应用人工修正失败", nil)
+		return
+	}
+	h.structuredCache.invalidateTask(req.TaskID)
+	h.recordAudit(c, audit.ActionCategoryOverride, audit.EntityCategories, req.TaskID, gin.H{
+		"code": req.Code, "name": req.Name, "reason": req.Reason,
+	})
+
+	category, err := h.db.GetCategoryByCode(ctx, req.TaskID, "", req.Code)
+	if err != nil {
+		log.Printf("获取任务 %s 的分类 %s 失败: %v", req.TaskID, req.Code, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取分类失败", nil)
+		return
+	}
+	log.Printf("人工修正分类名称 - TaskID=%s, Code=%s, Name=%s", req.TaskID, req.Code, req.Name)
+	c.JSON(http.StatusOK, buildCategoryDetail(category))
+}
+
+// maxBulkCategoryEdits 单次批量修正的最大条数
+const maxBulkCategoryEdits = 500
+
+// BulkCategoryEdit 批量修正中的一项
+type BulkCategoryEdit struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+	// UpdatedAt 客户端读取到的分类 updated_at，非空时分类已被修改则该项失败
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// BulkUpdateCategoriesRequest 批量人工修正分类名称的请求
+type BulkUpdateCategoriesRequest struct {
+	TaskID string             `json:"task_id" binding:"required"`
+	Edits  []BulkCategoryEdit `json:"edits" binding:"required"`
+}
+
+// BulkCategoryEditResult 批量修正中单项的结果
+type BulkCategoryEditResult struct {
+	Code    string    `json:"code"`
+	Name    string    `json:"name"`
+	Success bool      `json:"success"`
+	Error   *APIError `json:"error,omitempty"`
+}
+
+// BulkUpdateCategories 批量保存人工修正的分类名称，逐项返回成功或失败
+// 全部有效项在一个事务中写入修正并应用到当前版本；编码不存在、名称为空或分类已被并发修改的项失败，不影响其他项
+func (h *Handlers) BulkUpdateCategories(c *gin.Context) {
+	var req BulkUpdateCategoriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+	if len(req.Edits) == 0 {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "edits 不能为空", nil)
+		return
+	}
+	if len(req.Edits) > maxBulkCategoryEdits {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("一次最多修正 %d 条", maxBulkCategoryEdits), gin.H{"max_edits": maxBulkCategoryEdits})
+		return
+	}
+
+	results := make([]BulkCategoryEditResult, len(req.Edits))
+	var edits []database.OverrideEdit
+	var editIndexes []int
+	seen := make(map[string]bool, len(req.Edits))
+	for i, edit := range req.Edits {
+		name := strings.TrimSpace(edit.Name)
+		results[i] = BulkCategoryEditResult{Code: edit.Code, Name: name}
+		switch {
+		case edit.Code == "" || name == "":
+			results[i].Error = &APIError{Code: ErrCodeInvalidRequest, Message: "code 和 name 不能为空"}
+		case seen[edit.Code]:
+			results[i].Error = &APIError{Code: ErrCodeInvalidRequest, Message: "同一编码在请求中重复"}
+		default:
+			seen[edit.Code] = true
+			edits = append(edits, database.OverrideEdit{
+				Override:          &database.CategoryOverride{Code: edit.Code, Name: name, Reason: edit.Reason},
+				ExpectedUpdatedAt: edit.UpdatedAt,
+			})
+			editIndexes = append(editIndexes, i)
+		}
+	}
+
+	ctx := c.Request.Context()
+	if len(edits) > 0 {
+		editErrs, err := h.db.ApplyOverrideEdits(ctx, req.TaskID, edits)
+		if err != nil {
+			log.Printf("批量人工修正失败 - TaskID=%s, Error=%v", req.TaskID, err)
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "批量修正失败", nil)
+			return
+		}
+		for j, editErr := range editErrs {
+			result := &results[editIndexes[j]]
+			switch {
+			case editErr == nil:
+				result.Success = true
+			case errors.Is(editErr, database.ErrCategoryNotFound):
+				result.Error = &APIError{Code: ErrCodeNotFound, Message: "分类不存在"}
+			case errors.Is(editErr, database.ErrCategoryModified):
+				result.Error = &APIError{Code: ErrCodeConflict, Message: "分类已被修改，请刷新后重试"}
+			default:
+				result.Error = &APIError{Code: ErrCodeInternal, Message: editErr.Error()}
+			}
+		}
+	}
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+		}
+	}
+	if succeeded > 0 {
+		h.structuredCache.invalidateTask(req.TaskID)
+		h.recordAudit(c, audit.ActionCategoryBulkUpdate, audit.EntityCategories, req.TaskID, gin.H{
+			"succeeded": succeeded,
+			"failed":    len(results) - succeeded,
+			"results":   results,
+		})
+	}
+	log.Printf("批量人工修正 - TaskID=%s, 成功=%d/%d", req.TaskID, succeeded, len(results))
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":   req.TaskID,
+		"total":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	})
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetCategoryOverride(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	taskID := "6e8a0c2e-4f6b-4d8a-8b0c-2e4f6a8c0d2e"
+	categories := []*database.Category{
+		{TaskID: taskID, Code: "1-01-01-01", Name: "焊接工", Level: "细类", Status: database.StatusCompleted,
+			LLMEnhancements: `{"code":"1-01-01-01","name":"焊接工","rule_name":"焊工"}`},
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, "0c2e4a6c-8d0f-4b2c-9d4e-6a8c0e2a4b6d", categories); err != nil {
+		t.Fatalf("插入分类失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.PUT("/api/v1/data/category", h.SetCategoryOverride)
+	router.GET("/api/v1/data/review", h.GetReviewNodes)
+	put := func(body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/data/category", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := put(gin.H{"task_id": taskID, "code": "1-01-01-01", "name": "  "}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for blank name, got %d", w.Code)
+	}
+	if w := put(gin.H{"task_id": taskID, "code": "9-99", "name": "不存在"}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown code, got %d", w.Code)
+	}
+
+	// 重复修正以最后一次为准
+	for _, name := range []string{"电焊工", "焊工（电焊）"} {
+		w := put(gin.H{"task_id": taskID, "code": "1-01-01-01", "name": name, "reason": "审核修正"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var detail CategoryDetail
+		if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		if detail.Name != name {
+			t.Errorf("Expected name %s, got %s", name, detail.Name)
+		}
+		marker, ok := detail.LLMEnhancements[database.ManualOverrideKey].(map[string]interface{})
+		if !ok || marker["previous_name"] != "焊接工" {
+			t.Errorf("Expected manual_override marker keeping the pipeline name, got %v", detail.LLMEnhancements)
+		}
+	}
+
+	overrides, err := db.GetCategoryOverrides(ctx, taskID)
+	if err != nil {
+		t.Fatalf("获取人工修正失败: %v", err)
+	}
+	if len(overrides) != 1 || overrides[0].Name != "焊工（电焊）" {
+		t.Errorf("Expected a single override, got %+v", overrides)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/data/review?task_id="+taskID, nil))
+	var review struct {
+		Nodes []ReviewNode `json:"nodes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &review); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(review.Nodes) != 1 || !review.Nodes[0].Overridden || review.Nodes[0].RuleName != "焊工" || !review.Nodes[0].Changed {
+		t.Errorf("Unexpected review nodes: %+v", review.Nodes)
+	}
+}
+
+func TestBulkUpdateCategories(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	taskID := "8a0c2e4a-6b8d-4e0a-9c2e-4a6b8d0e2f4a"
+	categories := []*database.Category{
+		{TaskID: taskID, Code: "1-01-01-01", Name: "焊接工", Level: "细类", Status: database.StatusCompleted},
+		{TaskID: taskID, Code: "1-01-01-02", Name: "钳工", Level: "细类", Status: database.StatusCompleted},
+		{TaskID: taskID, Code: "1-01-01-03", Name: "车工", Level: "细类", Status: database.StatusCompleted},
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, "2e4a6c8e-0f2b-4d4e-8f6a-8c0e2a4c6e8f", categories); err != nil {
+		t.Fatalf("插入分类失败: %v", err)
+	}
+	current, err := db.GetCurrentCategoriesByCodes(ctx, taskID, []string{"1-01-01-01", "1-01-01-03"})
+	if err != nil {
+		t.Fatalf("获取分类失败: %v", err)
+	}
+	seenAt := current["1-01-01-01"].UpdatedAt
+	staleAt := current["1-01-01-03"].UpdatedAt.Add(-time.Second)
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/data/categories/bulk-update", h.BulkUpdateCategories)
+	post := func(body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/data/categories/bulk-update", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(gin.H{"task_id": taskID, "edits": []gin.H{}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for empty edits, got %d", w.Code)
+	}
+
+	w := post(gin.H{"task_id": taskID, "edits": []gin.H{
+		{"code": "1-01-01-01", "name": "电焊工", "updated_at": seenAt},
+		{"code": "1-01-01-02", "name": "钳工（装配）"},
+		{"code": "1-01-01-03", "name": "车床工", "updated_at": staleAt},
+		{"code": "9-99-99-99", "name": "不存在"},
+		{"code": "1-01-01-02", "name": "重复"},
+		{"code": "1-01-01-04", "name": " "},
+	}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Succeeded int                      `json:"succeeded"`
+		Failed    int                      `json:"failed"`
+		Results   []BulkCategoryEditResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Succeeded != 2 || resp.Failed != 4 || len(resp.Results) != 6 {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+	expectedErrors := []string{"", "", ErrCodeConflict, ErrCodeNotFound, ErrCodeInvalidRequest, ErrCodeInvalidRequest}
+	for i, result := range resp.Results {
+		code := ""
+		if result.Error != nil {
+			code = result.Error.Code
+		}
+		if code != expectedErrors[i] || result.Success != (code == "") {
+			t.Errorf("result %d: expected error %q, got %+v", i, expectedErrors[i], result)
+		}
+	}
+
+	after, err := db.GetCurrentCategoriesByCodes(ctx, taskID, []string{"1-01-01-01", "1-01-01-02", "1-01-01-03"})
+	if err != nil {
+		t.Fatalf("获取分类失败: %v", err)
+	}
+	if after["1-01-01-01"].Name != "电焊工" || after["1-01-01-02"].Name != "钳工（装配）" || after["1-01-01-03"].Name != "车工" {
+		t.Errorf("Unexpected names: %s, %s, %s", after["1-01-01-01"].Name, after["1-01-01-02"].Name, after["1-01-01-03"].Name)
+	}
+	overrides, err := db.GetCategoryOverrides(ctx, taskID)
+	if err != nil {
+		t.Fatalf("获取人工修正失败: %v", err)
+	}
+	if len(overrides) != 2 {
+		t.Errorf("Expected 2 overrides, got %+v", overrides)
+	}
+
+	// 使用修正前读取的 updated_at 再次提交时检测到并发修改
+	w = post(gin.H{"task_id": taskID, "edits": []gin.H{{"code": "1-01-01-01", "name": "气焊工", "updated_at": seenAt}}})
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Succeeded != 0 || resp.Results[0].Error == nil || resp.Results[0].Error.Code != ErrCodeConflict {
+		t.Errorf("Expected conflict for stale updated_at, got %+v", resp.Results)
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// 名称搜索的分页大小
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+// CategoryPathNode 编码路径上的一个分类
+type CategoryPathNode struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// CategorySearchResult 名称搜索结果，Path 为从根节点到该分类（含自身）的编码路径
+type CategorySearchResult struct {
+	model.FlatCategory
+	Path []CategoryPathNode `json:"path"`
+}
+
+// SearchCategories 按名称搜索任务当前版本的分类（不区分大小写的子串匹配），供前端自动补全使用
+// 名称以搜索词开头的排在前面；limit 默认20、最大100，offset 用于翻页
+func (h *Handlers) SearchCategories(c *gin.Context) {
+	taskID := c.Query("task_id")
+	q := strings.TrimSpace(c.Query("q"))
+	if taskID == "" || q == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id 或 q 参数", nil)
+		return
+	}
+
+	limit := defaultSearchPageSize
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= maxSearchPageSize {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	ctx := c.Request.Context()
+	dbCategories, total, err := h.db.SearchCurrentCategories(ctx, taskID, q, limit, offset)
+	if err != nil {
+		log.Printf("搜索任务 %s 的分类失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "搜索分类失败", nil)
+		return
+	}
+
+	flatCategories, err := h.toFlatCategories(ctx, taskID, "", dbCategories)
+	if err != nil {
+		log.Printf("获取任务 %s 的子节点信息失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "搜索分类失败", nil)
+		return
+	}
+	paths, err := h.categoryPaths(ctx, taskID, dbCategories)
+	if err != nil {
+		log.Printf("获取任务 %s 的编码路径失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "搜索分类失败", nil)
+		return
+	}
+
+	results := make([]CategorySearchResult, len(flatCategories))
+	for i, flat := range flatCategories {
+		results[i] = CategorySearchResult{FlatCategory: flat, Path: paths[i]}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":     taskID,
+		"query":       q,
+		"results":     results,
+		"total_count": total,
+		"limit":       limit,
+		"offset":      offset,
+		"has_more":    int64(offset+len(results)) < total,
+	})
+}
+
+// categoryPaths 计算每个分类从根节点到自身的编码路径，每一层祖先一次批量查询
+// 父节点不在当前版本中时路径从最近的已知祖先开始
+func (h *Handlers) categoryPaths(ctx context.Context, taskID string, categories []*database.Category) ([][]CategoryPathNode, error) {
+	known := make(map[string]*database.Category, len(categories))
+	for _, category := range categories {
+		known[category.Code] = category
+	}
+
+	pending := make([]string, 0, len(categories))
+	for _, category := range categories {
+		pending = append(pending, category.ParentCode)
+	}
+	for len(pending) > 0 {
+		var missing []string
+		seen := make(map[string]bool)
+		for _, code := range pending {
+			if code == "" || seen[code] || known[code] != nil {
+				continue
+			}
+			seen[code] = true
+			missing = append(missing, code)
+		}
+		if len(missing) == 0 {
+			break
+		}
+		found, err := h.db.GetCurrentCategoriesByCodes(ctx, taskID, missing)
+		if err != nil {
+			return nil, err
+		}
+		pending = pending[:0]
+		for _, category := range found {
+			known[category.Code] = category
+			pending = append(pending, category.ParentCode)
+		}
+	}
+
+	paths := make([][]CategoryPathNode, len(categories))
+	for i, category := range categories {
+		var path []CategoryPathNode
+		visited := make(map[string]bool)
+		for node := category; node != nil && !visited[node.Code]; node = known[node.ParentCode] {
+			visited[node.Code] = true
+			path = append([]CategoryPathNode{{Code: node.Code, Name: node.Name}}, path...)
+		}
+		paths[i] = path
+	}
+	return paths, nil
+}
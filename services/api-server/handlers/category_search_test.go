@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSearchCategories(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	taskID := "7a9c1e3a-5b7d-4f9a-8c1e-3a5b7d9f1a3c"
+	categories := []*database.Category{
+		{TaskID: taskID, Code: "6", Name: "生产制造及有关人员", Level: "大类", Status: database.StatusCompleted},
+		{TaskID: taskID, Code: "6-01", Name: "焊接人员", Level: "中类", ParentCode: "6", Status: database.StatusCompleted},
+		{TaskID: taskID, Code: "6-01-01", Name: "焊工", Level: "小类", ParentCode: "6-01", Status: database.StatusCompleted},
+		{TaskID: taskID, Code: "6-01-02", Name: "电焊工", Level: "小类", ParentCode: "6-01", Status: database.StatusCompleted},
+		{TaskID: taskID, Code: "6-01-03", Name: "CNC_Operator", Level: "小类", ParentCode: "6-01", Status: database.StatusCompleted},
+		{TaskID: taskID, Code: "6-01-04", Name: "CNCXOperator", Level: "小类", ParentCode: "6-01", Status: database.StatusCompleted},
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, "9c1e3a5c-7d9f-4b1c-9e3a-5c7d9f1b3c5e", categories); err != nil {
+		t.Fatalf("插入分类失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/data/search", h.SearchCategories)
+	type searchResponse struct {
+		Results []CategorySearchResult `json:"results"`
+		Total   int64                  `json:"total_count"`
+		HasMore bool                   `json:"has_more"`
+	}
+	search := func(params url.Values) (int, searchResponse) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/data/search?"+params.Encode(), nil))
+		var resp searchResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	if code, _ := search(url.Values{"task_id": {taskID}, "q": {" "}}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for empty query, got %d", code)
+	}
+
+	// 名称以搜索词开头的排在前面，其余按编码排序
+	code, resp := search(url.Values{"task_id": {taskID}, "q": {"焊"}})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	var names []string
+	for _, r := range resp.Results {
+		names = append(names, r.Name)
+	}
+	if resp.Total != 3 || len(names) != 3 || names[0] != "焊接人员" || names[1] != "焊工" || names[2] != "电焊工" {
+		t.Errorf("Unexpected results: %v (total %d)", names, resp.Total)
+	}
+	if !resp.Results[0].HasChildren || resp.Results[1].HasChildren {
+		t.Errorf("Unexpected has_children: %+v", resp.Results[:2])
+	}
+	path := resp.Results[1].Path
+	if len(path) != 3 || path[0].Code != "6" || path[1].Code != "6-01" || path[2].Name != "焊工" {
+		t.Errorf("Unexpected path for 焊工: %+v", path)
+	}
+
+	// 不区分大小写，通配符按字面匹配
+	if _, resp := search(url.Values{"task_id": {taskID}, "q": {"cnc_op"}}); resp.Total != 1 || resp.Results[0].Code != "6-01-03" {
+		t.Errorf("Expected literal underscore match only, got %+v", resp)
+	}
+
+	// 分页
+	_, resp = search(url.Values{"task_id": {taskID}, "q": {"焊"}, "limit": {"2"}, "offset": {"2"}})
+	if len(resp.Results) != 1 || resp.Results[0].Code != "6-01-02" || resp.HasMore {
+		t.Errorf("Unexpected second page: %+v", resp)
+	}
+	_, resp = search(url.Values{"task_id": {taskID}, "q": {"焊"}, "limit": {"2"}})
+	if len(resp.Results) != 2 || !resp.HasMore {
+		t.Errorf("Expected has_more on first page, got %+v", resp)
+	}
+}
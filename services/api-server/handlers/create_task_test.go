@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+func TestCreateTask_RejectsUnsupportedType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// 请求在访问数据库和队列之前被拒绝
+	h := NewHandlers(nil, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/tasks", h.CreateTask)
+
+	for name, body := range map[string]string{
+		"ai":      `{"type":"ai"}`,
+		"unknown": `{"type":"ocr"}`,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body)))
+		var resp ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: 解析响应失败: %v", name, err)
+		}
+		if w.Code != http.StatusBadRequest || resp.Error.Code != ErrCodeInvalidRequest {
+			t.Errorf("%s: expected 400 %s, got %d %s", name, ErrCodeInvalidRequest, w.Code, resp.Error.Code)
+		}
+	}
+}
+
+func TestCreateTask_RejectsInvalidMaxRows(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers(nil, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/tasks", h.CreateTask)
+
+	for _, maxRows := range []string{`-1`, `1.5`, `"abc"`, `true`} {
+		body := `{"type":"rule","config":{"max_rows":` + maxRows + `}}`
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("max_rows=%s: expected 400, got %d %s", maxRows, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestParseMaxRows(t *testing.T) {
+	for value, expected := range map[interface{}]int{float64(0): 0, float64(500): 500, "0": 0, "500": 500} {
+		got, err := parseMaxRows(value)
+		if err != nil || got != expected {
+			t.Errorf("parseMaxRows(%v) = %d, %v; expected %d", value, got, err, expected)
+		}
+	}
+	for _, value := range []interface{}{float64(-1), 2.5, "-3", "abc", "", nil, true} {
+		if _, err := parseMaxRows(value); err == nil {
+			t.Errorf("parseMaxRows(%v) expected error", value)
+		}
+	}
+}
+
+func TestCreateTask_RejectsInvalidFlowOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers(nil, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/tasks", h.CreateTask)
+
+	for _, config := range []string{`{"skip_pdf":"maybe"}`, `{"skip_pdf":1}`, `{"enrichment":"pdf"}`, `{"enrichment":true}`, `{"force_pdf":"maybe"}`, `{"force_pdf":0}`} {
+		body := `{"type":"rule","config":` + config + `}`
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("config=%s: expected 400, got %d %s", config, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestCreateTask_CountsRunningFlowsTowardActiveLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	// 规则步骤已完成、后台增量流程仍在运行的任务
+	started := time.Now()
+	task := &database.TaskRecord{ID: "3c5e7a9b-1d3f-4a5c-8e7a-9b1d3f5a7c9e", Type: "rule", Status: "completed", Config: datatypes.JSON(`{}`), FlowStartedAt: &started}
+	if err := db.CreateTask(ctx, task); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	h.SetMaxActiveTasks(1)
+	router := gin.New()
+	router.POST("/api/v1/tasks", h.CreateTask)
+	router.POST("/api/v1/tasks/import", h.ImportTaskBundle)
+
+	for _, path := range []string{"/api/v1/tasks", "/api/v1/tasks/import"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"type":"rule"}`)))
+		var resp ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: 解析响应失败: %v", path, err)
+		}
+		if w.Code != http.StatusTooManyRequests || resp.Error.Code != ErrCodeQueueFull {
+			t.Errorf("%s: expected 429 %s, got %d %s", path, ErrCodeQueueFull, w.Code, w.Body.String())
+		}
+	}
+}
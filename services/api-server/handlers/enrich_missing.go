@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/freedkr/moonshot/internal/audit"
+	"github.com/freedkr/moonshot/internal/integration"
+	"github.com/gin-gonic/gin"
+)
+
+// MissingEnricher 对缺少LLM增强信息的分类补充执行语义选择，由 integration.IncrementalProcessor 实现
+type MissingEnricher interface {
+	EnrichMissing(ctx context.Context, taskID string) (*integration.EnrichMissingResult, error)
+}
+
+// SetMissingEnricher 设置补充增强处理器，未设置时补充增强接口返回 503
+func (h *Handlers) SetMissingEnricher(enricher MissingEnricher) {
+	h.enricher = enricher
+}
+
+// EnrichMissing 只对缺少LLM增强信息的分类重新执行第二轮语义选择，同步返回选中和成功的条数
+// 同一任务的增量流程或补充增强正在执行时返回 409
+func (h *Handlers) EnrichMissing(c *gin.Context) {
+	ctx := c.Request.Context()
+	taskID := c.Param("id")
+
+	if h.enricher == nil {
+		respondError(c, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "补充增强未启用", nil)
+		return
+	}
+
+	task, err := h.db.GetTask(ctx, taskID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, ErrCodeTaskNotFound, "任务不存在", gin.H{"task_id": taskID})
+		return
+	}
+	if task.Status != "completed" {
+		respondError(c, http.StatusConflict, ErrCodeTaskNotReady, "任务尚未完成", gin.H{"status": task.Status})
+		return
+	}
+
+	result, err := h.enricher.EnrichMissing(ctx, taskID)
+	if errors.Is(err, integration.ErrFlowInProgress) {
+		respondError(c, http.StatusConflict, ErrCodeTaskInProgress, "任务正在处理中，请稍后重试", gin.H{"task_id": taskID})
+		return
+	}
+	// 已写入的批次对结构化数据可见，失败时也需要清除缓存
+	h.structuredCache.invalidateTask(taskID)
+	auditDetails := gin.H{"succeeded": err == nil}
+	if result != nil {
+		auditDetails["selected"] = result.Selected
+		auditDetails["enriched"] = result.Enriched
+	}
+	h.recordAudit(c, audit.ActionTaskEnrichMissing, audit.EntityTask, taskID, auditDetails)
+	if err != nil {
+		log.Printf("补充增强失败 - TaskID: %s, Error: %v", taskID, err)
+		details := gin.H{"task_id": taskID}
+		if result != nil {
+			details["selected"] = result.Selected
+			details["enriched"] = result.Enriched
+		}
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "补充增强失败", details)
+		return
+	}
+
+	log.Printf("补充增强完成 - TaskID: %s, 选中=%d, 成功=%d", taskID, result.Selected, result.Enriched)
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":  taskID,
+		"selected": result.Selected,
+		"enriched": result.Enriched,
+		"failed":   result.Failed,
+	})
+}
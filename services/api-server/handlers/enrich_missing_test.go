@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/integration"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+// fakeEnricher 返回固定结果的补充增强处理器
+type fakeEnricher struct {
+	result *integration.EnrichMissingResult
+	err    error
+	calls  int
+}
+
+func (f *fakeEnricher) EnrichMissing(ctx context.Context, taskID string) (*integration.EnrichMissingResult, error) {
+	f.calls++
+	return f.result, f.err
+}
+
+func TestEnrichMissing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	for id, status := range map[string]string{"task-done": "completed", "task-running": "processing"} {
+		if err := db.CreateTask(ctx, &database.TaskRecord{ID: id, Type: "rule", Status: status, Config: datatypes.JSON(`{}`)}); err != nil {
+			t.Fatalf("创建任务失败: %v", err)
+		}
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/tasks/:id/enrich-missing", h.EnrichMissing)
+	enrich := func(taskID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tasks/"+taskID+"/enrich-missing", nil))
+		return w
+	}
+
+	if w := enrich("task-done"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without enricher, got %d", w.Code)
+	}
+
+	enricher := &fakeEnricher{result: &integration.EnrichMissingResult{Selected: 5, Enriched: 4, Failed: 1}}
+	h.SetMissingEnricher(enricher)
+
+	w := enrich("task-done")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Selected int `json:"selected"`
+		Enriched int `json:"enriched"`
+		Failed   int `json:"failed"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if body.Selected != 5 || body.Enriched != 4 || body.Failed != 1 {
+		t.Errorf("Unexpected counts: %+v", body)
+	}
+
+	cases := map[string]struct {
+		taskID string
+		err    error
+		status int
+		code   string
+	}{
+		"missing task":     {taskID: "task-missing", status: http.StatusNotFound, code: ErrCodeTaskNotFound},
+		"task not ready":   {taskID: "task-running", status: http.StatusConflict, code: ErrCodeTaskNotReady},
+		"flow in progress": {taskID: "task-done", err: integration.ErrFlowInProgress, status: http.StatusConflict, code: ErrCodeTaskInProgress},
+	}
+	for name, tc := range cases {
+		enricher.err = tc.err
+		w := enrich(tc.taskID)
+		var resp ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: 解析响应失败: %v", name, err)
+		}
+		if w.Code != tc.status || resp.Error.Code != tc.code {
+			t.Errorf("%s: expected %d %s, got %d %s", name, tc.status, tc.code, w.Code, resp.Error.Code)
+		}
+	}
+	if enricher.calls != 2 {
+		t.Errorf("Expected enricher to be called only for completed tasks, got %d calls", enricher.calls)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// 机器可读的错误码，客户端应根据错误码而不是错误信息文本判断错误类型
+const (
+	ErrCodeInvalidRequest     = "INVALID_REQUEST"     // 请求参数缺失或格式错误
+	ErrCodeUnauthorized       = "UNAUTHORIZED"        // 未携带或携带了无效的API密钥
+	ErrCodeForbidden          = "FORBIDDEN"           // 密钥没有执行该操作的权限
+	ErrCodeInvalidFile        = "INVALID_FILE"        // 上传的文件或任务包无效
+	ErrCodeFileTooLarge       = "FILE_TOO_LARGE"      // 上传文件超过大小限制
+	ErrCodeTaskNotFound       = "TASK_NOT_FOUND"      // 任务不存在
+	ErrCodeNotFound           = "NOT_FOUND"           // 文件、分类等其他资源不存在
+	ErrCodeTaskNotReady       = "TASK_NOT_READY"      // 任务尚未完成，结果不可用
+	ErrCodeTaskFinished       = "TASK_FINISHED"       // 任务已结束，无法执行该操作
+	ErrCodeTaskInProgress     = "TASK_IN_PROGRESS"    // 任务的增量处理流程正在执行
+	ErrCodeConflict           = "CONFLICT"            // 资源在读取后已被其他请求修改
+	ErrCodeQueueFull          = "QUEUE_FULL"          // 活跃任务数超过上限
+	ErrCodeQueueError         = "QUEUE_ERROR"         // 任务入队或设置取消标记失败
+	ErrCodeStorageError       = "STORAGE_ERROR"       // 对象存储读写失败
+	ErrCodeServiceUnavailable = "SERVICE_UNAVAILABLE" // 依赖服务不可用
+	ErrCodeInternal           = "INTERNAL_ERROR"      // 数据库查询等内部错误
+)
+
+// APIError 统一的错误响应体
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// ErrorResponse 错误响应，所有接口的错误都以 {"error": {...}} 的形式返回
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// respondError 输出统一格式的错误响应并中止后续处理，details 为 nil 时不输出
+func respondError(c *gin.Context, status int, code, message string, details interface{}) {
+	c.AbortWithStatusJSON(status, ErrorResponse{Error: APIError{Code: code, Message: message, Details: details}})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondError_StandardBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handlers{}
+	router := gin.New()
+	router.GET("/pdf", h.GetPDFExtraction)
+	router.GET("/limited", func(c *gin.Context) {
+		respondError(c, http.StatusTooManyRequests, ErrCodeQueueFull, "当前处理中的任务过多，请稍后重试", gin.H{"queue_position": 2})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pdf", nil))
+	var body map[string]map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid error body %q: %v", w.Body.String(), err)
+	}
+	if w.Code != http.StatusBadRequest || body["error"]["code"] != ErrCodeInvalidRequest || body["error"]["message"] != "缺少 task_id 参数" {
+		t.Errorf("Unexpected error response: %d %s", w.Code, w.Body.String())
+	}
+	if _, ok := body["error"]["details"]; ok {
+		t.Errorf("Expected details to be omitted, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/limited", nil))
+	var limited ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &limited); err != nil {
+		t.Fatalf("Invalid error body %q: %v", w.Body.String(), err)
+	}
+	details, _ := limited.Error.Details.(map[string]interface{})
+	if w.Code != http.StatusTooManyRequests || limited.Error.Code != ErrCodeQueueFull || details["queue_position"] != float64(2) {
+		t.Errorf("Unexpected error response: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,11 +13,16 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/freedkr/moonshot/internal/audit"
 	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/integration"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/freedkr/moonshot/internal/notify"
 	"github.com/freedkr/moonshot/internal/queue"
 	"github.com/freedkr/moonshot/internal/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
 	"gorm.io/datatypes"
 )
 
@@ -25,6 +31,24 @@ type Handlers struct {
 	db      database.DatabaseInterface
 	queue   queue.Client
 	storage storage.StorageInterface
+
+	maxActiveTasks int   // 同时处于非终止状态的任务上限，0 表示不限制
+	maxUploadSize  int64 // 上传文件的大小上限（字节），0 表示不限制
+
+	callbackAllowedHosts []string // 允许指向内网地址的回调主机白名单
+
+	structuredCache *structuredCache // 增量流程已结束任务的结构化数据缓存，nil 表示不缓存
+	enricher        MissingEnricher  // 补充增强处理器，nil 表示未启用
+	minConfidence   float64          // 低置信度复核列表的默认阈值，0 表示未配置
+
+	statsRetentionDays int // 处理统计的保留天数，0 表示不清理
+
+	audit *audit.Logger // 写操作的审计日志
+
+	schemaCheck *database.SchemaCheck // 启动时的表结构检查结果，nil 表示未检查
+
+	summaryCache   *summaryCache // 汇总统计的短时缓存
+	tokenCostPer1K float64       // 每千token单价，用于估算LLM费用，0 表示不估算
 }
 
 // NewHandlers 创建处理器
@@ -33,14 +57,108 @@ func NewHandlers(db database.DatabaseInterface, queue queue.Client, storage stor
 		db:      db,
 		queue:   queue,
 		storage: storage,
+
+		structuredCache:    newStructuredCache(DefaultStructuredCacheSize, DefaultStructuredCacheTTL),
+		statsRetentionDays: DefaultStatsRetentionDays,
+		audit:              audit.NewLogger(db),
+		summaryCache:       &summaryCache{},
+	}
+}
+
+// SetStructuredCache 设置结构化数据缓存的容量和过期时间，size 为 0 时关闭缓存
+func (h *Handlers) SetStructuredCache(size int, ttl time.Duration) {
+	h.structuredCache = newStructuredCache(size, ttl)
+}
+
+// SetMaxUploadSize 设置上传文件的大小上限（字节），0 表示不限制
+func (h *Handlers) SetMaxUploadSize(limit int64) {
+	h.maxUploadSize = limit
+}
+
+// SetCallbackAllowedHosts 设置允许指向内网或本机地址的回调主机白名单，其余回调地址解析到内网时拒绝
+func (h *Handlers) SetCallbackAllowedHosts(hosts []string) {
+	h.callbackAllowedHosts = hosts
+}
+
+// SetSchemaCheck 设置启动时的表结构检查结果，表结构缺失列时 /ready 返回未就绪
+func (h *Handlers) SetSchemaCheck(check *database.SchemaCheck) {
+	h.schemaCheck = check
+}
+
+// multipartOverhead multipart 边界和表单头部占用的额外字节，请求体上限 = 文件上限 + 该值
+const multipartOverhead = 1 << 20
+
+// limitUploadBody 限制上传请求体的大小，Content-Length 已超限时直接返回 413，不读取请求体
+func (h *Handlers) limitUploadBody(c *gin.Context) bool {
+	if h.maxUploadSize <= 0 {
+		return true
+	}
+	if c.Request.ContentLength > h.maxUploadSize+multipartOverhead {
+		respondUploadTooLarge(c, h.maxUploadSize)
+		return false
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxUploadSize+multipartOverhead)
+	return true
+}
+
+// respondUploadTooLarge 返回上传文件过大的 413 响应
+func respondUploadTooLarge(c *gin.Context, limit int64) {
+	respondError(c, http.StatusRequestEntityTooLarge, ErrCodeFileTooLarge, "上传文件超过大小限制", gin.H{"max_upload_size": limit})
+}
+
+// activeTaskRetryAfterSeconds 活跃任务数超限时建议客户端的重试间隔（秒）
+const activeTaskRetryAfterSeconds = 30
+
+// SetMaxActiveTasks 设置同时活跃的任务上限，用于控制LLM调用预算，0 表示不限制
+func (h *Handlers) SetMaxActiveTasks(limit int) {
+	h.maxActiveTasks = limit
+}
+
+// activeTaskQueuePosition 计算超限时新任务的排队位置，未超限返回 0
+func activeTaskQueuePosition(active int64, limit int) int64 {
+	if limit <= 0 || active < int64(limit) {
+		return 0
 	}
+	return active - int64(limit) + 1
+}
+
+// checkActiveTaskLimit 检查活跃任务数是否超限，超限时返回 429 并附带排队位置提示
+// 计数与创建任务之间没有加锁，并发上传时可能短暂超出上限
+func (h *Handlers) checkActiveTaskLimit(c *gin.Context) bool {
+	if h.maxActiveTasks <= 0 {
+		return true
+	}
+
+	active, err := h.db.CountActiveTasks(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "统计活跃任务失败", nil)
+		return false
+	}
+
+	position := activeTaskQueuePosition(active, h.maxActiveTasks)
+	if position == 0 {
+		return true
+	}
+
+	c.Header("Retry-After", strconv.Itoa(activeTaskRetryAfterSeconds))
+	respondError(c, http.StatusTooManyRequests, ErrCodeQueueFull, "当前处理中的任务过多，请稍后重试", gin.H{
+		"active_tasks":     active,
+		"max_active_tasks": h.maxActiveTasks,
+		"queue_position":   position,
+		"retry_after":      activeTaskRetryAfterSeconds,
+	})
+	return false
 }
 
 // CreateTaskRequest 创建任务请求
+// Type 为 rule 时由 rule-worker 按规则解析Excel骨架，再经PDF合并和LLM增强的增量流程修正名称；
+// ai 表示不依赖规则骨架、完全由LLM解析Excel，目前没有worker消费该类型的任务，创建时直接拒绝
 type CreateTaskRequest struct {
 	Type     string                 `json:"type" binding:"required,oneof=rule ai"`
 	Priority int                    `json:"priority"`
 	Config   map[string]interface{} `json:"config"`
+	// CallbackURL 任务结束时接收通知的地址，可选
+	CallbackURL string `json:"callback_url"`
 }
 
 // CreateTaskResponse 创建任务响应
@@ -58,41 +176,154 @@ func (h *Handlers) Health(c *gin.Context) {
 	})
 }
 
-// Ready 就绪检查
+// Ready 就绪检查，同时返回数据库连接池状态
 func (h *Handlers) Ready(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	// 检查数据库
 	if err := h.db.Ping(ctx); err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"status": "not ready",
-			"reason": "database not available",
-		})
+		respondError(c, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "database not available", gin.H{"status": "not ready"})
 		return
 	}
 
 	// TODO: 检查队列连接 - 当前Client接口不支持Ping方法
 	// if err := h.queue.Ping(ctx); err != nil {
-	//	c.JSON(http.StatusServiceUnavailable, gin.H{
-	//		"status": "not ready",
-	//		"reason": "queue not available",
-	//	})
+	//	respondError(c, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "queue not available", gin.H{"status": "not ready"})
 	//	return
 	// }
 
-	c.JSON(http.StatusOK, gin.H{
+	// 表结构与代码中的模型不一致时，请求会在第一次查询时报出难以定位的SQL错误
+	if err := h.schemaCheck.Err(); err != nil {
+		respondError(c, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, err.Error(), gin.H{
+			"status": "not ready",
+			"schema": h.schemaCheck,
+		})
+		return
+	}
+
+	resp := gin.H{
 		"status":    "ready",
 		"timestamp": time.Now(),
-	})
+	}
+	if h.schemaCheck != nil {
+		resp["schema"] = h.schemaCheck
+	}
+	// 连接池状态用于排查连接耗尽，获取失败不影响就绪判断
+	if poolStats, err := h.db.PoolStats(); err != nil {
+		log.Printf("获取数据库连接池状态失败: %v", err)
+	} else {
+		resp["database_pool"] = poolStats
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// setTaskCallback 为任务设置回调地址，任务结束后由worker投递通知
+func setTaskCallback(task *database.TaskRecord, callbackURL string) {
+	if callbackURL == "" {
+		return
+	}
+	task.CallbackURL = callbackURL
+	task.CallbackStatus = notify.CallbackStatusPending
+}
+
+// parseMaxRows 校验任务的 max_rows 配置：非负整数，0表示不限制；JSON 数字或表单字符串均可
+func parseMaxRows(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case float64:
+		if v >= 0 && v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("max_rows 必须是非负整数（0表示不限制）: %v", value)
+}
+
+// parseBoolOption 校验任务的布尔配置（skip_pdf、force_pdf）：JSON 布尔值或表单字符串（true/false）
+func parseBoolOption(key string, value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("%s 必须是布尔值: %v", key, value)
+}
+
+// parseEnrichment 校验任务的 enrichment 配置：跳过PDF后的增强方式 llm 或 rule
+func parseEnrichment(value interface{}) (string, error) {
+	v, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("enrichment 必须是字符串: %v", value)
+	}
+	mode, err := integration.ParseEnrichmentMode(v)
+	if err != nil {
+		return "", err
+	}
+	return string(mode), nil
 }
 
 // CreateTask 创建任务
 func (h *Handlers) CreateTask(c *gin.Context) {
 	var req CreateTaskRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+	// ai 任务入队后无人处理，会一直停留在 pending，明确拒绝
+	if req.Type == "ai" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "ai 任务类型尚未实现，请使用 rule", gin.H{
+			"type":            req.Type,
+			"supported_types": []string{"rule"},
+		})
 		return
 	}
+	if req.CallbackURL != "" {
+		if err := notify.ValidateCallbackURL(c.Request.Context(), req.CallbackURL, h.callbackAllowedHosts); err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+	}
+
+	// max_rows 覆盖该任务的解析行数上限
+	if value, ok := req.Config["max_rows"]; ok {
+		maxRows, err := parseMaxRows(value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		req.Config["max_rows"] = maxRows
+	}
+	// skip_pdf 跳过PDF验证和融合，enrichment 选择跳过后的增强方式
+	if value, ok := req.Config["skip_pdf"]; ok {
+		skipPDF, err := parseBoolOption("skip_pdf", value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		req.Config["skip_pdf"] = skipPDF
+	}
+	if value, ok := req.Config["enrichment"]; ok {
+		enrichment, err := parseEnrichment(value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		req.Config["enrichment"] = enrichment
+	}
+	// force_pdf 重新处理时不复用已保存的PDF提取结果，PDF文件有变化时使用
+	if value, ok := req.Config[integration.ForcePDFConfigKey]; ok {
+		forcePDF, err := parseBoolOption(integration.ForcePDFConfigKey, value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		req.Config[integration.ForcePDFConfigKey] = forcePDF
+	}
 
 	ctx := c.Request.Context()
 	taskID := uuid.New().String()
@@ -102,12 +333,17 @@ func (h *Handlers) CreateTask(c *gin.Context) {
 	if req.Config != nil {
 		configBytes, err := json.Marshal(req.Config)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的config格式"})
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "无效的config格式", nil)
 			return
 		}
 		configJSON = configBytes
 	}
 
+	// 活跃任务数超限时拒绝新的任务，避免LLM调用超出预算
+	if !h.checkActiveTaskLimit(c) {
+		return
+	}
+
 	// 创建任务记录
 	task := &database.TaskRecord{
 		ID:       taskID,
@@ -116,9 +352,10 @@ func (h *Handlers) CreateTask(c *gin.Context) {
 		Priority: req.Priority,
 		Config:   configJSON,
 	}
+	setTaskCallback(task, req.CallbackURL)
 
 	if err := h.db.CreateTask(ctx, task); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建任务失败"})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "创建任务失败", nil)
 		return
 	}
 
@@ -133,9 +370,10 @@ func (h *Handlers) CreateTask(c *gin.Context) {
 	}
 
 	if err := h.queue.EnqueueTaskWithContext(ctx, queueTask); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "任务入队失败"})
+		respondEnqueueError(c, "任务入队失败", err)
 		return
 	}
+	h.recordAudit(c, audit.ActionTaskCreate, audit.EntityTask, taskID, gin.H{"type": req.Type, "priority": req.Priority})
 
 	c.JSON(http.StatusCreated, CreateTaskResponse{
 		TaskID: taskID,
@@ -143,6 +381,16 @@ func (h *Handlers) CreateTask(c *gin.Context) {
 	})
 }
 
+// respondEnqueueError 输出任务入队失败的响应；Redis重试耗尽时返回503，提示客户端稍后重试
+func respondEnqueueError(c *gin.Context, message string, err error) {
+	log.Printf("%s: %v", message, err)
+	status := http.StatusInternalServerError
+	if errors.Is(err, queue.ErrQueueUnavailable) {
+		status = http.StatusServiceUnavailable
+	}
+	respondError(c, status, ErrCodeQueueError, message, nil)
+}
+
 // GetTask 获取任务
 func (h *Handlers) GetTask(c *gin.Context) {
 	taskID := c.Param("id")
@@ -152,17 +400,158 @@ func (h *Handlers) GetTask(c *gin.Context) {
 	if err != nil {
 		// 添加详细错误日志
 		log.Printf("GetTask失败 - TaskID: %s, Error: %v", taskID, err)
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":   "任务不存在",
-			"taskId":  taskID,
-			"details": err.Error(),
-		})
+		respondError(c, http.StatusNotFound, ErrCodeTaskNotFound, "任务不存在", gin.H{"task_id": taskID})
 		return
 	}
 
 	c.JSON(http.StatusOK, task)
 }
 
+// GetTaskLogs 获取任务处理日志和最新的处理统计
+func (h *Handlers) GetTaskLogs(c *gin.Context) {
+	taskID := c.Param("id")
+	ctx := c.Request.Context()
+
+	task, err := h.db.GetTask(ctx, taskID)
+	if err != nil {
+		log.Printf("GetTaskLogs失败 - TaskID: %s, Error: %v", taskID, err)
+		respondError(c, http.StatusNotFound, ErrCodeTaskNotFound, "任务不存在", gin.H{"task_id": taskID})
+		return
+	}
+
+	stats, err := h.db.GetLatestProcessingStats(ctx, taskID)
+	if err != nil {
+		log.Printf("获取任务 %s 的处理统计失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取处理统计失败", nil)
+		return
+	}
+
+	// 统计尚未生成时返回空结构
+	statsResp := gin.H{
+		"total_records":      0,
+		"processed_records":  0,
+		"skipped_records":    0,
+		"error_records":      0,
+		"processing_time_ms": int64(0),
+		"memory_usage_mb":    0.0,
+		"created_at":         nil,
+	}
+	parseWarnings := []model.ParseWarning{}
+	if stats != nil {
+		statsResp = gin.H{
+			"total_records":      stats.TotalRecords,
+			"processed_records":  stats.ProcessedRecords,
+			"skipped_records":    stats.SkippedRecords,
+			"error_records":      stats.ErrorRecords,
+			"processing_time_ms": stats.ProcessingTimeMs,
+			"memory_usage_mb":    stats.MemoryUsageMB,
+			"created_at":         stats.CreatedAt,
+		}
+		if len(stats.ParseWarnings) > 0 {
+			if err := json.Unmarshal(stats.ParseWarnings, &parseWarnings); err != nil {
+				log.Printf("解析任务 %s 的解析警告失败: %v", taskID, err)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":        task.ID,
+		"status":         task.Status,
+		"processing_log": task.ProcessingLog,
+		"error_msg":      task.ErrorMsg,
+		"processed_at":   task.ProcessedAt,
+		"processed_by":   task.ProcessedBy,
+		"stats":          statsResp,
+		"has_stats":      stats != nil,
+		"parse_warnings": parseWarnings,
+		// 仅保存了部分警告时为 true，完整数量见 stats.skipped_records
+		"parse_warnings_truncated": stats != nil && stats.SkippedRecords > len(parseWarnings),
+	})
+}
+
+// maxBulkStatusTasks 批量状态查询的最大任务数
+const maxBulkStatusTasks = 100
+
+// BulkTaskStatusRequest 批量查询任务状态请求
+type BulkTaskStatusRequest struct {
+	TaskIDs []string `json:"task_ids" binding:"required,min=1"`
+}
+
+// TaskStatusSummary 任务状态摘要
+type TaskStatusSummary struct {
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Progress  *int      `json:"progress,omitempty"`
+	ErrorMsg  string    `json:"error_msg,omitempty"`
+}
+
+// taskStatusProgress 任务状态对应的进度百分比
+// 任务记录不保存处理进度，批量状态接口按状态给出粗略的估计值，不反映处理中任务的实际进度
+var taskStatusProgress = map[string]int{
+	"pending":       0,
+	"processing":    50,
+	"llm_processed": 100,
+	"completed":     100,
+	"failed":        100,
+	"cancelled":     100,
+}
+
+// GetTasksStatus 批量获取任务状态，progress 由任务状态估计
+func (h *Handlers) GetTasksStatus(c *gin.Context) {
+	var req BulkTaskStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+
+	if len(req.TaskIDs) > maxBulkStatusTasks {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("一次最多查询 %d 个任务", maxBulkStatusTasks), gin.H{"max_task_ids": maxBulkStatusTasks})
+		return
+	}
+
+	// 过滤非法的UUID，避免整个查询因类型转换失败
+	validIDs := make([]string, 0, len(req.TaskIDs))
+	for _, id := range req.TaskIDs {
+		if _, err := uuid.Parse(id); err == nil {
+			validIDs = append(validIDs, id)
+		}
+	}
+
+	tasks, err := h.db.GetTasksByIDs(c.Request.Context(), validIDs)
+	if err != nil {
+		log.Printf("批量获取任务状态失败: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取任务状态失败", nil)
+		return
+	}
+
+	statuses := make(map[string]TaskStatusSummary, len(tasks))
+	for _, task := range tasks {
+		summary := TaskStatusSummary{
+			Status:    task.Status,
+			UpdatedAt: task.UpdatedAt,
+			ErrorMsg:  task.ErrorMsg,
+		}
+		if progress, ok := taskStatusProgress[task.Status]; ok {
+			summary.Progress = &progress
+		}
+		statuses[task.ID] = summary
+	}
+
+	// 返回未找到的任务ID，便于前端清理；全部存在时返回空列表而不是 null
+	missing := []string{}
+	for _, id := range req.TaskIDs {
+		if _, ok := statuses[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"statuses": statuses,
+		"missing":  missing,
+		"count":    len(statuses),
+	})
+}
+
 // ListTasks 列出任务
 func (h *Handlers) ListTasks(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -185,7 +574,7 @@ func (h *Handlers) ListTasks(c *gin.Context) {
 
 	tasks, err := h.db.ListTasks(ctx, limit, offset)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取任务列表失败"})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取任务列表失败", nil)
 		return
 	}
 
@@ -196,12 +585,62 @@ func (h *Handlers) ListTasks(c *gin.Context) {
 	})
 }
 
+// CancelTask 取消任务
+// 在Redis中设置取消标记，worker在处理步骤和LLM批次之间检查并中止；
+// 尚未开始处理的任务直接标记为已取消；已完成的任务只有后台增量流程仍在运行时可以取消，
+// 其余已结束的任务返回 409
+func (h *Handlers) CancelTask(c *gin.Context) {
+	taskID := c.Param("id")
+	ctx := c.Request.Context()
+
+	task, err := h.db.GetTask(ctx, taskID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, ErrCodeTaskNotFound, "任务不存在", nil)
+		return
+	}
+
+	finished := task.Status == "failed" || task.Status == "cancelled" ||
+		(task.Status == "completed" && task.FlowStartedAt == nil)
+	if finished {
+		respondError(c, http.StatusConflict, ErrCodeTaskFinished, "任务已结束，无法取消", gin.H{"status": task.Status})
+		return
+	}
+
+	previousStatus := task.Status
+	if err := h.queue.RequestCancel(ctx, taskID); err != nil {
+		log.Printf("设置取消标记失败 - TaskID: %s, Error: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeQueueError, "取消任务失败", nil)
+		return
+	}
+
+	if task.Status == "pending" {
+		now := time.Now()
+		task.Status = "cancelled"
+		task.ErrorMsg = "任务已被用户取消"
+		task.UpdatedAt = now
+		task.ProcessedAt = &now
+		if err := h.db.UpdateTask(ctx, task); err != nil {
+			log.Printf("更新任务状态失败 - TaskID: %s, Error: %v", taskID, err)
+		}
+	}
+
+	h.recordAudit(c, audit.ActionTaskCancel, audit.EntityTask, taskID, gin.H{"previous_status": previousStatus})
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "取消请求已提交",
+		"task_id": taskID,
+		"status":  task.Status,
+	})
+}
+
 // DeleteTask 删除任务
 func (h *Handlers) DeleteTask(c *gin.Context) {
 	taskID := c.Param("id")
 
 	// TODO: 实现任务删除逻辑
 	// 注意：需要考虑正在处理中的任务
+	// 删除尚未实现，审计中如实记录请求未执行删除
+	h.recordAudit(c, audit.ActionTaskDelete, audit.EntityTask, taskID, gin.H{"deleted": false})
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "任务删除功能待实现",
@@ -213,51 +652,106 @@ func (h *Handlers) DeleteTask(c *gin.Context) {
 func (h *Handlers) UploadFile(c *gin.Context) {
 	ctx := c.Request.Context()
 
+	// 在解析 multipart 表单之前限制请求体大小，避免超大文件占满内存和临时磁盘
+	if !h.limitUploadBody(c) {
+		return
+	}
+
 	// 解析文件
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid file upload: " + err.Error(),
-		})
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondUploadTooLarge(c, h.maxUploadSize)
+			return
+		}
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidFile, "Invalid file upload: "+err.Error(), nil)
 		return
 	}
 	defer file.Close()
+	if h.maxUploadSize > 0 && header.Size > h.maxUploadSize {
+		respondUploadTooLarge(c, h.maxUploadSize)
+		return
+	}
 
 	// 验证文件类型
 	ext := filepath.Ext(header.Filename)
 	if ext != ".xlsx" && ext != ".xls" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Only Excel files (.xlsx, .xls) are supported",
-		})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidFile, "Only Excel files (.xlsx, .xls) are supported", gin.H{"extension": ext})
 		return
 	}
 
-	// 生成唯一ID
-	fileID := uuid.New().String()
-	taskID := uuid.New().String()
+	callbackURL := c.PostForm("callback_url")
+	if callbackURL != "" {
+		if err := notify.ValidateCallbackURL(c.Request.Context(), callbackURL, h.callbackAllowedHosts); err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+	}
 
-	// 计算MD5
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "计算文件哈希失败"})
+	// max_rows 覆盖该任务的解析行数上限，未填写时使用全局配置
+	taskConfig := map[string]interface{}{}
+	if value := c.PostForm("max_rows"); value != "" {
+		maxRows, err := parseMaxRows(value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		taskConfig["max_rows"] = maxRows
+	}
+	// skip_pdf 跳过PDF验证和融合，enrichment 选择跳过后的增强方式（llm/rule）
+	if value := c.PostForm("skip_pdf"); value != "" {
+		skipPDF, err := parseBoolOption("skip_pdf", value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		taskConfig["skip_pdf"] = skipPDF
+	}
+	if value := c.PostForm("enrichment"); value != "" {
+		enrichment, err := parseEnrichment(value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		taskConfig["enrichment"] = enrichment
+	}
+	// force_pdf 重新处理时不复用已保存的PDF提取结果
+	if value := c.PostForm(integration.ForcePDFConfigKey); value != "" {
+		forcePDF, err := parseBoolOption(integration.ForcePDFConfigKey, value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		taskConfig[integration.ForcePDFConfigKey] = forcePDF
+	}
+	configJSON, err := json.Marshal(taskConfig)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "序列化任务配置失败", nil)
+		return
+	}
+
+	// 活跃任务数超限时拒绝新的上传，避免LLM调用超出预算；后台增量流程未结束的任务同样计入
+	if !h.checkActiveTaskLimit(c) {
 		return
 	}
-	md5Hash := fmt.Sprintf("%x", hash.Sum(nil))
 
-	// 重置文件指针
-	file.Seek(0, 0)
+	// 生成唯一ID
+	fileID := uuid.New().String()
+	taskID := uuid.New().String()
 
 	// 生成存储路径
 	objectName := fmt.Sprintf("uploads/%s/%s", fileID, header.Filename)
 
-	// 上传到存储
-	err = h.storage.UploadFile(ctx, objectName, file, header.Size, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	// 上传到存储，同时边读边计算MD5，不需要回到文件开头再读一遍
+	hash := md5.New()
+	err = h.storage.UploadFile(ctx, objectName, io.TeeReader(file, hash), header.Size, xlsxContentType)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to upload file to storage: " + err.Error(),
-		})
+		log.Printf("上传文件到存储失败 - Path: %s, Error: %v", objectName, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeStorageError, "Failed to upload file to storage", nil)
 		return
 	}
+	md5Hash := fmt.Sprintf("%x", hash.Sum(nil))
 
 	// 创建任务记录
 	// 预先定义好输入和输出路径
@@ -270,17 +764,18 @@ func (h *Handlers) UploadFile(c *gin.Context) {
 		Type:          "rule", // 默认使用规则处理
 		Status:        "pending",
 		Priority:      0,
-		InputPath:     objectName,                   // 关联输入文件路径
-		OutputPath:    outputPath,                   // 关联输出文件路径
-		Config:        datatypes.JSON([]byte(`{}`)), // 为JSONB字段设置默认值
-		UploadBatchID: uploadBatchID,                // 设置上传批次ID
+		InputPath:     objectName,                 // 关联输入文件路径
+		OutputPath:    outputPath,                 // 关联输出文件路径
+		Config:        datatypes.JSON(configJSON), // 任务配置，如 max_rows
+		UploadBatchID: uploadBatchID,              // 设置上传批次ID
 	}
+	setTaskCallback(task, callbackURL)
 
 	if err := h.db.CreateTask(ctx, task); err != nil {
 		// 清理已上传的文件
 		h.storage.DeleteFile(ctx, objectName)
 		log.Printf("CreateTask失败 - TaskID: %s, Error: %v", taskID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建任务失败"})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "创建任务失败", nil)
 		return
 	}
 	log.Printf("CreateTask成功 - TaskID: %s", taskID)
@@ -301,7 +796,7 @@ func (h *Handlers) UploadFile(c *gin.Context) {
 		// 删除已上传的文件和任务
 		h.storage.DeleteFile(ctx, objectName)
 		h.db.DeleteTask(ctx, taskID) // 补偿：删除已创建的任务记录
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建文件记录失败"})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "创建文件记录失败", nil)
 		return
 	}
 
@@ -327,7 +822,7 @@ func (h *Handlers) UploadFile(c *gin.Context) {
 		// 补偿：删除文件和任务
 		h.storage.DeleteFile(ctx, objectName)
 		h.db.DeleteTask(ctx, taskID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Excel任务入队失败"})
+		respondEnqueueError(c, "Excel任务入队失败", err)
 		return
 	}
 
@@ -352,9 +847,10 @@ func (h *Handlers) UploadFile(c *gin.Context) {
 		// 补偿：删除文件和任务
 		h.storage.DeleteFile(ctx, objectName)
 		h.db.DeleteTask(ctx, taskID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "PDF任务入队失败"})
+		respondEnqueueError(c, "PDF任务入队失败", err)
 		return
 	}
+	h.recordAudit(c, audit.ActionTaskCreate, audit.EntityTask, taskID, gin.H{"file_id": fileID, "filename": header.Filename, "size": header.Size})
 
 	c.JSON(http.StatusOK, gin.H{
 		"taskId":  taskID,
@@ -363,30 +859,18 @@ func (h *Handlers) UploadFile(c *gin.Context) {
 	})
 }
 
-// FlatCategory 定义了用于API响应的扁平化分类结构。
-// 这种结构对前端更友好，便于快速渲染和处理大型数据集。
-type FlatCategory struct {
-	Code        string `json:"code"`
-	Name        string `json:"name"`
-	Level       string `json:"level"`
-	ParentCode  string `json:"parent_code"`
-	HasChildren bool   `json:"has_children"` // 是否有子节点，用于前端展开/收起功能
-	HasLLM      bool   `json:"has_llm"`      // 是否有LLM增强数据
-	HasPDF      bool   `json:"has_pdf"`      // 是否有PDF信息数据
-}
-
 // DownloadFile 下载文件
 func (h *Handlers) DownloadFile(c *gin.Context) {
 	objectName := c.Query("path")
 	if objectName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 path 参数"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 path 参数", nil)
 		return
 	}
 
 	reader, err := h.storage.DownloadFile(c.Request.Context(), objectName)
 	if err != nil {
 		log.Printf("下载文件失败: %v", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "文件未找到或无法下载"})
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "文件未找到或无法下载", nil)
 		return
 	}
 	defer reader.Close()
@@ -404,46 +888,120 @@ func (h *Handlers) DownloadFile(c *gin.Context) {
 }
 
 // DownloadResultByTaskID 根据任务ID下载处理结果
+// 格式版本通过 ?schema=v1|v2 或 Accept: application/vnd.moonshot.result.v2+json 协商，默认 v1
 func (h *Handlers) DownloadResultByTaskID(c *gin.Context) {
 	taskID := c.Query("task_id")
 	if taskID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 task_id 参数"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id 参数", nil)
 		return
 	}
-
-	// 1. 检查任务是否存在且已完成
-	task, err := h.db.GetTask(c.Request.Context(), taskID)
+	schema, err := negotiateResultSchema(c)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "任务未找到"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
 		return
 	}
-	if task.Status != "completed" {
-		c.JSON(http.StatusAccepted, gin.H{"error": "任务尚未完成", "status": task.Status})
+
+	dbCategories, ok := h.loadCompletedTaskCategories(c, taskID)
+	if !ok {
 		return
 	}
 
-	// 2. 从 'categories' 表获取与任务关联的当前版本分类数据
-	dbCategories, err := h.db.GetCurrentCategoriesByTaskID(c.Request.Context(), taskID)
+	// 3. 将数据库模型转换为对应版本的DTO
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="task_%s_result.json"`, taskID))
+	c.Header("Content-Type", "application/json")
+	c.Header(ResultSchemaHeader, schema)
+	c.JSON(http.StatusOK, buildResultPayload(schema, taskID, dbCategories))
+}
+
+// xlsxExportHeader Excel导出的列
+var xlsxExportHeader = []interface{}{"code", "name", "level", "parent_code", "pdf_name", "llm_name", "confidence"}
+
+// DownloadResultXLSXByTaskID 根据任务ID以Excel格式下载增强后的分类结果
+func (h *Handlers) DownloadResultXLSXByTaskID(c *gin.Context) {
+	taskID := c.Query("task_id")
+	if taskID == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id 参数", nil)
+		return
+	}
+
+	dbCategories, ok := h.loadCompletedTaskCategories(c, taskID)
+	if !ok {
+		return
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := f.GetSheetName(0)
+	sw, err := f.NewStreamWriter(sheet)
 	if err != nil {
-		log.Printf("获取任务 %s 的当前版本分类数据失败: %v", taskID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取结果数据失败"})
+		log.Printf("创建任务 %s 的Excel写入器失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "生成Excel失败", nil)
 		return
 	}
 
-	// 3. 将数据库模型转换为API的DTO，确保JSON字段为小写
-	flatCategories := make([]FlatCategory, len(dbCategories))
+	if err := sw.SetRow("A1", xlsxExportHeader); err != nil {
+		log.Printf("写入任务 %s 的Excel表头失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "生成Excel失败", nil)
+		return
+	}
 	for i, dbCat := range dbCategories {
-		flatCategories[i] = FlatCategory{
-			Code:       dbCat.Code,
-			Name:       dbCat.Name,
-			Level:      dbCat.Level,
-			ParentCode: dbCat.ParentCode,
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := sw.SetRow(cell, buildXLSXExportRow(dbCat)); err != nil {
+			log.Printf("写入任务 %s 的Excel数据失败: %v", taskID, err)
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "生成Excel失败", nil)
+			return
 		}
 	}
+	if err := sw.Flush(); err != nil {
+		log.Printf("生成任务 %s 的Excel失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "生成Excel失败", nil)
+		return
+	}
 
-	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="task_%s_result.json"`, taskID))
-	c.Header("Content-Type", "application/json")
-	c.JSON(http.StatusOK, flatCategories)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="task_%s_result.xlsx"`, taskID))
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Status(http.StatusOK)
+	if err := f.Write(c.Writer); err != nil {
+		log.Printf("写入响应流失败: %v", err)
+		// 此时已经写入响应头，所以不再发送JSON错误
+	}
+}
+
+// buildXLSXExportRow 生成单个分类的导出行，与 v2 下载结果使用同一转换
+func buildXLSXExportRow(dbCat *database.Category) []interface{} {
+	result := newResultCategoryV2(dbCat)
+
+	var confidence interface{}
+	if result.Confidence != nil {
+		confidence = *result.Confidence
+	}
+
+	return []interface{}{result.Code, result.Name, result.Level, result.ParentCode, result.PDFName, result.LLMName, confidence}
+}
+
+// loadCompletedTaskCategories 检查任务已完成并获取当前版本分类数据，失败时已写入响应
+func (h *Handlers) loadCompletedTaskCategories(c *gin.Context, taskID string) ([]*database.Category, bool) {
+	// 1. 检查任务是否存在且已完成
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, ErrCodeTaskNotFound, "任务未找到", nil)
+		return nil, false
+	}
+	if task.Status != "completed" {
+		respondError(c, http.StatusAccepted, ErrCodeTaskNotReady, "任务尚未完成", gin.H{"status": task.Status})
+		return nil, false
+	}
+
+	// 2. 从 'categories' 表获取与任务关联的当前版本分类数据
+	dbCategories, err := h.db.GetCurrentCategoriesByTaskID(c.Request.Context(), taskID)
+	if err != nil {
+		log.Printf("获取任务 %s 的当前版本分类数据失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取结果数据失败", nil)
+		return nil, false
+	}
+
+	return dbCategories, true
 }
 
 // DeleteFile 删除文件
@@ -465,7 +1023,8 @@ func (h *Handlers) GetStats(c *gin.Context) {
 			"rule_queue_length": 0, // TODO: implement queue length stats
 			"ai_queue_length":   0, // TODO: implement queue length stats
 		},
-		"timestamp": time.Now(),
+		"structured_cache": h.structuredCache.stats(),
+		"timestamp":        time.Now(),
 	})
 }
 
@@ -487,7 +1046,7 @@ func (h *Handlers) GetQueueStats(c *gin.Context) {
 func (h *Handlers) GetTaskVersionHistory(c *gin.Context) {
 	taskID := c.Param("task_id")
 	if taskID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 task_id 参数"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id 参数", nil)
 		return
 	}
 
@@ -495,7 +1054,7 @@ func (h *Handlers) GetTaskVersionHistory(c *gin.Context) {
 	versionHistory, err := h.db.GetCategoryVersionHistory(c.Request.Context(), taskID)
 	if err != nil {
 		log.Printf("获取任务 %s 的版本历史失败: %v", taskID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取版本历史失败"})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取版本历史失败", nil)
 		return
 	}
 
@@ -505,11 +1064,44 @@ func (h *Handlers) GetTaskVersionHistory(c *gin.Context) {
 	})
 }
 
+// GetVersionDiff 获取两个版本之间的分类差异
+func (h *Handlers) GetVersionDiff(c *gin.Context) {
+	taskID := c.Query("task_id")
+	from := c.Query("from")
+	to := c.Query("to")
+
+	if taskID == "" || from == "" || to == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id、from 或 to 参数", nil)
+		return
+	}
+
+	// 变更明细默认最多返回500条，最大2000条
+	limit := 500
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 2000 {
+			limit = parsed
+		}
+	}
+
+	diff, err := h.db.GetCategoryVersionDiff(c.Request.Context(), taskID, from, to, limit)
+	if err != nil {
+		log.Printf("获取任务 %s 的版本差异失败 (%s -> %s): %v", taskID, from, to, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取版本差异失败", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": taskID,
+		"diff":    diff,
+		"limit":   limit,
+	})
+}
+
 // GetVersionCategories 获取指定版本的分类数据
 func (h *Handlers) GetVersionCategories(c *gin.Context) {
 	batchID := c.Query("batch_id")
 	if batchID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 batch_id 参数"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 batch_id 参数", nil)
 		return
 	}
 
@@ -517,16 +1109,16 @@ func (h *Handlers) GetVersionCategories(c *gin.Context) {
 	dbCategories, err := h.db.GetCategoriesByBatchID(c.Request.Context(), batchID)
 	if err != nil {
 		log.Printf("获取批次 %s 的分类数据失败: %v", batchID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分类数据失败"})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取分类数据失败", nil)
 		return
 	}
 
 	// 转换为API DTO
-	flatCategories := make([]FlatCategory, len(dbCategories))
+	flatCategories := make([]model.FlatCategory, len(dbCategories))
 	for i, dbCat := range dbCategories {
 		// 对于版本分类查询，暂时不计算HasChildren以提高性能
-		// 如果需要可以加上: hasChildren := h.hasChildren(ctx, "", batchID, dbCat.Code)
-		flatCategories[i] = FlatCategory{
+		// 如果需要可以通过 h.db.GetParentCodesWithChildren 批量计算
+		flatCategories[i] = model.FlatCategory{
 			Code:        dbCat.Code,
 			Name:        dbCat.Name,
 			Level:       dbCat.Level,
@@ -542,130 +1134,519 @@ func (h *Handlers) GetVersionCategories(c *gin.Context) {
 	})
 }
 
+// CategoryDetail 单个分类的完整信息（包含PDF和LLM增强详情）
+type CategoryDetail struct {
+	Code            string                 `json:"code"`
+	Name            string                 `json:"name"`
+	Level           string                 `json:"level"`
+	ParentCode      string                 `json:"parent_code"`
+	Status          string                 `json:"status"`
+	DataSource      string                 `json:"data_source"`
+	UploadBatchID   string                 `json:"upload_batch_id"`
+	UploadTimestamp time.Time              `json:"upload_timestamp"`
+	IsCurrent       bool                   `json:"is_current"`
+	PDFInfo         map[string]interface{} `json:"pdf_info,omitempty"`
+	LLMEnhancements map[string]interface{} `json:"llm_enhancements,omitempty"`
+	Selection       *NameSelection         `json:"selection,omitempty"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+// NameSelection LLM名称选择的依据
+type NameSelection struct {
+	SelectedFrom    string   `json:"selected_from,omitempty"`
+	AlternativeName string   `json:"alternative_name,omitempty"`
+	Confidence      *float64 `json:"confidence,omitempty"`
+}
+
+// GetCategoryDetail 获取单个分类的完整信息
+func (h *Handlers) GetCategoryDetail(c *gin.Context) {
+	taskID := c.Query("task_id")
+	code := c.Query("code")
+	version := c.Query("version")
+
+	if taskID == "" || code == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id 或 code 参数", nil)
+		return
+	}
+
+	dbCat, err := h.db.GetCategoryByCode(c.Request.Context(), taskID, version, code)
+	if err != nil {
+		if errors.Is(err, database.ErrCategoryNotFound) {
+			respondError(c, http.StatusNotFound, ErrCodeNotFound, "分类不存在", nil)
+			return
+		}
+		log.Printf("获取任务 %s 的分类 %s 失败: %v", taskID, code, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取分类失败", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCategoryDetail(dbCat))
+}
+
+// buildCategoryDetail 将数据库记录转换为详情DTO，解析JSON字段
+func buildCategoryDetail(dbCat *database.Category) CategoryDetail {
+	detail := CategoryDetail{
+		Code:            dbCat.Code,
+		Name:            dbCat.Name,
+		Level:           dbCat.Level,
+		ParentCode:      dbCat.ParentCode,
+		Status:          dbCat.Status,
+		DataSource:      dbCat.DataSource,
+		UploadBatchID:   dbCat.UploadBatchID,
+		UploadTimestamp: dbCat.UploadTimestamp,
+		IsCurrent:       dbCat.IsCurrent,
+		UpdatedAt:       dbCat.UpdatedAt,
+	}
+
+	if dbCat.PDFInfo != "" {
+		if err := json.Unmarshal([]byte(dbCat.PDFInfo), &detail.PDFInfo); err != nil {
+			log.Printf("解析分类 %s 的 pdf_info 失败: %v", dbCat.Code, err)
+		}
+	}
+	if dbCat.LLMEnhancements != "" {
+		if err := json.Unmarshal([]byte(dbCat.LLMEnhancements), &detail.LLMEnhancements); err != nil {
+			log.Printf("解析分类 %s 的 llm_enhancements 失败: %v", dbCat.Code, err)
+		}
+	}
+
+	if detail.LLMEnhancements != nil {
+		selection := &NameSelection{}
+		if selectedFrom, ok := detail.LLMEnhancements["selected_from"].(string); ok {
+			selection.SelectedFrom = selectedFrom
+		}
+		if altName, ok := detail.LLMEnhancements["alternative_name"].(string); ok {
+			selection.AlternativeName = altName
+		}
+		if confidence, ok := detail.LLMEnhancements["confidence"].(float64); ok {
+			selection.Confidence = &confidence
+		}
+
+		// LLM未返回备选名称时，用PDF名称与最终名称对比推断
+		if selection.AlternativeName == "" && detail.PDFInfo != nil {
+			if pdfName, ok := detail.PDFInfo["name"].(string); ok && pdfName != "" && pdfName != dbCat.Name {
+				selection.AlternativeName = pdfName
+				if selection.SelectedFrom == "" {
+					selection.SelectedFrom = "rule"
+				}
+			}
+		}
+		detail.Selection = selection
+	}
+
+	return detail
+}
+
+// GetPDFExtraction 获取任务的PDF职业编码提取结果，包含第一轮LLM清洗前后的数据
+func (h *Handlers) GetPDFExtraction(c *gin.Context) {
+	taskID := c.Query("task_id")
+	if taskID == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id 参数", nil)
+		return
+	}
+
+	extraction, err := h.db.GetPDFExtraction(c.Request.Context(), taskID)
+	if err != nil {
+		if errors.Is(err, database.ErrPDFExtractionNotFound) {
+			respondError(c, http.StatusNotFound, ErrCodeNotFound, "该任务没有PDF提取结果", nil)
+			return
+		}
+		log.Printf("获取任务 %s 的PDF提取结果失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取PDF提取结果失败", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, extraction)
+}
+
+// HierarchyCorrection 重建层级时单个分类的修正
+type HierarchyCorrection struct {
+	Code          string `json:"code"`
+	OldParentCode string `json:"old_parent_code"`
+	NewParentCode string `json:"new_parent_code"`
+	OldLevel      string `json:"old_level"`
+	NewLevel      string `json:"new_level"`
+}
+
+// RebuildHierarchy 根据编码重新推导当前版本分类的 parent_code 和 level，修正与编码不一致的记录
+// dry_run=true 时只返回需要修正的记录，不写入数据库
+func (h *Handlers) RebuildHierarchy(c *gin.Context) {
+	ctx := c.Request.Context()
+	taskID := c.Query("task_id")
+	if taskID == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id 参数", nil)
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	categories, err := h.db.GetCurrentCategoriesByTaskID(ctx, taskID)
+	if err != nil {
+		log.Printf("重建层级失败 - 查询分类: TaskID=%s, Error=%v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取分类数据失败", nil)
+		return
+	}
+	if len(categories) == 0 {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "该任务没有分类数据", nil)
+		return
+	}
+
+	corrections := findHierarchyCorrections(categories)
+	if !dryRun && len(corrections) > 0 {
+		updates := make([]database.CategoryUpdate, 0, len(corrections))
+		for _, correction := range corrections {
+			updates = append(updates, database.CategoryUpdate{
+				Code: correction.Code,
+				Updates: map[string]interface{}{
+					"parent_code": correction.NewParentCode,
+					"level":       correction.NewLevel,
+				},
+			})
+		}
+		if _, err := h.db.BatchUpdateCurrentCategories(ctx, taskID, updates); err != nil {
+			log.Printf("重建层级失败 - 更新分类: TaskID=%s, Error=%v", taskID, err)
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "更新分类层级失败", nil)
+			return
+		}
+		h.structuredCache.invalidateTask(taskID)
+		log.Printf("重建层级完成 - TaskID=%s, 修正=%d/%d", taskID, len(corrections), len(categories))
+		h.recordAudit(c, audit.ActionHierarchyRebuild, audit.EntityCategories, taskID, gin.H{"corrected": len(corrections)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":     taskID,
+		"dry_run":     dryRun,
+		"total":       len(categories),
+		"corrected":   len(corrections),
+		"corrections": corrections,
+	})
+}
+
+// findHierarchyCorrections 找出 parent_code 或 level 与编码推导结果不一致的分类
+// 无法从编码推导层级（超出细类）时保留原有的 level
+func findHierarchyCorrections(categories []*database.Category) []HierarchyCorrection {
+	corrections := make([]HierarchyCorrection, 0)
+	for _, cat := range categories {
+		info := model.ParseCodeInfo(cat.Code)
+		level := info.Level
+		if level == "" {
+			level = cat.Level
+		}
+		if cat.ParentCode == info.ParentCode && cat.Level == level {
+			continue
+		}
+		corrections = append(corrections, HierarchyCorrection{
+			Code:          cat.Code,
+			OldParentCode: cat.ParentCode,
+			NewParentCode: info.ParentCode,
+			OldLevel:      cat.Level,
+			NewLevel:      level,
+		})
+	}
+	return corrections
+}
+
+// 结构化数据扁平列表的分页参数
+const (
+	defaultStructuredPageSize = 1000
+	maxStructuredPageSize     = 5000
+)
+
 // GetAllStructuredData 获取指定版本的所有结构化数据（包含完整骨架）
+// 不传 parent_code 时扁平数据按 limit/offset 分页；include_tree=true 时加载全部数据并返回层级结构
 func (h *Handlers) GetAllStructuredData(c *gin.Context) {
 	taskID := c.Query("task_id")
 	version := c.Query("version")
 	parentCode := c.Query("parent_code") // 新增：接收父节点ID
 
 	if taskID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 task_id 参数"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id 参数", nil)
 		return
 	}
 
 	ctx := c.Request.Context()
 
-	var dbCategories []*database.Category
-	var err error
+	// 层级结构需要加载全部数据，只在显式请求时返回
+	if parentCode == "" && c.Query("include_tree") == "true" {
+		h.getStructuredDataWithTree(c, taskID, version)
+		return
+	}
+
+	// 子节点存在性统一按版本批量查询：未指定版本时使用最新完整版本
+	batchID := version
+	if batchID == "" {
+		batchID = h.resolveLatestCompleteBatchID(ctx, taskID)
+	}
 
-	// 根据有无 parentCode 决定查询逻辑
+	// 如果是按父节点查询，直接返回扁平数据即可
 	if parentCode != "" {
-		// 按父节点查询子节点
-		dbCategories, err = h.db.GetChildrenByParentCode(ctx, taskID, version, parentCode)
-	} else {
-		// 按版本获取数据（保持原有逻辑，但可以优化为只获取顶层）
-		if version != "" {
-			// 获取指定版本数据
-			dbCategories, err = h.db.GetCategoriesByBatchID(ctx, version)
-			log.Printf("指定版本 %s 返回 %d 条记录", version, len(dbCategories))
-		} else {
-			// 获取最新完整版本，而不是简单的 is_current=true
-			dbCategories, err = h.getLatestCompleteVersion(ctx, taskID)
+		dbCategories, err := h.db.GetChildrenByParentCode(ctx, taskID, version, parentCode)
+		if err != nil {
+			log.Printf("获取任务 %s 的结构化数据失败: %v", taskID, err)
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取结构化数据失败", nil)
+			return
+		}
+
+		flatCategories, err := h.toFlatCategories(ctx, taskID, batchID, dbCategories)
+		if err != nil {
+			log.Printf("获取任务 %s 的子节点信息失败: %v", taskID, err)
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取结构化数据失败", nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"flat_data": flatCategories})
+		return
+	}
+
+	limit := defaultStructuredPageSize
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= maxStructuredPageSize {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
 		}
 	}
 
+	dbCategories, total, err := h.db.GetCategoriesPage(ctx, taskID, batchID, limit, offset)
 	if err != nil {
 		log.Printf("获取任务 %s 的结构化数据失败: %v", taskID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取结构化数据失败"})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取结构化数据失败", nil)
 		return
 	}
 
-	// 如果是按父节点查询，直接返回扁平数据即可
-	if parentCode != "" {
-		flatCategories := make([]FlatCategory, len(dbCategories))
-		for i, dbCat := range dbCategories {
-			// 计算是否有子节点
-			hasChildren := h.hasChildren(ctx, taskID, version, dbCat.Code)
-			
-			// 检查是否有LLM增强数据和PDF信息
-			hasLLM := dbCat.LLMEnhancements != ""
-			hasPDF := dbCat.PDFInfo != ""
-			
-			flatCategories[i] = FlatCategory{
-				Code:        dbCat.Code,
-				Name:        dbCat.Name,
-				Level:       dbCat.Level,
-				ParentCode:  dbCat.ParentCode,
-				HasChildren: hasChildren,
-				HasLLM:      hasLLM,
-				HasPDF:      hasPDF,
-			}
+	flatCategories, err := h.toFlatCategories(ctx, taskID, batchID, dbCategories)
+	if err != nil {
+		log.Printf("获取任务 %s 的子节点信息失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取结构化数据失败", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":     taskID,
+		"version":     version,
+		"flat_data":   flatCategories,
+		"total_count": total,
+		"limit":       limit,
+		"offset":      offset,
+		"has_more":    int64(offset+len(flatCategories)) < total,
+		"skeleton_info": gin.H{
+			"has_skeleton":       true,
+			"complete_structure": true,
+		},
+		"performance": gin.H{
+			"paginated":          true,
+			"max_limit":          maxStructuredPageSize,
+			"has_children_query": "每页一次批量查询",
+			"tree_included":      false,
+			"note":               "include_tree=true 会加载全部数据并在内存中构建层级结构，数据量大时响应较慢",
+		},
+	})
+}
+
+// getStructuredDataWithTree 加载全部数据并返回扁平列表和层级结构
+// 后台增量流程已结束的任务按 (task_id, version) 缓存，nocache=1 时跳过缓存读取
+func (h *Handlers) getStructuredDataWithTree(c *gin.Context, taskID, version string) {
+	ctx := c.Request.Context()
+
+	// 未指定版本时使用最新完整版本，而不是简单的 is_current=true
+	batchID := version
+	if batchID == "" {
+		batchID = h.resolveLatestCompleteBatchID(ctx, taskID)
+	}
+	cacheKey := structuredCacheKey{taskID: taskID, version: batchID}
+	cacheable := batchID != "" && h.structuredCache != nil && h.structuredDataSettled(ctx, taskID)
+	if !cacheable {
+		// 流程重新运行（如接管超时领取）时，之前缓存的版本会被原地改写
+		h.structuredCache.invalidateTask(taskID)
+	} else if c.Query("nocache") != "1" {
+		if entry, ok := h.structuredCache.get(cacheKey); ok {
+			writeStructuredTree(c, taskID, version, entry.flat, entry.hierarchical, true)
+			return
 		}
-		c.JSON(http.StatusOK, gin.H{"flat_data": flatCategories})
+	}
+
+	var dbCategories []*database.Category
+	var err error
+	if batchID != "" {
+		dbCategories, err = h.db.GetCategoriesByBatchID(ctx, batchID)
+		log.Printf("版本 %s 返回 %d 条记录", batchID, len(dbCategories))
+	} else {
+		log.Printf("WARNING: 没有找到完整版本，降级使用 is_current=true 版本")
+		dbCategories, err = h.db.GetCurrentCategoriesByTaskID(ctx, taskID)
+	}
+	if err != nil {
+		log.Printf("获取任务 %s 的结构化数据失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取结构化数据失败", nil)
 		return
 	}
 
-	// 转换为API DTO格式
-	flatCategories := make([]FlatCategory, len(dbCategories))
-	for i, dbCat := range dbCategories {
-		// 计算是否有子节点
-		hasChildren := h.hasChildren(ctx, taskID, version, dbCat.Code)
-		
-		// 检查是否有LLM增强数据和PDF信息
-		hasLLM := dbCat.LLMEnhancements != ""
-		hasPDF := dbCat.PDFInfo != ""
-		
-		flatCategories[i] = FlatCategory{
-			Code:        dbCat.Code,
-			Name:        dbCat.Name,
-			Level:       dbCat.Level,
-			ParentCode:  dbCat.ParentCode,
-			HasChildren: hasChildren,
-			HasLLM:      hasLLM,
-			HasPDF:      hasPDF,
+	// 数据已全部加载，子节点存在性直接由 parent_code 推导，无需额外查询
+	withChildren := make(map[string]bool, len(dbCategories))
+	for _, dbCat := range dbCategories {
+		if dbCat.ParentCode != "" {
+			withChildren[dbCat.ParentCode] = true
 		}
 	}
+	flatCategories := make([]model.FlatCategory, len(dbCategories))
+	for i, dbCat := range dbCategories {
+		flatCategories[i] = newFlatCategory(dbCat, withChildren[dbCat.Code])
+	}
 
 	// 构建层级结构
 	hierarchicalData := h.buildHierarchicalStructure(flatCategories)
 
+	if cacheable {
+		h.structuredCache.put(cacheKey, flatCategories, hierarchicalData)
+	}
+
+	writeStructuredTree(c, taskID, version, flatCategories, hierarchicalData, false)
+}
+
+// structuredDataSettled 判断任务的分类数据是否不会再被 worker 改写：
+// 任务已完成且后台增量流程已结束。规则步骤完成后任务即为 completed，
+// 但步骤3-5仍在 rule-worker 中原地改写同一版本的名称，api-server 的缓存无法感知这些写入
+func (h *Handlers) structuredDataSettled(ctx context.Context, taskID string) bool {
+	task, err := h.db.GetTask(ctx, taskID)
+	return err == nil && task.Status == "completed" && task.FlowStartedAt == nil
+}
+
+// writeStructuredTree 输出包含层级结构的结构化数据响应
+func writeStructuredTree(c *gin.Context, taskID, version string, flatCategories []model.FlatCategory, hierarchicalData HierarchicalStructure, cached bool) {
 	c.JSON(http.StatusOK, gin.H{
 		"task_id":           taskID,
 		"version":           version,
 		"flat_data":         flatCategories,
 		"hierarchical_data": hierarchicalData,
 		"total_count":       len(flatCategories),
+		"has_more":          false,
 		"skeleton_info": gin.H{
 			"has_skeleton":       true,
 			"complete_structure": true,
 		},
+		"performance": gin.H{
+			"paginated":          false,
+			"has_children_query": "由已加载数据推导",
+			"tree_included":      true,
+			"cached":             cached,
+		},
 	})
 }
 
-// buildHierarchicalStructure 构建层级结构
-func (h *Handlers) buildHierarchicalStructure(categories []FlatCategory) interface{} {
-	// 创建映射表
-	categoryMap := make(map[string]*FlatCategory)
-	for i := range categories {
-		categoryMap[categories[i].Code] = &categories[i]
+// toFlatCategories 转换为API DTO，子节点存在性通过一次批量查询获得
+func (h *Handlers) toFlatCategories(ctx context.Context, taskID, batchID string, dbCategories []*database.Category) ([]model.FlatCategory, error) {
+	codes := make([]string, len(dbCategories))
+	for i, dbCat := range dbCategories {
+		codes[i] = dbCat.Code
+	}
+
+	withChildren, err := h.db.GetParentCodesWithChildren(ctx, taskID, batchID, codes)
+	if err != nil {
+		return nil, err
+	}
+
+	flatCategories := make([]model.FlatCategory, len(dbCategories))
+	for i, dbCat := range dbCategories {
+		flatCategories[i] = newFlatCategory(dbCat, withChildren[dbCat.Code])
+	}
+	return flatCategories, nil
+}
+
+// newFlatCategory 将数据库记录转换为扁平分类DTO
+func newFlatCategory(dbCat *database.Category, hasChildren bool) model.FlatCategory {
+	return model.FlatCategory{
+		Code:        dbCat.Code,
+		Name:        dbCat.Name,
+		Level:       dbCat.Level,
+		ParentCode:  dbCat.ParentCode,
+		HasChildren: hasChildren,
+		HasLLM:      dbCat.LLMEnhancements != "", // 是否有LLM增强数据
+		HasPDF:      dbCat.PDFInfo != "",         // 是否有PDF信息
+	}
+}
+
+// HierarchicalStructure 嵌套的层级结构及统计
+type HierarchicalStructure struct {
+	TreeStructure []*CategoryTreeNode `json:"tree_structure"`
+	Statistics    HierarchyStatistics `json:"statistics"`
+}
+
+// CategoryTreeNode 层级结构中的节点，字段与扁平列表 model.FlatCategory 一致，另带嵌套的子节点
+type CategoryTreeNode struct {
+	Code        string              `json:"code"`
+	Name        string              `json:"name"`
+	Level       string              `json:"level"`
+	ParentCode  string              `json:"parent_code"`
+	HasChildren bool                `json:"has_children"`
+	HasLLM      bool                `json:"has_llm"`
+	HasPDF      bool                `json:"has_pdf"`
+	Children    []*CategoryTreeNode `json:"children,omitempty"`
+}
+
+// newCategoryTreeNodes 将 model.BuildTree 构建的树转换为响应节点，字段取自同一编码的扁平记录
+func newCategoryTreeNodes(nodes []*model.Category, flatByCode map[string]model.FlatCategory) []*CategoryTreeNode {
+	if len(nodes) == 0 {
+		return nil
 	}
+	result := make([]*CategoryTreeNode, len(nodes))
+	for i, node := range nodes {
+		flat := flatByCode[node.Code]
+		result[i] = &CategoryTreeNode{
+			Code:        node.Code,
+			Name:        node.Name,
+			Level:       node.Level,
+			ParentCode:  flat.ParentCode,
+			HasChildren: flat.HasChildren,
+			HasLLM:      flat.HasLLM,
+			HasPDF:      flat.HasPDF,
+			Children:    newCategoryTreeNodes(node.Children, flatByCode),
+		}
+	}
+	return result
+}
+
+// HierarchyStatistics 层级结构统计
+type HierarchyStatistics struct {
+	TotalNodes  int `json:"total_nodes"`
+	RootNodes   int `json:"root_nodes"`
+	OrphanRoots int `json:"orphan_roots"` // 祖先不在当前数据中而作为根节点展示的数量
+	MaxDepth    int `json:"max_depth"`
+}
 
-	// 构建树形结构
-	var rootNodes []FlatCategory
+// buildHierarchicalStructure 构建层级结构
+// 每个分类挂到父节点的 Children 下；父节点不在当前数据中时挂到最近的祖先，没有祖先则作为根节点
+func (h *Handlers) buildHierarchicalStructure(categories []model.FlatCategory) HierarchicalStructure {
+	rootNodes := model.BuildTree(categories)
 
+	flatByCode := make(map[string]model.FlatCategory, len(categories))
 	for _, category := range categories {
-		if category.ParentCode == "" || categoryMap[category.ParentCode] == nil {
-			// 根节点
-			rootNodes = append(rootNodes, category)
+		if _, exists := flatByCode[category.Code]; !exists {
+			flatByCode[category.Code] = category
 		}
 	}
 
-	return gin.H{
-		"tree_structure": rootNodes,
-		"statistics": gin.H{
-			"total_nodes": len(categories),
-			"root_nodes":  len(rootNodes),
-		},
+	stats := HierarchyStatistics{RootNodes: len(rootNodes)}
+	var walk func(nodes []*model.Category, depth int)
+	walk = func(nodes []*model.Category, depth int) {
+		for _, node := range nodes {
+			stats.TotalNodes++
+			if depth > stats.MaxDepth {
+				stats.MaxDepth = depth
+			}
+			walk(node.Children, depth+1)
+		}
+	}
+	walk(rootNodes, 1)
+
+	for _, root := range rootNodes {
+		if flatByCode[root.Code].ParentCode != "" {
+			stats.OrphanRoots++
+		}
+	}
+
+	return HierarchicalStructure{
+		TreeStructure: newCategoryTreeNodes(rootNodes, flatByCode),
+		Statistics:    stats,
 	}
 }
 
@@ -685,7 +1666,7 @@ func (h *Handlers) GetRecentTasks(c *gin.Context) {
 	tasks, err := h.db.ListTasks(ctx, limit, 0)
 	if err != nil {
 		log.Printf("获取最近任务列表失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取任务列表失败"})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取任务列表失败", nil)
 		return
 	}
 
@@ -709,74 +1690,28 @@ func (h *Handlers) GetRecentTasks(c *gin.Context) {
 	})
 }
 
-// hasChildren 检查指定节点是否有子节点
-func (h *Handlers) hasChildren(ctx context.Context, taskID string, version string, code string) bool {
-	var count int64
-	
-	// 需要通过类型断言获取底层的*gorm.DB
-	pgDB, ok := h.db.(*database.PostgreSQLDB)
-	if !ok {
-		return false
-	}
-	
-	query := pgDB.GetDB().WithContext(ctx).Model(&database.Category{}).
-		Where("task_id = ? AND parent_code = ?", taskID, code)
-	
-	if version != "" {
-		// 如果指定了版本，则查询该版本下的子节点
-		query = query.Where("upload_batch_id = ?", version)
-	} else {
-		// 否则，查询最新完整版本的子节点
-		// 先获取最新完整版本的batch_id
-		versionHistory, err := h.db.GetCategoryVersionHistory(ctx, taskID)
-		if err == nil {
-			var latestCompleteVersion *database.CategoryVersion
-			for _, v := range versionHistory {
-				if v.RecordCount > 1000 {
-					if latestCompleteVersion == nil || v.UploadTimestamp.After(latestCompleteVersion.UploadTimestamp) {
-						latestCompleteVersion = v
-					}
-				}
-			}
-			if latestCompleteVersion != nil {
-				query = query.Where("upload_batch_id = ?", latestCompleteVersion.UploadBatchID)
-			} else {
-				query = query.Where("is_current = ?", true) // 降级
-			}
-		} else {
-			query = query.Where("is_current = ?", true) // 降级
-		}
-	}
-	
-	query.Count(&count)
-	return count > 0
-}
-
-// getLatestCompleteVersion 获取最新的完整版本（记录数量 > 1000）
-func (h *Handlers) getLatestCompleteVersion(ctx context.Context, taskID string) ([]*database.Category, error) {
-	// 1. 获取版本历史
+// resolveLatestCompleteBatchID 获取最新完整版本（记录数量 > 1000）的批次ID，没有时返回空字符串表示使用 is_current 版本
+func (h *Handlers) resolveLatestCompleteBatchID(ctx context.Context, taskID string) string {
 	versionHistory, err := h.db.GetCategoryVersionHistory(ctx, taskID)
 	if err != nil {
-		return nil, fmt.Errorf("获取版本历史失败: %w", err)
+		log.Printf("获取任务 %s 的版本历史失败，使用当前版本: %v", taskID, err)
+		return ""
+	}
+	if latest := latestCompleteVersion(versionHistory); latest != nil {
+		return latest.UploadBatchID
 	}
+	return ""
+}
 
-	// 2. 找到最新的完整版本（记录数量 > 1000）
-	var latestCompleteVersion *database.CategoryVersion
+// latestCompleteVersion 从版本历史中找出最新的完整版本（记录数量 > 1000）
+func latestCompleteVersion(versionHistory []*database.CategoryVersion) *database.CategoryVersion {
+	var latest *database.CategoryVersion
 	for _, version := range versionHistory {
 		if version.RecordCount > 1000 { // 只考虑完整版本
-			if latestCompleteVersion == nil || version.UploadTimestamp.After(latestCompleteVersion.UploadTimestamp) {
-				latestCompleteVersion = version
+			if latest == nil || version.UploadTimestamp.After(latest.UploadTimestamp) {
+				latest = version
 			}
 		}
 	}
-
-	// 3. 如果没有找到完整版本，降级到 is_current=true 的版本
-	if latestCompleteVersion == nil {
-		log.Printf("WARNING: 没有找到完整版本，降级使用 is_current=true 版本")
-		return h.db.GetCurrentCategoriesByTaskID(ctx, taskID)
-	}
-
-	// 4. 获取该版本的数据
-	log.Printf("使用最新完整版本: %s (记录数: %d)", latestCompleteVersion.UploadBatchID, latestCompleteVersion.RecordCount)
-	return h.db.GetCategoriesByBatchID(ctx, latestCompleteVersion.UploadBatchID)
+	return latest
 }
@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/freedkr/moonshot/internal/queue"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+// recordingQueue 记录入队的任务和取消请求，测试不会调用其他队列方法
+type recordingQueue struct {
+	queue.Client
+	enqueued  []*queue.Task
+	cancelled []string
+}
+
+func (q *recordingQueue) EnqueueTaskWithContext(ctx context.Context, task *queue.Task) error {
+	q.enqueued = append(q.enqueued, task)
+	return nil
+}
+
+func (q *recordingQueue) RequestCancel(ctx context.Context, taskID string) error {
+	q.cancelled = append(q.cancelled, taskID)
+	return nil
+}
+
+// newTestHandlerDB 创建已建表的内存SQLite数据库并写入给定任务
+func newTestHandlerDB(t *testing.T, tasks ...*database.TaskRecord) *database.SQLiteDB {
+	t.Helper()
+	ctx := context.Background()
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	for _, task := range tasks {
+		if err := db.CreateTask(ctx, task); err != nil {
+			t.Fatalf("创建任务失败: %v", err)
+		}
+	}
+	return db
+}
+
+func TestCancelTask_RejectsFinishedTasks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	flowStarted := time.Now()
+	tasks := []*database.TaskRecord{
+		{ID: "1f3a5c7e-9b1d-4f3a-8c5e-7a9b1d3f5a7c", Type: "rule", Status: "completed", Config: datatypes.JSON(`{}`)},
+		{ID: "2a4b6c8d-1e3f-4a5b-9c7d-8e1f3a5b7c9d", Type: "rule", Status: "failed", Config: datatypes.JSON(`{}`)},
+		{ID: "3b5c7d9e-2f4a-4b6c-8d9e-1f2a4b6c8d9e", Type: "rule", Status: "cancelled", Config: datatypes.JSON(`{}`)},
+		{ID: "4c6d8e1f-3a5b-4c7d-9e1f-2a3b5c7d9e1f", Type: "rule", Status: "completed", Config: datatypes.JSON(`{}`), FlowStartedAt: &flowStarted},
+		{ID: "5d7e9f2a-4b6c-4d8e-8f2a-3b4c6d8e1f2a", Type: "rule", Status: "pending", Config: datatypes.JSON(`{}`)},
+	}
+	db := newTestHandlerDB(t, tasks...)
+	q := &recordingQueue{}
+	h := NewHandlers(db, q, nil)
+	router := gin.New()
+	router.POST("/api/v1/tasks/:id/cancel", h.CancelTask)
+	cancel := func(taskID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tasks/"+taskID+"/cancel", nil))
+		return w
+	}
+
+	// 已完成（增量流程已结束）、失败和已取消的任务不能取消
+	for _, task := range tasks[:3] {
+		w := cancel(task.ID)
+		var resp ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		if w.Code != http.StatusConflict || resp.Error.Code != ErrCodeTaskFinished {
+			t.Errorf("%s: expected 409 %s, got %d %s", task.Status, ErrCodeTaskFinished, w.Code, w.Body.String())
+		}
+	}
+	if len(q.cancelled) != 0 {
+		t.Errorf("已结束的任务不应设置取消标记，实际 %v", q.cancelled)
+	}
+
+	// 后台增量流程仍在运行的已完成任务可以取消，状态保持 completed
+	if w := cancel(tasks[3].ID); w.Code != http.StatusAccepted {
+		t.Errorf("增量流程运行中的任务应返回202，实际 %d %s", w.Code, w.Body.String())
+	}
+	// 排队中的任务直接标记为已取消
+	if w := cancel(tasks[4].ID); w.Code != http.StatusAccepted {
+		t.Errorf("排队中的任务应返回202，实际 %d %s", w.Code, w.Body.String())
+	}
+	if task, err := db.GetTask(context.Background(), tasks[4].ID); err != nil || task.Status != "cancelled" {
+		t.Errorf("排队中的任务应标记为已取消，实际 %+v, %v", task, err)
+	}
+	if !reflect.DeepEqual(q.cancelled, []string{tasks[3].ID, tasks[4].ID}) {
+		t.Errorf("取消标记不正确: %v", q.cancelled)
+	}
+
+	if w := cancel("6e8f1a3b-5c7d-4e9f-9a3b-4c5d7e9f1a3b"); w.Code != http.StatusNotFound {
+		t.Errorf("不存在的任务应返回404，实际 %d", w.Code)
+	}
+}
+
+func TestBuildHierarchicalStructure_NestsFourLevels(t *testing.T) {
+	h := &Handlers{}
+	categories := []model.FlatCategory{
+		{Code: "1-01-01-01", Name: "细类", Level: "细类", ParentCode: "1-01-01", HasLLM: true, HasPDF: true},
+		{Code: "1-01-01", Name: "小类", Level: "小类", ParentCode: "1-01"},
+		{Code: "1-01", Name: "中类", Level: "中类", ParentCode: "1"},
+		{Code: "1", Name: "大类", Level: "大类"},
+		// 父节点不在当前页中，应作为根节点展示
+		{Code: "2-01-01", Name: "页外小类", Level: "小类", ParentCode: "2-01"},
+	}
+
+	result := h.buildHierarchicalStructure(categories)
+
+	if len(result.TreeStructure) != 2 {
+		t.Fatalf("Expected 2 root nodes, got %d", len(result.TreeStructure))
+	}
+
+	node := result.TreeStructure[0]
+	for _, expected := range []string{"1", "1-01", "1-01-01", "1-01-01-01"} {
+		if node == nil || node.Code != expected {
+			t.Fatalf("Expected nested node %s, got %+v", expected, node)
+		}
+		if expected == "1-01-01-01" {
+			break
+		}
+		if len(node.Children) != 1 {
+			t.Fatalf("Expected node %s to have 1 child, got %d", node.Code, len(node.Children))
+		}
+		node = node.Children[0]
+	}
+	if len(node.Children) != 0 {
+		t.Errorf("Expected leaf node to have no children, got %d", len(node.Children))
+	}
+	if node.ParentCode != "1-01-01" || !node.HasLLM || !node.HasPDF {
+		t.Errorf("Expected tree node to keep parent_code, has_llm and has_pdf, got %+v", node)
+	}
+
+	if result.TreeStructure[1].Code != "2-01-01" {
+		t.Errorf("Expected orphan 2-01-01 as root, got %s", result.TreeStructure[1].Code)
+	}
+
+	expectedStats := HierarchyStatistics{TotalNodes: 5, RootNodes: 2, OrphanRoots: 1, MaxDepth: 4}
+	if result.Statistics != expectedStats {
+		t.Errorf("Expected statistics %+v, got %+v", expectedStats, result.Statistics)
+	}
+}
+
+func TestBuildXLSXExportRow(t *testing.T) {
+	dbCat := &database.Category{
+		Code:            "1-01-01-01",
+		Name:            "规则名称",
+		Level:           "细类",
+		ParentCode:      "1-01-01",
+		PDFInfo:         `{"name":"PDF名称"}`,
+		LLMEnhancements: `{"name":"LLM名称","confidence":0.9}`,
+	}
+
+	row := buildXLSXExportRow(dbCat)
+
+	expected := []interface{}{"1-01-01-01", "规则名称", "细类", "1-01-01", "PDF名称", "LLM名称", 0.9}
+	if !reflect.DeepEqual(row, expected) {
+		t.Errorf("Expected row %v, got %v", expected, row)
+	}
+
+	// 没有增强数据时对应列为空
+	row = buildXLSXExportRow(&database.Category{Code: "1", Name: "大类", Level: "大类"})
+	if row[4] != "" || row[5] != "" || row[6] != nil {
+		t.Errorf("Expected empty enrichment columns, got %v", row[4:])
+	}
+}
+
+func TestActiveTaskQueuePosition(t *testing.T) {
+	tests := []struct {
+		name     string
+		active   int64
+		limit    int
+		expected int64
+	}{
+		{"不限制", 100, 0, 0},
+		{"未达上限", 2, 3, 0},
+		{"刚好达到上限", 3, 3, 1},
+		{"超出上限", 5, 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := activeTaskQueuePosition(tt.active, tt.limit); got != tt.expected {
+				t.Errorf("Expected queue position %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFindHierarchyCorrections(t *testing.T) {
+	categories := []*database.Category{
+		{Code: "1", Level: "大类"},
+		{Code: "1-01", Level: "中类", ParentCode: "1"},
+		{Code: "1-01-01", Level: "细类", ParentCode: "1-01"},             // 层级错误
+		{Code: "1-01-01-01", Level: "细类", ParentCode: "1-01"},          // 父级错误
+		{Code: "1-01-01-01-01", Level: "细类", ParentCode: "1-01-01-01"}, // 超出细类，保留原层级
+	}
+
+	corrections := findHierarchyCorrections(categories)
+
+	expected := []HierarchyCorrection{
+		{Code: "1-01-01", OldParentCode: "1-01", NewParentCode: "1-01", OldLevel: "细类", NewLevel: "小类"},
+		{Code: "1-01-01-01", OldParentCode: "1-01", NewParentCode: "1-01-01", OldLevel: "细类", NewLevel: "细类"},
+	}
+	if !reflect.DeepEqual(corrections, expected) {
+		t.Errorf("Expected corrections %+v, got %+v", expected, corrections)
+	}
+}
+
+func TestGetTasksStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tasks := []*database.TaskRecord{
+		{ID: "7f9a2b4c-6d8e-4f1a-9b2c-5d6e8f1a2b4c", Type: "rule", Status: "processing", Config: datatypes.JSON(`{}`)},
+		{ID: "8a1b3c5d-7e9f-4a2b-8c3d-6e7f9a2b3c5d", Type: "rule", Status: "failed", ErrorMsg: "解析失败", Config: datatypes.JSON(`{}`)},
+	}
+	db := newTestHandlerDB(t, tasks...)
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/tasks/status", h.GetTasksStatus)
+
+	type statusResponse struct {
+		Statuses map[string]TaskStatusSummary `json:"statuses"`
+		Missing  []string                     `json:"missing"`
+		Count    int                          `json:"count"`
+	}
+	query := func(body string) (*httptest.ResponseRecorder, statusResponse) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tasks/status", strings.NewReader(body)))
+		var resp statusResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+		}
+		return w, resp
+	}
+
+	// 全部存在时 missing 为空列表
+	w, resp := query(`{"task_ids":["` + tasks[0].ID + `","` + tasks[1].ID + `"]}`)
+	if w.Code != http.StatusOK || resp.Count != 2 {
+		t.Fatalf("expected 200 with 2 statuses, got %d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"missing":[]`) {
+		t.Errorf("missing 应序列化为空列表，实际 %s", w.Body.String())
+	}
+	processing := resp.Statuses[tasks[0].ID]
+	if processing.Status != "processing" || processing.Progress == nil || *processing.Progress != taskStatusProgress["processing"] {
+		t.Errorf("处理中任务的状态摘要不正确: %+v", processing)
+	}
+	if failed := resp.Statuses[tasks[1].ID]; failed.Status != "failed" || failed.ErrorMsg != "解析失败" {
+		t.Errorf("失败任务的状态摘要不正确: %+v", failed)
+	}
+
+	// 不存在和非法的ID都列入 missing
+	unknownID := "9b2c4d6e-8f1a-4b3c-9d4e-7f8a1b3c4d6e"
+	w, resp = query(`{"task_ids":["` + tasks[0].ID + `","` + unknownID + `","not-a-uuid"]}`)
+	if w.Code != http.StatusOK || resp.Count != 1 {
+		t.Fatalf("expected 200 with 1 status, got %d %s", w.Code, w.Body.String())
+	}
+	if !reflect.DeepEqual(resp.Missing, []string{unknownID, "not-a-uuid"}) {
+		t.Errorf("missing 不正确: %v", resp.Missing)
+	}
+
+	// 空列表被参数校验拒绝
+	if w, _ := query(`{"task_ids":[]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("空的 task_ids 应返回400，实际 %d", w.Code)
+	}
+}
+
+func TestGetCategoryDetail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db := newTestHandlerDB(t)
+	taskID := "1c3e5a7c-9e1a-4c3e-8a5c-7e9a1c3e5a7c"
+	categories := []*database.Category{
+		{TaskID: taskID, Code: "6-01", Name: "焊接人员", Level: "中类", Status: database.StatusCompleted},
+		{TaskID: taskID, Code: "6-01-01", Name: "焊工", Level: "小类", ParentCode: "6-01", Status: database.StatusCompleted,
+			PDFInfo:         `{"name":"电焊工","confidence":0.9}`,
+			LLMEnhancements: `{"selected_from":"rule","confidence":0.8}`},
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, "2d4f6b8d-1f3b-4d5f-9b7d-8f1b3d5f7b9d", categories); err != nil {
+		t.Fatalf("插入分类失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/data/category", h.GetCategoryDetail)
+	get := func(taskID, code string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/data/category?task_id="+taskID+"&code="+code, nil))
+		return w
+	}
+
+	w := get(taskID, "6-01-01")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	var detail CategoryDetail
+	if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if detail.Code != "6-01-01" || detail.Name != "焊工" || detail.ParentCode != "6-01" || !detail.IsCurrent {
+		t.Errorf("分类详情不正确: %+v", detail)
+	}
+	if detail.PDFInfo["name"] != "电焊工" || detail.Selection == nil || detail.Selection.AlternativeName != "电焊工" ||
+		detail.Selection.Confidence == nil || *detail.Selection.Confidence != 0.8 {
+		t.Errorf("PDF和LLM增强信息解析不正确: %+v, %+v", detail.PDFInfo, detail.Selection)
+	}
+
+	// 未知编码和未知任务都返回404
+	for name, tc := range map[string][2]string{
+		"unknown code": {taskID, "6-01-09"},
+		"unknown task": {"3e5a7c9e-2a4c-4e6a-9c8e-1a3c5e7a9c1e", "6-01-01"},
+	} {
+		w := get(tc[0], tc[1])
+		var resp ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: 解析响应失败: %v", name, err)
+		}
+		if w.Code != http.StatusNotFound || resp.Error.Code != ErrCodeNotFound {
+			t.Errorf("%s: expected 404 %s, got %d %s", name, ErrCodeNotFound, w.Code, w.Body.String())
+		}
+	}
+
+	if w := get(taskID, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("缺少 code 参数应返回400，实际 %d", w.Code)
+	}
+}
+
+func TestGetTaskLogs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	withLogs := &database.TaskRecord{ID: "4f6a8c1e-3b5d-4f7a-9c1e-2b4d6f8a1c3e", Type: "rule", Status: "completed",
+		ProcessingLog: "解析完成", Config: datatypes.JSON(`{}`)}
+	withoutLogs := &database.TaskRecord{ID: "5a7b9d2f-4c6e-4a8b-8d2f-3c5e7a9b2d4f", Type: "rule", Status: "pending", Config: datatypes.JSON(`{}`)}
+	db := newTestHandlerDB(t, withLogs, withoutLogs)
+	if err := db.CreateProcessingStats(ctx, &database.ProcessingStats{
+		TaskID: withLogs.ID, TotalRecords: 10, ProcessedRecords: 8, SkippedRecords: 2,
+		ParseWarnings: datatypes.JSON(`[{"row":3,"cell":"E3","reason":"细类编码格式无效"}]`),
+	}); err != nil {
+		t.Fatalf("保存处理统计失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/tasks/:id/logs", h.GetTaskLogs)
+	type logsResponse struct {
+		ProcessingLog          string                 `json:"processing_log"`
+		HasStats               bool                   `json:"has_stats"`
+		Stats                  map[string]interface{} `json:"stats"`
+		ParseWarnings          []model.ParseWarning   `json:"parse_warnings"`
+		ParseWarningsTruncated bool                   `json:"parse_warnings_truncated"`
+	}
+	get := func(taskID string) (*httptest.ResponseRecorder, logsResponse) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+taskID+"/logs", nil))
+		var resp logsResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+		}
+		return w, resp
+	}
+
+	w, resp := get(withLogs.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	if resp.ProcessingLog != "解析完成" || !resp.HasStats || resp.Stats["skipped_records"] != float64(2) {
+		t.Errorf("日志或统计不正确: %+v", resp)
+	}
+	if len(resp.ParseWarnings) != 1 || resp.ParseWarnings[0].Cell != "E3" || !resp.ParseWarningsTruncated {
+		t.Errorf("解析警告不正确: %+v, truncated=%v", resp.ParseWarnings, resp.ParseWarningsTruncated)
+	}
+
+	// 没有日志和统计时返回空列表而不是 null
+	w, resp = get(withoutLogs.ID)
+	if w.Code != http.StatusOK || resp.HasStats || resp.ProcessingLog != "" {
+		t.Fatalf("expected 200 without stats, got %d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"parse_warnings":[]`) {
+		t.Errorf("parse_warnings 应序列化为空列表，实际 %s", w.Body.String())
+	}
+
+	w, _ = get("6b8c1e3a-5d7f-4b9c-9e3a-4d6f8b1c3e5a")
+	var errResp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if w.Code != http.StatusNotFound || errResp.Error.Code != ErrCodeTaskNotFound {
+		t.Errorf("expected 404 %s, got %d %s", ErrCodeTaskNotFound, w.Code, w.Body.String())
+	}
+}
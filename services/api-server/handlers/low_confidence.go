@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/integration"
+	"github.com/gin-gonic/gin"
+)
+
+// LowConfidenceNode 置信度低于阈值、需要人工复核的分类
+type LowConfidenceNode struct {
+	Code         string  `json:"code"`
+	Name         string  `json:"name"`
+	Level        string  `json:"level"`
+	ParentCode   string  `json:"parent_code"`
+	Status       string  `json:"status"`
+	Confidence   float64 `json:"confidence"`
+	LLMName      string  `json:"llm_name,omitempty"`
+	KeptRuleName bool    `json:"kept_rule_name"` // 处理时因置信度过低未应用LLM名称
+}
+
+// SetMinConfidence 设置低置信度复核列表的默认阈值，与增量处理使用的 LLM_MIN_CONFIDENCE 一致
+func (h *Handlers) SetMinConfidence(minConfidence float64) {
+	h.minConfidence = minConfidence
+}
+
+// GetLowConfidenceNodes 列出当前版本中语义选择置信度低于阈值的分类，供人工复核
+// 阈值默认使用配置的最低置信度，可通过 min_confidence 参数覆盖；未返回置信度的分类不在列表中
+func (h *Handlers) GetLowConfidenceNodes(c *gin.Context) {
+	taskID := c.Query("task_id")
+	if taskID == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id 参数", nil)
+		return
+	}
+
+	threshold := h.minConfidence
+	if v := c.Query("min_confidence"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "min_confidence 必须在 0 到 1 之间", nil)
+			return
+		}
+		threshold = parsed
+	}
+	if threshold <= 0 {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "未配置最低置信度，请通过 min_confidence 参数指定", nil)
+		return
+	}
+
+	categories, err := h.db.GetCurrentCategoriesByTaskID(c.Request.Context(), taskID)
+	if err != nil {
+		log.Printf("获取任务 %s 的分类失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取分类数据失败", nil)
+		return
+	}
+
+	nodes := make([]LowConfidenceNode, 0)
+	for _, cat := range categories {
+		if node, ok := lowConfidenceNode(cat, threshold); ok {
+			nodes = append(nodes, node)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":        taskID,
+		"min_confidence": threshold,
+		"total":          len(categories),
+		"count":          len(nodes),
+		"nodes":          nodes,
+	})
+}
+
+// lowConfidenceNode 判断分类的语义选择置信度是否低于阈值
+func lowConfidenceNode(cat *database.Category, threshold float64) (LowConfidenceNode, bool) {
+	if cat.LLMEnhancements == "" {
+		return LowConfidenceNode{}, false
+	}
+	var enhancements map[string]interface{}
+	if err := json.Unmarshal([]byte(cat.LLMEnhancements), &enhancements); err != nil {
+		log.Printf("解析分类 %s 的 llm_enhancements 失败: %v", cat.Code, err)
+		return LowConfidenceNode{}, false
+	}
+	confidence, ok := enhancements["confidence"].(float64)
+	if !ok || confidence >= threshold {
+		return LowConfidenceNode{}, false
+	}
+
+	node := LowConfidenceNode{
+		Code:       cat.Code,
+		Name:       cat.Name,
+		Level:      cat.Level,
+		ParentCode: cat.ParentCode,
+		Status:     cat.Status,
+		Confidence: confidence,
+	}
+	node.LLMName, _ = enhancements["name"].(string)
+	if _, kept := enhancements[integration.ConfidenceReviewKey]; kept {
+		node.KeptRuleName = true
+	}
+	return node, true
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetLowConfidenceNodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	taskID := "2e4f6a8c-0b1d-4e3f-9a5c-7d9e1f3a5b7c"
+	categories := []*database.Category{
+		{TaskID: taskID, Code: "1-01-01-01", Name: "焊工", Level: "细类", Status: database.StatusCompleted,
+			LLMEnhancements: `{"code":"1-01-01-01","name":"焊接工","confidence":0.3,"confidence_review":{"action":"kept_rule_name"}}`},
+		{TaskID: taskID, Code: "1-01-01-02", Name: "钳工", Level: "细类", Status: database.StatusCompleted,
+			LLMEnhancements: `{"code":"1-01-01-02","name":"钳工","confidence":0.55}`},
+		{TaskID: taskID, Code: "1-01-01-03", Name: "车工", Level: "细类", Status: database.StatusCompleted,
+			LLMEnhancements: `{"code":"1-01-01-03","name":"车工","confidence":0.9}`},
+		{TaskID: taskID, Code: "1-01-01-04", Name: "铣工", Level: "细类", Status: database.StatusExcelParsed},
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, "6a8c0e2f-4b6d-4f8a-8c0e-2f4a6b8d0e1f", categories); err != nil {
+		t.Fatalf("插入分类失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/data/low-confidence", h.GetLowConfidenceNodes)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/data/low-confidence?"+query, nil))
+		return w
+	}
+
+	// 未配置阈值且未指定参数
+	if w := get("task_id=" + taskID); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without threshold, got %d", w.Code)
+	}
+
+	h.SetMinConfidence(0.5)
+	var body struct {
+		Count int                 `json:"count"`
+		Nodes []LowConfidenceNode `json:"nodes"`
+	}
+	w := get("task_id=" + taskID)
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if w.Code != http.StatusOK || body.Count != 1 || body.Nodes[0].Code != "1-01-01-01" {
+		t.Fatalf("Expected only 1-01-01-01 below 0.5, got %d %s", w.Code, w.Body.String())
+	}
+	if node := body.Nodes[0]; !node.KeptRuleName || node.LLMName != "焊接工" || node.Name != "焊工" {
+		t.Errorf("Unexpected node: %+v", node)
+	}
+
+	// 参数覆盖配置的阈值
+	w = get("task_id=" + taskID + "&min_confidence=0.6")
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if body.Count != 2 {
+		t.Errorf("Expected 2 nodes below 0.6, got %d", body.Count)
+	}
+
+	if w := get("task_id=" + taskID + "&min_confidence=1.5"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid threshold, got %d", w.Code)
+	}
+}
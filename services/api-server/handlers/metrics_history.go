@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultMetricsBucket 指标趋势的默认时间桶
+	DefaultMetricsBucket = time.Hour
+	// minMetricsBucket 指标趋势允许的最小时间桶
+	minMetricsBucket = time.Minute
+	// maxMetricsBuckets 单次查询允许的最大时间桶数，避免窗口很长时桶过细
+	maxMetricsBuckets = 2000
+)
+
+// MetricsTrendPoint 一个时间桶内某个阶段的指标，由桶内所有实例的快照合并而成
+type MetricsTrendPoint struct {
+	Stage         string    `json:"stage"`
+	BucketStart   time.Time `json:"bucket_start"`
+	DurationCount int64     `json:"duration_count"`
+	AvgDurationMs float64   `json:"avg_duration_ms"` // 按记录时长的次数加权
+	SuccessCount  int64     `json:"success_count"`
+	ErrorCount    int64     `json:"error_count"`
+}
+
+// MetricsHistory 指标快照的历史趋势
+type MetricsHistory struct {
+	Window string              `json:"window"`
+	Bucket string              `json:"bucket"`
+	Since  time.Time           `json:"since"`
+	Stage  string              `json:"stage,omitempty"`
+	Source string              `json:"source,omitempty"`
+	Points []MetricsTrendPoint `json:"points"`
+}
+
+// GetMetricsHistory 按时间桶汇总导出的指标快照，查看各阶段耗时、成功和失败次数的历史趋势
+// 查询参数 since 为时间窗口（默认 7d），bucket 为时间桶（默认 1h），stage 和 source 可选，分别按阶段和导出实例过滤
+func (h *Handlers) GetMetricsHistory(c *gin.Context) {
+	window, err := parseSummaryWindow(c.Query("since"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), gin.H{"since": c.Query("since")})
+		return
+	}
+	bucket, err := parseMetricsBucket(c.Query("bucket"), window)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), gin.H{"bucket": c.Query("bucket")})
+		return
+	}
+
+	since := time.Now().Add(-window)
+	filter := database.MetricsSnapshotFilter{
+		Source: c.Query("source"),
+		Stage:  c.Query("stage"),
+		Since:  since,
+	}
+	snapshots, err := h.db.ListMetricsSnapshots(c.Request.Context(), filter)
+	if err != nil {
+		log.Printf("获取指标快照失败: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取指标快照失败", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, MetricsHistory{
+		Window: formatSummaryWindow(window),
+		Bucket: formatSummaryWindow(bucket),
+		Since:  since,
+		Stage:  filter.Stage,
+		Source: filter.Source,
+		Points: aggregateMetricsTrend(snapshots, bucket),
+	})
+}
+
+// parseMetricsBucket 解析时间桶，格式与时间窗口相同；为空时使用默认时间桶，不超过窗口
+func parseMetricsBucket(v string, window time.Duration) (time.Duration, error) {
+	if v == "" {
+		return min(DefaultMetricsBucket, window), nil
+	}
+	bucket, err := parseSummaryWindow(v)
+	if err != nil {
+		return 0, fmt.Errorf("bucket 格式无效: %s，应为 1h、1d 等", v)
+	}
+	if bucket < minMetricsBucket {
+		return 0, fmt.Errorf("bucket 不能小于 %s", minMetricsBucket)
+	}
+	if window/bucket > maxMetricsBuckets {
+		return 0, fmt.Errorf("时间桶过多：窗口 %s 按 %s 划分超过 %d 个", formatSummaryWindow(window), formatSummaryWindow(bucket), maxMetricsBuckets)
+	}
+	return bucket, nil
+}
+
+// aggregateMetricsTrend 将快照按阶段和时间桶合并，结果按阶段、时间排序
+func aggregateMetricsTrend(snapshots []*database.MetricsSnapshot, bucket time.Duration) []MetricsTrendPoint {
+	type key struct {
+		stage string
+		start time.Time
+	}
+	points := make(map[key]*MetricsTrendPoint)
+	totalMs := make(map[key]float64)
+	for _, s := range snapshots {
+		k := key{stage: s.Stage, start: s.CreatedAt.Truncate(bucket)}
+		point, ok := points[k]
+		if !ok {
+			point = &MetricsTrendPoint{Stage: k.stage, BucketStart: k.start}
+			points[k] = point
+		}
+		point.DurationCount += s.DurationCount
+		point.SuccessCount += s.SuccessCount
+		point.ErrorCount += s.ErrorCount
+		totalMs[k] += s.AvgDurationMs * float64(s.DurationCount)
+	}
+
+	result := make([]MetricsTrendPoint, 0, len(points))
+	for k, point := range points {
+		if point.DurationCount > 0 {
+			point.AvgDurationMs = totalMs[k] / float64(point.DurationCount)
+		}
+		result = append(result, *point)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Stage != result[j].Stage {
+			return result[i].Stage < result[j].Stage
+		}
+		return result[i].BucketStart.Before(result[j].BucketStart)
+	})
+	return result
+}
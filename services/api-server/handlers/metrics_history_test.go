@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseMetricsBucket(t *testing.T) {
+	cases := []struct {
+		in      string
+		window  time.Duration
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 7 * 24 * time.Hour, time.Hour, false},
+		{"", 30 * time.Minute, 30 * time.Minute, false},
+		{"1d", 30 * 24 * time.Hour, 24 * time.Hour, false},
+		{"5m", 24 * time.Hour, 5 * time.Minute, false},
+		{"30s", time.Hour, 0, true},
+		{"1m", 7 * 24 * time.Hour, 0, true},
+		{"abc", time.Hour, 0, true},
+	}
+	for _, tc := range cases {
+		got, err := parseMetricsBucket(tc.in, tc.window)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("parseMetricsBucket(%q, %v) = %v, %v", tc.in, tc.window, got, err)
+		}
+	}
+}
+
+func TestGetMetricsHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	// 两个实例在同一小时内的快照合并为一个点，平均时长按次数加权
+	hour := time.Now().Add(-2 * time.Hour).Truncate(time.Hour)
+	snapshots := []*database.MetricsSnapshot{
+		{Source: "worker-1", Stage: "llm_enhancement", DurationCount: 3, AvgDurationMs: 100, SuccessCount: 3, PeriodStart: hour, CreatedAt: hour.Add(5 * time.Minute)},
+		{Source: "worker-2", Stage: "llm_enhancement", DurationCount: 1, AvgDurationMs: 500, ErrorCount: 1, PeriodStart: hour, CreatedAt: hour.Add(10 * time.Minute)},
+		{Source: "worker-1", Stage: "llm_enhancement", DurationCount: 2, AvgDurationMs: 50, PeriodStart: hour, CreatedAt: hour.Add(70 * time.Minute)},
+		{Source: "worker-1", Stage: "merge", SuccessCount: 4, PeriodStart: hour, CreatedAt: hour.Add(5 * time.Minute)},
+	}
+	if err := db.SaveMetricsSnapshots(ctx, snapshots); err != nil {
+		t.Fatalf("写入快照失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/monitor/metrics/history", h.GetMetricsHistory)
+	get := func(query string) (*httptest.ResponseRecorder, MetricsHistory) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/monitor/metrics/history"+query, nil))
+		var body MetricsHistory
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+		}
+		return w, body
+	}
+
+	w, body := get("?since=1d&stage=llm_enhancement")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if body.Window != "1d" || body.Bucket != "1h" || len(body.Points) != 2 {
+		t.Fatalf("unexpected history: %+v", body)
+	}
+	first := body.Points[0]
+	if !first.BucketStart.Equal(hour) || first.DurationCount != 4 || first.AvgDurationMs != 200 || first.SuccessCount != 3 || first.ErrorCount != 1 {
+		t.Errorf("unexpected first point: %+v", first)
+	}
+	if second := body.Points[1]; !second.BucketStart.Equal(hour.Add(time.Hour)) || second.DurationCount != 2 {
+		t.Errorf("unexpected second point: %+v", second)
+	}
+
+	_, body = get("?since=1d&bucket=1d&source=worker-1")
+	if len(body.Points) != 2 || body.Points[0].Stage != "llm_enhancement" || body.Points[1].Stage != "merge" {
+		t.Errorf("按实例过滤、按天汇总的结果错误: %+v", body.Points)
+	}
+
+	if w, _ := get("?bucket=10s"); w.Code != http.StatusBadRequest {
+		t.Errorf("过小的时间桶应返回 400, 实际 %d", w.Code)
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultSummaryWindow 汇总统计的默认时间窗口
+	DefaultSummaryWindow = 7 * 24 * time.Hour
+	// maxSummaryWindow 汇总统计允许的最大时间窗口
+	maxSummaryWindow = 366 * 24 * time.Hour
+	// summaryCacheTTL 汇总结果的缓存时间，仪表盘频繁刷新时避免重复执行聚合查询
+	summaryCacheTTL = 30 * time.Second
+)
+
+// MonitorSummary 所有任务的汇总统计
+type MonitorSummary struct {
+	Window      string    `json:"window"`
+	Since       time.Time `json:"since"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Cached      bool      `json:"cached"`
+	*database.TaskSummary
+	EstimatedCost *float64 `json:"estimated_cost,omitempty"` // 按配置的每千token单价估算，未配置单价时不返回
+}
+
+// summaryCache 按时间窗口缓存汇总结果
+type summaryCache struct {
+	mu      sync.Mutex
+	entries map[time.Duration]MonitorSummary
+}
+
+func (sc *summaryCache) get(window time.Duration, now time.Time) (MonitorSummary, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	summary, ok := sc.entries[window]
+	if !ok || now.Sub(summary.GeneratedAt) > summaryCacheTTL {
+		return MonitorSummary{}, false
+	}
+	return summary, true
+}
+
+func (sc *summaryCache) put(window time.Duration, summary MonitorSummary) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.entries == nil {
+		sc.entries = make(map[time.Duration]MonitorSummary)
+	}
+	sc.entries[window] = summary
+}
+
+// SetTokenCost 设置估算LLM费用使用的每千token单价，0 表示不估算
+func (h *Handlers) SetTokenCost(per1K float64) {
+	h.tokenCostPer1K = per1K
+}
+
+// GetMonitorSummary 汇总时间窗口内的任务数、各状态任务数、处理记录数、平均处理耗时和LLM token消耗
+// 查询参数 since 为时间窗口，如 7d、24h、90m，默认 7d；结果缓存 30 秒
+func (h *Handlers) GetMonitorSummary(c *gin.Context) {
+	window, err := parseSummaryWindow(c.Query("since"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), gin.H{"since": c.Query("since")})
+		return
+	}
+
+	now := time.Now()
+	if summary, ok := h.summaryCache.get(window, now); ok {
+		summary.Cached = true
+		c.JSON(http.StatusOK, summary)
+		return
+	}
+
+	since := now.Add(-window)
+	taskSummary, err := h.db.GetTaskSummary(c.Request.Context(), since)
+	if err != nil {
+		log.Printf("统计任务汇总失败: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "统计任务汇总失败", nil)
+		return
+	}
+
+	summary := MonitorSummary{
+		Window:      formatSummaryWindow(window),
+		Since:       since,
+		GeneratedAt: now,
+		TaskSummary: taskSummary,
+	}
+	if h.tokenCostPer1K > 0 {
+		cost := float64(taskSummary.TotalTokens) / 1000 * h.tokenCostPer1K
+		summary.EstimatedCost = &cost
+	}
+	h.summaryCache.put(window, summary)
+	c.JSON(http.StatusOK, summary)
+}
+
+// parseSummaryWindow 解析时间窗口，支持按天的 Nd 和 time.ParseDuration 格式，为空时使用默认窗口
+func parseSummaryWindow(v string) (time.Duration, error) {
+	if v == "" {
+		return DefaultSummaryWindow, nil
+	}
+	var window time.Duration
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("since 格式无效: %s，应为 7d、24h 等", v)
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("since 格式无效: %s，应为 7d、24h 等", v)
+		}
+		window = parsed
+	}
+	if window <= 0 || window > maxSummaryWindow {
+		return 0, fmt.Errorf("since 必须大于0且不超过 %d 天", int(maxSummaryWindow.Hours()/24))
+	}
+	return window, nil
+}
+
+// formatSummaryWindow 整天数的窗口格式化为 Nd，其余使用 time.Duration 格式并去掉末尾为0的单位，如 1h、1h30m
+func formatSummaryWindow(window time.Duration) string {
+	if window%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", window/(24*time.Hour))
+	}
+	formatted := window.String()
+	if strings.HasSuffix(formatted, "m0s") {
+		formatted = strings.TrimSuffix(formatted, "0s")
+	}
+	if strings.HasSuffix(formatted, "h0m") {
+		formatted = strings.TrimSuffix(formatted, "0m")
+	}
+	return formatted
+}
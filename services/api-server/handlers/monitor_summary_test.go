@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+func TestParseSummaryWindow(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", DefaultSummaryWindow, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"24h", 24 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"400d", 0, true},
+		{"abc", 0, true},
+		{"xd", 0, true},
+	}
+	for _, tc := range cases {
+		got, err := parseSummaryWindow(tc.in)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("parseSummaryWindow(%q) = %v, %v", tc.in, got, err)
+		}
+	}
+}
+
+func TestFormatSummaryWindow(t *testing.T) {
+	cases := map[time.Duration]string{
+		7 * 24 * time.Hour: "7d",
+		time.Hour:          "1h",
+		90 * time.Minute:   "1h30m",
+		5 * time.Minute:    "5m",
+		90 * time.Second:   "1m30s",
+	}
+	for window, want := range cases {
+		if got := formatSummaryWindow(window); got != want {
+			t.Errorf("formatSummaryWindow(%v) = %q, want %q", window, got, want)
+		}
+	}
+}
+
+func TestGetMonitorSummary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	task := &database.TaskRecord{
+		ID:        "9d1f3b5d-7e9a-4c1d-8f3b-5d7e9a1c3d5f",
+		Type:      "rule",
+		Status:    "completed",
+		Config:    datatypes.JSON(`{}`),
+		Result:    datatypes.JSON(`{"processing_report":{"token_usage":{"prompt_tokens":1500,"completion_tokens":500,"total_tokens":2000}}}`),
+		CreatedAt: time.Now(),
+	}
+	if err := db.CreateTask(ctx, task); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	h.SetTokenCost(0.5)
+	router := gin.New()
+	router.GET("/api/v1/monitor/summary", h.GetMonitorSummary)
+
+	get := func(query string) (*httptest.ResponseRecorder, MonitorSummary) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/monitor/summary"+query, nil))
+		var body MonitorSummary
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+		}
+		return w, body
+	}
+
+	w, body := get("?since=1d")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if body.Window != "1d" || body.Cached || body.TaskSummary == nil || body.TotalTasks != 1 || body.TotalTokens != 2000 {
+		t.Errorf("Unexpected summary: %s", w.Body.String())
+	}
+	if body.EstimatedCost == nil || *body.EstimatedCost != 1.0 {
+		t.Errorf("Expected estimated_cost 1.0, got %s", w.Body.String())
+	}
+
+	// 缓存期内新增的任务不会反映在结果中
+	task.ID = "0e2a4c6e-8f0b-4d2e-9a4c-6e8f0b2d4e6a"
+	if err := db.CreateTask(ctx, task); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	_, body = get("?since=1d")
+	if !body.Cached || body.TotalTasks != 1 {
+		t.Errorf("Expected cached summary with 1 task, got cached=%v total=%d", body.Cached, body.TotalTasks)
+	}
+	// 24h 与 1d 是同一窗口，共用缓存；不同窗口单独缓存
+	_, body = get("?since=24h")
+	if body.Window != "1d" || !body.Cached {
+		t.Errorf("Expected 24h to share the 1d cache entry, got window=%s cached=%v", body.Window, body.Cached)
+	}
+	_, body = get("?since=2d")
+	if body.Cached || body.TotalTasks != 2 {
+		t.Errorf("Expected fresh summary with 2 tasks, got cached=%v total=%d", body.Cached, body.TotalTasks)
+	}
+
+	w, _ = get("?since=forever")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid since, got %d", w.Code)
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+// PoolStatsResponse 数据库连接池状态
+type PoolStatsResponse struct {
+	Pool      *database.PoolStats `json:"database_pool"`
+	Timestamp time.Time           `json:"timestamp"`
+}
+
+// GetDatabasePoolStats 返回 api-server 数据库连接池的当前状态，供监控定期采集以发现连接耗尽和等待
+// 计数类字段（wait_count、wait_duration_ms 等）为进程启动以来的累计值
+func (h *Handlers) GetDatabasePoolStats(c *gin.Context) {
+	stats, err := h.db.PoolStats()
+	if err != nil {
+		log.Printf("获取数据库连接池状态失败: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取数据库连接池状态失败", nil)
+		return
+	}
+	c.JSON(http.StatusOK, PoolStatsResponse{Pool: stats, Timestamp: time.Now()})
+}
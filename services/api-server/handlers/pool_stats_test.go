@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetDatabasePoolStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(context.Background()); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/monitor/db/pool", h.GetDatabasePoolStats)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/monitor/db/pool", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var body PoolStatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	// SQLite只保留一个连接
+	if body.Pool == nil || body.Pool.MaxOpenConnections != 1 || body.Pool.OpenConnections != 1 || body.Timestamp.IsZero() {
+		t.Errorf("Unexpected pool stats response: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestReady_ReportsPoolStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(context.Background()); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/ready", h.Ready)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var body struct {
+		Status string              `json:"status"`
+		Pool   *database.PoolStats `json:"database_pool"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	// SQLite只保留一个连接
+	if body.Status != "ready" || body.Pool == nil || body.Pool.MaxOpenConnections != 1 || body.Pool.OpenConnections != 1 {
+		t.Errorf("Unexpected ready response: %s", w.Body.String())
+	}
+}
+
+func TestReady_ReportsSchemaDrift(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	if err := db.WithContext(ctx).Exec("ALTER TABLE moonshot.categories DROP COLUMN pdf_info").Error; err != nil {
+		t.Fatalf("删除列失败: %v", err)
+	}
+	check, err := db.CheckSchema(ctx)
+	if err != nil {
+		t.Fatalf("检查表结构失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	h.SetSchemaCheck(check)
+	router := gin.New()
+	router.GET("/api/v1/ready", h.Ready)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Details struct {
+				Schema database.SchemaCheck `json:"schema"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Error.Code != ErrCodeServiceUnavailable || !strings.Contains(resp.Error.Message, "categories.pdf_info") {
+		t.Errorf("Unexpected error: %+v", resp.Error)
+	}
+	if len(resp.Error.Details.Schema.MissingColumns) != 1 || resp.Error.Details.Schema.MissingColumns[0] != "categories.pdf_info" {
+		t.Errorf("Unexpected schema details: %+v", resp.Error.Details.Schema)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// 下载结果的JSON格式版本
+// v1 为最初的扁平分类数组，字段固定，已有集成依赖其结构；
+// v2 在对象中返回分类及增强详情，新增字段只加到 v2（及之后的版本）
+const (
+	ResultSchemaV1      = "v1"
+	ResultSchemaV2      = "v2"
+	DefaultResultSchema = ResultSchemaV1
+)
+
+// ResultSchemaHeader 响应中标明实际使用的结果格式版本
+const ResultSchemaHeader = "X-Result-Schema"
+
+// resultSchemaMediaTypePrefix 通过 Accept 协商格式版本的媒体类型前缀，如 application/vnd.moonshot.result.v2+json
+const resultSchemaMediaTypePrefix = "application/vnd.moonshot.result."
+
+// ResultCategoryV2 v2 格式的分类，包含名称来源和增强详情
+type ResultCategoryV2 struct {
+	Code       string   `json:"code"`
+	Name       string   `json:"name"`
+	Level      string   `json:"level"`
+	ParentCode string   `json:"parent_code"`
+	Status     string   `json:"status"`
+	DataSource string   `json:"data_source"`
+	RuleName   string   `json:"rule_name,omitempty"` // 规则解析得到的名称
+	PDFName    string   `json:"pdf_name,omitempty"`
+	LLMName    string   `json:"llm_name,omitempty"`
+	Confidence *float64 `json:"confidence,omitempty"`
+	Overridden bool     `json:"overridden"` // 名称来自人工修正
+}
+
+// ResultV2 v2 格式的下载结果
+type ResultV2 struct {
+	Schema     string             `json:"schema"`
+	TaskID     string             `json:"task_id"`
+	BatchID    string             `json:"batch_id,omitempty"`
+	Count      int                `json:"count"`
+	Categories []ResultCategoryV2 `json:"categories"`
+}
+
+// negotiateResultSchema 按 ?schema= 参数、Accept 头的顺序确定格式版本，都未指定时使用 v1
+func negotiateResultSchema(c *gin.Context) (string, error) {
+	if schema := c.Query("schema"); schema != "" {
+		if schema != ResultSchemaV1 && schema != ResultSchemaV2 {
+			return "", fmt.Errorf("不支持的结果格式版本: %s，可选 %s、%s", schema, ResultSchemaV1, ResultSchemaV2)
+		}
+		return schema, nil
+	}
+	for _, part := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if version, ok := strings.CutPrefix(mediaType, resultSchemaMediaTypePrefix); ok {
+			version = strings.TrimSuffix(version, "+json")
+			if version == ResultSchemaV1 || version == ResultSchemaV2 {
+				return version, nil
+			}
+		}
+	}
+	return DefaultResultSchema, nil
+}
+
+// buildResultPayload 按格式版本将数据库记录转换为下载结果
+func buildResultPayload(schema, taskID string, dbCategories []*database.Category) interface{} {
+	if schema == ResultSchemaV2 {
+		result := ResultV2{
+			Schema:     ResultSchemaV2,
+			TaskID:     taskID,
+			Count:      len(dbCategories),
+			Categories: make([]ResultCategoryV2, len(dbCategories)),
+		}
+		for i, dbCat := range dbCategories {
+			result.Categories[i] = newResultCategoryV2(dbCat)
+		}
+		if len(dbCategories) > 0 {
+			result.BatchID = dbCategories[0].UploadBatchID
+		}
+		return result
+	}
+
+	flatCategories := make([]model.FlatCategory, len(dbCategories))
+	for i, dbCat := range dbCategories {
+		flatCategories[i] = newResultCategoryV1(dbCat)
+	}
+	return flatCategories
+}
+
+// newResultCategoryV1 v1 格式只包含编码、名称、层级和父级编码，其余字段保持零值以兼容旧客户端
+func newResultCategoryV1(dbCat *database.Category) model.FlatCategory {
+	return model.FlatCategory{
+		Code:       dbCat.Code,
+		Name:       dbCat.Name,
+		Level:      dbCat.Level,
+		ParentCode: dbCat.ParentCode,
+	}
+}
+
+// newResultCategoryV2 解析 pdf_info 和 llm_enhancements 得到 v2 格式的分类
+func newResultCategoryV2(dbCat *database.Category) ResultCategoryV2 {
+	detail := buildCategoryDetail(dbCat)
+	review := buildReviewNode(dbCat)
+
+	result := ResultCategoryV2{
+		Code:       dbCat.Code,
+		Name:       dbCat.Name,
+		Level:      dbCat.Level,
+		ParentCode: dbCat.ParentCode,
+		Status:     dbCat.Status,
+		DataSource: dbCat.DataSource,
+		RuleName:   review.RuleName,
+		PDFName:    review.PDFName,
+		Overridden: review.Overridden,
+	}
+	if name, ok := detail.LLMEnhancements["name"].(string); ok {
+		result.LLMName = name
+	}
+	if detail.Selection != nil {
+		result.Confidence = detail.Selection.Confidence
+	}
+	return result
+}
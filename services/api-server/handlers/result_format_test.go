@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+func TestNegotiateResultSchema(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		target   string
+		accept   string
+		expected string
+		invalid  bool
+	}{
+		{"/", "", ResultSchemaV1, false},
+		{"/", "application/json", ResultSchemaV1, false},
+		{"/?schema=v2", "", ResultSchemaV2, false},
+		{"/", "application/json, application/vnd.moonshot.result.v2+json;q=0.9", ResultSchemaV2, false},
+		{"/?schema=v1", "application/vnd.moonshot.result.v2+json", ResultSchemaV1, false},
+		{"/", "application/vnd.moonshot.result.v9+json", ResultSchemaV1, false},
+		{"/?schema=v3", "", "", true},
+	}
+	for _, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, tc.target, nil)
+		if tc.accept != "" {
+			c.Request.Header.Set("Accept", tc.accept)
+		}
+		schema, err := negotiateResultSchema(c)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%s: expected error", tc.target)
+			}
+			continue
+		}
+		if err != nil || schema != tc.expected {
+			t.Errorf("%s (Accept: %s): expected %s, got %s, %v", tc.target, tc.accept, tc.expected, schema, err)
+		}
+	}
+}
+
+func TestDownloadResultByTaskID_SchemaVersions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	taskID := "9c1e3a5c-7d9f-4b1c-8e3a-5c7d9f1b3e5a"
+	if err := db.CreateTask(ctx, &database.TaskRecord{ID: taskID, Type: "rule", Status: "completed", Config: datatypes.JSON(`{}`)}); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	categories := []*database.Category{
+		{TaskID: taskID, Code: "1-01-01-01", Name: "焊接工", Level: "细类", ParentCode: "1-01-01", Status: database.StatusCompleted,
+			DataSource: "excel", PDFInfo: `{"name":"焊接工"}`,
+			LLMEnhancements: `{"name":"焊接工","selected_from":"pdf","alternative_name":"焊工","confidence":0.92,"rule_name":"焊工"}`},
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, "0d2f4b6d-8e0a-4c2d-9f4b-6d8e0a2c4e6b", categories); err != nil {
+		t.Fatalf("插入分类失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/files/download", h.DownloadResultByTaskID)
+	get := func(query, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download?task_id="+taskID+query, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 默认 v1：保持原有的扁平数组结构
+	w := get("", "")
+	if w.Code != http.StatusOK || w.Header().Get(ResultSchemaHeader) != ResultSchemaV1 {
+		t.Fatalf("expected v1 200, got %d %s", w.Code, w.Header().Get(ResultSchemaHeader))
+	}
+	var v1 []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &v1); err != nil {
+		t.Fatalf("解析v1响应失败: %v", err)
+	}
+	expectedV1 := []map[string]interface{}{{
+		"code": "1-01-01-01", "name": "焊接工", "level": "细类", "parent_code": "1-01-01",
+		"has_children": false, "has_llm": false, "has_pdf": false,
+	}}
+	if !reflect.DeepEqual(v1, expectedV1) {
+		t.Errorf("v1 = %v, expected %v", v1, expectedV1)
+	}
+
+	// v2：通过 Accept 协商
+	w = get("", "application/vnd.moonshot.result.v2+json")
+	if w.Code != http.StatusOK || w.Header().Get(ResultSchemaHeader) != ResultSchemaV2 {
+		t.Fatalf("expected v2 200, got %d %s", w.Code, w.Header().Get(ResultSchemaHeader))
+	}
+	var v2 ResultV2
+	if err := json.Unmarshal(w.Body.Bytes(), &v2); err != nil {
+		t.Fatalf("解析v2响应失败: %v", err)
+	}
+	if v2.Schema != ResultSchemaV2 || v2.TaskID != taskID || v2.Count != 1 || len(v2.Categories) != 1 {
+		t.Fatalf("unexpected v2 result: %+v", v2)
+	}
+	got := v2.Categories[0]
+	if got.RuleName != "焊工" || got.PDFName != "焊接工" || got.LLMName != "焊接工" ||
+		got.Confidence == nil || *got.Confidence != 0.92 || got.Status != database.StatusCompleted {
+		t.Errorf("unexpected v2 category: %+v", got)
+	}
+
+	if w := get("&schema=v3", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown schema, got %d", w.Code)
+	}
+}
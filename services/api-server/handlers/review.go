@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/integration"
+	"github.com/gin-gonic/gin"
+)
+
+// ReviewNode 人工审核用的分类名称对比：规则解析名称、PDF名称与最终名称
+// 旧数据未记录规则名称且无法推断时 rule_name 为空，changed 为 false
+type ReviewNode struct {
+	Code       string `json:"code"`
+	Level      string `json:"level"`
+	ParentCode string `json:"parent_code"`
+	Status     string `json:"status"`
+	RuleName   string `json:"rule_name"`
+	PDFName    string `json:"pdf_name,omitempty"`
+	FinalName  string `json:"final_name"`
+	Changed    bool   `json:"changed"`    // 最终名称与规则名称不同
+	Overridden bool   `json:"overridden"` // 最终名称来自人工修正
+}
+
+// GetReviewNodes 列出任务当前版本分类的名称对比，changed_only=true 时只返回名称被修改的分类
+func (h *Handlers) GetReviewNodes(c *gin.Context) {
+	taskID := c.Query("task_id")
+	if taskID == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "缺少 task_id 参数", nil)
+		return
+	}
+	changedOnly := c.Query("changed_only") == "true"
+
+	categories, err := h.db.GetCurrentCategoriesByTaskID(c.Request.Context(), taskID)
+	if err != nil {
+		log.Printf("获取任务 %s 的分类失败: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取分类数据失败", nil)
+		return
+	}
+
+	nodes := make([]ReviewNode, 0)
+	changed := 0
+	for _, cat := range categories {
+		node := buildReviewNode(cat)
+		if node.Changed {
+			changed++
+		} else if changedOnly {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":       taskID,
+		"changed_only":  changedOnly,
+		"total":         len(categories),
+		"changed_count": changed,
+		"count":         len(nodes),
+		"nodes":         nodes,
+	})
+}
+
+// buildReviewNode 解析 pdf_info 和 llm_enhancements 得到名称对比
+func buildReviewNode(cat *database.Category) ReviewNode {
+	node := ReviewNode{
+		Code:       cat.Code,
+		Level:      cat.Level,
+		ParentCode: cat.ParentCode,
+		Status:     cat.Status,
+		FinalName:  cat.Name,
+	}
+
+	if cat.PDFInfo != "" {
+		var pdfInfo map[string]interface{}
+		if err := json.Unmarshal([]byte(cat.PDFInfo), &pdfInfo); err != nil {
+			log.Printf("解析分类 %s 的 pdf_info 失败: %v", cat.Code, err)
+		} else {
+			node.PDFName, _ = pdfInfo["name"].(string)
+		}
+	}
+
+	var enhancements map[string]interface{}
+	if cat.LLMEnhancements != "" {
+		if err := json.Unmarshal([]byte(cat.LLMEnhancements), &enhancements); err != nil {
+			log.Printf("解析分类 %s 的 llm_enhancements 失败: %v", cat.Code, err)
+		}
+	}
+	_, node.Overridden = enhancements[database.ManualOverrideKey]
+	node.RuleName = ruleName(cat.Name, enhancements)
+	node.Changed = node.RuleName != "" && node.RuleName != node.FinalName
+	return node
+}
+
+// ruleName 取规则解析得到的原始名称。
+// 新数据直接记录在 rule_name 字段；旧数据按语义选择结果推断：未经LLM修改的名称即规则名称，
+// 选择PDF名称时备选名称即规则名称，名称校验修改前的名称记录在 name_validation.original_name，
+// 人工修正前的名称记录在 manual_override.previous_name
+func ruleName(name string, enhancements map[string]interface{}) string {
+	if ruleName, ok := enhancements[integration.RuleNameKey].(string); ok && ruleName != "" {
+		return ruleName
+	}
+	if override, ok := enhancements[database.ManualOverrideKey].(map[string]interface{}); ok {
+		if previous, ok := override["previous_name"].(string); ok && previous != "" {
+			name = previous
+		}
+	}
+
+	// 名称校验修改前的名称，未校验时即为当前名称
+	beforeValidation := name
+	if validation, ok := enhancements["name_validation"].(map[string]interface{}); ok {
+		if original, ok := validation["original_name"].(string); ok && original != "" {
+			beforeValidation = original
+		}
+	}
+
+	if enhancements == nil {
+		return beforeValidation
+	}
+	if _, kept := enhancements[integration.ConfidenceReviewKey]; kept {
+		return beforeValidation
+	}
+	if _, hasLLMName := enhancements["name"]; !hasLLMName {
+		return beforeValidation
+	}
+	switch enhancements["selected_from"] {
+	case "rule":
+		llmName, _ := enhancements["name"].(string)
+		return llmName
+	case "pdf":
+		alternative, _ := enhancements["alternative_name"].(string)
+		return alternative
+	}
+	return ""
+}
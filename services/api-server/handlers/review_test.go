@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetReviewNodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	taskID := "4c6e8a0c-2d4f-4a6b-8c0e-2a4c6e8a0b2d"
+	categories := []*database.Category{
+		// 记录了规则名称
+		{TaskID: taskID, Code: "1-01-01-01", Name: "焊接工", Level: "细类", Status: database.StatusCompleted,
+			PDFInfo:         `{"code":"1-01-01-01","name":"焊接工"}`,
+			LLMEnhancements: `{"code":"1-01-01-01","name":"焊接工","rule_name":"焊工"}`},
+		// 旧数据：选择PDF名称，备选名称即规则名称
+		{TaskID: taskID, Code: "1-01-01-02", Name: "钳工（装配）", Level: "细类", Status: database.StatusCompleted,
+			PDFInfo:         `{"code":"1-01-01-02","name":"钳工（装配）"}`,
+			LLMEnhancements: `{"code":"1-01-01-02","name":"钳工（装配）","selected_from":"pdf","alternative_name":"钳工"}`},
+		// 低置信度保留规则名称
+		{TaskID: taskID, Code: "1-01-01-03", Name: "车工", Level: "细类", Status: database.StatusCompleted,
+			PDFInfo:         `{"code":"1-01-01-03","name":"车床工"}`,
+			LLMEnhancements: `{"code":"1-01-01-03","name":"车床工","confidence":0.3,"confidence_review":{"action":"kept_rule_name"}}`},
+		// 未经LLM处理，名称校验修改了名称
+		{TaskID: taskID, Code: "1-01-01-04", Name: "铣工", Level: "细类", Status: database.StatusCompleted,
+			LLMEnhancements: `{"name_validation":{"original_name":"铣工*","action":"fixed","final_name":"铣工"}}`},
+		{TaskID: taskID, Code: "1-01-01-05", Name: "磨工", Level: "细类", Status: database.StatusExcelParsed},
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, "8a0c2e4a-6b8d-4f0a-9c2e-4a6c8e0a2b4d", categories); err != nil {
+		t.Fatalf("插入分类失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/data/review", h.GetReviewNodes)
+	type reviewResponse struct {
+		Total        int          `json:"total"`
+		ChangedCount int          `json:"changed_count"`
+		Nodes        []ReviewNode `json:"nodes"`
+	}
+	get := func(query string) (int, reviewResponse) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/data/review?"+query, nil))
+		var resp reviewResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	if code, _ := get(""); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without task_id, got %d", code)
+	}
+
+	code, resp := get("task_id=" + taskID)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if resp.Total != 5 || len(resp.Nodes) != 5 || resp.ChangedCount != 3 {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+	byCode := make(map[string]ReviewNode)
+	for _, node := range resp.Nodes {
+		byCode[node.Code] = node
+	}
+	expected := map[string]ReviewNode{
+		"1-01-01-01": {RuleName: "焊工", PDFName: "焊接工", FinalName: "焊接工", Changed: true},
+		"1-01-01-02": {RuleName: "钳工", PDFName: "钳工（装配）", FinalName: "钳工（装配）", Changed: true},
+		"1-01-01-03": {RuleName: "车工", PDFName: "车床工", FinalName: "车工", Changed: false},
+		"1-01-01-04": {RuleName: "铣工*", FinalName: "铣工", Changed: true},
+		"1-01-01-05": {RuleName: "磨工", FinalName: "磨工", Changed: false},
+	}
+	for code, want := range expected {
+		got := byCode[code]
+		if got.RuleName != want.RuleName || got.PDFName != want.PDFName || got.FinalName != want.FinalName || got.Changed != want.Changed {
+			t.Errorf("%s: expected %+v, got %+v", code, want, got)
+		}
+	}
+
+	code, resp = get("task_id=" + taskID + "&changed_only=true")
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(resp.Nodes) != 3 || resp.ChangedCount != 3 {
+		t.Errorf("Expected 3 changed nodes, got %+v", resp.Nodes)
+	}
+	for _, node := range resp.Nodes {
+		if !node.Changed {
+			t.Errorf("Unexpected unchanged node %s", node.Code)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultStatsRetentionDays 处理统计的默认保留天数
+const DefaultStatsRetentionDays = 30
+
+// SetStatsRetention 设置处理统计的保留天数，清理接口未指定 days 时和定期清理都使用该值
+func (h *Handlers) SetStatsRetention(days int) {
+	h.statsRetentionDays = days
+}
+
+// PruneProcessingStats 删除早于指定天数的处理统计，每个任务最新的一条始终保留
+// 查询参数 days 可选，未指定时使用配置的保留天数
+func (h *Handlers) PruneProcessingStats(c *gin.Context) {
+	days := h.statsRetentionDays
+	if v := c.Query("days"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "days 必须是正整数", gin.H{"days": v})
+			return
+		}
+		days = parsed
+	}
+	if days <= 0 {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "未配置保留天数，请通过 days 参数指定", nil)
+		return
+	}
+
+	deleted, err := h.pruneProcessingStats(c.Request.Context(), days)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "清理处理统计失败", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"deleted":        deleted,
+		"retention_days": days,
+	})
+}
+
+// RunStatsPruning 按间隔定期清理过期的处理统计，直到 ctx 取消；未配置保留天数或间隔时直接返回
+func (h *Handlers) RunStatsPruning(ctx context.Context, interval time.Duration) {
+	if h.statsRetentionDays <= 0 || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		h.pruneProcessingStats(ctx, h.statsRetentionDays)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneProcessingStats 删除早于 days 天的处理统计并记录日志
+func (h *Handlers) pruneProcessingStats(ctx context.Context, days int) (int64, error) {
+	deleted, err := h.db.PruneProcessingStats(ctx, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		log.Printf("清理处理统计失败: %v", err)
+		return 0, err
+	}
+	log.Printf("已清理 %d 条超过 %d 天的处理统计", deleted, days)
+	return deleted, nil
+}
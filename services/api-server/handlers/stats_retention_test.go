@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPruneProcessingStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	now := time.Now()
+	oldTask := "3b5d7f9a-1c3e-4a5b-8d7f-9a1c3e5b7d9f"
+	activeTask := "5d7f9a1c-3e5b-4b7d-9f1a-3c5e7b9d1f3a"
+	stats := []*database.ProcessingStats{
+		// 只有过期记录的任务保留最新的一条
+		{ID: "00000000-0000-4000-8000-000000000001", TaskID: oldTask, CreatedAt: now.AddDate(0, 0, -90)},
+		{ID: "00000000-0000-4000-8000-000000000002", TaskID: oldTask, CreatedAt: now.AddDate(0, 0, -60)},
+		{ID: "00000000-0000-4000-8000-000000000003", TaskID: oldTask, CreatedAt: now.AddDate(0, 0, -45)},
+		// 有近期记录的任务，过期记录全部删除
+		{ID: "00000000-0000-4000-8000-000000000004", TaskID: activeTask, CreatedAt: now.AddDate(0, 0, -40)},
+		{ID: "00000000-0000-4000-8000-000000000005", TaskID: activeTask, CreatedAt: now.AddDate(0, 0, -1)},
+	}
+	for _, s := range stats {
+		if err := db.CreateProcessingStats(ctx, s); err != nil {
+			t.Fatalf("创建处理统计失败: %v", err)
+		}
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/monitor/stats/prune", h.PruneProcessingStats)
+	post := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/monitor/stats/prune?"+query, nil))
+		return w
+	}
+
+	if w := post("days=abc"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid days, got %d", w.Code)
+	}
+
+	w := post("")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Deleted       int64 `json:"deleted"`
+		RetentionDays int   `json:"retention_days"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if body.Deleted != 3 || body.RetentionDays != DefaultStatsRetentionDays {
+		t.Errorf("Expected 3 rows deleted with default retention, got %+v", body)
+	}
+
+	latest, err := db.GetLatestProcessingStats(ctx, oldTask)
+	if err != nil || latest == nil || latest.ID != "00000000-0000-4000-8000-000000000003" {
+		t.Errorf("Expected latest stats of old task kept, got %+v (err: %v)", latest, err)
+	}
+	var remaining int64
+	db.WithContext(ctx).Model(&database.ProcessingStats{}).Count(&remaining)
+	if remaining != 2 {
+		t.Errorf("Expected 2 rows remaining, got %d", remaining)
+	}
+
+	// 未配置保留天数时必须显式指定 days
+	h.SetStatsRetention(0)
+	if w := post(""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without retention configured, got %d", w.Code)
+	}
+	if w := post("days=1"); w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+		t.Errorf("Expected 200 with explicit days, got %d", w.Code)
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/model"
+)
+
+// 结构化数据缓存默认配置，TTL 为 0 表示不过期
+const (
+	DefaultStructuredCacheSize = 32
+	DefaultStructuredCacheTTL  = 10 * time.Minute
+)
+
+// structuredCacheKey 缓存键，version 为解析后的上传批次ID
+type structuredCacheKey struct {
+	taskID  string
+	version string
+}
+
+// structuredCacheEntry 已组装好的扁平数据和层级结构
+type structuredCacheEntry struct {
+	key          structuredCacheKey
+	flat         []model.FlatCategory
+	hierarchical HierarchicalStructure
+	expiresAt    time.Time
+}
+
+// StructuredCacheStats 缓存统计信息
+type StructuredCacheStats struct {
+	Size          int   `json:"size"`
+	Capacity      int   `json:"capacity"`
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Evictions     int64 `json:"evictions"`
+	Invalidations int64 `json:"invalidations"`
+}
+
+// structuredCache 按 (task_id, version) 缓存结构化数据的LRU缓存
+// 只缓存后台增量流程已结束的任务，api-server 自身的写入通过 invalidateTask 失效，过期时间只用于兜底回收
+type structuredCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List // 最近使用的在前
+	entries  map[structuredCacheKey]*list.Element
+	now      func() time.Time
+
+	hits          int64
+	misses        int64
+	evictions     int64
+	invalidations int64
+}
+
+// newStructuredCache 创建缓存，capacity <= 0 时返回 nil 表示不缓存
+func newStructuredCache(capacity int, ttl time.Duration) *structuredCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &structuredCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[structuredCacheKey]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// get 读取缓存，过期的条目视为未命中并移除
+func (sc *structuredCache) get(key structuredCacheKey) (*structuredCacheEntry, bool) {
+	if sc == nil {
+		return nil, false
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	elem, ok := sc.entries[key]
+	if !ok {
+		sc.misses++
+		return nil, false
+	}
+	entry := elem.Value.(*structuredCacheEntry)
+	if sc.ttl > 0 && sc.now().After(entry.expiresAt) {
+		sc.order.Remove(elem)
+		delete(sc.entries, key)
+		sc.misses++
+		return nil, false
+	}
+	sc.order.MoveToFront(elem)
+	sc.hits++
+	return entry, true
+}
+
+// put 写入缓存，超出容量时淘汰最久未使用的条目
+func (sc *structuredCache) put(key structuredCacheKey, flat []model.FlatCategory, hierarchical HierarchicalStructure) {
+	if sc == nil {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	entry := &structuredCacheEntry{key: key, flat: flat, hierarchical: hierarchical, expiresAt: sc.now().Add(sc.ttl)}
+	if elem, ok := sc.entries[key]; ok {
+		elem.Value = entry
+		sc.order.MoveToFront(elem)
+		return
+	}
+	sc.entries[key] = sc.order.PushFront(entry)
+	for sc.order.Len() > sc.capacity {
+		oldest := sc.order.Back()
+		sc.order.Remove(oldest)
+		delete(sc.entries, oldest.Value.(*structuredCacheEntry).key)
+		sc.evictions++
+	}
+}
+
+// invalidateTask 移除任务的所有缓存版本，在任务写入新数据后调用
+func (sc *structuredCache) invalidateTask(taskID string) {
+	if sc == nil {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for key, elem := range sc.entries {
+		if key.taskID == taskID {
+			sc.order.Remove(elem)
+			delete(sc.entries, key)
+			sc.invalidations++
+		}
+	}
+}
+
+// stats 返回缓存统计，未启用缓存时返回零值
+func (sc *structuredCache) stats() StructuredCacheStats {
+	if sc == nil {
+		return StructuredCacheStats{}
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	return StructuredCacheStats{
+		Size:          sc.order.Len(),
+		Capacity:      sc.capacity,
+		Hits:          sc.hits,
+		Misses:        sc.misses,
+		Evictions:     sc.evictions,
+		Invalidations: sc.invalidations,
+	}
+}
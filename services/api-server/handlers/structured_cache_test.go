@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+func TestStructuredCache_LRUAndInvalidation(t *testing.T) {
+	cache := newStructuredCache(2, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	keyA := structuredCacheKey{taskID: "task-1", version: "batch-a"}
+	keyB := structuredCacheKey{taskID: "task-1", version: "batch-b"}
+	keyC := structuredCacheKey{taskID: "task-2", version: "batch-c"}
+	flat := []model.FlatCategory{{Code: "1", Name: "大类"}}
+
+	cache.put(keyA, flat, HierarchicalStructure{})
+	cache.put(keyB, flat, HierarchicalStructure{})
+	if _, ok := cache.get(keyA); !ok {
+		t.Fatalf("Expected hit for %v", keyA)
+	}
+
+	// keyB 最久未使用，写入 keyC 时被淘汰
+	cache.put(keyC, flat, HierarchicalStructure{})
+	if _, ok := cache.get(keyB); ok {
+		t.Errorf("Expected %v to be evicted", keyB)
+	}
+	if entry, ok := cache.get(keyC); !ok || entry.flat[0].Code != "1" {
+		t.Errorf("Expected hit for %v", keyC)
+	}
+
+	cache.invalidateTask("task-1")
+	if _, ok := cache.get(keyA); ok {
+		t.Errorf("Expected %v to be invalidated", keyA)
+	}
+
+	// 过期条目视为未命中
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.get(keyC); ok {
+		t.Errorf("Expected %v to expire", keyC)
+	}
+
+	stats := cache.stats()
+	expected := StructuredCacheStats{Size: 0, Capacity: 2, Hits: 2, Misses: 3, Evictions: 1, Invalidations: 1}
+	if stats != expected {
+		t.Errorf("Expected stats %+v, got %+v", expected, stats)
+	}
+}
+
+func TestStructuredCache_Disabled(t *testing.T) {
+	cache := newStructuredCache(0, time.Minute)
+	if cache != nil {
+		t.Fatalf("Expected nil cache when size is 0")
+	}
+	key := structuredCacheKey{taskID: "task-1", version: "batch-a"}
+	cache.put(key, nil, HierarchicalStructure{})
+	if _, ok := cache.get(key); ok {
+		t.Errorf("Disabled cache should never hit")
+	}
+	if stats := cache.stats(); stats != (StructuredCacheStats{}) {
+		t.Errorf("Expected zero stats, got %+v", stats)
+	}
+}
+
+func TestGetAllStructuredData_CachesOnlyAfterFlowFinished(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	taskID := "5e7a9c1e-3a5b-4d7f-9a1c-3e5a7b9d1f3b"
+	batchID := "7a9c1e3a-5b7d-4f9a-8c1e-3a5b7d9f1a3d"
+	// 规则步骤已完成，后台增量流程仍在改写名称
+	started := time.Now()
+	task := &database.TaskRecord{ID: taskID, Type: "rule", Status: "completed", Config: datatypes.JSON(`{}`), FlowStartedAt: &started}
+	if err := db.CreateTask(ctx, task); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	categories := []*database.Category{
+		{TaskID: taskID, Code: "6", Name: "生产制造及有关人员", Level: "大类", Status: database.StatusCompleted},
+		{TaskID: taskID, Code: "6-01", Name: "焊接人员", Level: "中类", ParentCode: "6", Status: database.StatusCompleted},
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, batchID, categories); err != nil {
+		t.Fatalf("插入分类失败: %v", err)
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/data/structured", h.GetAllStructuredData)
+	fetch := func() (bool, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/data/structured?include_tree=true&task_id="+taskID+"&version="+batchID, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			FlatData    []model.FlatCategory `json:"flat_data"`
+			Performance struct {
+				Cached bool `json:"cached"`
+			} `json:"performance"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		for _, cat := range resp.FlatData {
+			if cat.Code == "6-01" {
+				return resp.Performance.Cached, cat.Name
+			}
+		}
+		t.Fatalf("响应中缺少编码 6-01: %s", w.Body.String())
+		return false, ""
+	}
+
+	fetch()
+	// worker 在流程中原地改写名称，api-server 无法感知
+	if err := db.WithContext(ctx).Model(&database.Category{}).Where("task_id = ? AND code = ?", taskID, "6-01").Update("name", "焊接与切割人员").Error; err != nil {
+		t.Fatalf("更新名称失败: %v", err)
+	}
+	if cached, name := fetch(); cached || name != "焊接与切割人员" {
+		t.Errorf("流程运行中不应命中缓存，got cached=%v name=%s", cached, name)
+	}
+
+	if err := db.SetTaskFlowRunning(ctx, taskID, false); err != nil {
+		t.Fatalf("清除流程标记失败: %v", err)
+	}
+	fetch()
+	if cached, name := fetch(); !cached || name != "焊接与切割人员" {
+		t.Errorf("流程结束后应命中缓存，got cached=%v name=%s", cached, name)
+	}
+}
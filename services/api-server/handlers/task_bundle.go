@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/audit"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// 任务包（tar.gz）中的条目名称
+const (
+	bundleFormatVersion = 1
+
+	bundleManifestEntry      = "manifest.json"
+	bundleTaskEntry          = "task.json"
+	bundleCategoriesEntry    = "categories.json"
+	bundlePDFExtractionEntry = "pdf_extraction.json"
+	bundleInputFilePrefix    = "files/input/" // 原始上传的Excel文件
+	bundlePDFFilePrefix      = "files/pdf/"   // 任务关联的PDF原始文件（可选）
+
+	xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// TaskBundleManifest 任务包的描述信息
+type TaskBundleManifest struct {
+	FormatVersion int       `json:"format_version"`
+	SourceTaskID  string    `json:"source_task_id"`
+	ExportedAt    time.Time `json:"exported_at"`
+	CategoryCount int       `json:"category_count"`
+	HasPDFResult  bool      `json:"has_pdf_result"`
+	InputFileName string    `json:"input_file_name"`
+	PDFFileName   string    `json:"pdf_file_name,omitempty"`
+}
+
+// ExportTaskBundle 导出任务包：任务记录、当前版本分类、PDF提取结果和原始文件，
+// 以 tar.gz 流式写入响应，不在内存中缓存整个归档
+func (h *Handlers) ExportTaskBundle(c *gin.Context) {
+	ctx := c.Request.Context()
+	taskID := c.Param("id")
+
+	task, err := h.db.GetTask(ctx, taskID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, ErrCodeTaskNotFound, "任务不存在", nil)
+		return
+	}
+
+	categories, err := h.db.GetCurrentCategoriesByTaskID(ctx, taskID)
+	if err != nil {
+		log.Printf("导出任务包失败 - 查询分类: TaskID=%s, Error=%v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取分类数据失败", nil)
+		return
+	}
+
+	extraction, err := h.db.GetPDFExtraction(ctx, taskID)
+	if err != nil && !errors.Is(err, database.ErrPDFExtractionNotFound) {
+		log.Printf("导出任务包失败 - 查询PDF结果: TaskID=%s, Error=%v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取PDF提取结果失败", nil)
+		return
+	}
+
+	// 开始写响应前确认原始文件存在，写出后就无法再返回JSON错误
+	inputInfo, err := h.storage.GetFileInfo(ctx, task.InputPath)
+	if err != nil {
+		log.Printf("导出任务包失败 - 原始文件不存在: TaskID=%s, Path=%s, Error=%v", taskID, task.InputPath, err)
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "任务的原始文件不存在", nil)
+		return
+	}
+	var pdfSize int64
+	if task.PDFPath != "" {
+		if info, err := h.storage.GetFileInfo(ctx, task.PDFPath); err == nil {
+			pdfSize = info.Size
+		} else {
+			log.Printf("导出任务包时跳过PDF文件: TaskID=%s, Path=%s, Error=%v", taskID, task.PDFPath, err)
+		}
+	}
+
+	manifest := TaskBundleManifest{
+		FormatVersion: bundleFormatVersion,
+		SourceTaskID:  taskID,
+		ExportedAt:    time.Now(),
+		CategoryCount: len(categories),
+		HasPDFResult:  extraction != nil,
+		InputFileName: path.Base(task.InputPath),
+	}
+	if pdfSize > 0 {
+		manifest.PDFFileName = path.Base(task.PDFPath)
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="task_%s.tar.gz"`, taskID))
+	c.Header("Content-Type", "application/gzip")
+	c.Status(http.StatusOK)
+
+	gz := gzip.NewWriter(c.Writer)
+	tw := tar.NewWriter(gz)
+	err = h.writeTaskBundle(ctx, tw, manifest, task, categories, extraction, inputInfo.Size, pdfSize)
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		// 响应头已经写出，只能记录日志，客户端会收到不完整的归档
+		log.Printf("写入任务包失败: TaskID=%s, Error=%v", taskID, err)
+	}
+}
+
+// writeTaskBundle 按 manifest、任务、PDF结果、分类、原始文件的顺序写入归档
+// JSON 条目写在文件之前，导入时读到文件前即可完成校验
+func (h *Handlers) writeTaskBundle(ctx context.Context, tw *tar.Writer, manifest TaskBundleManifest, task *database.TaskRecord,
+	categories []*database.Category, extraction *database.PDFExtraction, inputSize, pdfSize int64) error {
+	if err := writeBundleJSON(tw, bundleManifestEntry, manifest); err != nil {
+		return err
+	}
+	if err := writeBundleJSON(tw, bundleTaskEntry, task); err != nil {
+		return err
+	}
+	if extraction != nil {
+		if err := writeBundleJSON(tw, bundlePDFExtractionEntry, extraction); err != nil {
+			return err
+		}
+	}
+	if err := writeBundleJSON(tw, bundleCategoriesEntry, categories); err != nil {
+		return err
+	}
+
+	if err := h.writeBundleFile(ctx, tw, bundleInputFilePrefix+manifest.InputFileName, task.InputPath, inputSize); err != nil {
+		return err
+	}
+	if manifest.PDFFileName != "" {
+		if err := h.writeBundleFile(ctx, tw, bundlePDFFilePrefix+manifest.PDFFileName, task.PDFPath, pdfSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeBundleJSON(tw *tar.Writer, name string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化 %s 失败: %w", name, err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// writeBundleFile 从存储中流式复制对象到归档
+func (h *Handlers) writeBundleFile(ctx context.Context, tw *tar.Writer, name, objectName string, size int64) error {
+	reader, err := h.storage.DownloadFile(ctx, objectName)
+	if err != nil {
+		return fmt.Errorf("下载 %s 失败: %w", objectName, err)
+	}
+	defer reader.Close()
+
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now()}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, reader); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", name, err)
+	}
+	return nil
+}
+
+// importedTaskBundle 从任务包中读取的数据，文件在读取时已上传到存储
+type importedTaskBundle struct {
+	manifest      *TaskBundleManifest
+	task          *database.TaskRecord
+	categories    []*database.Category
+	extraction    *database.PDFExtraction
+	inputFile     *database.FileRecord
+	pdfObjectName string
+}
+
+// importedTaskStatus 导入任务的状态：终止状态原样保留，导出时尚未完成的任务标记为失败
+// 导入的任务不会重新入队，沿用 pending/processing 会让任务永远停在该状态
+func importedTaskStatus(status string) (string, string) {
+	switch status {
+	case "completed", "failed", "cancelled":
+		return status, ""
+	}
+	return "failed", fmt.Sprintf("导出时任务状态为 %s，导入后不会继续处理", status)
+}
+
+// ImportTaskBundle 导入 ExportTaskBundle 生成的任务包，以新的任务ID重建任务
+// 请求体即 tar.gz 归档，边读边将原始文件上传到存储；导入的任务不会重新入队处理
+func (h *Handlers) ImportTaskBundle(c *gin.Context) {
+	ctx := c.Request.Context()
+	// 任务包最多包含Excel和PDF两个原始文件
+	if h.maxUploadSize > 0 {
+		limit := 2*h.maxUploadSize + multipartOverhead
+		if c.Request.ContentLength > limit {
+			respondUploadTooLarge(c, h.maxUploadSize)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
+	// 与上传和创建任务使用同一准入限制，在写入存储之前检查
+	if !h.checkActiveTaskLimit(c) {
+		return
+	}
+	taskID := uuid.New().String()
+	batchID := uuid.New().String()
+
+	var uploaded []string
+	cleanup := func() {
+		for _, objectName := range uploaded {
+			h.storage.DeleteFile(ctx, objectName)
+		}
+	}
+
+	bundle, err := h.readTaskBundle(ctx, c.Request.Body, taskID, &uploaded)
+	if err != nil {
+		cleanup()
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondUploadTooLarge(c, h.maxUploadSize)
+			return
+		}
+		log.Printf("读取任务包失败: %v", err)
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidFile, "无效的任务包: "+err.Error(), nil)
+		return
+	}
+
+	task := *bundle.task
+	task.ID = taskID
+	task.InputPath = bundle.inputFile.StoragePath
+	task.OutputPath = fmt.Sprintf("results/%s/output.json", taskID)
+	task.PDFPath = bundle.pdfObjectName
+	task.UploadBatchID = batchID
+	task.CreatedAt = time.Now()
+	task.UpdatedAt = time.Now()
+	task.Status, task.ErrorMsg = importedTaskStatus(task.Status)
+	if task.ErrorMsg == "" {
+		task.ErrorMsg = bundle.task.ErrorMsg
+	}
+	// 领取信息属于源环境的worker
+	task.ProcessedBy = ""
+	task.ClaimedAt = nil
+	if len(task.Config) == 0 {
+		task.Config = datatypes.JSON([]byte(`{}`))
+	}
+
+	if err := h.db.CreateTask(ctx, &task); err != nil {
+		cleanup()
+		log.Printf("导入任务包失败 - 创建任务: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "创建任务失败", nil)
+		return
+	}
+
+	// 任务创建之后的失败需要一并删除已写入的记录
+	if err := h.saveImportedTaskData(ctx, taskID, batchID, bundle); err != nil {
+		h.db.WithContext(ctx).Where("task_id = ?", taskID).Delete(&database.Category{})
+		h.db.WithContext(ctx).Where("task_id = ?", taskID).Delete(&database.PDFExtraction{})
+		h.db.DeleteTask(ctx, taskID)
+		cleanup()
+		log.Printf("导入任务包失败 - TaskID=%s, Error=%v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "导入任务数据失败", nil)
+		return
+	}
+
+	log.Printf("导入任务包成功 - 源任务=%s, 新任务=%s, 分类=%d条", bundle.manifest.SourceTaskID, taskID, len(bundle.categories))
+	h.recordAudit(c, audit.ActionTaskImport, audit.EntityTask, taskID, gin.H{
+		"source_task_id": bundle.manifest.SourceTaskID,
+		"category_count": len(bundle.categories),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"taskId":        taskID,
+		"sourceTaskId":  bundle.manifest.SourceTaskID,
+		"categoryCount": len(bundle.categories),
+		"hasPdfResult":  bundle.extraction != nil,
+		"message":       "Task bundle imported successfully",
+	})
+}
+
+// saveImportedTaskData 写入文件记录、分类和PDF提取结果
+func (h *Handlers) saveImportedTaskData(ctx context.Context, taskID, batchID string, bundle *importedTaskBundle) error {
+	bundle.inputFile.TaskID = taskID
+	if err := h.db.CreateFile(ctx, bundle.inputFile); err != nil {
+		return err
+	}
+
+	for _, cat := range bundle.categories {
+		cat.ID = 0
+		cat.TaskID = taskID
+	}
+	if len(bundle.categories) > 0 {
+		if err := h.db.BatchInsertCategoriesWithVersion(ctx, taskID, batchID, bundle.categories); err != nil {
+			return err
+		}
+	}
+
+	if bundle.extraction != nil {
+		extraction := *bundle.extraction
+		extraction.ID = 0
+		extraction.TaskID = taskID
+		if err := h.db.SavePDFExtraction(ctx, &extraction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTaskBundle 顺序读取归档条目，文件条目直接流式上传到存储，上传的对象名追加到 uploaded
+func (h *Handlers) readTaskBundle(ctx context.Context, body io.Reader, taskID string, uploaded *[]string) (*importedTaskBundle, error) {
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, fmt.Errorf("不是gzip格式: %w", err)
+	}
+	defer gz.Close()
+
+	bundle := &importedTaskBundle{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取归档失败: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		switch name := header.Name; {
+		case name == bundleManifestEntry:
+			bundle.manifest = &TaskBundleManifest{}
+			err = json.NewDecoder(tr).Decode(bundle.manifest)
+			if err == nil && bundle.manifest.FormatVersion != bundleFormatVersion {
+				err = fmt.Errorf("不支持的任务包版本 %d", bundle.manifest.FormatVersion)
+			}
+		case name == bundleTaskEntry:
+			bundle.task = &database.TaskRecord{}
+			err = json.NewDecoder(tr).Decode(bundle.task)
+		case name == bundleCategoriesEntry:
+			err = json.NewDecoder(tr).Decode(&bundle.categories)
+		case name == bundlePDFExtractionEntry:
+			bundle.extraction = &database.PDFExtraction{}
+			err = json.NewDecoder(tr).Decode(bundle.extraction)
+		case strings.HasPrefix(name, bundleInputFilePrefix):
+			fileID := uuid.New().String()
+			objectName := fmt.Sprintf("uploads/%s/%s", fileID, path.Base(name))
+			var md5Hash string
+			md5Hash, err = h.uploadBundleFile(ctx, tr, objectName, header.Size, xlsxContentType, uploaded)
+			bundle.inputFile = &database.FileRecord{
+				ID:           fileID,
+				OriginalName: path.Base(name),
+				StoragePath:  objectName,
+				FileSize:     header.Size,
+				ContentType:  xlsxContentType,
+				MD5Hash:      md5Hash,
+				CreatedAt:    time.Now(),
+			}
+		case strings.HasPrefix(name, bundlePDFFilePrefix):
+			objectName := fmt.Sprintf("pdfs/%s/%s", taskID, path.Base(name))
+			_, err = h.uploadBundleFile(ctx, tr, objectName, header.Size, "application/pdf", uploaded)
+			bundle.pdfObjectName = objectName
+		default:
+			log.Printf("忽略任务包中的未知条目: %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %w", header.Name, err)
+		}
+	}
+
+	switch {
+	case bundle.manifest == nil:
+		return nil, fmt.Errorf("缺少 %s", bundleManifestEntry)
+	case bundle.task == nil:
+		return nil, fmt.Errorf("缺少 %s", bundleTaskEntry)
+	case bundle.inputFile == nil:
+		return nil, fmt.Errorf("缺少原始文件")
+	}
+	return bundle, nil
+}
+
+// uploadBundleFile 上传归档中的文件并计算MD5
+func (h *Handlers) uploadBundleFile(ctx context.Context, r io.Reader, objectName string, size int64, contentType string, uploaded *[]string) (string, error) {
+	hash := md5.New()
+	if err := h.storage.UploadFile(ctx, objectName, io.TeeReader(r, hash), size, contentType); err != nil {
+		return "", err
+	}
+	*uploaded = append(*uploaded, objectName)
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/storage"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+// memoryStorage 内存中的对象存储
+type memoryStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{objects: make(map[string][]byte)}
+}
+
+func (s *memoryStorage) EnsureBucket(ctx context.Context) error { return nil }
+
+func (s *memoryStorage) UploadFile(ctx context.Context, objectName string, reader io.Reader, objectSize int64, contentType string) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[objectName] = data
+	return nil
+}
+
+func (s *memoryStorage) DownloadFile(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[objectName]
+	if !ok {
+		return nil, fmt.Errorf("对象不存在: %s", objectName)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memoryStorage) DeleteFile(ctx context.Context, objectName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, objectName)
+	return nil
+}
+
+func (s *memoryStorage) GetFileInfo(ctx context.Context, objectName string) (*storage.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[objectName]
+	if !ok {
+		return nil, fmt.Errorf("对象不存在: %s", objectName)
+	}
+	return &storage.FileInfo{Name: objectName, Size: int64(len(data))}, nil
+}
+
+func (s *memoryStorage) GeneratePresignedURL(ctx context.Context, objectName string, expires time.Duration) (string, error) {
+	return "", nil
+}
+
+func (s *memoryStorage) ListFiles(ctx context.Context, prefix string) ([]*storage.FileInfo, error) {
+	return nil, nil
+}
+
+func TestTaskBundle_ExportImportRoundTrip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	store := newMemoryStorage()
+	h := NewHandlers(db, nil, store)
+
+	sourceID := "0b8f3c2e-6d1a-4f7b-9c3e-2a5d8e1f4b60"
+	inputPath := "uploads/source-file/职业分类.xlsx"
+	store.objects[inputPath] = []byte("excel-content")
+	if err := db.CreateTask(ctx, &database.TaskRecord{
+		ID: sourceID, Type: "rule", Status: "completed", InputPath: inputPath,
+		OutputPath: "results/" + sourceID + "/output.json", Config: datatypes.JSON(`{}`),
+	}); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	categories := []*database.Category{
+		{TaskID: sourceID, Code: "1", Name: "大类", Level: "大类", Status: database.StatusCompleted},
+		{TaskID: sourceID, Code: "1-01", Name: "中类", Level: "中类", ParentCode: "1", Status: database.StatusCompleted, LLMEnhancements: `{"name":"中类"}`},
+	}
+	if err := db.BatchInsertCategoriesWithVersion(ctx, sourceID, "5f0e9d8c-7b6a-4e3d-8c2b-1a0f9e8d7c6b", categories); err != nil {
+		t.Fatalf("插入分类失败: %v", err)
+	}
+	if err := db.SavePDFExtraction(ctx, &database.PDFExtraction{TaskID: sourceID, TotalFound: 2, OccupationCodes: datatypes.JSON(`[]`)}); err != nil {
+		t.Fatalf("保存PDF结果失败: %v", err)
+	}
+
+	router := gin.New()
+	router.GET("/api/v1/tasks/:id/export", h.ExportTaskBundle)
+	router.POST("/api/v1/tasks/import", h.ImportTaskBundle)
+
+	exportResp := httptest.NewRecorder()
+	router.ServeHTTP(exportResp, httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+sourceID+"/export", nil))
+	if exportResp.Code != http.StatusOK {
+		t.Fatalf("导出失败: %d %s", exportResp.Code, exportResp.Body.String())
+	}
+
+	importResp := httptest.NewRecorder()
+	router.ServeHTTP(importResp, httptest.NewRequest(http.MethodPost, "/api/v1/tasks/import", bytes.NewReader(exportResp.Body.Bytes())))
+	if importResp.Code != http.StatusOK {
+		t.Fatalf("导入失败: %d %s", importResp.Code, importResp.Body.String())
+	}
+	var result struct {
+		TaskID       string `json:"taskId"`
+		SourceTaskID string `json:"sourceTaskId"`
+	}
+	if err := json.Unmarshal(importResp.Body.Bytes(), &result); err != nil {
+		t.Fatalf("解析导入响应失败: %v", err)
+	}
+	if result.TaskID == "" || result.TaskID == sourceID || result.SourceTaskID != sourceID {
+		t.Fatalf("导入应生成新任务ID，得到 %+v", result)
+	}
+
+	task, err := db.GetTask(ctx, result.TaskID)
+	if err != nil {
+		t.Fatalf("获取导入任务失败: %v", err)
+	}
+	if task.Status != "completed" || task.InputPath == inputPath || !strings.HasSuffix(task.InputPath, "/职业分类.xlsx") {
+		t.Errorf("导入任务字段不正确: %+v", task)
+	}
+	if string(store.objects[task.InputPath]) != "excel-content" {
+		t.Errorf("原始文件未复制到新路径 %s", task.InputPath)
+	}
+
+	imported, err := db.GetCurrentCategoriesByTaskID(ctx, result.TaskID)
+	if err != nil || len(imported) != 2 {
+		t.Fatalf("导入分类数量不正确: %d, %v", len(imported), err)
+	}
+	if imported[1].Code != "1-01" || imported[1].LLMEnhancements != `{"name":"中类"}` || imported[1].UploadBatchID != task.UploadBatchID {
+		t.Errorf("导入分类字段不正确: %+v", imported[1])
+	}
+
+	extraction, err := db.GetPDFExtraction(ctx, result.TaskID)
+	if err != nil || extraction.TotalFound != 2 {
+		t.Errorf("PDF提取结果未导入: %+v, %v", extraction, err)
+	}
+
+	// 源任务的数据保持不变
+	if source, _ := db.GetCurrentCategoriesByTaskID(ctx, sourceID); len(source) != 2 {
+		t.Errorf("源任务分类被修改: %d", len(source))
+	}
+
+	// 无效的归档返回400，且不留下上传的对象
+	objectCount := len(store.objects)
+	badResp := httptest.NewRecorder()
+	router.ServeHTTP(badResp, httptest.NewRequest(http.MethodPost, "/api/v1/tasks/import", strings.NewReader("not a bundle")))
+	if badResp.Code != http.StatusBadRequest || len(store.objects) != objectCount {
+		t.Errorf("无效归档应返回400，得到 %d", badResp.Code)
+	}
+
+	// 导出时仍在处理中的任务导入后标记为失败，并清除源环境的领取信息
+	claimedAt := time.Now()
+	if err := db.WithContext(ctx).Model(&database.TaskRecord{}).Where("id = ?", sourceID).
+		Updates(map[string]interface{}{"status": "processing", "processed_by": "worker-1", "claimed_at": claimedAt}).Error; err != nil {
+		t.Fatalf("更新源任务失败: %v", err)
+	}
+	exportResp = httptest.NewRecorder()
+	router.ServeHTTP(exportResp, httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+sourceID+"/export", nil))
+	importResp = httptest.NewRecorder()
+	router.ServeHTTP(importResp, httptest.NewRequest(http.MethodPost, "/api/v1/tasks/import", bytes.NewReader(exportResp.Body.Bytes())))
+	if importResp.Code != http.StatusOK {
+		t.Fatalf("导入失败: %d %s", importResp.Code, importResp.Body.String())
+	}
+	if err := json.Unmarshal(importResp.Body.Bytes(), &result); err != nil {
+		t.Fatalf("解析导入响应失败: %v", err)
+	}
+	task, err = db.GetTask(ctx, result.TaskID)
+	if err != nil {
+		t.Fatalf("获取导入任务失败: %v", err)
+	}
+	if task.Status != "failed" || task.ErrorMsg == "" || task.ProcessedBy != "" || task.ClaimedAt != nil {
+		t.Errorf("未完成任务导入后应标记为失败且无领取信息: %+v", task)
+	}
+}
+
+func TestTaskBundle_ImportRejectsOversizedBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers(nil, nil, newMemoryStorage())
+	h.SetMaxUploadSize(16)
+
+	router := gin.New()
+	router.POST("/api/v1/tasks/import", h.ImportTaskBundle)
+
+	body := bytes.Repeat([]byte{0}, 2*16+multipartOverhead+1)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/v1/tasks/import", bytes.NewReader(body)))
+	if resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超限的任务包应返回413，得到 %d", resp.Code)
+	}
+}
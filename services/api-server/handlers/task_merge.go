@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/audit"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// 合并任务的类型，合并结果不会入队处理
+const mergeTaskType = "merge"
+
+// MergeTasksRequest 合并两个任务的分类，task_ids 的顺序决定取舍无法区分时保留哪一方
+type MergeTasksRequest struct {
+	TaskIDs []string `json:"task_ids" binding:"required"`
+}
+
+// MergeConflict 两个任务中同一编码的名称或层级不一致时的取舍
+type MergeConflict struct {
+	Code          string `json:"code"`
+	KeptTaskID    string `json:"kept_task_id"`
+	KeptName      string `json:"kept_name"`
+	KeptLevel     string `json:"kept_level"`
+	DroppedTaskID string `json:"dropped_task_id"`
+	DroppedName   string `json:"dropped_name"`
+	DroppedLevel  string `json:"dropped_level"`
+	Reason        string `json:"reason"` // confidence、status 或 order
+}
+
+// MergeCounts 合并结果的统计
+type MergeCounts struct {
+	Total        int `json:"total"`         // 合并后的分类数
+	FirstOnly    int `json:"first_only"`    // 只出现在第一个任务的编码数
+	SecondOnly   int `json:"second_only"`   // 只出现在第二个任务的编码数
+	Shared       int `json:"shared"`        // 两个任务都有的编码数
+	Conflicts    int `json:"conflicts"`     // 共有编码中名称或层级不一致的数量
+	FromFirst    int `json:"from_first"`    // 取自第一个任务的分类数
+	FromSecond   int `json:"from_second"`   // 取自第二个任务的分类数
+	Reparented   int `json:"reparented"`    // 合并后父编码发生变化的分类数
+	SourceFirst  int `json:"source_first"`  // 第一个任务的当前版本分类数
+	SourceSecond int `json:"source_second"` // 第二个任务的当前版本分类数
+}
+
+// MergeTasks 合并两个任务当前版本的分类，以新的任务ID保存为一个新版本
+// 用于同一份字典拆分在两个表格中上传的场景；合并的任务不会重新入队处理
+func (h *Handlers) MergeTasks(c *gin.Context) {
+	var req MergeTasksRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+	if len(req.TaskIDs) != 2 || req.TaskIDs[0] == "" || req.TaskIDs[1] == "" || req.TaskIDs[0] == req.TaskIDs[1] {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "task_ids 必须是两个不同的任务ID", nil)
+		return
+	}
+
+	ctx := c.Request.Context()
+	var sources [2][]*database.Category
+	for i, taskID := range req.TaskIDs {
+		if _, err := h.db.GetTask(ctx, taskID); err != nil {
+			respondError(c, http.StatusNotFound, ErrCodeTaskNotFound, "任务不存在", gin.H{"task_id": taskID})
+			return
+		}
+		categories, err := h.db.GetCurrentCategoriesByTaskID(ctx, taskID)
+		if err != nil {
+			log.Printf("合并任务失败 - 查询分类: TaskID=%s, Error=%v", taskID, err)
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取分类数据失败", nil)
+			return
+		}
+		if len(categories) == 0 {
+			respondError(c, http.StatusNotFound, ErrCodeNotFound, "该任务没有分类数据", gin.H{"task_id": taskID})
+			return
+		}
+		sources[i] = categories
+	}
+
+	merged, conflicts, counts := mergeTaskCategories(req.TaskIDs[0], sources[0], req.TaskIDs[1], sources[1])
+
+	taskID := uuid.New().String()
+	batchID := uuid.New().String()
+	if err := h.saveMergedTask(ctx, taskID, batchID, req.TaskIDs, merged, counts); err != nil {
+		log.Printf("合并任务失败 - TaskID=%s, Error=%v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "保存合并结果失败", nil)
+		return
+	}
+
+	log.Printf("合并任务完成 - 源任务=%v, 新任务=%s, 分类=%d条, 冲突=%d", req.TaskIDs, taskID, counts.Total, counts.Conflicts)
+	h.recordAudit(c, audit.ActionTaskMerge, audit.EntityTask, taskID, gin.H{
+		"source_task_ids": req.TaskIDs,
+		"category_count":  counts.Total,
+		"conflicts":       counts.Conflicts,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":         taskID,
+		"batch_id":        batchID,
+		"source_task_ids": req.TaskIDs,
+		"counts":          counts,
+		"conflicts":       conflicts,
+	})
+}
+
+// saveMergedTask 创建合并任务并写入分类，写入分类失败时删除已创建的任务
+func (h *Handlers) saveMergedTask(ctx context.Context, taskID, batchID string, sourceTaskIDs []string, categories []*database.Category, counts MergeCounts) error {
+	config, err := json.Marshal(map[string]interface{}{"merged_from": sourceTaskIDs})
+	if err != nil {
+		return err
+	}
+	result, err := json.Marshal(map[string]interface{}{
+		"status":  "completed",
+		"message": "Categories merged from source tasks",
+		"merge":   counts,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	task := &database.TaskRecord{
+		ID:            taskID,
+		Type:          mergeTaskType,
+		Status:        "completed",
+		OutputPath:    fmt.Sprintf("results/%s/output.json", taskID),
+		Config:        datatypes.JSON(config),
+		Result:        datatypes.JSON(result),
+		UploadBatchID: batchID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		ProcessedAt:   &now,
+	}
+	if err := h.db.CreateTask(ctx, task); err != nil {
+		return fmt.Errorf("创建任务失败: %w", err)
+	}
+	for _, cat := range categories {
+		cat.TaskID = taskID
+	}
+	if err := h.db.BatchInsertCategoriesWithVersion(ctx, taskID, batchID, categories); err != nil {
+		h.db.WithContext(ctx).Where("task_id = ?", taskID).Delete(&database.Category{})
+		h.db.DeleteTask(ctx, taskID)
+		return fmt.Errorf("写入分类失败: %w", err)
+	}
+	return nil
+}
+
+// mergeTaskCategories 合并两个任务的分类：编码取并集，同一编码优先取置信度更高的一方，
+// 其次取状态为 completed 的一方，仍无法区分时取第一个任务的记录。
+// 合并后按编码重建层级（BuildTree）并按先序展开去重，修正跨任务的父编码
+func mergeTaskCategories(firstID string, first []*database.Category, secondID string, second []*database.Category) ([]*database.Category, []MergeConflict, MergeCounts) {
+	counts := MergeCounts{SourceFirst: len(first), SourceSecond: len(second)}
+	conflicts := make([]MergeConflict, 0)
+
+	chosen := make(map[string]*database.Category, len(first)+len(second))
+	fromSecond := make(map[string]bool)
+	var order []model.FlatCategory
+	for _, cat := range first {
+		if _, exists := chosen[cat.Code]; exists {
+			continue
+		}
+		chosen[cat.Code] = cat
+		order = append(order, model.FlatCategory{Code: cat.Code, Name: cat.Name, Level: cat.Level, ParentCode: cat.ParentCode})
+	}
+	firstCodes := len(chosen)
+
+	seenSecond := make(map[string]bool, len(second))
+	for _, cat := range second {
+		if seenSecond[cat.Code] {
+			continue
+		}
+		seenSecond[cat.Code] = true
+
+		current, exists := chosen[cat.Code]
+		if !exists {
+			chosen[cat.Code] = cat
+			fromSecond[cat.Code] = true
+			counts.SecondOnly++
+			order = append(order, model.FlatCategory{Code: cat.Code, Name: cat.Name, Level: cat.Level, ParentCode: cat.ParentCode})
+			continue
+		}
+
+		counts.Shared++
+		preferSecond, reason := preferMergeCandidate(cat, current)
+		if preferSecond {
+			chosen[cat.Code] = cat
+			fromSecond[cat.Code] = true
+		}
+		if current.Name == cat.Name && current.Level == cat.Level {
+			continue
+		}
+		conflict := MergeConflict{
+			Code:          cat.Code,
+			KeptTaskID:    firstID,
+			KeptName:      current.Name,
+			KeptLevel:     current.Level,
+			DroppedTaskID: secondID,
+			DroppedName:   cat.Name,
+			DroppedLevel:  cat.Level,
+			Reason:        reason,
+		}
+		if preferSecond {
+			conflict.KeptTaskID, conflict.DroppedTaskID = secondID, firstID
+			conflict.KeptName, conflict.DroppedName = cat.Name, current.Name
+			conflict.KeptLevel, conflict.DroppedLevel = cat.Level, current.Level
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	counts.FirstOnly = firstCodes - counts.Shared
+	counts.Conflicts = len(conflicts)
+
+	// 取舍后的名称和层级参与重建，父编码按合并后的编码集合重新推导
+	for i := range order {
+		order[i].Name = chosen[order[i].Code].Name
+		order[i].Level = chosen[order[i].Code].Level
+	}
+	flat := model.Flatten(model.BuildTree(order))
+
+	merged := make([]*database.Category, 0, len(flat))
+	for _, item := range flat {
+		source := chosen[item.Code]
+		cat := *source
+		cat.ID = 0
+		cat.UploadBatchID = ""
+		cat.ParentCode = item.ParentCode
+		if cat.ParentCode != source.ParentCode {
+			counts.Reparented++
+		}
+		if fromSecond[item.Code] {
+			counts.FromSecond++
+		} else {
+			counts.FromFirst++
+		}
+		merged = append(merged, &cat)
+	}
+	counts.Total = len(merged)
+	return merged, conflicts, counts
+}
+
+// preferMergeCandidate 判断 candidate 是否优于 current，并返回取舍依据
+// 未记录置信度的分类视为置信度最低
+func preferMergeCandidate(candidate, current *database.Category) (bool, string) {
+	candidateConfidence, candidateOK := categoryConfidence(candidate)
+	currentConfidence, currentOK := categoryConfidence(current)
+	switch {
+	case candidateOK && (!currentOK || candidateConfidence > currentConfidence):
+		return true, "confidence"
+	case currentOK && (!candidateOK || currentConfidence > candidateConfidence):
+		return false, "confidence"
+	}
+
+	candidateDone := candidate.Status == database.StatusCompleted
+	currentDone := current.Status == database.StatusCompleted
+	if candidateDone != currentDone {
+		return candidateDone, "status"
+	}
+	return false, "order"
+}
+
+// categoryConfidence 读取分类 llm_enhancements 中语义选择的置信度
+func categoryConfidence(cat *database.Category) (float64, bool) {
+	if cat.LLMEnhancements == "" {
+		return 0, false
+	}
+	var enhancements map[string]interface{}
+	if err := json.Unmarshal([]byte(cat.LLMEnhancements), &enhancements); err != nil {
+		return 0, false
+	}
+	confidence, ok := enhancements["confidence"].(float64)
+	return confidence, ok
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+func TestMergeTasks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	h := NewHandlers(db, nil, nil)
+
+	firstID := "6a1c3e5f-7b9d-4f1a-8c3e-5a7c9e1b3d5f"
+	secondID := "7b2d4f6a-8c0e-4a2b-9d4f-6b8d0f2a4c6e"
+	sources := map[string][]*database.Category{
+		firstID: {
+			{Code: "1", Name: "大类", Level: "大类", Status: database.StatusCompleted},
+			{Code: "1-01", Name: "中类", Level: "中类", ParentCode: "1", Status: database.StatusCompleted},
+			{Code: "1-01-01", Name: "小类甲", Level: "小类", ParentCode: "1-01", Status: database.StatusCompleted, LLMEnhancements: `{"confidence":0.6}`},
+			{Code: "1-01-02", Name: "小类乙", Level: "小类", ParentCode: "1-01", Status: database.StatusCompleted},
+		},
+		secondID: {
+			{Code: "1-01-01", Name: "小类甲（修订）", Level: "小类", Status: database.StatusCompleted, LLMEnhancements: `{"confidence":0.9}`},
+			{Code: "1-01-02", Name: "小类乙（草稿）", Level: "小类", Status: database.StatusExcelParsed},
+			{Code: "1-01-01-01", Name: "细类", Level: "细类", ParentCode: "1-01-01", Status: database.StatusCompleted},
+			{Code: "1-01-03", Name: "小类丙", Level: "小类", Status: database.StatusCompleted},
+		},
+	}
+	batches := map[string]string{firstID: "8c3e5a7c-9e1b-4d5f-8a7c-9e1b3d5f7a9c", secondID: "9d4f6b8d-0f2a-4e6b-8d0f-2a4c6e8b0d2f"}
+	for taskID, categories := range sources {
+		if err := db.CreateTask(ctx, &database.TaskRecord{
+			ID: taskID, Type: "rule", Status: "completed", InputPath: "uploads/" + taskID + ".xlsx",
+			OutputPath: "results/" + taskID + "/output.json", Config: datatypes.JSON(`{}`),
+		}); err != nil {
+			t.Fatalf("创建任务失败: %v", err)
+		}
+		for _, cat := range categories {
+			cat.TaskID = taskID
+		}
+		if err := db.BatchInsertCategoriesWithVersion(ctx, taskID, batches[taskID], categories); err != nil {
+			t.Fatalf("插入分类失败: %v", err)
+		}
+	}
+
+	router := gin.New()
+	router.POST("/api/v1/data/merge", h.MergeTasks)
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/data/merge", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"task_ids":["` + firstID + `","` + secondID + `"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("合并失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		TaskID    string          `json:"task_id"`
+		Counts    MergeCounts     `json:"counts"`
+		Conflicts []MergeConflict `json:"conflicts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	expected := MergeCounts{Total: 6, FirstOnly: 2, SecondOnly: 2, Shared: 2, Conflicts: 2, FromFirst: 3, FromSecond: 3, Reparented: 2, SourceFirst: 4, SourceSecond: 4}
+	if resp.Counts != expected {
+		t.Errorf("统计错误: expected %+v, got %+v", expected, resp.Counts)
+	}
+	reasons := make(map[string]MergeConflict)
+	for _, conflict := range resp.Conflicts {
+		reasons[conflict.Code] = conflict
+	}
+	if c := reasons["1-01-01"]; c.Reason != "confidence" || c.KeptTaskID != secondID || c.KeptName != "小类甲（修订）" {
+		t.Errorf("置信度更高的记录应保留, got %+v", c)
+	}
+	if c := reasons["1-01-02"]; c.Reason != "status" || c.KeptTaskID != firstID || c.DroppedName != "小类乙（草稿）" {
+		t.Errorf("completed 的记录应保留, got %+v", c)
+	}
+
+	merged, err := db.GetCurrentCategoriesByTaskID(ctx, resp.TaskID)
+	if err != nil {
+		t.Fatalf("查询合并结果失败: %v", err)
+	}
+	parents := make(map[string]string)
+	for _, cat := range merged {
+		parents[cat.Code] = cat.ParentCode
+	}
+	if len(merged) != 6 || parents["1-01-03"] != "1-01" || parents["1-01-01-01"] != "1-01-01" {
+		t.Errorf("合并后的父编码应按编码重建, got %v", parents)
+	}
+	task, err := db.GetTask(ctx, resp.TaskID)
+	if err != nil || task.Type != mergeTaskType || task.Status != "completed" {
+		t.Errorf("应创建已完成的合并任务, got %+v, %v", task, err)
+	}
+
+	for _, body := range []string{`{}`, `{"task_ids":["` + firstID + `"]}`, `{"task_ids":["` + firstID + `","` + firstID + `"]}`} {
+		if w := post(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+	if w := post(`{"task_ids":["` + firstID + `","00000000-0000-4000-8000-000000000000"]}`); w.Code != http.StatusNotFound {
+		t.Errorf("不存在的任务应返回 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/freedkr/moonshot/internal/integration"
+	"github.com/gin-gonic/gin"
+)
+
+// GetTaskReport 获取任务增量处理流程结束时生成的处理报告
+// 流程尚未结束或失败时没有报告，返回 404
+func (h *Handlers) GetTaskReport(c *gin.Context) {
+	taskID := c.Param("id")
+
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
+	if err != nil {
+		log.Printf("GetTaskReport失败 - TaskID: %s, Error: %v", taskID, err)
+		respondError(c, http.StatusNotFound, ErrCodeTaskNotFound, "任务不存在", gin.H{"task_id": taskID})
+		return
+	}
+
+	var result struct {
+		Report *integration.ProcessingReport `json:"processing_report"`
+	}
+	if len(task.Result) > 0 {
+		if err := json.Unmarshal(task.Result, &result); err != nil {
+			log.Printf("解析任务 %s 的结果失败: %v", taskID, err)
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "解析任务结果失败", nil)
+			return
+		}
+	}
+	if result.Report == nil {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "处理报告尚未生成", gin.H{"status": task.Status})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": taskID,
+		"report":  result.Report,
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/integration"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+func TestGetTaskReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	reported := "4a6c8e0a-2b4d-4f6a-8c0e-2a4c6e8a0b2d"
+	pending := "6c8e0a2c-4d6f-4a8c-9e2a-4c6e8a0c2d4f"
+	tasks := map[string]string{
+		reported: `{"message":"Hierarchy saved to database","processing_report":{"total_codes":3,"pdf_matched":{"by_code":1,"by_name":1,"by_fuzzy":0,"total":2},"llm_enriched":2,"rule_fallback":1,"token_usage":{"total_tokens":45}}}`,
+		pending:  `{"message":"Hierarchy saved to database"}`,
+	}
+	for id, result := range tasks {
+		if err := db.CreateTask(ctx, &database.TaskRecord{
+			ID: id, Type: "rule", Status: "completed", Config: datatypes.JSON(`{}`), Result: datatypes.JSON(result),
+		}); err != nil {
+			t.Fatalf("创建任务失败: %v", err)
+		}
+	}
+
+	h := NewHandlers(db, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/tasks/:id/report", h.GetTaskReport)
+	get := func(taskID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+taskID+"/report", nil))
+		return w
+	}
+
+	w := get(reported)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		TaskID string                       `json:"task_id"`
+		Report integration.ProcessingReport `json:"report"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if body.TaskID != reported || body.Report.TotalCodes != 3 || body.Report.PDFMatched.Total != 2 ||
+		body.Report.RuleFallback != 1 || body.Report.TokenUsage.TotalTokens != 45 {
+		t.Errorf("Unexpected report: %+v", body)
+	}
+
+	for name, tc := range map[string]struct {
+		taskID string
+		code   string
+	}{
+		"report not generated": {taskID: pending, code: ErrCodeNotFound},
+		"task not found":       {taskID: "8e0a2c4e-6f8a-4c0e-8a4c-6e8a0c2e4f6a", code: ErrCodeTaskNotFound},
+	} {
+		w := get(tc.taskID)
+		var resp ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: 解析响应失败: %v", name, err)
+		}
+		if w.Code != http.StatusNotFound || resp.Error.Code != tc.code {
+			t.Errorf("%s: expected 404 %s, got %d %s", name, tc.code, w.Code, resp.Error.Code)
+		}
+	}
+}
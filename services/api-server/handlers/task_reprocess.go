@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/audit"
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/integration"
+	"github.com/freedkr/moonshot/internal/queue"
+	"github.com/gin-gonic/gin"
+)
+
+// ReprocessTaskRequest 重新处理任务的选项，请求体可以省略
+type ReprocessTaskRequest struct {
+	ForcePDF bool `json:"force_pdf"` // 为 true 时重新解析PDF，否则复用任务已保存的PDF提取结果
+}
+
+// ReprocessTask 以原任务ID重新处理已完成或失败的任务
+// 任务ID不变，增量流程会复用已保存的PDF提取结果，只重跑规则和LLM步骤；force_pdf 为 true 时重新解析PDF。
+// 任务未结束、已取消或后台增量流程仍在运行时返回 409
+func (h *Handlers) ReprocessTask(c *gin.Context) {
+	taskID := c.Param("id")
+	ctx := c.Request.Context()
+
+	var req ReprocessTaskRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+	}
+
+	task, err := h.db.GetTask(ctx, taskID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, ErrCodeTaskNotFound, "任务不存在", gin.H{"task_id": taskID})
+		return
+	}
+
+	// 保留创建时的配置，只替换 force_pdf
+	config := map[string]interface{}{}
+	if len(task.Config) > 0 {
+		if err := json.Unmarshal(task.Config, &config); err != nil {
+			log.Printf("解析任务配置失败 - TaskID: %s, Error: %v", taskID, err)
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "解析任务配置失败", nil)
+			return
+		}
+	}
+	config[integration.ForcePDFConfigKey] = req.ForcePDF
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "序列化任务配置失败", nil)
+		return
+	}
+
+	if !h.checkActiveTaskLimit(c) {
+		return
+	}
+
+	if err := h.db.ResetTaskForReprocess(ctx, taskID, configJSON); err != nil {
+		if errors.Is(err, database.ErrTaskNotReprocessable) {
+			code := ErrCodeTaskInProgress
+			if task.Status == "cancelled" {
+				code = ErrCodeTaskFinished
+			}
+			respondError(c, http.StatusConflict, code, "任务当前状态不能重新处理", gin.H{"status": task.Status})
+			return
+		}
+		log.Printf("重置任务失败 - TaskID: %s, Error: %v", taskID, err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "重置任务失败", nil)
+		return
+	}
+	// 上次处理的结构化数据即将被新版本替换
+	h.structuredCache.invalidateTask(taskID)
+
+	queueTask := &queue.Task{
+		ID:        taskID,
+		Type:      task.Type,
+		Data:      config,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Status:    "pending",
+	}
+	if err := h.queue.EnqueueTaskWithContext(ctx, queueTask); err != nil {
+		// 入队失败时将任务标记为失败，避免停留在 pending 占用活跃任务数，之后可以再次重新处理
+		now := time.Now()
+		task.Status = "failed"
+		task.ErrorMsg = "重新处理入队失败"
+		task.Config = configJSON
+		task.Result = nil
+		task.ProcessedBy = ""
+		task.ClaimedAt = nil
+		task.UpdatedAt = now
+		task.ProcessedAt = &now
+		if updateErr := h.db.UpdateTask(ctx, task); updateErr != nil {
+			log.Printf("更新任务状态失败 - TaskID: %s, Error: %v", taskID, updateErr)
+		}
+		respondEnqueueError(c, "任务入队失败", err)
+		return
+	}
+	h.recordAudit(c, audit.ActionTaskReprocess, audit.EntityTask, taskID, gin.H{
+		"previous_status":             task.Status,
+		integration.ForcePDFConfigKey: req.ForcePDF,
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":                     "任务已重新入队",
+		"task_id":                     taskID,
+		"status":                      "pending",
+		integration.ForcePDFConfigKey: req.ForcePDF,
+	})
+}
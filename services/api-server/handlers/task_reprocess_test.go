@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+func TestReprocessTask(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	processedAt := time.Now()
+	flowStarted := time.Now()
+	tasks := []*database.TaskRecord{
+		{ID: "5a1c3e5f-7b9d-4f1a-8c3e-5f7b9d1f3a5c", Type: "rule", Status: "completed", Config: datatypes.JSON(`{"max_rows":100,"force_pdf":true}`),
+			Result: datatypes.JSON(`{"total":3}`), ProcessedAt: &processedAt, ProcessedBy: "worker-1", ClaimedAt: &processedAt},
+		{ID: "6b2d4f6a-8c1e-4a2b-9d4f-6a8c1e2b4d6f", Type: "rule", Status: "completed", Config: datatypes.JSON(`{}`), FlowStartedAt: &flowStarted},
+		{ID: "7c3e5a7b-9d2f-4b3c-8e5a-7b9d2f3c5e7a", Type: "rule", Status: "processing", Config: datatypes.JSON(`{}`)},
+		{ID: "8d4f6b8c-1e3a-4c4d-9f6b-8c1e3a4d6f8b", Type: "rule", Status: "cancelled", Config: datatypes.JSON(`{}`)},
+	}
+	for _, task := range tasks {
+		if err := db.CreateTask(ctx, task); err != nil {
+			t.Fatalf("创建任务失败: %v", err)
+		}
+	}
+
+	q := &recordingQueue{}
+	h := NewHandlers(db, q, nil)
+	router := gin.New()
+	router.POST("/api/v1/tasks/:id/reprocess", h.ReprocessTask)
+	reprocess := func(taskID, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tasks/"+taskID+"/reprocess", strings.NewReader(body)))
+		return w
+	}
+
+	// 省略请求体时复用已保存的PDF提取结果，覆盖创建时的 force_pdf
+	w := reprocess(tasks[0].ID, "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("重新处理已完成任务应返回202，实际 %d %s", w.Code, w.Body.String())
+	}
+	task, err := db.GetTask(ctx, tasks[0].ID)
+	if err != nil {
+		t.Fatalf("获取任务失败: %v", err)
+	}
+	if task.Status != "pending" || task.ProcessedAt != nil || task.ProcessedBy != "" || task.ClaimedAt != nil || len(task.Result) != 0 {
+		t.Errorf("任务应重置为 pending 并清除上次处理信息，实际 %+v", task)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(task.Config, &config); err != nil {
+		t.Fatalf("解析任务配置失败: %v", err)
+	}
+	if config["force_pdf"] != false || config["max_rows"] != float64(100) {
+		t.Errorf("应保留原配置并将 force_pdf 设为 false，实际 %v", config)
+	}
+	if len(q.enqueued) != 1 || q.enqueued[0].ID != tasks[0].ID || q.enqueued[0].Data["force_pdf"] != false {
+		t.Fatalf("任务应以原ID重新入队，实际 %+v", q.enqueued)
+	}
+
+	// 再次完成后 force_pdf 为 true 时重新解析PDF
+	task.Status = "completed"
+	if err := db.UpdateTask(ctx, task); err != nil {
+		t.Fatalf("更新任务失败: %v", err)
+	}
+	if w := reprocess(tasks[0].ID, `{"force_pdf":true}`); w.Code != http.StatusAccepted {
+		t.Fatalf("force_pdf 重新处理应返回202，实际 %d %s", w.Code, w.Body.String())
+	}
+	if len(q.enqueued) != 2 || q.enqueued[1].Data["force_pdf"] != true {
+		t.Errorf("入队数据应携带 force_pdf=true，实际 %+v", q.enqueued)
+	}
+
+	// 增量流程未结束、处理中和已取消的任务不能重新处理
+	for _, tc := range []struct {
+		taskID string
+		code   string
+	}{
+		{tasks[1].ID, ErrCodeTaskInProgress},
+		{tasks[2].ID, ErrCodeTaskInProgress},
+		{tasks[3].ID, ErrCodeTaskFinished},
+	} {
+		w := reprocess(tc.taskID, "")
+		var resp ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		if w.Code != http.StatusConflict || resp.Error.Code != tc.code {
+			t.Errorf("%s: expected 409 %s, got %d %s", tc.taskID, tc.code, w.Code, w.Body.String())
+		}
+	}
+	if len(q.enqueued) != 2 {
+		t.Errorf("被拒绝的任务不应入队，实际入队 %d 次", len(q.enqueued))
+	}
+
+	if w := reprocess("9e5a7c9d-2f4b-4d5e-8a7c-9d2f4b5e7a9c", ""); w.Code != http.StatusNotFound {
+		t.Errorf("不存在的任务应返回404，实际 %d", w.Code)
+	}
+}
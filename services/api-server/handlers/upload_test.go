@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newUploadRequest 构造包含单个 xlsx 文件的 multipart 上传请求
+func newUploadRequest(t *testing.T, size int) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "职业分类.xlsx")
+	if err != nil {
+		t.Fatalf("创建表单失败: %v", err)
+	}
+	part.Write(bytes.Repeat([]byte("x"), size))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestUploadFile_RejectsOversizedBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryStorage()
+	h := NewHandlers(nil, nil, store)
+	h.SetMaxUploadSize(1024)
+	router := gin.New()
+	router.POST("/api/v1/files/upload", h.UploadFile)
+
+	cases := map[string]func(*http.Request){
+		// Content-Length 已知且超限，不读取请求体
+		"content length": func(req *http.Request) {},
+		// 分块上传没有 Content-Length，读取时由 MaxBytesReader 截断
+		"chunked": func(req *http.Request) { req.ContentLength = -1 },
+	}
+	for name, prepare := range cases {
+		req := newUploadRequest(t, 2*multipartOverhead)
+		prepare(req)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected 413, got %d %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	// 请求体在余量之内但文件本身超过上限
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newUploadRequest(t, 4096))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for oversized file, got %d %s", w.Code, w.Body.String())
+	}
+	if len(store.objects) != 0 {
+		t.Errorf("Oversized uploads should not reach storage, got %d objects", len(store.objects))
+	}
+}
+
+func TestUploadFile_RejectsInvalidCallbackURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryStorage()
+	h := NewHandlers(nil, nil, store)
+	router := gin.New()
+	router.POST("/api/v1/files/upload", h.UploadFile)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "职业分类.xlsx")
+	if err != nil {
+		t.Fatalf("创建表单失败: %v", err)
+	}
+	part.Write([]byte("x"))
+	writer.WriteField("callback_url", "ftp://example.com/hook")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid callback_url, got %d %s", w.Code, w.Body.String())
+	}
+	if len(store.objects) != 0 {
+		t.Errorf("Rejected uploads should not reach storage, got %d objects", len(store.objects))
+	}
+}
+
+func TestUploadFile_RejectsInvalidMaxRows(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryStorage()
+	h := NewHandlers(nil, nil, store)
+	router := gin.New()
+	router.POST("/api/v1/files/upload", h.UploadFile)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "职业分类.xlsx")
+	if err != nil {
+		t.Fatalf("创建表单失败: %v", err)
+	}
+	part.Write([]byte("x"))
+	writer.WriteField("max_rows", "-5")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for negative max_rows, got %d %s", w.Code, w.Body.String())
+	}
+	if len(store.objects) != 0 {
+		t.Errorf("Rejected uploads should not reach storage, got %d objects", len(store.objects))
+	}
+}
@@ -7,11 +7,16 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/freedkr/moonshot/internal/config"
 	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/httpx"
+	"github.com/freedkr/moonshot/internal/integration"
+	"github.com/freedkr/moonshot/internal/notify"
 	"github.com/freedkr/moonshot/internal/queue"
 	"github.com/freedkr/moonshot/internal/storage"
 	"github.com/freedkr/moonshot/services/api-server/handlers"
@@ -26,6 +31,11 @@ type Server struct {
 	storage  storage.StorageInterface
 	router   *gin.Engine
 	handlers *handlers.Handlers
+
+	statsPruneInterval time.Duration   // 定期清理处理统计的间隔，0 表示不定期清理
+	auth               gin.HandlerFunc // 除健康检查外所有接口的API密钥认证
+
+	metricsExporter *integration.MetricsExporter // 将补充增强的处理指标定期写入 metrics_snapshots
 }
 
 func main() {
@@ -54,14 +64,17 @@ func main() {
 	}
 }
 
-func NewServer(cfg *config.Config) (*Server, error) {
-	// 设置Gin模式
-	gin.SetMode(cfg.APIServer.Mode)
-	if cfg.App.Debug {
-		gin.SetMode(gin.DebugMode)
+// openDatabase 按 DB_DRIVER 创建数据库连接，sqlite 用于本地开发（SQLITE_PATH 为空时使用内存库）
+func openDatabase(cfg *config.Config) (database.DatabaseInterface, error) {
+	if os.Getenv("DB_DRIVER") == "sqlite" {
+		log.Printf("正在初始化SQLite数据库: path=%s", os.Getenv("SQLITE_PATH"))
+		return database.NewSQLiteDB(&database.SQLiteConfig{
+			Path:      os.Getenv("SQLITE_PATH"),
+			BatchSize: cfg.Database.BatchSize,
+		})
 	}
+
 	log.Printf("正在初始化数据库连接: db=%s", cfg.Database.Database)
-	// 初始化数据库
 	dbConfig := &database.PostgreSQLConfig{ // This can be simplified if NewPostgreSQLDB takes config.DatabaseConfig directly
 		Host:            cfg.Database.Host,
 		Port:            cfg.Database.Port,
@@ -73,8 +86,20 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		MaxIdleConns:    cfg.Database.MaxIdleConns,
 		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
 		ConnMaxIdleTime: cfg.Database.ConnMaxIdleTime,
+
+		SlowQueryThreshold: database.SlowQueryThresholdFromEnv(),
+	}
+	return database.NewPostgreSQLDB(dbConfig)
+}
+
+func NewServer(cfg *config.Config) (*Server, error) {
+	// 设置Gin模式
+	gin.SetMode(cfg.APIServer.Mode)
+	if cfg.App.Debug {
+		gin.SetMode(gin.DebugMode)
 	}
-	db, err := database.NewPostgreSQLDB(dbConfig)
+	// 初始化数据库
+	db, err := openDatabase(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("初始化数据库失败: %w", err)
 	}
@@ -84,6 +109,7 @@ func NewServer(cfg *config.Config) (*Server, error) {
 	if err := db.CreateTables(ctx); err != nil {
 		return nil, fmt.Errorf("创建数据库表失败: %w", err)
 	}
+	schemaCheck := checkSchema(ctx, db)
 
 	// 初始化队列
 	redisQueue, err := queue.NewRedisQueue(cfg.Queue)
@@ -98,6 +124,10 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		SecretAccessKey: cfg.Storage.SecretAccessKey,
 		UseSSL:          cfg.Storage.UseSSL,
 		BucketName:      cfg.Storage.BucketName,
+
+		Versioning:        cfg.Storage.Versioning,
+		UploadsPrefix:     cfg.Storage.UploadsPrefix,
+		UploadsExpireDays: cfg.Storage.UploadsExpireDays,
 	}
 	minioStorage, err := storage.NewMinIOStorage(storageConfig)
 	if err != nil {
@@ -109,15 +139,116 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		return nil, fmt.Errorf("确保存储桶失败: %w", err)
 	}
 
+	// 结构化数据缓存配置
+	cacheSize, cacheTTL := handlers.DefaultStructuredCacheSize, handlers.DefaultStructuredCacheTTL
+	if v := os.Getenv("API_STRUCTURED_CACHE_SIZE"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("API_STRUCTURED_CACHE_SIZE 配置无效: %s", v)
+		}
+		cacheSize = parsed
+	}
+	if v := os.Getenv("API_STRUCTURED_CACHE_TTL"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("API_STRUCTURED_CACHE_TTL 配置无效: %s", v)
+		}
+		cacheTTL = parsed
+	}
+
+	// 处理统计保留天数（0 表示不清理）和定期清理间隔（0 表示只通过接口手动清理）
+	statsRetentionDays, statsPruneInterval := handlers.DefaultStatsRetentionDays, 24*time.Hour
+	if v := os.Getenv("API_STATS_RETENTION_DAYS"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("API_STATS_RETENTION_DAYS 配置无效: %s", v)
+		}
+		statsRetentionDays = parsed
+	}
+	if v := os.Getenv("API_STATS_PRUNE_INTERVAL"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("API_STATS_PRUNE_INTERVAL 配置无效: %s", v)
+		}
+		statsPruneInterval = parsed
+	}
+
+	// 补充增强使用与rule-worker相同的提示词模板、名称规则和任务处理锁
+	processingConfig := integration.LoadProcessingConfig(cfg)
+	if err := integration.InitPromptTemplates(processingConfig.Prompts.TemplatesDir); err != nil {
+		return nil, fmt.Errorf("加载提示词模板失败: %w", err)
+	}
+	if err := integration.InitNameRules(processingConfig.Validation.NameRulesFile); err != nil {
+		return nil, fmt.Errorf("加载名称校验规则失败: %w", err)
+	}
+	enricher := integration.NewIncrementalProcessor(cfg, db)
+	enricher.SetCancellationChecker(redisQueue)
+	enricher.SetTaskLocker(redisQueue)
+	enricher.SetStepTimeouts(processingConfig.StepTimeouts)
+	enricher.SetMinConfidence(processingConfig.Validation.MinConfidence)
+	enricher.SetEnrichLevels(processingConfig.Enrichment.Levels)
+	metricsExporter := integration.NewMetricsExporter(enricher.MetricsCollector(), db, "api-server")
+	metricsExporter.SetRetention(integration.MetricsRetentionFromEnv())
+
 	// 创建处理器
 	handlers := handlers.NewHandlers(db, redisQueue, minioStorage)
+	if limit := os.Getenv("API_MAX_ACTIVE_TASKS"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("API_MAX_ACTIVE_TASKS 配置无效: %s", limit)
+		}
+		handlers.SetMaxActiveTasks(parsed)
+		log.Printf("活跃任务上限: %d", parsed)
+	}
+	handlers.SetMaxUploadSize(int64(cfg.APIServer.MaxUploadSize))
+	handlers.SetCallbackAllowedHosts(notify.AllowedHostsFromEnv())
+	handlers.SetStatsRetention(statsRetentionDays)
+	log.Printf("处理统计保留: %d 天, 定期清理间隔: %s", statsRetentionDays, statsPruneInterval)
+	handlers.SetStructuredCache(cacheSize, cacheTTL)
+	handlers.SetMissingEnricher(enricher)
+	handlers.SetMinConfidence(processingConfig.Validation.MinConfidence)
+	handlers.SetSchemaCheck(schemaCheck)
+	if v := os.Getenv("LLM_TOKEN_COST_PER_1K"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("LLM_TOKEN_COST_PER_1K 配置无效: %s", v)
+		}
+		handlers.SetTokenCost(parsed)
+	}
+	log.Printf("结构化数据缓存: 容量=%d, 过期时间=%s", cacheSize, cacheTTL)
+
+	// API密钥认证，未配置 API_KEYS 时不启用
+	apiKeys, err := middleware.ParseAPIKeys(os.Getenv("API_KEYS"))
+	if err != nil {
+		return nil, fmt.Errorf("API_KEYS 配置无效: %w", err)
+	}
+	if len(apiKeys) == 0 {
+		log.Printf("WARNING: 未配置 API_KEYS，API未启用认证")
+	} else {
+		labels := make([]string, len(apiKeys))
+		for i, key := range apiKeys {
+			labels[i] = key.Label
+		}
+		log.Printf("API密钥认证已启用: %s", strings.Join(labels, ", "))
+	}
 
 	// 创建路由
 	router := gin.New()
-	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 	router.Use(middleware.CORS())
 	router.Use(middleware.RequestID())
+	if os.Getenv("API_COMPRESSION_ENABLED") != "false" {
+		compressionConfig, err := loadCompressionConfig()
+		if err != nil {
+			return nil, err
+		}
+		router.Use(middleware.Compression(compressionConfig))
+	}
+	accessLogConfig, err := httpx.AccessLogConfigFromEnv("API")
+	if err != nil {
+		return nil, err
+	}
+	router.Use(httpx.AccessLog(accessLogConfig))
 
 	server := &Server{
 		config:   cfg,
@@ -126,6 +257,11 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		storage:  minioStorage,
 		router:   router,
 		handlers: handlers,
+
+		statsPruneInterval: statsPruneInterval,
+		auth:               middleware.Auth(apiKeys),
+
+		metricsExporter: metricsExporter,
 	}
 
 	// 设置路由
@@ -134,6 +270,39 @@ func NewServer(cfg *config.Config) (*Server, error) {
 	return server, nil
 }
 
+// checkSchema 检查表结构是否与模型一致，缺失列时记录错误，由 /ready 报告未就绪
+func checkSchema(ctx context.Context, db database.DatabaseInterface) *database.SchemaCheck {
+	check, err := db.CheckSchema(ctx)
+	if err != nil {
+		log.Printf("WARNING: 检查表结构失败: %v", err)
+		return nil
+	}
+	if err := check.Err(); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+	return check
+}
+
+// loadCompressionConfig 读取响应压缩配置，API_COMPRESSION_MIN_SIZE 为字节数，API_COMPRESSION_LEVEL 为gzip级别（1-9）
+func loadCompressionConfig() (middleware.CompressionConfig, error) {
+	compressionConfig := middleware.DefaultCompressionConfig()
+	if v := os.Getenv("API_COMPRESSION_MIN_SIZE"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			return compressionConfig, fmt.Errorf("API_COMPRESSION_MIN_SIZE 配置无效: %s", v)
+		}
+		compressionConfig.MinSize = parsed
+	}
+	if v := os.Getenv("API_COMPRESSION_LEVEL"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > 9 {
+			return compressionConfig, fmt.Errorf("API_COMPRESSION_LEVEL 配置无效: %s", v)
+		}
+		compressionConfig.Level = parsed
+	}
+	return compressionConfig, nil
+}
+
 func (s *Server) setupRoutes() {
 	// 静态文件服务 - 提供前端页面
 	s.router.Static("/static", "./web")
@@ -141,15 +310,27 @@ func (s *Server) setupRoutes() {
 
 	api := s.router.Group("/api/v1")
 
-	// 健康检查
+	// 健康检查，不需要认证
 	api.GET("/health", s.handlers.Health)
 	api.GET("/ready", s.handlers.Ready)
 
+	// 以下接口在配置 API_KEYS 时需要认证
+	api.Use(s.auth)
+	api.POST("/build", s.handlers.BuildHierarchy) // 根据原始记录构建层级结构，不读写数据库
+
 	// 任务管理
 	tasks := api.Group("/tasks")
 	{
 		tasks.POST("", s.handlers.CreateTask)
+		tasks.POST("/status", s.handlers.GetTasksStatus)
+		tasks.POST("/import", s.handlers.ImportTaskBundle)
 		tasks.GET("/:id", s.handlers.GetTask)
+		tasks.GET("/:id/logs", s.handlers.GetTaskLogs)
+		tasks.GET("/:id/report", s.handlers.GetTaskReport)
+		tasks.POST("/:id/cancel", s.handlers.CancelTask)
+		tasks.POST("/:id/enrich-missing", s.handlers.EnrichMissing)
+		tasks.POST("/:id/reprocess", s.handlers.ReprocessTask) // 复用已保存的PDF提取结果，force_pdf 为 true 时重新解析
+		tasks.GET("/:id/export", s.handlers.ExportTaskBundle)
 		tasks.GET("", s.handlers.ListTasks)
 		tasks.DELETE("/:id", s.handlers.DeleteTask)
 	}
@@ -159,24 +340,43 @@ func (s *Server) setupRoutes() {
 	{
 		files.POST("/upload", s.handlers.UploadFile)
 		files.GET("/:id", s.handlers.DownloadFile)
-		files.GET("/download", s.handlers.DownloadResultByTaskID)
+		files.GET("/download", s.handlers.DownloadResultByTaskID) // ?schema=v1|v2 选择结果格式版本，默认 v1
+		files.GET("/download/xlsx", s.handlers.DownloadResultXLSXByTaskID)
 		files.DELETE("/:id", s.handlers.DeleteFile)
 	}
 
 	// 数据管理
 	data := api.Group("/data")
 	{
-		data.GET("/structured", s.handlers.GetAllStructuredData)           // 获取指定版本的所有结构化数据
-		data.GET("/versions/:task_id", s.handlers.GetTaskVersionHistory)   // 获取任务版本历史
-		data.GET("/categories", s.handlers.GetVersionCategories)           // 获取指定版本的分类数据
-		data.GET("/recent-tasks", s.handlers.GetRecentTasks)               // 获取最近的任务列表
+		data.GET("/structured", s.handlers.GetAllStructuredData)              // 获取指定版本的所有结构化数据
+		data.GET("/versions/:task_id", s.handlers.GetTaskVersionHistory)      // 获取任务版本历史
+		data.GET("/categories", s.handlers.GetVersionCategories)              // 获取指定版本的分类数据
+		data.POST("/categories/bulk-update", s.handlers.BulkUpdateCategories) // 批量人工修正分类名称（逐项返回结果）
+		data.GET("/category", s.handlers.GetCategoryDetail)                   // 获取单个分类的完整信息
+		data.PUT("/category", s.handlers.SetCategoryOverride)                 // 人工修正分类名称，重新处理后仍然生效
+		data.GET("/diff", s.handlers.GetVersionDiff)                          // 获取两个版本之间的差异
+		data.GET("/pdf", s.handlers.GetPDFExtraction)                         // 获取PDF提取结果及清洗前后数据
+		data.GET("/ai-tasks", s.handlers.GetAITasks)                          // 获取混合解析器生成的AI任务及解析统计
+		data.GET("/low-confidence", s.handlers.GetLowConfidenceNodes)         // 获取置信度低于阈值、需要人工复核的分类
+		data.GET("/search", s.handlers.SearchCategories)                      // 按名称搜索当前版本的分类（自动补全）
+		data.GET("/review", s.handlers.GetReviewNodes)                        // 获取规则名称、PDF名称与最终名称的对比（支持changed_only）
+		data.POST("/rebuild-hierarchy", s.handlers.RebuildHierarchy)          // 根据编码重建分类层级（支持dry_run预览）
+		data.POST("/merge", s.handlers.MergeTasks)                            // 合并两个任务的分类为新任务（报告冲突和统计）
+		data.GET("/recent-tasks", s.handlers.GetRecentTasks)                  // 获取最近的任务列表
 	}
 
+	// 审计日志
+	api.GET("/audit", s.handlers.GetAuditLog) // 查看写操作的审计日志（支持按task_id过滤）
+
 	// 监控和统计
 	monitor := api.Group("/monitor")
 	{
 		monitor.GET("/stats", s.handlers.GetStats)
 		monitor.GET("/queues", s.handlers.GetQueueStats)
+		monitor.GET("/summary", s.handlers.GetMonitorSummary)         // 所有任务的汇总统计，?since=7d 指定时间窗口
+		monitor.POST("/stats/prune", s.handlers.PruneProcessingStats) // 清理过期的处理统计，保留每个任务最新的一条
+		monitor.GET("/metrics/history", s.handlers.GetMetricsHistory) // 按时间桶汇总的历史处理指标，?since=7d&bucket=1h&stage=
+		monitor.GET("/db/pool", s.handlers.GetDatabasePoolStats)      // 数据库连接池的当前状态（连接数、等待次数和时长）
 	}
 }
 
@@ -190,6 +390,15 @@ func (s *Server) Start() error {
 		WriteTimeout: s.config.APIServer.Timeout,
 	}
 
+	// 定期清理过期的处理统计，服务器关闭时停止
+	pruneCtx, stopPruning := context.WithCancel(context.Background())
+	defer stopPruning()
+	go s.handlers.RunStatsPruning(pruneCtx, s.statsPruneInterval)
+	// 定期输出数据库连接池状态，与统计清理同时停止
+	go database.RunPoolStatsExport(pruneCtx, s.db, database.PoolStatsIntervalFromEnv())
+	// 定期导出补充增强的处理指标快照
+	go s.metricsExporter.Run(pruneCtx, integration.MetricsFlushIntervalFromEnv())
+
 	// 在goroutine中启动服务器
 	go func() {
 		log.Printf("API服务器启动在 %s", addr)
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/freedkr/moonshot/internal/audit"
+	"github.com/freedkr/moonshot/services/api-server/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKey 一个API密钥，Label 作为审计日志中的操作人
+type APIKey struct {
+	Label    string
+	Key      string
+	ReadOnly bool // 只读密钥只能访问 GET/HEAD 请求
+}
+
+// APIKeyHeader 除 Authorization: Bearer 之外携带密钥的请求头
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyQueryParam SSE、文件下载等无法设置请求头的场景通过查询参数携带密钥
+const apiKeyQueryParam = "api_key"
+
+// ParseAPIKeys 解析 API_KEYS 配置：逗号分隔的 label:key，末尾加 :readonly 表示只读密钥，
+// 如 "ops:k1,viewer:k2:readonly"；为空时返回空列表（不启用认证）
+func ParseAPIKeys(v string) ([]APIKey, error) {
+	var keys []APIKey
+	labels := make(map[string]bool)
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("API密钥格式应为 label:key[:readonly]: %q", item)
+		}
+		key := APIKey{Label: parts[0], Key: parts[1]}
+		if len(parts) == 3 {
+			if parts[2] != "readonly" {
+				return nil, fmt.Errorf("API密钥 %s 的权限无效: %s", parts[0], parts[2])
+			}
+			key.ReadOnly = true
+		}
+		if labels[key.Label] {
+			return nil, fmt.Errorf("API密钥标签重复: %s", key.Label)
+		}
+		labels[key.Label] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Auth API密钥认证中间件，keys 为空时不做认证，便于本地开发
+// 未携带或密钥无效时返回 401，只读密钥访问写接口时返回 403；
+// 认证通过后以密钥标签覆盖操作人请求头，审计日志中的操作人不能由客户端伪造
+func Auth(keys []APIKey) gin.HandlerFunc {
+	if len(keys) == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		token := requestAPIKey(c)
+		if token == "" {
+			abortAuth(c, http.StatusUnauthorized, handlers.ErrCodeUnauthorized, "缺少API密钥")
+			return
+		}
+		key := matchAPIKey(keys, token)
+		if key == nil {
+			abortAuth(c, http.StatusUnauthorized, handlers.ErrCodeUnauthorized, "API密钥无效")
+			return
+		}
+		if key.ReadOnly && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			abortAuth(c, http.StatusForbidden, handlers.ErrCodeForbidden, "只读密钥不能执行写操作")
+			return
+		}
+
+		c.Request.Header.Set(audit.ActorHeader, key.Label)
+		c.Next()
+	}
+}
+
+// requestAPIKey 依次从 Authorization: Bearer、X-API-Key 和 api_key 查询参数中取密钥
+func requestAPIKey(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return strings.TrimSpace(key)
+	}
+	return c.Query(apiKeyQueryParam)
+}
+
+// matchAPIKey 以恒定时间比较查找密钥，避免通过响应时间猜测密钥
+func matchAPIKey(keys []APIKey, token string) *APIKey {
+	var matched *APIKey
+	for i := range keys {
+		if subtle.ConstantTimeCompare([]byte(keys[i].Key), []byte(token)) == 1 {
+			matched = &keys[i]
+		}
+	}
+	return matched
+}
+
+func abortAuth(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, handlers.ErrorResponse{Error: handlers.APIError{Code: code, Message: message}})
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/audit"
+	"github.com/freedkr/moonshot/services/api-server/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+func newAuthRouter(keys []APIKey) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.Use(Auth(keys))
+	actor := func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetHeader(audit.ActorHeader))
+	}
+	router.GET("/tasks", actor)
+	router.POST("/tasks", actor)
+	return router
+}
+
+func serveAuth(router *gin.Engine, method, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthDisabledWithoutKeys(t *testing.T) {
+	router := newAuthRouter(nil)
+	w := serveAuth(router, http.MethodPost, "/tasks", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("未配置密钥时应放行, got %d", w.Code)
+	}
+}
+
+func TestAuthRejectsMissingAndInvalidKeys(t *testing.T) {
+	router := newAuthRouter([]APIKey{{Label: "ops", Key: "secret"}})
+
+	if w := serveAuth(router, http.MethodGet, "/health", nil); w.Code != http.StatusOK {
+		t.Fatalf("健康检查不需要认证, got %d", w.Code)
+	}
+
+	for name, header := range map[string]map[string]string{
+		"missing": nil,
+		"invalid": {APIKeyHeader: "wrong"},
+		"scheme":  {"Authorization": "Basic secret"},
+	} {
+		w := serveAuth(router, http.MethodGet, "/tasks", header)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected 401, got %d", name, w.Code)
+		}
+		var resp handlers.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: 解析响应失败: %v", name, err)
+		}
+		if resp.Error.Code != handlers.ErrCodeUnauthorized {
+			t.Fatalf("%s: expected %s, got %s", name, handlers.ErrCodeUnauthorized, resp.Error.Code)
+		}
+	}
+}
+
+func TestAuthAcceptsKeyLocations(t *testing.T) {
+	router := newAuthRouter([]APIKey{{Label: "ops", Key: "secret"}, {Label: "ci", Key: "other"}})
+
+	cases := []struct {
+		target string
+		header map[string]string
+		actor  string
+	}{
+		{"/tasks", map[string]string{"Authorization": "Bearer secret"}, "ops"},
+		{"/tasks", map[string]string{APIKeyHeader: "other"}, "ci"},
+		{"/tasks?api_key=secret", nil, "ops"},
+		// 客户端传入的操作人会被密钥标签覆盖
+		{"/tasks", map[string]string{APIKeyHeader: "other", audit.ActorHeader: "admin"}, "ci"},
+	}
+	for _, tc := range cases {
+		w := serveAuth(router, http.MethodPost, tc.target, tc.header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %v: expected 200, got %d", tc.target, tc.header, w.Code)
+		}
+		if w.Body.String() != tc.actor {
+			t.Fatalf("%s %v: expected actor %s, got %s", tc.target, tc.header, tc.actor, w.Body.String())
+		}
+	}
+}
+
+func TestAuthReadOnlyKey(t *testing.T) {
+	router := newAuthRouter([]APIKey{{Label: "viewer", Key: "view", ReadOnly: true}})
+	header := map[string]string{APIKeyHeader: "view"}
+
+	if w := serveAuth(router, http.MethodGet, "/tasks", header); w.Code != http.StatusOK {
+		t.Fatalf("只读密钥应能读取, got %d", w.Code)
+	}
+	w := serveAuth(router, http.MethodPost, "/tasks", header)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("只读密钥写操作应返回 403, got %d", w.Code)
+	}
+	var resp handlers.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error.Code != handlers.ErrCodeForbidden {
+		t.Fatalf("expected %s, got %s (%v)", handlers.ErrCodeForbidden, w.Body.String(), err)
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys(" ops:k1 , viewer:k2:readonly,")
+	if err != nil {
+		t.Fatalf("ParseAPIKeys: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != (APIKey{Label: "ops", Key: "k1"}) || keys[1] != (APIKey{Label: "viewer", Key: "k2", ReadOnly: true}) {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+
+	if keys, err := ParseAPIKeys(""); err != nil || len(keys) != 0 {
+		t.Fatalf("空配置应返回空列表, got %+v, %v", keys, err)
+	}
+
+	for _, v := range []string{"nokey", "ops:", ":k1", "ops:k1:admin", "ops:k1,ops:k2", "a:b:c:d"} {
+		if _, err := ParseAPIKeys(v); err == nil {
+			t.Fatalf("%q 应解析失败", v)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompressionConfig 响应压缩配置
+type CompressionConfig struct {
+	// MinSize 响应体达到该字节数才压缩，更小的响应压缩收益不抵开销
+	MinSize int
+	// Level gzip 压缩级别
+	Level int
+	// ExcludedContentTypes 不压缩的 Content-Type 前缀，如已经压缩过的 xlsx、归档文件和 SSE 流
+	ExcludedContentTypes []string
+}
+
+// DefaultCompressionConfig 返回默认压缩配置
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		MinSize: 1024,
+		Level:   gzip.DefaultCompression,
+		ExcludedContentTypes: []string{
+			"application/vnd.openxmlformats-officedocument", // xlsx 本身是 zip
+			"application/zip",
+			"application/gzip",
+			"application/octet-stream", // 原始文件下载
+			"image/",
+			"text/event-stream", // SSE 需要逐条推送
+		},
+	}
+}
+
+// Compression gzip 响应压缩中间件
+// 客户端 Accept-Encoding 包含 gzip 且响应体超过 MinSize 时压缩；WebSocket 升级和 SSE 请求直接放行
+func Compression(cfg CompressionConfig) gin.HandlerFunc {
+	if cfg.Level < gzip.HuffmanOnly || cfg.Level > gzip.BestCompression {
+		cfg.Level = gzip.DefaultCompression
+	}
+	pool := &sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, cfg.Level)
+		return w
+	}}
+
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" ||
+			strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: c.Writer, cfg: &cfg, pool: pool, status: http.StatusOK}
+		c.Writer = writer
+		defer writer.finish()
+		c.Next()
+	}
+}
+
+// acceptsGzip 判断 Accept-Encoding 是否接受 gzip（q=0 表示拒绝）
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		encoding := strings.TrimSpace(fields[0])
+		if encoding != "gzip" && encoding != "*" {
+			continue
+		}
+		for _, param := range fields[1:] {
+			if q, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressWriter 缓存响应体直到可以判断是否压缩：
+// 超过 MinSize 时开始gzip输出，请求结束时仍未超过则原样输出
+type compressWriter struct {
+	gin.ResponseWriter
+	cfg  *CompressionConfig
+	pool *sync.Pool
+
+	status   int
+	buf      []byte
+	decided  bool
+	gz       *gzip.Writer
+	finished bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if !w.decided {
+		w.status = code
+	}
+}
+
+// WriteHeaderNow 在写入响应体之前被调用时（如 AbortWithStatus）不再压缩
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *compressWriter) Status() int {
+	if !w.decided {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *compressWriter) Written() bool {
+	return w.decided || len(w.buf) > 0
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		if !w.compressible() {
+			w.decide(false)
+		} else {
+			w.buf = append(w.buf, data...)
+			if len(w.buf) < w.cfg.MinSize {
+				return len(data), nil
+			}
+			buffered := w.buf
+			w.buf = nil
+			w.decide(true)
+			if _, err := w.gz.Write(buffered); err != nil {
+				return 0, err
+			}
+			return len(data), nil
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 流式响应无法等到 MinSize，按内容类型立即决定是否压缩
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		buffered := w.buf
+		w.buf = nil
+		w.decide(w.compressible() && len(buffered) > 0)
+		w.writeBuffered(buffered)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.decided = true
+	return w.ResponseWriter.Hijack()
+}
+
+// compressible 根据状态码和已设置的响应头判断响应是否可以压缩
+func (w *compressWriter) compressible() bool {
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+	header := w.ResponseWriter.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	for _, excluded := range w.cfg.ExcludedContentTypes {
+		if strings.HasPrefix(contentType, excluded) {
+			return false
+		}
+	}
+	return true
+}
+
+// decide 写出响应头，compress 为 true 时切换为gzip输出
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	if compress {
+		header := w.ResponseWriter.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressWriter) writeBuffered(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if w.gz != nil {
+		w.gz.Write(data)
+		return
+	}
+	w.ResponseWriter.Write(data)
+}
+
+// finish 请求结束时输出未达到 MinSize 的缓存内容，并关闭gzip写入器
+func (w *compressWriter) finish() {
+	if w.finished {
+		return
+	}
+	w.finished = true
+	if !w.decided {
+		if len(w.buf) == 0 {
+			// 处理器没有写入响应体，交给gin按原状态码输出
+			w.ResponseWriter.WriteHeader(w.status)
+			w.decided = true
+			return
+		}
+		buffered := w.buf
+		w.buf = nil
+		w.decide(false)
+		w.writeBuffered(buffered)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		w.gz.Reset(nil)
+		w.pool.Put(w.gz)
+		w.gz = nil
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCompressionRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Compression(DefaultCompressionConfig()))
+	large := strings.Repeat(`{"code":"1-01-01-01","name":"职业名称"},`, 200)
+	router.GET("/large", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(large))
+	})
+	router.GET("/small", func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"ok": true})
+	})
+	router.GET("/xlsx", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", []byte(large))
+	})
+	router.GET("/empty", func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusNoContent)
+	})
+	return router
+}
+
+func serve(router *gin.Engine, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCompression_LargeResponse(t *testing.T) {
+	w := serve(newCompressionRouter(), "/large", "gzip, deflate")
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip encoding, got %q", w.Header().Get("Content-Encoding"))
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", w.Header().Get("Vary"))
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip body: %v", err)
+	}
+	body, _ := io.ReadAll(reader)
+	if !strings.HasPrefix(string(body), `{"code":"1-01-01-01"`) || len(body) < 1024 {
+		t.Errorf("Unexpected decompressed body length %d", len(body))
+	}
+}
+
+func TestCompression_SkipsSmallExcludedAndUnaccepted(t *testing.T) {
+	router := newCompressionRouter()
+
+	small := serve(router, "/small", "gzip")
+	if small.Header().Get("Content-Encoding") != "" || small.Code != http.StatusCreated || small.Body.String() != `{"ok":true}` {
+		t.Errorf("Small response should pass through, got %d %q %q", small.Code, small.Header().Get("Content-Encoding"), small.Body.String())
+	}
+
+	xlsx := serve(router, "/xlsx", "gzip")
+	if xlsx.Header().Get("Content-Encoding") != "" {
+		t.Errorf("xlsx download should not be compressed")
+	}
+
+	unaccepted := serve(router, "/large", "gzip;q=0, br")
+	if unaccepted.Header().Get("Content-Encoding") != "" || unaccepted.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Response should not be compressed when gzip is refused")
+	}
+
+	empty := serve(router, "/empty", "gzip")
+	if empty.Code != http.StatusNoContent || empty.Body.Len() != 0 {
+		t.Errorf("Expected empty 204, got %d with %d bytes", empty.Code, empty.Body.Len())
+	}
+}
@@ -14,7 +14,7 @@ func CORS() gin.HandlerFunc {
 		if origin != "" {
 			c.Header("Access-Control-Allow-Origin", origin)
 			c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, UPDATE")
-			c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization, Cache-Control, X-File-Name, X-Request-ID")
+			c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization, Cache-Control, X-File-Name, X-Request-ID, X-Auth-User, X-API-Key")
 			c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Cache-Control, Content-Language, Content-Type")
 			c.Header("Access-Control-Allow-Credentials", "true")
 		}
@@ -43,14 +43,6 @@ func RequestID() gin.HandlerFunc {
 	})
 }
 
-// AuthMiddleware 认证中间件（暂时空实现）
-func AuthMiddleware() gin.HandlerFunc {
-	return gin.HandlerFunc(func(c *gin.Context) {
-		// TODO: 实现JWT或其他认证逻辑
-		c.Next()
-	})
-}
-
 // RateLimiter 限流中间件（暂时空实现）
 func RateLimiter() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
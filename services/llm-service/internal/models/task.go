@@ -3,6 +3,7 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -43,6 +44,7 @@ type LLMTask struct {
 	Result     json.RawMessage `json:"result,omitempty" db:"result"`           // 处理结果(JSON)
 	Error      string          `json:"error,omitempty" db:"error"`             // 错误信息
 	TokenUsage *TokenUsage     `json:"token_usage,omitempty" db:"token_usage"` // Token使用量
+	Truncated  bool            `json:"truncated,omitempty" db:"truncated"`     // 输出是否因max_tokens不足被截断
 
 	// 时间戳
 	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
@@ -50,10 +52,16 @@ type LLMTask struct {
 	StartedAt   *time.Time `json:"started_at,omitempty" db:"started_at"`
 	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
 
-	// 元数据
+	// 元数据，调用方通过 parent_task_id 和 step 关联发起调用的上游任务
 	Metadata map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
 }
 
+// 调用方写入 Metadata 的关联字段
+const (
+	MetadataParentTaskID = "parent_task_id" // 发起调用的上游任务ID，如 rule-worker 的任务ID
+	MetadataStep         = "step"           // 发起调用的处理步骤
+)
+
 // TaskConfig 任务配置
 type TaskConfig struct {
 	// 批处理配置
@@ -80,6 +88,11 @@ type TaskConfig struct {
 	TopP             float64 `json:"top_p,omitempty"`
 	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"`
 	PresencePenalty  float64 `json:"presence_penalty,omitempty"`
+
+	// 确定性模式：温度固定为0并使用固定seed，用于提示词修改的回归测试
+	// 注意：模型版本变化时输出仍可能不同
+	Deterministic bool `json:"deterministic,omitempty"`
+	Seed          int  `json:"seed,omitempty"` // 确定性模式下的seed，0表示使用默认值
 }
 
 // LLMTaskType 任务类型，扩展自internal/llm
@@ -127,6 +140,31 @@ const (
 // Priority 任务优先级，复用internal/llm定义
 // type Priority = llm.Priority
 
+// Weight 返回优先级的数值权重，数值越大优先级越高
+// 未知或空优先级按普通优先级处理
+func (p Priority) Weight() int {
+	switch p {
+	case PriorityLow:
+		return 1
+	case PriorityHigh:
+		return 3
+	case PriorityUrgent:
+		return 4
+	default:
+		return 2
+	}
+}
+
+// IsValid 判断优先级是否为已定义的取值
+func (p Priority) IsValid() bool {
+	switch p {
+	case PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent:
+		return true
+	default:
+		return false
+	}
+}
+
 // LLMResult 通用LLM结果结构
 type LLMResult struct {
 	TaskID      string                 `json:"task_id"`
@@ -139,6 +177,7 @@ type LLMResult struct {
 	Provider    string                 `json:"provider"`              // 使用的提供商
 	Model       string                 `json:"model"`                 // 使用的模型
 	Confidence  float64                `json:"confidence,omitempty"`  // 置信度
+	Truncated   bool                   `json:"truncated,omitempty"`   // 输出是否被截断
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`    // 元数据
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
@@ -179,7 +218,7 @@ type TaskMetrics struct {
 
 // CallbackEvent 回调事件
 type CallbackEvent struct {
-	EventType string                 `json:"event_type"` // started, progress, completed, failed
+	EventType string                 `json:"event_type"` // started, progress, completed, failed, cancelled
 	TaskID    string                 `json:"task_id"`
 	Status    TaskStatus             `json:"status"`
 	Progress  float64                `json:"progress,omitempty"` // 进度百分比
@@ -196,6 +235,36 @@ func (t *LLMTask) IsTerminal() bool {
 	return t.Status == StatusCompleted || t.Status == StatusFailed || t.Status == StatusCancelled
 }
 
+// ParentTaskID 返回元数据中的上游任务ID，未设置时返回空字符串
+func (t *LLMTask) ParentTaskID() string {
+	return t.metadataString(MetadataParentTaskID)
+}
+
+// Step 返回元数据中的处理步骤，未设置时返回空字符串
+func (t *LLMTask) Step() string {
+	return t.metadataString(MetadataStep)
+}
+
+// LogLabel 日志中使用的任务标识，包含上游任务ID和处理步骤
+func (t *LLMTask) LogLabel() string {
+	parent := t.ParentTaskID()
+	if parent == "" {
+		return t.ID
+	}
+	if step := t.Step(); step != "" {
+		return fmt.Sprintf("%s parent=%s step=%s", t.ID, parent, step)
+	}
+	return fmt.Sprintf("%s parent=%s", t.ID, parent)
+}
+
+func (t *LLMTask) metadataString(key string) string {
+	if t.Metadata == nil {
+		return ""
+	}
+	value, _ := t.Metadata[key].(string)
+	return value
+}
+
 // GetDuration 获取任务持续时间
 func (t *LLMTask) GetDuration() time.Duration {
 	if t.CompletedAt != nil {
@@ -98,6 +98,10 @@ type ProviderConfig struct {
 	Timeout    time.Duration          `json:"timeout,omitempty"`
 	MaxRetries int                    `json:"max_retries,omitempty"`
 	Settings   map[string]interface{} `json:"settings,omitempty"`
+
+	// 按小时和日统计的保留时长，为0时分别保留48小时和30天
+	HourlyStatsRetention time.Duration `json:"hourly_stats_retention,omitempty"`
+	DailyStatsRetention  time.Duration `json:"daily_stats_retention,omitempty"`
 }
 
 // ProviderStatus 提供商状态
@@ -131,6 +135,16 @@ type Condition struct {
 	Value    interface{} `json:"value"`    // 比较值
 }
 
+// AdmissionChecker 可在发送前检查速率限制的提供商，调度器在分配工作协程前据此判断任务能否立即执行
+type AdmissionChecker interface {
+	CanAccept() bool
+}
+
+// MetricsReporter 可上报指标的提供商
+type MetricsReporter interface {
+	GetMetrics() ProviderMetrics
+}
+
 // ProviderMetrics 提供商指标
 type ProviderMetrics struct {
 	RequestCount        int64         `json:"request_count"`
@@ -141,6 +155,8 @@ type ProviderMetrics struct {
 	AverageTokensPerSec float64       `json:"average_tokens_per_sec"`
 	TotalCost           float64       `json:"total_cost"`
 	LastRequestTime     time.Time     `json:"last_request_time"`
+	TruncationCount     int64         `json:"truncation_count"`   // 输出因max_tokens不足被截断的次数
+	TruncationRetries   int64         `json:"truncation_retries"` // 截断后提高max_tokens重试的次数
 
 	// 按时间窗口的统计
 	HourlyStats map[string]*HourlyStats `json:"hourly_stats,omitempty"`
@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/freedkr/moonshot/internal/clock"
 	"github.com/freedkr/moonshot/services/llm-service/internal/models"
 )
 
@@ -21,6 +22,8 @@ type KimiProvider struct {
 	config      ProviderConfig
 	httpClient  *http.Client
 	metrics     *ProviderMetrics
+	retention   bucketRetention
+	clock       clock.Clock
 	mutex       sync.RWMutex
 	rateLimiter *RateLimiter
 }
@@ -31,7 +34,8 @@ type KimiAPIRequest struct {
 	Messages       []KimiMessage       `json:"messages"`
 	ResponseFormat *KimiResponseFormat `json:"response_format,omitempty"`
 	MaxTokens      int                 `json:"max_tokens,omitempty"`
-	Temperature    float64             `json:"temperature,omitempty"`
+	Temperature    float64             `json:"temperature"` // 不省略，确定性模式需要显式传0
+	Seed           *int                `json:"seed,omitempty"`
 }
 
 // KimiMessage 消息结构
@@ -108,6 +112,8 @@ func NewKimiProvider(config ProviderConfig) (*KimiProvider, error) {
 			HourlyStats: make(map[string]*HourlyStats),
 			DailyStats:  make(map[string]*DailyStats),
 		},
+		retention: newBucketRetention(config),
+		clock:     clock.Real(),
 	}
 
 	// 初始化速率限制器
@@ -118,6 +124,13 @@ func NewKimiProvider(config ProviderConfig) (*KimiProvider, error) {
 	return provider, nil
 }
 
+// SetClock 替换时间源，用于按小时和日统计的分桶
+func (k *KimiProvider) SetClock(c clock.Clock) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.clock = clock.OrReal(c)
+}
+
 // Name 返回提供商名称
 func (k *KimiProvider) Name() string {
 	return k.name
@@ -156,7 +169,7 @@ func (k *KimiProvider) GetModels() []Model {
 			Name:           "Moonshot V1 Auto",
 			Provider:       k.name,
 			Type:           "chat",
-			MaxTokens:      8000,
+			MaxTokens:      128000, // 按提示词长度自动路由，最大到128k模型
 			SupportsBatch:  true,
 			SupportsStream: false,
 			Pricing: &ModelPricing{
@@ -210,6 +223,11 @@ func (k *KimiProvider) GetModels() []Model {
 	}
 }
 
+// CanAccept 速率限制当前是否允许立即发送请求，未配置速率限制时总是允许
+func (k *KimiProvider) CanAccept() bool {
+	return k.rateLimiter == nil || k.rateLimiter.CanRequest()
+}
+
 // GetLimits 获取速率限制 - 根据实际Kimi账号配额配置
 func (k *KimiProvider) GetLimits() RateLimit {
 	return RateLimit{
@@ -254,7 +272,7 @@ func (k *KimiProvider) Process(ctx context.Context, task *models.LLMTask) (*mode
 	k.recordRequest()
 
 	// 处理任务
-	result, _, err := k.processTask(ctx, task)
+	result, usage, truncated, err := k.processTask(ctx, task)
 
 	// 记录结果
 	processTime := time.Since(startTime)
@@ -263,7 +281,7 @@ func (k *KimiProvider) Process(ctx context.Context, task *models.LLMTask) (*mode
 		return nil, err
 	}
 
-	k.recordSuccess()
+	k.recordSuccess(usage)
 
 	// 构建结果 - 不包含TokenUsage字段，稍后设置
 	llmResult := &models.LLMResult{
@@ -274,9 +292,13 @@ func (k *KimiProvider) Process(ctx context.Context, task *models.LLMTask) (*mode
 		ProcessTime: processTime,
 		Provider:    k.name,
 		Model:       task.Model,
+		Truncated:   truncated,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
+	if truncated {
+		llmResult.Metadata = map[string]interface{}{"finish_reason": "length"}
+	}
 
 	return llmResult, nil
 }
@@ -291,29 +313,50 @@ func (k *KimiProvider) ProcessStream(ctx context.Context, task *models.LLMTask)
 }
 
 // ProcessBatch 批量处理
+// 批内任务并发执行，同时运行的协程数不超过 GetLimits 声明的并发上限，实际请求速率仍由速率限制器控制；
+// 结果与 tasks 一一对应，单个任务失败记录在对应结果中
 func (k *KimiProvider) ProcessBatch(ctx context.Context, tasks []*models.LLMTask) ([]*models.LLMResult, error) {
-	results := make([]*models.LLMResult, 0, len(tasks))
-
-	for _, task := range tasks {
-		result, err := k.Process(ctx, task)
-		if err != nil {
-			result = &models.LLMResult{
-				TaskID:    task.ID,
-				Type:      task.Type,
-				Status:    models.StatusFailed,
-				Error:     err.Error(),
-				Provider:  k.name,
-				Model:     task.Model,
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-			}
+	results := make([]*models.LLMResult, len(tasks))
+	sem := make(chan struct{}, max(1, k.GetLimits().ConcurrentRequests))
+
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = k.failedResult(task, ctx.Err())
+			continue
 		}
-		results = append(results, result)
+		wg.Add(1)
+		go func(i int, task *models.LLMTask) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result, err := k.Process(ctx, task)
+			if err != nil {
+				result = k.failedResult(task, err)
+			}
+			results[i] = result
+		}(i, task)
 	}
+	wg.Wait()
 
 	return results, nil
 }
 
+// failedResult 构造批量处理中单个任务的失败结果
+func (k *KimiProvider) failedResult(task *models.LLMTask, err error) *models.LLMResult {
+	return &models.LLMResult{
+		TaskID:    task.ID,
+		Type:      task.Type,
+		Status:    models.StatusFailed,
+		Error:     err.Error(),
+		Provider:  k.name,
+		Model:     task.Model,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
+
 // HealthCheck 健康检查
 func (k *KimiProvider) HealthCheck(ctx context.Context) error {
 	// 使用一个简单的测试请求
@@ -350,8 +393,13 @@ func (k *KimiProvider) Close() error {
 	return nil
 }
 
+// maxTruncationRetries 输出被截断时提高max_tokens重试的最大次数
+const maxTruncationRetries = 2
+
 // processTask 处理具体任务 - 确保参数正确传递
-func (k *KimiProvider) processTask(ctx context.Context, task *models.LLMTask) (interface{}, *TokenUsage, error) {
+// 输出因max_tokens不足被截断（finish_reason=length）时，提高max_tokens重试直到模型上限；
+// 仍被截断时返回 truncated=true，调用方不应把结果当作完整JSON解析
+func (k *KimiProvider) processTask(ctx context.Context, task *models.LLMTask) (interface{}, *TokenUsage, bool, error) {
 	// 构建消息列表
 	messages := []KimiMessage{}
 
@@ -378,35 +426,77 @@ func (k *KimiProvider) processTask(ctx context.Context, task *models.LLMTask) (i
 		},
 		Temperature: k.getTemperature(task), // ✅ 确保参数传递
 		MaxTokens:   k.getMaxTokens(task),   // ✅ 确保参数传递
+		Seed:        k.getSeed(task),
 	}
 
-	// 调用API
-	response, err := k.callKimiAPI(ctx, request)
-	if err != nil {
-		return nil, nil, k.wrapError(err)
-	}
+	tokenUsage := &TokenUsage{}
+	var rawResponse string
+	for attempt := 0; ; attempt++ {
+		// 调用API
+		response, err := k.callKimiAPI(ctx, request)
+		if err != nil {
+			if attempt > 0 {
+				// 提高max_tokens后的重试失败，返回上一次被截断的结果
+				log.Printf("⚠️ [Kimi] 提高max_tokens=%d重试失败，返回截断结果: %v", request.MaxTokens, err)
+				return rawResponse, tokenUsage, true, nil
+			}
+			return nil, nil, false, k.wrapError(err)
+		}
 
-	if len(response.Choices) == 0 {
-		return nil, nil, &ProviderError{
-			Provider: k.name,
-			Code:     "NO_RESPONSE",
-			Message:  "API响应中没有选择项",
+		if len(response.Choices) == 0 {
+			return nil, nil, false, &ProviderError{
+				Provider: k.name,
+				Code:     "NO_RESPONSE",
+				Message:  "API响应中没有选择项",
+			}
 		}
-	}
 
-	// 构建token使用情况
-	tokenUsage := &TokenUsage{
-		PromptTokens:     response.Usage.PromptTokens,
-		CompletionTokens: response.Usage.CompletionTokens,
-		TotalTokens:      response.Usage.TotalTokens,
+		// 累计token使用情况（包含被截断的尝试）
+		tokenUsage.PromptTokens += response.Usage.PromptTokens
+		tokenUsage.CompletionTokens += response.Usage.CompletionTokens
+		tokenUsage.TotalTokens += response.Usage.TotalTokens
+
+		// 直接返回原始响应，不进行JSON解析，避免双重编码问题
+		rawResponse = response.Choices[0].Message.Content
+		fmt.Printf("🔍 DEBUG: Kimi API原始响应: %s\n", rawResponse)
+
+		if response.Choices[0].FinishReason != "length" {
+			return rawResponse, tokenUsage, false, nil
+		}
+
+		k.recordTruncation()
+		raised := nextMaxTokens(request.MaxTokens, modelTokenLimit(request.Model), response.Usage.PromptTokens)
+		if attempt >= maxTruncationRetries || raised <= request.MaxTokens {
+			log.Printf("⚠️ [Kimi] 任务 %s 输出被截断，max_tokens=%d 已达上限", task.ID, request.MaxTokens)
+			return rawResponse, tokenUsage, true, nil
+		}
+
+		log.Printf("⚠️ [Kimi] 任务 %s 输出被截断，max_tokens 从 %d 提高到 %d 重试", task.ID, request.MaxTokens, raised)
+		k.recordTruncationRetry()
+		request.MaxTokens = raised
 	}
+}
 
-	// 直接返回原始响应，不进行JSON解析，避免双重编码问题
-	rawResponse := response.Choices[0].Message.Content
-	fmt.Printf("🔍 DEBUG: Kimi API原始响应: %s\n", rawResponse)
-	fmt.Printf("🔍 DEBUG: 直接返回原始字符串，避免双重JSON编码\n")
+// modelTokenLimit 获取模型的上下文长度上限，auto模型会按需路由到128k模型
+func modelTokenLimit(model string) int {
+	switch model {
+	case "moonshot-v1-8k":
+		return 8000
+	case "moonshot-v1-32k":
+		return 32000
+	default:
+		return 128000
+	}
+}
 
-	return rawResponse, tokenUsage, nil
+// nextMaxTokens 计算截断后重试使用的max_tokens：翻倍，但不超过模型上限减去提示词占用
+func nextMaxTokens(current, modelLimit, promptTokens int) int {
+	available := modelLimit - promptTokens
+	next := current * 2
+	if next > available {
+		next = available
+	}
+	return next
 }
 
 // selectModel 选择合适的模型
@@ -419,6 +509,11 @@ func (k *KimiProvider) selectModel(task *models.LLMTask) string {
 
 // getTemperature 获取温度参数 - 确保参数传递
 func (k *KimiProvider) getTemperature(task *models.LLMTask) float64 {
+	// 确定性模式固定温度为0
+	if task.Config.Deterministic {
+		return 0
+	}
+
 	// 优先使用任务指定的温度
 	if task.Temperature > 0 {
 		return task.Temperature
@@ -428,6 +523,22 @@ func (k *KimiProvider) getTemperature(task *models.LLMTask) float64 {
 	return 0.1
 }
 
+// defaultDeterministicSeed 确定性模式下未指定seed时使用的默认值
+const defaultDeterministicSeed = 42
+
+// getSeed 获取随机种子，仅在确定性模式下传递
+func (k *KimiProvider) getSeed(task *models.LLMTask) *int {
+	if !task.Config.Deterministic {
+		return nil
+	}
+
+	seed := defaultDeterministicSeed
+	if task.Config.Seed != 0 {
+		seed = task.Config.Seed
+	}
+	return &seed
+}
+
 // getMaxTokens 获取最大token数 - 确保参数传递
 func (k *KimiProvider) getMaxTokens(task *models.LLMTask) int {
 	// 检查配置中的max_tokens参数
@@ -530,20 +641,53 @@ func (k *KimiProvider) wrapError(err error) error {
 func (k *KimiProvider) recordRequest() {
 	k.mutex.Lock()
 	defer k.mutex.Unlock()
+	now := k.clock.Now()
 	k.metrics.RequestCount++
-	k.metrics.LastRequestTime = time.Now()
+	k.metrics.LastRequestTime = now
+	k.metrics.addToBuckets(now, metricsDelta{requests: 1}, k.retention)
 }
 
-func (k *KimiProvider) recordSuccess() {
+// recordSuccess 记录成功的调用，usage 包含截断重试消耗的token
+func (k *KimiProvider) recordSuccess(usage *TokenUsage) {
+	delta := metricsDelta{successes: 1}
+	if usage != nil {
+		delta.tokens = int64(usage.TotalTokens)
+		delta.cost = tokenCost(k.GetPricing(), usage)
+	}
+
 	k.mutex.Lock()
 	defer k.mutex.Unlock()
 	k.metrics.SuccessCount++
+	k.metrics.TotalTokens += delta.tokens
+	k.metrics.TotalCost += delta.cost
+	k.metrics.addToBuckets(k.clock.Now(), delta, k.retention)
 }
 
 func (k *KimiProvider) recordError() {
 	k.mutex.Lock()
 	defer k.mutex.Unlock()
 	k.metrics.ErrorCount++
+	k.metrics.addToBuckets(k.clock.Now(), metricsDelta{errors: 1}, k.retention)
+}
+
+func (k *KimiProvider) recordTruncation() {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.metrics.TruncationCount++
+}
+
+func (k *KimiProvider) recordTruncationRetry() {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.metrics.TruncationRetries++
+}
+
+// GetMetrics 获取指标快照，按小时和日的统计为深拷贝
+func (k *KimiProvider) GetMetrics() ProviderMetrics {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	return k.metrics.snapshot()
 }
 
 // 初始化时注册Kimi提供商工厂
@@ -0,0 +1,280 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/clock"
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+)
+
+// newTruncatingKimiServer 模拟在 max_tokens 小于 required 时返回 finish_reason=length 的Kimi API
+func newTruncatingKimiServer(t *testing.T, required int, seen *[]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req KimiAPIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		*seen = append(*seen, req.MaxTokens)
+
+		finishReason, content := "stop", `[{"code":"1"}]`
+		if req.MaxTokens < required {
+			finishReason, content = "length", `[{"code":`
+		}
+		json.NewEncoder(w).Encode(KimiAPIResponse{
+			Choices: []KimiChoice{{Message: KimiMessage{Role: "assistant", Content: content}, FinishReason: finishReason}},
+			Usage:   KimiUsage{PromptTokens: 1000, CompletionTokens: req.MaxTokens, TotalTokens: 1000 + req.MaxTokens},
+		})
+	}))
+}
+
+func newTestKimiProvider(t *testing.T, baseURL string) *KimiProvider {
+	provider, err := NewKimiProvider(ProviderConfig{Name: "kimi", APIKey: "test", BaseURL: baseURL})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	return provider
+}
+
+func TestKimiProvider_ProcessTask_RetriesWithHigherMaxTokens(t *testing.T) {
+	var seen []int
+	server := newTruncatingKimiServer(t, 15000, &seen)
+	defer server.Close()
+
+	provider := newTestKimiProvider(t, server.URL)
+	task := &models.LLMTask{ID: "task-1", Model: "moonshot-v1-32k", Prompt: "test", Config: models.TaskConfig{MaxTokens: 4000}}
+
+	result, usage, truncated, err := provider.processTask(context.Background(), task)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if truncated {
+		t.Error("Expected result not to be truncated after retry")
+	}
+	if result != `[{"code":"1"}]` {
+		t.Errorf("Expected complete result, got %v", result)
+	}
+	if len(seen) != 3 || seen[0] != 4000 || seen[1] != 8000 || seen[2] != 16000 {
+		t.Errorf("Expected max_tokens 4000 -> 8000 -> 16000, got %v", seen)
+	}
+	if usage.PromptTokens != 3000 {
+		t.Errorf("Expected usage accumulated across attempts, got %d prompt tokens", usage.PromptTokens)
+	}
+	if metrics := provider.GetMetrics(); metrics.TruncationCount != 2 || metrics.TruncationRetries != 2 {
+		t.Errorf("Expected 2 truncations and 2 retries, got %+v", metrics)
+	}
+}
+
+func TestKimiProvider_ProcessTask_FlagsTruncationAtModelLimit(t *testing.T) {
+	var seen []int
+	server := newTruncatingKimiServer(t, 100000, &seen)
+	defer server.Close()
+
+	provider := newTestKimiProvider(t, server.URL)
+	task := &models.LLMTask{ID: "task-1", Model: "moonshot-v1-8k", Prompt: "test", Config: models.TaskConfig{MaxTokens: 4000}}
+
+	_, _, truncated, err := provider.processTask(context.Background(), task)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !truncated {
+		t.Error("Expected result to be flagged as truncated")
+	}
+	// 8k模型减去1000提示词，最多提高到7000
+	if len(seen) != 2 || seen[1] != 7000 {
+		t.Errorf("Expected retry capped at 7000 max_tokens, got %v", seen)
+	}
+}
+
+func TestNextMaxTokens(t *testing.T) {
+	tests := []struct {
+		current, limit, prompt, expected int
+	}{
+		{30000, 128000, 10000, 60000},
+		{30000, 128000, 90000, 38000},
+		{30000, 32000, 5000, 27000},
+	}
+
+	for _, tt := range tests {
+		if got := nextMaxTokens(tt.current, tt.limit, tt.prompt); got != tt.expected {
+			t.Errorf("nextMaxTokens(%d, %d, %d) = %d, expected %d", tt.current, tt.limit, tt.prompt, got, tt.expected)
+		}
+	}
+}
+
+func TestKimiProvider_DeterministicMode(t *testing.T) {
+	provider := newTestKimiProvider(t, "http://localhost")
+
+	task := &models.LLMTask{Temperature: 0.7, Config: models.TaskConfig{Deterministic: true}}
+	if temperature := provider.getTemperature(task); temperature != 0 {
+		t.Errorf("Expected temperature 0 in deterministic mode, got %v", temperature)
+	}
+	if seed := provider.getSeed(task); seed == nil || *seed != defaultDeterministicSeed {
+		t.Errorf("Expected default seed %d, got %v", defaultDeterministicSeed, seed)
+	}
+
+	task.Config.Seed = 7
+	if seed := provider.getSeed(task); seed == nil || *seed != 7 {
+		t.Errorf("Expected configured seed 7, got %v", seed)
+	}
+
+	task.Config.Deterministic = false
+	if temperature := provider.getTemperature(task); temperature != 0.7 {
+		t.Errorf("Expected task temperature 0.7, got %v", temperature)
+	}
+	if seed := provider.getSeed(task); seed != nil {
+		t.Errorf("Expected no seed outside deterministic mode, got %d", *seed)
+	}
+}
+
+func TestKimiProvider_ProcessBatch_KeepsOrderAndIsolatesFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req KimiAPIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		prompt := req.Messages[len(req.Messages)-1].Content
+		if prompt == "bad" {
+			http.Error(w, `{"error":{"message":"invalid","type":"invalid_request_error"}}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(KimiAPIResponse{
+			Choices: []KimiChoice{{Message: KimiMessage{Role: "assistant", Content: prompt}, FinishReason: "stop"}},
+		})
+	}))
+	defer server.Close()
+
+	provider := newTestKimiProvider(t, server.URL)
+	prompts := []string{"p0", "p1", "bad", "p3"}
+	tasks := make([]*models.LLMTask, len(prompts))
+	for i, prompt := range prompts {
+		tasks[i] = &models.LLMTask{ID: prompt, Type: models.TaskTypeDataCleaning, Prompt: prompt}
+	}
+
+	results, err := provider.ProcessBatch(context.Background(), tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != len(tasks) {
+		t.Fatalf("Expected %d results, got %d", len(tasks), len(results))
+	}
+	for i, result := range results {
+		if prompts[i] == "bad" {
+			if result.Status != models.StatusFailed || result.Error == "" || result.TaskID != "bad" {
+				t.Errorf("Expected failed result for 'bad', got %+v", result)
+			}
+			continue
+		}
+		if result.Data != prompts[i] {
+			t.Errorf("Expected result %d to be %q, got %v", i, prompts[i], result.Data)
+		}
+	}
+}
+
+func TestKimiProvider_ProcessBatch_BoundsConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			peak := maxInFlight.Load()
+			if current <= peak || maxInFlight.CompareAndSwap(peak, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		json.NewEncoder(w).Encode(KimiAPIResponse{
+			Choices: []KimiChoice{{Message: KimiMessage{Role: "assistant", Content: "ok"}, FinishReason: "stop"}},
+		})
+	}))
+	defer server.Close()
+
+	provider := newTestKimiProvider(t, server.URL)
+	limit := provider.GetLimits().ConcurrentRequests
+	tasks := make([]*models.LLMTask, limit+50)
+	for i := range tasks {
+		tasks[i] = &models.LLMTask{ID: fmt.Sprintf("t%d", i), Type: models.TaskTypeDataCleaning, Prompt: "p"}
+	}
+
+	results, err := provider.ProcessBatch(context.Background(), tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, result := range results {
+		if result == nil || result.Status == models.StatusFailed {
+			t.Fatalf("Expected result %d to succeed, got %+v", i, result)
+		}
+	}
+	if peak := int(maxInFlight.Load()); peak > limit {
+		t.Errorf("Expected at most %d concurrent requests, got %d", limit, peak)
+	}
+}
+
+func TestKimiProvider_Metrics_RollsUpAndPrunesBuckets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req KimiAPIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.Messages[len(req.Messages)-1].Content == "bad" {
+			http.Error(w, `{"error":{"message":"invalid","type":"invalid_request_error"}}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(KimiAPIResponse{
+			Choices: []KimiChoice{{Message: KimiMessage{Role: "assistant", Content: "ok"}, FinishReason: "stop"}},
+			Usage:   KimiUsage{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500},
+		})
+	}))
+	defer server.Close()
+
+	provider, err := NewKimiProvider(ProviderConfig{Name: "kimi", APIKey: "test", BaseURL: server.URL, HourlyStatsRetention: 2 * time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	fake := clock.NewFake(time.Date(2024, 1, 1, 23, 30, 0, 0, time.Local))
+	provider.SetClock(fake)
+
+	process := func(prompt string) {
+		provider.Process(context.Background(), &models.LLMTask{ID: prompt, Prompt: prompt})
+	}
+
+	process("p0")
+	process("bad")
+	fake.Advance(time.Hour)
+	process("p1")
+
+	metrics := provider.GetMetrics()
+	if hour := metrics.HourlyStats["2024-01-01T23"]; hour == nil || hour.RequestCount != 2 || hour.SuccessCount != 1 || hour.ErrorCount != 1 || hour.TotalTokens != 1500 {
+		t.Errorf("Unexpected stats for 2024-01-01T23: %+v", hour)
+	}
+	if day := metrics.DailyStats["2024-01-02"]; day == nil || day.RequestCount != 1 || day.SuccessCount != 1 || day.TotalTokens != 1500 {
+		t.Errorf("Unexpected stats for 2024-01-02: %+v", day)
+	}
+	if metrics.TotalTokens != 3000 || metrics.TotalCost <= 0 {
+		t.Errorf("Expected total tokens 3000 and a positive cost, got %d and %v", metrics.TotalTokens, metrics.TotalCost)
+	}
+
+	// 快照为深拷贝，修改不影响提供商内部统计
+	metrics.HourlyStats["2024-01-01T23"].RequestCount = 100
+	if hour := provider.GetMetrics().HourlyStats["2024-01-01T23"]; hour.RequestCount != 2 {
+		t.Errorf("Expected snapshot to be a copy, got request count %d", hour.RequestCount)
+	}
+
+	// 03:30 新建窗口时，结束时间早于 01:30 的小时统计被清理，日统计仍在保留期内
+	fake.Advance(3 * time.Hour)
+	process("p2")
+
+	metrics = provider.GetMetrics()
+	if len(metrics.HourlyStats) != 1 || metrics.HourlyStats["2024-01-02T03"] == nil {
+		t.Errorf("Expected only the 2024-01-02T03 bucket to remain, got %v", metrics.HourlyStats)
+	}
+	if len(metrics.DailyStats) != 2 || metrics.DailyStats["2024-01-02"].RequestCount != 2 {
+		t.Errorf("Expected both daily buckets to remain, got %v", metrics.DailyStats)
+	}
+}
@@ -174,7 +174,15 @@ func (m *DefaultProviderManager) selectDefaultProvider(ctx context.Context, task
 	
 	log.Printf("🔍 [SelectProvider] 检查提供商可用性，总数: %d", len(m.providers))
 	
-	for name, provider := range m.providers {
+	// 按名称顺序检查，保证相同任务总是路由到同一个提供商（确定性模式依赖这一点）
+	names := make([]string, 0, len(m.providers))
+	for name := range m.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		provider := m.providers[name]
 		isAvailable := provider.IsAvailable(ctx)
 		log.Printf("🔍 [SelectProvider] 提供商 %s 可用性: %v", name, isAvailable)
 		
@@ -439,4 +447,32 @@ func (m *DefaultProviderManager) checkProviderHealth(name string, provider Provi
 func (m *DefaultProviderManager) updateMetrics() {
 	// 这里可以实现更复杂的指标收集和更新逻辑
 	// 比如从各个提供商收集性能指标、成本统计等
+	m.mutex.RLock()
+	reporters := make(map[string]MetricsReporter)
+	for name, provider := range m.providers {
+		if reporter, ok := provider.(MetricsReporter); ok {
+			reporters[name] = reporter
+		}
+	}
+	m.mutex.RUnlock()
+
+	for name, reporter := range reporters {
+		metrics := reporter.GetMetrics()
+
+		m.statusMutex.Lock()
+		if status := m.status[name]; status != nil {
+			status.Metrics = map[string]interface{}{
+				"request_count":      metrics.RequestCount,
+				"success_count":      metrics.SuccessCount,
+				"error_count":        metrics.ErrorCount,
+				"truncation_count":   metrics.TruncationCount,
+				"truncation_retries": metrics.TruncationRetries,
+				"total_tokens":       metrics.TotalTokens,
+				"total_cost":         metrics.TotalCost,
+				"hourly_stats":       metrics.HourlyStats,
+				"daily_stats":        metrics.DailyStats,
+			}
+		}
+		m.statusMutex.Unlock()
+	}
 }
\ No newline at end of file
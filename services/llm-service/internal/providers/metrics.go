@@ -0,0 +1,111 @@
+package providers
+
+import "time"
+
+// 按时间窗口统计的默认保留时长
+const (
+	DefaultHourlyStatsRetention = 48 * time.Hour
+	DefaultDailyStatsRetention  = 30 * 24 * time.Hour
+)
+
+// 时间窗口的键格式，按本地时区分桶
+const (
+	hourBucketLayout = "2006-01-02T15"
+	dayBucketLayout  = "2006-01-02"
+)
+
+// metricsDelta 一次调用对时间窗口统计的增量
+type metricsDelta struct {
+	requests  int64
+	successes int64
+	errors    int64
+	tokens    int64
+	cost      float64
+}
+
+// bucketRetention 时间窗口统计的保留时长，非正值时使用默认值
+type bucketRetention struct {
+	hourly time.Duration
+	daily  time.Duration
+}
+
+func newBucketRetention(config ProviderConfig) bucketRetention {
+	retention := bucketRetention{
+		hourly: config.HourlyStatsRetention,
+		daily:  config.DailyStatsRetention,
+	}
+	if retention.hourly <= 0 {
+		retention.hourly = DefaultHourlyStatsRetention
+	}
+	if retention.daily <= 0 {
+		retention.daily = DefaultDailyStatsRetention
+	}
+	return retention
+}
+
+// tokenCost 按每1k token单价计算费用
+func tokenCost(pricing Pricing, usage *TokenUsage) float64 {
+	return float64(usage.PromptTokens)/1000*pricing.PromptTokenPrice +
+		float64(usage.CompletionTokens)/1000*pricing.CompletionTokenPrice
+}
+
+// addToBuckets 把增量计入 now 所在的小时和日统计，调用方需持有写锁
+// 新建时间窗口时顺带清理超过保留时长的窗口，没有新请求时旧窗口保留到下次新建
+func (m *ProviderMetrics) addToBuckets(now time.Time, delta metricsDelta, retention bucketRetention) {
+	hourKey := now.Format(hourBucketLayout)
+	hourly, ok := m.HourlyStats[hourKey]
+	if !ok {
+		hourly = &HourlyStats{Hour: hourKey}
+		m.HourlyStats[hourKey] = hourly
+		m.pruneBuckets(now, retention)
+	}
+	hourly.RequestCount += delta.requests
+	hourly.SuccessCount += delta.successes
+	hourly.ErrorCount += delta.errors
+	hourly.TotalTokens += delta.tokens
+	hourly.TotalCost += delta.cost
+
+	dayKey := now.Format(dayBucketLayout)
+	daily, ok := m.DailyStats[dayKey]
+	if !ok {
+		daily = &DailyStats{Date: dayKey}
+		m.DailyStats[dayKey] = daily
+	}
+	daily.RequestCount += delta.requests
+	daily.SuccessCount += delta.successes
+	daily.ErrorCount += delta.errors
+	daily.TotalTokens += delta.tokens
+	daily.TotalCost += delta.cost
+}
+
+// pruneBuckets 删除窗口结束时间早于 now 减去保留时长的统计，调用方需持有写锁
+func (m *ProviderMetrics) pruneBuckets(now time.Time, retention bucketRetention) {
+	for key := range m.HourlyStats {
+		start, err := time.ParseInLocation(hourBucketLayout, key, now.Location())
+		if err != nil || start.Add(time.Hour).Before(now.Add(-retention.hourly)) {
+			delete(m.HourlyStats, key)
+		}
+	}
+	for key := range m.DailyStats {
+		start, err := time.ParseInLocation(dayBucketLayout, key, now.Location())
+		if err != nil || start.AddDate(0, 0, 1).Before(now.Add(-retention.daily)) {
+			delete(m.DailyStats, key)
+		}
+	}
+}
+
+// snapshot 深拷贝指标，调用方需持有读锁
+func (m *ProviderMetrics) snapshot() ProviderMetrics {
+	metrics := *m
+	metrics.HourlyStats = make(map[string]*HourlyStats, len(m.HourlyStats))
+	for key, stats := range m.HourlyStats {
+		copied := *stats
+		metrics.HourlyStats[key] = &copied
+	}
+	metrics.DailyStats = make(map[string]*DailyStats, len(m.DailyStats))
+	for key, stats := range m.DailyStats {
+		copied := *stats
+		metrics.DailyStats[key] = &copied
+	}
+	return metrics
+}
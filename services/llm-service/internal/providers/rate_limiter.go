@@ -104,10 +104,13 @@ func (r *RateLimiter) CanRequest() bool {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	
-	now := time.Now()
+	// 检查并发限制，并发槽位不随时间窗口重置
+	if r.config.ConcurrentRequests > 0 && r.concurrentReq >= r.config.ConcurrentRequests {
+		return false
+	}
 	
 	// 检查时间窗口
-	if now.Sub(r.windowStart) >= r.config.ResetInterval {
+	if time.Since(r.windowStart) >= r.config.ResetInterval {
 		return true
 	}
 	
@@ -116,11 +119,6 @@ func (r *RateLimiter) CanRequest() bool {
 		return false
 	}
 	
-	// 检查并发限制
-	if r.config.ConcurrentRequests > 0 && r.concurrentReq >= r.config.ConcurrentRequests {
-		return false
-	}
-	
 	return true
 }
 
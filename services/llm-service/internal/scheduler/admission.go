@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+	"github.com/freedkr/moonshot/services/llm-service/internal/providers"
+)
+
+// admissionProviders 任务可能被路由到的提供商：指定了提供商时只有该提供商，否则为全部已注册的提供商
+// 这里不调用 SelectProvider，避免调度循环每轮都触发提供商的健康检查
+func (s *DefaultTaskScheduler) admissionProviders(task *models.LLMTask) []providers.Provider {
+	if s.providerManager == nil {
+		return nil
+	}
+	if task.Provider != "" && task.Provider != "auto" {
+		provider, err := s.providerManager.GetProvider(task.Provider)
+		if err != nil {
+			return nil
+		}
+		return []providers.Provider{provider}
+	}
+
+	names := s.providerManager.ListProviders()
+	candidates := make([]providers.Provider, 0, len(names))
+	for _, name := range names {
+		if provider, err := s.providerManager.GetProvider(name); err == nil {
+			candidates = append(candidates, provider)
+		}
+	}
+	return candidates
+}
+
+// admits 判断任务能否立即执行：至少一个候选提供商有空闲的并发许可，且其速率限制允许发送请求。
+// 不能执行的任务留在队列中，不占用工作协程；没有候选提供商时放行，由工作协程按选择失败处理
+func (s *DefaultTaskScheduler) admits(task *models.LLMTask) bool {
+	candidates := s.admissionProviders(task)
+	if len(candidates) == 0 {
+		return true
+	}
+	for _, provider := range candidates {
+		if !s.concurrencyMgr.CanAcquire(provider.Name(), task.Type) {
+			continue
+		}
+		if checker, ok := provider.(providers.AdmissionChecker); ok && !checker.CanAccept() {
+			continue
+		}
+		return true
+	}
+	return false
+}
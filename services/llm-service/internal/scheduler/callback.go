@@ -21,6 +21,7 @@ type CallbackHandler interface {
 	OnTaskProgress(task *models.LLMTask, progress float64, message string)
 	OnTaskCompleted(task *models.LLMTask)
 	OnTaskFailed(task *models.LLMTask, err error)
+	OnTaskCancelled(task *models.LLMTask)
 	
 	// 注册回调监听器
 	RegisterListener(listener CallbackListener)
@@ -157,6 +158,18 @@ func (h *DefaultCallbackHandler) OnTaskFailed(task *models.LLMTask, err error) {
 	h.sendEvent(event)
 }
 
+// OnTaskCancelled 任务取消回调
+func (h *DefaultCallbackHandler) OnTaskCancelled(task *models.LLMTask) {
+	event := &models.CallbackEvent{
+		EventType: "cancelled",
+		TaskID:    task.ID,
+		Status:    task.Status,
+		Timestamp: time.Now(),
+	}
+
+	h.sendEvent(event)
+}
+
 // RegisterListener 注册回调监听器
 func (h *DefaultCallbackHandler) RegisterListener(listener CallbackListener) {
 	h.listenersMutex.Lock()
@@ -424,4 +437,72 @@ func (w *WebSocketCallbackListener) RemoveConnection(connID string) {
 		conn.Close()
 		delete(w.connections, connID)
 	}
-}
\ No newline at end of file
+}
+
+// TaskWaiterListener 任务结束等待监听器
+// 长轮询请求通过它挂起等待，任务进入终态时由回调事件统一唤醒，无需逐个轮询
+type TaskWaiterListener struct {
+	waiters map[string]map[chan struct{}]struct{}
+	mutex   sync.Mutex
+}
+
+// NewTaskWaiterListener 创建任务结束等待监听器
+func NewTaskWaiterListener() *TaskWaiterListener {
+	return &TaskWaiterListener{
+		waiters: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// Wait 注册对任务结束的等待
+// 返回的通道在任务完成、失败或取消时关闭；调用方结束等待后必须调用返回的注销函数
+func (w *TaskWaiterListener) Wait(taskID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+
+	w.mutex.Lock()
+	if w.waiters[taskID] == nil {
+		w.waiters[taskID] = make(map[chan struct{}]struct{})
+	}
+	w.waiters[taskID][ch] = struct{}{}
+	w.mutex.Unlock()
+
+	return ch, func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		if set, exists := w.waiters[taskID]; exists {
+			delete(set, ch)
+			if len(set) == 0 {
+				delete(w.waiters, taskID)
+			}
+		}
+	}
+}
+
+// OnCallback 处理回调事件，任务进入终态时唤醒所有等待者
+func (w *TaskWaiterListener) OnCallback(event *models.CallbackEvent) {
+	switch event.EventType {
+	case "completed", "failed", "cancelled":
+	default:
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for ch := range w.waiters[event.TaskID] {
+		close(ch)
+	}
+	delete(w.waiters, event.TaskID)
+}
+
+// WaiterCount 获取当前等待者数量
+func (w *TaskWaiterListener) WaiterCount() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	count := 0
+	for _, set := range w.waiters {
+		count += len(set)
+	}
+	return count
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+)
+
+func TestTaskWaiterListener_WakesOnTerminalEvent(t *testing.T) {
+	listener := NewTaskWaiterListener()
+
+	first, unregisterFirst := listener.Wait("task-1")
+	defer unregisterFirst()
+	second, unregisterSecond := listener.Wait("task-1")
+	defer unregisterSecond()
+
+	// 非终态事件不应唤醒等待者
+	listener.OnCallback(&models.CallbackEvent{EventType: "progress", TaskID: "task-1"})
+	select {
+	case <-first:
+		t.Fatal("Expected waiter to keep waiting on progress event")
+	default:
+	}
+
+	listener.OnCallback(&models.CallbackEvent{EventType: "completed", TaskID: "task-1"})
+	for _, ch := range []<-chan struct{}{first, second} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("Expected waiter to be woken on completed event")
+		}
+	}
+
+	if count := listener.WaiterCount(); count != 0 {
+		t.Errorf("Expected 0 waiters after wake-up, got %d", count)
+	}
+}
+
+func TestTaskWaiterListener_UnregisterRemovesWaiter(t *testing.T) {
+	listener := NewTaskWaiterListener()
+
+	_, unregister := listener.Wait("task-1")
+	other, unregisterOther := listener.Wait("task-2")
+	defer unregisterOther()
+
+	unregister()
+	if count := listener.WaiterCount(); count != 1 {
+		t.Errorf("Expected 1 waiter after unregister, got %d", count)
+	}
+
+	listener.OnCallback(&models.CallbackEvent{EventType: "cancelled", TaskID: "task-2"})
+	select {
+	case <-other:
+	default:
+		t.Error("Expected waiter to be woken on cancelled event")
+	}
+}
@@ -2,6 +2,8 @@
 package scheduler
 
 import (
+	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,15 +16,12 @@ type ConcurrencyManager struct {
 	globalSemaphore chan struct{}
 	globalLimit     int
 	
-	// 按提供商的并发限制
-	providerSemaphores map[string]chan struct{}
-	providerLimits     map[string]int
-	providerMutex      sync.RWMutex
-	
-	// 按任务类型的并发限制
-	taskTypeSemaphores map[models.LLMTaskType]chan struct{}
-	taskTypeLimits     map[models.LLMTaskType]int
-	taskTypeMutex      sync.RWMutex
+	// 按提供商和任务类型的并发许可，上限可在运行中调整
+	providerPermits map[string]*providerPermits
+	taskTypePermits map[models.LLMTaskType]*permitPool
+	activeTaskTypes []models.LLMTaskType // 分摊提供商许可的任务类型
+	queuedDemand    map[models.LLMTaskType]int // 各任务类型排队中的任务数，用于按需求分摊许可
+	permitMutex     sync.Mutex
 	
 	// 动态并发控制
 	adaptiveController *AdaptiveConcurrencyController
@@ -32,6 +31,43 @@ type ConcurrencyManager struct {
 	statsMutex   sync.RWMutex
 }
 
+// permitPool 许可池，上限调小时已发放的许可照常归还，归还后才按新上限发放
+type permitPool struct {
+	limit int
+	inUse int
+	fixed bool // 通过 SetTaskTypeLimit 显式设置，不随提供商许可重新分摊
+}
+
+// available 是否还有可用许可
+func (p *permitPool) available() bool {
+	return p.inUse < p.limit
+}
+
+// permitsFor 获取 n 个许可时实际占用的数量，不超过上限
+func (p *permitPool) permitsFor(n int) int {
+	return max(1, min(n, p.limit))
+}
+
+// availableFor 是否还有 permitsFor(n) 个可用许可
+func (p *permitPool) availableFor(n int) bool {
+	return p.inUse+p.permitsFor(n) <= p.limit
+}
+
+// providerPermits 提供商许可池，上限按AIMD在 [1, ceiling] 之间调整：
+// 每成功一轮（成功次数达到当前上限）加一，遇到限流减半
+type providerPermits struct {
+	permitPool
+	ceiling      int // 提供商声明的并发上限
+	successes    int
+	lastDecrease time.Time
+}
+
+// rateLimitDecreaseCooldown 两次减半之间的最小间隔，避免同一波限流中的多个请求把上限连续减半
+const rateLimitDecreaseCooldown = 2 * time.Second
+
+// permitRetryInterval 许可不足时重新尝试获取的间隔
+const permitRetryInterval = 50 * time.Millisecond
+
 // ConcurrencyStats 并发统计
 type ConcurrencyStats struct {
 	GlobalConcurrent     int                               `json:"global_concurrent"`
@@ -43,13 +79,25 @@ type ConcurrencyStats struct {
 	AverageWaitTime      time.Duration                     `json:"average_wait_time"`
 }
 
+// PermitStatus 许可池当前状态
+type PermitStatus struct {
+	Limit   int `json:"limit"`
+	InUse   int `json:"in_use"`
+	Ceiling int `json:"ceiling,omitempty"` // 提供商声明的并发上限，任务类型许可为0
+}
+
+// ConcurrencyStatus 各提供商和任务类型的当前并发许可
+type ConcurrencyStatus struct {
+	Providers map[string]PermitStatus             `json:"providers"`
+	TaskTypes map[models.LLMTaskType]PermitStatus `json:"task_types"`
+}
+
 // NewConcurrencyManager 创建新的并发管理器
 func NewConcurrencyManager() *ConcurrencyManager {
 	return &ConcurrencyManager{
-		providerSemaphores: make(map[string]chan struct{}),
-		providerLimits:     make(map[string]int),
-		taskTypeSemaphores: make(map[models.LLMTaskType]chan struct{}),
-		taskTypeLimits:     make(map[models.LLMTaskType]int),
+		providerPermits: make(map[string]*providerPermits),
+		taskTypePermits: make(map[models.LLMTaskType]*permitPool),
+		queuedDemand:    make(map[models.LLMTaskType]int),
 		stats: &ConcurrencyStats{
 			ProviderConcurrent: make(map[string]int),
 			TaskTypeConcurrent: make(map[models.LLMTaskType]int),
@@ -69,88 +117,252 @@ func (cm *ConcurrencyManager) SetGlobalLimit(limit int) {
 	cm.globalLimit = limit
 }
 
-// SetProviderLimit 设置提供商并发限制
+// SetProviderLimit 设置提供商并发限制，limit<=0 时取消限制
+// 上限同时作为AIMD调整的天花板，重复设置相同的值不会重置已调整的上限
 func (cm *ConcurrencyManager) SetProviderLimit(provider string, limit int) {
-	cm.providerMutex.Lock()
-	defer cm.providerMutex.Unlock()
+	cm.permitMutex.Lock()
+	defer cm.permitMutex.Unlock()
 	
 	if limit <= 0 {
-		delete(cm.providerSemaphores, provider)
-		delete(cm.providerLimits, provider)
+		delete(cm.providerPermits, provider)
+	} else if pool, exists := cm.providerPermits[provider]; !exists {
+		cm.providerPermits[provider] = &providerPermits{permitPool: permitPool{limit: limit}, ceiling: limit}
+	} else if pool.ceiling != limit {
+		pool.ceiling = limit
+		pool.limit = limit
+		pool.successes = 0
+	} else {
 		return
 	}
-	
-	cm.providerSemaphores[provider] = make(chan struct{}, limit)
-	cm.providerLimits[provider] = limit
+	cm.redistributeTaskTypePermits()
 }
 
-// SetTaskTypeLimit 设置任务类型并发限制
+// SetTaskTypeLimit 设置任务类型并发限制，limit<=0 时取消限制
+// 显式设置的上限不再随提供商许可分摊
 func (cm *ConcurrencyManager) SetTaskTypeLimit(taskType models.LLMTaskType, limit int) {
-	cm.taskTypeMutex.Lock()
-	defer cm.taskTypeMutex.Unlock()
+	cm.permitMutex.Lock()
+	defer cm.permitMutex.Unlock()
 	
 	if limit <= 0 {
-		delete(cm.taskTypeSemaphores, taskType)
-		delete(cm.taskTypeLimits, taskType)
+		delete(cm.taskTypePermits, taskType)
 		return
 	}
 	
-	cm.taskTypeSemaphores[taskType] = make(chan struct{}, limit)
-	cm.taskTypeLimits[taskType] = limit
+	pool := cm.getOrCreateTaskTypePool(taskType)
+	pool.limit = limit
+	pool.fixed = true
+}
+
+// SetActiveTaskTypes 设置分摊提供商许可的任务类型，没有排队和执行中的任务时各类型按类型数向上取整均分提供商当前上限之和
+func (cm *ConcurrencyManager) SetActiveTaskTypes(taskTypes []models.LLMTaskType) {
+	cm.permitMutex.Lock()
+	defer cm.permitMutex.Unlock()
+	
+	cm.activeTaskTypes = append([]models.LLMTaskType(nil), taskTypes...)
+	cm.redistributeTaskTypePermits()
+}
+
+// ReportSuccess 记录提供商请求成功，一轮请求全部成功后上限加一，直到声明的并发上限
+func (cm *ConcurrencyManager) ReportSuccess(provider string) {
+	cm.permitMutex.Lock()
+	defer cm.permitMutex.Unlock()
+	
+	pool := cm.providerPermits[provider]
+	if pool == nil || pool.limit >= pool.ceiling {
+		return
+	}
+	pool.successes++
+	if pool.successes < pool.limit {
+		return
+	}
+	pool.successes = 0
+	pool.limit++
+	cm.redistributeTaskTypePermits()
+}
+
+// ReportRateLimit 记录提供商限流，上限减半（最少为1）
+func (cm *ConcurrencyManager) ReportRateLimit(provider string) {
+	cm.permitMutex.Lock()
+	defer cm.permitMutex.Unlock()
+	
+	pool := cm.providerPermits[provider]
+	if pool == nil {
+		return
+	}
+	pool.successes = 0
+	if pool.limit <= 1 || time.Since(pool.lastDecrease) < rateLimitDecreaseCooldown {
+		return
+	}
+	previous := pool.limit
+	pool.limit = max(1, pool.limit/2)
+	pool.lastDecrease = time.Now()
+	cm.redistributeTaskTypePermits()
+	log.Printf("⚠️ [并发控制] 提供商 %s 遇到限流，并发上限 %d -> %d", provider, previous, pool.limit)
+}
+
+// SetTaskTypeDemand 更新各任务类型排队中的任务数，需求变化时按需求重新分摊任务类型许可
+func (cm *ConcurrencyManager) SetTaskTypeDemand(queued map[models.LLMTaskType]int) {
+	cm.permitMutex.Lock()
+	defer cm.permitMutex.Unlock()
+
+	changed := len(queued) != len(cm.queuedDemand)
+	for taskType, count := range queued {
+		if cm.queuedDemand[taskType] != count {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+	cm.queuedDemand = make(map[models.LLMTaskType]int, len(queued))
+	for taskType, count := range queued {
+		cm.queuedDemand[taskType] = count
+	}
+	cm.redistributeTaskTypePermits()
+}
+
+// redistributeTaskTypePermits 按提供商当前上限重新分摊任务类型许可，调用方需持有 permitMutex
+// 各类型的份额与其需求（排队中和执行中的任务数）成正比并向上取整，没有需求的类型保留1个许可以便新任务立即开始；
+// 所有类型都没有需求时均分
+func (cm *ConcurrencyManager) redistributeTaskTypePermits() {
+	if len(cm.activeTaskTypes) == 0 {
+		return
+	}
+	total := 0
+	for _, pool := range cm.providerPermits {
+		total += pool.limit
+	}
+
+	demand := make(map[models.LLMTaskType]int, len(cm.activeTaskTypes))
+	totalDemand := 0
+	for _, taskType := range cm.activeTaskTypes {
+		if pool := cm.taskTypePermits[taskType]; pool != nil && pool.fixed {
+			continue
+		}
+		demand[taskType] = cm.queuedDemand[taskType]
+		if pool := cm.taskTypePermits[taskType]; pool != nil {
+			demand[taskType] += pool.inUse
+		}
+		totalDemand += demand[taskType]
+	}
+
+	for _, taskType := range cm.activeTaskTypes {
+		pool := cm.taskTypePermits[taskType]
+		if pool != nil && pool.fixed {
+			continue
+		}
+		if total == 0 {
+			delete(cm.taskTypePermits, taskType)
+			continue
+		}
+		limit := (total + len(cm.activeTaskTypes) - 1) / len(cm.activeTaskTypes)
+		if totalDemand > 0 {
+			limit = max(1, (total*demand[taskType]+totalDemand-1)/totalDemand)
+		}
+		cm.getOrCreateTaskTypePool(taskType).limit = limit
+	}
+}
+
+// getOrCreateTaskTypePool 获取任务类型许可池，不存在时创建，调用方需持有 permitMutex
+func (cm *ConcurrencyManager) getOrCreateTaskTypePool(taskType models.LLMTaskType) *permitPool {
+	pool := cm.taskTypePermits[taskType]
+	if pool == nil {
+		pool = &permitPool{}
+		cm.taskTypePermits[taskType] = pool
+	}
+	return pool
+}
+
+// GetStatus 获取各提供商和任务类型的当前并发许可
+func (cm *ConcurrencyManager) GetStatus() *ConcurrencyStatus {
+	cm.permitMutex.Lock()
+	defer cm.permitMutex.Unlock()
+	
+	status := &ConcurrencyStatus{
+		Providers: make(map[string]PermitStatus, len(cm.providerPermits)),
+		TaskTypes: make(map[models.LLMTaskType]PermitStatus, len(cm.taskTypePermits)),
+	}
+	for provider, pool := range cm.providerPermits {
+		status.Providers[provider] = PermitStatus{Limit: pool.limit, InUse: pool.inUse, Ceiling: pool.ceiling}
+	}
+	for taskType, pool := range cm.taskTypePermits {
+		status.TaskTypes[taskType] = PermitStatus{Limit: pool.limit, InUse: pool.inUse}
+	}
+	return status
 }
 
 // Acquire 获取并发许可
 func (cm *ConcurrencyManager) Acquire(provider string, taskType models.LLMTaskType) (*ConcurrencyToken, error) {
+	return cm.AcquireN(provider, taskType, 1)
+}
+
+// AcquireN 一次获取 n 个并发许可，用于批量请求中每个任务各占一个许可；全部可用时才占用，否则都不占用
+// n 超过当前上限时按上限获取，避免大于上限的批次永远无法获取
+func (cm *ConcurrencyManager) AcquireN(provider string, taskType models.LLMTaskType, n int) (*ConcurrencyToken, error) {
 	startTime := time.Now()
 	
 	token := &ConcurrencyToken{
 		manager:   cm,
 		provider:  provider,
 		taskType:  taskType,
-		acquired:  make([]string, 0, 3),
+		acquired:  make([]string, 0, 3*n),
 		startTime: startTime,
 	}
 	
 	// 获取全局许可
 	if cm.globalSemaphore != nil {
-		select {
-		case cm.globalSemaphore <- struct{}{}:
-			token.acquired = append(token.acquired, "global")
-		default:
-			return nil, &ConcurrencyError{
-				Type:    "global_limit_exceeded",
-				Message: "全局并发限制已达到",
+		for i := 0; i < min(n, cm.globalLimit); i++ {
+			select {
+			case cm.globalSemaphore <- struct{}{}:
+				token.acquired = append(token.acquired, "global")
+			default:
+				token.release()
+				return nil, &ConcurrencyError{
+					Type:    "global_limit_exceeded",
+					Message: "全局并发限制已达到",
+				}
 			}
 		}
 	}
 	
-	// 获取提供商许可
-	if sem := cm.getProviderSemaphore(provider); sem != nil {
-		select {
-		case sem <- struct{}{}:
-			token.acquired = append(token.acquired, "provider:"+provider)
-		default:
-			token.release()
-			return nil, &ConcurrencyError{
-				Type:    "provider_limit_exceeded",
-				Message: "提供商 " + provider + " 并发限制已达到",
+	// 同时获取提供商和任务类型许可，任一不足时都不占用
+	cm.permitMutex.Lock()
+	providerPool := cm.providerPermits[provider]
+	taskTypePool := cm.taskTypePermits[taskType]
+	var permitErr *ConcurrencyError
+	switch {
+	case providerPool != nil && !providerPool.availableFor(n):
+		permitErr = &ConcurrencyError{
+			Type:    "provider_limit_exceeded",
+			Message: "提供商 " + provider + " 并发限制已达到",
+		}
+	case taskTypePool != nil && !taskTypePool.availableFor(n):
+		permitErr = &ConcurrencyError{
+			Type:    "task_type_limit_exceeded",
+			Message: "任务类型 " + string(taskType) + " 并发限制已达到",
+		}
+	default:
+		if providerPool != nil {
+			count := providerPool.permitsFor(n)
+			providerPool.inUse += count
+			for i := 0; i < count; i++ {
+				token.acquired = append(token.acquired, "provider:"+provider)
 			}
 		}
-	}
-	
-	// 获取任务类型许可
-	if sem := cm.getTaskTypeSemaphore(taskType); sem != nil {
-		select {
-		case sem <- struct{}{}:
-			token.acquired = append(token.acquired, "task_type:"+string(taskType))
-		default:
-			token.release()
-			return nil, &ConcurrencyError{
-				Type:    "task_type_limit_exceeded",
-				Message: "任务类型 " + string(taskType) + " 并发限制已达到",
+		if taskTypePool != nil {
+			count := taskTypePool.permitsFor(n)
+			taskTypePool.inUse += count
+			for i := 0; i < count; i++ {
+				token.acquired = append(token.acquired, "task_type:"+string(taskType))
 			}
 		}
 	}
+	cm.permitMutex.Unlock()
+	if permitErr != nil {
+		token.release()
+		return nil, permitErr
+	}
 	
 	// 更新统计
 	cm.updateStats(provider, taskType, true, time.Since(startTime))
@@ -158,20 +370,39 @@ func (cm *ConcurrencyManager) Acquire(provider string, taskType models.LLMTaskTy
 	return token, nil
 }
 
-// getProviderSemaphore 获取提供商信号量
-func (cm *ConcurrencyManager) getProviderSemaphore(provider string) chan struct{} {
-	cm.providerMutex.RLock()
-	defer cm.providerMutex.RUnlock()
-	
-	return cm.providerSemaphores[provider]
+// CanAcquire 检查当前能否获取提供商和任务类型的并发许可，只检查不占用
+func (cm *ConcurrencyManager) CanAcquire(provider string, taskType models.LLMTaskType) bool {
+	if cm.globalSemaphore != nil && len(cm.globalSemaphore) >= cap(cm.globalSemaphore) {
+		return false
+	}
+
+	cm.permitMutex.Lock()
+	defer cm.permitMutex.Unlock()
+	if pool := cm.providerPermits[provider]; pool != nil && !pool.available() {
+		return false
+	}
+	if pool := cm.taskTypePermits[taskType]; pool != nil && !pool.available() {
+		return false
+	}
+	return true
 }
 
-// getTaskTypeSemaphore 获取任务类型信号量
-func (cm *ConcurrencyManager) getTaskTypeSemaphore(taskType models.LLMTaskType) chan struct{} {
-	cm.taskTypeMutex.RLock()
-	defer cm.taskTypeMutex.RUnlock()
+// releasePermit 归还提供商或任务类型许可
+func (cm *ConcurrencyManager) releasePermit(provider string, taskType models.LLMTaskType, isProvider bool) {
+	cm.permitMutex.Lock()
+	defer cm.permitMutex.Unlock()
 	
-	return cm.taskTypeSemaphores[taskType]
+	var pool *permitPool
+	if isProvider {
+		if p := cm.providerPermits[provider]; p != nil {
+			pool = &p.permitPool
+		}
+	} else {
+		pool = cm.taskTypePermits[taskType]
+	}
+	if pool != nil && pool.inUse > 0 {
+		pool.inUse--
+	}
 }
 
 // updateStats 更新统计信息
@@ -258,16 +489,10 @@ func (ct *ConcurrencyToken) release() {
 			if ct.manager.globalSemaphore != nil {
 				<-ct.manager.globalSemaphore
 			}
-		case acquired[:9] == "provider:":
-			provider := acquired[9:]
-			if sem := ct.manager.getProviderSemaphore(provider); sem != nil {
-				<-sem
-			}
-		case acquired[:10] == "task_type:":
-			taskType := models.LLMTaskType(acquired[10:])
-			if sem := ct.manager.getTaskTypeSemaphore(taskType); sem != nil {
-				<-sem
-			}
+		case strings.HasPrefix(acquired, "provider:"):
+			ct.manager.releasePermit(ct.provider, ct.taskType, true)
+		case strings.HasPrefix(acquired, "task_type:"):
+			ct.manager.releasePermit(ct.provider, ct.taskType, false)
 		}
 	}
 	ct.acquired = ct.acquired[:0]
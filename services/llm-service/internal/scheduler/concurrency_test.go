@@ -0,0 +1,157 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+)
+
+func TestConcurrencyManager_AIMDAdjustsPermits(t *testing.T) {
+	cm := NewConcurrencyManager()
+	cm.SetActiveTaskTypes([]models.LLMTaskType{models.TaskTypeSemanticAnalysis, models.TaskTypeDataCleaning})
+	cm.SetProviderLimit("kimi", 100)
+
+	expect := func(providerLimit, taskTypeLimit int) {
+		t.Helper()
+		status := cm.GetStatus()
+		if got := status.Providers["kimi"]; got.Limit != providerLimit || got.Ceiling != 100 {
+			t.Errorf("Expected provider limit %d/100, got %+v", providerLimit, got)
+		}
+		if got := status.TaskTypes[models.TaskTypeDataCleaning]; got.Limit != taskTypeLimit {
+			t.Errorf("Expected task type limit %d, got %+v", taskTypeLimit, got)
+		}
+	}
+	expect(100, 50)
+
+	// 限流时减半，冷却期内的后续限流不再减半
+	cm.ReportRateLimit("kimi")
+	cm.ReportRateLimit("kimi")
+	expect(50, 25)
+
+	// 一轮（当前上限次）成功后加一
+	for i := 0; i < 49; i++ {
+		cm.ReportSuccess("kimi")
+	}
+	expect(50, 25)
+	cm.ReportSuccess("kimi")
+	expect(51, 26)
+
+	// 重复设置相同的上限不重置已调整的值
+	cm.SetProviderLimit("kimi", 100)
+	expect(51, 26)
+
+	// 显式设置的任务类型上限不参与分摊
+	cm.SetTaskTypeLimit(models.TaskTypeDataCleaning, 5)
+	cm.SetProviderLimit("kimi", 80)
+	status := cm.GetStatus()
+	if got := status.TaskTypes[models.TaskTypeDataCleaning]; got.Limit != 5 {
+		t.Errorf("Expected fixed data cleaning limit 5, got %+v", got)
+	}
+	if got := status.TaskTypes[models.TaskTypeSemanticAnalysis]; got.Limit != 40 {
+		t.Errorf("Expected semantic analysis limit 40, got %+v", got)
+	}
+}
+
+func TestConcurrencyManager_LoweredLimitWaitsForRelease(t *testing.T) {
+	cm := NewConcurrencyManager()
+	cm.SetProviderLimit("kimi", 2)
+
+	first, err := cm.Acquire("kimi", models.TaskTypeDataCleaning)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	second, err := cm.Acquire("kimi", models.TaskTypeDataCleaning)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if _, err := cm.Acquire("kimi", models.TaskTypeDataCleaning); err == nil {
+		t.Fatal("Expected provider limit exceeded")
+	}
+
+	// 上限降到1后，已发放的许可归还一个仍不能获取新许可
+	cm.ReportRateLimit("kimi")
+	first.Release()
+	if _, err := cm.Acquire("kimi", models.TaskTypeDataCleaning); err == nil {
+		t.Fatal("Expected lowered limit to be enforced")
+	}
+	second.Release()
+	token, err := cm.Acquire("kimi", models.TaskTypeDataCleaning)
+	if err != nil {
+		t.Fatalf("Expected permit after all releases, got %v", err)
+	}
+	if got := cm.GetStatus().Providers["kimi"]; got.Limit != 1 || got.InUse != 1 {
+		t.Errorf("Expected 1/1 permits in use, got %+v", got)
+	}
+	token.Release()
+	token.Release()
+	if got := cm.GetStatus().Providers["kimi"]; got.InUse != 0 {
+		t.Errorf("Expected double release to be a no-op, got %+v", got)
+	}
+}
+
+func TestConcurrencyManager_AcquireNTakesOnePermitPerTask(t *testing.T) {
+	cm := NewConcurrencyManager()
+	cm.SetProviderLimit("kimi", 4)
+
+	batch, err := cm.AcquireN("kimi", models.TaskTypeDataCleaning, 3)
+	if err != nil {
+		t.Fatalf("AcquireN failed: %v", err)
+	}
+	if got := cm.GetStatus().Providers["kimi"].InUse; got != 3 {
+		t.Fatalf("Expected 3 permits in use, got %d", got)
+	}
+	if _, err := cm.AcquireN("kimi", models.TaskTypeDataCleaning, 2); err == nil {
+		t.Fatal("Expected batch of 2 to wait for permits")
+	}
+	if got := cm.GetStatus().Providers["kimi"].InUse; got != 3 {
+		t.Fatalf("Failed AcquireN should not hold permits, got %d in use", got)
+	}
+	batch.Release()
+
+	// 大于上限的批次按上限占用
+	whole, err := cm.AcquireN("kimi", models.TaskTypeDataCleaning, 10)
+	if err != nil {
+		t.Fatalf("Expected oversized batch to take the whole limit, got %v", err)
+	}
+	if got := cm.GetStatus().Providers["kimi"].InUse; got != 4 {
+		t.Errorf("Expected 4 permits in use, got %d", got)
+	}
+	whole.Release()
+	if got := cm.GetStatus().Providers["kimi"].InUse; got != 0 {
+		t.Errorf("Expected all permits released, got %d", got)
+	}
+}
+
+func TestConcurrencyManager_RedistributesByDemand(t *testing.T) {
+	cm := NewConcurrencyManager()
+	cm.SetActiveTaskTypes([]models.LLMTaskType{models.TaskTypeSemanticAnalysis, models.TaskTypeDataCleaning, models.TaskTypeTranslation})
+	cm.SetProviderLimit("kimi", 12)
+
+	limits := func() (int, int, int) {
+		status := cm.GetStatus()
+		return status.TaskTypes[models.TaskTypeSemanticAnalysis].Limit,
+			status.TaskTypes[models.TaskTypeDataCleaning].Limit,
+			status.TaskTypes[models.TaskTypeTranslation].Limit
+	}
+	if semantic, cleaning, translation := limits(); semantic != 4 || cleaning != 4 || translation != 4 {
+		t.Fatalf("Expected even split without demand, got %d/%d/%d", semantic, cleaning, translation)
+	}
+
+	// 只有数据清洗排队时它获得全部许可，其他类型保留1个
+	cm.SetTaskTypeDemand(map[models.LLMTaskType]int{models.TaskTypeDataCleaning: 30})
+	if semantic, cleaning, translation := limits(); semantic != 1 || cleaning != 12 || translation != 1 {
+		t.Fatalf("Expected demand-weighted split, got %d/%d/%d", semantic, cleaning, translation)
+	}
+
+	// 按排队数成比例分摊
+	cm.SetTaskTypeDemand(map[models.LLMTaskType]int{models.TaskTypeDataCleaning: 9, models.TaskTypeSemanticAnalysis: 3})
+	if semantic, cleaning, _ := limits(); semantic != 3 || cleaning != 9 {
+		t.Fatalf("Expected 3/9 split, got %d/%d", semantic, cleaning)
+	}
+
+	// 需求消失后恢复均分
+	cm.SetTaskTypeDemand(nil)
+	if semantic, cleaning, translation := limits(); semantic != 4 || cleaning != 4 || translation != 4 {
+		t.Errorf("Expected even split after demand drains, got %d/%d/%d", semantic, cleaning, translation)
+	}
+}
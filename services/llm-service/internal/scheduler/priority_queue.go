@@ -64,6 +64,40 @@ func (pq *PriorityQueue) Peek() *models.LLMTask {
 	return pq.items[0]
 }
 
+// PeekOldest 查看队列中创建最早的任务但不移除，不考虑优先级
+func (pq *PriorityQueue) PeekOldest() *models.LLMTask {
+	pq.mutex.RLock()
+	defer pq.mutex.RUnlock()
+
+	if i := pq.oldestIndex(); i >= 0 {
+		return pq.items[i]
+	}
+	return nil
+}
+
+// PopOldest 取出队列中创建最早的任务，不考虑优先级
+func (pq *PriorityQueue) PopOldest() *models.LLMTask {
+	pq.mutex.Lock()
+	defer pq.mutex.Unlock()
+
+	i := pq.oldestIndex()
+	if i < 0 {
+		return nil
+	}
+	return heap.Remove(&pq.items, i).(*models.LLMTask)
+}
+
+// oldestIndex 返回创建最早的任务在堆中的下标，队列为空时返回 -1，调用方需持有锁
+func (pq *PriorityQueue) oldestIndex() int {
+	oldest := -1
+	for i, task := range pq.items {
+		if oldest < 0 || task.CreatedAt.Before(pq.items[oldest].CreatedAt) {
+			oldest = i
+		}
+	}
+	return oldest
+}
+
 // Len 获取队列长度
 func (pq *PriorityQueue) Len() int {
 	pq.mutex.RLock()
@@ -85,6 +119,22 @@ func (pq *PriorityQueue) IsFull() bool {
 	return pq.Len() >= pq.maxSize
 }
 
+// UpdatePriority 调整队列中任务的优先级并重新堆化
+// 任务不在队列中（例如已被工作协程取走）时返回 false；任务同时登记在调度器中时，调用方需持有调度器的 tasksMutex
+func (pq *PriorityQueue) UpdatePriority(taskID string, priority models.Priority) bool {
+	pq.mutex.Lock()
+	defer pq.mutex.Unlock()
+
+	for i, task := range pq.items {
+		if task.ID == taskID {
+			task.Priority = priority
+			heap.Fix(&pq.items, i)
+			return true
+		}
+	}
+	return false
+}
+
 // Clear 清空队列
 func (pq *PriorityQueue) Clear() {
 	pq.mutex.Lock()
@@ -105,8 +155,8 @@ func (h TaskHeap) Len() int {
 // Less 比较两个任务的优先级
 func (h TaskHeap) Less(i, j int) bool {
 	// 首先按优先级排序（高优先级在前）
-	if h[i].Priority != h[j].Priority {
-		return h[i].Priority > h[j].Priority
+	if h[i].Priority.Weight() != h[j].Priority.Weight() {
+		return h[i].Priority.Weight() > h[j].Priority.Weight()
 	}
 	
 	// 如果优先级相同，按创建时间排序（早创建的在前）
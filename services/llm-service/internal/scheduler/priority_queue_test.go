@@ -0,0 +1,140 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+)
+
+func newQueuedTask(id string, priority models.Priority, createdAt time.Time) *models.LLMTask {
+	return &models.LLMTask{
+		ID:        id,
+		Type:      models.TaskTypeDataCleaning,
+		Status:    models.StatusQueued,
+		Priority:  priority,
+		CreatedAt: createdAt,
+	}
+}
+
+func TestPriorityQueue_OrdersByPriorityWeight(t *testing.T) {
+	pq := NewPriorityQueue(0)
+	now := time.Now()
+
+	pq.Push(newQueuedTask("low", models.PriorityLow, now))
+	pq.Push(newQueuedTask("high", models.PriorityHigh, now.Add(time.Second)))
+	pq.Push(newQueuedTask("normal", models.PriorityNormal, now.Add(2*time.Second)))
+	pq.Push(newQueuedTask("urgent", models.PriorityUrgent, now.Add(3*time.Second)))
+
+	expected := []string{"urgent", "high", "normal", "low"}
+	for _, id := range expected {
+		task := pq.Pop()
+		if task == nil || task.ID != id {
+			t.Fatalf("Expected task '%s', got %v", id, task)
+		}
+	}
+}
+
+func TestPriorityQueue_UpdatePriority(t *testing.T) {
+	pq := NewPriorityQueue(0)
+	now := time.Now()
+
+	for i, id := range []string{"batch-1", "batch-2", "batch-3"} {
+		pq.Push(newQueuedTask(id, models.PriorityNormal, now.Add(time.Duration(i)*time.Second)))
+	}
+	pq.Push(newQueuedTask("interactive", models.PriorityNormal, now.Add(time.Minute)))
+
+	if !pq.UpdatePriority("interactive", models.PriorityUrgent) {
+		t.Fatal("Expected UpdatePriority to find queued task")
+	}
+
+	if task := pq.Pop(); task.ID != "interactive" {
+		t.Errorf("Expected late high-priority task to jump ahead, got '%s'", task.ID)
+	}
+	if task := pq.Pop(); task.ID != "batch-1" {
+		t.Errorf("Expected FIFO order for equal priority, got '%s'", task.ID)
+	}
+
+	if pq.UpdatePriority("interactive", models.PriorityLow) {
+		t.Error("Expected UpdatePriority to return false for task no longer queued")
+	}
+}
+
+func TestDefaultTaskScheduler_UpdateTaskPriority(t *testing.T) {
+	s := NewTaskScheduler(nil, SchedulerConfig{})
+	now := time.Now()
+
+	first := newQueuedTask("first", models.PriorityNormal, now)
+	late := newQueuedTask("late", models.PriorityLow, now.Add(time.Second))
+	for _, task := range []*models.LLMTask{first, late} {
+		if err := s.SubmitTask(context.Background(), task); err != nil {
+			t.Fatalf("SubmitTask failed: %v", err)
+		}
+	}
+
+	if err := s.UpdateTaskPriority("late", models.PriorityHigh); err != nil {
+		t.Fatalf("UpdateTaskPriority failed: %v", err)
+	}
+
+	if task := s.selectNextTask(); task == nil || task.ID != "late" {
+		t.Errorf("Expected 'late' to be selected first, got %v", task)
+	}
+
+	// 已被取走的任务不受影响
+	if err := s.UpdateTaskPriority("late", models.PriorityUrgent); err == nil {
+		t.Error("Expected error when updating a task that has left the queue")
+	}
+	if late.Priority != models.PriorityHigh {
+		t.Errorf("Expected picked task priority unchanged, got '%s'", late.Priority)
+	}
+
+	if err := s.UpdateTaskPriority("first", "bogus"); err == nil {
+		t.Error("Expected error for invalid priority")
+	}
+	if err := s.UpdateTaskPriority("missing", models.PriorityHigh); err == nil {
+		t.Error("Expected error for unknown task")
+	}
+}
+
+// TestDefaultTaskScheduler_UpdateTaskPriorityConcurrentReads 调整优先级与查询接口并发执行，需配合 -race 运行
+func TestDefaultTaskScheduler_UpdateTaskPriorityConcurrentReads(t *testing.T) {
+	s := NewTaskScheduler(nil, SchedulerConfig{})
+	task := newQueuedTask("queued", models.PriorityLow, time.Now())
+	if err := s.SubmitTask(context.Background(), task); err != nil {
+		t.Fatalf("SubmitTask failed: %v", err)
+	}
+
+	priorities := []models.Priority{models.PriorityHigh, models.PriorityLow, models.PriorityUrgent, models.PriorityNormal}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			if err := s.UpdateTaskPriority("queued", priorities[i%len(priorities)]); err != nil {
+				t.Errorf("UpdateTaskPriority failed: %v", err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			got, err := s.GetTaskStatus("queued")
+			if err != nil {
+				t.Errorf("GetTaskStatus failed: %v", err)
+				return
+			}
+			json.Marshal(got)
+			tasks, _, _ := s.ListTasks(TaskFilter{}, 10, 0)
+			json.Marshal(tasks)
+		}
+	}()
+	wg.Wait()
+
+	if got, _ := s.GetTaskStatus("queued"); got.Priority != models.PriorityNormal {
+		t.Errorf("Expected last priority to win, got '%s'", got.Priority)
+	}
+}
@@ -0,0 +1,41 @@
+package scheduler
+
+import (
+	"log"
+
+	"github.com/freedkr/moonshot/internal/tokens"
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+	"github.com/freedkr/moonshot/services/llm-service/internal/providers"
+)
+
+// defaultCompletionReserve 检查提示词大小时默认给输出预留的token数
+const defaultCompletionReserve = 8000
+
+// promptBudget 获取任务在提供商上的提示词预算：模型上下文取提供商声明的 MaxTokens，
+// 任务未指定模型时取最大的一个；提供商没有声明对应模型时返回零值，不做检查
+func (s *DefaultTaskScheduler) promptBudget(provider providers.Provider, task *models.LLMTask) tokens.Budget {
+	contextTokens := 0
+	for _, model := range provider.GetModels() {
+		if task.Model == "" {
+			contextTokens = max(contextTokens, model.MaxTokens)
+		} else if model.ID == task.Model {
+			contextTokens = model.MaxTokens
+			break
+		}
+	}
+	return tokens.Budget{ContextTokens: contextTokens, CompletionReserve: s.config.CompletionReserve}
+}
+
+// checkPromptSize 发送前估算任务提示词的token数，超出模型上下文减去输出预留时返回 tokens.ErrPromptTooLarge。
+// 过大的提示词发送后输出会被截断，重试也不会改变结果，因此直接失败，由调用方拆分后重新提交
+func (s *DefaultTaskScheduler) checkPromptSize(provider providers.Provider, task *models.LLMTask) error {
+	budget := s.promptBudget(provider, task)
+	estimate, err := budget.Check(task.SystemPrompt, task.Prompt)
+	if err != nil {
+		return err
+	}
+	if budget.ContextTokens > 0 {
+		log.Printf("🔍 DEBUG: [任务 %s] 提示词估算 %d tokens，上限 %d", task.LogLabel(), estimate, budget.Limit())
+	}
+	return nil
+}
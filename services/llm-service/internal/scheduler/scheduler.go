@@ -6,10 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/freedkr/moonshot/internal/clock"
 	"github.com/freedkr/moonshot/services/llm-service/internal/models"
 	"github.com/freedkr/moonshot/services/llm-service/internal/providers"
 )
@@ -25,12 +28,19 @@ type TaskScheduler interface {
 	// 取消任务
 	CancelTask(taskID string) error
 	
+	// 调整排队中任务的优先级
+	UpdateTaskPriority(taskID string, priority models.Priority) error
+	
 	// 获取任务列表
-	ListTasks(limit, offset int) ([]*models.LLMTask, int, error)
+	ListTasks(filter TaskFilter, limit, offset int) ([]*models.LLMTask, int, error)
 	
 	// 获取调度器统计
 	GetStats() *SchedulerStats
 	
+	// 暂停和恢复任务分发，暂停期间仍接收提交，排队任务保留，运行中的任务继续完成
+	Pause()
+	Resume()
+	
 	// 生命周期管理
 	Start(ctx context.Context) error
 	Stop(ctx context.Context) error
@@ -68,6 +78,29 @@ type DefaultTaskScheduler struct {
 	
 	// 回调处理
 	callbackHandler CallbackHandler
+	
+	// 加权公平调度的各任务类型累计值
+	fairCredits    map[models.LLMTaskType]int
+	fairMutex      sync.Mutex
+	
+	// 时间源，调度循环、退避等待和任务时间戳都从这里取时间
+	clock          clock.Clock
+	
+	// 暂停时调度循环不再分发任务
+	paused         atomic.Bool
+	
+	// 被清理任务的归档，清理后查询可区分已过期和从未存在
+	taskStore      TaskStore
+}
+
+// TaskFilter 任务列表过滤条件，零值表示不过滤
+type TaskFilter struct {
+	ParentTaskID string // 只返回元数据中 parent_task_id 等于该值的任务
+}
+
+// matches 判断任务是否满足过滤条件
+func (f TaskFilter) matches(task *models.LLMTask) bool {
+	return f.ParentTaskID == "" || task.ParentTaskID() == f.ParentTaskID
 }
 
 // SchedulerConfig 调度器配置
@@ -79,6 +112,25 @@ type SchedulerConfig struct {
 	StatsInterval    time.Duration `json:"stats_interval"`
 	RetryAttempts    int           `json:"retry_attempts"`
 	RetryDelay       time.Duration `json:"retry_delay"`
+
+	// 结果保留：终态任务超过 ResultTTL 后从内存清理。ArchiveResults 开启时清理前把结果写入 TaskStore，
+	// 否则只记录过期标记；TaskStore 中的记录保留 ArchiveTTL
+	ResultTTL      time.Duration `json:"result_ttl"`
+	ArchiveResults bool          `json:"archive_results"`
+	ArchiveTTL     time.Duration `json:"archive_ttl"`
+
+	// 提示词预算：发送前估算提示词的token数，超过模型上下文减去 CompletionReserve 的任务直接失败
+	CompletionReserve int `json:"completion_reserve"`
+
+	// 批量处理：同类型排队任务凑满 BatchSize 或最早的任务等待超过 BatchWindow 后，
+	// 通过提供商的 ProcessBatch 一次下发。BatchSize<=1 时不启用
+	BatchSize      int                  `json:"batch_size"`
+	BatchWindow    time.Duration        `json:"batch_window"`
+	BatchTaskTypes []models.LLMTaskType `json:"batch_task_types"` // 为空时只批量处理 data_cleaning
+
+	// 调度策略：strict_priority（默认）、weighted_fair、fifo
+	SchedulingPolicy SchedulingPolicy           `json:"scheduling_policy"`
+	TypeWeights      map[models.LLMTaskType]int `json:"type_weights"` // weighted_fair 下各任务类型的权重，未配置的类型为1
 }
 
 // NewTaskScheduler 创建新的任务调度器
@@ -99,12 +151,31 @@ func NewTaskScheduler(providerMgr providers.ProviderManager, config SchedulerCon
 	if config.StatsInterval == 0 {
 		config.StatsInterval = 30 * time.Second
 	}
+	if config.ResultTTL == 0 {
+		config.ResultTTL = time.Hour
+	}
+	if config.ArchiveTTL == 0 {
+		config.ArchiveTTL = 24 * time.Hour
+	}
+	if config.CompletionReserve == 0 {
+		config.CompletionReserve = defaultCompletionReserve
+	}
 	if config.RetryAttempts == 0 {
 		config.RetryAttempts = 3
 	}
 	if config.RetryDelay == 0 {
 		config.RetryDelay = time.Second
 	}
+	if config.BatchSize > 1 {
+		if config.BatchWindow == 0 {
+			config.BatchWindow = 200 * time.Millisecond
+		}
+		if len(config.BatchTaskTypes) == 0 {
+			config.BatchTaskTypes = []models.LLMTaskType{models.TaskTypeDataCleaning}
+		}
+	}
+	
+	config.SchedulingPolicy = normalizeSchedulingPolicy(config.SchedulingPolicy)
 	
 	ctx, cancel := context.WithCancel(context.Background())
 	
@@ -120,6 +191,9 @@ func NewTaskScheduler(providerMgr providers.ProviderManager, config SchedulerCon
 		cancel:          cancel,
 		stats:           &SchedulerStats{},
 		callbackHandler: NewDefaultCallbackHandler(),
+		fairCredits:     make(map[models.LLMTaskType]int),
+		clock:           clock.Real(),
+		taskStore:       NewMemoryTaskStore(),
 	}
 	
 	// 初始化任务队列
@@ -128,6 +202,16 @@ func NewTaskScheduler(providerMgr providers.ProviderManager, config SchedulerCon
 	return scheduler
 }
 
+// SetClock 替换时间源，需在 Start 之前调用
+func (s *DefaultTaskScheduler) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetTaskStore 替换被清理任务的归档，需在 Start 之前调用
+func (s *DefaultTaskScheduler) SetTaskStore(store TaskStore) {
+	s.taskStore = store
+}
+
 // initializeQueues 初始化任务队列
 func (s *DefaultTaskScheduler) initializeQueues() {
 	s.queuesMutex.Lock()
@@ -146,6 +230,52 @@ func (s *DefaultTaskScheduler) initializeQueues() {
 	for _, taskType := range taskTypes {
 		s.taskQueues[taskType] = NewPriorityQueue(s.config.MaxQueueSize)
 	}
+	
+	// 提供商的并发许可在有队列的任务类型间分摊
+	s.concurrencyMgr.SetActiveTaskTypes(taskTypes)
+}
+
+// initializePermits 按已注册提供商声明的并发上限初始化并发许可
+func (s *DefaultTaskScheduler) initializePermits() {
+	for _, name := range s.providerManager.ListProviders() {
+		provider, err := s.providerManager.GetProvider(name)
+		if err != nil {
+			continue
+		}
+		limits := provider.GetLimits()
+		s.concurrencyMgr.SetProviderLimit(provider.Name(), limits.ConcurrentRequests)
+		if limits.ConcurrentRequests > 0 {
+			log.Printf("🔧 [并发控制] 提供商 %s 并发上限: %d", provider.Name(), limits.ConcurrentRequests)
+		}
+	}
+}
+
+// acquirePermit 等待获取提供商和任务类型的并发许可，直到获取成功或调度器停止
+// 调度器启动后才注册的提供商在首次使用时按其声明的并发上限初始化
+func (s *DefaultTaskScheduler) acquirePermit(provider providers.Provider, taskType models.LLMTaskType, n int) (*ConcurrencyToken, error) {
+	s.concurrencyMgr.SetProviderLimit(provider.Name(), provider.GetLimits().ConcurrentRequests)
+	
+	for {
+		token, err := s.concurrencyMgr.AcquireN(provider.Name(), taskType, n)
+		if err == nil {
+			return token, nil
+		}
+		select {
+		case <-s.clock.After(permitRetryInterval):
+		case <-s.ctx.Done():
+			return nil, fmt.Errorf("等待并发许可时任务被取消: %w", s.ctx.Err())
+		}
+	}
+}
+
+// reportOutcome 把请求结果反馈给并发控制，限流时减半并发上限，成功时逐步恢复
+func (s *DefaultTaskScheduler) reportOutcome(provider providers.Provider, err error) {
+	switch {
+	case err == nil:
+		s.concurrencyMgr.ReportSuccess(provider.Name())
+	case s.isRateLimitError(err):
+		s.concurrencyMgr.ReportRateLimit(provider.Name())
+	}
 }
 
 // RegisterListener 注册回调监听器到调度器
@@ -160,6 +290,9 @@ func (s *DefaultTaskScheduler) Start(ctx context.Context) error {
 	// 创建工作协程池
 	s.createWorkerPool()
 	
+	// 按提供商声明的并发上限初始化并发许可
+	s.initializePermits()
+	
 	// 启动回调处理器
 	if err := s.callbackHandler.Start(); err != nil {
 		return fmt.Errorf("启动回调处理器失败: %w", err)
@@ -200,7 +333,7 @@ func (s *DefaultTaskScheduler) Stop(ctx context.Context) error {
 	select {
 	case <-done:
 		return nil
-	case <-time.After(30 * time.Second):
+	case <-s.clock.After(30 * time.Second):
 		return fmt.Errorf("停止调度器超时")
 	}
 }
@@ -209,7 +342,7 @@ func (s *DefaultTaskScheduler) Stop(ctx context.Context) error {
 func (s *DefaultTaskScheduler) SubmitTask(ctx context.Context, task *models.LLMTask) error {
 	// 设置任务状态
 	task.Status = models.StatusQueued
-	task.UpdatedAt = time.Now()
+	task.UpdatedAt = s.clock.Now()
 	
 	// 存储任务
 	s.tasksMutex.Lock()
@@ -238,28 +371,44 @@ func (s *DefaultTaskScheduler) SubmitTask(ctx context.Context, task *models.LLMT
 	return nil
 }
 
-// GetTaskStatus 获取任务状态
+// GetTaskStatus 获取任务状态。任务已被清理时返回归档的任务，结果未归档时返回 ErrTaskExpired，
+// 从未存在时返回 ErrTaskNotFound
 func (s *DefaultTaskScheduler) GetTaskStatus(taskID string) (*models.LLMTask, error) {
 	s.tasksMutex.RLock()
-	defer s.tasksMutex.RUnlock()
-	
 	task, exists := s.tasks[taskID]
-	if !exists {
-		return nil, fmt.Errorf("任务不存在: %s", taskID)
+	var snapshot models.LLMTask
+	if exists {
+		// 返回副本，调用方序列化时不与持锁修改任务的操作竞争
+		snapshot = *task
+	}
+	s.tasksMutex.RUnlock()
+	if exists {
+		return &snapshot, nil
 	}
 	
-	return task, nil
+	archived, expiredAt, found := s.taskStore.Get(taskID)
+	switch {
+	case !found:
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	case archived == nil:
+		return nil, fmt.Errorf("%w: %s (清理于 %s)", ErrTaskExpired, taskID, expiredAt.Format(time.RFC3339))
+	default:
+		return archived, nil
+	}
 }
 
-// ListTasks 获取任务列表
-func (s *DefaultTaskScheduler) ListTasks(limit, offset int) ([]*models.LLMTask, int, error) {
+// ListTasks 获取满足过滤条件的任务列表，total 为过滤后的总数
+func (s *DefaultTaskScheduler) ListTasks(filter TaskFilter, limit, offset int) ([]*models.LLMTask, int, error) {
 	s.tasksMutex.RLock()
 	defer s.tasksMutex.RUnlock()
 	
-	// 获取所有任务
+	// 获取所有满足条件的任务
 	allTasks := make([]*models.LLMTask, 0, len(s.tasks))
 	for _, task := range s.tasks {
-		allTasks = append(allTasks, task)
+		if filter.matches(task) {
+			snapshot := *task
+			allTasks = append(allTasks, &snapshot)
+		}
 	}
 	
 	// 按创建时间排序（最新的在前面）
@@ -293,7 +442,7 @@ func (s *DefaultTaskScheduler) CancelTask(taskID string) error {
 	
 	task, exists := s.tasks[taskID]
 	if !exists {
-		return fmt.Errorf("任务不存在: %s", taskID)
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
 	}
 	
 	if task.IsTerminal() {
@@ -301,11 +450,46 @@ func (s *DefaultTaskScheduler) CancelTask(taskID string) error {
 	}
 	
 	task.Status = models.StatusCancelled
-	task.UpdatedAt = time.Now()
+	task.UpdatedAt = s.clock.Now()
+
+	// 发送取消回调
+	s.callbackHandler.OnTaskCancelled(task)
 	
 	return nil
 }
 
+// UpdateTaskPriority 调整排队中任务的优先级，已开始执行的任务不受影响
+func (s *DefaultTaskScheduler) UpdateTaskPriority(taskID string, priority models.Priority) error {
+	if !priority.IsValid() {
+		return fmt.Errorf("无效的优先级: %s", priority)
+	}
+
+	s.tasksMutex.RLock()
+	task, exists := s.tasks[taskID]
+	s.tasksMutex.RUnlock()
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+
+	s.queuesMutex.RLock()
+	queue, exists := s.taskQueues[task.Type]
+	s.queuesMutex.RUnlock()
+	if !exists {
+		return fmt.Errorf("不支持的任务类型: %s", task.Type)
+	}
+
+	// 任务结构体同时被查询接口读取，修改优先级时持有 tasksMutex；
+	// 查找和重新堆化在队列锁内完成，避免与工作协程取任务产生竞争
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	if !queue.UpdatePriority(taskID, priority) {
+		return fmt.Errorf("任务不在等待队列中，无法调整优先级: %s", taskID)
+	}
+	task.UpdatedAt = s.clock.Now()
+
+	return nil
+}
+
 // GetStats 获取调度器统计
 func (s *DefaultTaskScheduler) GetStats() *SchedulerStats {
 	s.statsMutex.RLock()
@@ -313,51 +497,151 @@ func (s *DefaultTaskScheduler) GetStats() *SchedulerStats {
 	
 	// 返回统计副本
 	stats := *s.stats
+	stats.Concurrency = s.concurrencyMgr.GetStatus()
 	return &stats
 }
 
+// Pause 暂停分发新任务，用于轮换密钥等维护操作；排队任务保留，运行中的任务继续完成，重复调用无副作用
+func (s *DefaultTaskScheduler) Pause() {
+	if !s.paused.CompareAndSwap(false, true) {
+		return
+	}
+	now := s.clock.Now()
+	s.updateStats(func(stats *SchedulerStats) {
+		stats.Paused = true
+		stats.PausedAt = &now
+	})
+	log.Printf("⏸️ 调度器已暂停，排队任务将在恢复后继续分发")
+}
+
+// Resume 恢复分发排队任务，重复调用无副作用
+func (s *DefaultTaskScheduler) Resume() {
+	if !s.paused.CompareAndSwap(true, false) {
+		return
+	}
+	s.updateStats(func(stats *SchedulerStats) {
+		stats.Paused = false
+		stats.PausedAt = nil
+	})
+	log.Printf("▶️ 调度器已恢复")
+}
+
 // scheduleNext 调度下一个任务
 func (s *DefaultTaskScheduler) scheduleNext() {
-	// 选择下一个任务
-	task := s.selectNextTask()
-	if task == nil {
+	// 暂停期间任务保持在队列中
+	if s.paused.Load() {
 		return
 	}
 	
-	// 获取可用的工作协程
+	s.reportQueueDemand()
+
+	// 先占用工作协程再出队，避免没有空闲协程时任务离开队列
+	var worker *Worker
 	select {
-	case worker := <-s.workerPool:
-		// 分配任务给工作协程
-		go s.assignTask(worker, task)
+	case worker = <-s.workerPool:
 	default:
 		// 没有可用的工作协程，任务保持在队列中
+		return
 	}
+
+	// 选择下一个任务
+	task := s.selectNextTask()
+	if task == nil {
+		s.workerPool <- worker
+		return
+	}
+
+	if s.isBatchType(task.Type) {
+		if tasks := s.fillBatch(task); len(tasks) > 1 {
+			go s.assignBatch(worker, tasks)
+			return
+		}
+	}
+
+	// 分配任务给工作协程
+	go s.assignTask(worker, task)
+}
+
+// reportQueueDemand 把各任务类型的排队数报告给并发管理器，任务类型许可按需求分摊
+func (s *DefaultTaskScheduler) reportQueueDemand() {
+	s.queuesMutex.RLock()
+	queued := make(map[models.LLMTaskType]int, len(s.taskQueues))
+	for taskType, queue := range s.taskQueues {
+		if n := queue.Len(); n > 0 {
+			queued[taskType] = n
+		}
+	}
+	s.queuesMutex.RUnlock()
+	s.concurrencyMgr.SetTaskTypeDemand(queued)
 }
 
-// selectNextTask 选择下一个任务
+// selectNextTask 按配置的调度策略选择下一个任务
+// 批量类型的队列未凑满一批且最早的任务还在等待窗口内时暂不出队，让给其他队列；
+// 提供商并发许可已满或被限流的任务同样留在队列中，工作协程留给能立即执行的任务
 func (s *DefaultTaskScheduler) selectNextTask() *models.LLMTask {
 	s.queuesMutex.RLock()
 	defer s.queuesMutex.RUnlock()
-	
-	var bestTask *models.LLMTask
-	var bestQueue *PriorityQueue
-	
-	// 简单策略：选择优先级最高的任务
-	for _, queue := range s.taskQueues {
-		task := queue.Peek()
-		if task != nil {
-			if bestTask == nil || task.Priority > bestTask.Priority {
-				bestTask = task
-				bestQueue = queue
-			}
+
+	candidates := make([]queueCandidate, 0, len(s.taskQueues))
+	deferred := 0
+	for taskType, queue := range s.taskQueues {
+		task := s.headOf(queue)
+		if task == nil {
+			continue
 		}
+		if s.isBatchType(taskType) && queue.Len() < s.config.BatchSize && s.clock.Now().Sub(task.CreatedAt) < s.config.BatchWindow {
+			continue
+		}
+		if !s.admits(task) {
+			deferred++
+			continue
+		}
+		candidates = append(candidates, queueCandidate{taskType: taskType, queue: queue, task: task})
 	}
-	
-	if bestTask != nil {
-		bestQueue.Pop()
+	if deferred > 0 {
+		s.updateStats(func(stats *SchedulerStats) {
+			stats.ThrottledDeferrals += int64(deferred)
+		})
 	}
-	
-	return bestTask
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// 按任务类型排序，使选择结果不依赖map的遍历顺序
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].taskType < candidates[j].taskType
+	})
+	return s.popFrom(s.pickCandidate(candidates).queue)
+}
+
+// fillBatch 从同类型队列中再取出任务，与 first 凑成一批（最多 BatchSize 个）
+func (s *DefaultTaskScheduler) fillBatch(first *models.LLMTask) []*models.LLMTask {
+	s.queuesMutex.RLock()
+	queue := s.taskQueues[first.Type]
+	s.queuesMutex.RUnlock()
+
+	tasks := []*models.LLMTask{first}
+	for len(tasks) < s.config.BatchSize {
+		task := s.popFrom(queue)
+		if task == nil {
+			break
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// isBatchType 判断任务类型是否走批量处理
+func (s *DefaultTaskScheduler) isBatchType(taskType models.LLMTaskType) bool {
+	if s.config.BatchSize <= 1 {
+		return false
+	}
+	for _, t := range s.config.BatchTaskTypes {
+		if t == taskType {
+			return true
+		}
+	}
+	return false
 }
 
 // assignTask 分配任务给工作协程
@@ -366,18 +650,24 @@ func (s *DefaultTaskScheduler) assignTask(worker *Worker, task *models.LLMTask)
 	worker.taskChan <- task
 }
 
+// assignBatch 分配一批任务给工作协程
+func (s *DefaultTaskScheduler) assignBatch(worker *Worker, tasks []*models.LLMTask) {
+	worker.currentTask = tasks[0]
+	worker.batchChan <- tasks
+}
+
 // schedulingLoop 调度循环
 func (s *DefaultTaskScheduler) schedulingLoop() {
 	defer s.wg.Done()
 	
-	ticker := time.NewTicker(100 * time.Millisecond)
+	ticker := s.clock.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
 	
 	for {
 		select {
 		case <-s.ctx.Done():
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			s.scheduleNext()
 		}
 	}
@@ -387,14 +677,14 @@ func (s *DefaultTaskScheduler) schedulingLoop() {
 func (s *DefaultTaskScheduler) cleanupLoop() {
 	defer s.wg.Done()
 	
-	ticker := time.NewTicker(s.config.CleanupInterval)
+	ticker := s.clock.NewTicker(s.config.CleanupInterval)
 	defer ticker.Stop()
 	
 	for {
 		select {
 		case <-s.ctx.Done():
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			s.cleanupCompletedTasks()
 		}
 	}
@@ -404,14 +694,14 @@ func (s *DefaultTaskScheduler) cleanupLoop() {
 func (s *DefaultTaskScheduler) statsLoop() {
 	defer s.wg.Done()
 	
-	ticker := time.NewTicker(s.config.StatsInterval)
+	ticker := s.clock.NewTicker(s.config.StatsInterval)
 	defer ticker.Stop()
 	
 	for {
 		select {
 		case <-s.ctx.Done():
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			s.updateStatsCounts()
 		}
 	}
@@ -422,14 +712,21 @@ func (s *DefaultTaskScheduler) cleanupCompletedTasks() {
 	s.tasksMutex.Lock()
 	defer s.tasksMutex.Unlock()
 	
-	// 清理超过一定时间的已完成任务
-	cutoff := time.Now().Add(-time.Hour) // 保留1小时内的任务
+	// 清理超过保留时长的已完成任务，删除前写入归档
+	now := s.clock.Now()
+	cutoff := now.Add(-s.config.ResultTTL)
 	
 	for taskID, task := range s.tasks {
 		if task.IsTerminal() && task.UpdatedAt.Before(cutoff) {
+			if err := s.taskStore.Archive(task, s.config.ArchiveResults, now); err != nil {
+				log.Printf("⚠️ 归档任务失败，保留到下次清理: %s, 错误: %v", taskID, err)
+				continue
+			}
 			delete(s.tasks, taskID)
 		}
 	}
+	
+	s.taskStore.Prune(now.Add(-s.config.ArchiveTTL))
 }
 
 // updateStatsCounts 更新统计计数
@@ -480,17 +777,20 @@ func (s *DefaultTaskScheduler) runWorker(worker *Worker) {
 			s.processTask(worker, task)
 			// 将工作协程放回池中
 			s.workerPool <- worker
+		case tasks := <-worker.batchChan:
+			s.processBatch(worker, tasks)
+			s.workerPool <- worker
 		}
 	}
 }
 
 // processTask 处理任务
 func (s *DefaultTaskScheduler) processTask(worker *Worker, task *models.LLMTask) {
-	startTime := time.Now()
+	startTime := s.clock.Now()
 	
 	// 更新任务状态
 	task.Status = models.StatusRunning
-	task.UpdatedAt = time.Now()
+	task.UpdatedAt = s.clock.Now()
 	task.StartedAt = &startTime
 	
 	// 发送开始回调
@@ -503,13 +803,109 @@ func (s *DefaultTaskScheduler) processTask(worker *Worker, task *models.LLMTask)
 		return
 	}
 	
+	if err := s.checkPromptSize(provider, task); err != nil {
+		s.failTask(task, err)
+		return
+	}
+	
 	// 执行任务（带重试）
+	result, retryCount, err := s.processWithRetry(provider, task)
+	if err != nil {
+		s.failTask(task, fmt.Errorf("任务执行失败（重试%d次后）: %w", retryCount, err))
+		return
+	}
+	
+	// 任务成功
+	s.completeTask(task, result)
+}
+
+// processBatch 通过提供商的 ProcessBatch 一次处理一批同类型任务，并把结果拆回各任务
+// 整批调用失败时逐个回退到单任务处理；单个任务因限流失败时单独重试
+func (s *DefaultTaskScheduler) processBatch(worker *Worker, tasks []*models.LLMTask) {
+	startTime := s.clock.Now()
+	for _, task := range tasks {
+		task.Status = models.StatusRunning
+		task.UpdatedAt = startTime
+		task.StartedAt = &startTime
+		s.callbackHandler.OnTaskStarted(task)
+	}
+
+	provider, err := s.providerManager.SelectProvider(s.ctx, tasks[0])
+	if err != nil {
+		for _, task := range tasks {
+			s.failTask(task, fmt.Errorf("选择提供商失败: %w", err))
+		}
+		return
+	}
+
+	// 提示词过大的任务单独失败，其余任务照常批量下发
+	fitting := tasks[:0]
+	for _, task := range tasks {
+		if err := s.checkPromptSize(provider, task); err != nil {
+			s.failTask(task, err)
+			continue
+		}
+		fitting = append(fitting, task)
+	}
+	if tasks = fitting; len(tasks) == 0 {
+		return
+	}
+
+	log.Printf("📦 [批量任务] 提交 %d 个 %s 任务到 %s", len(tasks), tasks[0].Type, provider.Name())
+	// 批量请求中每个任务各占一个许可
+	token, err := s.acquirePermit(provider, tasks[0].Type, len(tasks))
+	if err != nil {
+		for _, task := range tasks {
+			s.failTask(task, err)
+		}
+		return
+	}
+	results, err := provider.ProcessBatch(s.ctx, tasks)
+	token.Release()
+	s.reportOutcome(provider, err)
+	if err == nil && len(results) != len(tasks) {
+		err = fmt.Errorf("批量结果数量不匹配: 期望 %d, 实际 %d", len(tasks), len(results))
+	}
+	if err != nil {
+		log.Printf("⚠️ [批量任务] 批量处理失败，改为逐个处理: %v", err)
+		results = make([]*models.LLMResult, len(tasks))
+	}
+
+	for i, task := range tasks {
+		result := results[i]
+		if result != nil && result.Status != models.StatusFailed && result.Error == "" {
+			s.completeTask(task, result)
+			continue
+		}
+		if result != nil && !s.isRateLimitError(errors.New(result.Error)) {
+			s.failTask(task, fmt.Errorf("任务执行失败: %s", result.Error))
+			continue
+		}
+
+		result, retryCount, err := s.processWithRetry(provider, task)
+		if err != nil {
+			s.failTask(task, fmt.Errorf("任务执行失败（重试%d次后）: %w", retryCount, err))
+			continue
+		}
+		s.completeTask(task, result)
+	}
+}
+
+// processWithRetry 执行单个任务，限流错误按退避时间重试
+func (s *DefaultTaskScheduler) processWithRetry(provider providers.Provider, task *models.LLMTask) (*models.LLMResult, int, error) {
 	var result *models.LLMResult
+	var err error
 	retryCount := 0
 	maxRetries := 3
 	
 	for retryCount <= maxRetries {
+		token, permitErr := s.acquirePermit(provider, task.Type, 1)
+		if permitErr != nil {
+			return nil, retryCount, permitErr
+		}
 		result, err = provider.Process(s.ctx, task)
+		token.Release()
+		s.reportOutcome(provider, err)
 		if err == nil {
 			break // 成功
 		}
@@ -521,15 +917,14 @@ func (s *DefaultTaskScheduler) processTask(worker *Worker, task *models.LLMTask)
 				// 计算退避时间
 				backoff := time.Duration(retryCount) * 30 * time.Second
 				log.Printf("⚠️ [任务 %s] 遇到限流错误，%d秒后重试 (第%d/%d次)", 
-					task.ID, int(backoff.Seconds()), retryCount, maxRetries)
+					task.LogLabel(), int(backoff.Seconds()), retryCount, maxRetries)
 				
 				// 等待退避时间
 				select {
-				case <-time.After(backoff):
+				case <-s.clock.After(backoff):
 					continue
 				case <-s.ctx.Done():
-					s.failTask(task, fmt.Errorf("任务被取消: %w", s.ctx.Err()))
-					return
+					return nil, retryCount, fmt.Errorf("任务被取消: %w", s.ctx.Err())
 				}
 			}
 		}
@@ -538,18 +933,12 @@ func (s *DefaultTaskScheduler) processTask(worker *Worker, task *models.LLMTask)
 		break
 	}
 	
-	if err != nil {
-		s.failTask(task, fmt.Errorf("任务执行失败（重试%d次后）: %w", retryCount, err))
-		return
-	}
-	
-	// 任务成功
-	s.completeTask(task, result)
+	return result, retryCount, err
 }
 
 // completeTask 完成任务
 func (s *DefaultTaskScheduler) completeTask(task *models.LLMTask, result *models.LLMResult) {
-	now := time.Now()
+	now := s.clock.Now()
 	task.Status = models.StatusCompleted
 	task.UpdatedAt = now
 	task.CompletedAt = &now
@@ -557,6 +946,7 @@ func (s *DefaultTaskScheduler) completeTask(task *models.LLMTask, result *models
 	// 设置结果
 	task.SetResult(result.Data)
 	task.TokenUsage = result.TokenUsage
+	task.Truncated = result.Truncated
 	
 	// 发送完成回调
 	s.callbackHandler.OnTaskCompleted(task)
@@ -570,11 +960,12 @@ func (s *DefaultTaskScheduler) completeTask(task *models.LLMTask, result *models
 
 // failTask 任务失败
 func (s *DefaultTaskScheduler) failTask(task *models.LLMTask, err error) {
-	now := time.Now()
+	now := s.clock.Now()
 	task.Status = models.StatusFailed
 	task.Error = err.Error()
 	task.UpdatedAt = now
 	task.CompletedAt = &now
+	log.Printf("❌ [任务 %s] 执行失败: %v", task.LogLabel(), err)
 	
 	// 发送失败回调
 	s.callbackHandler.OnTaskFailed(task, err)
@@ -612,6 +1003,7 @@ type Worker struct {
 	scheduler   *DefaultTaskScheduler
 	currentTask *models.LLMTask
 	taskChan    chan *models.LLMTask
+	batchChan   chan []*models.LLMTask
 }
 
 // createWorkerPool 创建工作协程池
@@ -621,6 +1013,7 @@ func (s *DefaultTaskScheduler) createWorkerPool() {
 			ID:        i,
 			scheduler: s,
 			taskChan:  make(chan *models.LLMTask, 1), // 初始化任务通道
+			batchChan: make(chan []*models.LLMTask, 1),
 		}
 		s.workers = append(s.workers, worker)
 		s.workerPool <- worker
@@ -637,4 +1030,14 @@ type SchedulerStats struct {
 	AvgProcessTime float64   `json:"avg_process_time"`
 	Uptime         time.Duration `json:"uptime"`
 	LastUpdated    time.Time `json:"last_updated"`
+	
+	// 各提供商和任务类型当前的并发许可
+	Concurrency    *ConcurrencyStatus `json:"concurrency,omitempty"`
+	
+	// 因并发许可已满或被限流而留在队列中的累计调度次数
+	ThrottledDeferrals int64 `json:"throttled_deferrals"`
+	
+	// 是否暂停分发任务，以及暂停的时间
+	Paused         bool       `json:"paused"`
+	PausedAt       *time.Time `json:"paused_at,omitempty"`
 }
\ No newline at end of file
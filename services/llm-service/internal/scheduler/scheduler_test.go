@@ -0,0 +1,552 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/clock"
+	"github.com/freedkr/moonshot/internal/tokens"
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+	"github.com/freedkr/moonshot/services/llm-service/internal/providers"
+)
+
+// fakeProvider 记录单任务和批量调用，结果回显提示词
+type fakeProvider struct {
+	providers.Provider
+
+	limits providers.RateLimit
+	models []providers.Model
+
+	mu         sync.Mutex
+	processed  []string
+	batchSizes []int
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) GetLimits() providers.RateLimit { return p.limits }
+
+func (p *fakeProvider) GetModels() []providers.Model { return p.models }
+
+func (p *fakeProvider) Process(ctx context.Context, task *models.LLMTask) (*models.LLMResult, error) {
+	p.mu.Lock()
+	p.processed = append(p.processed, task.ID)
+	p.mu.Unlock()
+	return &models.LLMResult{TaskID: task.ID, Status: models.StatusCompleted, Data: task.Prompt}, nil
+}
+
+func (p *fakeProvider) ProcessBatch(ctx context.Context, tasks []*models.LLMTask) ([]*models.LLMResult, error) {
+	p.mu.Lock()
+	p.batchSizes = append(p.batchSizes, len(tasks))
+	p.mu.Unlock()
+	results := make([]*models.LLMResult, len(tasks))
+	for i, task := range tasks {
+		results[i] = &models.LLMResult{TaskID: task.ID, Status: models.StatusCompleted, Data: task.Prompt}
+	}
+	return results, nil
+}
+
+// fakeProviderManager 总是选择同一个提供商
+type fakeProviderManager struct {
+	providers.ProviderManager
+	provider providers.Provider
+}
+
+func (m *fakeProviderManager) ListProviders() []string {
+	return []string{m.provider.Name()}
+}
+
+func (m *fakeProviderManager) GetProvider(name string) (providers.Provider, error) {
+	return m.provider, nil
+}
+
+func (m *fakeProviderManager) SelectProvider(ctx context.Context, task *models.LLMTask) (providers.Provider, error) {
+	return m.provider, nil
+}
+
+// waitForCalls 等待提供商处理完指定数量的任务
+func (p *fakeProvider) waitForCalls(t *testing.T, tasks int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		p.mu.Lock()
+		done := len(p.processed)
+		for _, size := range p.batchSizes {
+			done += size
+		}
+		p.mu.Unlock()
+		if done >= tasks {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d tasks, processed %d", tasks, done)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDefaultTaskScheduler_BatchesDataCleaningTasks(t *testing.T) {
+	provider := &fakeProvider{}
+	s := NewTaskScheduler(&fakeProviderManager{provider: provider}, SchedulerConfig{
+		MaxWorkers:  2,
+		BatchSize:   3,
+		BatchWindow: time.Hour,
+	})
+
+	now := time.Now()
+	ids := []string{"c1", "c2", "c3"}
+	for i, id := range ids {
+		task := newQueuedTask(id, models.PriorityNormal, now.Add(time.Duration(i)*time.Millisecond))
+		task.Prompt = "prompt-" + id
+		if err := s.SubmitTask(context.Background(), task); err != nil {
+			t.Fatalf("SubmitTask failed: %v", err)
+		}
+	}
+	semantic := newQueuedTask("s1", models.PriorityNormal, now)
+	semantic.Type = models.TaskTypeSemanticAnalysis
+	if err := s.SubmitTask(context.Background(), semantic); err != nil {
+		t.Fatalf("SubmitTask failed: %v", err)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	provider.waitForCalls(t, 4)
+	// 停止后工作协程已退出，可以安全读取任务状态
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if len(provider.batchSizes) != 1 || provider.batchSizes[0] != 3 {
+		t.Errorf("Expected one batch of 3 tasks, got %v", provider.batchSizes)
+	}
+	if len(provider.processed) != 1 || provider.processed[0] != "s1" {
+		t.Errorf("Expected only the semantic task to be processed singly, got %v", provider.processed)
+	}
+	for _, id := range ids {
+		task, _ := s.GetTaskStatus(id)
+		var result string
+		if err := task.GetResult(&result); err != nil || task.Status != models.StatusCompleted || result != "prompt-"+id {
+			t.Errorf("Expected task '%s' completed with its own result, got status=%s result=%s", id, task.Status, task.Result)
+		}
+	}
+}
+
+func TestDefaultTaskScheduler_PermitsFromProviderLimits(t *testing.T) {
+	provider := &fakeProvider{limits: providers.RateLimit{ConcurrentRequests: 12}}
+	s := NewTaskScheduler(&fakeProviderManager{provider: provider}, SchedulerConfig{MaxWorkers: 2})
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	status := s.GetStats().Concurrency
+	if status == nil {
+		t.Fatal("Expected concurrency status in scheduler stats")
+	}
+	if got := status.Providers["fake"]; got.Limit != 12 || got.Ceiling != 12 {
+		t.Errorf("Expected provider permits 12/12, got %+v", got)
+	}
+	// 12个许可在6种任务类型间均分
+	if got := status.TaskTypes[models.TaskTypeDataCleaning]; got.Limit != 2 {
+		t.Errorf("Expected 2 permits per task type, got %+v", got)
+	}
+
+	task := newQueuedTask("p1", models.PriorityNormal, time.Now())
+	if err := s.SubmitTask(context.Background(), task); err != nil {
+		t.Fatalf("SubmitTask failed: %v", err)
+	}
+	provider.waitForCalls(t, 1)
+	deadline := time.Now().Add(3 * time.Second)
+	for s.GetStats().Concurrency.Providers["fake"].InUse != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected permit released after task finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDefaultTaskScheduler_SelectNextTask_WaitsForBatchWindow(t *testing.T) {
+	s := NewTaskScheduler(nil, SchedulerConfig{BatchSize: 3, BatchWindow: time.Minute})
+	now := time.Now()
+
+	if err := s.SubmitTask(context.Background(), newQueuedTask("fresh", models.PriorityNormal, now)); err != nil {
+		t.Fatalf("SubmitTask failed: %v", err)
+	}
+	if task := s.selectNextTask(); task != nil {
+		t.Fatalf("Expected partial batch to wait within the window, got %v", task.ID)
+	}
+
+	// 最早的任务超过等待窗口后，不足一批也会下发
+	if err := s.SubmitTask(context.Background(), newQueuedTask("stale", models.PriorityNormal, now.Add(-2*time.Minute))); err != nil {
+		t.Fatalf("SubmitTask failed: %v", err)
+	}
+	task := s.selectNextTask()
+	if task == nil || task.ID != "stale" {
+		t.Fatalf("Expected 'stale' to be selected, got %v", task)
+	}
+	if batch := s.fillBatch(task); len(batch) != 2 || batch[1].ID != "fresh" {
+		t.Errorf("Expected batch [stale fresh], got %v", batch)
+	}
+}
+
+func TestDefaultTaskScheduler_ListTasks_FiltersByParentTaskID(t *testing.T) {
+	s := NewTaskScheduler(nil, SchedulerConfig{})
+	now := time.Now()
+	for i, parent := range []string{"upload-1", "upload-2", "upload-1", ""} {
+		task := newQueuedTask(fmt.Sprintf("task-%d", i), models.PriorityNormal, now.Add(time.Duration(i)*time.Second))
+		if parent != "" {
+			task.Metadata = map[string]interface{}{models.MetadataParentTaskID: parent, models.MetadataStep: "llm_enhance"}
+		}
+		if err := s.SubmitTask(context.Background(), task); err != nil {
+			t.Fatalf("SubmitTask failed: %v", err)
+		}
+	}
+
+	tasks, total, err := s.ListTasks(TaskFilter{ParentTaskID: "upload-1"}, 10, 0)
+	if err != nil {
+		t.Fatalf("ListTasks failed: %v", err)
+	}
+	if total != 2 || len(tasks) != 2 || tasks[0].ID != "task-2" || tasks[1].ID != "task-0" {
+		t.Errorf("Expected [task-2 task-0] for upload-1, got total=%d %v", total, tasks)
+	}
+	if label := tasks[0].LogLabel(); label != "task-2 parent=upload-1 step=llm_enhance" {
+		t.Errorf("Unexpected log label: %s", label)
+	}
+
+	if _, total, _ := s.ListTasks(TaskFilter{}, 10, 0); total != 4 {
+		t.Errorf("Expected all 4 tasks without filter, got %d", total)
+	}
+}
+
+// drainOrder 依次选择任务直到队列为空，返回出队的任务ID
+func drainOrder(s *DefaultTaskScheduler) []string {
+	var order []string
+	for task := s.selectNextTask(); task != nil; task = s.selectNextTask() {
+		order = append(order, task.ID)
+	}
+	return order
+}
+
+// submitFlood 提交大量高优先级的语义分析任务和少量普通优先级的数据清洗任务
+func submitFlood(t *testing.T, s *DefaultTaskScheduler) {
+	t.Helper()
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		task := newQueuedTask(fmt.Sprintf("semantic-%d", i), models.PriorityHigh, now.Add(time.Duration(i)*time.Millisecond))
+		task.Type = models.TaskTypeSemanticAnalysis
+		if err := s.SubmitTask(context.Background(), task); err != nil {
+			t.Fatalf("SubmitTask failed: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		task := newQueuedTask(fmt.Sprintf("cleaning-%d", i), models.PriorityNormal, now.Add(-time.Minute))
+		if err := s.SubmitTask(context.Background(), task); err != nil {
+			t.Fatalf("SubmitTask failed: %v", err)
+		}
+	}
+}
+
+func TestDefaultTaskScheduler_WeightedFairPreventsStarvation(t *testing.T) {
+	// 严格优先级下，数据清洗任务要等全部语义分析任务出队后才被调度
+	strict := NewTaskScheduler(nil, SchedulerConfig{})
+	submitFlood(t, strict)
+	if order := drainOrder(strict); order[20] != "cleaning-0" {
+		t.Fatalf("Expected data_cleaning to be starved under strict priority, got order %v", order)
+	}
+
+	// 加权公平下，语义分析与数据清洗按 3:1 轮转
+	fair := NewTaskScheduler(nil, SchedulerConfig{
+		SchedulingPolicy: PolicyWeightedFair,
+		TypeWeights:      map[models.LLMTaskType]int{models.TaskTypeSemanticAnalysis: 3},
+	})
+	submitFlood(t, fair)
+	order := drainOrder(fair)
+	if len(order) != 22 {
+		t.Fatalf("Expected all 22 tasks to be selected, got %d", len(order))
+	}
+	var cleaningAt []int
+	for i, id := range order {
+		if id == "cleaning-0" || id == "cleaning-1" {
+			cleaningAt = append(cleaningAt, i)
+		}
+	}
+	if len(cleaningAt) != 2 || cleaningAt[0] > 3 || cleaningAt[1] > 7 {
+		t.Errorf("Expected data_cleaning within every 4 selections, got positions %v in %v", cleaningAt, order)
+	}
+	if order[0] != "semantic-0" || order[len(order)-1] != "semantic-19" {
+		t.Errorf("Expected semantic_analysis to keep its own order, got %v", order)
+	}
+}
+
+func TestDefaultTaskScheduler_FIFOPolicy(t *testing.T) {
+	s := NewTaskScheduler(nil, SchedulerConfig{SchedulingPolicy: PolicyFIFO})
+	now := time.Now()
+	tasks := []*models.LLMTask{
+		newQueuedTask("urgent-late", models.PriorityUrgent, now),
+		newQueuedTask("low-early", models.PriorityLow, now.Add(-2*time.Second)),
+		newQueuedTask("semantic-middle", models.PriorityHigh, now.Add(-time.Second)),
+	}
+	tasks[2].Type = models.TaskTypeSemanticAnalysis
+	for _, task := range tasks {
+		if err := s.SubmitTask(context.Background(), task); err != nil {
+			t.Fatalf("SubmitTask failed: %v", err)
+		}
+	}
+
+	order := drainOrder(s)
+	expected := []string{"low-early", "semantic-middle", "urgent-late"}
+	if fmt.Sprint(order) != fmt.Sprint(expected) {
+		t.Errorf("Expected FIFO order %v, got %v", expected, order)
+	}
+}
+
+func TestParseTypeWeights(t *testing.T) {
+	weights, err := ParseTypeWeights("semantic_analysis=3, data_cleaning=1")
+	if err != nil {
+		t.Fatalf("ParseTypeWeights failed: %v", err)
+	}
+	if weights[models.TaskTypeSemanticAnalysis] != 3 || weights[models.TaskTypeDataCleaning] != 1 {
+		t.Errorf("Unexpected weights: %v", weights)
+	}
+	for _, invalid := range []string{"semantic_analysis", "data_cleaning=0", "data_cleaning=x"} {
+		if _, err := ParseTypeWeights(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+// rateLimitedProvider 前 failures 次调用返回限流错误
+type rateLimitedProvider struct {
+	fakeProvider
+	failures int32
+	calls    int32
+}
+
+func (p *rateLimitedProvider) Process(ctx context.Context, task *models.LLMTask) (*models.LLMResult, error) {
+	if atomic.AddInt32(&p.calls, 1) <= p.failures {
+		return nil, &providers.ProviderError{Provider: "fake", Code: providers.ErrCodeRateLimit, Message: "429"}
+	}
+	return p.fakeProvider.Process(ctx, task)
+}
+
+func TestDefaultTaskScheduler_RateLimitBackoffUsesClock(t *testing.T) {
+	provider := &rateLimitedProvider{failures: 2}
+	s := NewTaskScheduler(&fakeProviderManager{provider: provider}, SchedulerConfig{MaxWorkers: 1})
+	fake := clock.NewFake(time.Now())
+	s.SetClock(fake)
+
+	type outcome struct {
+		retries int
+		err     error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		_, retries, err := s.processWithRetry(provider, newQueuedTask("t1", models.PriorityNormal, fake.Now()))
+		done <- outcome{retries, err}
+	}()
+
+	// 第一次限流后等待 30 秒，未到退避时间时不会重试
+	fake.BlockUntil(1)
+	fake.Advance(29 * time.Second)
+	if calls := atomic.LoadInt32(&provider.calls); calls != 1 {
+		t.Fatalf("Expected no retry before the backoff elapsed, got %d calls", calls)
+	}
+	fake.Advance(time.Second)
+
+	// 第二次限流后退避时间翻倍为 60 秒
+	fake.BlockUntil(1)
+	fake.Advance(60 * time.Second)
+
+	select {
+	case got := <-done:
+		if got.err != nil || got.retries != 2 {
+			t.Errorf("Expected success after 2 retries, got retries=%d err=%v", got.retries, got.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected processWithRetry to finish after advancing the clock")
+	}
+	if calls := atomic.LoadInt32(&provider.calls); calls != 3 {
+		t.Errorf("Expected 3 provider calls, got %d", calls)
+	}
+}
+
+func TestDefaultTaskScheduler_CleanupUsesClock(t *testing.T) {
+	s := NewTaskScheduler(nil, SchedulerConfig{})
+	fake := clock.NewFake(time.Now())
+	s.SetClock(fake)
+
+	task := newQueuedTask("done", models.PriorityNormal, fake.Now())
+	task.Status = models.StatusCompleted
+	task.UpdatedAt = fake.Now()
+	s.tasks[task.ID] = task
+
+	fake.Advance(59 * time.Minute)
+	s.cleanupCompletedTasks()
+	if _, ok := s.tasks[task.ID]; !ok {
+		t.Fatal("Expected completed task to be kept within an hour")
+	}
+	fake.Advance(2 * time.Minute)
+	s.cleanupCompletedTasks()
+	if _, ok := s.tasks[task.ID]; ok {
+		t.Error("Expected completed task older than an hour to be removed")
+	}
+}
+
+func TestDefaultTaskScheduler_CleanupArchivesExpiredTasks(t *testing.T) {
+	for _, archive := range []bool{false, true} {
+		s := NewTaskScheduler(nil, SchedulerConfig{ResultTTL: 10 * time.Minute, ArchiveResults: archive, ArchiveTTL: time.Hour})
+		fake := clock.NewFake(time.Now())
+		s.SetClock(fake)
+
+		task := newQueuedTask("done", models.PriorityNormal, fake.Now())
+		task.Status = models.StatusCompleted
+		task.UpdatedAt = fake.Now()
+		s.tasks[task.ID] = task
+
+		fake.Advance(11 * time.Minute)
+		s.cleanupCompletedTasks()
+		if _, ok := s.tasks[task.ID]; ok {
+			t.Fatalf("archive=%v: Expected task older than ResultTTL to be removed", archive)
+		}
+
+		got, err := s.GetTaskStatus(task.ID)
+		if archive {
+			if err != nil || got != task {
+				t.Errorf("Expected archived task, got %v, %v", got, err)
+			}
+		} else if !errors.Is(err, ErrTaskExpired) {
+			t.Errorf("Expected ErrTaskExpired, got %v", err)
+		}
+
+		fake.Advance(2 * time.Hour)
+		s.cleanupCompletedTasks()
+		if _, err := s.GetTaskStatus(task.ID); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("archive=%v: Expected ErrTaskNotFound after ArchiveTTL, got %v", archive, err)
+		}
+	}
+
+	s := NewTaskScheduler(nil, SchedulerConfig{})
+	if _, err := s.GetTaskStatus("missing"); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Expected ErrTaskNotFound for unknown task, got %v", err)
+	}
+}
+
+func TestDefaultTaskScheduler_RejectsPromptTooLarge(t *testing.T) {
+	provider := &fakeProvider{
+		limits: providers.RateLimit{ConcurrentRequests: 5},
+		models: []providers.Model{{ID: "small", MaxTokens: 100}, {ID: "large", MaxTokens: 1000}},
+	}
+	s := NewTaskScheduler(&fakeProviderManager{provider: provider}, SchedulerConfig{CompletionReserve: 50})
+
+	oversized := newQueuedTask("big", models.PriorityNormal, time.Now())
+	oversized.Model = "small"
+	oversized.Prompt = strings.Repeat("职", 60)
+	fits := newQueuedTask("fits", models.PriorityNormal, time.Now())
+	fits.Prompt = strings.Repeat("职", 60) // 未指定模型时按最大的模型检查
+	s.processBatch(nil, []*models.LLMTask{oversized, fits})
+
+	if oversized.Status != models.StatusFailed || !strings.Contains(oversized.Error, tokens.ErrPromptTooLarge.Error()) {
+		t.Errorf("Expected oversized prompt to fail with ErrPromptTooLarge, got status=%s error=%q", oversized.Status, oversized.Error)
+	}
+	if fits.Status != models.StatusCompleted {
+		t.Errorf("Expected fitting task to complete, got %s: %s", fits.Status, fits.Error)
+	}
+	if len(provider.batchSizes) != 1 || provider.batchSizes[0] != 1 {
+		t.Errorf("Expected only the fitting task to be sent, got %v", provider.batchSizes)
+	}
+
+	single := newQueuedTask("single", models.PriorityNormal, time.Now())
+	single.Model = "small"
+	single.SystemPrompt = strings.Repeat("职", 30)
+	single.Prompt = strings.Repeat("职", 30)
+	s.processTask(nil, single)
+	if single.Status != models.StatusFailed || len(provider.processed) != 0 {
+		t.Errorf("Expected system and user prompts to count toward the budget, got status=%s processed=%v", single.Status, provider.processed)
+	}
+}
+
+func TestDefaultTaskScheduler_PauseKeepsQueuedTasks(t *testing.T) {
+	provider := &fakeProvider{}
+	s := NewTaskScheduler(&fakeProviderManager{provider: provider}, SchedulerConfig{MaxWorkers: 1})
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	s.Pause()
+	s.Pause()
+	if err := s.SubmitTask(context.Background(), newQueuedTask("t1", models.PriorityNormal, time.Now())); err != nil {
+		t.Fatalf("SubmitTask failed: %v", err)
+	}
+
+	// 调度循环每 100ms 执行一次，暂停期间任务保持排队
+	time.Sleep(300 * time.Millisecond)
+	provider.mu.Lock()
+	processed := len(provider.processed)
+	provider.mu.Unlock()
+	if processed != 0 {
+		t.Fatalf("Expected no task dispatched while paused, got %d", processed)
+	}
+	if task, _ := s.GetTaskStatus("t1"); task.Status != models.StatusQueued {
+		t.Errorf("Expected task to stay queued while paused, got %s", task.Status)
+	}
+	if stats := s.GetStats(); !stats.Paused || stats.PausedAt == nil {
+		t.Errorf("Expected stats to report paused, got paused=%v paused_at=%v", stats.Paused, stats.PausedAt)
+	}
+
+	s.Resume()
+	provider.waitForCalls(t, 1)
+	if stats := s.GetStats(); stats.Paused || stats.PausedAt != nil {
+		t.Errorf("Expected stats to report resumed, got paused=%v paused_at=%v", stats.Paused, stats.PausedAt)
+	}
+}
+
+// throttledProvider 速率限制可切换的提供商
+type throttledProvider struct {
+	fakeProvider
+	accepting atomic.Bool
+}
+
+func (p *throttledProvider) CanAccept() bool { return p.accepting.Load() }
+
+func TestDefaultTaskScheduler_KeepsThrottledTasksQueued(t *testing.T) {
+	provider := &throttledProvider{fakeProvider: fakeProvider{limits: providers.RateLimit{ConcurrentRequests: 6}}}
+	s := NewTaskScheduler(&fakeProviderManager{provider: provider}, SchedulerConfig{MaxWorkers: 1})
+	s.initializePermits()
+
+	if err := s.SubmitTask(context.Background(), newQueuedTask("t1", models.PriorityHigh, time.Now())); err != nil {
+		t.Fatalf("SubmitTask failed: %v", err)
+	}
+
+	// 速率限制不允许发送时任务留在队列中，不分配工作协程
+	if task := s.selectNextTask(); task != nil {
+		t.Fatalf("Expected throttled task to stay queued, got %v", task.ID)
+	}
+	if stats := s.GetStats(); stats.ThrottledDeferrals == 0 || stats.QueuedTasks != 1 {
+		t.Errorf("Expected a throttled deferral with the task still queued, got %+v", stats)
+	}
+
+	// 并发许可已满时同样留在队列中
+	provider.accepting.Store(true)
+	token, err := s.concurrencyMgr.Acquire("fake", models.TaskTypeDataCleaning)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if task := s.selectNextTask(); task != nil {
+		t.Fatalf("Expected task to wait for a permit, got %v", task.ID)
+	}
+
+	token.Release()
+	if task := s.selectNextTask(); task == nil || task.ID != "t1" {
+		t.Fatalf("Expected t1 to be admitted once a permit is free, got %v", task)
+	}
+}
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+)
+
+// SchedulingPolicy 从各任务类型的队列中选择下一个任务的策略
+type SchedulingPolicy string
+
+const (
+	// PolicyStrictPriority 严格优先级（默认）：选择各队列头部中优先级最高的任务，
+	// 持续的高优先级负载会让低优先级的任务类型一直得不到调度
+	PolicyStrictPriority SchedulingPolicy = "strict_priority"
+
+	// PolicyWeightedFair 加权公平：在有任务的类型之间按 TypeWeights 加权轮转，类型内部仍按优先级出队
+	PolicyWeightedFair SchedulingPolicy = "weighted_fair"
+
+	// PolicyFIFO 先进先出：类型内部按创建时间出队，不同类型之间选择等待最久的任务，不考虑优先级
+	PolicyFIFO SchedulingPolicy = "fifo"
+)
+
+// defaultTypeWeight 加权公平策略下未配置权重的任务类型使用的权重
+const defaultTypeWeight = 1
+
+// queueCandidate 本轮可以出队的任务类型及其下一个任务
+type queueCandidate struct {
+	taskType models.LLMTaskType
+	queue    *PriorityQueue
+	task     *models.LLMTask
+}
+
+// normalizeSchedulingPolicy 未配置时使用严格优先级，未知策略记录警告后同样回退
+func normalizeSchedulingPolicy(policy SchedulingPolicy) SchedulingPolicy {
+	switch policy {
+	case PolicyStrictPriority, PolicyWeightedFair, PolicyFIFO:
+		return policy
+	case "":
+		return PolicyStrictPriority
+	default:
+		log.Printf("⚠️ 未知的调度策略 %q，使用 %s", policy, PolicyStrictPriority)
+		return PolicyStrictPriority
+	}
+}
+
+// ParseTypeWeights 解析 "semantic_analysis=3,data_cleaning=1" 格式的任务类型权重
+func ParseTypeWeights(value string) (map[models.LLMTaskType]int, error) {
+	weights := make(map[models.LLMTaskType]int)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("无效的任务类型权重 %q，格式应为 类型=权重", pair)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("任务类型 %s 的权重必须是正整数: %q", parts[0], parts[1])
+		}
+		weights[models.LLMTaskType(strings.TrimSpace(parts[0]))] = weight
+	}
+	return weights, nil
+}
+
+// headOf 按调度策略返回队列中下一个将要出队的任务
+func (s *DefaultTaskScheduler) headOf(queue *PriorityQueue) *models.LLMTask {
+	if s.config.SchedulingPolicy == PolicyFIFO {
+		return queue.PeekOldest()
+	}
+	return queue.Peek()
+}
+
+// popFrom 按调度策略从队列中取出下一个任务
+func (s *DefaultTaskScheduler) popFrom(queue *PriorityQueue) *models.LLMTask {
+	if s.config.SchedulingPolicy == PolicyFIFO {
+		return queue.PopOldest()
+	}
+	return queue.Pop()
+}
+
+// pickCandidate 按调度策略从候选中选出下一个任务，candidates 非空且已按任务类型排序
+func (s *DefaultTaskScheduler) pickCandidate(candidates []queueCandidate) *queueCandidate {
+	switch s.config.SchedulingPolicy {
+	case PolicyWeightedFair:
+		return s.pickWeightedFair(candidates)
+	case PolicyFIFO:
+		best := &candidates[0]
+		for i := range candidates[1:] {
+			if c := &candidates[i+1]; c.task.CreatedAt.Before(best.task.CreatedAt) {
+				best = c
+			}
+		}
+		return best
+	default:
+		// 优先级相同时选择等待更久的任务
+		best := &candidates[0]
+		for i := range candidates[1:] {
+			c := &candidates[i+1]
+			weight, bestWeight := c.task.Priority.Weight(), best.task.Priority.Weight()
+			if weight > bestWeight || (weight == bestWeight && c.task.CreatedAt.Before(best.task.CreatedAt)) {
+				best = c
+			}
+		}
+		return best
+	}
+}
+
+// pickWeightedFair 平滑加权轮询：每次选择时各候选类型的累计值加上自身权重，
+// 选出累计值最大的类型并减去本轮的总权重。没有任务的类型不参与本轮并清零累计值，
+// 避免空闲期间积累的额度在恢复后集中抢占
+func (s *DefaultTaskScheduler) pickWeightedFair(candidates []queueCandidate) *queueCandidate {
+	s.fairMutex.Lock()
+	defer s.fairMutex.Unlock()
+
+	active := make(map[models.LLMTaskType]bool, len(candidates))
+	total := 0
+	var best *queueCandidate
+	for i := range candidates {
+		c := &candidates[i]
+		active[c.taskType] = true
+		weight := s.typeWeight(c.taskType)
+		s.fairCredits[c.taskType] += weight
+		total += weight
+		if best == nil || s.fairCredits[c.taskType] > s.fairCredits[best.taskType] {
+			best = c
+		}
+	}
+	for taskType := range s.fairCredits {
+		if !active[taskType] {
+			delete(s.fairCredits, taskType)
+		}
+	}
+
+	s.fairCredits[best.taskType] -= total
+	return best
+}
+
+// typeWeight 返回任务类型在加权公平策略下的权重
+func (s *DefaultTaskScheduler) typeWeight(taskType models.LLMTaskType) int {
+	if weight := s.config.TypeWeights[taskType]; weight > 0 {
+		return weight
+	}
+	return defaultTypeWeight
+}
@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StatsBroadcaster 定时把调度器统计推送给所有WebSocket连接，用于运维实时面板
+// 每个连接有独立的发送协程和容量为1的缓冲，客户端接收过慢时丢弃本次推送，不阻塞推送循环
+type StatsBroadcaster struct {
+	snapshot func() interface{} // 生成推送内容
+	interval time.Duration
+
+	clients map[string]*statsClient
+	mutex   sync.RWMutex
+
+	dropped  int64
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// statsClient 单个连接的发送缓冲
+type statsClient struct {
+	conn    WebSocketConnection
+	updates chan interface{}
+	done    chan struct{}
+}
+
+// NewStatsBroadcaster 创建统计推送器，snapshot 在每次推送时调用
+func NewStatsBroadcaster(snapshot func() interface{}, interval time.Duration) *StatsBroadcaster {
+	return &StatsBroadcaster{
+		snapshot: snapshot,
+		interval: interval,
+		clients:  make(map[string]*statsClient),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start 启动推送循环，没有连接时跳过本次推送
+func (b *StatsBroadcaster) Start() {
+	go func() {
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.stopCh:
+				return
+			case <-ticker.C:
+				if b.ConnectionCount() > 0 {
+					b.Broadcast(b.snapshot())
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止推送循环并关闭所有连接
+func (b *StatsBroadcaster) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stopCh)
+	})
+
+	b.mutex.RLock()
+	connIDs := make([]string, 0, len(b.clients))
+	for connID := range b.clients {
+		connIDs = append(connIDs, connID)
+	}
+	b.mutex.RUnlock()
+	for _, connID := range connIDs {
+		b.RemoveConnection(connID)
+	}
+}
+
+// Broadcast 向所有连接推送一次统计，缓冲已满的连接丢弃本次推送
+func (b *StatsBroadcaster) Broadcast(message interface{}) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for _, client := range b.clients {
+		select {
+		case client.updates <- message:
+		default:
+			atomic.AddInt64(&b.dropped, 1)
+		}
+	}
+}
+
+// AddConnection 添加连接并立即推送一次当前统计
+func (b *StatsBroadcaster) AddConnection(connID string, conn WebSocketConnection) {
+	client := &statsClient{
+		conn:    conn,
+		updates: make(chan interface{}, 1),
+		done:    make(chan struct{}),
+	}
+	client.updates <- b.snapshot()
+
+	b.mutex.Lock()
+	b.clients[connID] = client
+	b.mutex.Unlock()
+
+	go b.writeLoop(connID, client)
+}
+
+// writeLoop 逐条发送缓冲中的统计，发送失败时移除连接
+func (b *StatsBroadcaster) writeLoop(connID string, client *statsClient) {
+	for {
+		select {
+		case <-client.done:
+			return
+		case message := <-client.updates:
+			if err := client.conn.WriteJSON(message); err != nil {
+				log.Printf("统计推送失败 [%s]: %v", connID, err)
+				b.RemoveConnection(connID)
+				return
+			}
+		}
+	}
+}
+
+// RemoveConnection 移除并关闭连接
+func (b *StatsBroadcaster) RemoveConnection(connID string) {
+	b.mutex.Lock()
+	client, exists := b.clients[connID]
+	delete(b.clients, connID)
+	b.mutex.Unlock()
+
+	if exists {
+		close(client.done)
+		client.conn.Close()
+	}
+}
+
+// ConnectionCount 当前连接数
+func (b *StatsBroadcaster) ConnectionCount() int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return len(b.clients)
+}
+
+// DroppedUpdates 因客户端接收过慢而丢弃的推送次数
+func (b *StatsBroadcaster) DroppedUpdates() int64 {
+	return atomic.LoadInt64(&b.dropped)
+}
@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStatsConn 记录收到的推送，release 关闭前 WriteJSON 一直阻塞
+type fakeStatsConn struct {
+	mu       sync.Mutex
+	received []interface{}
+	release  chan struct{}
+	closed   bool
+	fail     bool
+}
+
+func (c *fakeStatsConn) WriteJSON(v interface{}) error {
+	if c.release != nil {
+		<-c.release
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail {
+		return errors.New("connection reset")
+	}
+	c.received = append(c.received, v)
+	return nil
+}
+
+func (c *fakeStatsConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeStatsConn) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.received)
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStatsBroadcaster_DropsUpdatesForSlowClients(t *testing.T) {
+	seq := 0
+	b := NewStatsBroadcaster(func() interface{} { seq++; return seq }, time.Hour)
+	defer b.Stop()
+
+	fast := &fakeStatsConn{}
+	slow := &fakeStatsConn{release: make(chan struct{})}
+	b.AddConnection("fast", fast)
+	b.AddConnection("slow", slow)
+	waitUntil(t, func() bool { return fast.count() == 1 })
+
+	// 慢客户端阻塞在第一次发送上，后续推送只能缓冲一条，其余丢弃且不阻塞推送
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			b.Broadcast(i)
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Broadcast blocked on slow client")
+	}
+
+	waitUntil(t, func() bool { return fast.count() == 6 })
+	if dropped := b.DroppedUpdates(); dropped < 3 {
+		t.Errorf("Expected slow client updates to be dropped, got %d", dropped)
+	}
+
+	close(slow.release)
+	waitUntil(t, func() bool { return slow.count() == 2 })
+}
+
+func TestStatsBroadcaster_RemovesFailedConnections(t *testing.T) {
+	b := NewStatsBroadcaster(func() interface{} { return "stats" }, 10*time.Millisecond)
+	conn := &fakeStatsConn{fail: true}
+	b.AddConnection("broken", conn)
+	b.Start()
+	defer b.Stop()
+
+	waitUntil(t, func() bool { return b.ConnectionCount() == 0 })
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if !conn.closed {
+		t.Errorf("Expected failed connection to be closed")
+	}
+}
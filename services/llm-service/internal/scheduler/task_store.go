@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+)
+
+var (
+	// ErrTaskNotFound 任务从未提交过，或其过期记录也已清理
+	ErrTaskNotFound = errors.New("任务不存在")
+	// ErrTaskExpired 任务结束后超过保留时长已被清理，结果没有归档
+	ErrTaskExpired = errors.New("任务已过期清理")
+)
+
+// TaskStore 保存被清理的终态任务，任务超过保留时长从调度器移除后仍可查询
+type TaskStore interface {
+	// Archive 保存被清理的任务；withResult 为 false 时只记录任务曾经存在，不保存结果
+	Archive(task *models.LLMTask, withResult bool, expiredAt time.Time) error
+	// Get 查询被清理的任务，found 为 false 表示没有记录；task 为 nil 表示结果未归档
+	Get(taskID string) (task *models.LLMTask, expiredAt time.Time, found bool)
+	// Prune 删除 before 之前清理的记录
+	Prune(before time.Time)
+}
+
+// archivedTask 归档的任务，task 为 nil 时只保留过期标记
+type archivedTask struct {
+	task      *models.LLMTask
+	expiredAt time.Time
+}
+
+// MemoryTaskStore 内存中的任务归档，服务重启后丢失
+type MemoryTaskStore struct {
+	mu      sync.RWMutex
+	entries map[string]archivedTask
+}
+
+// NewMemoryTaskStore 创建内存任务归档
+func NewMemoryTaskStore() *MemoryTaskStore {
+	return &MemoryTaskStore{entries: make(map[string]archivedTask)}
+}
+
+// Archive 保存被清理的任务
+func (m *MemoryTaskStore) Archive(task *models.LLMTask, withResult bool, expiredAt time.Time) error {
+	entry := archivedTask{expiredAt: expiredAt}
+	if withResult {
+		entry.task = task
+	}
+	m.mu.Lock()
+	m.entries[task.ID] = entry
+	m.mu.Unlock()
+	return nil
+}
+
+// Get 查询被清理的任务
+func (m *MemoryTaskStore) Get(taskID string) (*models.LLMTask, time.Time, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entry, ok := m.entries[taskID]
+	return entry.task, entry.expiredAt, ok
+}
+
+// Prune 删除 before 之前清理的记录
+func (m *MemoryTaskStore) Prune(before time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for taskID, entry := range m.entries {
+		if entry.expiredAt.Before(before) {
+			delete(m.entries, taskID)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/services/llm-service/internal/scheduler"
+)
+
+// fakePauseScheduler 记录暂停状态
+type fakePauseScheduler struct {
+	scheduler.TaskScheduler
+	paused bool
+}
+
+func (f *fakePauseScheduler) Pause()  { f.paused = true }
+func (f *fakePauseScheduler) Resume() { f.paused = false }
+
+func (f *fakePauseScheduler) GetStats() *scheduler.SchedulerStats {
+	return &scheduler.SchedulerStats{Paused: f.paused, QueuedTasks: 2}
+}
+
+// TestHandlePauseResume 测试暂停和恢复端点切换调度器状态并返回当前状态
+func TestHandlePauseResume(t *testing.T) {
+	sched := &fakePauseScheduler{}
+	s := NewLLMServer(sched, nil, ServerConfig{})
+
+	for _, tc := range []struct {
+		path   string
+		paused bool
+	}{
+		{"/api/v1/admin/pause", true},
+		{"/api/v1/admin/pause", true},
+		{"/api/v1/admin/resume", false},
+	} {
+		w := httptest.NewRecorder()
+		s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tc.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: code=%d body=%s", tc.path, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Paused      bool `json:"paused"`
+			QueuedTasks int  `json:"queued_tasks"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		if sched.paused != tc.paused || resp.Paused != tc.paused || resp.QueuedTasks != 2 {
+			t.Errorf("%s: scheduler paused=%v resp=%+v, want paused=%v", tc.path, sched.paused, resp, tc.paused)
+		}
+	}
+}
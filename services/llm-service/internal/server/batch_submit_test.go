@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+	"github.com/freedkr/moonshot/services/llm-service/internal/scheduler"
+)
+
+// fakeSubmitScheduler 只实现 SubmitTask，提示词包含 "fail" 的任务提交失败
+type fakeSubmitScheduler struct {
+	scheduler.TaskScheduler
+}
+
+func (f *fakeSubmitScheduler) SubmitTask(ctx context.Context, task *models.LLMTask) error {
+	if strings.Contains(task.Prompt, "fail") {
+		return errors.New("队列已满")
+	}
+	task.Status = models.StatusQueued
+	return nil
+}
+
+func postBatch(t *testing.T, s *LLMServer, prompts ...string) (int, BatchSubmitResponse) {
+	t.Helper()
+	req := BatchSubmitRequest{}
+	for _, prompt := range prompts {
+		req.Tasks = append(req.Tasks, SubmitTaskRequest{Type: models.TaskTypeSemanticAnalysis, Prompt: prompt})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tasks/batch", bytes.NewReader(body)))
+
+	var resp BatchSubmitResponse
+	if w.Code != http.StatusRequestEntityTooLarge {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v, body: %s", err, w.Body.String())
+		}
+	}
+	return w.Code, resp
+}
+
+// TestHandleBatchSubmit_Status 测试批量提交的状态码反映整体结果，并限制批量大小
+func TestHandleBatchSubmit_Status(t *testing.T) {
+	s := NewLLMServer(&fakeSubmitScheduler{}, nil, ServerConfig{MaxBatchSize: 3})
+
+	code, resp := postBatch(t, s, "a", "b")
+	if code != http.StatusOK || resp.Submitted != 2 || resp.Failed != 0 {
+		t.Fatalf("全部成功: code=%d resp=%+v", code, resp)
+	}
+
+	code, resp = postBatch(t, s, "a", "fail", "c")
+	if code != http.StatusMultiStatus {
+		t.Fatalf("部分失败应返回 207, 实际 %d", code)
+	}
+	if resp.Total != 3 || resp.Submitted != 2 || resp.Failed != 1 || len(resp.Results) != 3 {
+		t.Fatalf("部分失败汇总错误: %+v", resp)
+	}
+	if resp.Results[1].Status != "failed" || resp.Results[1].Error == "" {
+		t.Fatalf("失败任务的结果错误: %+v", resp.Results[1])
+	}
+
+	code, resp = postBatch(t, s, "fail-1", "fail-2")
+	if code != http.StatusBadRequest || resp.Failed != 2 || len(resp.Results) != 2 {
+		t.Fatalf("全部失败: code=%d resp=%+v", code, resp)
+	}
+
+	prompts := make([]string, 4)
+	for i := range prompts {
+		prompts[i] = fmt.Sprintf("task-%d", i)
+	}
+	if code, _ := postBatch(t, s, prompts...); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("超过批量上限应返回 413, 实际 %d", code)
+	}
+}
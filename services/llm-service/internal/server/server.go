@@ -4,6 +4,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -13,11 +14,15 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 
+	"github.com/freedkr/moonshot/internal/httpx"
 	"github.com/freedkr/moonshot/services/llm-service/internal/models"
 	"github.com/freedkr/moonshot/services/llm-service/internal/providers"
 	"github.com/freedkr/moonshot/services/llm-service/internal/scheduler"
 )
 
+// defaultMaxBatchSize 批量提交默认的最大任务数
+const defaultMaxBatchSize = 100
+
 // LLMServer LLM服务HTTP服务器
 type LLMServer struct {
 	// 核心组件
@@ -34,21 +39,31 @@ type LLMServer struct {
 	// WebSocket连接管理
 	wsListener *scheduler.WebSocketCallbackListener
 
+	// 调度器统计推送
+	statsBroadcaster *scheduler.StatsBroadcaster
+
+	// 长轮询等待者管理
+	waitListener *scheduler.TaskWaiterListener
+
 	// 配置
 	config ServerConfig
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Port            int           `json:"port"`
-	ReadTimeout     time.Duration `json:"read_timeout"`
-	WriteTimeout    time.Duration `json:"write_timeout"`
-	IdleTimeout     time.Duration `json:"idle_timeout"`
-	MaxRequestSize  int64         `json:"max_request_size"`
-	EnableCORS      bool          `json:"enable_cors"`
-	EnableMetrics   bool          `json:"enable_metrics"`
-	EnableWebSocket bool          `json:"enable_websocket"`
-	AuthToken       string        `json:"auth_token,omitempty"`
+	Port            int                   `json:"port"`
+	ReadTimeout     time.Duration         `json:"read_timeout"`
+	WriteTimeout    time.Duration         `json:"write_timeout"`
+	IdleTimeout     time.Duration         `json:"idle_timeout"`
+	MaxRequestSize  int64                 `json:"max_request_size"`
+	EnableCORS      bool                  `json:"enable_cors"`
+	EnableMetrics   bool                  `json:"enable_metrics"`
+	EnableWebSocket bool                  `json:"enable_websocket"`
+	StatsInterval   time.Duration         `json:"stats_interval"` // /ws/stats 推送统计的间隔
+	MaxBatchSize    int                   `json:"max_batch_size"` // 批量提交单次允许的最大任务数
+	AuthToken       string                `json:"auth_token,omitempty"`
+	AccessLog       httpx.AccessLogConfig `json:"-"`        // 请求日志配置，零值时按 basic 级别记录
+	Defaults        TaskDefaults          `json:"defaults"` // 请求未指定提供商或模型时的默认值
 }
 
 // NewLLMServer 创建LLM服务器
@@ -73,11 +88,17 @@ func NewLLMServer(
 	if config.MaxRequestSize == 0 {
 		config.MaxRequestSize = 32 << 20 // 32MB
 	}
+	if config.StatsInterval == 0 {
+		config.StatsInterval = 5 * time.Second
+	}
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = defaultMaxBatchSize
+	}
 
 	// 创建Gin引擎
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.New()
-	engine.Use(gin.Logger(), gin.Recovery())
+	engine.Use(gin.Recovery(), httpx.AccessLog(config.AccessLog))
 
 	// WebSocket升级器
 	upgrader := websocket.Upgrader{
@@ -91,18 +112,24 @@ func NewLLMServer(
 	// WebSocket监听器
 	wsListener := scheduler.NewWebSocketCallbackListener()
 
+	// 长轮询监听器
+	waitListener := scheduler.NewTaskWaiterListener()
+
 	server := &LLMServer{
 		scheduler:       taskScheduler,
 		providerManager: providerManager,
 		engine:          engine,
 		upgrader:        upgrader,
 		wsListener:      wsListener,
+		waitListener:    waitListener,
 		config:          config,
 	}
+	server.statsBroadcaster = scheduler.NewStatsBroadcaster(server.statsSnapshot, config.StatsInterval)
 
-	// 注册WebSocket监听器到调度器
+	// 注册WebSocket及长轮询监听器到调度器
 	if defaultScheduler, ok := taskScheduler.(*scheduler.DefaultTaskScheduler); ok {
 		defaultScheduler.RegisterListener(wsListener)
+		defaultScheduler.RegisterListener(waitListener)
 	}
 
 	// 设置路由
@@ -122,6 +149,10 @@ func (s *LLMServer) Start(ctx context.Context) error {
 		MaxHeaderBytes: 1 << 20, // 1MB
 	}
 
+	if s.config.EnableWebSocket {
+		s.statsBroadcaster.Start()
+	}
+
 	// 启动HTTP服务器
 	go func() {
 		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -135,6 +166,7 @@ func (s *LLMServer) Start(ctx context.Context) error {
 
 // Stop 停止服务器
 func (s *LLMServer) Stop(ctx context.Context) error {
+	s.statsBroadcaster.Stop()
 	if s.server != nil {
 		return s.server.Shutdown(ctx)
 	}
@@ -159,6 +191,7 @@ func (s *LLMServer) setupRoutes() {
 	api.POST("/tasks", s.handleSubmitTask)
 	api.GET("/tasks/:id", s.handleGetTask)
 	api.DELETE("/tasks/:id", s.handleCancelTask)
+	api.PATCH("/tasks/:id", s.handleUpdateTask)
 	api.GET("/tasks", s.handleListTasks)
 
 	// 批量处理
@@ -179,9 +212,15 @@ func (s *LLMServer) setupRoutes() {
 	api.GET("/stats", s.handleGetStats)
 	api.GET("/metrics", s.handleGetMetrics)
 
+	// 维护操作
+	admin := api.Group("/admin")
+	admin.POST("/pause", s.handlePauseScheduler)
+	admin.POST("/resume", s.handleResumeScheduler)
+
 	// WebSocket端点
 	if s.config.EnableWebSocket {
 		s.engine.GET("/ws", s.handleWebSocket)
+		s.engine.GET("/ws/stats", s.handleStatsWebSocket)
 	}
 
 	// CORS支持
@@ -251,13 +290,20 @@ func (s *LLMServer) handleSubmitTask(c *gin.Context) {
 		Prompt:       req.Prompt,
 		SystemPrompt: req.SystemPrompt,
 		Priority:     req.Priority,
-		Config:       req.Config,
+		Config:       req.taskConfig(),
 		CallbackURL:  req.CallbackURL,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 		Metadata:     req.Metadata,
 	}
 
+	if err := s.applyTaskDefaults(task); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	// 设置数据
 	if req.Data != nil {
 		if err := task.SetData(req.Data); err != nil {
@@ -282,21 +328,74 @@ func (s *LLMServer) handleSubmitTask(c *gin.Context) {
 	})
 }
 
+// maxLongPollWait 长轮询最长等待时间
+const maxLongPollWait = 60 * time.Second
+
 // handleGetTask 获取任务处理器
+// 支持 ?wait=30s 长轮询：任务未结束时挂起直到进入终态或等待超时，两种情况都返回任务当前状态
 func (s *LLMServer) handleGetTask(c *gin.Context) {
 	taskID := c.Param("id")
 
+	var wait time.Duration
+	if waitParam := c.Query("wait"); waitParam != "" {
+		parsedWait, err := time.ParseDuration(waitParam)
+		if err != nil || parsedWait < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的等待时间: " + waitParam,
+			})
+			return
+		}
+		wait = s.clampLongPollWait(parsedWait)
+	}
+
+	// 先注册等待再查询状态，避免查询与终态事件之间的竞争导致错过唤醒
+	var done <-chan struct{}
+	if wait > 0 {
+		var unregister func()
+		done, unregister = s.waitListener.Wait(taskID)
+		defer unregister()
+	}
+
 	task, err := s.scheduler.GetTaskStatus(taskID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": err.Error(),
-		})
+		respondTaskLookupError(c, err)
 		return
 	}
 
+	if wait > 0 && !task.IsTerminal() {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-done:
+		case <-timer.C:
+		case <-c.Request.Context().Done():
+			return
+		}
+
+		if task, err = s.scheduler.GetTaskStatus(taskID); err != nil {
+			respondTaskLookupError(c, err)
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, task)
 }
 
+// respondTaskLookupError 返回任务查询失败的响应：已过期清理且结果未归档返回 410，其余返回 404
+func respondTaskLookupError(c *gin.Context, err error) {
+	if errors.Is(err, scheduler.ErrTaskExpired) {
+		c.JSON(http.StatusGone, gin.H{
+			"error":   err.Error(),
+			"expired": true,
+		})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": err.Error(),
+	})
+}
+
 // handleCancelTask 取消任务处理器
 func (s *LLMServer) handleCancelTask(c *gin.Context) {
 	taskID := c.Param("id")
@@ -314,6 +413,79 @@ func (s *LLMServer) handleCancelTask(c *gin.Context) {
 	})
 }
 
+// handlePauseScheduler 暂停分发新任务，排队任务保留，运行中的任务继续完成
+func (s *LLMServer) handlePauseScheduler(c *gin.Context) {
+	s.scheduler.Pause()
+	s.respondSchedulerState(c, "调度器已暂停")
+}
+
+// handleResumeScheduler 恢复分发排队任务
+func (s *LLMServer) handleResumeScheduler(c *gin.Context) {
+	s.scheduler.Resume()
+	s.respondSchedulerState(c, "调度器已恢复")
+}
+
+// respondSchedulerState 返回调度器的暂停状态和当前任务数
+func (s *LLMServer) respondSchedulerState(c *gin.Context, message string) {
+	stats := s.scheduler.GetStats()
+	c.JSON(http.StatusOK, gin.H{
+		"message":       message,
+		"paused":        stats.Paused,
+		"paused_at":     stats.PausedAt,
+		"queued_tasks":  stats.QueuedTasks,
+		"running_tasks": stats.RunningTasks,
+	})
+}
+
+// clampLongPollWait 限制长轮询等待时间，并保证在写超时之前返回响应
+func (s *LLMServer) clampLongPollWait(wait time.Duration) time.Duration {
+	if wait > maxLongPollWait {
+		wait = maxLongPollWait
+	}
+	if limit := s.config.WriteTimeout - time.Second; limit > 0 && wait > limit {
+		wait = limit
+	}
+	return wait
+}
+
+// handleUpdateTask 调整任务优先级处理器
+func (s *LLMServer) handleUpdateTask(c *gin.Context) {
+	taskID := c.Param("id")
+
+	var req UpdateTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的请求格式: " + err.Error(),
+		})
+		return
+	}
+
+	if !req.Priority.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的优先级: " + string(req.Priority),
+		})
+		return
+	}
+
+	if _, err := s.scheduler.GetTaskStatus(taskID); err != nil {
+		respondTaskLookupError(c, err)
+		return
+	}
+
+	if err := s.scheduler.UpdateTaskPriority(taskID, req.Priority); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "任务优先级已更新",
+		"task_id":  taskID,
+		"priority": req.Priority,
+	})
+}
+
 // handleListTasks 列出任务处理器
 func (s *LLMServer) handleListTasks(c *gin.Context) {
 	// 获取查询参数
@@ -332,8 +504,9 @@ func (s *LLMServer) handleListTasks(c *gin.Context) {
 		}
 	}
 	
-	// 获取任务列表
-	tasks, total, err := s.scheduler.ListTasks(limit, offset)
+	// 获取任务列表，parent_task_id 用于按发起调用的上游任务过滤
+	filter := scheduler.TaskFilter{ParentTaskID: c.Query("parent_task_id")}
+	tasks, total, err := s.scheduler.ListTasks(filter, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponseFromError(err))
 		return
@@ -360,8 +533,15 @@ func (s *LLMServer) handleBatchSubmit(c *gin.Context) {
 		})
 		return
 	}
+	if len(req.Tasks) > s.config.MaxBatchSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("批量任务数 %d 超过上限 %d", len(req.Tasks), s.config.MaxBatchSize),
+		})
+		return
+	}
 
 	responses := make([]SubmitTaskResponse, 0, len(req.Tasks))
+	failed := 0
 
 	// 提交每个任务
 	for _, taskReq := range req.Tasks {
@@ -374,7 +554,7 @@ func (s *LLMServer) handleBatchSubmit(c *gin.Context) {
 			Prompt:       taskReq.Prompt,
 			SystemPrompt: taskReq.SystemPrompt,
 			Priority:     taskReq.Priority,
-			Config:       taskReq.Config,
+			Config:       taskReq.taskConfig(),
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 			Metadata:     taskReq.Metadata,
@@ -384,7 +564,12 @@ func (s *LLMServer) handleBatchSubmit(c *gin.Context) {
 			task.SetData(taskReq.Data)
 		}
 
-		if err := s.scheduler.SubmitTask(c.Request.Context(), task); err != nil {
+		err := s.applyTaskDefaults(task)
+		if err == nil {
+			err = s.scheduler.SubmitTask(c.Request.Context(), task)
+		}
+		if err != nil {
+			failed++
 			responses = append(responses, SubmitTaskResponse{
 				TaskID: task.ID,
 				Status: "failed",
@@ -398,11 +583,26 @@ func (s *LLMServer) handleBatchSubmit(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, BatchSubmitResponse{
-		Results: responses,
+	c.JSON(batchSubmitStatus(len(req.Tasks), failed), BatchSubmitResponse{
+		Total:     len(req.Tasks),
+		Submitted: len(req.Tasks) - failed,
+		Failed:    failed,
+		Results:   responses,
 	})
 }
 
+// batchSubmitStatus 根据提交结果选择状态码：全部成功 200，部分失败 207，全部失败 400
+func batchSubmitStatus(total, failed int) int {
+	switch {
+	case failed == 0:
+		return http.StatusOK
+	case failed < total:
+		return http.StatusMultiStatus
+	default:
+		return http.StatusBadRequest
+	}
+}
+
 // handleSyncProcess 同步处理处理器
 func (s *LLMServer) handleSyncProcess(c *gin.Context) {
 	var req SubmitTaskRequest
@@ -423,7 +623,7 @@ func (s *LLMServer) handleSyncProcess(c *gin.Context) {
 		Prompt:       req.Prompt,
 		SystemPrompt: req.SystemPrompt,
 		Priority:     req.Priority,
-		Config:       req.Config,
+		Config:       req.taskConfig(),
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 		Metadata:     req.Metadata,
@@ -433,6 +633,13 @@ func (s *LLMServer) handleSyncProcess(c *gin.Context) {
 		task.SetData(req.Data)
 	}
 
+	if err := s.applyTaskDefaults(task); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	// 同步处理：提交任务并等待完成
 	if err := s.scheduler.SubmitTask(c.Request.Context(), task); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -572,6 +779,33 @@ func (s *LLMServer) handleWebSocket(c *gin.Context) {
 	}
 }
 
+// handleStatsWebSocket 每隔 StatsInterval 推送一次调度器统计，连接建立时立即推送当前统计
+func (s *LLMServer) handleStatsWebSocket(c *gin.Context) {
+	conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "WebSocket升级失败: " + err.Error(),
+		})
+		return
+	}
+
+	connID := uuid.New().String()
+	s.statsBroadcaster.AddConnection(connID, &WebSocketConn{conn: conn})
+	defer s.statsBroadcaster.RemoveConnection(connID)
+
+	// 客户端不发送数据，读取只用于检测断开
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+}
+
+// statsSnapshot 生成一次统计推送
+func (s *LLMServer) statsSnapshot() interface{} {
+	return WebSocketMessage{Type: "scheduler_stats", Data: s.scheduler.GetStats()}
+}
+
 // 中间件
 
 // authMiddleware 认证中间件
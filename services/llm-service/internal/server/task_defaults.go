@@ -0,0 +1,87 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+	"github.com/freedkr/moonshot/services/llm-service/internal/providers"
+)
+
+// errInvalidTaskTarget 请求指定的提供商或模型不可用，提交时返回 400
+var errInvalidTaskTarget = errors.New("无效的提供商或模型")
+
+// autoProvider 由路由规则选择提供商
+const autoProvider = "auto"
+
+// TaskDefaults 请求未指定提供商或模型时使用的默认值
+type TaskDefaults struct {
+	Provider string                        `json:"provider,omitempty"` // 为空时按路由规则选择
+	Models   map[models.LLMTaskType]string `json:"models,omitempty"`   // 按任务类型的默认模型，未配置时由提供商选择
+}
+
+// ParseTypeModels 解析按任务类型的默认模型，格式为 类型=模型，多个以逗号分隔
+func ParseTypeModels(value string) (map[models.LLMTaskType]string, error) {
+	typeModels := make(map[models.LLMTaskType]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("无效的任务类型默认模型 %q，格式应为 类型=模型", pair)
+		}
+		typeModels[models.LLMTaskType(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+	}
+	return typeModels, nil
+}
+
+// applyTaskDefaults 补全请求未指定的提供商和模型，并检查提供商已注册、模型受支持
+// 在入队前拒绝拼错的名称，避免任务排队后在分发时才失败
+func (s *LLMServer) applyTaskDefaults(task *models.LLMTask) error {
+	if task.Provider == "" {
+		task.Provider = s.config.Defaults.Provider
+	}
+	if task.Model == "" {
+		task.Model = s.config.Defaults.Models[task.Type]
+	}
+
+	if s.providerManager == nil {
+		return nil
+	}
+
+	if task.Provider != "" && task.Provider != autoProvider {
+		provider, err := s.providerManager.GetProvider(task.Provider)
+		if err != nil {
+			return fmt.Errorf("%w: 提供商 %s 未注册", errInvalidTaskTarget, task.Provider)
+		}
+		if task.Model != "" && !supportsModel(provider.GetModels(), task.Model) {
+			return fmt.Errorf("%w: 提供商 %s 不支持模型 %s", errInvalidTaskTarget, task.Provider, task.Model)
+		}
+		return nil
+	}
+
+	// 自动选择提供商时，模型至少要被一个已注册的提供商支持
+	if task.Model == "" {
+		return nil
+	}
+	for _, name := range s.providerManager.ListProviders() {
+		provider, err := s.providerManager.GetProvider(name)
+		if err == nil && supportsModel(provider.GetModels(), task.Model) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: 没有已注册的提供商支持模型 %s", errInvalidTaskTarget, task.Model)
+}
+
+// supportsModel 检查模型是否在提供商的模型列表中
+func supportsModel(providerModels []providers.Model, model string) bool {
+	for _, m := range providerModels {
+		if m.ID == model {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+	"github.com/freedkr/moonshot/services/llm-service/internal/providers"
+)
+
+// fakeModelProvider 只实现 GetModels
+type fakeModelProvider struct {
+	providers.Provider
+	models []providers.Model
+}
+
+func (p *fakeModelProvider) GetModels() []providers.Model { return p.models }
+
+// fakeProviderManager 只实现按名称查询已注册的提供商
+type fakeProviderManager struct {
+	providers.ProviderManager
+	providers map[string]providers.Provider
+}
+
+func (m *fakeProviderManager) GetProvider(name string) (providers.Provider, error) {
+	provider, ok := m.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("提供商 %s 不存在", name)
+	}
+	return provider, nil
+}
+
+func (m *fakeProviderManager) ListProviders() []string {
+	names := make([]string, 0, len(m.providers))
+	for name := range m.providers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// recordingScheduler 记录提交的任务
+type recordingScheduler struct {
+	fakeSubmitScheduler
+	submitted []*models.LLMTask
+}
+
+func (r *recordingScheduler) SubmitTask(ctx context.Context, task *models.LLMTask) error {
+	r.submitted = append(r.submitted, task)
+	return r.fakeSubmitScheduler.SubmitTask(ctx, task)
+}
+
+func postTask(t *testing.T, s *LLMServer, req SubmitTaskRequest) int {
+	t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tasks", bytes.NewReader(body)))
+	return w.Code
+}
+
+// TestHandleSubmitTask_DefaultsAndValidation 测试未指定时补全默认提供商和模型，无效的提供商或模型返回 400 且不入队
+func TestHandleSubmitTask_DefaultsAndValidation(t *testing.T) {
+	manager := &fakeProviderManager{providers: map[string]providers.Provider{
+		"kimi": &fakeModelProvider{models: []providers.Model{{ID: "moonshot-v1-8k"}, {ID: "moonshot-v1-32k"}}},
+	}}
+	sched := &recordingScheduler{}
+	s := NewLLMServer(sched, manager, ServerConfig{Defaults: TaskDefaults{
+		Provider: "kimi",
+		Models:   map[models.LLMTaskType]string{models.TaskTypeSemanticAnalysis: "moonshot-v1-32k"},
+	}})
+
+	if code := postTask(t, s, SubmitTaskRequest{Type: models.TaskTypeSemanticAnalysis, Prompt: "p"}); code != http.StatusCreated {
+		t.Fatalf("使用默认值提交应返回 201, 实际 %d", code)
+	}
+	if task := sched.submitted[0]; task.Provider != "kimi" || task.Model != "moonshot-v1-32k" {
+		t.Errorf("未补全默认提供商和模型: provider=%q model=%q", task.Provider, task.Model)
+	}
+
+	if code := postTask(t, s, SubmitTaskRequest{Type: models.TaskTypeDataCleaning, Prompt: "p"}); code != http.StatusCreated {
+		t.Fatalf("未配置默认模型的类型应返回 201, 实际 %d", code)
+	}
+	if task := sched.submitted[1]; task.Model != "" {
+		t.Errorf("未配置默认模型时应交给提供商选择, 实际 %q", task.Model)
+	}
+
+	invalid := []SubmitTaskRequest{
+		{Type: models.TaskTypeSemanticAnalysis, Prompt: "p", Provider: "kimmi"},
+		{Type: models.TaskTypeSemanticAnalysis, Prompt: "p", Model: "moonshot-v1-64k"},
+		{Type: models.TaskTypeSemanticAnalysis, Prompt: "p", Provider: "auto", Model: "gpt-4"},
+	}
+	for _, req := range invalid {
+		if code := postTask(t, s, req); code != http.StatusBadRequest {
+			t.Errorf("provider=%q model=%q 应返回 400, 实际 %d", req.Provider, req.Model, code)
+		}
+	}
+	if len(sched.submitted) != 2 {
+		t.Errorf("无效的任务不应入队, 实际提交 %d 个", len(sched.submitted))
+	}
+
+	if code := postTask(t, s, SubmitTaskRequest{Type: models.TaskTypeSemanticAnalysis, Prompt: "p", Provider: "auto", Model: "moonshot-v1-8k"}); code != http.StatusCreated {
+		t.Errorf("自动选择提供商且模型受支持时应返回 201, 实际 %d", code)
+	}
+}
+
+func TestParseTypeModels(t *testing.T) {
+	typeModels, err := ParseTypeModels("semantic_analysis=moonshot-v1-32k, data_cleaning = moonshot-v1-8k")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if typeModels[models.TaskTypeSemanticAnalysis] != "moonshot-v1-32k" || typeModels[models.TaskTypeDataCleaning] != "moonshot-v1-8k" {
+		t.Errorf("解析结果错误: %v", typeModels)
+	}
+
+	for _, value := range []string{"semantic_analysis", "semantic_analysis=", "=moonshot-v1-8k"} {
+		if _, err := ParseTypeModels(value); err == nil {
+			t.Errorf("%q 应解析失败", value)
+		}
+	}
+}
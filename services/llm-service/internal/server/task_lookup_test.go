@@ -0,0 +1,47 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freedkr/moonshot/services/llm-service/internal/models"
+	"github.com/freedkr/moonshot/services/llm-service/internal/scheduler"
+)
+
+// fakeLookupScheduler 按任务ID返回固定的查询结果
+type fakeLookupScheduler struct {
+	scheduler.TaskScheduler
+}
+
+func (f *fakeLookupScheduler) GetTaskStatus(taskID string) (*models.LLMTask, error) {
+	switch taskID {
+	case "archived":
+		return &models.LLMTask{ID: taskID, Status: models.StatusCompleted}, nil
+	case "expired":
+		return nil, fmt.Errorf("%w: %s", scheduler.ErrTaskExpired, taskID)
+	default:
+		return nil, fmt.Errorf("%w: %s", scheduler.ErrTaskNotFound, taskID)
+	}
+}
+
+// TestHandleGetTask_ExpiredAndMissing 测试已过期清理的任务返回 410，从未存在的任务返回 404
+func TestHandleGetTask_ExpiredAndMissing(t *testing.T) {
+	s := NewLLMServer(&fakeLookupScheduler{}, nil, ServerConfig{})
+
+	for _, tc := range []struct {
+		taskID string
+		code   int
+	}{
+		{"archived", http.StatusOK},
+		{"expired", http.StatusGone},
+		{"missing", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+tc.taskID, nil))
+		if w.Code != tc.code {
+			t.Errorf("%s: code=%d, want %d, body=%s", tc.taskID, w.Code, tc.code, w.Body.String())
+		}
+	}
+}
@@ -17,6 +17,9 @@ type SubmitTaskRequest struct {
 	Model       string             `json:"model,omitempty"`       // 指定模型
 	Temperature float64            `json:"temperature,omitempty"` // 温度参数
 
+	// 确定性模式，等同于 config.deterministic
+	Deterministic bool `json:"deterministic,omitempty"`
+
 	// 提示词
 	Prompt       string `json:"prompt" binding:"required"` // 用户提示词
 	SystemPrompt string `json:"system_prompt,omitempty"`   // 系统提示词
@@ -35,6 +38,15 @@ type SubmitTaskRequest struct {
 	Metadata map[string]interface{} `json:"metadata,omitempty"` // 元数据
 }
 
+// taskConfig 合并请求中的任务配置，顶层 deterministic 开关会写入配置
+func (r *SubmitTaskRequest) taskConfig() models.TaskConfig {
+	config := r.Config
+	if r.Deterministic {
+		config.Deterministic = true
+	}
+	return config
+}
+
 // SubmitTaskResponse 提交任务响应
 type SubmitTaskResponse struct {
 	TaskID string `json:"task_id"`
@@ -42,14 +54,22 @@ type SubmitTaskResponse struct {
 	Error  string `json:"error,omitempty"`
 }
 
+// UpdateTaskRequest 调整任务请求
+type UpdateTaskRequest struct {
+	Priority models.Priority `json:"priority" binding:"required"`
+}
+
 // BatchSubmitRequest 批量提交请求
 type BatchSubmitRequest struct {
-	Tasks []SubmitTaskRequest `json:"tasks" binding:"required,min=1,max=100"`
+	Tasks []SubmitTaskRequest `json:"tasks" binding:"required,min=1"` // 数量上限由 ServerConfig.MaxBatchSize 控制
 }
 
 // BatchSubmitResponse 批量提交响应
 type BatchSubmitResponse struct {
-	Results []SubmitTaskResponse `json:"results"`
+	Total     int                  `json:"total"`     // 请求中的任务数
+	Submitted int                  `json:"submitted"` // 提交成功的任务数
+	Failed    int                  `json:"failed"`    // 提交失败的任务数
+	Results   []SubmitTaskResponse `json:"results"`
 }
 
 // SyncProcessRequest 同步处理请求（复用SubmitTaskRequest）
@@ -10,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/freedkr/moonshot/internal/httpx"
 	"github.com/freedkr/moonshot/services/llm-service/internal/providers"
 	"github.com/freedkr/moonshot/services/llm-service/internal/scheduler"
 	"github.com/freedkr/moonshot/services/llm-service/internal/server"
@@ -76,8 +77,10 @@ func createProviderManager() providers.ProviderManager {
 			TokensPerMinute:    128000, // 实际配额: 128K TPM
 			ResetInterval:      time.Minute,
 		},
-		Timeout:    500 * time.Second,
-		MaxRetries: 2,
+		Timeout:              500 * time.Second,
+		MaxRetries:           2,
+		HourlyStatsRetention: getEnvDurationOrDefault("LLM_HOURLY_STATS_RETENTION", providers.DefaultHourlyStatsRetention),
+		DailyStatsRetention:  getEnvDurationOrDefault("LLM_DAILY_STATS_RETENTION", providers.DefaultDailyStatsRetention),
 	}
 
 	// 调试：打印API Key状态
@@ -127,13 +130,28 @@ func createProviderManager() providers.ProviderManager {
 // createTaskScheduler 创建任务调度器
 func createTaskScheduler(providerManager providers.ProviderManager) scheduler.TaskScheduler {
 	config := scheduler.SchedulerConfig{
-		MaxWorkers:      getEnvIntOrDefault("LLM_MAX_WORKERS", 50),      // 增加到50个worker以支持高并发
-		MaxQueueSize:    getEnvIntOrDefault("LLM_MAX_QUEUE_SIZE", 5000), // 增加队列容量
-		TaskTimeout:     getEnvDurationOrDefault("LLM_TASK_TIMEOUT", 5*time.Minute),
-		CleanupInterval: getEnvDurationOrDefault("LLM_CLEANUP_INTERVAL", time.Minute),
-		StatsInterval:   getEnvDurationOrDefault("LLM_STATS_INTERVAL", 30*time.Second),
-		RetryAttempts:   getEnvIntOrDefault("LLM_RETRY_ATTEMPTS", 3),
-		RetryDelay:      getEnvDurationOrDefault("LLM_RETRY_DELAY", time.Second),
+		MaxWorkers:        getEnvIntOrDefault("LLM_MAX_WORKERS", 50),      // 增加到50个worker以支持高并发
+		MaxQueueSize:      getEnvIntOrDefault("LLM_MAX_QUEUE_SIZE", 5000), // 增加队列容量
+		TaskTimeout:       getEnvDurationOrDefault("LLM_TASK_TIMEOUT", 5*time.Minute),
+		CleanupInterval:   getEnvDurationOrDefault("LLM_CLEANUP_INTERVAL", time.Minute),
+		StatsInterval:     getEnvDurationOrDefault("LLM_STATS_INTERVAL", 30*time.Second),
+		RetryAttempts:     getEnvIntOrDefault("LLM_RETRY_ATTEMPTS", 3),
+		RetryDelay:        getEnvDurationOrDefault("LLM_RETRY_DELAY", time.Second),
+		ResultTTL:         getEnvDurationOrDefault("LLM_RESULT_TTL", time.Hour),              // 终态任务在内存中的保留时长
+		ArchiveResults:    getEnvBoolOrDefault("LLM_ARCHIVE_RESULTS", false),                 // 清理前归档结果，关闭时只记录过期标记
+		ArchiveTTL:        getEnvDurationOrDefault("LLM_ARCHIVE_TTL", 24*time.Hour),          // 归档记录的保留时长
+		CompletionReserve: getEnvIntOrDefault("LLM_COMPLETION_RESERVE", 8000),                // 检查提示词大小时给输出预留的token数
+		BatchSize:         getEnvIntOrDefault("LLM_BATCH_SIZE", 5),                           // data_cleaning 任务合并下发，设为1关闭
+		BatchWindow:       getEnvDurationOrDefault("LLM_BATCH_WINDOW", 200*time.Millisecond), // 凑批的最长等待时间
+		SchedulingPolicy:  scheduler.SchedulingPolicy(getEnvOrDefault("LLM_SCHEDULING_POLICY", string(scheduler.PolicyStrictPriority))),
+	}
+	if value := os.Getenv("LLM_TYPE_WEIGHTS"); value != "" {
+		weights, err := scheduler.ParseTypeWeights(value)
+		if err != nil {
+			log.Printf("⚠️ 忽略无效的 LLM_TYPE_WEIGHTS: %v", err)
+		} else {
+			config.TypeWeights = weights
+		}
 	}
 
 	return scheduler.NewTaskScheduler(providerManager, config)
@@ -153,8 +171,26 @@ func createHTTPServer(
 		EnableCORS:      getEnvBoolOrDefault("LLM_ENABLE_CORS", true),
 		EnableMetrics:   getEnvBoolOrDefault("LLM_ENABLE_METRICS", true),
 		EnableWebSocket: getEnvBoolOrDefault("LLM_ENABLE_WEBSOCKET", true),
+		StatsInterval:   getEnvDurationOrDefault("LLM_WS_STATS_INTERVAL", 5*time.Second),
+		MaxBatchSize:    getEnvIntOrDefault("LLM_MAX_BATCH_SIZE", 100),
 		AuthToken:       getEnvOrDefault("LLM_AUTH_TOKEN", ""),
 	}
+	accessLog, err := httpx.AccessLogConfigFromEnv("LLM")
+	if err != nil {
+		log.Printf("⚠️ 请求日志配置无效，使用默认配置: %v", err)
+		accessLog = httpx.AccessLogConfig{}
+	}
+	config.AccessLog = accessLog
+
+	config.Defaults.Provider = getEnvOrDefault("LLM_DEFAULT_PROVIDER", "")
+	if value := os.Getenv("LLM_DEFAULT_MODELS"); value != "" {
+		typeModels, err := server.ParseTypeModels(value)
+		if err != nil {
+			log.Printf("⚠️ 忽略无效的 LLM_DEFAULT_MODELS: %v", err)
+		} else {
+			config.Defaults.Models = typeModels
+		}
+	}
 
 	return server.NewLLMServer(taskScheduler, providerManager, config)
 }
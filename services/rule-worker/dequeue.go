@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/queue"
+)
+
+// defaultPollInterval 出队失败或下游不可用时，下一次出队前的等待时间
+const defaultPollInterval = 2 * time.Second
+
+// defaultClaimTimeout 任务领取后仍处于 processing 的最长时间，超过后视为领取它的worker已退出
+const defaultClaimTimeout = 30 * time.Minute
+
+// staleClaimBatch 每轮重新入队的超时领取任务上限
+const staleClaimBatch = 100
+
+// dequeueTimeoutFromEnv 读取 RULE_WORKER_DEQUEUE_TIMEOUT，即单次阻塞出队的最长等待时间
+func dequeueTimeoutFromEnv() time.Duration {
+	return durationFromEnv("RULE_WORKER_DEQUEUE_TIMEOUT", queue.DefaultDequeueTimeout)
+}
+
+// pollIntervalFromEnv 读取 RULE_WORKER_POLL_INTERVAL，即出队失败后的重试间隔
+func pollIntervalFromEnv() time.Duration {
+	return durationFromEnv("RULE_WORKER_POLL_INTERVAL", defaultPollInterval)
+}
+
+// claimTimeoutFromEnv 读取 RULE_WORKER_CLAIM_TIMEOUT，应大于规则任务的最长处理时间
+func claimTimeoutFromEnv() time.Duration {
+	return durationFromEnv("RULE_WORKER_CLAIM_TIMEOUT", defaultClaimTimeout)
+}
+
+func durationFromEnv(key string, defaultValue time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("警告：%s 配置无效: %s，使用 %v", key, v, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// runDequeueLoop 循环调用 poll 直到 ctx 取消
+// poll 返回 true 表示完成了一次阻塞出队（取到任务或等待超时），立即开始下一次出队，新任务入队后无需等待轮询周期；
+// 返回 false 表示队列或下游不可用，等待 interval 后再试，避免故障期间空转
+func runDequeueLoop(ctx context.Context, interval time.Duration, poll func(context.Context) bool) {
+	for ctx.Err() == nil {
+		if poll(ctx) {
+			continue
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// requeueStaleClaims 将领取超时仍处于 processing 的规则任务重新入队，出队后由 ClaimTask 接管，返回入队的任务数
+func requeueStaleClaims(ctx context.Context, db database.DatabaseInterface, q queue.Client, timeout time.Duration) int {
+	tasks, err := db.ListStaleClaims(ctx, "rule", time.Now().Add(-timeout), staleClaimBatch)
+	if err != nil {
+		log.Printf("查询超时领取的任务失败: %v", err)
+		return 0
+	}
+
+	requeued := 0
+	for _, record := range tasks {
+		task := &queue.Task{
+			ID:        record.ID,
+			Type:      record.Type,
+			Status:    "pending",
+			CreatedAt: record.CreatedAt,
+			UpdatedAt: time.Now(),
+		}
+		if err := q.EnqueueTaskWithContext(ctx, task); err != nil {
+			log.Printf("超时领取的任务重新入队失败: %s, 错误: %v", record.ID, err)
+			continue
+		}
+		log.Printf("任务领取超时，已重新入队: %s (原worker: %s)", record.ID, record.ProcessedBy)
+		requeued++
+	}
+	return requeued
+}
+
+// runStaleClaimRecovery 每隔 timeout/2 检查一次超时领取的任务，直到 ctx 取消
+func runStaleClaimRecovery(ctx context.Context, db database.DatabaseInterface, q queue.Client, timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for {
+		requeueStaleClaims(ctx, db, q, timeout)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
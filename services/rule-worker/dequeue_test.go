@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunDequeueLoop_NoWaitAfterDequeue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 重试间隔远大于测试时长，只有完成出队后立即开始下一次出队才能在超时前达到次数
+	polls := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runDequeueLoop(ctx, time.Hour, func(context.Context) bool {
+			polls++
+			if polls == 100 {
+				cancel()
+			}
+			return true
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected loop to dequeue without waiting for the poll interval")
+	}
+	if polls != 100 {
+		t.Errorf("Expected 100 polls, got %d", polls)
+	}
+}
+
+func TestRunDequeueLoop_WaitsAfterFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls []time.Time
+	interval := 50 * time.Millisecond
+	runDequeueLoop(ctx, interval, func(context.Context) bool {
+		calls = append(calls, time.Now())
+		if len(calls) == 3 {
+			cancel()
+		}
+		return false
+	})
+
+	if len(calls) != 3 {
+		t.Fatalf("Expected 3 polls, got %d", len(calls))
+	}
+	for i := 1; i < len(calls); i++ {
+		if gap := calls[i].Sub(calls[i-1]); gap < interval {
+			t.Errorf("Expected at least %v between failed polls, got %v", interval, gap)
+		}
+	}
+}
+
+func TestDurationFromEnv(t *testing.T) {
+	t.Setenv("RULE_WORKER_DEQUEUE_TIMEOUT", "")
+	if d := dequeueTimeoutFromEnv(); d != 5*time.Second {
+		t.Errorf("Expected default 5s, got %v", d)
+	}
+	t.Setenv("RULE_WORKER_DEQUEUE_TIMEOUT", "30s")
+	if d := dequeueTimeoutFromEnv(); d != 30*time.Second {
+		t.Errorf("Expected 30s, got %v", d)
+	}
+	t.Setenv("RULE_WORKER_POLL_INTERVAL", "-1s")
+	if d := pollIntervalFromEnv(); d != defaultPollInterval {
+		t.Errorf("Expected default poll interval for invalid value, got %v", d)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// flowShutdownTimeout worker关闭时等待后台流程退出的最长时间
+const flowShutdownTimeout = 30 * time.Second
+
+// flowRegistry 记录后台运行的增量处理流程。
+// 流程运行在worker持有的ctx下，不随单次出队处理的ctx结束，但worker关闭时全部取消，不再继续消耗LLM调用
+type flowRegistry struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	flows map[string]context.CancelFunc
+	wg    sync.WaitGroup
+}
+
+func newFlowRegistry() *flowRegistry {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &flowRegistry{
+		ctx:    ctx,
+		cancel: cancel,
+		flows:  make(map[string]context.CancelFunc),
+	}
+}
+
+// start 在后台运行任务的流程，run 收到的ctx在worker关闭时取消；worker已关闭时不再启动
+func (r *flowRegistry) start(taskID string, run func(ctx context.Context)) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.flows[taskID] = cancel
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() {
+			r.mu.Lock()
+			delete(r.flows, taskID)
+			r.mu.Unlock()
+			cancel()
+		}()
+		run(ctx)
+	}()
+	return true
+}
+
+// running 返回正在运行的流程数
+func (r *flowRegistry) running() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.flows)
+}
+
+// shutdown 取消全部流程并等待其退出，超过 timeout 时不再等待
+func (r *flowRegistry) shutdown(timeout time.Duration) {
+	r.mu.Lock()
+	r.cancel()
+	count := len(r.flows)
+	r.mu.Unlock()
+	if count == 0 {
+		return
+	}
+
+	log.Printf("正在取消 %d 个运行中的增量处理流程...", count)
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Printf("增量处理流程已全部退出")
+	case <-time.After(timeout):
+		log.Printf("警告：等待增量处理流程退出超时，仍有 %d 个未退出", r.running())
+	}
+}
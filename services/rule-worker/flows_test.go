@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/notify"
+	"gorm.io/datatypes"
+)
+
+func TestFlowRegistry_ShutdownCancelsRunningFlows(t *testing.T) {
+	registry := newFlowRegistry()
+
+	started := make(chan struct{})
+	var flowErr error
+	if !registry.start("task-1", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		flowErr = ctx.Err()
+	}) {
+		t.Fatal("Expected flow to start")
+	}
+	<-started
+	if n := registry.running(); n != 1 {
+		t.Fatalf("Expected 1 running flow, got %d", n)
+	}
+
+	registry.shutdown(time.Second)
+	if flowErr != context.Canceled {
+		t.Errorf("Expected flow context cancelled, got %v", flowErr)
+	}
+	if n := registry.running(); n != 0 {
+		t.Errorf("Expected no running flows after shutdown, got %d", n)
+	}
+
+	// 关闭后不再启动新的流程
+	if registry.start("task-2", func(ctx context.Context) {}) {
+		t.Error("Expected start to be rejected after shutdown")
+	}
+}
+
+func TestFlowRegistry_FinishedFlowsAreRemoved(t *testing.T) {
+	registry := newFlowRegistry()
+	done := make(chan struct{})
+	registry.start("task-1", func(ctx context.Context) { close(done) })
+	<-done
+
+	deadline := time.Now().Add(time.Second)
+	for registry.running() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := registry.running(); n != 0 {
+		t.Errorf("Expected finished flow removed, got %d running", n)
+	}
+	// 流程结束后worker级别的ctx仍可用
+	if registry.ctx.Err() != nil {
+		t.Error("Expected registry context still active")
+	}
+}
+
+func TestFinishIncrementalFlow_SendsCallbackAfterFlow(t *testing.T) {
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(context.Background()); err != nil {
+		t.Fatalf("创建表失败: %v", err)
+	}
+
+	var statuses []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var payload notify.Payload
+		json.NewDecoder(r.Body).Decode(&payload)
+		statuses = append(statuses, payload.TaskID+":"+payload.Status)
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	for _, id := range []string{"flow-ok", "flow-failed"} {
+		started := time.Now()
+		task := &database.TaskRecord{ID: id, Type: "rule", Status: "completed", Config: datatypes.JSON(`{}`), CallbackURL: server.URL, FlowStartedAt: &started}
+		if err := db.CreateTask(context.Background(), task); err != nil {
+			t.Fatalf("创建任务失败: %v", err)
+		}
+	}
+
+	cfg := notify.DefaultConfig()
+	cfg.AllowedHosts = []string{"127.0.0.1"}
+	w := &RuleWorker{db: db, notifier: notify.NewTaskNotifier(db, cfg)}
+
+	w.finishIncrementalFlow(context.Background(), "flow-ok", nil)
+	w.finishIncrementalFlow(context.Background(), "flow-failed", errors.New("llm unavailable"))
+
+	want := []string{"flow-ok:completed", "flow-failed:completed"}
+	if len(statuses) != len(want) || statuses[0] != want[0] || statuses[1] != want[1] {
+		t.Errorf("Expected callbacks %v after the flow finished, got %v", want, statuses)
+	}
+	if active, err := db.CountActiveTasks(context.Background()); err != nil || active != 0 {
+		t.Errorf("Expected finished flows to leave the active count, got %d (err: %v)", active, err)
+	}
+}
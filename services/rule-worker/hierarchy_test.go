@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+)
+
+func TestSaveHierarchyToDB_PrefersCompleteDuplicateName(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	// 同一细类编码出现两次，先出现的名称被截断
+	small := &model.Category{Code: "6-01-01", Name: "粮油加工人员", Level: "小类"}
+	small.AddChild(&model.Category{Code: "6-01-01-01", Name: "碾米", Level: "细类"})
+	small.AddChild(&model.Category{Code: "6-01-01-01", Name: "碾米工", Level: "细类"})
+	roots := []*model.Category{small}
+
+	for _, tc := range []struct {
+		policy   model.DedupPolicy
+		taskID   string
+		expected string
+	}{
+		{model.DedupComplete, "1f3b5d7f-9a1c-4e3b-8d5f-7a9c1e3b5d7f", "碾米工"},
+		{model.DedupFirst, "2a4c6e8a-0b2d-4f4a-9c6e-8b0d2f4a6c8e", "碾米"},
+	} {
+		w := &RuleWorker{db: db, dedupPolicy: tc.policy}
+		if err := w.saveHierarchyToDB(ctx, tc.taskID, roots); err != nil {
+			t.Fatalf("%s: 保存层级结构失败: %v", tc.policy, err)
+		}
+		categories, err := db.GetCurrentCategoriesByTaskID(ctx, tc.taskID)
+		if err != nil {
+			t.Fatalf("%s: 查询分类失败: %v", tc.policy, err)
+		}
+		if len(categories) != 2 {
+			t.Fatalf("%s: expected 2 categories, got %d", tc.policy, len(categories))
+		}
+		for _, cat := range categories {
+			if cat.Code == "6-01-01-01" && cat.Name != tc.expected {
+				t.Errorf("%s: expected name %s, got %s", tc.policy, tc.expected, cat.Name)
+			}
+		}
+	}
+}
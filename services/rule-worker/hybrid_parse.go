@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/freedkr/moonshot/internal/parser"
+	"gorm.io/datatypes"
+)
+
+// saveHybridParseResult 保存混合解析器生成的AI任务和解析统计。
+// hybrid 模式下传入已有的解析结果；classic 模式下 result 为空，按任务的 maxRows 额外用混合解析器解析一次输入文件
+func (w *RuleWorker) saveHybridParseResult(ctx context.Context, taskID, filePath string, maxRows int, result *model.HybridParseResult) {
+	if result == nil {
+		if w.hybridParser == nil {
+			return
+		}
+		var err error
+		result, err = w.taskHybridParser(maxRows).ParseFile(ctx, filePath)
+		if err != nil {
+			log.Printf("警告：混合解析失败，未保存AI任务: %v", err)
+			return
+		}
+	}
+	record, err := encodeHybridParseResult(taskID, result)
+	if err != nil {
+		log.Printf("警告：序列化混合解析结果失败: %v", err)
+		return
+	}
+	if err := w.db.SaveHybridParseResult(ctx, record); err != nil {
+		log.Printf("警告：保存混合解析结果失败: %v", err)
+		return
+	}
+	log.Printf("已保存 %d 个AI任务", record.AITaskCount)
+}
+
+// taskHybridParser 返回按任务 max_rows 限制行数的混合解析器
+func (w *RuleWorker) taskHybridParser(maxRows int) *parser.HybridParser {
+	if maxRows == w.hybridParser.MaxRows() {
+		return w.hybridParser
+	}
+	return w.hybridParser.WithMaxRows(maxRows)
+}
+
+// encodeHybridParseResult 将混合解析结果转换为数据库记录，没有AI任务时保存空数组
+func encodeHybridParseResult(taskID string, result *model.HybridParseResult) (*database.HybridParseResult, error) {
+	aiTasks := result.AITasks
+	if aiTasks == nil {
+		aiTasks = []*model.AITask{}
+	}
+	tasksJSON, err := json.Marshal(aiTasks)
+	if err != nil {
+		return nil, err
+	}
+	statsJSON, err := json.Marshal(result.Stats)
+	if err != nil {
+		return nil, err
+	}
+	return &database.HybridParseResult{
+		TaskID:      taskID,
+		AITaskCount: len(aiTasks),
+		AITasks:     datatypes.JSON(tasksJSON),
+		Stats:       datatypes.JSON(statsJSON),
+	}, nil
+}
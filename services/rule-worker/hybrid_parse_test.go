@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/database"
+	"github.com/freedkr/moonshot/internal/model"
+	"github.com/freedkr/moonshot/internal/parser"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestSaveHybridParseResult_PersistsAITasks(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.NewSQLiteDB(&database.SQLiteConfig{})
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetName("Sheet1", "Table1")
+	f.SetSheetRow("Table1", "A1", &[]interface{}{"大类", "中类", "小类", "细类"})
+	f.SetSheetRow("Table1", "A2", &[]interface{}{"1 (GBM 10000) 国家机关负责人"})
+	f.SetSheetRow("Table1", "A3", &[]interface{}{"", "1-01 (GBM 10100) 中国共产党机关负责人"})
+	f.SetSheetRow("Table1", "A4", &[]interface{}{"", "", "1-01-01 (GBM 10101) 委员会负责人", "", "1-01-01-01", "委员会主任"})
+	path := t.TempDir() + "/hybrid.xlsx"
+	if err := f.SaveAs(path); err != nil {
+		t.Fatalf("保存工作簿失败: %v", err)
+	}
+
+	taskID := "7f9b1d3f-5a7c-4d9e-8f1b-3d5f7b9d1e3a"
+	w := &RuleWorker{db: db, hybridParser: parser.NewHybridParser(nil)}
+	w.saveHybridParseResult(ctx, taskID, path, 0, nil)
+
+	record, err := db.GetHybridParseResult(ctx, taskID)
+	if err != nil {
+		t.Fatalf("查询混合解析结果失败: %v", err)
+	}
+	var aiTasks []*model.AITask
+	if err := json.Unmarshal(record.AITasks, &aiTasks); err != nil {
+		t.Fatalf("解析AI任务失败: %v", err)
+	}
+	var stats model.HybridParseStats
+	if err := json.Unmarshal(record.Stats, &stats); err != nil {
+		t.Fatalf("解析统计失败: %v", err)
+	}
+	if record.AITaskCount != 1 || len(aiTasks) != 1 || aiTasks[0].ParentCode != "1-01-01" {
+		t.Fatalf("Expected one AI task for 1-01-01, got %s", record.AITasks)
+	}
+	if stats.AITaskCount != 1 || stats.TotalRows != 4 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// 额外解析同样受任务 max_rows 限制
+	limitedTaskID := "8a0c2e4a-6b8d-4e0f-9a2c-4e6a8c0e2f4b"
+	w.saveHybridParseResult(ctx, limitedTaskID, path, 3, nil)
+	limited, err := db.GetHybridParseResult(ctx, limitedTaskID)
+	if err != nil {
+		t.Fatalf("查询混合解析结果失败: %v", err)
+	}
+	if err := json.Unmarshal(limited.Stats, &stats); err != nil {
+		t.Fatalf("解析统计失败: %v", err)
+	}
+	if stats.TotalRows != 3 || limited.AITaskCount != 0 {
+		t.Errorf("Expected only the first 3 rows to be parsed, got %+v", stats)
+	}
+}
+
+func TestEncodeHybridParseResult_EmptyTasks(t *testing.T) {
+	record, err := encodeHybridParseResult("t", &model.HybridParseResult{Stats: &model.HybridParseStats{TotalRows: 2}})
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	if string(record.AITasks) != "[]" || record.AITaskCount != 0 {
+		t.Errorf("Expected empty AI task array, got %s", record.AITasks)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -15,6 +16,7 @@ import (
 	"github.com/freedkr/moonshot/internal/database"
 	"github.com/freedkr/moonshot/internal/integration"
 	"github.com/freedkr/moonshot/internal/model"
+	"github.com/freedkr/moonshot/internal/notify"
 	"github.com/freedkr/moonshot/internal/parser"
 	"github.com/freedkr/moonshot/internal/queue"
 	"github.com/freedkr/moonshot/internal/storage"
@@ -29,9 +31,23 @@ type RuleWorker struct {
 	queue                queue.Client
 	storage              storage.StorageInterface
 	parser               *parser.ExcelParserImpl
+	hybridParser         *parser.HybridParser // 为空时不生成AI任务，classic 模式下需设置 RULE_WORKER_HYBRID_PARSE=true 开启
+	parseMode            parser.ParseMode     // classic 使用 parser+builder 解析全部层级，hybrid 使用 hybridParser
 	builder              *builder.HierarchyBuilderImpl
 	pdfProcessor         *integration.PDFLLMProcessor
 	incrementalProcessor *integration.IncrementalProcessor
+	healthGate           *integration.HealthGate // 处理任务前检查任务依赖的PDF/LLM服务是否可用
+	notifier             *notify.TaskNotifier    // 任务结束时向回调地址发送通知
+	workerID             string                  // 写入任务记录的worker标识，用于定位处理任务的实例
+	memorySampling       bool                    // 是否采样任务内存峰值
+	ruleOnlyFallback     bool                    // LLM不可用时以规则解析结果完成任务，开启后健康门控不检查LLM服务
+	autoSkipPDF          bool                    // 全局开关：未设置 skip_pdf 的任务默认跳过PDF验证和融合（导入的带PDF任务包除外）
+	flows                *flowRegistry           // 后台运行的增量处理流程，关闭时取消
+	dedupPolicy          model.DedupPolicy       // 保存层级结构时重复编码的取舍策略
+	categoryFlushSize    int                     // 分类分批写入的刷写大小，0 表示使用默认值
+	dequeueTimeout       time.Duration           // 单次阻塞出队的最长等待时间
+	pollInterval         time.Duration           // 出队失败或下游不可用时的重试间隔
+	claimTimeout         time.Duration           // 领取后超过该时长仍未完成的任务可被其他worker接管
 }
 
 func main() {
@@ -61,8 +77,15 @@ func main() {
 	}
 }
 
-func NewRuleWorker(cfg *config.Config) (*RuleWorker, error) {
-	// 初始化数据库
+// openDatabase 按 DB_DRIVER 创建数据库连接，sqlite 用于本地开发，需与api-server使用同一个 SQLITE_PATH
+func openDatabase(cfg *config.Config) (database.DatabaseInterface, error) {
+	if os.Getenv("DB_DRIVER") == "sqlite" {
+		return database.NewSQLiteDB(&database.SQLiteConfig{
+			Path:      os.Getenv("SQLITE_PATH"),
+			BatchSize: cfg.Database.BatchSize,
+		})
+	}
+
 	dbConfig := &database.PostgreSQLConfig{
 		Host:      cfg.Database.Host,
 		Port:      cfg.Database.Port,
@@ -71,12 +94,28 @@ func NewRuleWorker(cfg *config.Config) (*RuleWorker, error) {
 		Password:  cfg.Database.Password,
 		SSLMode:   cfg.Database.SSLMode,
 		BatchSize: cfg.Database.BatchSize,
+
+		SlowQueryThreshold: database.SlowQueryThresholdFromEnv(),
 	}
-	db, err := database.NewPostgreSQLDB(dbConfig)
+	return database.NewPostgreSQLDB(dbConfig)
+}
+
+func NewRuleWorker(cfg *config.Config) (*RuleWorker, error) {
+	// 初始化数据库
+	db, err := openDatabase(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("初始化数据库失败: %w", err)
 	}
 
+	// worker 不执行迁移，表结构落后于模型时直接退出，避免在处理任务时才出现难以定位的SQL错误
+	schemaCheck, err := db.CheckSchema(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("检查表结构失败: %w", err)
+	}
+	if err := schemaCheck.Err(); err != nil {
+		return nil, fmt.Errorf("%w，请先启动 api-server 完成迁移", err)
+	}
+
 	// 初始化队列
 	redisQueue, err := queue.NewRedisQueue(cfg.Queue)
 	if err != nil {
@@ -90,33 +129,77 @@ func NewRuleWorker(cfg *config.Config) (*RuleWorker, error) {
 		SecretAccessKey: cfg.Storage.SecretAccessKey,
 		UseSSL:          cfg.Storage.UseSSL,
 		BucketName:      cfg.Storage.BucketName,
+
+		Versioning:        cfg.Storage.Versioning,
+		UploadsPrefix:     cfg.Storage.UploadsPrefix,
+		UploadsExpireDays: cfg.Storage.UploadsExpireDays,
 	}
 	minioStorage, err := storage.NewMinIOStorage(storageConfig)
 	if err != nil {
 		return nil, fmt.Errorf("初始化存储失败: %w", err)
 	}
 
-	// 初始化解析器
+	// 初始化解析器，词典格式未注册时启动失败
+	schema, err := parser.LookupSchema(parser.SchemaFromEnv())
+	if err != nil {
+		return nil, fmt.Errorf("词典格式配置错误: %w", err)
+	}
 	parserConfig := &parser.ParserConfig{
-		SheetName:     cfg.Parser.SheetName,
-		StrictMode:    cfg.Parser.StrictMode,
-		SkipEmptyRows: cfg.Parser.SkipEmptyRows,
-		MaxRows:       cfg.Parser.MaxRows,
+		SheetName:       cfg.Parser.SheetName,
+		SheetCandidates: parser.SheetCandidatesFromEnv(),
+		Schema:          schema.Name,
+		StrictMode:      cfg.Parser.StrictMode,
+		SkipEmptyRows:   cfg.Parser.SkipEmptyRows,
+		MaxRows:         cfg.Parser.MaxRows,
 	}
 	excelParser := parser.NewExcelParser(parserConfig)
+	parseMode, err := parser.ResolveParseMode(cfg.Parser.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("解析方式配置错误: %w", err)
+	}
+	var hybridParser *parser.HybridParser
+	if parseMode == parser.ParseModeHybrid || os.Getenv("RULE_WORKER_HYBRID_PARSE") == "true" {
+		hybridParser = parser.NewHybridParser(parserConfig)
+	}
+	log.Printf("解析方式: %s", parseMode)
 
-	// 初始化构建器
+	// 初始化构建器，层级按词典格式的分隔符和层级名称确定
 	builderConfig := &builder.BuilderConfig{
 		EnableOrphanHandling: cfg.Builder.EnableOrphanHandling,
 		StrictMode:           cfg.Builder.StrictMode,
+		Separator:            schema.Separator,
+		Levels:               schema.Levels,
 	}
 	hierarchyBuilder := builder.NewHierarchyBuilder(builderConfig)
 
+	// 加载并校验LLM提示词模板，模板有误时启动失败
+	processingConfig := integration.LoadProcessingConfig(cfg)
+	if err := integration.InitPromptTemplates(processingConfig.Prompts.TemplatesDir); err != nil {
+		return nil, fmt.Errorf("加载提示词模板失败: %w", err)
+	}
+	if err := integration.InitNameRules(processingConfig.Validation.NameRulesFile); err != nil {
+		return nil, fmt.Errorf("加载名称校验规则失败: %w", err)
+	}
+
 	// 初始化PDF和LLM处理器
 	pdfProcessor := integration.NewPDFLLMProcessor(cfg, db)
+	pdfProcessor.SetRetryConfig(processingConfig.Services.LLM)
+	pdfProcessor.SetHTTPConfig(processingConfig.HTTP)
 
 	// 初始化增量处理器
 	incrementalProcessor := integration.NewIncrementalProcessor(cfg, db)
+	incrementalProcessor.SetCancellationChecker(redisQueue)
+	incrementalProcessor.SetTaskLocker(redisQueue)
+	incrementalProcessor.SetRetryConfig(processingConfig.Services.LLM)
+	incrementalProcessor.SetHTTPConfig(processingConfig.HTTP)
+	incrementalProcessor.SetStepTimeouts(processingConfig.StepTimeouts)
+	incrementalProcessor.SetMinConfidence(processingConfig.Validation.MinConfidence)
+	incrementalProcessor.SetPDFCodeDedup(processingConfig.Merge.DedupPDFCodes)
+	incrementalProcessor.SetPDFResultReuse(processingConfig.PDFReplay.ReuseStoredResult)
+	incrementalProcessor.SetRuleOnlyFallback(processingConfig.Degradation.RuleOnlyOnLLMFailure)
+	incrementalProcessor.SetEnrichLevels(processingConfig.Enrichment.Levels)
+	dedupPolicy := dedupPolicyFromEnv()
+	incrementalProcessor.SetDedupPolicy(dedupPolicy)
 
 	return &RuleWorker{
 		config:               cfg,
@@ -124,14 +207,52 @@ func NewRuleWorker(cfg *config.Config) (*RuleWorker, error) {
 		queue:                redisQueue,
 		storage:              minioStorage,
 		parser:               excelParser,
+		hybridParser:         hybridParser,
+		parseMode:            parseMode,
 		builder:              hierarchyBuilder,
 		pdfProcessor:         pdfProcessor,
 		incrementalProcessor: incrementalProcessor,
+		healthGate:           integration.NewHealthGate(processingConfig),
+		notifier:             notify.NewTaskNotifier(db, notify.ConfigFromEnv()),
+		workerID:             resolveWorkerID(),
+		memorySampling:       os.Getenv("RULE_WORKER_MEMORY_SAMPLING") != "false",
+		ruleOnlyFallback:     processingConfig.Degradation.RuleOnlyOnLLMFailure,
+		autoSkipPDF:          os.Getenv("RULE_WORKER_AUTO_SKIP_PDF") == "true",
+		flows:                newFlowRegistry(),
+		dedupPolicy:          dedupPolicy,
+		categoryFlushSize:    database.CategoryFlushSizeFromEnv(),
+		dequeueTimeout:       dequeueTimeoutFromEnv(),
+		pollInterval:         pollIntervalFromEnv(),
+		claimTimeout:         claimTimeoutFromEnv(),
 	}, nil
 }
 
+// dedupPolicyFromEnv 读取 RULE_DEDUP_POLICY（first/complete），未设置或无效时使用完整性优先
+func dedupPolicyFromEnv() model.DedupPolicy {
+	v := os.Getenv("RULE_DEDUP_POLICY")
+	switch policy := model.DedupPolicy(v); policy {
+	case model.DedupFirst, model.DedupComplete:
+		return policy
+	case "":
+	default:
+		log.Printf("警告：RULE_DEDUP_POLICY 配置无效: %s，使用 %s", v, model.DedupComplete)
+	}
+	return model.DedupComplete
+}
+
+// resolveWorkerID 获取worker标识，优先使用 WORKER_ID，未设置时使用主机名
+func resolveWorkerID() string {
+	if id := os.Getenv("WORKER_ID"); id != "" {
+		return id
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	return "rule-worker"
+}
+
 func (w *RuleWorker) Start() error {
-	log.Println("规则处理Worker启动中...")
+	log.Printf("规则处理Worker启动中... (worker: %s)", w.workerID)
 
 	// 创建上下文
 	ctx, cancel := context.WithCancel(context.Background())
@@ -143,6 +264,11 @@ func (w *RuleWorker) Start() error {
 
 	// 启动工作循环
 	go w.workLoop(ctx)
+	go runStaleClaimRecovery(ctx, w.db, w.queue, w.claimTimeout)
+	go database.RunPoolStatsExport(ctx, w.db, database.PoolStatsIntervalFromEnv())
+	metricsExporter := integration.NewMetricsExporter(w.incrementalProcessor.MetricsCollector(), w.db, w.workerID)
+	metricsExporter.SetRetention(integration.MetricsRetentionFromEnv())
+	go metricsExporter.Run(ctx, integration.MetricsFlushIntervalFromEnv())
 
 	log.Println("规则处理Worker已启动，等待任务...")
 
@@ -157,37 +283,79 @@ func (w *RuleWorker) Start() error {
 	return nil
 }
 
+// workLoop 以阻塞出队等待任务，新任务入队后立即处理，空闲时阻塞在Redis上而不是反复轮询
 func (w *RuleWorker) workLoop(ctx context.Context) {
-	ticker := time.NewTicker(2 * time.Second) // 每2秒检查一次队列
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			w.processTask(ctx)
-		}
-	}
+	runDequeueLoop(ctx, w.pollInterval, w.processTask)
 }
 
-func (w *RuleWorker) processTask(ctx context.Context) {
+// processTask 出队并处理一个任务，返回 false 表示队列或任务依赖的下游不可用，调用方应等待后再出队
+func (w *RuleWorker) processTask(ctx context.Context) bool {
 	// 从队列获取任务
-	task, err := w.queue.DequeueTask("queue:rule")
+	task, err := w.queue.BlockingDequeue(ctx, "queue:rule", w.dequeueTimeout)
 	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		if errors.Is(err, queue.ErrQueueUnavailable) {
+			log.Printf("队列暂不可用，下个周期重试: %v", err)
+			return false
+		}
 		log.Printf("获取任务失败: %v", err)
-		return
+		return false
 	}
 
 	if task == nil {
-		// 队列为空，继续等待
-		return
+		// 等待超时，队列为空，继续等待
+		return true
 	}
 
-	log.Printf("开始处理规则任务: %s", task.ID)
+	// 以数据库条件更新领取任务，重复投递或多个worker取到同一任务时只有一个继续处理；
+	// 领取超时的 processing 任务视为原worker已退出，由本worker接管
+	taskRecord, err := w.db.ClaimTask(ctx, task.ID, w.workerID, w.claimTimeout)
+	if err != nil {
+		// 任务已出队，领取失败时放回队列，否则任务会一直停留在 pending
+		log.Printf("领取任务失败: %s, 错误: %v", task.ID, err)
+		w.requeueTask(ctx, task)
+		return false
+	}
+	if taskRecord == nil {
+		log.Printf("任务已被领取或已结束，跳过: %s", task.ID)
+		return true
+	}
+
+	if cancelled, err := w.queue.IsCancelRequested(ctx, task.ID); err != nil {
+		log.Printf("检查任务取消标记失败: %s, 错误: %v", task.ID, err)
+	} else if cancelled {
+		log.Printf("任务已取消，跳过处理: %s", task.ID)
+		w.markTaskCancelled(ctx, task.ID)
+		return true
+	}
+
+	flowOptions, err := taskFlowOptions(taskRecord.Config, taskRecord.PDFPath, w.autoSkipPDF)
+	if err == nil {
+		// 只检查任务需要的下游：跳过PDF的任务不受PDF服务影响；仅规则增强或开启规则降级时不受LLM服务影响
+		if downstreamErr := w.healthGate.CheckServices(ctx, flowOptions.RequiredServices(w.ruleOnlyFallback)...); downstreamErr != nil {
+			if w.healthGate.Mode() == integration.DownstreamModeHold {
+				// hold 模式下释放领取并放回队列，等待下游恢复
+				log.Printf("任务依赖的下游服务不可用，放回队列: %s, 错误: %v", task.ID, downstreamErr)
+				w.releaseTask(ctx, task)
+				return false
+			}
+			// fail_fast 模式下直接失败，不再下载和解析文件
+			err = downstreamErr
+			log.Printf("下游服务不可用，任务直接失败: %s, 错误: %v", task.ID, downstreamErr)
+		}
+	}
+	if err != nil {
+		w.queue.UpdateTaskStatus(task.ID, "failed", err.Error())
+		w.updateTaskInDB(ctx, task.ID, "failed", "", err.Error())
+		return true
+	}
+
+	log.Printf("开始处理规则任务: %s (worker: %s)", task.ID, w.workerID)
 
 	// 处理任务
-	if err := w.handleRuleTask(ctx, task); err != nil {
+	if err := w.handleRuleTask(ctx, task, taskRecord, flowOptions); err != nil {
 		log.Printf("处理任务失败: %s, 错误: %v", task.ID, err)
 
 		// 更新任务状态为失败
@@ -214,16 +382,45 @@ func (w *RuleWorker) processTask(ctx context.Context) {
 		// 更新任务状态为完成
 		w.queue.UpdateTaskStatus(task.ID, "completed", "")
 	}
+	return true
 }
 
-func (w *RuleWorker) handleRuleTask(ctx context.Context, task *queue.Task) error {
+// requeueTask 将已出队但未能领取的任务放回队列，入队失败时只记录日志
+func (w *RuleWorker) requeueTask(ctx context.Context, task *queue.Task) {
+	task.Status = "pending"
+	task.UpdatedAt = time.Now()
+	if err := w.queue.EnqueueTaskWithContext(ctx, task); err != nil {
+		log.Printf("任务重新入队失败: %s, 错误: %v", task.ID, err)
+	}
+}
+
+// releaseTask 释放已领取但未处理的任务并放回队列
+func (w *RuleWorker) releaseTask(ctx context.Context, task *queue.Task) {
+	if _, err := w.db.ReleaseTaskClaim(ctx, task.ID, w.workerID); err != nil {
+		// 未能释放时任务保持 processing，领取超时后由超时检查重新入队
+		log.Printf("释放任务失败: %s, 错误: %v", task.ID, err)
+		return
+	}
+	w.requeueTask(ctx, task)
+}
+
+// handleRuleTask 处理已领取的规则任务，taskRecord 为 ClaimTask 返回的任务记录，flowOptions 为任务的增量流程选项
+func (w *RuleWorker) handleRuleTask(ctx context.Context, task *queue.Task, taskRecord *database.TaskRecord, flowOptions integration.FlowOptions) error {
 	startTime := time.Now()
 
-	// 从数据库获取任务详情
-	taskRecord, err := w.db.GetTask(ctx, task.ID)
-	if err != nil {
-		return fmt.Errorf("获取任务记录失败: %w", err)
+	// 采样解析和构建期间的内存峰值，可通过 RULE_WORKER_MEMORY_SAMPLING=false 关闭
+	var sampler *memorySampler
+	if w.memorySampling {
+		sampler = startMemorySampler(0)
+	}
+	memoryUsageMB := 0.0
+	stopSampler := func() {
+		if sampler != nil {
+			memoryUsageMB = sampler.Stop()
+			sampler = nil
+		}
 	}
+	defer stopSampler()
 
 	// 从存储下载输入文件
 	inputReader, err := w.storage.DownloadFile(ctx, taskRecord.InputPath)
@@ -246,13 +443,39 @@ func (w *RuleWorker) handleRuleTask(ctx context.Context, task *queue.Task) error
 	}
 	tmpFile.Close()
 
-	// 1. 解析Excel文件
-	log.Printf("解析Excel文件: %s", taskRecord.InputPath)
-	records, err := w.parser.ParseFile(ctx, tmpFile.Name())
+	// 1. 解析Excel文件，任务配置的 max_rows 覆盖全局最大行数
+	maxRows, err := taskMaxRows(taskRecord.Config, w.parser.MaxRows())
 	if err != nil {
-		return fmt.Errorf("解析Excel失败: %w", err)
+		return err
+	}
+	taskParser := w.parser
+	if maxRows != w.parser.MaxRows() {
+		taskParser = w.parser.WithMaxRows(maxRows)
+	}
+	w.recordEffectiveMaxRows(ctx, taskRecord, maxRows)
+
+	var (
+		records       []*model.ParsedInfo
+		parseWarnings []model.ParseWarning
+		hybridResult  *model.HybridParseResult
+	)
+	if w.parseMode == parser.ParseModeHybrid {
+		log.Printf("混合解析Excel文件: %s (max_rows=%d)", taskRecord.InputPath, maxRows)
+		hybridResult, err = w.taskHybridParser(maxRows).ParseFile(ctx, tmpFile.Name())
+		if err != nil {
+			return fmt.Errorf("混合解析Excel失败: %w", err)
+		}
+		var pairWarnings []model.ParseWarning
+		records, pairWarnings = parser.HybridParsedInfos(hybridResult)
+		parseWarnings = append(hybridResult.Warnings, pairWarnings...)
+	} else {
+		log.Printf("解析Excel文件: %s (max_rows=%d)", taskRecord.InputPath, maxRows)
+		records, parseWarnings, err = taskParser.ParseFileWithWarnings(ctx, tmpFile.Name())
+		if err != nil {
+			return fmt.Errorf("解析Excel失败: %w", err)
+		}
 	}
-	log.Printf("成功解析 %d 条记录", len(records))
+	log.Printf("成功解析 %d 条记录，跳过 %d 处内容", len(records), len(parseWarnings))
 
 	// 2. 构建层级结构
 	log.Printf("构建层级结构...")
@@ -286,8 +509,12 @@ func (w *RuleWorker) handleRuleTask(ctx context.Context, task *queue.Task) error
 	}
 	log.Printf("层级结构已成功保存")
 
+	// 保存混合解析器以小类为单位打包的AI任务，用于检查V2混合方案，失败不影响规则处理
+	w.saveHybridParseResult(ctx, task.ID, tmpFile.Name(), maxRows, hybridResult)
+
 	// 4. 更新数据库任务记录
 	processingTime := time.Since(startTime)
+	stopSampler()
 	taskRecord.Status = "completed"
 	resultMap := map[string]string{"status": "completed", "message": "Hierarchy saved to database"}
 	resultJSON, _ := json.Marshal(resultMap)
@@ -296,8 +523,11 @@ func (w *RuleWorker) handleRuleTask(ctx context.Context, task *queue.Task) error
 	taskRecord.UpdatedAt = time.Now()
 	now := time.Now()
 	taskRecord.ProcessedAt = &now
-	taskRecord.ProcessingLog = fmt.Sprintf("处理时间: %v, 结果已存入数据库", processingTime)
+	// 与 completed 状态一起写入，后台增量流程结束前任务仍计入活跃任务数
+	taskRecord.FlowStartedAt = &now
+	taskRecord.ProcessingLog = fmt.Sprintf("处理时间: %v, 内存峰值增量: %.2fMB, 结果已存入数据库", processingTime, memoryUsageMB)
 
+	// 结束回调在后台增量流程结束后发送，回调中的结果包含LLM增强的统计
 	if err := w.db.UpdateTask(ctx, taskRecord); err != nil {
 		return fmt.Errorf("更新任务记录失败: %w", err)
 	}
@@ -307,10 +537,11 @@ func (w *RuleWorker) handleRuleTask(ctx context.Context, task *queue.Task) error
 		TaskID:           task.ID,
 		TotalRecords:     len(records),
 		ProcessedRecords: len(records), // 规则处理通常处理所有记录
-		SkippedRecords:   0,
+		SkippedRecords:   len(parseWarnings),
 		ErrorRecords:     0,
 		ProcessingTimeMs: processingTime.Milliseconds(),
-		MemoryUsageMB:    0, // TODO: 实现内存使用监控
+		MemoryUsageMB:    memoryUsageMB,
+		ParseWarnings:    encodeParseWarnings(parseWarnings),
 		CreatedAt:        time.Now(),
 	}
 
@@ -321,90 +552,92 @@ func (w *RuleWorker) handleRuleTask(ctx context.Context, task *queue.Task) error
 	log.Printf("规则处理完成，耗时: %v", processingTime)
 
 	// 6. 调用增量处理器进行5步流程处理（异步执行，不阻塞主流程）
-	log.Printf("开始增量处理流程（PDF验证和LLM语义分析）...")
-	go func() {
-		// 使用独立的context，避免主任务context取消影响LLM处理
-		llmCtx := context.Background()
-		if err := w.incrementalProcessor.ProcessIncrementalFlow(llmCtx, task.ID, taskRecord.InputPath, categories); err != nil {
-			log.Printf("警告：增量处理失败: %v", err)
-		} else {
-			log.Printf("增量处理流程完成")
-		}
-	}()
+	if flowOptions.SkipPDF {
+		log.Printf("开始增量处理流程（跳过PDF验证，增强方式: %s）...", flowOptions.Enrichment)
+	} else {
+		log.Printf("开始增量处理流程（PDF验证和LLM语义分析）...")
+	}
+	// 流程运行在worker持有的context下：不随本次处理的ctx结束，worker关闭时取消
+	started := w.flows.start(task.ID, func(llmCtx context.Context) {
+		err := w.incrementalProcessor.ProcessIncrementalFlowWithOptions(llmCtx, task.ID, taskRecord.InputPath, categories, flowOptions)
+		w.finishIncrementalFlow(llmCtx, task.ID, err)
+	})
+	if !started {
+		log.Printf("worker正在关闭，未启动增量处理: %s", task.ID)
+		w.clearFlowRunning(task.ID)
+		w.notifyTaskFinished(task.ID)
+		return nil
+	}
 	log.Printf("增量处理已在后台启动")
 
 	return nil
 }
 
 func (w *RuleWorker) saveHierarchyToDB(ctx context.Context, taskID string, categories []*model.Category) error {
-	var allCategories []*database.Category
-	processedCodes := make(map[string]bool) // 用于跟踪已处理的Code，防止重复
-	var flatten func([]*model.Category, string, int)
-
-	flatten = func(nodes []*model.Category, parentCode string, depth int) {
-		log.Printf("DEBUG: flatten调用 - depth=%d, 节点数=%d, parentCode=%s", depth, len(nodes), parentCode)
-		for i, node := range nodes {
-			if node == nil {
-				continue
-			}
-
-			log.Printf("DEBUG: 处理节点[%d] - Code=%s, Name=%s, Level=%s, 子节点数=%d",
-				i, node.Code, node.Name, node.Level, len(node.Children))
-
-			// 如果Code已经处理过，则跳过，防止违反数据库唯一约束
-			if _, ok := processedCodes[node.Code]; ok {
-				log.Printf("DEBUG: 跳过重复节点 - Code=%s", node.Code)
-				continue
-			}
-			dbCategory := &database.Category{
-				TaskID:     taskID,
-				Code:       node.Code,
-				Name:       node.Name,
-				Level:      node.Level,
-				ParentCode: parentCode,
-				Status:     "excel_parsed",
-				DataSource: "excel",
-			}
-			allCategories = append(allCategories, dbCategory)
-			processedCodes[node.Code] = true // 标记为已处理
-
-			log.Printf("DEBUG: 已添加节点到allCategories - Code=%s, allCategories长度=%d", node.Code, len(allCategories))
-
-			if len(node.Children) > 0 {
-				log.Printf("DEBUG: 递归处理子节点 - Code=%s, 子节点数=%d", node.Code, len(node.Children))
-				flatten(node.Children, node.Code, depth+1)
-			}
-		}
+	// 展开为扁平记录，重复编码只保留一条，防止违反数据库唯一约束；
+	// 完整性优先策略下保留最完整的名称，避免截断的名称因先出现而被保留
+	flatCategories, replacements := model.FlattenWithPolicy(categories, w.dedupPolicy)
+	log.Printf("DEBUG: flatten完成 - 根节点数=%d, 扁平记录数=%d", len(categories), len(flatCategories))
+	for _, r := range replacements {
+		log.Printf("重复编码 %s 使用更完整的记录: %s(%s) -> %s(%s)", r.Code, r.OldName, r.OldLevel, r.NewName, r.NewLevel)
 	}
 
-	log.Printf("DEBUG: 开始flatten处理 - 根节点数=%d", len(categories))
-	flatten(categories, "", 0) // 根节点的父编码为空字符串
-
-	if len(allCategories) == 0 {
+	if len(flatCategories) == 0 {
 		return nil // 没有需要插入的数据
 	}
 
-	// 使用版本化的批量插入方法，正确处理版本管理
-	log.Printf("DEBUG: saveHierarchyToDB - 准备插入 %d 条记录", len(allCategories))
+	// 任务重试时当前版本的内容可能已经相同，此时复用当前版本，不再写入重复的完整版本；
+	// 增量流程的步骤1以同样的方式展开和比较，不会再写入第二个版本
+	batchID := uuid.New().String()
+	reused, written, err := database.SaveFlatCategoryVersion(ctx, w.db, taskID, batchID, flatCategories, w.categoryFlushSize)
+	if err != nil {
+		log.Printf("ERROR: 保存分类版本失败: %v", err)
+		return err
+	}
+	if reused != "" {
+		log.Printf("任务 %s 的当前版本 %s 内容相同，复用该版本", taskID, reused)
+		return nil
+	}
+	log.Printf("DEBUG: 分类写入完成 - 批次ID=%s, 记录数=%d", batchID, written)
+	return nil
+}
 
-	// 检查第一条记录的字段设置情况
-	if len(allCategories) > 0 {
-		first := allCategories[0]
-		log.Printf("DEBUG: 第一条记录字段 - Status: %s, DataSource: %s", first.Status, first.DataSource)
+// recordEffectiveMaxRows 将实际使用的最大解析行数写入任务配置，失败时只记录日志
+func (w *RuleWorker) recordEffectiveMaxRows(ctx context.Context, taskRecord *database.TaskRecord, maxRows int) {
+	config, err := withEffectiveMaxRows(taskRecord.Config, maxRows)
+	if err != nil {
+		log.Printf("警告：记录任务 %s 的 max_rows 失败: %v", taskRecord.ID, err)
+		return
 	}
+	taskRecord.Config = config
+	if err := w.db.UpdateTask(ctx, taskRecord); err != nil {
+		log.Printf("警告：记录任务 %s 的 max_rows 失败: %v", taskRecord.ID, err)
+	}
+}
 
-	// 生成新的批次ID用于版本管理
-	batchID := uuid.New().String()
-	log.Printf("DEBUG: 生成新的批次ID: %s", batchID)
+// maxStoredParseWarnings 处理统计中保存的解析警告上限，超出部分只计入 SkippedRecords
+const maxStoredParseWarnings = 200
 
-	// 使用版本化插入方法，这会正确处理is_current字段
-	err := w.db.BatchInsertCategoriesWithVersion(ctx, taskID, batchID, allCategories)
+// encodeParseWarnings 截断并序列化解析警告
+func encodeParseWarnings(warnings []model.ParseWarning) datatypes.JSON {
+	if len(warnings) == 0 {
+		return nil
+	}
+	if len(warnings) > maxStoredParseWarnings {
+		warnings = warnings[:maxStoredParseWarnings]
+	}
+	data, err := json.Marshal(warnings)
 	if err != nil {
-		log.Printf("ERROR: BatchInsertCategoriesWithVersion 调用失败: %v", err)
-	} else {
-		log.Printf("DEBUG: BatchInsertCategoriesWithVersion 调用成功")
+		log.Printf("警告：序列化解析警告失败: %v", err)
+		return nil
 	}
-	return err
+	return datatypes.JSON(data)
+}
+
+// markTaskCancelled 将任务标记为已取消，已保存的分类数据保留以便查询
+func (w *RuleWorker) markTaskCancelled(ctx context.Context, taskID string) {
+	w.queue.UpdateTaskStatus(taskID, "cancelled", "")
+	w.updateTaskInDB(ctx, taskID, "cancelled", "", "任务已被用户取消")
 }
 
 func (w *RuleWorker) updateTaskInDB(ctx context.Context, taskID string, status string, result, errorMsg string) {
@@ -416,7 +649,9 @@ func (w *RuleWorker) updateTaskInDB(ctx context.Context, taskID string, status s
 
 	task.Status = status
 	task.UpdatedAt = time.Now()
-	if status == "completed" || status == "failed" {
+	task.ProcessedBy = w.workerID
+	finished := status == "completed" || status == "failed" || status == "cancelled"
+	if finished {
 		now := time.Now()
 		task.ProcessedAt = &now
 	}
@@ -429,10 +664,57 @@ func (w *RuleWorker) updateTaskInDB(ctx context.Context, taskID string, status s
 
 	if err := w.db.UpdateTask(ctx, task); err != nil {
 		log.Printf("更新任务记录失败: %v", err)
+		return
+	}
+	if finished {
+		w.notifyTaskFinished(taskID)
+	}
+}
+
+// finishIncrementalFlow 处理后台增量流程的结束：取消时标记任务已取消，否则发送任务结束回调。
+// 规则步骤已将任务置为 completed，增量流程失败或worker关闭中止时任务仍保持 completed，回调照常发送
+func (w *RuleWorker) finishIncrementalFlow(flowCtx context.Context, taskID string, err error) {
+	w.clearFlowRunning(taskID)
+
+	switch {
+	case errors.Is(err, integration.ErrTaskCancelled):
+		log.Printf("增量处理已取消: %s", taskID)
+		w.markTaskCancelled(flowCtx, taskID)
+		return
+	case err != nil && flowCtx.Err() != nil:
+		log.Printf("worker关闭，增量处理中止: %s", taskID)
+	case err != nil:
+		log.Printf("警告：增量处理失败: %v", err)
+	default:
+		log.Printf("增量处理流程完成")
 	}
+
+	// 在流程的goroutine中同步发送，worker关闭时会等待回调结束后再关闭数据库
+	if err := w.notifier.Notify(context.Background(), taskID); err != nil {
+		log.Printf("任务回调通知失败: %s, 错误: %v", taskID, err)
+	}
+}
+
+// clearFlowRunning 清除任务的后台流程标记，任务不再计入活跃任务数；worker关闭时流程ctx已取消，因此使用独立的context
+func (w *RuleWorker) clearFlowRunning(taskID string) {
+	if err := w.db.SetTaskFlowRunning(context.Background(), taskID, false); err != nil {
+		log.Printf("警告：清除任务 %s 的流程标记失败: %v", taskID, err)
+	}
+}
+
+// notifyTaskFinished 在后台向任务的回调地址发送终态通知，不阻塞任务处理
+func (w *RuleWorker) notifyTaskFinished(taskID string) {
+	go func() {
+		// 使用独立的context，避免主任务context取消后回调和重试被中断
+		if err := w.notifier.Notify(context.Background(), taskID); err != nil {
+			log.Printf("任务回调通知失败: %s, 错误: %v", taskID, err)
+		}
+	}()
 }
 
 func (w *RuleWorker) cleanup() {
+	// 先取消后台流程，流程退出前仍需访问数据库和队列
+	w.flows.shutdown(flowShutdownTimeout)
 	if err := w.db.Close(); err != nil {
 		log.Printf("关闭数据库失败: %v", err)
 	}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// memorySampler 在任务处理期间周期性采样堆内存，记录相对起始值的峰值增量
+type memorySampler struct {
+	interval  time.Duration
+	readHeap  func() uint64
+	startHeap uint64
+	peakHeap  uint64
+	samples   int
+	mu        sync.Mutex
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+}
+
+// memorySamplerStats 采样统计，Samples 为起始值之后的采样次数
+type memorySamplerStats struct {
+	Samples int
+	PeakMB  float64
+}
+
+// startMemorySampler 启动内存采样，interval<=0 时使用默认200ms
+func startMemorySampler(interval time.Duration) *memorySampler {
+	return newMemorySampler(interval, readHeapAlloc)
+}
+
+// newMemorySampler 使用指定的堆内存读取函数启动采样
+func newMemorySampler(interval time.Duration, readHeap func() uint64) *memorySampler {
+	if interval <= 0 {
+		interval = 200 * time.Millisecond
+	}
+
+	heap := readHeap()
+	s := &memorySampler{
+		interval:  interval,
+		readHeap:  readHeap,
+		startHeap: heap,
+		peakHeap:  heap,
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// run 采样循环
+func (s *memorySampler) run() {
+	defer close(s.doneCh)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.sample()
+		}
+	}
+}
+
+// sample 读取一次堆内存并更新峰值
+func (s *memorySampler) sample() {
+	heap := s.readHeap()
+	s.mu.Lock()
+	s.samples++
+	if heap > s.peakHeap {
+		s.peakHeap = heap
+	}
+	s.mu.Unlock()
+}
+
+// stats 返回当前的采样次数和峰值内存增量（MB），第一次采样前峰值为0
+func (s *memorySampler) stats() memorySamplerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := memorySamplerStats{Samples: s.samples}
+	if s.peakHeap > s.startHeap {
+		stats.PeakMB = float64(s.peakHeap-s.startHeap) / 1024 / 1024
+	}
+	return stats
+}
+
+// Stop 停止采样并返回任务期间的峰值内存增量（MB）
+func (s *memorySampler) Stop() float64 {
+	close(s.stopCh)
+	<-s.doneCh
+	s.sample()
+	return s.stats().PeakMB
+}
+
+// readHeapAlloc 读取当前堆内存分配量
+func readHeapAlloc() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
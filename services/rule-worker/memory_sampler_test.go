@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHeap 按顺序返回预设的堆内存值，用完后保持最后一个值
+type fakeHeap struct {
+	mu     sync.Mutex
+	values []uint64
+	reads  int
+}
+
+func (f *fakeHeap) read() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.reads
+	if i >= len(f.values) {
+		i = len(f.values) - 1
+	}
+	f.reads++
+	return f.values[i]
+}
+
+func TestMemorySampler_NoSamplesBeforeFirstTick(t *testing.T) {
+	heap := &fakeHeap{values: []uint64{10 << 20, 50 << 20}}
+	s := newMemorySampler(time.Hour, heap.read)
+
+	if stats := s.stats(); stats.Samples != 0 || stats.PeakMB != 0 {
+		t.Errorf("第一次采样前统计应为空，实际 %+v", stats)
+	}
+	// 停止时补充最后一次采样
+	if peak := s.Stop(); peak != 40 {
+		t.Errorf("expected peak 40MB, got %v", peak)
+	}
+	if stats := s.stats(); stats.Samples != 1 {
+		t.Errorf("停止后应有1次采样，实际 %d", stats.Samples)
+	}
+}
+
+func TestMemorySampler_TracksPeakAcrossTicks(t *testing.T) {
+	// 起始10MB，峰值在中间的采样，之后回落
+	heap := &fakeHeap{values: []uint64{10 << 20, 20 << 20, 74 << 20, 30 << 20, 12 << 20}}
+	s := newMemorySampler(time.Millisecond, heap.read)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.stats().Samples < len(heap.values)-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("采样未按间隔执行，统计 %+v", s.stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if stats := s.stats(); stats.PeakMB != 64 {
+		t.Errorf("expected peak 64MB, got %+v", stats)
+	}
+
+	if peak := s.Stop(); peak != 64 {
+		t.Errorf("回落后峰值应保持64MB，实际 %v", peak)
+	}
+}
+
+func TestMemorySampler_NoGrowthReportsZero(t *testing.T) {
+	heap := &fakeHeap{values: []uint64{40 << 20, 30 << 20}}
+	s := newMemorySampler(time.Hour, heap.read)
+	if peak := s.Stop(); peak != 0 {
+		t.Errorf("堆内存未超过起始值时峰值增量应为0，实际 %v", peak)
+	}
+}
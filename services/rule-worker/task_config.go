@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/freedkr/moonshot/internal/integration"
+	"gorm.io/datatypes"
+)
+
+// taskMaxRows 读取任务配置中的 max_rows（0表示不限制），未设置时使用全局配置 defaultMaxRows
+func taskMaxRows(config datatypes.JSON, defaultMaxRows int) (int, error) {
+	if len(config) == 0 {
+		return defaultMaxRows, nil
+	}
+	var taskConfig struct {
+		MaxRows *int `json:"max_rows"`
+	}
+	if err := json.Unmarshal(config, &taskConfig); err != nil {
+		return 0, fmt.Errorf("解析任务配置失败: %w", err)
+	}
+	if taskConfig.MaxRows == nil {
+		return defaultMaxRows, nil
+	}
+	if *taskConfig.MaxRows < 0 {
+		return 0, fmt.Errorf("max_rows 不能为负数: %d", *taskConfig.MaxRows)
+	}
+	return *taskConfig.MaxRows, nil
+}
+
+// withEffectiveMaxRows 在任务配置中记录实际使用的最大解析行数 effective_max_rows
+func withEffectiveMaxRows(config datatypes.JSON, maxRows int) (datatypes.JSON, error) {
+	taskConfig := make(map[string]interface{})
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &taskConfig); err != nil {
+			return nil, fmt.Errorf("解析任务配置失败: %w", err)
+		}
+	}
+	if taskConfig == nil {
+		taskConfig = make(map[string]interface{})
+	}
+	taskConfig["effective_max_rows"] = maxRows
+	data, err := json.Marshal(taskConfig)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(data), nil
+}
+
+// taskFlowOptions 读取任务配置中的 skip_pdf 和 enrichment（llm/rule）
+// 未设置 skip_pdf 时，若开启了 autoSkip 且任务没有关联PDF（pdfPath 为空）则跳过PDF步骤；
+// 上传接口不接收PDF，只有导入的任务包带有PDF，因此 autoSkip 实际上是对上传任务的全局开关
+func taskFlowOptions(config datatypes.JSON, pdfPath string, autoSkip bool) (integration.FlowOptions, error) {
+	var taskConfig struct {
+		SkipPDF    *bool  `json:"skip_pdf"`
+		Enrichment string `json:"enrichment"`
+	}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &taskConfig); err != nil {
+			return integration.FlowOptions{}, fmt.Errorf("解析任务配置失败: %w", err)
+		}
+	}
+	enrichment, err := integration.ParseEnrichmentMode(taskConfig.Enrichment)
+	if err != nil {
+		return integration.FlowOptions{}, err
+	}
+	skipPDF := autoSkip && pdfPath == ""
+	if taskConfig.SkipPDF != nil {
+		skipPDF = *taskConfig.SkipPDF
+	}
+	return integration.FlowOptions{SkipPDF: skipPDF, Enrichment: enrichment}, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/freedkr/moonshot/internal/integration"
+	"gorm.io/datatypes"
+)
+
+func TestTaskMaxRows(t *testing.T) {
+	cases := []struct {
+		config   string
+		expected int
+	}{
+		{``, 1000},
+		{`{}`, 1000},
+		{`{"max_rows":500}`, 500},
+		{`{"max_rows":0}`, 0},
+	}
+	for _, tc := range cases {
+		got, err := taskMaxRows(datatypes.JSON(tc.config), 1000)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.config, err)
+		}
+		if got != tc.expected {
+			t.Errorf("%q: expected %d, got %d", tc.config, tc.expected, got)
+		}
+	}
+
+	for _, config := range []string{`{"max_rows":-1}`, `{"max_rows":"abc"}`} {
+		if _, err := taskMaxRows(datatypes.JSON(config), 1000); err == nil {
+			t.Errorf("%q: expected error", config)
+		}
+	}
+}
+
+func TestWithEffectiveMaxRows(t *testing.T) {
+	for _, config := range []string{``, `null`, `{"max_rows":500,"source":"preview"}`} {
+		data, err := withEffectiveMaxRows(datatypes.JSON(config), 500)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", config, err)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%q: 解析结果失败: %v", config, err)
+		}
+		if got["effective_max_rows"] != float64(500) {
+			t.Errorf("%q: expected effective_max_rows 500, got %v", config, got)
+		}
+		if config != `` && config != `null` && got["source"] != "preview" {
+			t.Errorf("%q: existing config should be kept, got %v", config, got)
+		}
+	}
+}
+
+func TestTaskFlowOptions(t *testing.T) {
+	cases := []struct {
+		config     string
+		pdfPath    string
+		autoSkip   bool
+		skipPDF    bool
+		enrichment integration.EnrichmentMode
+	}{
+		{``, "", false, false, integration.EnrichmentLLM},
+		{``, "", true, true, integration.EnrichmentLLM},
+		{``, "uploads/a.pdf", true, false, integration.EnrichmentLLM},
+		{`{"skip_pdf":true,"enrichment":"rule"}`, "uploads/a.pdf", false, true, integration.EnrichmentRule},
+		{`{"skip_pdf":false}`, "", true, false, integration.EnrichmentLLM},
+	}
+	for _, tc := range cases {
+		got, err := taskFlowOptions(datatypes.JSON(tc.config), tc.pdfPath, tc.autoSkip)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.config, err)
+		}
+		if got.SkipPDF != tc.skipPDF || got.Enrichment != tc.enrichment {
+			t.Errorf("%q pdf=%q auto=%v: expected skip=%v enrichment=%s, got %+v", tc.config, tc.pdfPath, tc.autoSkip, tc.skipPDF, tc.enrichment, got)
+		}
+	}
+
+	for _, config := range []string{`{"enrichment":"pdf"}`, `{"skip_pdf":"yes"}`} {
+		if _, err := taskFlowOptions(datatypes.JSON(config), "", false); err == nil {
+			t.Errorf("%q: expected error", config)
+		}
+	}
+}